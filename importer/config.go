@@ -17,7 +17,6 @@ import (
 	"flag"
 	"fmt"
 
-	"github.com/BurntSushi/toml"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-tools/pkg/importer"
 	"github.com/pingcap/tidb-tools/pkg/utils"
@@ -34,6 +33,7 @@ func NewConfig() *Config {
 
 	fs.StringVar(&cfg.TableSQL, "t", "", "create table sql")
 	fs.StringVar(&cfg.IndexSQL, "i", "", "create index sql")
+	fs.IntVar(&cfg.TableCount, "table-count", 0, "the number of tables generated from the create table and index sql templates, 0 means not use template")
 
 	fs.IntVar(&cfg.WorkerCount, "c", 2, "parallel worker count")
 	fs.IntVar(&cfg.JobCount, "n", 10000, "total job count")
@@ -41,7 +41,7 @@ func NewConfig() *Config {
 
 	fs.StringVar(&cfg.DBCfg.Host, "h", "127.0.0.1", "set the database host ip")
 	fs.StringVar(&cfg.DBCfg.User, "u", "root", "set the database user")
-	fs.StringVar(&cfg.DBCfg.Password, "p", "", "set the database password")
+	fs.StringVar(&cfg.DBCfg.Password, "p", "", "set the database password, can be \"env:VAR_NAME\" or \"file:/path\"")
 	fs.StringVar(&cfg.DBCfg.Schema, "D", "test", "set the database name")
 	fs.IntVar(&cfg.DBCfg.Port, "P", 3306, "set the database host port")
 
@@ -61,49 +61,18 @@ type Config struct {
 	configFile   string
 }
 
-// Parse parses flag definitions from the argument list.
+// Parse parses flag definitions from the argument list, the flags can also be set by the environment variables
+// prefixed with "IMPORTER_", like IMPORTER_TABLE_COUNT, which override the config file.
 func (c *Config) Parse(arguments []string) error {
-	// Parse first to get config file.
-	err := c.FlagSet.Parse(arguments)
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	if c.printVersion {
-		fmt.Printf(utils.GetRawInfo("importer"))
-		return flag.ErrHelp
-	}
-
-	// Load config file if specified.
-	if c.configFile != "" {
-		err = c.configFromFile(c.configFile)
-		if err != nil {
-			return errors.Trace(err)
-		}
-	}
-
-	// Parse again to replace with command line options.
-	err = c.FlagSet.Parse(arguments)
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	if len(c.FlagSet.Args()) != 0 {
-		return errors.Errorf("'%s' is an invalid flag", c.FlagSet.Arg(0))
-	}
-
-	return nil
+	binder := utils.NewConfigBinder(c.FlagSet, "IMPORTER_").
+		WithConfigFile(&c.configFile, c).
+		WithVersion(&c.printVersion, "importer")
+	return errors.Trace(binder.Parse(arguments))
 }
 
 func (c *Config) String() string {
 	if c == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("Config(%+v)", *c)
-}
-
-// configFromFile loads config from file.
-func (c *Config) configFromFile(path string) error {
-	_, err := toml.DecodeFile(path, c)
-	return errors.Trace(err)
+	return fmt.Sprintf("Config(%s)", utils.MaskSecrets(c))
 }
@@ -32,13 +32,15 @@ func main() {
 	case flag.ErrHelp:
 		os.Exit(0)
 	default:
-		log.Error("parse cmd flags failed", zap.Error(err))
+		err = utils.ErrInvalidConfig.Wrap(err, "parse cmd flags")
+		log.Error("parse cmd flags failed", zap.Error(err), utils.ZapErrCode(err))
 		os.Exit(2)
 	}
 
 	importerCfg := &importer.Config{
 		TableSQL:    cfg.TableSQL,
 		IndexSQL:    cfg.IndexSQL,
+		TableCount:  cfg.TableCount,
 		LogLevel:    cfg.LogLevel,
 		WorkerCount: cfg.WorkerCount,
 		JobCount:    cfg.JobCount,
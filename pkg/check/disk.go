@@ -0,0 +1,167 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/errors"
+)
+
+// DiskUsage is the space and the mount option of the filesystem of a directory.
+type DiskUsage struct {
+	// the bytes available to the unprivileged users
+	Available uint64
+	Total     uint64
+	ReadOnly  bool
+}
+
+// nearestExistingDir returns the directory itself if it exists, otherwise its nearest existing ancestor, where the
+// directory will be created by the tools.
+func nearestExistingDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return "", errors.NotValidf("%s is not a directory", dir)
+			}
+			return dir, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", errors.Trace(err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.NotFoundf("directory %s", dir)
+		}
+		dir = parent
+	}
+}
+
+// checkWritable creates and removes a temporary file in the directory.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".tidb-tools-check-")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	name := f.Name()
+	if err = f.Close(); err != nil {
+		os.Remove(name)
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Remove(name))
+}
+
+/*****************************************************/
+
+// OutputDirChecker checks whether the output directory, like the dump, relay or fix sql directory, is writable and
+// has enough free space, so the tools don't fail after running for hours. the directory is created by the tools if
+// it doesn't exist, its nearest existing ancestor is checked instead.
+type OutputDirChecker struct {
+	// the name of the directory in the config, like "fix-sql-dir"
+	name string
+	dir  string
+	// the estimated bytes written to the directory, 0 means unknown
+	estimatedSize uint64
+	// the free space should be left after writing the estimated bytes
+	reservedSize uint64
+
+	getDiskUsage func(dir string) (*DiskUsage, error)
+}
+
+// NewOutputDirChecker returns a Checker, the directory should be writable, not on a read-only mount, and have
+// estimatedSize+reservedSize bytes free at least. estimatedSize 0 means the written bytes are unknown.
+func NewOutputDirChecker(name, dir string, estimatedSize, reservedSize uint64) Checker {
+	return &OutputDirChecker{
+		name:          name,
+		dir:           dir,
+		estimatedSize: estimatedSize,
+		reservedSize:  reservedSize,
+		getDiskUsage:  GetDiskUsage,
+	}
+}
+
+// Check implements the Checker interface.
+func (pc *OutputDirChecker) Check(ctx context.Context) *Result {
+	result := &Result{
+		Name:  pc.Name(),
+		Desc:  "check whether the output directory is writable and has enough free space",
+		State: StateFailure,
+		Extra: fmt.Sprintf("%s - %s", pc.name, pc.dir),
+	}
+
+	dir, err := nearestExistingDir(pc.dir)
+	if err != nil {
+		markCheckError(result, err)
+		result.Instruction = fmt.Sprintf("please set %s to a directory", pc.name)
+		return result
+	}
+
+	usage, err := pc.getDiskUsage(dir)
+	if err != nil {
+		markCheckError(result, err)
+		return result
+	}
+	if usage.ReadOnly {
+		result.ErrorMsg = fmt.Sprintf("%s is on a read-only filesystem", dir)
+		result.Instruction = fmt.Sprintf("please set %s to a directory on a writable filesystem", pc.name)
+		return result
+	}
+
+	if err = checkWritable(dir); err != nil {
+		result.ErrorMsg = fmt.Sprintf("%s is not writable: %v", dir, err)
+		result.Instruction = fmt.Sprintf("please grant the write permission of %s to the current user", dir)
+		return result
+	}
+
+	pc.checkSpace(usage, result)
+	return result
+}
+
+func (pc *OutputDirChecker) checkSpace(usage *DiskUsage, result *Result) {
+	// the space is unknown on some platforms
+	if usage.Total == 0 {
+		result.State = StateWarning
+		result.ErrorMsg = "the free space of the filesystem is unknown"
+		return
+	}
+
+	needed := pc.estimatedSize + pc.reservedSize
+	if usage.Available < needed {
+		result.ErrorMsg = fmt.Sprintf("the filesystem has %d bytes free, but %d bytes are needed", usage.Available, needed)
+		result.Instruction = fmt.Sprintf("please free some space or set %s to a directory on a larger filesystem", pc.name)
+		if pc.estimatedSize == 0 {
+			// the written bytes are unknown, the tools may still succeed
+			result.State = StateWarning
+		}
+		return
+	}
+
+	result.State = StateSuccess
+}
+
+// Name implements the Checker interface.
+func (pc *OutputDirChecker) Name() string {
+	return "output directory checker"
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// +build linux darwin freebsd unix
+
+package check
+
+import (
+	"syscall"
+
+	"github.com/pingcap/errors"
+)
+
+// readOnlyFlag is ST_RDONLY in linux, and MNT_RDONLY in darwin and freebsd.
+const readOnlyFlag = 0x1
+
+// GetDiskUsage returns the space and the mount option of the filesystem of the directory.
+// http://man7.org/linux/man-pages/man2/statfs.2.html
+func GetDiskUsage(dir string) (*DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return nil, errors.Annotatef(err, "statfs %s", dir)
+	}
+
+	return &DiskUsage{
+		Available: uint64(st.Bavail) * uint64(st.Bsize),
+		Total:     uint64(st.Blocks) * uint64(st.Bsize),
+		ReadOnly:  uint64(st.Flags)&readOnlyFlag != 0,
+	}, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	tc "github.com/pingcap/check"
+)
+
+func (t *testCheckSuite) TestOutputDirChecker(c *tc.C) {
+	dir, err := ioutil.TempDir("", "output-dir-checker")
+	c.Assert(err, tc.IsNil)
+	defer os.RemoveAll(dir)
+
+	// the directory is created by the tools
+	notExist := filepath.Join(dir, "a", "b")
+	existing, err := nearestExistingDir(notExist)
+	c.Assert(err, tc.IsNil)
+	c.Assert(existing, tc.Equals, dir)
+
+	file := filepath.Join(dir, "file")
+	c.Assert(ioutil.WriteFile(file, nil, 0644), tc.IsNil)
+	result := NewOutputDirChecker("fix-sql-dir", file, 0, 0).Check(context.Background())
+	c.Assert(result.State, tc.Equals, StateFailure)
+
+	cases := []struct {
+		usage         DiskUsage
+		estimatedSize uint64
+		state         State
+	}{
+		{DiskUsage{Available: 100, Total: 1000}, 50, StateSuccess},
+		{DiskUsage{Available: 100, Total: 1000}, 90, StateFailure},
+		{DiskUsage{Available: 5, Total: 1000}, 0, StateWarning},
+		{DiskUsage{Available: 100, Total: 1000, ReadOnly: true}, 0, StateFailure},
+		{DiskUsage{}, 0, StateWarning},
+	}
+	for _, cs := range cases {
+		checker := NewOutputDirChecker("fix-sql-dir", notExist, cs.estimatedSize, 10).(*OutputDirChecker)
+		usage := cs.usage
+		checker.getDiskUsage = func(string) (*DiskUsage, error) { return &usage, nil }
+		result := checker.Check(context.Background())
+		c.Assert(result.State, tc.Equals, cs.state, tc.Commentf("usage %+v", cs.usage))
+	}
+
+	// the real filesystem of the temporary directory
+	result = NewOutputDirChecker("fix-sql-dir", notExist, 0, 0).Check(context.Background())
+	c.Assert(result.State, tc.Not(tc.Equals), StateFailure, tc.Commentf("%s", result.ErrorMsg))
+}
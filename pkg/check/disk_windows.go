@@ -0,0 +1,46 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// +build windows
+
+package check
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pingcap/errors"
+)
+
+var procGetDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// GetDiskUsage returns the space of the filesystem of the directory, the read-only volumes are found by writing
+// the directory.
+func GetDiskUsage(dir string) (*DiskUsage, error) {
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var available, total, free uint64
+	ret, _, e := procGetDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&available)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&free)),
+	)
+	if ret == 0 {
+		return nil, errors.Annotatef(e, "GetDiskFreeSpaceEx %s", dir)
+	}
+
+	return &DiskUsage{Available: available, Total: total}, nil
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/pingcap/parser"
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
 	_ "github.com/pingcap/tidb/types/parser_driver" // for parser driver
 )
 
@@ -159,3 +160,109 @@ func verifyPrivileges(result *Result, grants []string, expectedGrants []string)
 	result.State = StateSuccess
 	return
 }
+
+/*****************************************************/
+
+// TablePrivilege is a privilege needed on the table or the schema.
+type TablePrivilege struct {
+	Privilege string `json:"privilege"`
+	Schema    string `json:"schema"`
+	// empty means the privilege is needed on the whole schema
+	Table string `json:"table,omitempty"`
+}
+
+// String returns the privilege on the object, like "SELECT ON `db`.`t`".
+func (p *TablePrivilege) String() string {
+	if len(p.Table) == 0 {
+		return fmt.Sprintf("%s ON `%s`.*", p.Privilege, p.Schema)
+	}
+	return fmt.Sprintf("%s ON %s", p.Privilege, dbutil.TableName(p.Schema, p.Table))
+}
+
+// MissingPrivileges returns the privileges not granted by the grant statements of SHOW GRANTS, the privilege is
+// granted if it's granted on the table, the schema or all the schemas, or ALL PRIVILEGES is granted. the privileges
+// of the roles and the column privileges are not counted.
+func MissingPrivileges(grants []string, privileges []*TablePrivilege) []*TablePrivilege {
+	granted := make(map[string]struct{})
+	for _, grant := range grants {
+		for _, privilege := range diff.CanonicalizeGrant(grant) {
+			granted[privilege] = struct{}{}
+		}
+	}
+
+	var missing []*TablePrivilege
+	for _, p := range privileges {
+		objects := []string{"*.*", p.Schema + ".*"}
+		if len(p.Table) != 0 {
+			objects = append(objects, p.Schema+"."+p.Table)
+		}
+
+		hasPrivilege := false
+		for _, object := range objects {
+			for _, privilege := range []string{p.Privilege, "ALL PRIVILEGES"} {
+				if _, ok := granted[privilege+" ON "+object]; ok {
+					hasPrivilege = true
+				}
+			}
+		}
+		if !hasPrivilege {
+			missing = append(missing, p)
+		}
+	}
+
+	return missing
+}
+
+// TablePrivilegeChecker checks whether the current user has the privileges on the tables and schemas,
+// for example SELECT on the compared tables.
+type TablePrivilegeChecker struct {
+	db         *sql.DB
+	dbinfo     *dbutil.DBConfig
+	privileges []*TablePrivilege
+}
+
+// NewTablePrivilegeChecker returns a Checker.
+func NewTablePrivilegeChecker(db *sql.DB, dbinfo *dbutil.DBConfig, privileges []*TablePrivilege) Checker {
+	return &TablePrivilegeChecker{db: db, dbinfo: dbinfo, privileges: privileges}
+}
+
+// Check implements the Checker interface.
+func (pc *TablePrivilegeChecker) Check(ctx context.Context) *Result {
+	result := &Result{
+		Name:  pc.Name(),
+		Desc:  "check privileges on the tables",
+		State: StateFailure,
+		Extra: fmt.Sprintf("address of db instance - %s:%d", pc.dbinfo.Host, pc.dbinfo.Port),
+	}
+
+	grants, err := dbutil.ShowGrants(ctx, pc.db, "", "")
+	if err != nil {
+		markCheckError(result, err)
+		return result
+	}
+
+	pc.verifyPrivileges(grants, result)
+	return result
+}
+
+func (pc *TablePrivilegeChecker) verifyPrivileges(grants []string, result *Result) {
+	missing := MissingPrivileges(grants, pc.privileges)
+	if len(missing) == 0 {
+		result.State = StateSuccess
+		return
+	}
+
+	privileges := make([]string, 0, len(missing))
+	instructions := make([]string, 0, len(missing))
+	for _, p := range missing {
+		privileges = append(privileges, p.String())
+		instructions = append(instructions, fmt.Sprintf("GRANT %s TO '%s'@'%s';", p, pc.dbinfo.User, "%"))
+	}
+	result.ErrorMsg = fmt.Sprintf("lack of privileges %s", strings.Join(privileges, ", "))
+	result.Instruction = strings.Join(instructions, "\n")
+}
+
+// Name implements the Checker interface.
+func (pc *TablePrivilegeChecker) Name() string {
+	return "table privilege checker"
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	tc "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
 )
 
 func TestClient(t *testing.T) {
@@ -114,3 +115,38 @@ func (t *testCheckSuite) TestVerifyPrivileges(c *tc.C) {
 		c.Assert(result.State, tc.Equals, cs.replcationState)
 	}
 }
+
+func (t *testCheckSuite) TestTablePrivilegeChecker(c *tc.C) {
+	privileges := []*TablePrivilege{
+		{Privilege: "SELECT", Schema: "test", Table: "t1"},
+		{Privilege: "SELECT", Schema: "test", Table: "t2"},
+		{Privilege: "CREATE", Schema: "sync_diff_inspector"},
+		{Privilege: "INSERT", Schema: "sync_diff_inspector"},
+	}
+
+	grants := []string{
+		"GRANT USAGE ON *.* TO 'user'@'%'",
+		"GRANT SELECT ON `test`.`t1` TO 'user'@'%'",
+		"GRANT SELECT (`a`) ON `test`.`t2` TO 'user'@'%'",
+		"GRANT CREATE, INSERT ON `sync_diff_inspector`.* TO 'user'@'%'",
+	}
+	c.Assert(MissingPrivileges(grants, privileges), tc.DeepEquals, []*TablePrivilege{privileges[1]})
+	c.Assert(MissingPrivileges([]string{"GRANT SELECT, CREATE, INSERT ON *.* TO 'user'@'%'"}, privileges), tc.HasLen, 0)
+	c.Assert(MissingPrivileges([]string{"GRANT ALL PRIVILEGES ON *.* TO 'user'@'%'"}, privileges), tc.HasLen, 0)
+	c.Assert(MissingPrivileges([]string{"GRANT ALL ON `test`.* TO 'user'@'%'"}, privileges), tc.HasLen, 2)
+
+	checker := NewTablePrivilegeChecker(nil, &dbutil.DBConfig{User: "user"}, privileges).(*TablePrivilegeChecker)
+	result := &Result{State: StateFailure}
+	checker.verifyPrivileges(grants, result)
+	c.Assert(result.State, tc.Equals, StateFailure)
+	c.Assert(result.ErrorMsg, tc.Equals, "lack of privileges SELECT ON `test`.`t2`")
+	c.Assert(result.Instruction, tc.Equals, "GRANT SELECT ON `test`.`t2` TO 'user'@'%';")
+
+	result = &Result{State: StateFailure}
+	checker.verifyPrivileges(grants[3:], result)
+	c.Assert(result.ErrorMsg, tc.Equals, "lack of privileges SELECT ON `test`.`t1`, SELECT ON `test`.`t2`")
+
+	result = &Result{State: StateFailure}
+	checker.verifyPrivileges(append(grants, "GRANT SELECT ON `test`.* TO 'user'@'%'"), result)
+	c.Assert(result.State, tc.Equals, StateSuccess)
+}
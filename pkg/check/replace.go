@@ -0,0 +1,123 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// ReplaceChecker checks whether the REPLACE statements of the fix sql replace the rows in the target tables, REPLACE
+// only deletes the old row if it conflicts by the primary key or a unique key, otherwise the row is inserted again.
+// the table without primary key and unique key fails the check, and the table only has nullable unique keys is warned,
+// because the rows with NULL in the keys never conflict.
+type ReplaceChecker struct {
+	db     *sql.DB
+	dbinfo *dbutil.DBConfig
+	tables map[string][]string // schema => []table
+}
+
+// NewReplaceChecker returns a Checker.
+func NewReplaceChecker(db *sql.DB, dbinfo *dbutil.DBConfig, tables map[string][]string) Checker {
+	return &ReplaceChecker{db: db, dbinfo: dbinfo, tables: tables}
+}
+
+// Check implements the Checker interface.
+func (pc *ReplaceChecker) Check(ctx context.Context) *Result {
+	result := &Result{
+		Name:  pc.Name(),
+		Desc:  "check whether REPLACE replaces the rows in the tables",
+		State: StateFailure,
+		Extra: fmt.Sprintf("address of db instance - %s:%d", pc.dbinfo.Host, pc.dbinfo.Port),
+	}
+
+	var noKeyTables, nullableKeyTables []string
+	for schema, tables := range pc.tables {
+		for _, table := range tables {
+			tableInfo, err := dbutil.GetTableInfo(ctx, pc.db, schema, table)
+			if err != nil {
+				markCheckError(result, err)
+				return result
+			}
+
+			switch replaceKey(tableInfo) {
+			case replaceKeyNone:
+				noKeyTables = append(noKeyTables, dbutil.TableName(schema, table))
+			case replaceKeyNullable:
+				nullableKeyTables = append(nullableKeyTables, dbutil.TableName(schema, table))
+			}
+		}
+	}
+	sort.Strings(noKeyTables)
+	sort.Strings(nullableKeyTables)
+
+	switch {
+	case len(noKeyTables) != 0:
+		result.ErrorMsg = fmt.Sprintf("tables %s have no primary key or unique key", strings.Join(noKeyTables, ", "))
+		result.Instruction = "the fix sql may insert duplicated rows into the tables, please add primary key or unique key, or fix them manually"
+	case len(nullableKeyTables) != 0:
+		result.State = StateWarning
+		result.ErrorMsg = fmt.Sprintf("tables %s only have nullable unique keys", strings.Join(nullableKeyTables, ", "))
+		result.Instruction = "the fix sql may insert duplicated rows with NULL in the unique keys, please check them manually"
+	default:
+		result.State = StateSuccess
+	}
+	return result
+}
+
+// Name implements the Checker interface.
+func (pc *ReplaceChecker) Name() string {
+	return "replace checker"
+}
+
+const (
+	replaceKeyNone = iota
+	replaceKeyNullable
+	replaceKeyNotNull
+)
+
+// replaceKey returns the kind of the best key the REPLACE statements conflict by.
+func replaceKey(tableInfo *model.TableInfo) int {
+	if tableInfo.PKIsHandle {
+		return replaceKeyNotNull
+	}
+
+	kind := replaceKeyNone
+	for _, index := range tableInfo.Indices {
+		if !index.Primary && !index.Unique {
+			continue
+		}
+		notNull := true
+		for _, indexCol := range index.Columns {
+			col := dbutil.FindColumnByName(tableInfo.Columns, indexCol.Name.O)
+			if col == nil || !mysql.HasNotNullFlag(col.Flag) {
+				notNull = false
+				break
+			}
+		}
+		if index.Primary || notNull {
+			return replaceKeyNotNull
+		}
+		kind = replaceKeyNullable
+	}
+
+	return kind
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	tc "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+func (t *testCheckSuite) TestReplaceKey(c *tc.C) {
+	cases := []struct {
+		createTableSQL string
+		kind           int
+	}{
+		{"CREATE TABLE t (a INT PRIMARY KEY, b INT)", replaceKeyNotNull},
+		{"CREATE TABLE t (a VARCHAR(10), b INT, PRIMARY KEY (a, b))", replaceKeyNotNull},
+		{"CREATE TABLE t (a INT NOT NULL, b INT, UNIQUE KEY (a))", replaceKeyNotNull},
+		{"CREATE TABLE t (a INT, b INT NOT NULL, UNIQUE KEY (a), UNIQUE KEY (b))", replaceKeyNotNull},
+		{"CREATE TABLE t (a INT, b INT NOT NULL, UNIQUE KEY (a, b))", replaceKeyNullable},
+		{"CREATE TABLE t (a INT, b INT, KEY (a))", replaceKeyNone},
+	}
+
+	for _, cs := range cases {
+		tableInfo, err := dbutil.GetTableInfoBySQL(cs.createTableSQL)
+		c.Assert(err, tc.IsNil)
+		c.Assert(replaceKey(tableInfo), tc.Equals, cs.kind, tc.Commentf("sql %s", cs.createTableSQL))
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/filter"
+)
+
+// SourceObject is a trigger, event or stored routine in the source database.
+type SourceObject struct {
+	Schema  string `json:"schema"`
+	Name    string `json:"name"`
+	Definer string `json:"definer"`
+	// the table of the trigger, the status of the event, empty for the stored routines
+	Detail string `json:"detail,omitempty"`
+}
+
+// SourceObjects is the inventory of the objects which are not replicated or compared, they should be created in the
+// target database manually if needed.
+type SourceObjects struct {
+	// the value of the variable event_scheduler, for example "ON", "OFF" or "DISABLED"
+	EventScheduler string          `json:"event-scheduler"`
+	Triggers       []*SourceObject `json:"triggers"`
+	Events         []*SourceObject `json:"events"`
+	Procedures     []*SourceObject `json:"procedures"`
+	Functions      []*SourceObject `json:"functions"`
+}
+
+// Empty returns true if there is no trigger, event or stored routine.
+func (o *SourceObjects) Empty() bool {
+	return len(o.Triggers) == 0 && len(o.Events) == 0 && len(o.Procedures) == 0 && len(o.Functions) == 0
+}
+
+// FetchSourceObjects fetches the triggers, events and stored routines in the schemas from information_schema.
+// the empty schemas means all the schemas except the system schemas.
+func FetchSourceObjects(ctx context.Context, db *sql.DB, schemas []string) (*SourceObjects, error) {
+	objects := &SourceObjects{}
+
+	eventScheduler, err := dbutil.ShowMySQLVariable(ctx, db, "event_scheduler")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	objects.EventScheduler = eventScheduler
+
+	/*
+		mysql> SELECT TRIGGER_SCHEMA, TRIGGER_NAME, DEFINER, EVENT_OBJECT_TABLE FROM information_schema.TRIGGERS;
+		+----------------+--------------+----------------+--------------------+
+		| TRIGGER_SCHEMA | TRIGGER_NAME | DEFINER        | EVENT_OBJECT_TABLE |
+		+----------------+--------------+----------------+--------------------+
+		| test           | tr1          | root@localhost | t1                 |
+		+----------------+--------------+----------------+--------------------+
+	*/
+	objects.Triggers, err = fetchSourceObjects(ctx, db, "SELECT TRIGGER_SCHEMA, TRIGGER_NAME, DEFINER, EVENT_OBJECT_TABLE FROM information_schema.TRIGGERS", "TRIGGER_SCHEMA", schemas)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	objects.Events, err = fetchSourceObjects(ctx, db, "SELECT EVENT_SCHEMA, EVENT_NAME, DEFINER, STATUS FROM information_schema.EVENTS", "EVENT_SCHEMA", schemas)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	objects.Procedures, err = fetchSourceObjects(ctx, db, "SELECT ROUTINE_SCHEMA, ROUTINE_NAME, DEFINER, '' FROM information_schema.ROUTINES WHERE ROUTINE_TYPE = 'PROCEDURE'", "ROUTINE_SCHEMA", schemas)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	objects.Functions, err = fetchSourceObjects(ctx, db, "SELECT ROUTINE_SCHEMA, ROUTINE_NAME, DEFINER, '' FROM information_schema.ROUTINES WHERE ROUTINE_TYPE = 'FUNCTION'", "ROUTINE_SCHEMA", schemas)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return objects, nil
+}
+
+// fetchSourceObjects executes the query which selects the schema, name, definer and detail of the objects,
+// the objects are filtered by the schema column.
+func fetchSourceObjects(ctx context.Context, db *sql.DB, query string, schemaColumn string, schemas []string) ([]*SourceObject, error) {
+	where := " WHERE "
+	if strings.Contains(query, " WHERE ") {
+		where = " AND "
+	}
+
+	var args []interface{}
+	if len(schemas) > 0 {
+		query += where + schemaColumn + " IN (" + strings.TrimSuffix(strings.Repeat("?,", len(schemas)), ",") + ")"
+		for _, schema := range schemas {
+			args = append(args, schema)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var objects []*SourceObject
+	for rows.Next() {
+		var schema, name, definer, detail sql.NullString
+		if err = rows.Scan(&schema, &name, &definer, &detail); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if len(schemas) == 0 && filter.IsSystemSchema(schema.String) {
+			continue
+		}
+		objects = append(objects, &SourceObject{
+			Schema:  schema.String,
+			Name:    name.String,
+			Definer: definer.String,
+			Detail:  detail.String,
+		})
+	}
+
+	return objects, errors.Trace(rows.Err())
+}
+
+/*****************************************************/
+
+// SourceObjectsChecker inventories the triggers, events and stored routines in the source database, they are not
+// replicated or compared, so the check is warned if any of them exists.
+type SourceObjectsChecker struct {
+	db      *sql.DB
+	dbinfo  *dbutil.DBConfig
+	schemas []string
+
+	inventory *SourceObjects
+}
+
+// NewSourceObjectsChecker returns a Checker, the empty schemas means all the schemas except the system schemas.
+func NewSourceObjectsChecker(db *sql.DB, dbinfo *dbutil.DBConfig, schemas []string) *SourceObjectsChecker {
+	return &SourceObjectsChecker{db: db, dbinfo: dbinfo, schemas: schemas}
+}
+
+// Check implements the Checker interface.
+func (pc *SourceObjectsChecker) Check(ctx context.Context) *Result {
+	result := &Result{
+		Name:  pc.Name(),
+		Desc:  "check whether triggers, events and stored routines exist",
+		State: StateFailure,
+		Extra: fmt.Sprintf("address of db instance - %s:%d", pc.dbinfo.Host, pc.dbinfo.Port),
+	}
+
+	objects, err := FetchSourceObjects(ctx, pc.db, pc.schemas)
+	if err != nil {
+		markCheckError(result, err)
+		return result
+	}
+	pc.inventory = objects
+
+	pc.checkObjects(objects, result)
+	return result
+}
+
+func (pc *SourceObjectsChecker) checkObjects(objects *SourceObjects, result *Result) {
+	if objects.Empty() {
+		result.State = StateSuccess
+		return
+	}
+
+	var information bytes.Buffer
+	writeObjects := func(kind string, objs []*SourceObject) {
+		if len(objs) == 0 {
+			return
+		}
+		names := make([]string, 0, len(objs))
+		for _, obj := range objs {
+			names = append(names, dbutil.TableName(obj.Schema, obj.Name))
+		}
+		fmt.Fprintf(&information, "%d %s: %s\n", len(objs), kind, strings.Join(names, ", "))
+	}
+	writeObjects("triggers", objects.Triggers)
+	writeObjects("events", objects.Events)
+	writeObjects("procedures", objects.Procedures)
+	writeObjects("functions", objects.Functions)
+	if len(objects.Events) > 0 {
+		fmt.Fprintf(&information, "event_scheduler is %s\n", objects.EventScheduler)
+	}
+
+	result.State = StateWarning
+	result.ErrorMsg = information.String()
+	result.Instruction = "triggers, events and stored routines are not replicated or compared, please create them in the target database manually if needed"
+}
+
+// Inventory returns the objects found by the latest check, nil if not checked or the check failed.
+func (pc *SourceObjectsChecker) Inventory() *SourceObjects {
+	return pc.inventory
+}
+
+// Name implements the Checker interface.
+func (pc *SourceObjectsChecker) Name() string {
+	return "source_objects"
+}
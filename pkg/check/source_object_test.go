@@ -0,0 +1,56 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	tc "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+func (t *testCheckSuite) TestSourceObjectsChecker(c *tc.C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, tc.IsNil)
+	defer db.Close()
+
+	columns := []string{"SCHEMA", "NAME", "DEFINER", "DETAIL"}
+	mock.ExpectQuery("SHOW GLOBAL VARIABLES LIKE 'event_scheduler'").WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("event_scheduler", "ON"))
+	mock.ExpectQuery("FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA IN \\(\\?,\\?\\)").WithArgs("test", "test2").WillReturnRows(sqlmock.NewRows(columns).AddRow("test", "tr1", "root@localhost", "t1"))
+	mock.ExpectQuery("FROM information_schema.EVENTS WHERE EVENT_SCHEMA IN").WithArgs("test", "test2").WillReturnRows(sqlmock.NewRows(columns).AddRow("test2", "e1", "root@localhost", "ENABLED"))
+	mock.ExpectQuery("FROM information_schema.ROUTINES WHERE ROUTINE_TYPE = 'PROCEDURE' AND ROUTINE_SCHEMA IN").WithArgs("test", "test2").WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery("FROM information_schema.ROUTINES WHERE ROUTINE_TYPE = 'FUNCTION' AND ROUTINE_SCHEMA IN").WithArgs("test", "test2").WillReturnRows(sqlmock.NewRows(columns))
+
+	checker := NewSourceObjectsChecker(db, &dbutil.DBConfig{}, []string{"test", "test2"})
+	result := checker.Check(context.Background())
+	c.Assert(mock.ExpectationsWereMet(), tc.IsNil)
+	c.Assert(result.State, tc.Equals, StateWarning)
+	c.Assert(result.ErrorMsg, tc.Equals, "1 triggers: `test`.`tr1`\n1 events: `test2`.`e1`\nevent_scheduler is ON\n")
+	c.Assert(checker.Inventory(), tc.DeepEquals, &SourceObjects{
+		EventScheduler: "ON",
+		Triggers:       []*SourceObject{{Schema: "test", Name: "tr1", Definer: "root@localhost", Detail: "t1"}},
+		Events:         []*SourceObject{{Schema: "test2", Name: "e1", Definer: "root@localhost", Detail: "ENABLED"}},
+	})
+
+	// the system schemas are ignored
+	mock.ExpectQuery("SHOW GLOBAL VARIABLES").WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("event_scheduler", "OFF"))
+	mock.ExpectQuery("FROM information_schema.TRIGGERS$").WillReturnRows(sqlmock.NewRows(columns).AddRow("sys", "sys_config_insert_set_user", "mysql.sys@localhost", "sys_config"))
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(columns))
+	}
+	result = NewSourceObjectsChecker(db, &dbutil.DBConfig{}, nil).Check(context.Background())
+	c.Assert(mock.ExpectationsWereMet(), tc.IsNil)
+	c.Assert(result.State, tc.Equals, StateSuccess)
+}
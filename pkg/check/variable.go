@@ -0,0 +1,190 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// showSessionVariable returns the value of the session variable, returns false if the variable is not supported,
+// for example max_execution_time in MariaDB.
+func showSessionVariable(ctx context.Context, db *sql.DB, variable string) (string, bool, error) {
+	var name, value string
+	query := fmt.Sprintf("SHOW VARIABLES LIKE '%s'", variable)
+	err := db.QueryRowContext(ctx, query).Scan(&name, &value)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Trace(err)
+	}
+
+	return value, true, nil
+}
+
+/*****************************************************/
+
+// SessionTimeoutChecker checks whether max_execution_time and wait_timeout are long enough, the queries are killed
+// by max_execution_time, and the idle connections are closed by wait_timeout.
+type SessionTimeoutChecker struct {
+	db     *sql.DB
+	dbinfo *dbutil.DBConfig
+	// the longest time of the queries, 0 means the queries are not limited
+	queryTimeout time.Duration
+	// the longest time the connections are idle
+	idleTimeout time.Duration
+}
+
+// NewSessionTimeoutChecker returns a Checker, max_execution_time should be 0 or not less than queryTimeout, and
+// wait_timeout should not be less than idleTimeout. queryTimeout 0 means the queries are not limited.
+func NewSessionTimeoutChecker(db *sql.DB, dbinfo *dbutil.DBConfig, queryTimeout, idleTimeout time.Duration) Checker {
+	return &SessionTimeoutChecker{db: db, dbinfo: dbinfo, queryTimeout: queryTimeout, idleTimeout: idleTimeout}
+}
+
+// Check implements the Checker interface.
+func (pc *SessionTimeoutChecker) Check(ctx context.Context) *Result {
+	result := &Result{
+		Name:  pc.Name(),
+		Desc:  "check whether max_execution_time and wait_timeout are long enough",
+		State: StateFailure,
+		Extra: fmt.Sprintf("address of db instance - %s:%d", pc.dbinfo.Host, pc.dbinfo.Port),
+	}
+
+	// in milliseconds, 0 means no limit
+	maxExecutionTime, ok, err := showSessionVariable(ctx, pc.db, "max_execution_time")
+	if err != nil {
+		markCheckError(result, err)
+		return result
+	}
+	if !ok {
+		maxExecutionTime = "0"
+	}
+	// in seconds
+	waitTimeout, _, err := showSessionVariable(ctx, pc.db, "wait_timeout")
+	if err != nil {
+		markCheckError(result, err)
+		return result
+	}
+
+	pc.checkTimeouts(maxExecutionTime, waitTimeout, result)
+	return result
+}
+
+func (pc *SessionTimeoutChecker) checkTimeouts(maxExecutionTime, waitTimeout string, result *Result) {
+	executionMs, err := strconv.ParseInt(maxExecutionTime, 10, 64)
+	if err != nil {
+		markCheckError(result, errors.NotValidf("max_execution_time %s", maxExecutionTime))
+		return
+	}
+	if executionMs != 0 && (pc.queryTimeout == 0 || time.Duration(executionMs)*time.Millisecond < pc.queryTimeout) {
+		expected := "0"
+		if pc.queryTimeout != 0 {
+			expected = strconv.FormatInt(int64(pc.queryTimeout/time.Millisecond), 10)
+		}
+		result.ErrorMsg = fmt.Sprintf("max_execution_time is %dms, the long queries may be killed", executionMs)
+		result.Instruction = fmt.Sprintf("please set max_execution_time to 0 or not less than %s", expected)
+		return
+	}
+
+	if len(waitTimeout) != 0 && pc.idleTimeout > 0 {
+		waitSeconds, err := strconv.ParseInt(waitTimeout, 10, 64)
+		if err != nil {
+			markCheckError(result, errors.NotValidf("wait_timeout %s", waitTimeout))
+			return
+		}
+		if time.Duration(waitSeconds)*time.Second < pc.idleTimeout {
+			result.ErrorMsg = fmt.Sprintf("wait_timeout is %ds, the idle connections may be closed", waitSeconds)
+			result.Instruction = fmt.Sprintf("please set wait_timeout to not less than %d", int64(pc.idleTimeout/time.Second))
+			return
+		}
+	}
+
+	result.State = StateSuccess
+}
+
+// Name implements the Checker interface.
+func (pc *SessionTimeoutChecker) Name() string {
+	return "session timeout checker"
+}
+
+/*****************************************************/
+
+// DiffIncompatibleSQLModes are the sql modes incompatible with comparing the data and the fix sql,
+// the strings in the fix sql are escaped by backslashes, and the trailing spaces of CHAR are compared.
+var DiffIncompatibleSQLModes = []string{"NO_BACKSLASH_ESCAPES", "PAD_CHAR_TO_FULL_LENGTH"}
+
+// SQLModeChecker checks whether the session's sql_mode contains the incompatible modes.
+type SQLModeChecker struct {
+	db                *sql.DB
+	dbinfo            *dbutil.DBConfig
+	incompatibleModes []string
+}
+
+// NewSQLModeChecker returns a Checker.
+func NewSQLModeChecker(db *sql.DB, dbinfo *dbutil.DBConfig, incompatibleModes []string) Checker {
+	return &SQLModeChecker{db: db, dbinfo: dbinfo, incompatibleModes: incompatibleModes}
+}
+
+// Check implements the Checker interface.
+func (pc *SQLModeChecker) Check(ctx context.Context) *Result {
+	result := &Result{
+		Name:  pc.Name(),
+		Desc:  "check whether sql_mode is compatible",
+		State: StateFailure,
+		Extra: fmt.Sprintf("address of db instance - %s:%d", pc.dbinfo.Host, pc.dbinfo.Port),
+	}
+
+	sqlMode, _, err := showSessionVariable(ctx, pc.db, "sql_mode")
+	if err != nil {
+		markCheckError(result, err)
+		return result
+	}
+
+	pc.checkSQLMode(sqlMode, result)
+	return result
+}
+
+func (pc *SQLModeChecker) checkSQLMode(sqlMode string, result *Result) {
+	modes := make(map[string]struct{})
+	for _, mode := range strings.Split(strings.ToUpper(sqlMode), ",") {
+		modes[strings.TrimSpace(mode)] = struct{}{}
+	}
+
+	incompatible := make([]string, 0, len(pc.incompatibleModes))
+	for _, mode := range pc.incompatibleModes {
+		if _, ok := modes[strings.ToUpper(mode)]; ok {
+			incompatible = append(incompatible, mode)
+		}
+	}
+	if len(incompatible) != 0 {
+		result.ErrorMsg = fmt.Sprintf("sql_mode %s contains the incompatible modes %s", sqlMode, strings.Join(incompatible, ","))
+		result.Instruction = fmt.Sprintf("please remove %s from sql_mode", strings.Join(incompatible, ","))
+		return
+	}
+
+	result.State = StateSuccess
+}
+
+// Name implements the Checker interface.
+func (pc *SQLModeChecker) Name() string {
+	return "sql mode checker"
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	tc "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+func (t *testCheckSuite) TestSessionTimeoutChecker(c *tc.C) {
+	cases := []struct {
+		queryTimeout     time.Duration
+		maxExecutionTime string
+		waitTimeout      string
+		state            State
+	}{
+		{0, "0", "28800", StateSuccess},
+		{0, "60000", "28800", StateFailure},
+		{time.Minute, "60000", "28800", StateSuccess},
+		{time.Minute, "30000", "28800", StateFailure},
+		{time.Minute, "0", "30", StateFailure},
+		{time.Minute, "0", "", StateSuccess},
+		{time.Minute, "abc", "28800", StateFailure},
+	}
+	for _, cs := range cases {
+		checker := NewSessionTimeoutChecker(nil, &dbutil.DBConfig{}, cs.queryTimeout, time.Minute).(*SessionTimeoutChecker)
+		result := &Result{State: StateFailure}
+		checker.checkTimeouts(cs.maxExecutionTime, cs.waitTimeout, result)
+		c.Assert(result.State, tc.Equals, cs.state, tc.Commentf("case %+v", cs))
+	}
+
+	// max_execution_time is not supported in MariaDB
+	db, mock, err := sqlmock.New()
+	c.Assert(err, tc.IsNil)
+	defer db.Close()
+	mock.ExpectQuery("SHOW VARIABLES LIKE 'max_execution_time'").WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}))
+	mock.ExpectQuery("SHOW VARIABLES LIKE 'wait_timeout'").WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("wait_timeout", "28800"))
+	result := NewSessionTimeoutChecker(db, &dbutil.DBConfig{}, 0, time.Minute).Check(context.Background())
+	c.Assert(mock.ExpectationsWereMet(), tc.IsNil)
+	c.Assert(result.State, tc.Equals, StateSuccess)
+}
+
+func (t *testCheckSuite) TestSQLModeChecker(c *tc.C) {
+	checker := NewSQLModeChecker(nil, &dbutil.DBConfig{}, DiffIncompatibleSQLModes).(*SQLModeChecker)
+
+	result := &Result{State: StateFailure}
+	checker.checkSQLMode("ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", result)
+	c.Assert(result.State, tc.Equals, StateSuccess)
+
+	result = &Result{State: StateFailure}
+	checker.checkSQLMode("STRICT_TRANS_TABLES,no_backslash_escapes,PAD_CHAR_TO_FULL_LENGTH", result)
+	c.Assert(result.State, tc.Equals, StateFailure)
+	c.Assert(result.Instruction, tc.Equals, "please remove NO_BACKSLASH_ESCAPES,PAD_CHAR_TO_FULL_LENGTH from sql_mode")
+}
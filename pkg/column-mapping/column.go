@@ -18,6 +18,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-tools/pkg/table-rule-selector"
@@ -47,6 +48,9 @@ const (
 	AddPrefix   Expr = "add prefix"
 	AddSuffix   Expr = "add suffix"
 	PartitionID Expr = "partition id"
+
+	ShiftDatetime   Expr = "shift datetime"
+	ConvertTimezone Expr = "convert timezone"
 )
 
 // Exprs is some built-in expression for column mapping
@@ -68,6 +72,11 @@ var Exprs = map[Expr]func(*mappingInfo, []interface{}) ([]interface{}, error){
 	//  example: schema = schema_1 table = t_1  => arguments[1] = "schema_", arguments[2] = "t_"
 	//  if arguments[1]/arguments[2] == "", it means we don't use schemaID/tableID to compute partition ID
 	PartitionID: partitionID,
+	// arguments contains [offset], the datetime is shifted by the offset, for example "8h" or "-30m"
+	ShiftDatetime: shiftDatetime,
+	// arguments contains [from timezone, to timezone], the datetime in from timezone is converted to to timezone,
+	// the timezone can be an offset like "+08:00" or a name like "Asia/Shanghai"
+	ConvertTimezone: convertTimezone,
 }
 
 // Rule is a rule to map column
@@ -112,9 +121,50 @@ func (r *Rule) Valid() error {
 		}
 	}
 
+	if r.Expression == ShiftDatetime {
+		if len(r.Arguments) != 1 {
+			return errors.NotValidf("arguments %v for shift datetime", r.Arguments)
+		}
+		if _, err := time.ParseDuration(r.Arguments[0]); err != nil {
+			return errors.NotValidf("offset %s for shift datetime", r.Arguments[0])
+		}
+	}
+
+	if r.Expression == ConvertTimezone {
+		if len(r.Arguments) != 2 {
+			return errors.NotValidf("arguments %v for convert timezone", r.Arguments)
+		}
+		for _, tz := range r.Arguments {
+			if _, err := loadTimezone(tz); err != nil {
+				return errors.Annotatef(err, "convert timezone")
+			}
+		}
+	}
+
 	return nil
 }
 
+// Inverse returns the rule maps the target column's mapped value back to the original value, for example to compare
+// the transformed data in the original form. only shift datetime and convert timezone can be inverted.
+func (r *Rule) Inverse() (*Rule, error) {
+	if err := r.Valid(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	inverse := *r
+	switch r.Expression {
+	case ShiftDatetime:
+		offset, _ := time.ParseDuration(r.Arguments[0])
+		inverse.Arguments = []string{(-offset).String()}
+	case ConvertTimezone:
+		inverse.Arguments = []string{r.Arguments[1], r.Arguments[0]}
+	default:
+		return nil, errors.NotSupportedf("inverse of column mapping expression %s", r.Expression)
+	}
+
+	return &inverse, nil
+}
+
 // check source and target position
 func (r *Rule) adjustColumnPosition(source, target int) (int, int, error) {
 	// if not found target, ignore it
@@ -134,6 +184,12 @@ type mappingInfo struct {
 	instanceID int64
 	schemaID   int64
 	tableID    int64
+
+	// for shift datetime
+	offset time.Duration
+	// for convert timezone
+	fromLocation *time.Location
+	toLocation   *time.Location
 }
 
 // Mapping maps column to something by rules
@@ -297,8 +353,11 @@ func (m *Mapping) queryColumnInfo(schema, table string, columns []string) (*mapp
 	var info = &mappingInfo{
 		ignore: true,
 	}
-	rules := m.Match(schema, table)
-	if len(rules) == 0 {
+	rule, err := m.matchRule(schema, table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if rule == nil {
 		m.cache.Lock()
 		m.cache.infos[tableName(schema, table)] = info
 		m.cache.Unlock()
@@ -306,6 +365,56 @@ func (m *Mapping) queryColumnInfo(schema, table string, columns []string) (*mapp
 		return info, nil
 	}
 
+	// compute source and target column position
+	sourcePosition := findColumnPosition(columns, rule.SourceColumn)
+	targetPosition := findColumnPosition(columns, rule.TargetColumn)
+
+	sourcePosition, targetPosition, err = rule.adjustColumnPosition(sourcePosition, targetPosition)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	info = &mappingInfo{
+		sourcePosition: sourcePosition,
+		targetPosition: targetPosition,
+		rule:           rule,
+	}
+
+	// if expr is partition ID, compute schema and table ID
+	if rule.Expression == PartitionID {
+		info.instanceID, info.schemaID, info.tableID, err = computePartitionID(schema, table, rule)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	switch rule.Expression {
+	case ShiftDatetime:
+		info.offset, err = time.ParseDuration(rule.Arguments[0])
+	case ConvertTimezone:
+		info.fromLocation, err = loadTimezone(rule.Arguments[0])
+		if err == nil {
+			info.toLocation, err = loadTimezone(rule.Arguments[1])
+		}
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	m.cache.Lock()
+	m.cache.infos[tableName(schema, table)] = info
+	m.cache.Unlock()
+
+	return info, nil
+}
+
+// matchRule returns the rule matched by the table, returns nil if no rule matches.
+func (m *Mapping) matchRule(schema, table string) (*Rule, error) {
+	rules := m.Match(schema, table)
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
 	var (
 		schemaRules []*Rule
 		tableRules  = make([]*Rule, 0, 1)
@@ -326,56 +435,99 @@ func (m *Mapping) queryColumnInfo(schema, table string, columns []string) (*mapp
 	}
 
 	// only support one expression for one table now, refine it later
-	var rule *Rule
 	if len(table) == 0 || len(tableRules) == 0 {
 		if len(schemaRules) != 1 {
 			return nil, errors.NotSupportedf("route %s/%s to rule set(%d)", schema, table, len(schemaRules))
 		}
 
-		rule = schemaRules[0]
-	} else {
-		if len(tableRules) != 1 {
-			return nil, errors.NotSupportedf("route %s/%s to rule set(%d)", schema, table, len(tableRules))
-		}
+		return schemaRules[0], nil
+	}
 
-		rule = tableRules[0]
+	if len(tableRules) != 1 {
+		return nil, errors.NotSupportedf("route %s/%s to rule set(%d)", schema, table, len(tableRules))
 	}
-	if rule == nil {
-		m.cache.Lock()
-		m.cache.infos[tableName(schema, table)] = info
-		m.cache.Unlock()
 
-		return info, nil
+	return tableRules[0], nil
+}
+
+// HandleSQLExpr returns the SQL expression which computes the mapped value of the target column from the table's row,
+// so the mapping can be applied by the database, for example to compare the source and target data.
+// returns empty column if no rule matches the table.
+func (m *Mapping) HandleSQLExpr(schema, table string) (string, string, error) {
+	if m == nil {
+		return "", "", nil
 	}
 
-	// compute source and target column position
-	sourcePosition := findColumnPosition(columns, rule.SourceColumn)
-	targetPosition := findColumnPosition(columns, rule.TargetColumn)
+	schemaL, tableL := schema, table
+	if !m.caseSensitive {
+		schemaL, tableL = strings.ToLower(schema), strings.ToLower(table)
+	}
 
-	sourcePosition, targetPosition, err := rule.adjustColumnPosition(sourcePosition, targetPosition)
-	if err != nil {
-		return nil, errors.Trace(err)
+	rule, err := m.matchRule(schemaL, tableL)
+	if err != nil || rule == nil {
+		return "", "", errors.Trace(err)
 	}
 
-	info = &mappingInfo{
-		sourcePosition: sourcePosition,
-		targetPosition: targetPosition,
-		rule:           rule,
+	return ruleSQLExpr(rule, schemaL, tableL)
+}
+
+// HandleInverseSQLExpr returns the SQL expression which computes the original value of the target column from the
+// mapped row like HandleSQLExpr, by the inverse of the matched rule. returns empty column if no rule matches the table.
+func (m *Mapping) HandleInverseSQLExpr(schema, table string) (string, string, error) {
+	if m == nil {
+		return "", "", nil
 	}
 
-	// if expr is partition ID, compute schema and table ID
-	if rule.Expression == PartitionID {
-		info.instanceID, info.schemaID, info.tableID, err = computePartitionID(schema, table, rule)
+	schemaL, tableL := schema, table
+	if !m.caseSensitive {
+		schemaL, tableL = strings.ToLower(schema), strings.ToLower(table)
+	}
+
+	rule, err := m.matchRule(schemaL, tableL)
+	if err != nil || rule == nil {
+		return "", "", errors.Trace(err)
+	}
+	inverse, err := rule.Inverse()
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+
+	return ruleSQLExpr(inverse, schemaL, tableL)
+}
+
+// ruleSQLExpr returns the target column and the SQL expression which computes the mapped value by the rule.
+func ruleSQLExpr(rule *Rule, schemaL, tableL string) (string, string, error) {
+	column := fmt.Sprintf("`%s`", strings.Replace(rule.TargetColumn, "`", "``", -1))
+	switch rule.Expression {
+	case AddPrefix:
+		return rule.TargetColumn, fmt.Sprintf("CONCAT(%s, %s)", quoteString(rule.Arguments[0]), column), nil
+	case AddSuffix:
+		return rule.TargetColumn, fmt.Sprintf("CONCAT(%s, %s)", column, quoteString(rule.Arguments[0])), nil
+	case PartitionID:
+		instanceID, schemaID, tableID, err := computePartitionID(schemaL, tableL, rule)
 		if err != nil {
-			return nil, errors.Trace(err)
+			return "", "", errors.Trace(err)
+		}
+		return rule.TargetColumn, fmt.Sprintf("(%s | %d)", column, instanceID|schemaID|tableID), nil
+	case ShiftDatetime:
+		offset, err := time.ParseDuration(rule.Arguments[0])
+		if err != nil {
+			return "", "", errors.NotValidf("offset %s for shift datetime", rule.Arguments[0])
 		}
+		// the interval of microseconds makes the datetime's fractional seconds 6 digits, only use it if necessary
+		if offset%time.Second == 0 {
+			return rule.TargetColumn, fmt.Sprintf("DATE_ADD(%s, INTERVAL %d SECOND)", column, offset/time.Second), nil
+		}
+		return rule.TargetColumn, fmt.Sprintf("DATE_ADD(%s, INTERVAL %d MICROSECOND)", column, offset/time.Microsecond), nil
+	case ConvertTimezone:
+		return rule.TargetColumn, fmt.Sprintf("CONVERT_TZ(%s, %s, %s)", column, quoteString(rule.Arguments[0]), quoteString(rule.Arguments[1])), nil
+	default:
+		return "", "", errors.NotSupportedf("column mapping expression %s in SQL", rule.Expression)
 	}
+}
 
-	m.cache.Lock()
-	m.cache.infos[tableName(schema, table)] = info
-	m.cache.Unlock()
-
-	return info, nil
+func quoteString(s string) string {
+	return fmt.Sprintf("'%s'", strings.NewReplacer(`\`, `\\`, "'", "''").Replace(s))
 }
 
 func (m *Mapping) resetCache() {
@@ -518,3 +670,67 @@ func computeID(name string, prefix string, bitSize int, shiftCount uint) (int64,
 
 	return int64(id << shiftCount), nil
 }
+
+// loadTimezone returns the location of the timezone, which can be an offset like "+08:00" or a name like "UTC".
+func loadTimezone(tz string) (*time.Location, error) {
+	if len(tz) == 6 && (tz[0] == '+' || tz[0] == '-') && tz[3] == ':' {
+		hours, err1 := strconv.ParseUint(tz[1:3], 10, 8)
+		minutes, err2 := strconv.ParseUint(tz[4:], 10, 8)
+		if err1 != nil || err2 != nil || hours > 14 || minutes > 59 {
+			return nil, errors.NotValidf("timezone %s", tz)
+		}
+		offset := int(hours*3600 + minutes*60)
+		if tz[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone(tz, offset), nil
+	}
+
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.NotValidf("timezone %s", tz)
+	}
+	return location, nil
+}
+
+// datetimeLayout is the layout of the datetime's string value, the fractional seconds are parsed even if not in layout.
+const datetimeLayout = "2006-01-02 15:04:05"
+
+// mapDatetime maps the target column's datetime value by fn, the value can be time.Time or the string like
+// "2006-01-02 15:04:05.000", and the string keeps the number of fractional digits. the value's wall clock is regarded
+// as the time in location. NULL is not mapped.
+func mapDatetime(info *mappingInfo, vals []interface{}, location *time.Location, fn func(time.Time) time.Time) ([]interface{}, error) {
+	switch value := vals[info.targetPosition].(type) {
+	case nil:
+	case time.Time:
+		t := time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), value.Nanosecond(), location)
+		vals[info.targetPosition] = fn(t)
+	case string:
+		t, err := time.ParseInLocation(datetimeLayout, value, location)
+		if err != nil {
+			return nil, errors.NotValidf("column %d value is not datetime, but %v", info.targetPosition, value)
+		}
+
+		layout := datetimeLayout
+		if dot := strings.IndexByte(value, '.'); dot >= 0 {
+			layout += "." + strings.Repeat("0", len(value)-dot-1)
+		}
+		vals[info.targetPosition] = fn(t).Format(layout)
+	default:
+		return nil, errors.NotValidf("type %T(%v)", value, value)
+	}
+
+	return vals, nil
+}
+
+func shiftDatetime(info *mappingInfo, vals []interface{}) ([]interface{}, error) {
+	return mapDatetime(info, vals, time.UTC, func(t time.Time) time.Time {
+		return t.Add(info.offset)
+	})
+}
+
+func convertTimezone(info *mappingInfo, vals []interface{}) ([]interface{}, error) {
+	return mapDatetime(info, vals, info.fromLocation, func(t time.Time) time.Time {
+		return t.In(info.toLocation)
+	})
+}
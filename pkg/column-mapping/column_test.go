@@ -16,6 +16,7 @@ package column
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/pingcap/check"
 )
@@ -248,3 +249,122 @@ func (t *testColumnMappingSuit) TestCaseSensitive(c *C) {
 	c.Assert(vals, DeepEquals, []interface{}{1, "1"})
 	c.Assert(poss, IsNil)
 }
+
+func (t *testColumnMappingSuit) TestHandleSQLExpr(c *C) {
+	SetPartitionRule(4, 7, 8)
+	rules := []*Rule{
+		{"test*", "prefix*", "", "name", AddPrefix, []string{"it's:"}, ""},
+		{"test*", "suffix*", "", "name", AddSuffix, []string{`\`}, ""},
+		{"test*", "t_*", "", "id", PartitionID, []string{"2", "test_", "t_"}, ""},
+	}
+
+	m, err := NewMapping(false, rules)
+	c.Assert(err, IsNil)
+
+	column, expr, err := m.HandleSQLExpr("Test_1", "prefix_a")
+	c.Assert(err, IsNil)
+	c.Assert(column, Equals, "name")
+	c.Assert(expr, Equals, "CONCAT('it''s:', `name`)")
+
+	column, expr, err = m.HandleSQLExpr("test_1", "suffix_a")
+	c.Assert(err, IsNil)
+	c.Assert(column, Equals, "name")
+	c.Assert(expr, Equals, "CONCAT(`name`, '\\\\')")
+
+	column, expr, err = m.HandleSQLExpr("test_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(column, Equals, "id")
+	c.Assert(expr, Equals, fmt.Sprintf("(`id` | %d)", int64(2<<59|1<<52|1<<44)))
+
+	// no rule matched
+	column, expr, err = m.HandleSQLExpr("other", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(column, Equals, "")
+	c.Assert(expr, Equals, "")
+
+	// the table's suffix is not a number
+	_, _, err = m.HandleSQLExpr("test_1", "t_x")
+	c.Assert(err, NotNil)
+
+	var nilMapping *Mapping
+	column, _, err = nilMapping.HandleSQLExpr("test_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(column, Equals, "")
+}
+
+func (t *testColumnMappingSuit) TestDatetimeRules(c *C) {
+	// test invalid rules
+	inValidRules := []*Rule{
+		{"test*", "", "", "ts", ShiftDatetime, nil, ""},
+		{"test*", "", "", "ts", ShiftDatetime, []string{"8 hours"}, ""},
+		{"test*", "", "", "ts", ConvertTimezone, []string{"+08:00"}, ""},
+		{"test*", "", "", "ts", ConvertTimezone, []string{"+08:00", "+25:00"}, ""},
+		{"test*", "", "", "ts", ConvertTimezone, []string{"Mars/Olympus", "UTC"}, ""},
+	}
+	for _, rule := range inValidRules {
+		c.Assert(rule.Valid(), NotNil)
+	}
+
+	rules := []*Rule{
+		{"shift*", "", "", "ts", ShiftDatetime, []string{"-8h"}, ""},
+		{"tz*", "", "", "ts", ConvertTimezone, []string{"+08:00", "UTC"}, ""},
+	}
+	m, err := NewMapping(false, rules)
+	c.Assert(err, IsNil)
+
+	cases := []struct {
+		schema   string
+		value    interface{}
+		expected interface{}
+	}{
+		{"shift", "2020-01-01 06:00:00", "2019-12-31 22:00:00"},
+		{"shift", "2020-01-01 06:00:00.120", "2019-12-31 22:00:00.120"},
+		{"shift", nil, nil},
+		{"tz", "2020-01-01 06:00:00.5", "2019-12-31 22:00:00.5"},
+		{"tz", time.Date(2020, 1, 1, 6, 0, 0, 0, time.UTC), time.Date(2019, 12, 31, 22, 0, 0, 0, time.UTC)},
+	}
+	for _, cs := range cases {
+		vals, poss, err := m.HandleRowValue(cs.schema, "t", []string{"id", "ts"}, []interface{}{1, cs.value})
+		c.Assert(err, IsNil)
+		c.Assert(poss, DeepEquals, []int{-1, 1})
+		if expected, ok := cs.expected.(time.Time); ok {
+			c.Assert(vals[1].(time.Time).Equal(expected), IsTrue)
+			c.Assert(vals[1].(time.Time).Hour(), Equals, expected.Hour())
+			continue
+		}
+		c.Assert(vals[1], Equals, cs.expected)
+	}
+
+	_, _, err = m.HandleRowValue("shift", "t", []string{"id", "ts"}, []interface{}{1, "0000-00-00"})
+	c.Assert(err, NotNil)
+
+	// the SQL expressions and their inverse
+	column, expr, err := m.HandleSQLExpr("shift", "t")
+	c.Assert(err, IsNil)
+	c.Assert(column, Equals, "ts")
+	c.Assert(expr, Equals, "DATE_ADD(`ts`, INTERVAL -28800 SECOND)")
+	_, expr, err = m.HandleInverseSQLExpr("shift", "t")
+	c.Assert(err, IsNil)
+	c.Assert(expr, Equals, "DATE_ADD(`ts`, INTERVAL 28800 SECOND)")
+	_, expr, err = m.HandleSQLExpr("tz", "t")
+	c.Assert(err, IsNil)
+	c.Assert(expr, Equals, "CONVERT_TZ(`ts`, '+08:00', 'UTC')")
+	_, expr, err = m.HandleInverseSQLExpr("tz", "t")
+	c.Assert(err, IsNil)
+	c.Assert(expr, Equals, "CONVERT_TZ(`ts`, 'UTC', '+08:00')")
+
+	rule := &Rule{"test*", "", "", "ts", ShiftDatetime, []string{"1500ms"}, ""}
+	_, expr, err = ruleSQLExpr(rule, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(expr, Equals, "DATE_ADD(`ts`, INTERVAL 1500000 MICROSECOND)")
+
+	// the inverse of the inverse is the rule itself
+	inverse, err := rules[0].Inverse()
+	c.Assert(err, IsNil)
+	inverse, err = inverse.Inverse()
+	c.Assert(err, IsNil)
+	c.Assert(inverse.Arguments, DeepEquals, []string{"-8h0m0s"})
+
+	_, err = (&Rule{"test*", "", "", "name", AddPrefix, []string{"a"}, ""}).Inverse()
+	c.Assert(err, NotNil)
+}
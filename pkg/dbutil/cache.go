@@ -0,0 +1,150 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+)
+
+const (
+	cacheKindCreateTable = "create-table"
+	cacheKindIndex       = "index"
+	cacheKindVariable    = "variable"
+)
+
+// metadataCacheKey identifies a cached result, the database is identified by the connection pool.
+type metadataCacheKey struct {
+	db     *sql.DB
+	kind   string
+	object string
+}
+
+type metadataCacheEntry struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// MetadataCache caches the results of the metadata statements, like SHOW CREATE TABLE, SHOW INDEX and the variables,
+// keyed by the database and the object. it's used in one run to avoid redundant round trips when the same table is
+// used in several phases, so the metadata changed in the run is not visible. the errors are not cached.
+// the concurrent queries of the same object are merged into one.
+type MetadataCache struct {
+	sync.Mutex
+	entries map[metadataCacheKey]*metadataCacheEntry
+}
+
+// NewMetadataCache returns a new MetadataCache.
+func NewMetadataCache() *MetadataCache {
+	return &MetadataCache{
+		entries: make(map[metadataCacheKey]*metadataCacheEntry),
+	}
+}
+
+// get returns the cached value, or calls load and caches the value if success.
+func (c *MetadataCache) get(ctx context.Context, key metadataCacheKey, load func() (interface{}, error)) (interface{}, error) {
+	c.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &metadataCacheEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+		c.Unlock()
+
+		entry.value, entry.err = load()
+		if entry.err != nil {
+			c.Lock()
+			delete(c.entries, key)
+			c.Unlock()
+		}
+		close(entry.done)
+		return entry.value, errors.Trace(entry.err)
+	}
+	c.Unlock()
+
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		return nil, errors.Trace(ctx.Err())
+	}
+	return entry.value, errors.Trace(entry.err)
+}
+
+// GetCreateTableSQL returns the create table statement like GetCreateTableSQL, and caches it.
+func (c *MetadataCache) GetCreateTableSQL(ctx context.Context, db *sql.DB, schemaName string, tableName string) (string, error) {
+	value, err := c.get(ctx, metadataCacheKey{db: db, kind: cacheKindCreateTable, object: TableName(schemaName, tableName)}, func() (interface{}, error) {
+		return GetCreateTableSQL(ctx, db, schemaName, tableName)
+	})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return value.(string), nil
+}
+
+// GetTableInfoWithRowID returns table information like GetTableInfoWithRowID, the create table statement is cached.
+// a new TableInfo is returned every time, so the caller can modify it.
+func (c *MetadataCache) GetTableInfoWithRowID(ctx context.Context, db *sql.DB, schemaName string, tableName string, useRowID bool) (*model.TableInfo, error) {
+	createTableSQL, err := c.GetCreateTableSQL(ctx, db, schemaName, tableName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	table, err := GetTableInfoBySQL(createTableSQL)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if useRowID && !table.PKIsHandle {
+		setImplicitColumn(table)
+	}
+
+	return table, nil
+}
+
+// ShowIndex returns the index information like ShowIndex, and caches it. the result should not be modified.
+func (c *MetadataCache) ShowIndex(ctx context.Context, db *sql.DB, schemaName string, table string) ([]*IndexInfo, error) {
+	value, err := c.get(ctx, metadataCacheKey{db: db, kind: cacheKindIndex, object: TableName(schemaName, table)}, func() (interface{}, error) {
+		return ShowIndex(ctx, db, schemaName, table)
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return value.([]*IndexInfo), nil
+}
+
+// ShowMySQLVariable returns the variable's value like ShowMySQLVariable, and caches it.
+func (c *MetadataCache) ShowMySQLVariable(ctx context.Context, db *sql.DB, variable string) (string, error) {
+	value, err := c.get(ctx, metadataCacheKey{db: db, kind: cacheKindVariable, object: variable}, func() (interface{}, error) {
+		return ShowMySQLVariable(ctx, db, variable)
+	})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return value.(string), nil
+}
+
+// Clear removes all the cached results, for example after executing DDLs.
+func (c *MetadataCache) Clear() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = make(map[metadataCacheKey]*metadataCacheEntry)
+}
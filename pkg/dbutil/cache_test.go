@@ -0,0 +1,67 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+func (*testDBSuite) TestMetadataCache(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ctx := context.Background()
+	cache := NewMetadataCache()
+	createTableSQL := "CREATE TABLE `t` (`a` int, `b` int)"
+
+	// the error is not cached
+	mock.ExpectQuery("SHOW CREATE TABLE").WillReturnError(errors.New("connection lost"))
+	_, err = cache.GetCreateTableSQL(ctx, db, "test", "t")
+	c.Assert(err, NotNil)
+
+	mock.ExpectQuery("SHOW CREATE TABLE").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", createTableSQL))
+	for i := 0; i < 3; i++ {
+		sql, err := cache.GetCreateTableSQL(ctx, db, "test", "t")
+		c.Assert(err, IsNil)
+		c.Assert(sql, Equals, createTableSQL)
+	}
+
+	// a new table info is returned every time
+	tableInfo, err := cache.GetTableInfoWithRowID(ctx, db, "test", "t", true)
+	c.Assert(err, IsNil)
+	c.Assert(tableInfo.Columns, HasLen, 3)
+	tableInfo, err = cache.GetTableInfoWithRowID(ctx, db, "test", "t", false)
+	c.Assert(err, IsNil)
+	c.Assert(tableInfo.Columns, HasLen, 2)
+
+	mock.ExpectQuery("SHOW GLOBAL VARIABLES").WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("sql_mode", "ANSI_QUOTES"))
+	for i := 0; i < 2; i++ {
+		value, err := cache.ShowMySQLVariable(ctx, db, "sql_mode")
+		c.Assert(err, IsNil)
+		c.Assert(value, Equals, "ANSI_QUOTES")
+	}
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// query again after clear
+	cache.Clear()
+	mock.ExpectQuery("SHOW CREATE TABLE").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", createTableSQL))
+	_, err = cache.GetCreateTableSQL(ctx, db, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/charset"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/types"
+)
+
+// setTableCharset sets the table's default charset and collation by the table options.
+func setTableCharset(table *model.TableInfo, options []*ast.TableOption) {
+	for _, option := range options {
+		switch option.Tp {
+		case ast.TableOptionCharset:
+			table.Charset = strings.ToLower(option.StrValue)
+		case ast.TableOptionCollate:
+			table.Collate = strings.ToLower(option.StrValue)
+		}
+	}
+}
+
+// ColumnCharset returns the column's charset and collation, the table's default charset and collation are returned
+// if the column doesn't specify them. returns empty strings if the column is not a non-binary string column or the
+// charset is unknown.
+func ColumnCharset(table *model.TableInfo, col *model.ColumnInfo) (string, string) {
+	if !types.IsString(col.Tp) && col.Tp != mysql.TypeEnum && col.Tp != mysql.TypeSet {
+		return "", ""
+	}
+
+	cs, collation := strings.ToLower(col.Charset), strings.ToLower(col.Collate)
+	if len(cs) == 0 && len(collation) == 0 {
+		cs, collation = table.Charset, table.Collate
+	}
+	if len(cs) == 0 && len(collation) != 0 {
+		cs = collationCharset(collation)
+	}
+	if len(cs) != 0 && len(collation) == 0 {
+		collation, _ = charset.GetDefaultCollation(cs)
+	}
+	if cs == charset.CharsetBin {
+		return "", ""
+	}
+
+	return cs, collation
+}
+
+// collationCharset returns the charset of the collation, like "utf8mb4" of "utf8mb4_bin".
+func collationCharset(collation string) string {
+	for _, c := range charset.GetCollations() {
+		if c.Name == collation {
+			return c.CharsetName
+		}
+	}
+	return strings.SplitN(collation, "_", 2)[0]
+}
+
+// BinaryCollation returns the charset's binary collation like "utf8mb4_bin", which compares the strings by the code
+// points, so the strings in utf8 and utf8mb4 are ordered in the same way.
+func BinaryCollation(cs string) string {
+	return cs + "_bin"
+}
+
+// compatibleCharsets are the charsets which save the same characters in the same encoding, utf8 is the subset of utf8mb4.
+var compatibleCharsets = map[string]string{
+	"utf8":    "utf8mb4",
+	"utf8mb3": "utf8mb4",
+	"utf8mb4": "utf8mb4",
+}
+
+// CharsetDifference is a column's different charset or collation between source and target table.
+type CharsetDifference struct {
+	Column          string
+	SourceCharset   string
+	SourceCollation string
+	TargetCharset   string
+	TargetCollation string
+}
+
+// String implements fmt.Stringer interface.
+func (d *CharsetDifference) String() string {
+	return fmt.Sprintf("column %s: source %s(%s), target %s(%s)", d.Column, d.SourceCharset, d.SourceCollation, d.TargetCharset, d.TargetCollation)
+}
+
+// Compatible returns true if only the collations are different, or the charsets save the characters in the same
+// encoding like utf8 and utf8mb4, so the data can be compared by a compatible collation.
+func (d *CharsetDifference) Compatible() bool {
+	if d.SourceCharset == d.TargetCharset {
+		return true
+	}
+	sourceEncoding, ok1 := compatibleCharsets[d.SourceCharset]
+	targetEncoding, ok2 := compatibleCharsets[d.TargetCharset]
+	return ok1 && ok2 && sourceEncoding == targetEncoding
+}
+
+// DiffCharsets returns the columns which have different charsets or collations between source and target table, the
+// columns are matched by the name, and the binary and non-string columns are skipped.
+func DiffCharsets(source, target *model.TableInfo) []*CharsetDifference {
+	var differences []*CharsetDifference
+	for _, sourceCol := range source.Columns {
+		targetCol := FindColumnByName(target.Columns, sourceCol.Name.O)
+		if targetCol == nil {
+			continue
+		}
+
+		sourceCharset, sourceCollation := ColumnCharset(source, sourceCol)
+		targetCharset, targetCollation := ColumnCharset(target, targetCol)
+		if sourceCharset == targetCharset && sourceCollation == targetCollation {
+			continue
+		}
+		differences = append(differences, &CharsetDifference{
+			Column:          sourceCol.Name.O,
+			SourceCharset:   sourceCharset,
+			SourceCollation: sourceCollation,
+			TargetCharset:   targetCharset,
+			TargetCollation: targetCollation,
+		})
+	}
+	return differences
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestDiffCharsets(c *C) {
+	source, err := GetTableInfoBySQL("CREATE TABLE `t` (\n" +
+		"  `id` varchar(20) NOT NULL,\n" +
+		"  `a` varchar(20) COLLATE utf8mb4_general_ci DEFAULT NULL,\n" +
+		"  `b` varchar(20) CHARACTER SET latin1 DEFAULT NULL,\n" +
+		"  `c` varbinary(20) DEFAULT NULL,\n" +
+		"  `d` int(11) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin")
+	c.Assert(err, IsNil)
+	target, err := GetTableInfoBySQL("CREATE TABLE `t` (\n" +
+		"  `id` varchar(20) NOT NULL,\n" +
+		"  `a` varchar(20) DEFAULT NULL,\n" +
+		"  `b` varchar(20) DEFAULT NULL,\n" +
+		"  `c` varbinary(20) DEFAULT NULL,\n" +
+		"  `d` int(11) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	c.Assert(err, IsNil)
+
+	cs, collation := ColumnCharset(source, source.Columns[0])
+	c.Assert(cs, Equals, "utf8mb4")
+	c.Assert(collation, Equals, "utf8mb4_bin")
+	cs, collation = ColumnCharset(target, target.Columns[0])
+	c.Assert(cs, Equals, "utf8")
+	c.Assert(collation, Equals, "utf8_bin")
+
+	differences := DiffCharsets(source, target)
+	c.Assert(differences, HasLen, 3)
+	c.Assert(differences[0].String(), Equals, "column id: source utf8mb4(utf8mb4_bin), target utf8(utf8_bin)")
+	c.Assert(differences[0].Compatible(), IsTrue)
+	c.Assert(differences[1].String(), Equals, "column a: source utf8mb4(utf8mb4_general_ci), target utf8(utf8_bin)")
+	c.Assert(differences[1].Compatible(), IsTrue)
+	c.Assert(differences[2].String(), Equals, "column b: source latin1(latin1_bin), target utf8(utf8_bin)")
+	c.Assert(differences[2].Compatible(), IsFalse)
+
+	c.Assert(DiffCharsets(source, source), HasLen, 0)
+}
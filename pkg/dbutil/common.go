@@ -69,9 +69,40 @@ type DBConfig struct {
 
 	User string `toml:"user" json:"user"`
 
+	// can be "env:VAR_NAME" or "file:/path" to read the password from the environment variable or the file when connecting.
 	Password string `toml:"password" json:"password"`
 
 	Schema string `toml:"schema" json:"schema"`
+
+	// the path of the CA certificate used to verify the server, TLS is enabled if any of the ssl options is set.
+	SSLCA string `toml:"ssl-ca" json:"ssl-ca"`
+
+	// the path of the client certificate, should be set with ssl-key.
+	SSLCert string `toml:"ssl-cert" json:"ssl-cert"`
+
+	// the path of the client certificate's private key.
+	SSLKey string `toml:"ssl-key" json:"ssl-key"`
+
+	// set true will not verify the server's certificate, and ssl-ca is not required.
+	SkipVerify bool `toml:"skip-verify" json:"skip-verify"`
+
+	// the session variables set in every connection when connecting, for example { max_execution_time = "10000" }.
+	// the value is quoted as a string unless it's a number.
+	SessionVariables map[string]string `toml:"session-variables" json:"session-variables"`
+
+	// the staleness of TiDB's stale read like "5s", tidb_read_staleness is set in every connection, so the reads are
+	// served by the nearest replicas at the time before now, and don't contend with the leaders' traffic.
+	// only works for TiDB, and can't be used with tidb_snapshot.
+	ReadStaleness string `toml:"read-staleness" json:"read-staleness"`
+
+	// the max number of open connections, 0 means no limit or decided by the tool.
+	MaxOpenConns int `toml:"max-open-conns" json:"max-open-conns"`
+
+	// the max number of idle connections, 0 means the default or decided by the tool.
+	MaxIdleConns int `toml:"max-idle-conns" json:"max-idle-conns"`
+
+	// the max time a connection may be reused, for example "1h", empty means forever.
+	ConnMaxLifetime string `toml:"conn-max-lifetime" json:"conn-max-lifetime"`
 }
 
 // String returns native format of database configuration
@@ -109,16 +140,41 @@ func GetDBConfigFromEnv(schema string) DBConfig {
 
 // OpenDB opens a mysql connection FD
 func OpenDB(cfg DBConfig) (*sql.DB, error) {
-	dbDSN := fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4", cfg.User, cfg.Password, cfg.Host, cfg.Port)
+	dbDSN, err := GetDSN(cfg, "", "charset=utf8mb4")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	dbConn, err := sql.Open("mysql", dbDSN)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	if err = cfg.applyConnPool(dbConn); err != nil {
+		dbConn.Close()
+		return nil, errors.Trace(err)
+	}
 
 	err = dbConn.Ping()
 	return dbConn, errors.Trace(err)
 }
 
+// applyConnPool sets the connection pool's options of the config, the options not set are not changed.
+func (c *DBConfig) applyConnPool(db *sql.DB) error {
+	if c.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if len(c.ConnMaxLifetime) != 0 {
+		lifetime, err := time.ParseDuration(c.ConnMaxLifetime)
+		if err != nil || lifetime < 0 {
+			return errors.NotValidf("conn-max-lifetime %s", c.ConnMaxLifetime)
+		}
+		db.SetConnMaxLifetime(lifetime)
+	}
+	return nil
+}
+
 // CloseDB closes the mysql fd
 func CloseDB(db *sql.DB) error {
 	if db == nil {
@@ -187,6 +243,42 @@ func GetRowCount(ctx context.Context, db *sql.DB, schemaName string, tableName s
 	return cnt.Int64, nil
 }
 
+// TableStatus is the estimated size of a table in information_schema.
+type TableStatus struct {
+	Rows         int64
+	AvgRowLength int64
+	DataLength   int64
+}
+
+// GetTableStatus returns the estimated row count and data size of the table, the values are from statistics and may be not accurate.
+func GetTableStatus(ctx context.Context, db *sql.DB, schemaName string, tableName string) (*TableStatus, error) {
+	/*
+		example result:
+		mysql> SELECT TABLE_ROWS, AVG_ROW_LENGTH, DATA_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = 'test' AND TABLE_NAME = 'itest';
+		+------------+----------------+-------------+
+		| TABLE_ROWS | AVG_ROW_LENGTH | DATA_LENGTH |
+		+------------+----------------+-------------+
+		|        100 |            163 |       16384 |
+		+------------+----------------+-------------+
+	*/
+	query := "SELECT TABLE_ROWS, AVG_ROW_LENGTH, DATA_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+
+	var rows, avgRowLength, dataLength sql.NullInt64
+	err := db.QueryRowContext(ctx, query, schemaName, tableName).Scan(&rows, &avgRowLength, &dataLength)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.NotFoundf("table `%s`.`%s`", schemaName, tableName)
+		}
+		return nil, errors.Trace(err)
+	}
+
+	return &TableStatus{
+		Rows:         rows.Int64,
+		AvgRowLength: avgRowLength.Int64,
+		DataLength:   dataLength.Int64,
+	}, nil
+}
+
 // GetRandomValues returns some random value and these value's count of a column, just like sampling. Tips: limitArgs is the value in limitRange.
 func GetRandomValues(ctx context.Context, db *sql.DB, schemaName, table, column string, num int, limitRange string, limitArgs []interface{}, collation string) ([]string, []int, error) {
 	/*
@@ -377,18 +469,7 @@ func GetCRC32Checksum(ctx context.Context, db *sql.DB, schemaName, tableName str
 		| 1466098199 |
 		+------------+
 	*/
-	columnNames := make([]string, 0, len(tbInfo.Columns))
-	columnIsNull := make([]string, 0, len(tbInfo.Columns))
-	for _, col := range tbInfo.Columns {
-		if _, ok := ignoreColumns[col.Name.O]; ok {
-			continue
-		}
-		columnNames = append(columnNames, fmt.Sprintf("`%s`", col.Name.O))
-		columnIsNull = append(columnIsNull, fmt.Sprintf("ISNULL(`%s`)", col.Name.O))
-	}
-
-	query := fmt.Sprintf("SELECT BIT_XOR(CAST(CRC32(CONCAT_WS(',', %s, CONCAT(%s)))AS UNSIGNED)) AS checksum FROM %s WHERE %s;",
-		strings.Join(columnNames, ", "), strings.Join(columnIsNull, ", "), TableName(schemaName, tableName), limitRange)
+	query := fmt.Sprintf("SELECT %s AS checksum FROM %s WHERE %s;", crc32ChecksumExpr(tbInfo, ignoreColumns, nil), TableName(schemaName, tableName), limitRange)
 	log.Debug("checksum", zap.String("sql", query), zap.Reflect("args", args))
 
 	var checksum sql.NullInt64
@@ -405,6 +486,137 @@ func GetCRC32Checksum(ctx context.Context, db *sql.DB, schemaName, tableName str
 	return checksum.Int64, nil
 }
 
+// GetCRC32ChecksumWithCount returns checksum code and the number of rows of some data by given condition in one query.
+// the checksum may collide when some rows are duplicated and others are missing, compare the count too can avoid some of them.
+func GetCRC32ChecksumWithCount(ctx context.Context, db *sql.DB, schemaName, tableName string, tbInfo *model.TableInfo, limitRange string, args []interface{}, ignoreColumns map[string]interface{}) (int64, int64, error) {
+	return GetCRC32ChecksumWithCountByExprs(ctx, db, schemaName, tableName, tbInfo, limitRange, args, ignoreColumns, nil)
+}
+
+// GetCRC32ChecksumWithCountByExprs returns checksum code and the number of rows like GetCRC32ChecksumWithCount, but the
+// columns in columnExprs are replaced by the expressions when calculating the checksum, for example "LOWER(`email`)"
+// makes the checksum case-insensitive.
+func GetCRC32ChecksumWithCountByExprs(ctx context.Context, db *sql.DB, schemaName, tableName string, tbInfo *model.TableInfo, limitRange string, args []interface{}, ignoreColumns map[string]interface{}, columnExprs map[string]string) (int64, int64, error) {
+	return GetCRC32ChecksumWithCountByIndex(ctx, db, schemaName, tableName, tbInfo, "", limitRange, args, ignoreColumns, columnExprs)
+}
+
+// GetCRC32ChecksumWithCountByIndex returns checksum code and the number of rows like GetCRC32ChecksumWithCountByExprs,
+// the rows are read by FORCE INDEX if the index is not empty, to avoid the optimizer choosing a bad plan for the range.
+func GetCRC32ChecksumWithCountByIndex(ctx context.Context, db *sql.DB, schemaName, tableName string, tbInfo *model.TableInfo, index string, limitRange string, args []interface{}, ignoreColumns map[string]interface{}, columnExprs map[string]string) (int64, int64, error) {
+	/*
+		calculate CRC32 checksum and count example:
+		mysql> SELECT BIT_XOR(CAST(CRC32(CONCAT_WS(',', id, name, age, CONCAT(ISNULL(id), ISNULL(name), ISNULL(age))))AS UNSIGNED)) AS checksum, COUNT(*) AS count FROM test.test WHERE id > 0 AND id < 10;
+		+------------+-------+
+		| checksum   | count |
+		+------------+-------+
+		| 1466098199 |     9 |
+		+------------+-------+
+	*/
+	query := CRC32ChecksumQuery(schemaName, tableName, tbInfo, index, limitRange, ignoreColumns, columnExprs)
+	log.Debug("checksum", zap.String("sql", query), zap.Reflect("args", args))
+
+	var checksum, count sql.NullInt64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&checksum, &count)
+	if err != nil {
+		return -1, 0, errors.Trace(err)
+	}
+	if !checksum.Valid {
+		// if don't have any data, the checksum will be `NULL`
+		log.Warn("get empty checksum", zap.String("sql", query), zap.Reflect("args", args))
+		return 0, 0, nil
+	}
+
+	return checksum.Int64, count.Int64, nil
+}
+
+// CRC32ChecksumQuery returns the query used by GetCRC32ChecksumWithCountByIndex, it can be executed with the arguments of
+// limitRange to reproduce the checksum and count.
+func CRC32ChecksumQuery(schemaName, tableName string, tbInfo *model.TableInfo, index string, limitRange string, ignoreColumns map[string]interface{}, columnExprs map[string]string) string {
+	return fmt.Sprintf("SELECT %s AS checksum, COUNT(*) AS count FROM %s%s WHERE %s;", crc32ChecksumExpr(tbInfo, ignoreColumns, columnExprs), TableName(schemaName, tableName), IndexHint(index), limitRange)
+}
+
+// IndexHint returns the FORCE INDEX hint placed after the table name, returns empty string if the index is empty.
+func IndexHint(index string) string {
+	if len(index) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" FORCE INDEX(`%s`)", escapeName(index))
+}
+
+// GetIndexCRC32ChecksumWithCount returns the checksum code and the number of rows of the index's columns and the primary
+// key's columns by given condition, the data is read by FORCE INDEX, so it's calculated from the index's content
+// instead of the rows, and can be compared with the rows' or the other database's to find the diverged index.
+func GetIndexCRC32ChecksumWithCount(ctx context.Context, db *sql.DB, schemaName, tableName string, tbInfo *model.TableInfo, index *model.IndexInfo, limitRange string, args []interface{}) (int64, int64, error) {
+	/*
+		calculate index CRC32 checksum and count example:
+		mysql> SELECT BIT_XOR(CAST(CRC32(CONCAT_WS(',', name, id, CONCAT(ISNULL(name), ISNULL(id))))AS UNSIGNED)) AS checksum, COUNT(*) AS count FROM test.test FORCE INDEX(`idx_name`) WHERE TRUE;
+		+------------+-------+
+		| checksum   | count |
+		+------------+-------+
+		| 1466098199 |     9 |
+		+------------+-------+
+	*/
+	indexTable := &model.TableInfo{Columns: indexChecksumColumns(tbInfo, index)}
+	query := fmt.Sprintf("SELECT %s AS checksum, COUNT(*) AS count FROM %s%s WHERE %s;", crc32ChecksumExpr(indexTable, nil, nil), TableName(schemaName, tableName), IndexHint(index.Name.O), limitRange)
+	log.Debug("index checksum", zap.String("sql", query), zap.Reflect("args", args))
+
+	var checksum, count sql.NullInt64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&checksum, &count)
+	if err != nil {
+		return -1, 0, errors.Trace(err)
+	}
+	if !checksum.Valid {
+		// if don't have any data, the checksum will be `NULL`
+		return 0, 0, nil
+	}
+
+	return checksum.Int64, count.Int64, nil
+}
+
+// indexChecksumColumns returns the index's columns and the primary key's columns not in the index,
+// they are all covered by the index.
+func indexChecksumColumns(tbInfo *model.TableInfo, index *model.IndexInfo) []*model.ColumnInfo {
+	cols := make([]*model.ColumnInfo, 0, len(index.Columns)+1)
+	names := make(map[string]struct{})
+	addColumns := func(indexCols []*model.IndexColumn) {
+		for _, indexCol := range indexCols {
+			if _, ok := names[indexCol.Name.O]; ok {
+				continue
+			}
+			names[indexCol.Name.O] = struct{}{}
+			cols = append(cols, tbInfo.Columns[indexCol.Offset])
+		}
+	}
+
+	addColumns(index.Columns)
+	for _, idx := range tbInfo.Indices {
+		if idx.Primary {
+			addColumns(idx.Columns)
+		}
+	}
+
+	return cols
+}
+
+// crc32ChecksumExpr returns the expression calculates the CRC32 checksum of the rows,
+// the columns in columnExprs are replaced by the expressions.
+func crc32ChecksumExpr(tbInfo *model.TableInfo, ignoreColumns map[string]interface{}, columnExprs map[string]string) string {
+	columnNames := make([]string, 0, len(tbInfo.Columns))
+	columnIsNull := make([]string, 0, len(tbInfo.Columns))
+	for _, col := range tbInfo.Columns {
+		if _, ok := ignoreColumns[col.Name.O]; ok {
+			continue
+		}
+		if expr, ok := columnExprs[col.Name.O]; ok {
+			columnNames = append(columnNames, expr)
+		} else {
+			columnNames = append(columnNames, fmt.Sprintf("`%s`", col.Name.O))
+		}
+		columnIsNull = append(columnIsNull, fmt.Sprintf("ISNULL(`%s`)", col.Name.O))
+	}
+
+	return fmt.Sprintf("BIT_XOR(CAST(CRC32(CONCAT_WS(',', %s, CONCAT(%s)))AS UNSIGNED))", strings.Join(columnNames, ", "), strings.Join(columnIsNull, ", "))
+}
+
 // Bucket saves the bucket information from TiDB.
 type Bucket struct {
 	Count      int64
@@ -733,6 +945,16 @@ func isRetryableError(err error) bool {
 	}
 }
 
+// errCodeQueryTimeout is returned by MySQL and TiDB when the statement exceeds the max execution time,
+// which is set by the variable max_execution_time or the hint MAX_EXECUTION_TIME.
+const errCodeQueryTimeout = 3024
+
+// IsMaxExecutionTimeExceeded returns true if the statement is interrupted because it exceeds the max execution time.
+func IsMaxExecutionTimeExceeded(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && mysqlErr.Number == errCodeQueryTimeout
+}
+
 func ignoreError(err error) bool {
 	// TODO: now only ignore some ddl error, add some dml error later
 	if ignoreDDLError(err) {
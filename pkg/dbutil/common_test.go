@@ -14,11 +14,13 @@
 package dbutil
 
 import (
+	"database/sql"
 	"database/sql/driver"
 
 	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
 	tmysql "github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb/infoschema"
 	gmysql "github.com/siddontang/go-mysql/mysql"
@@ -108,6 +110,14 @@ func (s *testDBSuite) TestIsRetryableError(c *C) {
 	}
 }
 
+func (s *testDBSuite) TestIsMaxExecutionTimeExceeded(c *C) {
+	err := newMysqlErr(errCodeQueryTimeout, "Query execution was interrupted, maximum statement execution time exceeded")
+	c.Assert(IsMaxExecutionTimeExceeded(err), IsTrue)
+	c.Assert(IsMaxExecutionTimeExceeded(errors.Annotate(err, "get rows")), IsTrue)
+	c.Assert(IsMaxExecutionTimeExceeded(newMysqlErr(tmysql.ErrUnknown, "i/o timeout")), IsFalse)
+	c.Assert(IsMaxExecutionTimeExceeded(errors.New("unknown error")), IsFalse)
+}
+
 func (s *testDBSuite) TestIsIgnoreError(c *C) {
 	cases := []struct {
 		err       error
@@ -129,3 +139,46 @@ func (s *testDBSuite) TestIsIgnoreError(c *C) {
 		c.Assert(ignoreError(t.err), Equals, t.canIgnore)
 	}
 }
+
+func (*testDBSuite) TestCRC32ChecksumExpr(c *C) {
+	tableInfo, err := GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `email` varchar(24), `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	c.Assert(crc32ChecksumExpr(tableInfo, nil, nil), Equals, "BIT_XOR(CAST(CRC32(CONCAT_WS(',', `id`, `email`, `name`, CONCAT(ISNULL(`id`), ISNULL(`email`), ISNULL(`name`))))AS UNSIGNED))")
+	c.Assert(crc32ChecksumExpr(tableInfo, map[string]interface{}{"name": struct{}{}}, map[string]string{"email": "LOWER(`email`)"}), Equals, "BIT_XOR(CAST(CRC32(CONCAT_WS(',', `id`, LOWER(`email`), CONCAT(ISNULL(`id`), ISNULL(`email`))))AS UNSIGNED))")
+	c.Assert(CRC32ChecksumQuery("test", "t", tableInfo, "idx", "`id` > ?", map[string]interface{}{"name": struct{}{}}, nil), Equals,
+		"SELECT BIT_XOR(CAST(CRC32(CONCAT_WS(',', `id`, `email`, CONCAT(ISNULL(`id`), ISNULL(`email`))))AS UNSIGNED)) AS checksum, COUNT(*) AS count FROM `test`.`t` FORCE INDEX(`idx`) WHERE `id` > ?;")
+}
+
+func (*testDBSuite) TestIndexChecksumColumns(c *C) {
+	tableInfo, err := GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` int, `b` int, `c` varchar(24), `d` int, primary key(`a`, `b`), key `idx_c_a`(`c`, `a`))")
+	c.Assert(err, IsNil)
+
+	var index *model.IndexInfo
+	for _, idx := range tableInfo.Indices {
+		if idx.Name.O == "idx_c_a" {
+			index = idx
+		}
+	}
+	c.Assert(index, NotNil)
+
+	cols := indexChecksumColumns(tableInfo, index)
+	names := make([]string, 0, len(cols))
+	for _, col := range cols {
+		names = append(names, col.Name.O)
+	}
+	c.Assert(names, DeepEquals, []string{"c", "a", "b"})
+}
+
+func (*testDBSuite) TestApplyConnPool(c *C) {
+	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:3306)/")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	cfg := DBConfig{MaxOpenConns: 8, MaxIdleConns: 2, ConnMaxLifetime: "1h"}
+	c.Assert(cfg.applyConnPool(db), IsNil)
+	c.Assert(db.Stats().MaxOpenConnections, Equals, 8)
+
+	cfg.ConnMaxLifetime = "1x"
+	c.Assert(cfg.applyConnPool(db), ErrorMatches, ".*conn-max-lifetime 1x not valid.*")
+}
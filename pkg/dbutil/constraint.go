@@ -0,0 +1,212 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// ConstraintForeignKey is the kind of the foreign key.
+	ConstraintForeignKey = "foreign key"
+	// ConstraintCheck is the kind of the CHECK constraint.
+	ConstraintCheck = "check"
+	// ConstraintExpressionIndex is the kind of the index has expression key parts, like `KEY idx ((LOWER(name)))`.
+	ConstraintExpressionIndex = "expression index"
+)
+
+var (
+	foreignKeyRegexp = regexp.MustCompile("(?i)^CONSTRAINT\\s+`((?:[^`]|``)+)`\\s+FOREIGN\\s+KEY\\b")
+	checkRegexp      = regexp.MustCompile("(?i)^CONSTRAINT\\s+`((?:[^`]|``)+)`\\s+CHECK\\b")
+	indexRegexp      = regexp.MustCompile("(?i)^(?:UNIQUE\\s+)?KEY\\s+`((?:[^`]|``)+)`\\s*\\((.*)\\)")
+	trailingCommaRe  = regexp.MustCompile(",(\\s*\\n\\s*\\))")
+	spacesRegexp     = regexp.MustCompile("\\s+")
+)
+
+// Constraint is a foreign key, CHECK constraint or expression index of the table, the definition is the text in the
+// create table statement, for example "CONSTRAINT `c` CHECK ((`a` > 0))".
+type Constraint struct {
+	Kind       string
+	Name       string
+	Definition string
+}
+
+// ParseConstraints parses the foreign keys, CHECK constraints and expression indexes from the create table statement
+// returned by SHOW CREATE TABLE, which has one definition per line. they are not fully parsed into the table
+// information by the parser, so they are compared by the definitions.
+func ParseConstraints(createTableSQL string) []*Constraint {
+	var constraints []*Constraint
+	for _, line := range strings.Split(createTableSQL, "\n") {
+		definition := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		if constraint := parseConstraint(definition); constraint != nil {
+			constraints = append(constraints, constraint)
+		}
+	}
+	return constraints
+}
+
+func parseConstraint(definition string) *Constraint {
+	newConstraint := func(kind, name string) *Constraint {
+		return &Constraint{
+			Kind:       kind,
+			Name:       strings.Replace(name, "``", "`", -1),
+			Definition: spacesRegexp.ReplaceAllString(definition, " "),
+		}
+	}
+
+	if matches := foreignKeyRegexp.FindStringSubmatch(definition); matches != nil {
+		return newConstraint(ConstraintForeignKey, matches[1])
+	}
+	if matches := checkRegexp.FindStringSubmatch(definition); matches != nil {
+		return newConstraint(ConstraintCheck, matches[1])
+	}
+	if matches := indexRegexp.FindStringSubmatch(definition); matches != nil && hasExpressionKeyPart(matches[2]) {
+		return newConstraint(ConstraintExpressionIndex, matches[1])
+	}
+	return nil
+}
+
+// hasExpressionKeyPart returns true if any of the index's key parts is an expression, which is quoted by parentheses.
+func hasExpressionKeyPart(keyParts string) bool {
+	depth := 0
+	partStart := true
+	for _, c := range keyParts {
+		switch {
+		case partStart && c == '(':
+			return true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			partStart = true
+			continue
+		}
+		if c != ' ' {
+			partStart = false
+		}
+	}
+	return false
+}
+
+// removeUnparsableDefinitions removes the CHECK constraints and expression indexes from the create table statement,
+// the parser can't parse them, and they are compared by ParseConstraints.
+func removeUnparsableDefinitions(createTableSQL string) string {
+	lines := strings.Split(createTableSQL, "\n")
+	kept := lines[:0]
+	removed := false
+	for _, line := range lines {
+		constraint := parseConstraint(strings.TrimSuffix(strings.TrimSpace(line), ","))
+		if constraint != nil && constraint.Kind != ConstraintForeignKey {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return createTableSQL
+	}
+
+	// the last definition before the closing parenthesis may be removed
+	return trailingCommaRe.ReplaceAllString(strings.Join(kept, "\n"), "$1")
+}
+
+// ConstraintDifference is a difference of a constraint between source and target table, the definition is empty if
+// the constraint doesn't exist.
+type ConstraintDifference struct {
+	Kind             string
+	Name             string
+	SourceDefinition string
+	TargetDefinition string
+}
+
+// String implements fmt.Stringer interface.
+func (d *ConstraintDifference) String() string {
+	switch {
+	case len(d.TargetDefinition) == 0:
+		return fmt.Sprintf("%s %s: missing in target, source %s", d.Kind, d.Name, d.SourceDefinition)
+	case len(d.SourceDefinition) == 0:
+		return fmt.Sprintf("%s %s: extra in target, target %s", d.Kind, d.Name, d.TargetDefinition)
+	default:
+		return fmt.Sprintf("%s %s: source %s, target %s", d.Kind, d.Name, d.SourceDefinition, d.TargetDefinition)
+	}
+}
+
+// FixDDLs returns the DDLs make the target table's constraint same as the source's, the different constraint is
+// dropped and added again.
+func (d *ConstraintDifference) FixDDLs(schemaName, tableName string) []string {
+	var ddls []string
+	if len(d.TargetDefinition) != 0 {
+		var drop string
+		switch d.Kind {
+		case ConstraintForeignKey:
+			drop = "DROP FOREIGN KEY"
+		case ConstraintCheck:
+			drop = "DROP CHECK"
+		default:
+			drop = "DROP INDEX"
+		}
+		ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s %s %s;", TableName(schemaName, tableName), drop, "`"+escapeName(d.Name)+"`"))
+	}
+	if len(d.SourceDefinition) != 0 {
+		add := d.SourceDefinition
+		if d.Kind == ConstraintExpressionIndex {
+			// `KEY idx (...)` is not valid in ALTER TABLE ... ADD, `INDEX` is
+			add = indexKeywordRegexp.ReplaceAllString(add, "${1}INDEX")
+		}
+		ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ADD %s;", TableName(schemaName, tableName), add))
+	}
+	return ddls
+}
+
+var indexKeywordRegexp = regexp.MustCompile("(?i)^((?:UNIQUE\\s+)?)KEY")
+
+// DiffConstraints returns the differences of the constraints between source and target table, the constraints are
+// matched by the kind and name, and compared by the definitions. the differences are sorted by the kind and name.
+func DiffConstraints(source, target []*Constraint) []*ConstraintDifference {
+	type constraintKey struct {
+		kind string
+		name string
+	}
+	differences := make(map[constraintKey]*ConstraintDifference)
+	for _, constraint := range source {
+		differences[constraintKey{constraint.Kind, constraint.Name}] = &ConstraintDifference{Kind: constraint.Kind, Name: constraint.Name, SourceDefinition: constraint.Definition}
+	}
+	for _, constraint := range target {
+		key := constraintKey{constraint.Kind, constraint.Name}
+		difference, ok := differences[key]
+		if !ok {
+			difference = &ConstraintDifference{Kind: constraint.Kind, Name: constraint.Name}
+			differences[key] = difference
+		}
+		difference.TargetDefinition = constraint.Definition
+	}
+
+	result := make([]*ConstraintDifference, 0, len(differences))
+	for _, difference := range differences {
+		if difference.SourceDefinition != difference.TargetDefinition {
+			result = append(result, difference)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
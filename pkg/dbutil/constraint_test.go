@@ -0,0 +1,68 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	. "github.com/pingcap/check"
+)
+
+const constraintTableSQL = "CREATE TABLE `t` (\n" +
+	"  `id` int(11) NOT NULL,\n" +
+	"  `pid` int(11) DEFAULT NULL,\n" +
+	"  `name` varchar(20) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_pid` (`pid`),\n" +
+	"  KEY `idx_name` ((lower(`name`)), `id`),\n" +
+	"  CONSTRAINT `fk_pid` FOREIGN KEY (`pid`) REFERENCES `p` (`id`) ON DELETE CASCADE,\n" +
+	"  CONSTRAINT `chk_id` CHECK ((`id` > 0))\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+func (*testDBSuite) TestParseConstraints(c *C) {
+	constraints := ParseConstraints(constraintTableSQL)
+	c.Assert(constraints, DeepEquals, []*Constraint{
+		{Kind: ConstraintExpressionIndex, Name: "idx_name", Definition: "KEY `idx_name` ((lower(`name`)), `id`)"},
+		{Kind: ConstraintForeignKey, Name: "fk_pid", Definition: "CONSTRAINT `fk_pid` FOREIGN KEY (`pid`) REFERENCES `p` (`id`) ON DELETE CASCADE"},
+		{Kind: ConstraintCheck, Name: "chk_id", Definition: "CONSTRAINT `chk_id` CHECK ((`id` > 0))"},
+	})
+
+	// the CHECK constraints and expression indexes are ignored when parsing the table information
+	table, err := GetTableInfoBySQL(constraintTableSQL)
+	c.Assert(err, IsNil)
+	c.Assert(table.Indices, HasLen, 2)
+	c.Assert(table.ForeignKeys, HasLen, 1)
+}
+
+func (*testDBSuite) TestDiffConstraints(c *C) {
+	source := ParseConstraints(constraintTableSQL)
+	target := []*Constraint{
+		{Kind: ConstraintCheck, Name: "chk_id", Definition: "CONSTRAINT `chk_id` CHECK ((`id` > 1))"},
+		{Kind: ConstraintExpressionIndex, Name: "idx_extra", Definition: "UNIQUE KEY `idx_extra` ((abs(`id`)))"},
+		source[1],
+	}
+
+	differences := DiffConstraints(source, target)
+	c.Assert(differences, HasLen, 3)
+	c.Assert(differences[0].Name, Equals, "chk_id")
+	c.Assert(differences[0].FixDDLs("test", "t"), DeepEquals, []string{
+		"ALTER TABLE `test`.`t` DROP CHECK `chk_id`;",
+		"ALTER TABLE `test`.`t` ADD CONSTRAINT `chk_id` CHECK ((`id` > 0));",
+	})
+	c.Assert(differences[1].Name, Equals, "idx_extra")
+	c.Assert(differences[1].String(), Matches, ".*extra in target.*")
+	c.Assert(differences[1].FixDDLs("test", "t"), DeepEquals, []string{"ALTER TABLE `test`.`t` DROP INDEX `idx_extra`;"})
+	c.Assert(differences[2].Name, Equals, "idx_name")
+	c.Assert(differences[2].FixDDLs("test", "t"), DeepEquals, []string{"ALTER TABLE `test`.`t` ADD INDEX `idx_name` ((lower(`name`)), `id`);"})
+
+	c.Assert(DiffConstraints(source, source), HasLen, 0)
+}
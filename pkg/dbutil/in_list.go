@@ -0,0 +1,119 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// MaxPlaceholders is the max number of placeholders in one prepared statement of MySQL and TiDB.
+const MaxPlaceholders = 65535
+
+// InListQuery is a query selecting by a part of the IN list.
+type InListQuery struct {
+	SQL  string
+	Args []interface{}
+}
+
+// BuildInListQueries builds the queries selecting by a large IN list, the tuples are split into several queries so
+// the number of placeholders in every query doesn't exceed maxPlaceholders, 0 means MaxPlaceholders.
+// format should contain one `%s` replaced by the tuples' placeholders, for example "SELECT * FROM t WHERE (a, b) IN (%s)",
+// and prefixArgs are the args of the placeholders before the IN list. all the tuples should have the same length.
+func BuildInListQueries(format string, prefixArgs []interface{}, tuples [][]interface{}, maxPlaceholders int) ([]*InListQuery, error) {
+	if len(tuples) == 0 {
+		return nil, nil
+	}
+	if maxPlaceholders <= 0 {
+		maxPlaceholders = MaxPlaceholders
+	}
+
+	tupleLen := len(tuples[0])
+	if tupleLen == 0 {
+		return nil, errors.NotValidf("empty tuple")
+	}
+	for _, tuple := range tuples {
+		if len(tuple) != tupleLen {
+			return nil, errors.NotValidf("tuples with different length %d and %d", tupleLen, len(tuple))
+		}
+	}
+
+	batchSize := (maxPlaceholders - len(prefixArgs)) / tupleLen
+	if batchSize <= 0 {
+		return nil, errors.NotValidf("max placeholders %d for %d prefix args and tuple length %d", maxPlaceholders, len(prefixArgs), tupleLen)
+	}
+
+	tuplePlaceholder := "?"
+	if tupleLen > 1 {
+		tuplePlaceholder = "(" + strings.TrimSuffix(strings.Repeat("?,", tupleLen), ",") + ")"
+	}
+
+	queries := make([]*InListQuery, 0, (len(tuples)+batchSize-1)/batchSize)
+	for begin := 0; begin < len(tuples); begin += batchSize {
+		end := begin + batchSize
+		if end > len(tuples) {
+			end = len(tuples)
+		}
+
+		args := make([]interface{}, 0, len(prefixArgs)+(end-begin)*tupleLen)
+		args = append(args, prefixArgs...)
+		for _, tuple := range tuples[begin:end] {
+			args = append(args, tuple...)
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat(tuplePlaceholder+",", end-begin), ",")
+		queries = append(queries, &InListQuery{
+			SQL:  fmt.Sprintf(format, placeholders),
+			Args: args,
+		})
+	}
+
+	return queries, nil
+}
+
+// QueryInList executes the queries built by BuildInListQueries one by one, and calls handle for every row.
+func QueryInList(ctx context.Context, db *sql.DB, format string, prefixArgs []interface{}, tuples [][]interface{}, maxPlaceholders int, handle func(rows *sql.Rows) error) error {
+	queries, err := BuildInListQueries(format, prefixArgs, tuples, maxPlaceholders)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, query := range queries {
+		if err = queryRows(ctx, db, query, handle); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+func queryRows(ctx context.Context, db *sql.DB, query *InListQuery, handle func(rows *sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query.SQL, query.Args...)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = handle(rows); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(rows.Err())
+}
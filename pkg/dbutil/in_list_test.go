@@ -0,0 +1,70 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestBuildInListQueries(c *C) {
+	queries, err := BuildInListQueries("SELECT * FROM t WHERE a IN (%s)", nil, nil, 0)
+	c.Assert(err, IsNil)
+	c.Assert(queries, HasLen, 0)
+
+	tuples := [][]interface{}{{1, "a"}, {2, "b"}, {3, "c"}}
+	queries, err = BuildInListQueries("SELECT * FROM t WHERE c = ? AND (a, b) IN (%s)", []interface{}{"x"}, tuples, 5)
+	c.Assert(err, IsNil)
+	c.Assert(queries, HasLen, 2)
+	c.Assert(queries[0].SQL, Equals, "SELECT * FROM t WHERE c = ? AND (a, b) IN ((?,?),(?,?))")
+	c.Assert(queries[0].Args, DeepEquals, []interface{}{"x", 1, "a", 2, "b"})
+	c.Assert(queries[1].SQL, Equals, "SELECT * FROM t WHERE c = ? AND (a, b) IN ((?,?))")
+	c.Assert(queries[1].Args, DeepEquals, []interface{}{"x", 3, "c"})
+
+	// the single column tuples are not wrapped by parentheses
+	queries, err = BuildInListQueries("SELECT * FROM t WHERE a IN (%s)", nil, [][]interface{}{{1}, {2}, {3}}, 0)
+	c.Assert(err, IsNil)
+	c.Assert(queries, HasLen, 1)
+	c.Assert(queries[0].SQL, Equals, "SELECT * FROM t WHERE a IN (?,?,?)")
+
+	_, err = BuildInListQueries("SELECT * FROM t WHERE (a, b) IN (%s)", nil, [][]interface{}{{1, 2}, {3}}, 0)
+	c.Assert(err, NotNil)
+	_, err = BuildInListQueries("SELECT * FROM t WHERE c = ? AND (a, b) IN (%s)", []interface{}{"x"}, tuples, 2)
+	c.Assert(err, NotNil)
+}
+
+func (*testDBSuite) TestQueryInList(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT a FROM t WHERE a IN \\(\\?,\\?\\)").WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery("SELECT a FROM t WHERE a IN \\(\\?\\)").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(3))
+
+	var values []int
+	err = QueryInList(context.Background(), db, "SELECT a FROM t WHERE a IN (%s)", nil, [][]interface{}{{1}, {2}, {3}}, 2, func(rows *sql.Rows) error {
+		var value int
+		if err := rows.Scan(&value); err != nil {
+			return err
+		}
+		values = append(values, value)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, []int{1, 2, 3})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
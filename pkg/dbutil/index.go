@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/model"
@@ -137,6 +138,33 @@ func FindAllIndex(tableInfo *model.TableInfo) []*model.IndexInfo {
 	return indices
 }
 
+// FindIndexByColumns returns the index whose leading columns are the columns in order, the primary key and unique
+// keys are preferred. returns nil if no index covers the columns.
+func FindIndexByColumns(tableInfo *model.TableInfo, columns []string) *model.IndexInfo {
+	if len(columns) == 0 {
+		return nil
+	}
+
+	for _, index := range FindAllIndex(tableInfo) {
+		if len(index.Columns) < len(columns) {
+			continue
+		}
+
+		covered := true
+		for i, column := range columns {
+			if !strings.EqualFold(index.Columns[i].Name.O, column) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return index
+		}
+	}
+
+	return nil
+}
+
 // FindAllColumnWithIndex returns columns with index, order is pk, uk and normal index.
 func FindAllColumnWithIndex(tableInfo *model.TableInfo) []*model.ColumnInfo {
 	colsMap := make(map[string]interface{})
@@ -95,3 +95,28 @@ func (*testDBSuite) TestIndex(c *C) {
 		}
 	}
 }
+
+func (*testDBSuite) TestFindIndexByColumns(c *C) {
+	tableInfo, err := GetTableInfoBySQL(`
+		CREATE TABLE itest (
+			a int(11) NOT NULL,
+			b int(11) NOT NULL,
+			c int(11) NOT NULL,
+			KEY idx_b_c (b, c),
+			UNIQUE KEY uk_b (b),
+			PRIMARY KEY (a, b))
+	`)
+	c.Assert(err, IsNil)
+
+	c.Assert(FindIndexByColumns(tableInfo, []string{"a"}).Name.O, Equals, "PRIMARY")
+	c.Assert(FindIndexByColumns(tableInfo, []string{"A", "b"}).Name.O, Equals, "PRIMARY")
+	// the unique key is preferred
+	c.Assert(FindIndexByColumns(tableInfo, []string{"b"}).Name.O, Equals, "uk_b")
+	c.Assert(FindIndexByColumns(tableInfo, []string{"b", "c"}).Name.O, Equals, "idx_b_c")
+	c.Assert(FindIndexByColumns(tableInfo, []string{"c"}), IsNil)
+	c.Assert(FindIndexByColumns(tableInfo, []string{"a", "b", "c"}), IsNil)
+	c.Assert(FindIndexByColumns(tableInfo, nil), IsNil)
+
+	c.Assert(IndexHint("uk_b"), Equals, " FORCE INDEX(`uk_b`)")
+	c.Assert(IndexHint(""), Equals, "")
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	passwordEnvPrefix  = "env:"
+	passwordFilePrefix = "file:"
+)
+
+// ResolvePassword returns the password, which can be "env:VAR_NAME" to read it from the environment variable,
+// or "file:/path" to read it from the file, the trailing line breaks in the file are removed.
+// the other passwords are returned directly, so the plaintext passwords need not live in the config files.
+func ResolvePassword(password string) (string, error) {
+	switch {
+	case strings.HasPrefix(password, passwordEnvPrefix):
+		name := strings.TrimPrefix(password, passwordEnvPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.NotFoundf("environment variable %s of password", name)
+		}
+		return value, nil
+	case strings.HasPrefix(password, passwordFilePrefix):
+		path := strings.TrimPrefix(password, passwordFilePrefix)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Annotatef(err, "read password from file %s", path)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return password, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestResolvePassword(c *C) {
+	password, err := ResolvePassword("123456")
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "123456")
+
+	c.Assert(os.Setenv("DBUTIL_TEST_PASSWORD", "env-password"), IsNil)
+	defer os.Unsetenv("DBUTIL_TEST_PASSWORD")
+	password, err = ResolvePassword("env:DBUTIL_TEST_PASSWORD")
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "env-password")
+
+	_, err = ResolvePassword("env:DBUTIL_TEST_PASSWORD_NOT_EXIST")
+	c.Assert(err, NotNil)
+
+	path := filepath.Join(c.MkDir(), "password")
+	c.Assert(ioutil.WriteFile(path, []byte("file-password\n"), 0600), IsNil)
+	password, err = ResolvePassword("file:" + path)
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "file-password")
+
+	_, err = ResolvePassword("file:" + path + ".not-exist")
+	c.Assert(err, NotNil)
+
+	dsn, err := GetDSN(DBConfig{Host: "127.0.0.1", Port: 3306, User: "root", Password: "env:DBUTIL_TEST_PASSWORD"}, "", "charset=utf8mb4")
+	c.Assert(err, IsNil)
+	c.Assert(dsn, Equals, "root:env-password@tcp(127.0.0.1:3306)/?charset=utf8mb4")
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+)
+
+const readOnlyDriverName = "mysql-readonly"
+
+func init() {
+	sql.Register(readOnlyDriverName, &readOnlyDriver{Driver: &mysql.MySQLDriver{}})
+}
+
+// ErrReadOnly means the statement is rejected by the read-only connection.
+var ErrReadOnly = errors.New("only read-only statements are allowed")
+
+// OpenReadOnlyDB opens a mysql connection FD like OpenDB, which only allows the read-only statements, like SELECT, SHOW,
+// EXPLAIN and setting session variables. the other statements are rejected before sent to the database,
+// so it's safe to be used for audits against production.
+func OpenReadOnlyDB(cfg DBConfig) (*sql.DB, error) {
+	dbDSN, err := GetDSN(cfg, "", "charset=utf8mb4")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	dbConn, err := sql.Open(readOnlyDriverName, dbDSN)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = cfg.applyConnPool(dbConn); err != nil {
+		dbConn.Close()
+		return nil, errors.Trace(err)
+	}
+
+	err = dbConn.Ping()
+	return dbConn, errors.Trace(err)
+}
+
+// IsReadOnlyStatement returns true if the statement doesn't modify the data or schema.
+func IsReadOnlyStatement(query string) bool {
+	query = trimLeadingComments(query)
+	fields := strings.Fields(strings.ToUpper(query))
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch fields[0] {
+	case "SELECT":
+		for i := 1; i < len(fields); i++ {
+			// SELECT ... FOR UPDATE locks the rows, SELECT ... INTO OUTFILE writes files
+			if fields[i] == "FOR" && i+1 < len(fields) && fields[i+1] == "UPDATE" {
+				return false
+			}
+			if fields[i] == "INTO" {
+				return false
+			}
+		}
+		return true
+	case "SHOW", "EXPLAIN", "DESC", "DESCRIBE":
+		return true
+	case "SET":
+		// only the session variables can be set, like @@tidb_snapshot
+		for _, field := range fields[1:] {
+			if field == "GLOBAL" || strings.HasPrefix(field, "@@GLOBAL.") {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// trimLeadingComments removes the spaces and comments like `/* ... */` before the statement.
+func trimLeadingComments(query string) string {
+	for {
+		query = strings.TrimSpace(query)
+		if !strings.HasPrefix(query, "/*") || strings.HasPrefix(query, "/*!") {
+			return query
+		}
+
+		end := strings.Index(query, "*/")
+		if end < 0 {
+			return query
+		}
+		query = query[end+2:]
+	}
+}
+
+func checkReadOnly(query string) error {
+	if !IsReadOnlyStatement(query) {
+		return errors.Annotatef(ErrReadOnly, "statement %s", query)
+	}
+	return nil
+}
+
+// readOnlyDriver wraps the mysql driver, the connections reject the statements which are not read-only.
+type readOnlyDriver struct {
+	driver.Driver
+}
+
+func (d *readOnlyDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyConn{Conn: conn}, nil
+}
+
+type readOnlyConn struct {
+	driver.Conn
+}
+
+func (c *readOnlyConn) Prepare(query string) (driver.Stmt, error) {
+	if err := checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *readOnlyConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *readOnlyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *readOnlyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	if queryer, ok := c.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *readOnlyConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	// the statements in transaction are also checked, so the transaction is read-only
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *readOnlyConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *readOnlyConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *readOnlyConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
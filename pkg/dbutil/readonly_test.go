@@ -0,0 +1,71 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+func (*testDBSuite) TestIsReadOnlyStatement(c *C) {
+	testCases := []struct {
+		query    string
+		readOnly bool
+	}{
+		{"SELECT * FROM `test`.`t` WHERE `a` > ?", true},
+		{"  /* diff */ select count(1) from t", true},
+		{"SHOW CREATE TABLE `test`.`t`", true},
+		{"EXPLAIN SELECT 1", true},
+		{"SET @@tidb_snapshot = '2016-10-08 16:45:26'", true},
+		{"SET GLOBAL read_only = 0", false},
+		{"SET @@global.read_only = 0", false},
+		{"SELECT * FROM t FOR UPDATE", false},
+		{"SELECT * FROM t INTO OUTFILE '/tmp/t'", false},
+		{"CREATE DATABASE IF NOT EXISTS `sync_diff_inspector`", false},
+		{"REPLACE INTO `sync_diff_inspector`.`chunk` VALUES (1)", false},
+		{"DELETE FROM t", false},
+		{"/* SELECT */ UPDATE t SET a = 1", false},
+		{"", false},
+	}
+
+	for _, testCase := range testCases {
+		c.Assert(IsReadOnlyStatement(testCase.query), Equals, testCase.readOnly, Commentf("query: %s", testCase.query))
+	}
+}
+
+func (*testDBSuite) TestReadOnlyDriver(c *C) {
+	mockDB, mock, err := sqlmock.NewWithDSN("readonly_test")
+	c.Assert(err, IsNil)
+	defer mockDB.Close()
+
+	sql.Register("readonly-sqlmock", &readOnlyDriver{Driver: mockDB.Driver()})
+	db, err := sql.Open("readonly-sqlmock", "readonly_test")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	var a int
+	c.Assert(db.QueryRowContext(context.Background(), "SELECT a FROM t").Scan(&a), IsNil)
+	c.Assert(a, Equals, 1)
+
+	_, err = db.ExecContext(context.Background(), "DELETE FROM t")
+	c.Assert(errors.Cause(err), Equals, ErrReadOnly)
+	_, err = db.PrepareContext(context.Background(), "INSERT INTO t VALUES (?)")
+	c.Assert(errors.Cause(err), Equals, ErrReadOnly)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
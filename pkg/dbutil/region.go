@@ -0,0 +1,102 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+	"go.uber.org/zap"
+)
+
+// RegionInfo saves the region's information from TiDB.
+type RegionInfo struct {
+	RegionID int64
+	TableID  int64
+	// the hex encoded keys of the region's range
+	StartKey string
+	EndKey   string
+	// the estimated number of keys in the region
+	ApproximateKeys int64
+}
+
+// GetTableRegions returns the regions of the table's records in TiDB, ordered by the start key.
+func GetTableRegions(ctx context.Context, db *sql.DB, schemaName string, tableName string) ([]*RegionInfo, error) {
+	/*
+		example in tidb:
+		mysql> SELECT REGION_ID, TABLE_ID, START_KEY, END_KEY, APPROXIMATE_KEYS FROM information_schema.TIKV_REGION_STATUS WHERE DB_NAME = 'test' AND TABLE_NAME = 't' AND IS_INDEX = 0 ORDER BY START_KEY;
+		+-----------+----------+--------------------------------------------------------+--------------------------------------------------------+------------------+
+		| REGION_ID | TABLE_ID | START_KEY                                              | END_KEY                                                | APPROXIMATE_KEYS |
+		+-----------+----------+--------------------------------------------------------+--------------------------------------------------------+------------------+
+		|         2 |       45 | 7480000000000000FF2D00000000000000F8                   | 7480000000000000FF2D5F728000000000FF0003E80000000000FA |           999    |
+		|        12 |       45 | 7480000000000000FF2D5F728000000000FF0003E80000000000FA | 7480000000000000FF2E00000000000000F8                   |           1001   |
+		+-----------+----------+--------------------------------------------------------+--------------------------------------------------------+------------------+
+	*/
+	query := "SELECT REGION_ID, TABLE_ID, START_KEY, END_KEY, APPROXIMATE_KEYS FROM information_schema.TIKV_REGION_STATUS WHERE DB_NAME = ? AND TABLE_NAME = ? AND IS_INDEX = 0 ORDER BY START_KEY"
+	log.Debug("get table regions", zap.String("sql", query), zap.String("schema", schemaName), zap.String("table", tableName))
+
+	rows, err := db.QueryContext(ctx, query, schemaName, tableName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	regions := make([]*RegionInfo, 0, 10)
+	for rows.Next() {
+		var (
+			region           RegionInfo
+			startKey, endKey sql.NullString
+			approximateKeys  sql.NullInt64
+		)
+		if err = rows.Scan(&region.RegionID, &region.TableID, &startKey, &endKey, &approximateKeys); err != nil {
+			return nil, errors.Trace(err)
+		}
+		region.StartKey = startKey.String
+		region.EndKey = endKey.String
+		region.ApproximateKeys = approximateKeys.Int64
+		regions = append(regions, &region)
+	}
+
+	return regions, errors.Trace(rows.Err())
+}
+
+// DecodeRecordHandle decodes the handle from the region's hex encoded key, ok is false if the key is not the table's
+// record key, for example the region starts before the table's first record.
+func DecodeRecordHandle(hexKey string, tableID int64) (handle int64, ok bool, err error) {
+	encodedKey, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return 0, false, errors.Trace(err)
+	}
+	if len(encodedKey) == 0 {
+		return 0, false, nil
+	}
+
+	// the keys in TiKV are encoded to be memory comparable
+	_, key, err := codec.DecodeBytes(encodedKey, nil)
+	if err != nil {
+		return 0, false, errors.Trace(err)
+	}
+
+	keyTableID, handle, err := tablecodec.DecodeRecordKey(key)
+	if err != nil || keyTableID != tableID {
+		return 0, false, nil
+	}
+
+	return handle, true, nil
+}
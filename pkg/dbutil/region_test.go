@@ -0,0 +1,80 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+func encodeRegionKey(key kv.Key) string {
+	return strings.ToUpper(hex.EncodeToString(codec.EncodeBytes(nil, key)))
+}
+
+func (*testDBSuite) TestDecodeRecordHandle(c *C) {
+	testCases := []struct {
+		key    string
+		handle int64
+		ok     bool
+	}{
+		{encodeRegionKey(tablecodec.EncodeRowKeyWithHandle(45, 1000)), 1000, true},
+		{encodeRegionKey(tablecodec.EncodeRowKeyWithHandle(45, -10)), -10, true},
+		// the other table's record
+		{encodeRegionKey(tablecodec.EncodeRowKeyWithHandle(46, 1000)), 0, false},
+		// the table's prefix, the region starts before the records
+		{encodeRegionKey(tablecodec.EncodeTablePrefix(45)), 0, false},
+		{encodeRegionKey(tablecodec.GenTableRecordPrefix(45)), 0, false},
+		{"", 0, false},
+	}
+	for _, testCase := range testCases {
+		handle, ok, err := DecodeRecordHandle(testCase.key, 45)
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, testCase.ok, Commentf("key %s", testCase.key))
+		c.Assert(handle, Equals, testCase.handle)
+	}
+
+	_, _, err := DecodeRecordHandle("not hex", 45)
+	c.Assert(err, NotNil)
+}
+
+func (*testDBSuite) TestGetTableRegions(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT REGION_ID, TABLE_ID, START_KEY, END_KEY, APPROXIMATE_KEYS FROM information_schema.TIKV_REGION_STATUS").
+		WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"REGION_ID", "TABLE_ID", "START_KEY", "END_KEY", "APPROXIMATE_KEYS"}).
+			AddRow(2, 45, "7480000000000000FF2D00000000000000F8", "7480000000000000FF2D5F728000000000FF0003E80000000000FA", 999).
+			AddRow(12, 45, "7480000000000000FF2D5F728000000000FF0003E80000000000FA", "", nil))
+
+	regions, err := GetTableRegions(context.Background(), db, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(regions, HasLen, 2)
+	c.Assert(regions[0].ApproximateKeys, Equals, int64(999))
+	c.Assert(regions[1].EndKey, Equals, "")
+
+	handle, ok, err := DecodeRecordHandle(regions[0].EndKey, regions[0].TableID)
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	c.Assert(handle, Equals, int64(1000))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"database/sql"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	// the default number of rows whose ColumnData are allocated together
+	defaultScanBatchSize = 256
+	// the size of the buffer the columns' data are copied into, the larger data are allocated separately
+	scanArenaSize = 64 << 10
+)
+
+// RowScanner scans the rows into maps like ScanRow, but the columns' names are got only once, and the ColumnData and
+// the data of a batch of rows are allocated together, so scanning the wide tables allocates much less.
+// the scanned rows are never reused, so they can be kept after scanning the next row.
+type RowScanner struct {
+	rows      *sql.Rows
+	cols      []string
+	vals      []sql.RawBytes
+	valPtrs   []interface{}
+	batchSize int
+
+	// the ColumnData of the rows in the current batch, column by column for every row
+	datas []ColumnData
+	// the buffer the columns' data are copied into
+	arena []byte
+}
+
+// NewRowScanner returns a RowScanner of the rows, the ColumnData of batchSize rows are allocated together, the default
+// is used if batchSize is not positive.
+func NewRowScanner(rows *sql.Rows, batchSize int) (*RowScanner, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if batchSize <= 0 {
+		batchSize = defaultScanBatchSize
+	}
+
+	s := &RowScanner{
+		rows:      rows,
+		cols:      cols,
+		vals:      make([]sql.RawBytes, len(cols)),
+		valPtrs:   make([]interface{}, len(cols)),
+		batchSize: batchSize,
+	}
+	for i := range s.vals {
+		s.valPtrs[i] = &s.vals[i]
+	}
+	return s, nil
+}
+
+// Scan scans the current row into a map, should be called after rows.Next returns true.
+func (s *RowScanner) Scan() (map[string]*ColumnData, error) {
+	for i := range s.vals {
+		// not nil, so the empty value is not regarded as NULL
+		s.vals[i] = sql.RawBytes{}
+	}
+	if err := s.rows.Scan(s.valPtrs...); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if len(s.datas) < len(s.cols) {
+		s.datas = make([]ColumnData, len(s.cols)*s.batchSize)
+	}
+	datas := s.datas[:len(s.cols)]
+	s.datas = s.datas[len(s.cols):]
+
+	result := make(map[string]*ColumnData, len(s.cols))
+	for i, val := range s.vals {
+		data := &datas[i]
+		if val == nil {
+			data.IsNull = true
+		} else {
+			data.Data = s.copyData(val)
+		}
+		result[s.cols[i]] = data
+	}
+
+	return result, nil
+}
+
+// copyData copies the data into the arena, the RawBytes are only valid until the next scan.
+func (s *RowScanner) copyData(val []byte) []byte {
+	if len(val) > scanArenaSize/4 {
+		return append([]byte{}, val...)
+	}
+	if cap(s.arena)-len(s.arena) < len(val) {
+		s.arena = make([]byte, 0, scanArenaSize)
+	}
+
+	start := len(s.arena)
+	s.arena = append(s.arena, val...)
+	// limit the capacity, so appending to the data doesn't overwrite the next one
+	return s.arena[start:len(s.arena):len(s.arena)]
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestRowScanner(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mockRows := sqlmock.NewRows([]string{"a", "b"})
+	for i := 0; i < 5; i++ {
+		mockRows.AddRow(i, "")
+	}
+	mockRows.AddRow(nil, "x")
+	mock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+
+	rows, err := db.QueryContext(context.Background(), "SELECT a, b FROM t")
+	c.Assert(err, IsNil)
+	defer rows.Close()
+
+	// the ColumnData are allocated every 2 rows
+	scanner, err := NewRowScanner(rows, 2)
+	c.Assert(err, IsNil)
+	var results []map[string]*ColumnData
+	for rows.Next() {
+		row, err := scanner.Scan()
+		c.Assert(err, IsNil)
+		results = append(results, row)
+	}
+	c.Assert(rows.Err(), IsNil)
+
+	c.Assert(results, HasLen, 6)
+	for i := 0; i < 5; i++ {
+		c.Assert(results[i]["a"], DeepEquals, &ColumnData{Data: []byte{byte('0' + i)}})
+		c.Assert(results[i]["b"].IsNull, IsFalse)
+		c.Assert(results[i]["b"].Data, HasLen, 0)
+	}
+	c.Assert(results[5]["a"].IsNull, IsTrue)
+	c.Assert(string(results[5]["b"].Data), Equals, "x")
+}
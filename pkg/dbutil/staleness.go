@@ -0,0 +1,65 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	readStalenessVariable = "tidb_read_staleness"
+	snapshotVariable      = "tidb_snapshot"
+
+	// MinReadStaleness is the min staleness of TiDB's stale read.
+	MinReadStaleness = time.Second
+)
+
+// ParseReadStaleness parses the staleness of TiDB's stale read like "5s", returns error if less than MinReadStaleness.
+func ParseReadStaleness(staleness string) (time.Duration, error) {
+	duration, err := time.ParseDuration(staleness)
+	if err != nil {
+		return 0, errors.Annotatef(err, "read-staleness %s", staleness)
+	}
+	if duration < MinReadStaleness {
+		return 0, errors.NotValidf("read-staleness %s less than %s", staleness, MinReadStaleness)
+	}
+	return duration, nil
+}
+
+// sessionVariables returns the session variables set in every connection, tidb_read_staleness is set if ReadStaleness
+// is not empty, so all the read queries of the connections are stale reads served by the nearest replicas.
+func (c *DBConfig) sessionVariables() (map[string]string, error) {
+	if len(c.ReadStaleness) == 0 {
+		return c.SessionVariables, nil
+	}
+
+	staleness, err := ParseReadStaleness(c.ReadStaleness)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, ok := c.SessionVariables[snapshotVariable]; ok {
+		return nil, errors.NotValidf("read-staleness with %s", snapshotVariable)
+	}
+
+	variables := make(map[string]string, len(c.SessionVariables)+1)
+	for name, value := range c.SessionVariables {
+		variables[name] = value
+	}
+	// the staleness is negative seconds
+	variables[readStalenessVariable] = strconv.FormatInt(-int64(staleness/time.Second), 10)
+	return variables, nil
+}
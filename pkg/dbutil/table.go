@@ -54,7 +54,9 @@ func GetTableInfo(ctx context.Context, db *sql.DB, schemaName string, tableName
 }
 
 // GetTableInfoBySQL returns table information by given create table sql.
+// the CHECK constraints and expression indexes are ignored, use ParseConstraints to get them.
 func GetTableInfoBySQL(createTableSQL string) (table *model.TableInfo, err error) {
+	createTableSQL = removeUnparsableDefinitions(createTableSQL)
 	stmt, err := parser.New().ParseOneStmt(createTableSQL, "", "")
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -67,6 +69,7 @@ func GetTableInfoBySQL(createTableSQL string) (table *model.TableInfo, err error
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
+		setTableCharset(table, s.Options)
 
 		return table, nil
 	}
@@ -114,7 +117,7 @@ func columnDefToCol(offset int, colDef *ast.ColumnDef) (*model.ColumnInfo, []*as
 		for _, v := range colDef.Options {
 			switch v.Tp {
 			case ast.ColumnOptionNotNull:
-				// do nothing
+				col.Flag |= mysql.NotNullFlag
 			case ast.ColumnOptionNull:
 				// do nothing
 			case ast.ColumnOptionAutoIncrement:
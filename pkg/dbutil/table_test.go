@@ -91,6 +91,12 @@ func (*testDBSuite) TestTable(c *C) {
 		col := FindColumnByName(tableInfo.Columns, testCase.colName)
 		c.Assert(testCase.fineCol, Equals, col != nil)
 	}
+
+	tableInfo, err := GetTableInfoBySQL("CREATE TABLE ntest (a int NOT NULL, b int NULL, c int)")
+	c.Assert(err, IsNil)
+	c.Assert(mysql.HasNotNullFlag(tableInfo.Columns[0].Flag), IsTrue)
+	c.Assert(mysql.HasNotNullFlag(tableInfo.Columns[1].Flag), IsFalse)
+	c.Assert(mysql.HasNotNullFlag(tableInfo.Columns[2].Flag), IsFalse)
 }
 
 func (*testDBSuite) TestTableStructEqual(c *C) {
@@ -0,0 +1,141 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+// DefaultAutoRandomBits is the shard bits of the AUTO_RANDOM column if not specified.
+const DefaultAutoRandomBits = 5
+
+var (
+	autoIncrementOptionRegexp   = regexp.MustCompile("(?i)\\bAUTO_INCREMENT\\s*=\\s*(\\d+)")
+	shardRowIDBitsOptionRegexp  = regexp.MustCompile("(?i)\\bSHARD_ROW_ID_BITS\\s*=\\s*(\\d+)")
+	preSplitRegionsOptionRegexp = regexp.MustCompile("(?i)\\bPRE_SPLIT_REGIONS\\s*=\\s*(\\d+)")
+	autoIncrementColumnRegexp   = regexp.MustCompile("(?im)^\\s*`((?:[^`]|``)+)`[^\\n]*\\bAUTO_INCREMENT\\b")
+	autoRandomColumnRegexp      = regexp.MustCompile("(?im)^\\s*`((?:[^`]|``)+)`[^\\n]*\\bAUTO_RANDOM\\b(?:\\s*\\(\\s*(\\d+)\\s*\\))?")
+)
+
+// TiDBTableAttributes are the TiDB-specific attributes of the table, which are not parsed into the table information.
+type TiDBTableAttributes struct {
+	// the table's AUTO_INCREMENT option, 0 if not specified
+	AutoIncrement int64
+	// the name of the AUTO_INCREMENT column, empty if no such column
+	AutoIncrementColumn string
+	// the shard bits of the AUTO_RANDOM columns
+	AutoRandomBits map[string]int
+	// the table's SHARD_ROW_ID_BITS option
+	ShardRowIDBits int
+	// the table's PRE_SPLIT_REGIONS option
+	PreSplitRegions int
+}
+
+// ParseTiDBTableAttributes parses the TiDB-specific attributes from the create table statement returned by SHOW CREATE
+// TABLE, the attributes are usually in the comments like `/*T![auto_rand] AUTO_RANDOM(5) */` and
+// `/*T! SHARD_ROW_ID_BITS=4 PRE_SPLIT_REGIONS=2 */`, so they are ignored by the parser and MySQL.
+func ParseTiDBTableAttributes(createTableSQL string) *TiDBTableAttributes {
+	attrs := &TiDBTableAttributes{
+		AutoRandomBits: make(map[string]int),
+	}
+
+	parseInt := func(re *regexp.Regexp) int64 {
+		matches := re.FindStringSubmatch(createTableSQL)
+		if len(matches) < 2 {
+			return 0
+		}
+		value, _ := strconv.ParseInt(matches[1], 10, 64)
+		return value
+	}
+	attrs.AutoIncrement = parseInt(autoIncrementOptionRegexp)
+	attrs.ShardRowIDBits = int(parseInt(shardRowIDBitsOptionRegexp))
+	attrs.PreSplitRegions = int(parseInt(preSplitRegionsOptionRegexp))
+
+	if matches := autoIncrementColumnRegexp.FindStringSubmatch(createTableSQL); len(matches) != 0 {
+		attrs.AutoIncrementColumn = strings.Replace(matches[1], "``", "`", -1)
+	}
+	for _, matches := range autoRandomColumnRegexp.FindAllStringSubmatch(createTableSQL, -1) {
+		bits := DefaultAutoRandomBits
+		if len(matches[2]) != 0 {
+			bits, _ = strconv.Atoi(matches[2])
+		}
+		attrs.AutoRandomBits[strings.Replace(matches[1], "``", "`", -1)] = bits
+	}
+
+	return attrs
+}
+
+// SequenceInfo is the definition of the sequence in TiDB.
+type SequenceInfo struct {
+	Name      string
+	Start     int64
+	Increment int64
+	MinValue  int64
+	MaxValue  int64
+	Cache     bool
+	CacheSize int64
+	Cycle     bool
+}
+
+// String implements fmt.Stringer interface.
+func (s *SequenceInfo) String() string {
+	return fmt.Sprintf("start %d, increment %d, min value %d, max value %d, cache %t, cache size %d, cycle %t",
+		s.Start, s.Increment, s.MinValue, s.MaxValue, s.Cache, s.CacheSize, s.Cycle)
+}
+
+// GetSequences returns the sequences in the schema by the name, returns empty if the database doesn't support
+// sequences, like MySQL.
+func GetSequences(ctx context.Context, db *sql.DB, schemaName string) (map[string]*SequenceInfo, error) {
+	/*
+		mysql> SELECT SEQUENCE_NAME, START, INCREMENT, MIN_VALUE, MAX_VALUE, CACHE, CACHE_VALUE, CYCLE FROM information_schema.SEQUENCES WHERE SEQUENCE_SCHEMA = 'test';
+		+---------------+-------+-----------+-----------+---------------------+-------+-------------+-------+
+		| SEQUENCE_NAME | START | INCREMENT | MIN_VALUE | MAX_VALUE           | CACHE | CACHE_VALUE | CYCLE |
+		+---------------+-------+-----------+-----------+---------------------+-------+-------------+-------+
+		| seq           |     1 |         1 |         1 | 9223372036854775806 |     1 |        1000 |     0 |
+		+---------------+-------+-----------+-----------+---------------------+-------+-------------+-------+
+	*/
+	query := "SELECT SEQUENCE_NAME, START, INCREMENT, MIN_VALUE, MAX_VALUE, CACHE, CACHE_VALUE, CYCLE FROM information_schema.SEQUENCES WHERE SEQUENCE_SCHEMA = ?"
+	rows, err := db.QueryContext(ctx, query, schemaName)
+	if err != nil {
+		if mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError); ok && mysqlErr.Number == tmysql.ErrUnknownTable {
+			return map[string]*SequenceInfo{}, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	sequences := make(map[string]*SequenceInfo)
+	for rows.Next() {
+		var (
+			sequence  SequenceInfo
+			cacheSize sql.NullInt64
+		)
+		if err = rows.Scan(&sequence.Name, &sequence.Start, &sequence.Increment, &sequence.MinValue, &sequence.MaxValue, &sequence.Cache, &cacheSize, &sequence.Cycle); err != nil {
+			return nil, errors.Trace(err)
+		}
+		sequence.CacheSize = cacheSize.Int64
+		sequences[sequence.Name] = &sequence
+	}
+
+	return sequences, errors.Trace(rows.Err())
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	tmysql "github.com/pingcap/parser/mysql"
+)
+
+func (*testDBSuite) TestParseTiDBTableAttributes(c *C) {
+	createTableSQL := "CREATE TABLE `t` (\n" +
+		"  `id` bigint(20) NOT NULL /*T![auto_rand] AUTO_RANDOM(3) */,\n" +
+		"  `a``b` bigint(20) NOT NULL /*T![auto_rand] AUTO_RANDOM */,\n" +
+		"  `c` int(11) NOT NULL AUTO_INCREMENT,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin AUTO_INCREMENT=30001 /*T! SHARD_ROW_ID_BITS=4 PRE_SPLIT_REGIONS=2 */"
+	attrs := ParseTiDBTableAttributes(createTableSQL)
+	c.Assert(attrs, DeepEquals, &TiDBTableAttributes{
+		AutoIncrement:       30001,
+		AutoIncrementColumn: "c",
+		AutoRandomBits:      map[string]int{"id": 3, "a`b": DefaultAutoRandomBits},
+		ShardRowIDBits:      4,
+		PreSplitRegions:     2,
+	})
+
+	attrs = ParseTiDBTableAttributes("CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB")
+	c.Assert(attrs, DeepEquals, &TiDBTableAttributes{AutoRandomBits: map[string]int{}})
+}
+
+func (*testDBSuite) TestGetSequences(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	ctx := context.Background()
+
+	columns := []string{"SEQUENCE_NAME", "START", "INCREMENT", "MIN_VALUE", "MAX_VALUE", "CACHE", "CACHE_VALUE", "CYCLE"}
+	mock.ExpectQuery("SELECT SEQUENCE_NAME, .* FROM information_schema.SEQUENCES").WithArgs("test").WillReturnRows(
+		sqlmock.NewRows(columns).AddRow("seq1", 1, 1, 1, 100, 1, 10, 1).AddRow("seq2", 10, 2, 1, 1000, 0, nil, 0))
+	sequences, err := GetSequences(ctx, db, "test")
+	c.Assert(err, IsNil)
+	c.Assert(sequences, DeepEquals, map[string]*SequenceInfo{
+		"seq1": {Name: "seq1", Start: 1, Increment: 1, MinValue: 1, MaxValue: 100, Cache: true, CacheSize: 10, Cycle: true},
+		"seq2": {Name: "seq2", Start: 10, Increment: 2, MinValue: 1, MaxValue: 1000},
+	})
+
+	// MySQL doesn't support the sequences
+	mock.ExpectQuery("SELECT SEQUENCE_NAME, .* FROM information_schema.SEQUENCES").WithArgs("test").WillReturnError(&mysql.MySQLError{Number: tmysql.ErrUnknownTable})
+	sequences, err = GetSequences(ctx, db, "test")
+	c.Assert(err, IsNil)
+	c.Assert(sequences, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// TimeoutClass is the class of the operations which share the same timeout.
+type TimeoutClass string
+
+const (
+	// TimeoutMetadata is the class of the queries of the tables' metadata, like SHOW CREATE TABLE.
+	TimeoutMetadata TimeoutClass = "metadata"
+	// TimeoutChecksum is the class of the queries scan the rows to calculate the checksum or count the rows.
+	TimeoutChecksum TimeoutClass = "checksum"
+	// TimeoutRowFetch is the class of the queries select the rows.
+	TimeoutRowFetch TimeoutClass = "row-fetch"
+	// TimeoutCheckpoint is the class of the statements load and save the checkpoint and summary.
+	TimeoutCheckpoint TimeoutClass = "checkpoint"
+)
+
+// TimeoutPolicy is the timeout of every class of operations, 0 means no timeout, the operations are only stopped when
+// the caller's context is done.
+type TimeoutPolicy struct {
+	Metadata   time.Duration
+	Checksum   time.Duration
+	RowFetch   time.Duration
+	Checkpoint time.Duration
+}
+
+// DefaultTimeoutPolicy returns the default TimeoutPolicy, the scans of the rows have no timeout because the time they
+// take depends on the size of the chunks.
+func DefaultTimeoutPolicy() *TimeoutPolicy {
+	return &TimeoutPolicy{
+		Metadata:   5 * DefaultTimeout,
+		Checkpoint: 5 * DefaultTimeout,
+	}
+}
+
+// Valid returns error if the timeouts are negative.
+func (p *TimeoutPolicy) Valid() error {
+	for _, class := range []TimeoutClass{TimeoutMetadata, TimeoutChecksum, TimeoutRowFetch, TimeoutCheckpoint} {
+		if timeout := p.Timeout(class); timeout < 0 {
+			return errors.NotValidf("%s timeout %s", class, timeout)
+		}
+	}
+	return nil
+}
+
+// Timeout returns the timeout of the class, 0 means no timeout. the nil policy is the default policy.
+func (p *TimeoutPolicy) Timeout(class TimeoutClass) time.Duration {
+	if p == nil {
+		return DefaultTimeoutPolicy().Timeout(class)
+	}
+
+	switch class {
+	case TimeoutMetadata:
+		return p.Metadata
+	case TimeoutChecksum:
+		return p.Checksum
+	case TimeoutRowFetch:
+		return p.RowFetch
+	case TimeoutCheckpoint:
+		return p.Checkpoint
+	default:
+		return 0
+	}
+}
+
+// WithTimeout returns a copy of ctx with the deadline of the class's timeout, the copy is only cancelable if no timeout.
+func (p *TimeoutPolicy) WithTimeout(ctx context.Context, class TimeoutClass) (context.Context, context.CancelFunc) {
+	timeout := p.Timeout(class)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
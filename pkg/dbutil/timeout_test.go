@@ -0,0 +1,50 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestTimeoutPolicy(c *C) {
+	var policy *TimeoutPolicy
+	// the nil policy is the default policy
+	c.Assert(policy.Timeout(TimeoutMetadata), Equals, 5*DefaultTimeout)
+	c.Assert(policy.Timeout(TimeoutChecksum), Equals, time.Duration(0))
+
+	policy = &TimeoutPolicy{Checksum: time.Minute}
+	c.Assert(policy.Valid(), IsNil)
+	c.Assert(policy.Timeout(TimeoutChecksum), Equals, time.Minute)
+	c.Assert(policy.Timeout(TimeoutMetadata), Equals, time.Duration(0))
+	c.Assert(policy.Timeout("unknown"), Equals, time.Duration(0))
+
+	ctx, cancel := policy.WithTimeout(context.Background(), TimeoutChecksum)
+	deadline, ok := ctx.Deadline()
+	c.Assert(ok, IsTrue)
+	c.Assert(time.Until(deadline) <= time.Minute, IsTrue)
+	cancel()
+	c.Assert(ctx.Err(), Equals, context.Canceled)
+
+	// no deadline if no timeout
+	ctx, cancel = policy.WithTimeout(context.Background(), TimeoutRowFetch)
+	_, ok = ctx.Deadline()
+	c.Assert(ok, IsFalse)
+	cancel()
+
+	policy.RowFetch = -time.Second
+	c.Assert(policy.Valid(), NotNil)
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+)
+
+var (
+	tlsConfigLock sync.Mutex
+	// the registered TLS configs' names, keyed by the TLS options and the host
+	tlsConfigNames = make(map[string]string)
+)
+
+// TLSEnabled returns true if the connection should use TLS.
+func (c *DBConfig) TLSEnabled() bool {
+	return len(c.SSLCA) != 0 || len(c.SSLCert) != 0 || len(c.SSLKey) != 0 || c.SkipVerify
+}
+
+// ToTLSConfig generates the TLS config of the connection, returns nil if TLS is not enabled.
+func (c *DBConfig) ToTLSConfig() (*tls.Config, error) {
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+	if (len(c.SSLCert) == 0) != (len(c.SSLKey) == 0) {
+		return nil, errors.NotValidf("ssl-cert %s and ssl-key %s, they should be set together", c.SSLCert, c.SSLKey)
+	}
+	if len(c.SSLCA) == 0 && !c.SkipVerify {
+		return nil, errors.NotValidf("ssl-ca, it's required to verify the server unless skip-verify is true")
+	}
+
+	var tlsConfig *tls.Config
+	if len(c.SSLCA) != 0 {
+		var err error
+		tlsConfig, err = utils.ToTLSConfig(c.SSLCA, c.SSLCert, c.SSLKey)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	} else {
+		tlsConfig = &tls.Config{}
+		if len(c.SSLCert) != 0 {
+			certificate, err := tls.LoadX509KeyPair(c.SSLCert, c.SSLKey)
+			if err != nil {
+				return nil, errors.Errorf("could not load client key pair: %s", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+		}
+	}
+
+	tlsConfig.ServerName = c.Host
+	tlsConfig.InsecureSkipVerify = c.SkipVerify
+	return tlsConfig, nil
+}
+
+// RegisterTLSConfig registers the connection's TLS config with go-sql-driver, returns the name used as the DSN's
+// `tls` parameter, empty if TLS is not enabled. the same config is only registered once.
+func RegisterTLSConfig(cfg DBConfig) (string, error) {
+	if !cfg.TLSEnabled() {
+		return "", nil
+	}
+
+	key := fmt.Sprintf("%s|%s|%s|%t|%s", cfg.SSLCA, cfg.SSLCert, cfg.SSLKey, cfg.SkipVerify, cfg.Host)
+	tlsConfigLock.Lock()
+	defer tlsConfigLock.Unlock()
+
+	if name, ok := tlsConfigNames[key]; ok {
+		return name, nil
+	}
+
+	tlsConfig, err := cfg.ToTLSConfig()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	name := fmt.Sprintf("tidb-tools-%d", len(tlsConfigNames)+1)
+	if err = mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", errors.Trace(err)
+	}
+	tlsConfigNames[key] = name
+
+	return name, nil
+}
+
+// GetDSN returns the DSN of the database with the params, for example "charset=utf8mb4". the TLS config is registered
+// and added to the params if TLS is enabled, and the password is resolved by ResolvePassword. the session variables
+// and tidb_read_staleness are set in every connection.
+func GetDSN(cfg DBConfig, schema string, params string) (string, error) {
+	password, err := ResolvePassword(cfg.Password)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	tlsName, err := RegisterTLSConfig(cfg)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if len(tlsName) != 0 {
+		params = fmt.Sprintf("%s&tls=%s", params, tlsName)
+	}
+	variables, err := cfg.sessionVariables()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	params += sessionVariableParams(variables)
+
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s", cfg.User, password, cfg.Host, cfg.Port, schema, params), nil
+}
+
+// sessionVariableParams returns the DSN params of the session variables, the driver sets them in every connection.
+func sessionVariableParams(variables map[string]string) string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params strings.Builder
+	for _, name := range names {
+		value := variables[name]
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			value = "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+		}
+		fmt.Fprintf(&params, "&%s=%s", name, url.QueryEscape(value))
+	}
+	return params.String()
+}
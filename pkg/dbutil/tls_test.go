@@ -0,0 +1,90 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	. "github.com/pingcap/check"
+)
+
+func (*testDBSuite) TestTLSConfig(c *C) {
+	cfg := DBConfig{Host: "127.0.0.1", Port: 4000, User: "root", Password: "123"}
+	c.Assert(cfg.TLSEnabled(), IsFalse)
+	tlsConfig, err := cfg.ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(tlsConfig, IsNil)
+
+	dsn, err := GetDSN(cfg, "", "charset=utf8mb4")
+	c.Assert(err, IsNil)
+	c.Assert(dsn, Equals, "root:123@tcp(127.0.0.1:4000)/?charset=utf8mb4")
+
+	// the session variables are set by the params
+	cfg.SessionVariables = map[string]string{"time_zone": "+00:00", "max_execution_time": "1000", "sql_mode": "it's"}
+	dsn, err = GetDSN(cfg, "", "charset=utf8mb4")
+	c.Assert(err, IsNil)
+	c.Assert(dsn, Equals, "root:123@tcp(127.0.0.1:4000)/?charset=utf8mb4&max_execution_time=1000&sql_mode=%27it%5C%27s%27&time_zone=%27%2B00%3A00%27")
+
+	// the stale read is set by tidb_read_staleness, and can't be used with tidb_snapshot
+	cfg.SessionVariables = map[string]string{"time_zone": "+00:00"}
+	cfg.ReadStaleness = "5s"
+	dsn, err = GetDSN(cfg, "", "charset=utf8mb4")
+	c.Assert(err, IsNil)
+	c.Assert(dsn, Equals, "root:123@tcp(127.0.0.1:4000)/?charset=utf8mb4&tidb_read_staleness=-5&time_zone=%27%2B00%3A00%27")
+	c.Assert(cfg.SessionVariables, HasLen, 1)
+	cfg.ReadStaleness = "500ms"
+	_, err = GetDSN(cfg, "", "charset=utf8mb4")
+	c.Assert(err, ErrorMatches, ".*less than 1s.*")
+	cfg.ReadStaleness = "5s"
+	cfg.SessionVariables = map[string]string{"tidb_snapshot": "2019-01-01 00:00:00"}
+	_, err = GetDSN(cfg, "", "charset=utf8mb4")
+	c.Assert(err, ErrorMatches, ".*read-staleness with tidb_snapshot.*")
+	cfg.SessionVariables = nil
+	cfg.ReadStaleness = ""
+
+	// skip verify doesn't need the ca
+	cfg.SkipVerify = true
+	c.Assert(cfg.TLSEnabled(), IsTrue)
+	tlsConfig, err = cfg.ToTLSConfig()
+	c.Assert(err, IsNil)
+	c.Assert(tlsConfig.InsecureSkipVerify, IsTrue)
+
+	name, err := RegisterTLSConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(name, Not(Equals), "")
+	// the same config is registered once
+	name2, err := RegisterTLSConfig(cfg)
+	c.Assert(err, IsNil)
+	c.Assert(name2, Equals, name)
+
+	dsn, err = GetDSN(cfg, "test", "charset=utf8")
+	c.Assert(err, IsNil)
+	c.Assert(dsn, Equals, "root:123@tcp(127.0.0.1:4000)/test?charset=utf8&tls="+name)
+
+	// the ca is required to verify the server
+	cfg.SkipVerify = false
+	cfg.SSLCert = "client.pem"
+	cfg.SSLKey = "client-key.pem"
+	_, err = cfg.ToTLSConfig()
+	c.Assert(err, ErrorMatches, ".*ssl-ca.*")
+
+	// the cert and key should be set together
+	cfg.SSLCA = "ca.pem"
+	cfg.SSLKey = ""
+	_, err = cfg.ToTLSConfig()
+	c.Assert(err, ErrorMatches, ".*set together.*")
+
+	// the files don't exist
+	cfg.SSLCert = ""
+	_, err = RegisterTLSConfig(cfg)
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+)
+
+// IsView returns true if the table is a view.
+func IsView(ctx context.Context, db *sql.DB, schemaName string, tableName string) (bool, error) {
+	/*
+		mysql> SELECT TABLE_TYPE FROM information_schema.TABLES WHERE TABLE_SCHEMA = 'test' AND TABLE_NAME = 'v';
+		+------------+
+		| TABLE_TYPE |
+		+------------+
+		| VIEW       |
+		+------------+
+	*/
+	var tableType string
+	query := "SELECT TABLE_TYPE FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+	err := db.QueryRowContext(ctx, query, schemaName, tableName).Scan(&tableType)
+	if err == sql.ErrNoRows {
+		return false, errors.NotFoundf("table %s", TableName(schemaName, tableName))
+	}
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	return tableType == "VIEW", nil
+}
+
+// GetViewDefinition returns the SELECT statement of the view.
+func GetViewDefinition(ctx context.Context, db *sql.DB, schemaName string, viewName string) (string, error) {
+	/*
+		mysql> SELECT VIEW_DEFINITION FROM information_schema.VIEWS WHERE TABLE_SCHEMA = 'test' AND TABLE_NAME = 'v';
+		+--------------------------------------------------------------------------+
+		| VIEW_DEFINITION                                                          |
+		+--------------------------------------------------------------------------+
+		| select `test`.`t`.`id` AS `id`,`test`.`t`.`name` AS `name` from `test`.`t` |
+		+--------------------------------------------------------------------------+
+	*/
+	var definition string
+	query := "SELECT VIEW_DEFINITION FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+	err := db.QueryRowContext(ctx, query, schemaName, viewName).Scan(&definition)
+	if err == sql.ErrNoRows {
+		return "", errors.NotFoundf("view %s", TableName(schemaName, viewName))
+	}
+
+	return definition, errors.Trace(err)
+}
+
+// GetViewInfo returns the view's columns as a table information without indexes, the columns' types are got from
+// information_schema.COLUMNS because SHOW CREATE TABLE returns the view's definition.
+func GetViewInfo(ctx context.Context, db *sql.DB, schemaName string, viewName string) (*model.TableInfo, error) {
+	/*
+		mysql> SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLLATION_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = 'test' AND TABLE_NAME = 'v' ORDER BY ORDINAL_POSITION;
+		+-------------+-------------+-------------+--------------------+
+		| COLUMN_NAME | COLUMN_TYPE | IS_NULLABLE | COLLATION_NAME     |
+		+-------------+-------------+-------------+--------------------+
+		| id          | int(11)     | NO          | NULL               |
+		| name        | varchar(24) | YES         | utf8mb4_general_ci |
+		+-------------+-------------+-------------+--------------------+
+	*/
+	query := "SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLLATION_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
+	rows, err := db.QueryContext(ctx, query, schemaName, viewName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	columnDefs := make([]string, 0, 8)
+	for rows.Next() {
+		var (
+			name, tp, nullable string
+			collation          sql.NullString
+		)
+		if err = rows.Scan(&name, &tp, &nullable, &collation); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		columnDef := fmt.Sprintf("`%s` %s", escapeName(name), tp)
+		if collation.Valid {
+			columnDef += " COLLATE " + collation.String
+		}
+		if nullable == "NO" {
+			columnDef += " NOT NULL"
+		}
+		columnDefs = append(columnDefs, columnDef)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(columnDefs) == 0 {
+		return nil, errors.NotFoundf("view %s", TableName(schemaName, viewName))
+	}
+
+	createTableSQL := fmt.Sprintf("CREATE TABLE `%s` (%s)", escapeName(viewName), strings.Join(columnDefs, ", "))
+	tableInfo, err := GetTableInfoBySQL(createTableSQL)
+	return tableInfo, errors.Trace(err)
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbutil
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/mysql"
+)
+
+func (*testDBSuite) TestView(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT TABLE_TYPE FROM information_schema.TABLES").WithArgs("test", "v").WillReturnRows(sqlmock.NewRows([]string{"TABLE_TYPE"}).AddRow("VIEW"))
+	mock.ExpectQuery("SELECT TABLE_TYPE FROM information_schema.TABLES").WithArgs("test", "t").WillReturnRows(sqlmock.NewRows([]string{"TABLE_TYPE"}).AddRow("BASE TABLE"))
+	mock.ExpectQuery("SELECT TABLE_TYPE FROM information_schema.TABLES").WithArgs("test", "x").WillReturnRows(sqlmock.NewRows([]string{"TABLE_TYPE"}))
+	isView, err := IsView(ctx, db, "test", "v")
+	c.Assert(err, IsNil)
+	c.Assert(isView, IsTrue)
+	isView, err = IsView(ctx, db, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(isView, IsFalse)
+	_, err = IsView(ctx, db, "test", "x")
+	c.Assert(err, ErrorMatches, ".*not found")
+
+	definition := "select `test`.`t`.`id` AS `id` from `test`.`t`"
+	mock.ExpectQuery("SELECT VIEW_DEFINITION FROM information_schema.VIEWS").WithArgs("test", "v").WillReturnRows(sqlmock.NewRows([]string{"VIEW_DEFINITION"}).AddRow(definition))
+	def, err := GetViewDefinition(ctx, db, "test", "v")
+	c.Assert(err, IsNil)
+	c.Assert(def, Equals, definition)
+
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLLATION_NAME FROM information_schema.COLUMNS").WithArgs("test", "v").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLLATION_NAME"}).
+			AddRow("id", "int(11) unsigned", "NO", nil).
+			AddRow("na`me", "varchar(24)", "YES", "utf8mb4_bin").
+			AddRow("state", "enum('a','b')", "YES", "utf8mb4_bin"))
+	tableInfo, err := GetViewInfo(ctx, db, "test", "v")
+	c.Assert(err, IsNil)
+	c.Assert(tableInfo.Name.O, Equals, "v")
+	c.Assert(tableInfo.Columns, HasLen, 3)
+	c.Assert(tableInfo.Indices, HasLen, 0)
+	c.Assert(mysql.HasUnsignedFlag(tableInfo.Columns[0].Flag), IsTrue)
+	c.Assert(tableInfo.Columns[1].Name.O, Equals, "na`me")
+	c.Assert(tableInfo.Columns[1].Collate, Equals, "utf8mb4_bin")
+	c.Assert(tableInfo.Columns[2].Elems, DeepEquals, []string{"a", "b"})
+
+	mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLLATION_NAME FROM information_schema.COLUMNS").WithArgs("test", "x").WillReturnRows(
+		sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLLATION_NAME"}))
+	_, err = GetViewInfo(ctx, db, "test", "x")
+	c.Assert(err, ErrorMatches, ".*not found")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
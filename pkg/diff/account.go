@@ -0,0 +1,380 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// AccountMissing means the account exists in source but not in target.
+	AccountMissing = "missing"
+	// AccountExtra means the account exists in target but not in source.
+	AccountExtra = "extra"
+	// AccountPluginDiff means the account's authentication plugins are different.
+	AccountPluginDiff = "plugin"
+	// AccountPasswordDiff means the account's password hashes are different.
+	AccountPasswordDiff = "password"
+	// AccountGrantDiff means the account's privileges are different.
+	AccountGrantDiff = "grant"
+
+	defaultAuthPlugin = "mysql_native_password"
+)
+
+// Account is an account in mysql.user and its privileges, the values are canonicalized so the accounts in different
+// versions of MySQL and TiDB can be compared.
+type Account struct {
+	User string
+	// the host is case insensitive, saved in lower case
+	Host   string
+	Plugin string
+	// the password hash, never printed
+	AuthString string
+	// the canonical privileges like "SELECT ON db.*", see CanonicalizeGrant
+	Privileges []string
+}
+
+// Name returns the account's name like 'user'@'host'.
+func (a *Account) Name() string {
+	return fmt.Sprintf("'%s'@'%s'", a.User, a.Host)
+}
+
+// AccountDrift is a difference of an account between source and target.
+type AccountDrift struct {
+	Account string
+	// one of AccountMissing, AccountExtra, AccountPluginDiff, AccountPasswordDiff and AccountGrantDiff
+	Kind   string
+	Detail string
+}
+
+// String returns the string of the drift, used for report.
+func (d *AccountDrift) String() string {
+	if len(d.Detail) == 0 {
+		return fmt.Sprintf("account %s: %s", d.Account, d.Kind)
+	}
+	return fmt.Sprintf("account %s: %s, %s", d.Account, d.Kind, d.Detail)
+}
+
+// FetchAccounts reads the accounts from mysql.user and their grants by SHOW GRANTS, only the read-only statements are
+// executed. the internal accounts like 'mysql.sys'@'localhost' are skipped, and the accounts in ignoreAccounts are
+// skipped too, which can be like "user@host", or "user" for all the hosts.
+func FetchAccounts(ctx context.Context, db *sql.DB, ignoreAccounts []string) ([]*Account, error) {
+	ignored := make(map[string]struct{}, len(ignoreAccounts))
+	for _, account := range ignoreAccounts {
+		ignored[strings.ToLower(account)] = struct{}{}
+	}
+
+	// the columns are different in the versions, for example the password hash is saved in `Password` before MySQL 5.7
+	rows, err := db.QueryContext(ctx, "SELECT * FROM mysql.user")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	accounts := make([]*Account, 0, 10)
+	for rows.Next() {
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		account := &Account{}
+		var password string
+		for i, column := range columns {
+			switch strings.ToLower(column) {
+			case "user":
+				account.User = string(values[i])
+			case "host":
+				account.Host = strings.ToLower(string(values[i]))
+			case "plugin":
+				account.Plugin = string(values[i])
+			case "authentication_string":
+				account.AuthString = string(values[i])
+			case "password":
+				password = string(values[i])
+			}
+		}
+		if len(account.AuthString) == 0 {
+			account.AuthString = password
+		}
+		account.Plugin, account.AuthString = canonicalizeAuth(account.Plugin, account.AuthString)
+
+		if isAccountIgnored(account, ignored) {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for _, account := range accounts {
+		grants, err := showGrants(ctx, db, account.User, account.Host)
+		if err != nil {
+			return nil, errors.Annotatef(err, "account %s", account.Name())
+		}
+		account.Privileges = canonicalizeGrants(grants)
+	}
+
+	return accounts, nil
+}
+
+func isAccountIgnored(account *Account, ignored map[string]struct{}) bool {
+	// the internal accounts of MySQL, like 'mysql.sys', 'mysql.session' and 'mysql.infoschema'
+	if strings.HasPrefix(account.User, "mysql.") {
+		return true
+	}
+
+	if _, ok := ignored[strings.ToLower(account.User)]; ok {
+		return true
+	}
+	_, ok := ignored[strings.ToLower(fmt.Sprintf("%s@%s", account.User, account.Host))]
+	return ok
+}
+
+func showGrants(ctx context.Context, db *sql.DB, user, host string) ([]string, error) {
+	query := fmt.Sprintf("SHOW GRANTS FOR %s@%s", quoteString(user), quoteString(host))
+	log.Debug("show grants", zap.String("sql", query))
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	grants := make([]string, 0, 2)
+	for rows.Next() {
+		var grant string
+		if err = rows.Scan(&grant); err != nil {
+			return nil, errors.Trace(err)
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, errors.Trace(rows.Err())
+}
+
+// quoteString returns the string literal of the value.
+func quoteString(value string) string {
+	return fmt.Sprintf("'%s'", strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(value))
+}
+
+// canonicalizeAuth returns the canonical plugin and password hash, the default plugin is mysql_native_password,
+// and its hash is case insensitive.
+func canonicalizeAuth(plugin, authString string) (string, string) {
+	if len(plugin) == 0 {
+		plugin = defaultAuthPlugin
+	}
+	if plugin == defaultAuthPlugin {
+		authString = strings.ToUpper(authString)
+	}
+	return plugin, authString
+}
+
+// canonicalizeGrants returns the sorted and deduplicated canonical privileges of the grants.
+func canonicalizeGrants(grants []string) []string {
+	privilegeSet := make(map[string]struct{})
+	for _, grant := range grants {
+		for _, privilege := range CanonicalizeGrant(grant) {
+			privilegeSet[privilege] = struct{}{}
+		}
+	}
+
+	privileges := make([]string, 0, len(privilegeSet))
+	for privilege := range privilegeSet {
+		privileges = append(privileges, privilege)
+	}
+	sort.Strings(privileges)
+
+	return privileges
+}
+
+// CanonicalizeGrant splits the grant statement of SHOW GRANTS to the canonical privileges on the objects, so the grants
+// in different formats can be compared, for example "GRANT SELECT, INSERT ON `db`.* TO 'u'@'%' WITH GRANT OPTION" is
+// split to "GRANT OPTION ON db.*", "INSERT ON db.*" and "SELECT ON db.*". the password in the grant is removed, and the
+// USAGE privilege is ignored because it means no privilege.
+func CanonicalizeGrant(grant string) []string {
+	grant = strings.Join(strings.Fields(grant), " ")
+	upper := strings.ToUpper(grant)
+	if !strings.HasPrefix(upper, "GRANT ") {
+		return []string{grant}
+	}
+
+	onIdx := strings.Index(upper, " ON ")
+	if onIdx < 0 {
+		// grant roles, like "GRANT `r1`@`%` TO `u1`@`%`"
+		toIdx := strings.Index(upper, " TO ")
+		if toIdx < 0 {
+			return []string{grant}
+		}
+		return []string{"ROLE " + removeQuotes(grant[len("GRANT "):toIdx])}
+	}
+	toIdx := strings.Index(upper[onIdx:], " TO ")
+	if toIdx < 0 {
+		return []string{grant}
+	}
+	toIdx += onIdx
+
+	object := removeQuotes(grant[onIdx+len(" ON ") : toIdx])
+	privileges := make([]string, 0, 4)
+	for _, privilege := range splitPrivileges(grant[len("GRANT "):onIdx]) {
+		switch privilege {
+		case "USAGE":
+			continue
+		case "ALL":
+			privilege = "ALL PRIVILEGES"
+		}
+		privileges = append(privileges, fmt.Sprintf("%s ON %s", privilege, object))
+	}
+	if strings.Contains(upper[toIdx:], " WITH GRANT OPTION") {
+		privileges = append(privileges, fmt.Sprintf("GRANT OPTION ON %s", object))
+	}
+
+	return privileges
+}
+
+// splitPrivileges splits the privileges by the commas not in the columns' list, like "SELECT (`a`, `b`), INSERT".
+// the privileges are in upper case, and the columns are in lower case without quotes.
+func splitPrivileges(privileges string) []string {
+	result := make([]string, 0, 4)
+	depth, start := 0, 0
+	appendPrivilege := func(privilege string) {
+		privilege = strings.TrimSpace(privilege)
+		if len(privilege) == 0 {
+			return
+		}
+
+		name, columnList := privilege, ""
+		if idx := strings.Index(privilege, "("); idx >= 0 {
+			name = strings.TrimSpace(privilege[:idx])
+			columns := strings.Split(strings.Trim(privilege[idx:], "()"), ",")
+			for i := range columns {
+				columns[i] = strings.ToLower(removeQuotes(columns[i]))
+			}
+			sort.Strings(columns)
+			columnList = fmt.Sprintf(" (%s)", strings.Join(columns, ","))
+		}
+		result = append(result, strings.ToUpper(name)+columnList)
+	}
+
+	for i, ch := range privileges {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				appendPrivilege(privileges[start:i])
+				start = i + 1
+			}
+		}
+	}
+	appendPrivilege(privileges[start:])
+
+	return result
+}
+
+// removeQuotes removes the quotes of the identifiers and strings, like `db`.`t` or 'u'@'%'.
+func removeQuotes(name string) string {
+	return strings.NewReplacer("`", "", "'", "", `"`, "").Replace(strings.TrimSpace(name))
+}
+
+// CompareAccounts compares the source's and target's accounts, returns the drifts ordered by the account.
+// the password hashes are compared, but never put in the drifts.
+func CompareAccounts(sourceAccounts, targetAccounts []*Account) []*AccountDrift {
+	targets := make(map[string]*Account, len(targetAccounts))
+	for _, account := range targetAccounts {
+		targets[account.Name()] = account
+	}
+
+	drifts := make([]*AccountDrift, 0, 4)
+	sources := make(map[string]struct{}, len(sourceAccounts))
+	for _, source := range sourceAccounts {
+		name := source.Name()
+		sources[name] = struct{}{}
+
+		target, ok := targets[name]
+		if !ok {
+			drifts = append(drifts, &AccountDrift{Account: name, Kind: AccountMissing})
+			continue
+		}
+
+		if source.Plugin != target.Plugin {
+			drifts = append(drifts, &AccountDrift{Account: name, Kind: AccountPluginDiff, Detail: fmt.Sprintf("source %s, target %s", source.Plugin, target.Plugin)})
+		} else if source.AuthString != target.AuthString {
+			drifts = append(drifts, &AccountDrift{Account: name, Kind: AccountPasswordDiff})
+		}
+
+		missing, extra := diffStrings(source.Privileges, target.Privileges)
+		if len(missing) != 0 {
+			drifts = append(drifts, &AccountDrift{Account: name, Kind: AccountGrantDiff, Detail: fmt.Sprintf("missing in target: %s", strings.Join(missing, "; "))})
+		}
+		if len(extra) != 0 {
+			drifts = append(drifts, &AccountDrift{Account: name, Kind: AccountGrantDiff, Detail: fmt.Sprintf("extra in target: %s", strings.Join(extra, "; "))})
+		}
+	}
+
+	for _, target := range targetAccounts {
+		if _, ok := sources[target.Name()]; !ok {
+			drifts = append(drifts, &AccountDrift{Account: target.Name(), Kind: AccountExtra})
+		}
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool { return drifts[i].Account < drifts[j].Account })
+	return drifts
+}
+
+// diffStrings returns the strings only in strs1 and the strings only in strs2.
+func diffStrings(strs1, strs2 []string) ([]string, []string) {
+	set1 := make(map[string]struct{}, len(strs1))
+	for _, str := range strs1 {
+		set1[str] = struct{}{}
+	}
+	set2 := make(map[string]struct{}, len(strs2))
+	for _, str := range strs2 {
+		set2[str] = struct{}{}
+	}
+
+	var only1, only2 []string
+	for _, str := range strs1 {
+		if _, ok := set2[str]; !ok {
+			only1 = append(only1, str)
+		}
+	}
+	for _, str := range strs2 {
+		if _, ok := set1[str]; !ok {
+			only2 = append(only2, str)
+		}
+	}
+
+	return only1, only2
+}
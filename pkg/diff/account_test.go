@@ -0,0 +1,93 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testAccountSuite{})
+
+type testAccountSuite struct{}
+
+func (s *testAccountSuite) TestCanonicalizeGrant(c *C) {
+	testCases := []struct {
+		grant      string
+		privileges []string
+	}{
+		{"GRANT USAGE ON *.* TO 'u1'@'%' IDENTIFIED BY PASSWORD '*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9'", []string{}},
+		{"GRANT SELECT, INSERT ON `db`.* TO 'u1'@'%' WITH GRANT OPTION", []string{"SELECT ON db.*", "INSERT ON db.*", "GRANT OPTION ON db.*"}},
+		{"GRANT Select,Insert ON db.* TO 'u1'@'%'", []string{"SELECT ON db.*", "INSERT ON db.*"}},
+		{"GRANT ALL ON *.* TO `u1`@`%`", []string{"ALL PRIVILEGES ON *.*"}},
+		{"GRANT SELECT (`b`, `A`), UPDATE (c) ON `db`.`t` TO 'u1'@'localhost'", []string{"SELECT (a,b) ON db.t", "UPDATE (c) ON db.t"}},
+		{"GRANT `r1`@`%` TO `u1`@`%`", []string{"ROLE r1@%"}},
+	}
+	for _, testCase := range testCases {
+		c.Assert(CanonicalizeGrant(testCase.grant), DeepEquals, testCase.privileges, Commentf("grant %s", testCase.grant))
+	}
+}
+
+func (s *testAccountSuite) TestCompareAccounts(c *C) {
+	sourceAccounts := []*Account{
+		{User: "u1", Host: "%", Plugin: defaultAuthPlugin, AuthString: "*ABC", Privileges: []string{"INSERT ON db.*", "SELECT ON db.*"}},
+		{User: "u2", Host: "%", Plugin: defaultAuthPlugin, AuthString: "*ABC"},
+		{User: "u3", Host: "%", Plugin: defaultAuthPlugin, AuthString: "*ABC"},
+	}
+	targetAccounts := []*Account{
+		{User: "u1", Host: "%", Plugin: defaultAuthPlugin, AuthString: "*ABC", Privileges: []string{"SELECT ON db.*", "UPDATE ON db.*"}},
+		{User: "u2", Host: "%", Plugin: defaultAuthPlugin, AuthString: "*DEF"},
+		{User: "u4", Host: "%", Plugin: defaultAuthPlugin},
+	}
+
+	drifts := CompareAccounts(sourceAccounts, targetAccounts)
+	c.Assert(drifts, HasLen, 5)
+	c.Assert(drifts[0].String(), Equals, "account 'u1'@'%': grant, missing in target: INSERT ON db.*")
+	c.Assert(drifts[1].String(), Equals, "account 'u1'@'%': grant, extra in target: UPDATE ON db.*")
+	// the password hash is not printed
+	c.Assert(drifts[2].String(), Equals, "account 'u2'@'%': password")
+	c.Assert(drifts[3].String(), Equals, "account 'u3'@'%': missing")
+	c.Assert(drifts[4].String(), Equals, "account 'u4'@'%': extra")
+
+	c.Assert(CompareAccounts(sourceAccounts, sourceAccounts), HasLen, 0)
+}
+
+func (s *testAccountSuite) TestFetchAccounts(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the password hash is in `Password` in old versions
+	mock.ExpectQuery("SELECT \\* FROM mysql.user").WillReturnRows(sqlmock.NewRows([]string{"Host", "User", "Password", "Select_priv"}).
+		AddRow("%", "u1", "*6bb4837eb74329105ee4568dda7dc67ed2ca2ad9", "N").
+		AddRow("localhost", "mysql.sys", "", "N").
+		AddRow("LOCALHOST", "root", "", "Y").
+		AddRow("%", "it's", "", "N"))
+	mock.ExpectQuery("SHOW GRANTS FOR 'u1'@'%'").WillReturnRows(sqlmock.NewRows([]string{"Grants"}).
+		AddRow("GRANT USAGE ON *.* TO 'u1'@'%'").
+		AddRow("GRANT SELECT ON `db`.* TO 'u1'@'%'"))
+	mock.ExpectQuery("SHOW GRANTS FOR 'it''s'@'%'").WillReturnRows(sqlmock.NewRows([]string{"Grants"}))
+
+	accounts, err := FetchAccounts(context.Background(), db, []string{"root@localhost"})
+	c.Assert(err, IsNil)
+	c.Assert(accounts, HasLen, 2)
+	c.Assert(accounts[0].Name(), Equals, "'u1'@'%'")
+	c.Assert(accounts[0].Plugin, Equals, defaultAuthPlugin)
+	c.Assert(accounts[0].AuthString, Equals, "*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9")
+	c.Assert(accounts[0].Privileges, DeepEquals, []string{"SELECT ON db.*"})
+	c.Assert(accounts[1].User, Equals, "it's")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,237 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// ColumnAggregates are the aggregates of a column's values in a chunk, the NULL values are not aggregated.
+// Sum, Min and Max are nil if all the values are NULL.
+type ColumnAggregates struct {
+	Sum      *big.Rat
+	Min      *big.Rat
+	Max      *big.Rat
+	Distinct int64
+}
+
+// String implements fmt.Stringer interface.
+func (a *ColumnAggregates) String() string {
+	ratString := func(r *big.Rat) string {
+		if r == nil {
+			return "NULL"
+		}
+		return r.RatString()
+	}
+	return fmt.Sprintf("sum %s, distinct %d, min %s, max %s", ratString(a.Sum), a.Distinct, ratString(a.Min), ratString(a.Max))
+}
+
+// merge merges the other shard's aggregates, the number of distinct values is added up.
+func (a *ColumnAggregates) merge(other *ColumnAggregates) {
+	if other.Sum != nil {
+		if a.Sum == nil {
+			a.Sum = new(big.Rat)
+		}
+		a.Sum.Add(a.Sum, other.Sum)
+	}
+	if other.Min != nil && (a.Min == nil || other.Min.Cmp(a.Min) < 0) {
+		a.Min = other.Min
+	}
+	if other.Max != nil && (a.Max == nil || other.Max.Cmp(a.Max) > 0) {
+		a.Max = other.Max
+	}
+	a.Distinct += other.Distinct
+}
+
+// equal returns true if the aggregates are equal, the number of distinct values is not compared if compareDistinct is false.
+func (a *ColumnAggregates) equal(other *ColumnAggregates, compareDistinct bool) bool {
+	equalRat := func(r1, r2 *big.Rat) bool {
+		if r1 == nil || r2 == nil {
+			return r1 == nil && r2 == nil
+		}
+		return r1.Cmp(r2) == 0
+	}
+	return equalRat(a.Sum, other.Sum) && equalRat(a.Min, other.Min) && equalRat(a.Max, other.Max) && (!compareDistinct || a.Distinct == other.Distinct)
+}
+
+// aggregateSource is a RowSource which can calculate the aggregates of the columns in a chunk.
+type aggregateSource interface {
+	getAggregates(ctx context.Context, chunk *ChunkRange, columns []string) (int64, map[string]*ColumnAggregates, error)
+}
+
+// getAggregates returns the number of rows and the columns' aggregates in the chunk.
+func (s *sqlRowSource) getAggregates(ctx context.Context, chunk *ChunkRange, columns []string) (int64, map[string]*ColumnAggregates, error) {
+	/*
+		mysql> SELECT COUNT(*), SUM(`a`), COUNT(DISTINCT `a`), MIN(`a`), MAX(`a`) FROM `test`.`t` WHERE `id` > 0 AND `id` < 100;
+		+----------+----------+---------------------+----------+----------+
+		| COUNT(*) | SUM(`a`) | COUNT(DISTINCT `a`) | MIN(`a`) | MAX(`a`) |
+		+----------+----------+---------------------+----------+----------+
+		|       99 |     4950 |                  99 |        1 |       99 |
+		+----------+----------+---------------------+----------+----------+
+	*/
+	exprs := make([]string, 0, len(columns)*4+1)
+	exprs = append(exprs, "COUNT(*)")
+	for _, column := range columns {
+		expr := s.table.columnExpr(column)
+		exprs = append(exprs, fmt.Sprintf("SUM(%s), COUNT(DISTINCT %s), MIN(%s), MAX(%s)", expr, expr, expr, expr))
+	}
+
+	where, args := s.table.chunkWhere(chunk)
+	query := fmt.Sprintf("SELECT %s FROM %s%s WHERE %s", strings.Join(exprs, ", "), dbutil.TableName(s.table.Schema, s.table.Table), dbutil.IndexHint(s.table.indexHint), where)
+	log.Debug("get chunk aggregates", zap.String("sql", query), zap.Reflect("args", args))
+
+	var count int64
+	values := make([]sql.NullString, len(columns)*4)
+	dest := make([]interface{}, 0, len(values)+1)
+	dest = append(dest, &count)
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+	if err := s.table.Conn.QueryRowContext(ctx, query, args...).Scan(dest...); err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+
+	aggregates := make(map[string]*ColumnAggregates, len(columns))
+	for i, column := range columns {
+		aggregate := &ColumnAggregates{}
+		var err error
+		if aggregate.Sum, err = parseRat(values[i*4]); err != nil {
+			return 0, nil, errors.Annotatef(err, "sum of column %s", column)
+		}
+		distinct, err := parseRat(values[i*4+1])
+		if err != nil || distinct == nil {
+			return 0, nil, errors.NotValidf("count distinct %s of column %s", values[i*4+1].String, column)
+		}
+		aggregate.Distinct = distinct.Num().Int64()
+		if aggregate.Min, err = parseRat(values[i*4+2]); err != nil {
+			return 0, nil, errors.Annotatef(err, "min of column %s", column)
+		}
+		if aggregate.Max, err = parseRat(values[i*4+3]); err != nil {
+			return 0, nil, errors.Annotatef(err, "max of column %s", column)
+		}
+		aggregates[column] = aggregate
+	}
+
+	return count, aggregates, nil
+}
+
+// parseRat parses the decimal value exactly, returns nil if the value is NULL.
+func parseRat(value sql.NullString) (*big.Rat, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	r, ok := new(big.Rat).SetString(value.String)
+	if !ok {
+		return nil, errors.NotValidf("number %s", value.String)
+	}
+	return r, nil
+}
+
+// isExactNumericColumn returns true if the column's values are integers or decimals, whose sums are exact.
+func isExactNumericColumn(col *model.ColumnInfo) bool {
+	switch col.Tp {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeNewDecimal, mysql.TypeYear:
+		return true
+	}
+	return false
+}
+
+// supportAggregate returns true if all the table instances' RowSources can calculate the aggregates.
+func (t *TableDiff) supportAggregate() bool {
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		if _, ok := table.rowSource().(aggregateSource); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAggregateColumns returns error if the aggregate columns are not the target table's integer or decimal columns.
+func (t *TableDiff) checkAggregateColumns() error {
+	for _, column := range t.AggregateColumns {
+		col := dbutil.FindColumnByName(t.TargetTable.info.Columns, column)
+		if col == nil {
+			return errors.NotFoundf("aggregate column %s in table %s.%s", column, t.TargetTable.Schema, t.TargetTable.Table)
+		}
+		if !isExactNumericColumn(col) {
+			return errors.NotSupportedf("aggregate column %s in table %s.%s which is not integer or decimal", column, t.TargetTable.Schema, t.TargetTable.Table)
+		}
+	}
+	return nil
+}
+
+// compareAggregates compares the number of rows and the aggregates of AggregateColumns in the chunk of source tables
+// and target table. the sharding tables' aggregates are merged, and the numbers of distinct values are only compared
+// if there is one source table, because the shards may have the same values.
+func (t *TableDiff) compareAggregates(ctx context.Context, chunk *ChunkRange, result *ChunkResult) (bool, error) {
+	var (
+		sourceCount      int64
+		sourceAggregates = make(map[string]*ColumnAggregates, len(t.AggregateColumns))
+	)
+	for _, column := range t.AggregateColumns {
+		sourceAggregates[column] = &ColumnAggregates{}
+	}
+	for _, sourceTable := range t.SourceTables {
+		ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+		count, aggregates, err := sourceTable.rowSource().(aggregateSource).getAggregates(ctx1, chunk, t.AggregateColumns)
+		cancel1()
+		if err != nil {
+			return false, errors.Annotatef(err, "get aggregates of %s in %s", dbutil.TableName(sourceTable.Schema, sourceTable.Table), sourceTable.InstanceID)
+		}
+
+		sourceCount += count
+		for column, aggregate := range aggregates {
+			sourceAggregates[column].merge(aggregate)
+		}
+	}
+
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+	targetCount, targetAggregates, err := t.TargetTable.rowSource().(aggregateSource).getAggregates(ctx1, chunk, t.AggregateColumns)
+	cancel1()
+	if err != nil {
+		return false, errors.Annotatef(err, "get aggregates of %s in %s", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table), t.TargetTable.InstanceID)
+	}
+
+	result.RowCountCompared = true
+	result.SourceRowCount = sourceCount
+	result.TargetRowCount = targetCount
+	result.AggregatesCompared = true
+
+	equal := sourceCount == targetCount
+	for _, column := range t.AggregateColumns {
+		if !sourceAggregates[column].equal(targetAggregates[column], len(t.SourceTables) == 1) {
+			log.Warn("column's aggregates are not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk),
+				zap.String("column", column), zap.Stringer("source", sourceAggregates[column]), zap.Stringer("target", targetAggregates[column]))
+			equal = false
+		}
+	}
+	if equal {
+		log.Info("aggregates are equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Int64("count", sourceCount))
+		return true, nil
+	}
+
+	log.Warn("aggregates are not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Int64("source count", sourceCount), zap.Int64("target count", targetCount))
+	return false, nil
+}
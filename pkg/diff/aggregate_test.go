@@ -0,0 +1,118 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testAggregateSuite{})
+
+type testAggregateSuite struct{}
+
+func (s *testAggregateSuite) TestCheckAggregateColumns(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` int, `amount` decimal(10,2), `score` double, `name` varchar(10), PRIMARY KEY (`id`))")
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{
+		TargetTable:      &TableInstance{Schema: "test", Table: "t", info: tableInfo},
+		AggregateColumns: []string{"id", "amount"},
+	}
+	c.Assert(td.checkAggregateColumns(), IsNil)
+
+	td.AggregateColumns = []string{"score"}
+	c.Assert(td.checkAggregateColumns(), ErrorMatches, ".*not supported")
+	td.AggregateColumns = []string{"name"}
+	c.Assert(td.checkAggregateColumns(), ErrorMatches, ".*not supported")
+	td.AggregateColumns = []string{"c"}
+	c.Assert(td.checkAggregateColumns(), ErrorMatches, ".*not found")
+}
+
+func (s *testAggregateSuite) TestCompareAggregates(c *C) {
+	sourceDB1, sourceMock1, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB1.Close()
+	sourceDB2, sourceMock2, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB2.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	td := &TableDiff{
+		SourceTables: []*TableInstance{
+			{Conn: sourceDB1, Schema: "test", Table: "t1", InstanceID: "source-1"},
+			{Conn: sourceDB2, Schema: "test", Table: "t2", InstanceID: "source-2"},
+		},
+		TargetTable:      &TableInstance{Conn: targetDB, Schema: "test", Table: "t", InstanceID: "target"},
+		AggregateColumns: []string{"amount"},
+	}
+	c.Assert(td.supportAggregate(), IsTrue)
+
+	chunk := &ChunkRange{Where: "(`id` > ?)", Args: []string{"0"}}
+	columns := []string{"COUNT(*)", "SUM", "DISTINCT", "MIN", "MAX"}
+	query := "SELECT COUNT\\(\\*\\), SUM\\(`amount`\\), COUNT\\(DISTINCT `amount`\\), MIN\\(`amount`\\), MAX\\(`amount`\\) FROM `test`.`%s` WHERE \\(`id` > \\?\\)"
+	expect := func(mock sqlmock.Sqlmock, table string, values ...driver.Value) {
+		mock.ExpectQuery(fmt.Sprintf(query, table)).WithArgs("0").WillReturnRows(sqlmock.NewRows(columns).AddRow(values...))
+	}
+
+	// the sharding tables' aggregates are merged, and the distinct counts are not compared
+	expect(sourceMock1, "t1", 2, "3.50", 2, "1.00", "2.50")
+	expect(sourceMock2, "t2", 1, "2.5", 1, "2.50", "2.50")
+	expect(targetMock, "t", 3, "6.00", 2, "1.00", "2.50")
+	result := &ChunkResult{}
+	equal, err := td.compareAggregates(context.Background(), chunk, result)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+	c.Assert(result.AggregatesCompared, IsTrue)
+	c.Assert(result.SourceRowCount, Equals, int64(3))
+	c.Assert(result.TargetRowCount, Equals, int64(3))
+
+	// the row counts are equal but the sums are not
+	expect(sourceMock1, "t1", 2, "3.50", 2, "1.00", "2.50")
+	expect(sourceMock2, "t2", 1, "2.50", 1, "2.50", "2.50")
+	expect(targetMock, "t", 3, "6.01", 3, "1.00", "2.51")
+	equal, err = td.compareAggregates(context.Background(), chunk, &ChunkResult{})
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+
+	// all the values are NULL in one side
+	td.SourceTables = td.SourceTables[:1]
+	expect(sourceMock1, "t1", 1, nil, 0, nil, nil)
+	expect(targetMock, "t", 1, "0", 1, "0", "0")
+	equal, err = td.compareAggregates(context.Background(), chunk, &ChunkResult{})
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+
+	// the distinct counts are compared if there is one source table
+	expect(sourceMock1, "t1", 2, "2", 2, "0", "2")
+	expect(targetMock, "t", 2, "2", 1, "0", "2")
+	equal, err = td.compareAggregates(context.Background(), chunk, &ChunkResult{})
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+
+	c.Assert(sourceMock1.ExpectationsWereMet(), IsNil)
+	c.Assert(sourceMock2.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+
+	// the files don't support the aggregates
+	td.SourceTables[0].Source = &fileRowSource{}
+	c.Assert(td.supportAggregate(), IsFalse)
+}
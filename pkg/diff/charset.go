@@ -0,0 +1,104 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"strings"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// checkCharsets compares the columns' charsets and collations of the source tables with the target table. the
+// compatible differences like utf8 and utf8mb4 are only warned unless StrictCharset is true.
+func (t *TableDiff) checkCharsets() bool {
+	equal := true
+	for _, sourceTable := range t.SourceTables {
+		for _, difference := range dbutil.DiffCharsets(sourceTable.info, t.TargetTable.info) {
+			compatible := difference.Compatible()
+			log.Warn("column's charset or collation is different", zap.String("source", dbutil.TableName(sourceTable.Schema, sourceTable.Table)),
+				zap.String("target", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Stringer("difference", difference), zap.Bool("compatible", compatible))
+			if !compatible || t.StrictCharset {
+				equal = false
+			}
+		}
+	}
+
+	return equal
+}
+
+// normalizeCollation sets every instance's collation to the binary collation of its charset if the collation is not
+// configured and the collations of the order key are different, for example utf8mb4_general_ci and utf8_bin, so the
+// rows are ordered in the same way in all the instances. only works when the order key and the split fields are
+// all the string columns in the same charset.
+func (t *TableDiff) normalizeCollation() {
+	if len(t.Collation) != 0 {
+		return
+	}
+
+	instances := append([]*TableInstance{t.TargetTable}, t.SourceTables...)
+	charsets := make([]string, 0, len(instances))
+	collations := make(map[string]struct{})
+	for _, table := range instances {
+		cs, tableCollations, ok := t.orderKeyCharset(table.info)
+		if !ok {
+			return
+		}
+		charsets = append(charsets, cs)
+		for _, collation := range tableCollations {
+			collations[collation] = struct{}{}
+		}
+	}
+	if len(collations) <= 1 {
+		return
+	}
+
+	for i, table := range instances {
+		table.collation = dbutil.BinaryCollation(charsets[i])
+		log.Info("order key's collations are different, use the binary collation", zap.String("instance id", table.InstanceID),
+			zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.String("collation", table.collation))
+	}
+}
+
+// orderKeyCharset returns the charset and the collations of the order key and the split fields, returns false if any
+// of them is not a string column or they are in different charsets.
+func (t *TableDiff) orderKeyCharset(tableInfo *model.TableInfo) (string, []string, bool) {
+	_, columns := dbutil.SelectUniqueOrderKey(tableInfo)
+	if len(t.Fields) != 0 {
+		for _, field := range strings.Split(t.Fields, ",") {
+			col := dbutil.FindColumnByName(tableInfo.Columns, strings.TrimSpace(field))
+			if col == nil {
+				return "", nil, false
+			}
+			columns = append(columns, col)
+		}
+	}
+
+	var (
+		cs         string
+		collations []string
+	)
+	for _, col := range columns {
+		colCharset, collation := dbutil.ColumnCharset(tableInfo, col)
+		if len(colCharset) == 0 || (len(cs) != 0 && cs != colCharset) {
+			return "", nil, false
+		}
+		cs = colCharset
+		collations = append(collations, collation)
+	}
+
+	return cs, collations, len(cs) != 0
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testCharsetSuite{})
+
+type testCharsetSuite struct{}
+
+func (s *testCharsetSuite) TestCharsets(c *C) {
+	sourceInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` varchar(20) NOT NULL, `a` int(11), PRIMARY KEY (`id`)) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci")
+	c.Assert(err, IsNil)
+	targetInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` varchar(20) NOT NULL, `a` int(11), PRIMARY KEY (`id`)) DEFAULT CHARSET=utf8")
+	c.Assert(err, IsNil)
+
+	tableDiff := &TableDiff{
+		SourceTables: []*TableInstance{{Schema: "test", Table: "t", InstanceID: "source-1", info: sourceInfo}},
+		TargetTable:  &TableInstance{Schema: "test", Table: "t", InstanceID: "target", info: targetInfo},
+	}
+
+	// utf8mb4 and utf8 are compatible
+	c.Assert(tableDiff.checkCharsets(), IsTrue)
+	tableDiff.StrictCharset = true
+	c.Assert(tableDiff.checkCharsets(), IsFalse)
+
+	tableDiff.normalizeCollation()
+	c.Assert(tableDiff.SourceTables[0].collation, Equals, "utf8mb4_bin")
+	c.Assert(tableDiff.TargetTable.collation, Equals, "utf8_bin")
+
+	// the configured collation is not changed
+	tableDiff.SourceTables[0].collation, tableDiff.TargetTable.collation = "", ""
+	tableDiff.Collation = "utf8mb4_unicode_ci"
+	tableDiff.normalizeCollation()
+	c.Assert(tableDiff.TargetTable.collation, Equals, "")
+
+	// the collation is not applied to the int split field
+	tableDiff.Collation = ""
+	tableDiff.Fields = "a"
+	tableDiff.normalizeCollation()
+	c.Assert(tableDiff.TargetTable.collation, Equals, "")
+
+	latin1Info, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` varchar(20) NOT NULL, `a` int(11), PRIMARY KEY (`id`)) DEFAULT CHARSET=latin1")
+	c.Assert(err, IsNil)
+	tableDiff.TargetTable.info = latin1Info
+	tableDiff.StrictCharset = false
+	c.Assert(tableDiff.checkCharsets(), IsFalse)
+}
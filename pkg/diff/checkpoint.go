@@ -51,6 +51,7 @@ var (
 	// for table: don't have this state
 	ignoreState = "ignore"
 
+	// the names can be changed by SetCheckpointNames
 	checkpointSchemaName = "sync_diff_inspector"
 
 	summaryTableName = "summary"
@@ -58,15 +59,54 @@ var (
 	chunkTableName = "chunk"
 )
 
+// SetCheckpointNames sets the names of the schema and tables saving the checkpoint and summary, the empty name keeps
+// the current one, for example to save them in a dedicated database. the table `history` is also saved in the schema.
+// the names are shared by all the checks in the process, so it should be called before any check.
+func SetCheckpointNames(schema, summaryTable, chunkTable string) error {
+	if len(schema) == 0 {
+		schema = checkpointSchemaName
+	}
+	if len(summaryTable) == 0 {
+		summaryTable = summaryTableName
+	}
+	if len(chunkTable) == 0 {
+		chunkTable = chunkTableName
+	}
+
+	tables := map[string]struct{}{
+		summaryTable:     {},
+		chunkTable:       {},
+		historyTableName: {},
+	}
+	if len(tables) != 3 {
+		return errors.NotValidf("checkpoint table names %s, %s and %s are not unique", summaryTable, chunkTable, historyTableName)
+	}
+
+	checkpointSchemaName = schema
+	summaryTableName = summaryTable
+	chunkTableName = chunkTable
+	return nil
+}
+
+// CheckpointSchemaName returns the name of the schema saving the checkpoint and summary.
+func CheckpointSchemaName() string {
+	return checkpointSchemaName
+}
+
+// IsCheckpointSchema returns true if the schema is used to save the checkpoint and summary.
+func IsCheckpointSchema(schema string) bool {
+	return schema == checkpointSchemaName
+}
+
 // saveChunk saves the chunk's info to `chunk` table
-func saveChunk(ctx context.Context, db *sql.DB, chunkID int, instanceID, schema, table, checksum string, chunk *ChunkRange) error {
+func saveChunk(ctx context.Context, db *sql.DB, chunkID int64, instanceID, schema, table, checksum string, chunk *ChunkRange) error {
 	chunkBytes, err := json.Marshal(chunk)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	sql := fmt.Sprintf("REPLACE INTO `%s`.`%s` VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?);", checkpointSchemaName, chunkTableName)
-	err = dbutil.ExecSQLWithRetry(ctx, db, sql, chunkID, instanceID, schema, table, chunk.Where, checksum, string(chunkBytes), chunk.State, time.Now())
+	sql := fmt.Sprintf("REPLACE INTO `%s`.`%s`(`chunk_id`, `instance_id`, `schema`, `table`, `range`, `checksum`, `chunk_str`, `state`, `update_time`, `version`) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?);", checkpointSchemaName, chunkTableName)
+	err = dbutil.ExecSQLWithRetry(ctx, db, sql, chunkID, instanceID, schema, table, chunk.Where, checksum, string(chunkBytes), chunk.State, time.Now(), checkpointVersion)
 	if err != nil {
 		log.Error("save chunk info failed", zap.Error(err))
 		return errors.Trace(err)
@@ -75,7 +115,7 @@ func saveChunk(ctx context.Context, db *sql.DB, chunkID int, instanceID, schema,
 }
 
 // getChunk gets chunk info from table `chunk` by chunkID
-func getChunk(ctx context.Context, db *sql.DB, instanceID, schema, table string, chunkID int) (*ChunkRange, error) {
+func getChunk(ctx context.Context, db *sql.DB, instanceID, schema, table string, chunkID int64) (*ChunkRange, error) {
 	query := fmt.Sprintf("SELECT `chunk_str` FROM `%s`.`%s` WHERE `instance_id` = ? AND `schema` = ? AND `table` = ? AND `chunk_id` = ? limit 1", checkpointSchemaName, chunkTableName)
 	rows, err := db.QueryContext(ctx, query, instanceID, schema, table, chunkID)
 	if err != nil {
@@ -102,7 +142,7 @@ func getChunk(ctx context.Context, db *sql.DB, instanceID, schema, table string,
 		return nil, errors.Trace(rows.Err())
 	}
 
-	return nil, errors.NotFoundf("instanceID %d, schema %s, table %s, chunk %d", instanceID, schema, table, chunkID)
+	return nil, errors.NotFoundf("instanceID %s, schema %s, table %s, chunk %d", instanceID, schema, table, chunkID)
 }
 
 // loadChunks loads chunk info from table `chunk`
@@ -134,6 +174,35 @@ func loadChunks(ctx context.Context, db *sql.DB, instanceID, schema, table strin
 	return chunks, errors.Trace(rows.Err())
 }
 
+// checkpointLoadBatchSize is the max number of chunks loaded from the checkpoint in one query.
+const checkpointLoadBatchSize = 1000
+
+// loadChunksAfter loads at most limit chunks whose id is greater than afterID from table `chunk`, ordered by the id.
+func loadChunksAfter(ctx context.Context, db *sql.DB, instanceID, schema, table string, afterID int64, limit int) ([]*ChunkRange, error) {
+	query := fmt.Sprintf("SELECT `chunk_str` FROM `%s`.`%s` WHERE `instance_id` = ? AND `schema` = ? AND `table` = ? AND `chunk_id` > ? ORDER BY `chunk_id` LIMIT %d",
+		checkpointSchemaName, chunkTableName, limit)
+	rows, err := db.QueryContext(ctx, query, instanceID, schema, table, afterID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	chunks := make([]*ChunkRange, 0, limit)
+	for rows.Next() {
+		var chunkStr string
+		if err = rows.Scan(&chunkStr); err != nil {
+			return nil, errors.Trace(err)
+		}
+		chunk := new(ChunkRange)
+		if err = json.Unmarshal([]byte(chunkStr), chunk); err != nil {
+			return nil, errors.Trace(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, errors.Trace(rows.Err())
+}
+
 // getTableSummary returns a table's total chunk num, check success chunk num, check failed chunk num, check ignore chunk num and the state
 func getTableSummary(ctx context.Context, db *sql.DB, schema, table string) (total int64, success int64, failed int64, ignore int64, state string, err error) {
 	query := fmt.Sprintf("SELECT `chunk_num`, `check_success_num`, `check_failed_num`, `check_ignore_num`, `state` FROM `%s`.`%s` WHERE `schema` = ? AND `table` = ? LIMIT 1",
@@ -211,8 +280,8 @@ func getChunkSummary(ctx context.Context, db *sql.DB, instanceID, schema, table
 
 // initTableSummary initials a table's summary info in table `summary`
 func initTableSummary(ctx context.Context, db *sql.DB, schema, table string, configHash string) error {
-	sql := fmt.Sprintf("REPLACE INTO `%s`.`%s`(`schema`, `table`, `state`, `config_hash`) VALUES(?, ?, ?, ?)", checkpointSchemaName, summaryTableName)
-	err := dbutil.ExecSQLWithRetry(ctx, db, sql, schema, table, notCheckedState, configHash)
+	sql := fmt.Sprintf("REPLACE INTO `%s`.`%s`(`schema`, `table`, `state`, `config_hash`, `version`) VALUES(?, ?, ?, ?, ?)", checkpointSchemaName, summaryTableName)
+	err := dbutil.ExecSQLWithRetry(ctx, db, sql, schema, table, notCheckedState, configHash, checkpointVersion)
 	if err != nil {
 		log.Error("save summary info failed", zap.Error(err))
 		return errors.Trace(err)
@@ -238,8 +307,9 @@ func updateTableSummary(ctx context.Context, db *sql.DB, instanceID, schema, tab
 		}
 	}
 
-	updateSQL := fmt.Sprintf("UPDATE `%s`.`%s` SET `chunk_num` = ?, `check_success_num` = ?, `check_failed_num` = ?, `check_ignore_num` = ?, `state` = ? WHERE `schema` = ? AND `table` = ?", checkpointSchemaName, summaryTableName)
-	err = dbutil.ExecSQLWithRetry(ctx, db, updateSQL, total, successNum, failedNum, ignoreNum, state, schema, table)
+	// the table is still checking until all the chunks are split and saved, even if all the saved chunks are checked
+	updateSQL := fmt.Sprintf("UPDATE `%s`.`%s` SET `chunk_num` = ?, `check_success_num` = ?, `check_failed_num` = ?, `check_ignore_num` = ?, `state` = IF(`split_done` = 1, ?, ?) WHERE `schema` = ? AND `table` = ?", checkpointSchemaName, summaryTableName)
+	err = dbutil.ExecSQLWithRetry(ctx, db, updateSQL, total, successNum, failedNum, ignoreNum, state, notCheckedState, schema, table)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -247,7 +317,15 @@ func updateTableSummary(ctx context.Context, db *sql.DB, instanceID, schema, tab
 	return nil
 }
 
-// createCheckpointTable creates checkpoint tables, include `summary` and `chunk`
+// markSplitDone marks all the table's chunks are split and saved in table `chunk`, the checkpoint can't be used before
+// it's marked, because the chunks not split yet are not saved.
+func markSplitDone(ctx context.Context, db *sql.DB, schema, table string) error {
+	updateSQL := fmt.Sprintf("UPDATE `%s`.`%s` SET `split_done` = 1 WHERE `schema` = ? AND `table` = ?", checkpointSchemaName, summaryTableName)
+	return errors.Trace(dbutil.ExecSQLWithRetry(ctx, db, updateSQL, schema, table))
+}
+
+// createCheckpointTable creates checkpoint tables, include `summary` and `chunk`, and migrates the tables created by
+// the old versions.
 func createCheckpointTable(ctx context.Context, db *sql.DB) error {
 	createSchemaSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`;", checkpointSchemaName)
 	_, err := db.ExecContext(ctx, createSchemaSQL)
@@ -258,24 +336,27 @@ func createCheckpointTable(ctx context.Context, db *sql.DB) error {
 
 	/* example
 	mysql> select * from sync_diff_inspector.summary;
-	+--------+-------+-----------+-------------------+------------------+------------------+---------+----------------------------------+---------------------+
-	| schema | table | chunk_num | check_success_num | check_failed_num | check_ignore_num | state   | config_hash                      | update_time         |
-	+--------+-------+-----------+-------------------+------------------+------------------+---------+----------------------------------+---------------------+
-	| diff   | test  |       112 |               104 |                0 |                8 | success | 91f302052783672b01af3e2b0e7d66ff | 2019-03-26 12:42:11 |
-	+--------+-------+-----------+-------------------+------------------+------------------+---------+----------------------------------+---------------------+
+	+--------+-------+-----------+-------------------+------------------+------------------+---------+----------------------------------+---------------------+---------+------------+
+	| schema | table | chunk_num | check_success_num | check_failed_num | check_ignore_num | state   | config_hash                      | update_time         | version | split_done |
+	+--------+-------+-----------+-------------------+------------------+------------------+---------+----------------------------------+---------------------+---------+------------+
+	| diff   | test  |       112 |               104 |                0 |                8 | success | 91f302052783672b01af3e2b0e7d66ff | 2019-03-26 12:42:11 |       3 |          1 |
+	+--------+-------+-----------+-------------------+------------------+------------------+---------+----------------------------------+---------------------+---------+------------+
 
 	note: config_hash is the hash value for the config, if config is changed, will clear the history checkpoint.
+	version is the format's version of the row, see checkpointVersion. split_done is 1 after all the chunks are saved.
 	*/
 	createSummaryTableSQL :=
-		"CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`summary`(" +
+		"CREATE TABLE IF NOT EXISTS `" + checkpointSchemaName + "`.`" + summaryTableName + "`(" +
 			"`schema` varchar(30), `table` varchar(30)," +
-			"`chunk_num` int not null default 0," +
-			"`check_success_num` int not null default 0," +
-			"`check_failed_num` int not null default 0," +
-			"`check_ignore_num` int not null default 0," +
+			"`chunk_num` bigint not null default 0," +
+			"`check_success_num` bigint not null default 0," +
+			"`check_failed_num` bigint not null default 0," +
+			"`check_ignore_num` bigint not null default 0," +
 			"`state` enum('not_checked', 'checking', 'success', 'failed') DEFAULT 'not_checked'," +
 			"`config_hash` varchar(50)," +
 			"`update_time` datetime ON UPDATE CURRENT_TIMESTAMP," +
+			"`version` int not null default 0," +
+			"`split_done` tinyint(1) not null default 0," +
 			"PRIMARY KEY(`schema`, `table`));"
 
 	_, err = db.ExecContext(ctx, createSummaryTableSQL)
@@ -287,14 +368,14 @@ func createCheckpointTable(ctx context.Context, db *sql.DB) error {
 	/* example
 	mysql> select * from sync_diff_inspector.chunk where chunk_id = 2;;
 	+----------+-------------+--------+-------+---------------------------------+-------------+-----------+---------+---------------------+
-	| chunk_id | instance_id | schema | table | range                           |  checksum   | chunk_str | state   | update_time         |
-	+----------+-------------+--------+-------+---------------------------------+-------------+-----------+---------+---------------------+
-	|        2 | target-1    | diff   | test1 | (`a` >= ? AND `a` < ? AND TRUE) |  91f3020527 |  .....    | success | 2019-03-26 12:41:42 |
-	+----------+-------------+--------+-------+---------------------------------+-------------+-----------+---------+---------------------+
+	| chunk_id | instance_id | schema | table | range                           |  checksum   | chunk_str | state   | update_time         | version |
+	+----------+-------------+--------+-------+---------------------------------+-------------+-----------+---------+---------------------+---------+
+	|        2 | target-1    | diff   | test1 | (`a` >= ? AND `a` < ? AND TRUE) |  91f3020527 |  .....    | success | 2019-03-26 12:41:42 |       1 |
+	+----------+-------------+--------+-------+---------------------------------+-------------+-----------+---------+---------------------+---------+
 	*/
 	createChunkTableSQL :=
-		"CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`chunk`(" +
-			"`chunk_id` int," +
+		"CREATE TABLE IF NOT EXISTS `" + checkpointSchemaName + "`.`" + chunkTableName + "`(" +
+			"`chunk_id` bigint," +
 			"`instance_id` varchar(30)," +
 			"`schema` varchar(30)," +
 			"`table` varchar(30)," +
@@ -303,6 +384,7 @@ func createCheckpointTable(ctx context.Context, db *sql.DB) error {
 			"`chunk_str` text," +
 			"`state` enum('not_checked', 'checking', 'success', 'failed', 'ignore', 'error') DEFAULT 'not_checked'," +
 			"`update_time` datetime ON UPDATE CURRENT_TIMESTAMP," +
+			"`version` int not null default 0," +
 			"PRIMARY KEY(`schema`, `table`, `instance_id`, `chunk_id`));"
 	_, err = db.ExecContext(ctx, createChunkTableSQL)
 	if err != nil {
@@ -310,7 +392,7 @@ func createCheckpointTable(ctx context.Context, db *sql.DB) error {
 		return errors.Trace(err)
 	}
 
-	return nil
+	return errors.Trace(migrateCheckpointTables(ctx, db))
 }
 
 // cleanCheckpoint deletes the table's checkpoint info in table `summary` and `chunk`
@@ -327,7 +409,7 @@ func cleanCheckpoint(ctx context.Context, db *sql.DB, schema, table string) erro
 	return errors.Trace(dbutil.ExecuteSQLs(ctx, db, sqls, args))
 }
 
-// dropCheckpoint drops the database `sync_diff_inspector`
+// dropCheckpoint drops the checkpoint database, default is `sync_diff_inspector`
 func dropCheckpoint(ctx context.Context, db *sql.DB) error {
 	dropSchemaSQL := fmt.Sprintf("DROP DATABASE IF EXISTS `%s`;", checkpointSchemaName)
 	_, err := db.ExecContext(ctx, dropSchemaSQL)
@@ -341,37 +423,194 @@ func dropCheckpoint(ctx context.Context, db *sql.DB) error {
 
 // loadFromCheckPoint returns true if we should use the history checkpoint
 func loadFromCheckPoint(ctx context.Context, db *sql.DB, schema, table, configHash string) (bool, error) {
-	query := fmt.Sprintf("SELECT `state`, `config_hash` FROM `%s`.`%s` WHERE `schema` = ? AND `table` = ? LIMIT 1;", checkpointSchemaName, summaryTableName)
+	state, ok, err := loadCheckpointState(ctx, db, schema, table, configHash)
+	if err != nil || !ok {
+		return false, errors.Trace(err)
+	}
+
+	// is state is success, will begin a new check for this table
+	// if state is not checked, the chunk info maybe not exists, so just return false
+	return state != successState && state != notCheckedState, nil
+}
+
+// loadCheckpointState returns the table's state in the history checkpoint, and false if the checkpoint can't be used,
+// for example the config is changed.
+func loadCheckpointState(ctx context.Context, db *sql.DB, schema, table, configHash string) (string, bool, error) {
+	query := fmt.Sprintf("SELECT `state`, `config_hash`, `version`, `split_done` FROM `%s`.`%s` WHERE `schema` = ? AND `table` = ? LIMIT 1;", checkpointSchemaName, summaryTableName)
 	rows, err := db.QueryContext(ctx, query, schema, table)
 	if err != nil {
-		return false, errors.Trace(err)
+		return "", false, errors.Trace(err)
 	}
 	defer rows.Close()
 
 	var state, cfgHash sql.NullString
+	var version, splitDone sql.NullInt64
 
 	for rows.Next() {
-		err1 := rows.Scan(&state, &cfgHash)
+		err1 := rows.Scan(&state, &cfgHash, &version, &splitDone)
 		if err1 != nil {
-			return false, errors.Trace(err1)
+			return "", false, errors.Trace(err1)
+		}
+
+		// the checkpoint saved by a newer version may have an unknown format
+		if version.Int64 > checkpointVersion {
+			log.Warn("the checkpoint is saved by a newer version, will not use it", zap.String("table", dbutil.TableName(schema, table)), zap.Int64("version", version.Int64), zap.Int("supported version", checkpointVersion))
+			return "", false, nil
 		}
 
 		if cfgHash.Valid {
 			if configHash != cfgHash.String {
-				return false, nil
+				return "", false, nil
+			}
+		}
+
+		// the check is interrupted while splitting, the chunks not split yet are not saved
+		if splitDone.Int64 == 0 {
+			log.Info("the chunks in checkpoint are not split completely, will not use it", zap.String("table", dbutil.TableName(schema, table)))
+			return "", false, nil
+		}
+
+		return state.String, true, nil
+	}
+
+	return "", false, errors.Trace(rows.Err())
+}
+
+// LoadTablesLastCheckTime returns the time of every table's latest finished check in table `summary`, the key is
+// the table's name returned by dbutil.TableName. the tables never finished are not returned.
+func LoadTablesLastCheckTime(ctx context.Context, db *sql.DB) (map[string]time.Time, error) {
+	// the checkpoint tables may not exist in the first run
+	err := createCheckpointTable(ctx, db)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	query := fmt.Sprintf("SELECT `schema`, `table`, UNIX_TIMESTAMP(`update_time`) FROM `%s`.`%s` WHERE `state` IN (?, ?) AND `update_time` IS NOT NULL",
+		checkpointSchemaName, summaryTableName)
+	rows, err := db.QueryContext(ctx, query, successState, failedState)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	lastCheckTimes := make(map[string]time.Time)
+	for rows.Next() {
+		var (
+			schema, table string
+			updateTime    sql.NullInt64
+		)
+		err1 := rows.Scan(&schema, &table, &updateTime)
+		if err1 != nil {
+			return nil, errors.Trace(err1)
+		}
+		if updateTime.Valid {
+			lastCheckTimes[dbutil.TableName(schema, table)] = time.Unix(updateTime.Int64, 0)
+		}
+	}
+
+	return lastCheckTimes, errors.Trace(rows.Err())
+}
+
+// the max number of rows deleted in one statement when cleaning up the checkpoint, to avoid large transactions
+const cleanupBatchSize = 1000
+
+// CheckpointCleanupPolicy decides which rows are pruned from the checkpoint tables `summary` and `chunk`.
+type CheckpointCleanupPolicy struct {
+	// the rows not updated in it are deleted, 0 means don't delete rows by time.
+	Retention time.Duration
+	// returns false if the table is deleted, all the rows of the deleted tables are deleted. nil means don't delete rows by table.
+	TableExists func(ctx context.Context, schema, table string) (bool, error)
+}
+
+// CleanupCheckpoint deletes the rows of the checkpoint tables by the policy, returns the number of deleted rows.
+func CleanupCheckpoint(ctx context.Context, db *sql.DB, policy CheckpointCleanupPolicy) (int64, error) {
+	// the checkpoint tables may not exist if never checked
+	err := createCheckpointTable(ctx, db)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	var deleted int64
+	if policy.Retention > 0 {
+		for _, tableName := range []string{summaryTableName, chunkTableName} {
+			// the summary's update time is NULL before the first update, it's a new check and should be kept
+			deleteSQL := fmt.Sprintf("DELETE FROM `%s`.`%s` WHERE `update_time` < DATE_SUB(NOW(), INTERVAL ? SECOND) LIMIT %d", checkpointSchemaName, tableName, cleanupBatchSize)
+			num, err := deleteInBatches(ctx, db, deleteSQL, int64(policy.Retention.Seconds()))
+			deleted += num
+			if err != nil {
+				return deleted, errors.Trace(err)
 			}
+			log.Info("delete expired checkpoint", zap.String("table", tableName), zap.Int64("rows", num), zap.Duration("retention", policy.Retention))
 		}
+	}
+
+	if policy.TableExists != nil {
+		tables, err := loadCheckpointTables(ctx, db)
+		if err != nil {
+			return deleted, errors.Trace(err)
+		}
+
+		for _, table := range tables {
+			exists, err := policy.TableExists(ctx, table[0], table[1])
+			if err != nil {
+				return deleted, errors.Trace(err)
+			}
+			if exists {
+				continue
+			}
 
-		if state.Valid {
-			// is state is success, will begin a new check for this table
-			// if state is not checked, the chunk info maybe not exists, so just return false
-			if state.String == successState || state.String == notCheckedState {
-				return false, nil
+			for _, tableName := range []string{summaryTableName, chunkTableName} {
+				deleteSQL := fmt.Sprintf("DELETE FROM `%s`.`%s` WHERE `schema` = ? AND `table` = ? LIMIT %d", checkpointSchemaName, tableName, cleanupBatchSize)
+				num, err := deleteInBatches(ctx, db, deleteSQL, table[0], table[1])
+				deleted += num
+				if err != nil {
+					return deleted, errors.Trace(err)
+				}
 			}
+			log.Info("delete checkpoint of deleted table", zap.String("table", dbutil.TableName(table[0], table[1])))
 		}
+	}
+
+	return deleted, nil
+}
+
+// loadCheckpointTables returns the schema and name of the tables in the checkpoint tables.
+func loadCheckpointTables(ctx context.Context, db *sql.DB) ([][2]string, error) {
+	query := fmt.Sprintf("SELECT DISTINCT `schema`, `table` FROM `%[1]s`.`%[2]s` UNION SELECT DISTINCT `schema`, `table` FROM `%[1]s`.`%[3]s`",
+		checkpointSchemaName, summaryTableName, chunkTableName)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
 
-		return true, nil
+	var tables [][2]string
+	for rows.Next() {
+		var schema, table string
+		if err = rows.Scan(&schema, &table); err != nil {
+			return nil, errors.Trace(err)
+		}
+		tables = append(tables, [2]string{schema, table})
 	}
 
-	return false, errors.Trace(rows.Err())
+	return tables, errors.Trace(rows.Err())
+}
+
+// deleteInBatches executes the delete statement with limit until no more rows are deleted, returns the number of deleted rows.
+func deleteInBatches(ctx context.Context, db *sql.DB, deleteSQL string, args ...interface{}) (int64, error) {
+	var deleted int64
+	for {
+		result, err := db.ExecContext(ctx, deleteSQL, args...)
+		if err != nil {
+			return deleted, errors.Trace(err)
+		}
+		num, err := result.RowsAffected()
+		if err != nil {
+			return deleted, errors.Trace(err)
+		}
+		deleted += num
+		if num < cleanupBatchSize {
+			return deleted, nil
+		}
+	}
 }
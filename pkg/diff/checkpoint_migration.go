@@ -0,0 +1,207 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// checkpointVersion is the version of the checkpoint tables' format, saved in the column `version` of every row.
+// increase it and add a migration when the format is changed, so the checkpoints saved by the old versions can still
+// be used after upgrade.
+const checkpointVersion = 3
+
+// checkpointMigration upgrades the rows of the checkpoint tables from the previous version to the version.
+type checkpointMigration struct {
+	version int
+	// upgrades the table's rows of the previous version, nil means only the version is changed.
+	migrate func(ctx context.Context, db *sql.DB, tableName string) error
+}
+
+// checkpointMigrations are ordered by the version, the rows saved before the versioning are version 0.
+var checkpointMigrations = []checkpointMigration{
+	// version 1 adds the column `version`, the rows' format is not changed
+	{version: 1},
+	// version 2 widens the chunk id and the numbers of chunks to 64 bits by widenCheckpointColumns, the rows' format is
+	// not changed, but the ids may overflow in the old versions
+	{version: 2},
+	// version 3 adds the column `split_done` to the summary by addSplitDoneColumn, the old versions save the chunks
+	// after the table is split completely, so their summaries are marked as split done
+	{version: 3, migrate: markSplitDone},
+}
+
+// checkpointWideColumns are the columns widened to bigint in version 2, and their definitions.
+var checkpointWideColumns = map[string]string{
+	"chunk_id":          "bigint",
+	"chunk_num":         "bigint not null default 0",
+	"check_success_num": "bigint not null default 0",
+	"check_failed_num":  "bigint not null default 0",
+	"check_ignore_num":  "bigint not null default 0",
+}
+
+// migrateCheckpointTables adds the column `version` to the checkpoint tables created by the old versions, and
+// upgrades the rows of the old versions to checkpointVersion.
+func migrateCheckpointTables(ctx context.Context, db *sql.DB) error {
+	versioned := make(map[string]bool)
+	query := "SELECT `TABLE_NAME` FROM `information_schema`.`COLUMNS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` IN (?, ?) AND `COLUMN_NAME` = 'version'"
+	rows, err := db.QueryContext(ctx, query, checkpointSchemaName, summaryTableName, chunkTableName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for rows.Next() {
+		var tableName string
+		if err = rows.Scan(&tableName); err != nil {
+			rows.Close()
+			return errors.Trace(err)
+		}
+		versioned[tableName] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, tableName := range []string{summaryTableName, chunkTableName} {
+		if versioned[tableName] {
+			continue
+		}
+
+		alterSQL := fmt.Sprintf("ALTER TABLE `%s`.`%s` ADD COLUMN `version` int not null default 0", checkpointSchemaName, tableName)
+		if _, err = db.ExecContext(ctx, alterSQL); err != nil {
+			return errors.Annotatef(err, "add column version to checkpoint table %s", tableName)
+		}
+		log.Info("add column version to checkpoint table", zap.String("table", tableName))
+	}
+
+	if err = widenCheckpointColumns(ctx, db); err != nil {
+		return errors.Trace(err)
+	}
+	// the columns are added before the rows are migrated, so the migrations can set them
+	if err = addSplitDoneColumn(ctx, db); err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, tableName := range []string{summaryTableName, chunkTableName} {
+		if err = migrateCheckpointRows(ctx, db, tableName); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// markSplitDone marks the summaries of the old versions as split done.
+func markSplitDone(ctx context.Context, db *sql.DB, tableName string) error {
+	if tableName != summaryTableName {
+		return nil
+	}
+
+	updateSQL := fmt.Sprintf("UPDATE `%s`.`%s` SET `split_done` = 1, `update_time` = `update_time` WHERE `version` < ?", checkpointSchemaName, tableName)
+	_, err := db.ExecContext(ctx, updateSQL, 3)
+	return errors.Trace(err)
+}
+
+// addSplitDoneColumn adds the column `split_done` to the summary table created by the old versions.
+func addSplitDoneColumn(ctx context.Context, db *sql.DB) error {
+	var count int
+	query := "SELECT COUNT(*) FROM `information_schema`.`COLUMNS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ? AND `COLUMN_NAME` = 'split_done'"
+	if err := db.QueryRowContext(ctx, query, checkpointSchemaName, summaryTableName).Scan(&count); err != nil {
+		return errors.Trace(err)
+	}
+	if count != 0 {
+		return nil
+	}
+
+	alterSQL := fmt.Sprintf("ALTER TABLE `%s`.`%s` ADD COLUMN `split_done` tinyint(1) not null default 0", checkpointSchemaName, summaryTableName)
+	if _, err := db.ExecContext(ctx, alterSQL); err != nil {
+		return errors.Annotatef(err, "add column split_done to checkpoint table %s", summaryTableName)
+	}
+	log.Info("add column split_done to checkpoint table", zap.String("table", summaryTableName))
+	return nil
+}
+
+// widenCheckpointColumns modifies the int columns created by the old versions to bigint, so the huge tables' chunk
+// ids and numbers of chunks don't overflow.
+func widenCheckpointColumns(ctx context.Context, db *sql.DB) error {
+	query := "SELECT `TABLE_NAME`, `COLUMN_NAME` FROM `information_schema`.`COLUMNS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` IN (?, ?) AND `DATA_TYPE` = 'int'"
+	rows, err := db.QueryContext(ctx, query, checkpointSchemaName, summaryTableName, chunkTableName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var narrowColumns [][2]string
+	for rows.Next() {
+		var tableName, columnName string
+		if err = rows.Scan(&tableName, &columnName); err != nil {
+			rows.Close()
+			return errors.Trace(err)
+		}
+		if _, ok := checkpointWideColumns[columnName]; ok {
+			narrowColumns = append(narrowColumns, [2]string{tableName, columnName})
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, column := range narrowColumns {
+		alterSQL := fmt.Sprintf("ALTER TABLE `%s`.`%s` MODIFY COLUMN `%s` %s", checkpointSchemaName, column[0], column[1], checkpointWideColumns[column[1]])
+		if _, err = db.ExecContext(ctx, alterSQL); err != nil {
+			return errors.Annotatef(err, "widen column %s of checkpoint table %s", column[1], column[0])
+		}
+		log.Info("widen column of checkpoint table", zap.String("table", column[0]), zap.String("column", column[1]))
+	}
+
+	return nil
+}
+
+// migrateCheckpointRows upgrades the table's rows of the old versions by the migrations one by one.
+func migrateCheckpointRows(ctx context.Context, db *sql.DB, tableName string) error {
+	var minVersion sql.NullInt64
+	query := fmt.Sprintf("SELECT MIN(`version`) FROM `%s`.`%s`", checkpointSchemaName, tableName)
+	if err := db.QueryRowContext(ctx, query).Scan(&minVersion); err != nil {
+		return errors.Trace(err)
+	}
+	// the table is empty or all the rows are up to date
+	if !minVersion.Valid || minVersion.Int64 >= checkpointVersion {
+		return nil
+	}
+
+	for _, migration := range checkpointMigrations {
+		if int64(migration.version) <= minVersion.Int64 {
+			continue
+		}
+
+		if migration.migrate != nil {
+			if err := migration.migrate(ctx, db, tableName); err != nil {
+				return errors.Annotatef(err, "migrate checkpoint table %s to version %d", tableName, migration.version)
+			}
+		}
+
+		// keep the update time, it's used to prune the expired checkpoint
+		updateSQL := fmt.Sprintf("UPDATE `%s`.`%s` SET `version` = ?, `update_time` = `update_time` WHERE `version` < ?", checkpointSchemaName, tableName)
+		if _, err := db.ExecContext(ctx, updateSQL, migration.version, migration.version); err != nil {
+			return errors.Annotatef(err, "migrate checkpoint table %s to version %d", tableName, migration.version)
+		}
+	}
+	log.Info("migrate checkpoint table", zap.String("table", tableName), zap.Int64("from version", minVersion.Int64), zap.Int("to version", checkpointVersion))
+
+	return nil
+}
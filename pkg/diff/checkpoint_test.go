@@ -16,9 +16,12 @@ package diff
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
 )
 
 var _ = Suite(&testCheckpointSuite{})
@@ -91,6 +94,14 @@ func (s *testCheckpointSuite) testUpdateSummary(c *C, db *sql.DB) {
 	err = saveChunk(context.Background(), db, ignoreChunk.ID, "target", "test", "checkpoint", "", ignoreChunk)
 	c.Assert(err, IsNil)
 
+	// the table is still checking before all the chunks are split
+	err = updateTableSummary(context.Background(), db, "target", "test", "checkpoint")
+	c.Assert(err, IsNil)
+	_, _, _, _, state, err := getTableSummary(context.Background(), db, "test", "checkpoint")
+	c.Assert(err, IsNil)
+	c.Assert(state, Equals, notCheckedState)
+
+	c.Assert(markSplitDone(context.Background(), db, "test", "checkpoint"), IsNil)
 	err = updateTableSummary(context.Background(), db, "target", "test", "checkpoint")
 	c.Assert(err, IsNil)
 
@@ -107,18 +118,255 @@ func (s *testUtilSuite) TestloadFromCheckPoint(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
 
-	rows := sqlmock.NewRows([]string{"state", "config_hash"}).AddRow("success", "123")
+	rows := sqlmock.NewRows([]string{"state", "config_hash", "version", "split_done"}).AddRow("success", "123", checkpointVersion, 1)
 	mock.ExpectQuery("SELECT").WillReturnRows(rows)
 	useCheckpoint, err := loadFromCheckPoint(context.Background(), db, "test", "test", "123")
 	c.Assert(useCheckpoint, Equals, false)
 
-	rows = sqlmock.NewRows([]string{"state", "config_hash"}).AddRow("success", "123")
+	rows = sqlmock.NewRows([]string{"state", "config_hash", "version", "split_done"}).AddRow("success", "123", checkpointVersion, 1)
 	mock.ExpectQuery("SELECT").WillReturnRows(rows)
 	useCheckpoint, err = loadFromCheckPoint(context.Background(), db, "test", "test", "456")
 	c.Assert(useCheckpoint, Equals, false)
 
-	rows = sqlmock.NewRows([]string{"state", "config_hash"}).AddRow("failed", "123")
+	rows = sqlmock.NewRows([]string{"state", "config_hash", "version", "split_done"}).AddRow("failed", "123", checkpointVersion, 1)
 	mock.ExpectQuery("SELECT").WillReturnRows(rows)
 	useCheckpoint, err = loadFromCheckPoint(context.Background(), db, "test", "test", "123")
 	c.Assert(useCheckpoint, Equals, true)
+	// the checkpoint saved by a newer version is not used
+	rows = sqlmock.NewRows([]string{"state", "config_hash", "version", "split_done"}).AddRow("failed", "123", checkpointVersion+1, 1)
+	mock.ExpectQuery("SELECT").WillReturnRows(rows)
+	useCheckpoint, err = loadFromCheckPoint(context.Background(), db, "test", "test", "123")
+	c.Assert(err, IsNil)
+	c.Assert(useCheckpoint, Equals, false)
+	// the check is interrupted while splitting
+	rows = sqlmock.NewRows([]string{"state", "config_hash", "version", "split_done"}).AddRow("failed", "123", checkpointVersion, 0)
+	mock.ExpectQuery("SELECT").WillReturnRows(rows)
+	useCheckpoint, err = loadFromCheckPoint(context.Background(), db, "test", "test", "123")
+	c.Assert(err, IsNil)
+	c.Assert(useCheckpoint, Equals, false)
+}
+
+func (s *testUtilSuite) TestLoadTablesLastCheckTime(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec("CREATE").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	expectMigrateCheckpoint(mock, "summary", "chunk")
+	rows := sqlmock.NewRows([]string{"schema", "table", "update_time"}).AddRow("test", "t1", 1575158400).AddRow("test", "t2", nil)
+	mock.ExpectQuery("SELECT `schema`, `table`").WithArgs(successState, failedState).WillReturnRows(rows)
+
+	lastCheckTimes, err := LoadTablesLastCheckTime(context.Background(), db)
+	c.Assert(err, IsNil)
+	c.Assert(lastCheckTimes, DeepEquals, map[string]time.Time{"`test`.`t1`": time.Unix(1575158400, 0)})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testCheckpointSuite) TestCleanupCheckpoint(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	expectCreateTables := func() {
+		mock.ExpectExec("CREATE DATABASE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`summary`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`chunk`").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectMigrateCheckpoint(mock, "summary", "chunk")
+	}
+
+	// delete the expired rows in batches
+	expectCreateTables()
+	mock.ExpectExec("DELETE FROM `sync_diff_inspector`.`summary` WHERE `update_time` <").WithArgs(int64(86400)).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM `sync_diff_inspector`.`chunk` WHERE `update_time` <").WithArgs(int64(86400)).WillReturnResult(sqlmock.NewResult(0, cleanupBatchSize))
+	mock.ExpectExec("DELETE FROM `sync_diff_inspector`.`chunk` WHERE `update_time` <").WithArgs(int64(86400)).WillReturnResult(sqlmock.NewResult(0, 10))
+	deleted, err := CleanupCheckpoint(context.Background(), db, CheckpointCleanupPolicy{Retention: 24 * time.Hour})
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, int64(cleanupBatchSize+13))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// delete the rows of the deleted tables
+	expectCreateTables()
+	mock.ExpectQuery("SELECT DISTINCT `schema`, `table`").WillReturnRows(sqlmock.NewRows([]string{"schema", "table"}).AddRow("test", "t1").AddRow("test", "t2"))
+	mock.ExpectExec("DELETE FROM `sync_diff_inspector`.`summary` WHERE `schema` = \\? AND `table` = \\?").WithArgs("test", "t2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `sync_diff_inspector`.`chunk` WHERE `schema` = \\? AND `table` = \\?").WithArgs("test", "t2").WillReturnResult(sqlmock.NewResult(0, 5))
+	deleted, err = CleanupCheckpoint(context.Background(), db, CheckpointCleanupPolicy{
+		TableExists: func(ctx context.Context, schema, table string) (bool, error) {
+			return table == "t1", nil
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(deleted, Equals, int64(6))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testCheckpointSuite) TestSetCheckpointNames(c *C) {
+	defer SetCheckpointNames("sync_diff_inspector", "summary", "chunk")
+
+	c.Assert(SetCheckpointNames("", "chunk", ""), NotNil)
+	c.Assert(SetCheckpointNames("", "history", ""), NotNil)
+	c.Assert(SetCheckpointNames("diff_meta", "", "diff_chunk"), IsNil)
+	c.Assert(IsCheckpointSchema("diff_meta"), IsTrue)
+	c.Assert(IsCheckpointSchema("sync_diff_inspector"), IsFalse)
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `diff_meta`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `diff_meta`.`summary`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `diff_meta`.`diff_chunk`").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectMigrateCheckpoint(mock, "summary", "diff_chunk")
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `diff_meta`.`summary` WHERE `schema` = \\? AND `table` = \\?").WithArgs("test", "t1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `diff_meta`.`diff_chunk` WHERE `schema` = \\? AND `table` = \\?").WithArgs("test", "t1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(createCheckpointTable(context.Background(), db), IsNil)
+	c.Assert(cleanCheckpoint(context.Background(), db, "test", "t1"), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testCheckpointSuite) TestMigrateCheckpointTables(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the chunk table is created by the old version
+	mock.ExpectQuery("SELECT `TABLE_NAME` FROM `information_schema`.`COLUMNS`").WithArgs("sync_diff_inspector", "summary", "chunk").WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow("summary"))
+	mock.ExpectExec("ALTER TABLE `sync_diff_inspector`.`chunk` ADD COLUMN `version`").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the chunk id and the numbers of chunks are int in the old version
+	mock.ExpectQuery("SELECT `TABLE_NAME`, `COLUMN_NAME` FROM `information_schema`.`COLUMNS`").WithArgs("sync_diff_inspector", "summary", "chunk").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME"}).AddRow("summary", "chunk_num").AddRow("chunk", "chunk_id").AddRow("chunk", "version"))
+	mock.ExpectExec("ALTER TABLE `sync_diff_inspector`.`summary` MODIFY COLUMN `chunk_num` bigint not null default 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `sync_diff_inspector`.`chunk` MODIFY COLUMN `chunk_id` bigint").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the summary table doesn't have the column split_done in the old version
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `information_schema`.`COLUMNS`").WithArgs("sync_diff_inspector", "summary").WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+	mock.ExpectExec("ALTER TABLE `sync_diff_inspector`.`summary` ADD COLUMN `split_done`").WillReturnResult(sqlmock.NewResult(0, 0))
+	// the summaries of version 2 are split done
+	mock.ExpectQuery("SELECT MIN\\(`version`\\) FROM `sync_diff_inspector`.`summary`").WillReturnRows(sqlmock.NewRows([]string{"MIN(`version`)"}).AddRow(2))
+	mock.ExpectExec("UPDATE `sync_diff_inspector`.`summary` SET `split_done` = 1").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec("UPDATE `sync_diff_inspector`.`summary` SET `version` = \\?").WithArgs(3, 3).WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectQuery("SELECT MIN\\(`version`\\) FROM `sync_diff_inspector`.`chunk`").WillReturnRows(sqlmock.NewRows([]string{"MIN(`version`)"}).AddRow(0))
+	mock.ExpectExec("UPDATE `sync_diff_inspector`.`chunk` SET `version` = \\?").WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("UPDATE `sync_diff_inspector`.`chunk` SET `version` = \\?").WithArgs(2, 2).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("UPDATE `sync_diff_inspector`.`chunk` SET `version` = \\?").WithArgs(3, 3).WillReturnResult(sqlmock.NewResult(0, 10))
+	c.Assert(migrateCheckpointTables(context.Background(), db), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+// expectMigrateCheckpoint expects the checkpoint tables are up to date.
+func expectMigrateCheckpoint(mock sqlmock.Sqlmock, summaryTable, chunkTable string) {
+	mock.ExpectQuery("SELECT `TABLE_NAME` FROM `information_schema`.`COLUMNS`").WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow(summaryTable).AddRow(chunkTable))
+	mock.ExpectQuery("SELECT `TABLE_NAME`, `COLUMN_NAME` FROM `information_schema`.`COLUMNS`").WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME"}))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `information_schema`.`COLUMNS`").WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	for _, tableName := range []string{summaryTable, chunkTable} {
+		mock.ExpectQuery("SELECT MIN\\(`version`\\) FROM .*`" + tableName + "`").WillReturnRows(sqlmock.NewRows([]string{"MIN(`version`)"}).AddRow(checkpointVersion))
+	}
+}
+
+func (s *testCheckpointSuite) TestCheckpointChunkSource(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	td := &TableDiff{TargetTable: &TableInstance{Conn: db, InstanceID: "target", Schema: "test", Table: "t"}}
+	states := []string{successState, failedState, ignoreState, notCheckedState}
+	summaryRows := sqlmock.NewRows([]string{"state", "COUNT(*)"})
+	chunkRows := sqlmock.NewRows([]string{"chunk_str"})
+	for i, state := range states {
+		summaryRows.AddRow(state, 1)
+		chunkRows.AddRow(fmt.Sprintf(`{"id":%d,"state":"%s"}`, i, state))
+	}
+	mock.ExpectQuery("SELECT `state`, COUNT\\(\\*\\) FROM `sync_diff_inspector`.`chunk`").WithArgs("target", "test", "t").WillReturnRows(summaryRows)
+	mock.ExpectQuery("SELECT `chunk_str` FROM `sync_diff_inspector`.`chunk` WHERE .* AND `chunk_id` > \\? ORDER BY `chunk_id` LIMIT 1000").WithArgs("target", "test", "t", -1).WillReturnRows(chunkRows)
+
+	// the success and ignored chunks are skipped
+	source, total, err := td.checkpointChunkSource(context.Background(), true)
+	c.Assert(err, IsNil)
+	c.Assert(total, Equals, int64(2))
+	for _, expectState := range []string{failedState, notCheckedState} {
+		chunk, err := source(context.Background())
+		c.Assert(err, IsNil)
+		c.Assert(chunk.State, Equals, expectState)
+	}
+	chunk, err := source(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(chunk, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testCheckpointSuite) TestRecheckFailedUsesCheckpoint(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// the checkpoint is saved by the previous check without the flags
+	td := &TableDiff{TargetTable: &TableInstance{Conn: db, InstanceID: "target", Schema: "test", Table: "t"}, Range: "TRUE", UseCheckpoint: true}
+	c.Assert(td.setConfigHash(), IsNil)
+	savedHash := td.configHash
+
+	for _, flags := range []struct{ resume, recheck bool }{{true, false}, {false, true}} {
+		td.ResumeFailedChunks = flags.resume
+		td.RecheckFailed = flags.recheck
+
+		mock.ExpectExec("CREATE DATABASE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`summary`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`chunk`").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectMigrateCheckpoint(mock, "summary", "chunk")
+		mock.ExpectQuery("SELECT `state`, `config_hash`, `version`, `split_done` FROM `sync_diff_inspector`.`summary`").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"state", "config_hash", "version", "split_done"}).AddRow(failedState, savedHash, checkpointVersion, 1))
+
+		useCheckpoint, err := td.prepareCheckpoint(context.Background())
+		c.Assert(err, IsNil)
+		c.Assert(useCheckpoint, IsTrue)
+		c.Assert(td.configHash, Equals, savedHash)
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+	}
+}
+
+func (s *testCheckpointSuite) TestIteratorChunkSourceSplitDone(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	td := &TableDiff{TargetTable: &TableInstance{Conn: db, InstanceID: "target", Schema: "test", Table: "t"}, Progress: NewNoopProgress()}
+	split := func(interrupted bool) func(emit func(*ChunkRange) error) error {
+		return func(emit func(*ChunkRange) error) error {
+			for i := 0; i < 2; i++ {
+				if err := emit(&ChunkRange{Bounds: []*Bound{{Column: "a", Lower: fmt.Sprint(i), LowerSymbol: ">"}}}); err != nil {
+					return err
+				}
+			}
+			if interrupted {
+				return errors.New("connection refused")
+			}
+			return nil
+		}
+	}
+
+	for _, interrupted := range []bool{true, false} {
+		iter := newChunkIterator(context.Background(), "TRUE", "", split(interrupted))
+		firstChunk, err := iter.Next(context.Background())
+		c.Assert(err, IsNil)
+		source := td.iteratorChunkSource(firstChunk, iter)
+
+		for i := 0; i < 2; i++ {
+			mock.ExpectExec("REPLACE INTO `sync_diff_inspector`.`chunk`").WillReturnResult(sqlmock.NewResult(0, 1))
+			chunk, err := source(context.Background())
+			c.Assert(err, IsNil)
+			c.Assert(chunk.ID, Equals, int64(i))
+		}
+		if interrupted {
+			// the split is not marked done, so the checkpoint of the saved chunks is not used by the next check
+			_, err = source(context.Background())
+			c.Assert(err, ErrorMatches, ".*connection refused.*")
+		} else {
+			mock.ExpectExec("UPDATE `sync_diff_inspector`.`summary` SET `split_done` = 1").WithArgs("test", "t").WillReturnResult(sqlmock.NewResult(0, 1))
+			chunk, err := source(context.Background())
+			c.Assert(err, IsNil)
+			c.Assert(chunk, IsNil)
+		}
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+		iter.Close()
+	}
 }
@@ -18,12 +18,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/utils"
 	"go.uber.org/zap"
@@ -47,11 +49,26 @@ type Bound struct {
 	LowerSymbol string `json:"lower-symbol"`
 	Upper       string `json:"upper"`
 	UpperSymbol string `json:"upper-symbol"`
+	// the type the bound values are cast to, for example "DECIMAL(10,2)", not cast if is empty.
+	Cast string `json:"cast,omitempty"`
+	// set true if the column is ENUM, the values are the elements' indexes and compared with the column's index,
+	// because ENUM is sorted by the index but compared with the string by the label.
+	EnumIndex bool `json:"enum-index,omitempty"`
+}
+
+// placeholder returns the placeholder of the bound's value in the chunk's conditions.
+func (b *Bound) placeholder() string {
+	if len(b.Cast) == 0 {
+		return "?"
+	}
+	return fmt.Sprintf("CAST(? AS %s)", b.Cast)
 }
 
 // ChunkRange represents chunk range
 type ChunkRange struct {
-	ID     int      `json:"id"`
+	// the sequence of the chunk in the table's split, it's unique in the chunks of the table in the instance, and
+	// 64 bits so the huge tables can be split to more than 2^31 chunks.
+	ID     int64    `json:"id"`
 	Bounds []*Bound `json:"bounds"`
 	Mode   string   `json:"mode"`
 
@@ -80,10 +97,49 @@ func (c *ChunkRange) String() string {
 	return string(chunkBytes)
 }
 
+// sampled returns true if the chunk is in the sample of the percent, it's decided by the hash of the chunk's bounds and
+// the seed, so the same chunks are sampled in every run with the same config, and the sampled run can be resumed.
+func (c *ChunkRange) sampled(seed string, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	for _, bound := range c.Bounds {
+		for _, field := range []string{bound.Column, bound.Lower, bound.LowerSymbol, bound.Upper, bound.UpperSymbol} {
+			// separate the fields, so ("ab", "c") and ("a", "bc") have different hash
+			h.Write([]byte{0})
+			h.Write([]byte(field))
+		}
+	}
+
+	return int(h.Sum32()%100) < percent
+}
+
 func (c *ChunkRange) toString(collation string) (string, []string) {
+	return c.toStringByExprs(collation, nil)
+}
+
+// toStringByExprs returns the chunk's conditions like toString, the columns in columnExprs are replaced by the expressions.
+func (c *ChunkRange) toStringByExprs(collation string, columnExprs map[string]string) (string, []string) {
+	columnExpr := func(column string) string {
+		if expr, ok := columnExprs[column]; ok {
+			return fmt.Sprintf("(%s)", expr)
+		}
+		return fmt.Sprintf("`%s`", column)
+	}
+
 	if collation != "" {
 		collation = fmt.Sprintf(" COLLATE '%s'", collation)
 	}
+	// boundExpr returns the expression compared with the bound's values, the collation is only for the labels.
+	boundExpr := func(bound *Bound, collation string) string {
+		if bound.EnumIndex {
+			return fmt.Sprintf("(%s + 0)", columnExpr(bound.Column))
+		}
+		return columnExpr(bound.Column) + collation
+	}
 
 	if c.Mode != bucketMode {
 		conditions := make([]string, 0, 2)
@@ -91,11 +147,11 @@ func (c *ChunkRange) toString(collation string) (string, []string) {
 
 		for _, bound := range c.Bounds {
 			if len(bound.Lower) != 0 {
-				conditions = append(conditions, fmt.Sprintf("`%s`%s %s ?", bound.Column, collation, bound.LowerSymbol))
+				conditions = append(conditions, fmt.Sprintf("%s %s %s", boundExpr(bound, collation), bound.LowerSymbol, bound.placeholder()))
 				args = append(args, bound.Lower)
 			}
 			if len(bound.Upper) != 0 {
-				conditions = append(conditions, fmt.Sprintf("`%s`%s %s ?", bound.Column, collation, bound.UpperSymbol))
+				conditions = append(conditions, fmt.Sprintf("%s %s %s", boundExpr(bound, collation), bound.UpperSymbol, bound.placeholder()))
 				args = append(args, bound.Upper)
 			}
 		}
@@ -126,25 +182,25 @@ func (c *ChunkRange) toString(collation string) (string, []string) {
 	for _, bound := range c.Bounds {
 		if len(bound.Lower) != 0 {
 			if len(preConditionForLower) > 0 {
-				lowerCondition = append(lowerCondition, fmt.Sprintf("(%s AND `%s`%s %s ?)", strings.Join(preConditionForLower, " AND "), bound.Column, collation, bound.LowerSymbol))
+				lowerCondition = append(lowerCondition, fmt.Sprintf("(%s AND %s %s %s)", strings.Join(preConditionForLower, " AND "), boundExpr(bound, collation), bound.LowerSymbol, bound.placeholder()))
 				lowerArgs = append(append(lowerArgs, preConditionArgsForLower...), bound.Lower)
 			} else {
-				lowerCondition = append(lowerCondition, fmt.Sprintf("(`%s`%s %s ?)", bound.Column, collation, bound.LowerSymbol))
+				lowerCondition = append(lowerCondition, fmt.Sprintf("(%s %s %s)", boundExpr(bound, collation), bound.LowerSymbol, bound.placeholder()))
 				lowerArgs = append(lowerArgs, bound.Lower)
 			}
-			preConditionForLower = append(preConditionForLower, fmt.Sprintf("`%s` = ?", bound.Column))
+			preConditionForLower = append(preConditionForLower, fmt.Sprintf("%s = %s", boundExpr(bound, ""), bound.placeholder()))
 			preConditionArgsForLower = append(preConditionArgsForLower, bound.Lower)
 		}
 
 		if len(bound.Upper) != 0 {
 			if len(preConditionForUpper) > 0 {
-				upperCondition = append(upperCondition, fmt.Sprintf("(%s AND `%s`%s %s ?)", strings.Join(preConditionForUpper, " AND "), bound.Column, collation, bound.UpperSymbol))
+				upperCondition = append(upperCondition, fmt.Sprintf("(%s AND %s %s %s)", strings.Join(preConditionForUpper, " AND "), boundExpr(bound, collation), bound.UpperSymbol, bound.placeholder()))
 				upperArgs = append(append(upperArgs, preConditionArgsForUpper...), bound.Upper)
 			} else {
-				upperCondition = append(upperCondition, fmt.Sprintf("(`%s`%s %s ?)", bound.Column, collation, bound.UpperSymbol))
+				upperCondition = append(upperCondition, fmt.Sprintf("(%s %s %s)", boundExpr(bound, collation), bound.UpperSymbol, bound.placeholder()))
 				upperArgs = append(upperArgs, bound.Upper)
 			}
-			preConditionForUpper = append(preConditionForUpper, fmt.Sprintf("`%s` = ?", bound.Column))
+			preConditionForUpper = append(preConditionForUpper, fmt.Sprintf("%s = %s", boundExpr(bound, ""), bound.placeholder()))
 			preConditionArgsForUpper = append(preConditionArgsForUpper, bound.Upper)
 		}
 	}
@@ -176,7 +232,9 @@ func (c *ChunkRange) update(column, lower, lowerSymbol, upper, upperSymbol strin
 
 	for i, b := range c.Bounds {
 		if b.Column == column {
-			// update the bound
+			// update the bound, the column's type is not changed
+			newBound.Cast = b.Cast
+			newBound.EnumIndex = b.EnumIndex
 			c.Bounds[i] = newBound
 			return
 		}
@@ -215,6 +273,20 @@ type randomSpliter struct {
 }
 
 func (s *randomSpliter) split(table *TableInstance, columns []*model.ColumnInfo, chunkSize int, limits string, collation string) ([]*ChunkRange, error) {
+	var chunks []*ChunkRange
+	err := s.splitTo(table, columns, chunkSize, limits, collation, func(chunk *ChunkRange) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return chunks, nil
+}
+
+// splitTo splits a table's data to several chunks like split, and calls emit for every chunk once it's generated.
+func (s *randomSpliter) splitTo(table *TableInstance, columns []*model.ColumnInfo, chunkSize int, limits string, collation string, emit func(*ChunkRange) error) error {
 	s.table = table
 	s.chunkSize = chunkSize
 	s.limits = limits
@@ -223,11 +295,20 @@ func (s *randomSpliter) split(table *TableInstance, columns []*model.ColumnInfo,
 	// get the chunk count by data count and chunk size
 	cnt, err := dbutil.GetRowCount(context.Background(), table.Conn, table.Schema, table.Table, limits)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return errors.Trace(err)
 	}
 
 	chunkCnt := (int(cnt) + chunkSize - 1) / chunkSize
-	chunks, err := s.splitRange(table.Conn, NewChunkRange(normalMode), chunkCnt, table.Schema, table.Table, columns)
+	return errors.Trace(s.splitRangeTo(table.Conn, NewChunkRange(normalMode), chunkCnt, table.Schema, table.Table, columns, emit))
+}
+
+// splitRange splits a chunk to multiple chunks.
+func (s *randomSpliter) splitRange(db *sql.DB, chunk *ChunkRange, count int, schema string, table string, columns []*model.ColumnInfo) ([]*ChunkRange, error) {
+	var chunks []*ChunkRange
+	err := s.splitRangeTo(db, chunk, count, schema, table, columns, func(chunk *ChunkRange) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -235,13 +316,10 @@ func (s *randomSpliter) split(table *TableInstance, columns []*model.ColumnInfo,
 	return chunks, nil
 }
 
-// splitRange splits a chunk to multiple chunks.
-func (s *randomSpliter) splitRange(db *sql.DB, chunk *ChunkRange, count int, schema string, table string, columns []*model.ColumnInfo) ([]*ChunkRange, error) {
-	var chunks []*ChunkRange
-
+// splitRangeTo splits a chunk to multiple chunks like splitRange, and calls emit for every chunk once it's generated.
+func (s *randomSpliter) splitRangeTo(db *sql.DB, chunk *ChunkRange, count int, schema string, table string, columns []*model.ColumnInfo, emit func(*ChunkRange) error) error {
 	if count <= 1 {
-		chunks = append(chunks, chunk)
-		return chunks, nil
+		return errors.Trace(emit(chunk))
 	}
 
 	var (
@@ -264,7 +342,7 @@ func (s *randomSpliter) splitRange(db *sql.DB, chunk *ChunkRange, count int, sch
 	} else {
 		if len(columns) <= colNum {
 			log.Warn("chunk can't be splited", zap.Stringer("chunk", chunk))
-			return append(chunks, chunk), nil
+			return errors.Trace(emit(chunk))
 		}
 
 		// choose the next column to split data
@@ -275,13 +353,25 @@ func (s *randomSpliter) splitRange(db *sql.DB, chunk *ChunkRange, count int, sch
 		if err != nil {
 			if errors.Cause(err) == dbutil.ErrNoData {
 				log.Info("no data found", zap.String("table", dbutil.TableName(schema, table)), zap.String("range", limitRange), zap.Reflect("args", args))
-				return append(chunks, chunk), nil
+				return errors.Trace(emit(chunk))
 			}
-			return nil, errors.Trace(err)
+			return errors.Trace(err)
 		}
 
 		symbolMin = gte
 		symbolMax = lte
+
+		// add the new column's bound without values, so the chunks split from it keep the bound's cast
+		chunk = chunk.copyAndUpdate(splitCol, "", "", "", "")
+		chunk.Bounds[len(chunk.Bounds)-1].Cast = boundCast(columns[colNum])
+
+		// MIN and MAX of ENUM are the labels compared as strings, the indexes of all the elements are the range instead,
+		// the index of the empty string inserted for an invalid value is 0. the ENUM columns whose elements are
+		// different between the instances are not split by, so the indexes are the same in all the instances.
+		if columns[colNum].Tp == mysql.TypeEnum {
+			chunk.Bounds[len(chunk.Bounds)-1].EnumIndex = true
+			min, max = "0", strconv.Itoa(len(columns[colNum].Elems))
+		}
 	}
 
 	splitValues := make([]string, 0, count)
@@ -290,7 +380,10 @@ func (s *randomSpliter) splitRange(db *sql.DB, chunk *ChunkRange, count int, sch
 	// get random value as split value
 	randomValues, randomValueCount, err := dbutil.GetRandomValues(context.Background(), db, schema, table, splitCol, count-1, limitRange, utils.StringsToInterfaces(args), s.collation)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return errors.Trace(err)
+	}
+	if chunk.Bounds[len(chunk.Bounds)-1].EnumIndex {
+		randomValues, randomValueCount = enumIndexValues(dbutil.FindColumnByName(columns, splitCol), randomValues, randomValueCount)
 	}
 	log.Debug("get split values by random values", zap.Stringer("chunk", chunk), zap.Reflect("random values", randomValues))
 
@@ -345,22 +438,28 @@ func (s *randomSpliter) splitRange(db *sql.DB, chunk *ChunkRange, count int, sch
 
 	lowerSymbol := symbolMin
 	upperSymbol := lt
+	chunkNum := 0
+	emitChunk := func(newChunk *ChunkRange) error {
+		chunkNum++
+		return errors.Trace(emit(newChunk))
+	}
 
 	for i := 0; i < len(splitValues); i++ {
 		if i == 0 && useNewColumn {
 			// create chunk less than min
 			newChunk := chunk.copyAndUpdate(splitCol, "", "", splitValues[i], lt)
-			chunks = append(chunks, newChunk)
+			if err = emitChunk(newChunk); err != nil {
+				return errors.Trace(err)
+			}
 		}
 
 		if valueCounts[i] > 1 {
 			// means should split it
 			newChunk := chunk.copyAndUpdate(splitCol, splitValues[i], equal, "", "")
-			splitChunks, err := s.splitRange(db, newChunk, valueCounts[i], schema, table, columns)
+			err = s.splitRangeTo(db, newChunk, valueCounts[i], schema, table, columns, emitChunk)
 			if err != nil {
-				return nil, errors.Trace(err)
+				return errors.Trace(err)
 			}
-			chunks = append(chunks, splitChunks...)
 
 			// already have the chunk [column = value], so next chunk should start with column > value
 			lowerSymbol = gt
@@ -372,20 +471,24 @@ func (s *randomSpliter) splitRange(db *sql.DB, chunk *ChunkRange, count int, sch
 
 		if i < len(splitValues)-1 {
 			newChunk := chunk.copyAndUpdate(splitCol, splitValues[i], lowerSymbol, splitValues[i+1], upperSymbol)
-			chunks = append(chunks, newChunk)
+			if err = emitChunk(newChunk); err != nil {
+				return errors.Trace(err)
+			}
 		}
 
 		if i == len(splitValues)-1 && useNewColumn {
 			// create chunk greater than max
 			newChunk := chunk.copyAndUpdate(splitCol, splitValues[i], gt, "", "")
-			chunks = append(chunks, newChunk)
+			if err = emitChunk(newChunk); err != nil {
+				return errors.Trace(err)
+			}
 		}
 
 		lowerSymbol = gte
 	}
 
-	log.Debug("getChunksForTable cut table", zap.Int("count", count), zap.String("min", min), zap.String("max", max), zap.Int("chunk num", len(chunks)))
-	return chunks, nil
+	log.Debug("getChunksForTable cut table", zap.Int("count", count), zap.String("min", min), zap.String("max", max), zap.Int("chunk num", chunkNum))
+	return nil
 }
 
 type bucketSpliter struct {
@@ -397,6 +500,20 @@ type bucketSpliter struct {
 }
 
 func (s *bucketSpliter) split(table *TableInstance, columns []*model.ColumnInfo, chunkSize int, limits string, collation string) ([]*ChunkRange, error) {
+	chunks := make([]*ChunkRange, 0, 1000)
+	err := s.splitTo(table, columns, chunkSize, limits, collation, func(chunk *ChunkRange) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return chunks, nil
+}
+
+// splitTo splits a table's data to several chunks like split, and calls emit for every chunk once it's generated.
+func (s *bucketSpliter) splitTo(table *TableInstance, columns []*model.ColumnInfo, chunkSize int, limits string, collation string, emit func(*ChunkRange) error) error {
 	s.table = table
 	s.chunkSize = chunkSize
 	s.limits = limits
@@ -404,15 +521,15 @@ func (s *bucketSpliter) split(table *TableInstance, columns []*model.ColumnInfo,
 
 	buckets, err := dbutil.GetBucketsInfo(context.Background(), s.table.Conn, s.table.Schema, s.table.Table, s.table.info)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return errors.Trace(err)
 	}
 	s.buckets = buckets
 
-	return s.getChunksByBuckets()
+	return errors.Trace(s.getChunksByBuckets(emit))
 }
 
-func (s *bucketSpliter) getChunksByBuckets() ([]*ChunkRange, error) {
-	chunks := make([]*ChunkRange, 0, 1000)
+func (s *bucketSpliter) getChunksByBuckets(emit func(*ChunkRange) error) error {
+	chunkNum := 0
 
 	indices := dbutil.FindAllIndex(s.table.info)
 	for _, index := range indices {
@@ -421,7 +538,7 @@ func (s *bucketSpliter) getChunksByBuckets() ([]*ChunkRange, error) {
 		}
 		buckets, ok := s.buckets[index.Name.O]
 		if !ok {
-			return nil, errors.NotFoundf("index %s in buckets info", index.Name.O)
+			return errors.NotFoundf("index %s in buckets info", index.Name.O)
 		}
 
 		var (
@@ -432,11 +549,15 @@ func (s *bucketSpliter) getChunksByBuckets() ([]*ChunkRange, error) {
 		)
 
 		indexColumns := getColumnsFromIndex(index, s.table.info)
+		if hasApproximateColumn(indexColumns) {
+			log.Warn("skip the index has FLOAT or DOUBLE column, its buckets' bounds are not exact", zap.String("index", index.Name.O))
+			continue
+		}
 
 		for i, bucket := range buckets {
 			upperValues, err = dbutil.AnalyzeValuesFromBuckets(bucket.UpperBound, indexColumns)
 			if err != nil {
-				return nil, errors.Trace(err)
+				return errors.Trace(err)
 			}
 
 			if bucket.Count-latestCount > int64(s.chunkSize) || i == len(buckets)-1 {
@@ -454,37 +575,58 @@ func (s *bucketSpliter) getChunksByBuckets() ([]*ChunkRange, error) {
 					}
 
 					chunk.update(col.Name.O, lower, lowerSymbol, upper, upperSymbol)
+					chunk.Bounds[j].Cast = boundCast(indexColumns[j])
 				}
 
-				chunks = append(chunks, chunk)
+				if err = emit(chunk); err != nil {
+					return errors.Trace(err)
+				}
+				chunkNum++
 				lowerValues = upperValues
 				latestCount = bucket.Count
 			}
 		}
 
-		if len(chunks) != 0 {
+		if chunkNum != 0 {
 			break
 		}
 	}
 
-	return chunks, nil
+	return nil
 }
 
 func getChunksForTable(table *TableInstance, columns []*model.ColumnInfo, chunkSize int, limits string, collation string, useTiDBStatsInfo bool) ([]*ChunkRange, error) {
+	var chunks []*ChunkRange
+	err := getChunksForTableTo(table, columns, chunkSize, limits, collation, useTiDBStatsInfo, func(chunk *ChunkRange) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	return chunks, err
+}
+
+// getChunksForTableTo splits the table's data like getChunksForTable, and calls emit for every chunk once it's generated.
+func getChunksForTableTo(table *TableInstance, columns []*model.ColumnInfo, chunkSize int, limits string, collation string, useTiDBStatsInfo bool, emit func(*ChunkRange) error) error {
 	if useTiDBStatsInfo {
 		s := bucketSpliter{}
-		chunks, err := s.split(table, columns, chunkSize, limits, collation)
-		if err == nil && len(chunks) > 0 {
-			return chunks, nil
+		chunkNum := 0
+		err := s.splitTo(table, columns, chunkSize, limits, collation, func(chunk *ChunkRange) error {
+			chunkNum++
+			return emit(chunk)
+		})
+		if err == nil && chunkNum > 0 {
+			return nil
+		}
+		if chunkNum > 0 {
+			// the chunks are already emitted, can't split again
+			return errors.Trace(err)
 		}
 
-		log.Warn("use tidb bucket information to get chunks failed, will split chunk by random again", zap.Int("get chunk", len(chunks)), zap.Error(err))
+		log.Warn("use tidb bucket information to get chunks failed, will split chunk by random again", zap.Error(err))
 	}
 
 	// get chunks from tidb bucket information failed, use random.
 	s := randomSpliter{}
-	chunks, err := s.split(table, columns, chunkSize, limits, collation)
-	return chunks, err
+	return s.splitTo(table, columns, chunkSize, limits, collation, emit)
 }
 
 // getSplitFields returns fields to split chunks, order by pk, uk, index, columns.
@@ -504,21 +646,33 @@ func getSplitFields(table *model.TableInfo, splitFields []string) ([]*model.Colu
 
 	indexColumns := dbutil.FindAllColumnWithIndex(table)
 
-	// user's config had higher priorities
+	// user's config had higher priorities, but the FLOAT and DOUBLE columns are used at last,
+	// because their values can't be used as the chunk's bounds exactly.
+	approximateCols := make([]*model.ColumnInfo, 0, 1)
 	for _, col := range append(append(splitCols, indexColumns...), table.Columns...) {
 		if _, ok := colsMap[col.Name.O]; ok {
 			continue
 		}
 
 		colsMap[col.Name.O] = struct{}{}
+		if isApproximateColumn(col) {
+			approximateCols = append(approximateCols, col)
+			continue
+		}
 		cols = append(cols, col)
 	}
 
-	return cols, nil
+	for _, col := range splitCols {
+		if isApproximateColumn(col) {
+			log.Warn("the split field is FLOAT or DOUBLE, will split by the other columns first", zap.String("table", table.Name.O), zap.String("field", col.Name.O))
+		}
+	}
+
+	return append(cols, approximateCols...), nil
 }
 
-// SplitChunks splits the table to some chunks.
-func SplitChunks(ctx context.Context, table *TableInstance, splitFields, limits string, chunkSize int, collation string, useTiDBStatsInfo bool) (chunks []*ChunkRange, err error) {
+// getSplitFieldsByString returns fields to split chunks like getSplitFields, the split fields are separated by comma.
+func getSplitFieldsByString(table *model.TableInfo, splitFields string) ([]*model.ColumnInfo, error) {
 	var splitFieldArr []string
 	if len(splitFields) != 0 {
 		splitFieldArr = strings.Split(splitFields, ",")
@@ -528,35 +682,157 @@ func SplitChunks(ctx context.Context, table *TableInstance, splitFields, limits
 		splitFieldArr[i] = strings.TrimSpace(splitFieldArr[i])
 	}
 
-	fields, err := getSplitFields(table.info, splitFieldArr)
+	return getSplitFields(table, splitFieldArr)
+}
+
+// splitChunk splits the chunk to about count smaller chunks by the random values in the chunk's range,
+// the chunks split by TiDB's buckets can't be split again.
+func splitChunk(table *TableInstance, chunk *ChunkRange, splitFields, limits string, count int, collation string) ([]*ChunkRange, error) {
+	if chunk.Mode == bucketMode {
+		return nil, errors.NotSupportedf("split chunk in bucket mode")
+	}
+	if table.Conn == nil {
+		return nil, errors.NotSupportedf("split chunk without database connection")
+	}
+
+	fields, err := table.splitFields(splitFields)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	chunks, err = getChunksForTable(table, fields, chunkSize, limits, collation, useTiDBStatsInfo)
+	s := randomSpliter{
+		table:     table,
+		limits:    limits,
+		collation: collation,
+	}
+	chunks, err := s.splitRange(table.Conn, chunk.copy(), count, table.Schema, table.Table, fields)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	if chunks == nil {
-		return nil, nil
+	for _, newChunk := range chunks {
+		conditions, args := newChunk.toString(collation)
+		newChunk.ID = chunk.ID
+		newChunk.Where = fmt.Sprintf("(%s AND %s)", conditions, limits)
+		newChunk.Args = args
+		newChunk.State = notCheckedState
 	}
 
-	ctx1, cancel1 := context.WithTimeout(ctx, time.Duration(len(chunks))*dbutil.DefaultTimeout)
-	defer cancel1()
-	for i, chunk := range chunks {
-		conditions, args := chunk.toString(collation)
+	return chunks, nil
+}
 
-		chunk.ID = i
-		chunk.Where = fmt.Sprintf("(%s AND %s)", conditions, limits)
-		chunk.Args = args
-		chunk.State = notCheckedState
+// SplitChunks splits the table to some chunks, and saves them in checkpoint with the timeout of the checkpoint class.
+// all the chunks are kept in memory, use NewChunkIterator to get the chunks on demand for the huge tables.
+func SplitChunks(ctx context.Context, table *TableInstance, splitFields, limits string, chunkSize int, collation string, useTiDBStatsInfo bool, timeouts *dbutil.TimeoutPolicy) (chunks []*ChunkRange, err error) {
+	iter, err := NewChunkIterator(ctx, table, splitFields, limits, chunkSize, collation, useTiDBStatsInfo)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer iter.Close()
 
-		err = saveChunk(ctx1, table.Conn, i, table.InstanceID, table.Schema, table.Table, "", chunk)
+	for {
+		chunk, err := iter.Next(ctx)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if chunk == nil {
+			return chunks, nil
+		}
+
+		ctx1, cancel1 := timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+		err = saveChunk(ctx1, table.Conn, chunk.ID, table.InstanceID, table.Schema, table.Table, "", chunk)
+		cancel1()
 		if err != nil {
 			return nil, err
 		}
+		chunks = append(chunks, chunk)
 	}
+}
 
-	return chunks, nil
+// chunkIteratorBufferSize is the number of chunks generated in advance by ChunkIterator.
+const chunkIteratorBufferSize = 64
+
+// ChunkIterator generates the chunks of a table lazily in background, so the chunks can be checked before the whole
+// table is split. the generating is blocked if the chunks are not consumed. the chunks are not saved in checkpoint,
+// the caller should save them when they are dispatched.
+type ChunkIterator struct {
+	chunks chan *ChunkRange
+	// set before chunks is closed
+	err    error
+	cancel context.CancelFunc
+}
+
+// NewChunkIterator returns a ChunkIterator which splits the table like SplitChunks.
+func NewChunkIterator(ctx context.Context, table *TableInstance, splitFields, limits string, chunkSize int, collation string, useTiDBStatsInfo bool) (*ChunkIterator, error) {
+	fields, err := table.splitFields(splitFields)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return newChunkIterator(ctx, limits, collation, func(emit func(*ChunkRange) error) error {
+		return getChunksForTableTo(table, fields, chunkSize, limits, collation, useTiDBStatsInfo, emit)
+	}), nil
+}
+
+// NewRegionChunkIterator returns a ChunkIterator which splits the table by the regions of the table's records in TiKV,
+// the table should be in TiDB. the table is split by TiDB's statistics if its handle is not an integer column.
+func NewRegionChunkIterator(ctx context.Context, table *TableInstance, splitFields, limits string, chunkSize int, collation string) (*ChunkIterator, error) {
+	fields, err := table.splitFields(splitFields)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return newChunkIterator(ctx, limits, collation, func(emit func(*ChunkRange) error) error {
+		return getChunksByRegionsTo(table, fields, chunkSize, limits, collation, emit)
+	}), nil
+}
+
+// newChunkIterator returns a ChunkIterator which generates the chunks by split.
+func newChunkIterator(ctx context.Context, limits string, collation string, split func(emit func(*ChunkRange) error) error) *ChunkIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	iter := &ChunkIterator{
+		chunks: make(chan *ChunkRange, chunkIteratorBufferSize),
+		cancel: cancel,
+	}
+
+	go func() {
+		var id int64
+		err := split(func(chunk *ChunkRange) error {
+			conditions, args := chunk.toString(collation)
+			chunk.ID = id
+			chunk.Where = fmt.Sprintf("(%s AND %s)", conditions, limits)
+			chunk.Args = args
+			chunk.State = notCheckedState
+			id++
+
+			select {
+			case iter.chunks <- chunk:
+				return nil
+			case <-ctx.Done():
+				return errors.Trace(ctx.Err())
+			}
+		})
+		iter.err = errors.Trace(err)
+		close(iter.chunks)
+	}()
+
+	return iter
+}
+
+// Next returns the next chunk, returns nil if all the chunks are generated.
+func (iter *ChunkIterator) Next(ctx context.Context) (*ChunkRange, error) {
+	select {
+	case chunk, ok := <-iter.chunks:
+		if !ok {
+			return nil, iter.err
+		}
+		return chunk, nil
+	case <-ctx.Done():
+		return nil, errors.Trace(ctx.Err())
+	}
+}
+
+// Close stops generating the chunks.
+func (iter *ChunkIterator) Close() {
+	iter.cancel()
 }
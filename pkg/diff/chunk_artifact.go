@@ -0,0 +1,167 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// ArtifactSource means the queries are executed in a source table.
+	ArtifactSource = "source"
+	// ArtifactTarget means the queries are executed in the target table.
+	ArtifactTarget = "target"
+)
+
+// InstanceArtifact is the queries of a failed chunk in a table instance, they can be executed with the arguments to
+// reproduce the checksum and the rows manually.
+type InstanceArtifact struct {
+	// ArtifactSource or ArtifactTarget
+	Side       string `json:"side"`
+	InstanceID string `json:"instance-id"`
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+
+	// empty if the rows are not read from the database, for example from a dump directory
+	ChecksumSQL string `json:"checksum-sql,omitempty"`
+	SelectSQL   string `json:"select-sql,omitempty"`
+	// the arguments bound to the placeholders of both the queries, they're masked if any bound's column is redacted
+	Args []string `json:"args"`
+}
+
+// ChunkArtifact is the diagnostics of a failed chunk, contains the exact queries of every table instance and the
+// results of both sides.
+type ChunkArtifact struct {
+	// the target table's schema and name
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	ChunkID int64  `json:"chunk-id"`
+	Where   string `json:"where"`
+
+	// the checksums of the source tables are combined by XOR, and the counts are summed
+	ChecksumCompared bool  `json:"checksum-compared"`
+	SourceChecksum   int64 `json:"source-checksum"`
+	TargetChecksum   int64 `json:"target-checksum"`
+	RowCountCompared bool  `json:"row-count-compared"`
+	SourceRowCount   int64 `json:"source-row-count"`
+	TargetRowCount   int64 `json:"target-row-count"`
+	// the columns of the mismatched column groups, the checksums are of these groups if the columns are split
+	MismatchedColumns []string `json:"mismatched-columns,omitempty"`
+	DifferentRows     int      `json:"different-rows"`
+
+	Instances []*InstanceArtifact `json:"instances"`
+	Time      time.Time           `json:"time"`
+}
+
+// ChunkArtifactExporter exports the artifacts of the failed chunks, should be safe for concurrent use.
+type ChunkArtifactExporter interface {
+	Export(artifact *ChunkArtifact) error
+}
+
+// NewChunkArtifactExporter returns a ChunkArtifactExporter which writes one json object for every failed chunk to w.
+func NewChunkArtifactExporter(w io.Writer) ChunkArtifactExporter {
+	return &jsonChunkArtifactExporter{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+type jsonChunkArtifactExporter struct {
+	sync.Mutex
+	encoder *json.Encoder
+}
+
+// Export implements ChunkArtifactExporter's Export.
+func (e *jsonChunkArtifactExporter) Export(artifact *ChunkArtifact) error {
+	e.Lock()
+	defer e.Unlock()
+
+	return errors.Trace(e.encoder.Encode(artifact))
+}
+
+// exportChunkArtifact exports the artifact of the failed chunk by ChunkArtifactExporter, the error is only logged so
+// the check is not interrupted.
+func (t *TableDiff) exportChunkArtifact(chunk *ChunkRange, result *ChunkResult) {
+	if t.ChunkArtifactExporter == nil {
+		return
+	}
+
+	if err := t.ChunkArtifactExporter.Export(t.chunkArtifact(chunk, result)); err != nil {
+		log.Warn("export chunk artifact", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Int64("chunk", chunk.ID), zap.Error(err))
+	}
+}
+
+// chunkArtifact returns the artifact of the chunk, the queries are built in the same way as checking the chunk.
+func (t *TableDiff) chunkArtifact(chunk *ChunkRange, result *ChunkResult) *ChunkArtifact {
+	artifact := &ChunkArtifact{
+		Schema:            t.TargetTable.Schema,
+		Table:             t.TargetTable.Table,
+		ChunkID:           chunk.ID,
+		Where:             chunk.Where,
+		ChecksumCompared:  result.ChecksumCompared,
+		SourceChecksum:    result.SourceChecksum,
+		TargetChecksum:    result.TargetChecksum,
+		RowCountCompared:  result.RowCountCompared,
+		SourceRowCount:    result.SourceRowCount,
+		TargetRowCount:    result.TargetRowCount,
+		MismatchedColumns: result.MismatchedColumns,
+		DifferentRows:     result.DifferentRows,
+		Instances:         make([]*InstanceArtifact, 0, len(t.SourceTables)+1),
+		Time:              time.Now(),
+	}
+
+	checksumIgnoreColumns := utils.SliceToMap(t.IgnoreColumns)
+	selectIgnoreColumns := checksumIgnoreColumns
+	if len(result.MismatchedColumns) != 0 {
+		selectIgnoreColumns = t.columnGroupsIgnoreColumns(result.MismatchedColumns)
+	}
+	if _, ok := selectIgnoreColumns[t.SoftDeleteColumn]; ok {
+		columns := make(map[string]interface{}, len(selectIgnoreColumns))
+		for column := range selectIgnoreColumns {
+			columns[column] = struct{}{}
+		}
+		delete(columns, t.SoftDeleteColumn)
+		selectIgnoreColumns = columns
+	}
+
+	add := func(side string, table *TableInstance) {
+		where, args := table.chunkWhere(chunk)
+		instance := &InstanceArtifact{
+			Side:       side,
+			InstanceID: table.InstanceID,
+			Schema:     table.Schema,
+			Table:      table.Table,
+			Args:       t.redact.args(chunk, args),
+		}
+		if table.Source == nil {
+			instance.ChecksumSQL = dbutil.CRC32ChecksumQuery(table.Schema, table.Table, t.TargetTable.info, table.indexHint, where, checksumIgnoreColumns, t.checksumColumnExprs(table))
+			instance.SelectSQL, _ = chunkRowsQuery(table.Schema, table.Table, table.info, table.indexHint, where, selectIgnoreColumns, table.rowExprs(), table.collation)
+		}
+		artifact.Instances = append(artifact.Instances, instance)
+	}
+	for _, table := range t.SourceTables {
+		add(ArtifactSource, table)
+	}
+	add(ArtifactTarget, t.TargetTable)
+
+	return artifact
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testChunkArtifactSuite{})
+
+type testChunkArtifactSuite struct{}
+
+func (s *testChunkArtifactSuite) TestChunkArtifact(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{
+		TargetTable: &TableInstance{Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables: []*TableInstance{
+			{Schema: "test", Table: "atest_1", InstanceID: "source-1", info: tableInfo},
+		},
+	}
+	td.adjustConfig()
+
+	chunk := &ChunkRange{
+		ID:     3,
+		Bounds: []*Bound{{Column: "id", Lower: "1", LowerSymbol: ">"}},
+		Where:  "((`id` > ?) AND TRUE)",
+		Args:   []string{"1"},
+	}
+	result := &ChunkResult{ChecksumCompared: true, SourceChecksum: 1, TargetChecksum: 2, RowCountCompared: true, SourceRowCount: 10, TargetRowCount: 10}
+
+	buf := new(bytes.Buffer)
+	td.ChunkArtifactExporter = NewChunkArtifactExporter(buf)
+	td.exportChunkArtifact(chunk, result)
+
+	artifact := &ChunkArtifact{}
+	c.Assert(json.Unmarshal(buf.Bytes(), artifact), IsNil)
+	c.Assert(artifact.ChunkID, Equals, int64(3))
+	c.Assert(artifact.SourceChecksum, Equals, int64(1))
+	c.Assert(artifact.TargetChecksum, Equals, int64(2))
+	c.Assert(artifact.Instances, HasLen, 2)
+	c.Assert(artifact.Instances[0].Side, Equals, ArtifactSource)
+	c.Assert(artifact.Instances[0].InstanceID, Equals, "source-1")
+	c.Assert(artifact.Instances[0].ChecksumSQL, Equals, "SELECT BIT_XOR(CAST(CRC32(CONCAT_WS(',', `id`, `name`, CONCAT(ISNULL(`id`), ISNULL(`name`))))AS UNSIGNED)) AS checksum, COUNT(*) AS count FROM `test`.`atest_1` WHERE ((`id` > ?) AND TRUE);")
+	c.Assert(artifact.Instances[0].SelectSQL, Equals, "SELECT /*!40001 SQL_NO_CACHE */ * FROM `test`.`atest_1` WHERE ((`id` > ?) AND TRUE) ORDER BY `id`")
+	c.Assert(artifact.Instances[0].Args, DeepEquals, []string{"1"})
+	c.Assert(artifact.Instances[1].Side, Equals, ArtifactTarget)
+	c.Assert(artifact.Instances[1].SelectSQL, Equals, "SELECT /*!40001 SQL_NO_CACHE */ * FROM `test`.`atest` WHERE ((`id` > ?) AND TRUE) ORDER BY `id`")
+
+	// the arguments are masked if the bound's column is redacted, and the rows read from files have no queries
+	td.redact = newRedactor(true, []string{"id"})
+	td.SourceTables[0].Source = &fileRowSource{}
+	artifact = td.chunkArtifact(chunk, result)
+	c.Assert(artifact.Instances[0].ChecksumSQL, Equals, "")
+	c.Assert(artifact.Instances[0].SelectSQL, Equals, "")
+	c.Assert(artifact.Instances[0].Args, DeepEquals, []string{redactedValue})
+	c.Assert(artifact.Instances[1].Args, DeepEquals, []string{redactedValue})
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+)
+
+// ChunkResult is the final state and statistics of a checked chunk.
+type ChunkResult struct {
+	// the target table's schema and name
+	Schema string
+	Table  string
+
+	Chunk *ChunkRange
+	// the final state of the chunk, for example "success", "failed", "error" or "ignore" if the chunk is sampled out.
+	State string
+	Equal bool
+	// not nil if check the chunk failed
+	Err error
+
+	// set true if the chunk's row count is compared
+	RowCountCompared bool
+	SourceRowCount   int64
+	TargetRowCount   int64
+
+	// set true if the chunk is compared by checksum
+	ChecksumCompared bool
+	SourceChecksum   int64
+	TargetChecksum   int64
+	// the columns of the mismatched column groups if the columns are split by TableDiff's ColumnGroupSize,
+	// only these columns are compared by rows.
+	MismatchedColumns []string
+
+	// set true if the chunk's aggregates of TableDiff's AggregateColumns are compared, the row counts are also compared
+	AggregatesCompared bool
+
+	// the checksums are re-read after DoubleReadDelay, and confirmed if the second read has the same checksums
+	DoubleReadCompared  bool
+	DoubleReadConfirmed bool
+
+	// set true if the chunk's rows are selected and compared
+	RowsCompared  bool
+	SourceRows    int
+	TargetRows    int
+	DifferentRows int
+	// set true if the comparing is stopped because DifferentRows reaches TableDiff's MaxChunkDiffRows
+	DiffTruncated bool
+	// the number of the unique keys which exist in more than one row on either side, all the rows of these keys are
+	// counted in DifferentRows
+	DuplicatedKeys int
+	// the size of the selected rows' data
+	SourceBytes int64
+	TargetBytes int64
+
+	Duration time.Duration
+}
+
+// ChunkResultHandler is invoked with every chunk's result after the chunk is checked, can be used to push the results
+// into other systems, for example a data quality catalog. it's called by the check goroutines concurrently.
+type ChunkResultHandler func(ctx context.Context, result *ChunkResult)
+
+// merge adds the result of a smaller chunk split from the chunk. the checksums and the aggregates are compared by
+// the smaller chunks, so they are not merged.
+func (r *ChunkResult) merge(sub *ChunkResult) {
+	r.RowCountCompared = r.RowCountCompared || sub.RowCountCompared
+	r.SourceRowCount += sub.SourceRowCount
+	r.TargetRowCount += sub.TargetRowCount
+
+	r.RowsCompared = r.RowsCompared || sub.RowsCompared
+	r.SourceRows += sub.SourceRows
+	r.TargetRows += sub.TargetRows
+	r.DifferentRows += sub.DifferentRows
+	r.DiffTruncated = r.DiffTruncated || sub.DiffTruncated
+	r.DuplicatedKeys += sub.DuplicatedKeys
+	r.SourceBytes += sub.SourceBytes
+	r.TargetBytes += sub.TargetBytes
+}
@@ -0,0 +1,389 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testChunkResultSuite{})
+
+type testChunkResultSuite struct{}
+
+func (s *testChunkResultSuite) TestChunkResultHandler(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	var results []*ChunkResult
+	td := &TableDiff{
+		TargetTable:     &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables:    []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		UseChecksum:     true,
+		OnlyUseChecksum: true,
+		ChunkResultHandler: func(ctx context.Context, result *ChunkResult) {
+			results = append(results, result)
+		},
+	}
+	td.adjustConfig()
+
+	chunk := &ChunkRange{ID: 1, Where: "(TRUE)"}
+
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(456, 10))
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	equal, err := td.checkChunkDataEqual(context.Background(), false, chunk)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+
+	c.Assert(results, HasLen, 1)
+	result := results[0]
+	c.Assert(result.Table, Equals, "atest")
+	c.Assert(result.Chunk, Equals, chunk)
+	c.Assert(result.State, Equals, failedState)
+	c.Assert(result.Equal, IsFalse)
+	c.Assert(result.Err, IsNil)
+	c.Assert(result.ChecksumCompared, IsTrue)
+	c.Assert(result.SourceChecksum, Equals, int64(123))
+	c.Assert(result.TargetChecksum, Equals, int64(456))
+	c.Assert(result.RowsCompared, IsFalse)
+
+	// the checksum is same but the count is different, may be caused by the duplicated rows
+	chunk = &ChunkRange{ID: 2, Where: "(TRUE)"}
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 2))
+	targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 4))
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	equal, err = td.checkChunkDataEqual(context.Background(), false, chunk)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+	c.Assert(results[1].SourceRowCount, Equals, int64(2))
+	c.Assert(results[1].TargetRowCount, Equals, int64(4))
+}
+
+func (s *testChunkResultSuite) TestRowCountCheck(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	var results []*ChunkResult
+	td := &TableDiff{
+		TargetTable:     &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables:    []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		UseChecksum:     true,
+		OnlyUseChecksum: true,
+		RowCountCheck:   true,
+		ChunkResultHandler: func(ctx context.Context, result *ChunkResult) {
+			results = append(results, result)
+		},
+	}
+	td.adjustConfig()
+
+	// the row counts are different, the checksum is skipped
+	chunk := &ChunkRange{ID: 1, Where: "(TRUE)"}
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(10))
+	targetMock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(9))
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	equal, err := td.checkChunkDataEqual(context.Background(), false, chunk)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+	c.Assert(results[0].RowCountCompared, IsTrue)
+	c.Assert(results[0].SourceRowCount, Equals, int64(10))
+	c.Assert(results[0].TargetRowCount, Equals, int64(9))
+	c.Assert(results[0].ChecksumCompared, IsFalse)
+
+	// the row counts are equal, then compare the checksum
+	chunk = &ChunkRange{ID: 2, Where: "(TRUE)"}
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(5))
+	targetMock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(5))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	equal, err = td.checkChunkDataEqual(context.Background(), false, chunk)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+	c.Assert(results[1].RowCountCompared, IsTrue)
+	c.Assert(results[1].ChecksumCompared, IsTrue)
+
+	sourceCount, targetCount, ok := td.RowCounts()
+	c.Assert(ok, IsTrue)
+	c.Assert(sourceCount, Equals, int64(15))
+	c.Assert(targetCount, Equals, int64(14))
+}
+
+func (s *testChunkResultSuite) TestRetryFailedChunks(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	var results []*ChunkResult
+	td := &TableDiff{
+		TargetTable:       &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables:      []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		UseChecksum:       true,
+		OnlyUseChecksum:   true,
+		CheckThreadCount:  1,
+		RetryFailedChunks: true,
+		ChunkResultHandler: func(ctx context.Context, result *ChunkResult) {
+			results = append(results, result)
+		},
+	}
+	td.adjustConfig()
+
+	chunks := []*ChunkRange{{ID: 1, Where: "(TRUE)"}, {ID: 2, Where: "(TRUE)"}}
+	expectChecksum := func(sourceChecksum, targetChecksum int64) {
+		targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+		sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(sourceChecksum, 10))
+		targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(targetChecksum, 10))
+		targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	// the first chunk is different because of the replication lag
+	expectChecksum(123, 456)
+	expectChecksum(789, 789)
+	c.Assert(td.checkChunks(context.Background(), chunks, false, true), IsFalse)
+	c.Assert(chunks[0].State, Equals, failedState)
+	c.Assert(chunks[1].State, Equals, successState)
+
+	// only the failed chunk is re-checked
+	expectChecksum(456, 456)
+	c.Assert(td.retryFailedChunks(context.Background(), chunks), IsTrue)
+	c.Assert(chunks[0].State, Equals, successState)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+
+	c.Assert(results, HasLen, 3)
+	c.Assert(results[2].Chunk, Equals, chunks[0])
+	c.Assert(results[2].Equal, IsTrue)
+}
+
+func (s *testChunkResultSuite) TestTimeoutSplit(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	var results []*ChunkResult
+	td := &TableDiff{
+		TargetTable:       &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables:      []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		UseChecksum:       true,
+		OnlyUseChecksum:   true,
+		TimeoutSplitTimes: 1,
+		ChunkResultHandler: func(ctx context.Context, result *ChunkResult) {
+			results = append(results, result)
+		},
+	}
+	td.adjustConfig()
+
+	chunk := NewChunkRange(normalMode)
+	chunk.ID = 1
+	chunk.update("id", "1", gte, "100", lte)
+	chunk.Where = "((`id` >= ? AND `id` <= ?) AND TRUE)"
+	chunk.Args = []string{"1", "100"}
+
+	timeoutErr := &mysql.MySQLError{Number: 3024, Message: "Query execution was interrupted, maximum statement execution time exceeded"}
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnError(timeoutErr)
+	// split to [1, 30), [30, 60), [60, 100], the smaller chunks share the chunk's id, so they are not saved in checkpoint
+	targetMock.ExpectQuery("SELECT id, COUNT\\(\\*\\) count").WillReturnRows(sqlmock.NewRows([]string{"id", "count"}).AddRow("30", 1).AddRow("60", 1))
+	for i := 0; i < 3; i++ {
+		sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+		targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	}
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	equal, err := td.checkChunkWithSplit(context.Background(), false, chunk, 0)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+	c.Assert(chunk.State, Equals, successState)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+
+	// only the chunk's final result is reported, with the smaller chunks' row counts
+	c.Assert(results, HasLen, 1)
+	c.Assert(results[0].Chunk, Equals, chunk)
+	c.Assert(results[0].State, Equals, successState)
+	c.Assert(results[0].RowCountCompared, IsTrue)
+	c.Assert(results[0].SourceRowCount, Equals, int64(30))
+	c.Assert(results[0].TargetRowCount, Equals, int64(30))
+
+	// the chunk's failed state is saved in checkpoint if a smaller chunk failed
+	chunk.State = notCheckedState
+	results = nil
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnError(timeoutErr)
+	targetMock.ExpectQuery("SELECT id, COUNT\\(\\*\\) count").WillReturnRows(sqlmock.NewRows([]string{"id", "count"}).AddRow("30", 1).AddRow("60", 1))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnError(errors.New("connection refused"))
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = td.checkChunkWithSplit(context.Background(), false, chunk, 0)
+	c.Assert(err, ErrorMatches, ".*connection refused")
+	c.Assert(chunk.State, Equals, errorState)
+	c.Assert(results, HasLen, 1)
+	c.Assert(results[0].State, Equals, errorState)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+
+	// don't split if exceeds the split times
+	chunk.State = notCheckedState
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnError(timeoutErr)
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = td.checkChunkWithSplit(context.Background(), false, chunk, 1)
+	c.Assert(dbutil.IsMaxExecutionTimeExceeded(err), IsTrue)
+	c.Assert(chunk.State, Equals, errorState)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testChunkResultSuite) TestCheckChunksFromSource(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{
+		TargetTable:      &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables:     []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		UseChecksum:      true,
+		OnlyUseChecksum:  true,
+		CheckThreadCount: 2,
+	}
+	td.adjustConfig()
+
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// the chunks are checked until the source fails
+	generated := 0
+	source := func(ctx context.Context) (*ChunkRange, error) {
+		generated++
+		if generated > 1 {
+			return nil, errors.New("split failed")
+		}
+		return &ChunkRange{ID: int64(generated), Where: "(TRUE)"}, nil
+	}
+	equal, chunks, err := td.checkChunksFrom(context.Background(), source, false, true, true)
+	c.Assert(err, ErrorMatches, "split failed")
+	c.Assert(equal, IsFalse)
+	c.Assert(chunks, HasLen, 1)
+	c.Assert(chunks[0].State, Equals, successState)
+
+	// the empty source
+	c.Assert(sliceChunkSource(nil), IsNil)
+	equal, chunks, err = td.checkChunksFrom(context.Background(), func(ctx context.Context) (*ChunkRange, error) { return nil, nil }, false, true, true)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+	c.Assert(chunks, HasLen, 0)
+}
+
+func (s *testChunkResultSuite) TestChunkDiffTruncated(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{
+		TargetTable:      &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables:     []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		MaxChunkDiffRows: 2,
+	}
+	td.adjustConfig()
+	td.skipFix = true
+
+	sourceRows := sqlmock.NewRows([]string{"id", "name"})
+	targetRows := sqlmock.NewRows([]string{"id", "name"})
+	for i := 1; i <= 5; i++ {
+		sourceRows.AddRow(i, "a")
+		targetRows.AddRow(i, "b")
+	}
+	targetMock.ExpectQuery("SELECT").WillReturnRows(targetRows)
+	sourceMock.ExpectQuery("SELECT").WillReturnRows(sourceRows)
+
+	result := &ChunkResult{}
+	equal, err := td.compareRows(context.Background(), &ChunkRange{ID: 1, Where: "(TRUE)"}, result)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(result.DifferentRows, Equals, 2)
+	c.Assert(result.DiffTruncated, IsTrue)
+}
+
+func (s *testChunkResultSuite) TestIsQueryTimeout(c *C) {
+	ctx := context.Background()
+	c.Assert(isQueryTimeout(ctx, &mysql.MySQLError{Number: 3024}), IsTrue)
+	c.Assert(isQueryTimeout(ctx, errors.Annotate(context.DeadlineExceeded, "get checksum")), IsTrue)
+	c.Assert(isQueryTimeout(ctx, errors.New("unknown")), IsFalse)
+
+	// the caller's context is done
+	ctx, cancel := context.WithTimeout(ctx, 0)
+	defer cancel()
+	<-ctx.Done()
+	c.Assert(isQueryTimeout(ctx, context.DeadlineExceeded), IsFalse)
+}
@@ -15,8 +15,10 @@ package diff
 
 import (
 	"context"
+	"fmt"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/importer"
 )
@@ -204,3 +206,139 @@ func (*testChunkSuite) TestChunkToString(c *C) {
 		c.Assert(arg, Equals, expectArgs[i])
 	}
 }
+
+func (*testChunkSuite) TestChunkWhereByExprs(c *C) {
+	chunk := &ChunkRange{
+		Bounds: []*Bound{
+			{Column: "a", Lower: "1", LowerSymbol: ">", Upper: "2", UpperSymbol: "<="},
+			{Column: "b", Lower: "3", LowerSymbol: ">", Upper: "4", UpperSymbol: "<="},
+		},
+		Mode:  bucketMode,
+		Where: "(((`a` > ?) OR (`a` = ? AND `b` > ?)) AND ((`a` <= ?) OR (`a` = ? AND `b` <= ?)) AND TRUE)",
+		Args:  []string{"1", "1", "3", "2", "2", "4"},
+	}
+
+	conditions, args := chunk.toStringByExprs("", map[string]string{"a": "`a` - 10000"})
+	c.Assert(conditions, Equals, "(((`a` - 10000) > ?) OR ((`a` - 10000) = ? AND `b` > ?)) AND (((`a` - 10000) <= ?) OR ((`a` - 10000) = ? AND `b` <= ?))")
+	c.Assert(args, DeepEquals, chunk.Args)
+
+	// the chunk's conditions are used if the bounds' columns have no expression
+	table := &TableInstance{ColumnExprs: map[string]string{"c": "LOWER(`c`)"}, limits: "`c` > 'a'"}
+	where, whereArgs := table.chunkWhere(chunk)
+	c.Assert(where, Equals, chunk.Where)
+	c.Assert(whereArgs, DeepEquals, []interface{}{"1", "1", "3", "2", "2", "4"})
+
+	table.ColumnExprs["b"] = "`b` + 1"
+	where, _ = table.chunkWhere(chunk)
+	c.Assert(where, Equals, "(((`a` > ?) OR (`a` = ? AND (`b` + 1) > ?)) AND ((`a` <= ?) OR (`a` = ? AND (`b` + 1) <= ?)) AND `c` > 'a')")
+
+	// the instance's range is merged with the table's range
+	table = &TableInstance{Range: "`tenant_id` = 1"}
+	table.limits = table.mergeRange("`c` > 'a'")
+	where, whereArgs = table.chunkWhere(chunk)
+	c.Assert(where, Equals, "(((`a` > ?) OR (`a` = ? AND `b` > ?)) AND ((`a` <= ?) OR (`a` = ? AND `b` <= ?)) AND (`c` > 'a') AND (`tenant_id` = 1))")
+	c.Assert(whereArgs, DeepEquals, []interface{}{"1", "1", "3", "2", "2", "4"})
+	c.Assert((&TableInstance{}).mergeRange("TRUE"), Equals, "TRUE")
+}
+
+func (*testChunkSuite) TestChunkSampled(c *C) {
+	newChunk := func(lower, upper string) *ChunkRange {
+		chunk := NewChunkRange(normalMode)
+		chunk.Bounds = append(chunk.Bounds, &Bound{Column: "a", Lower: lower, LowerSymbol: gt, Upper: upper, UpperSymbol: lte})
+		return chunk
+	}
+
+	sampledNum := 0
+	for i := 0; i < 1000; i++ {
+		chunk := newChunk(fmt.Sprintf("%d", i*10), fmt.Sprintf("%d", (i+1)*10))
+		sampled := chunk.sampled("hash", 20)
+		// the same chunk is always sampled in the same way
+		c.Assert(newChunk(chunk.Bounds[0].Lower, chunk.Bounds[0].Upper).sampled("hash", 20), Equals, sampled)
+		c.Assert(chunk.sampled("hash", 100), IsTrue)
+		c.Assert(chunk.sampled("hash", 0), IsFalse)
+		if sampled {
+			sampledNum++
+		}
+	}
+	c.Assert(sampledNum > 100 && sampledNum < 300, IsTrue, Commentf("sampled %d chunks", sampledNum))
+}
+
+func (*testChunkSuite) TestDecimalBoundCast(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` decimal(20,4), `b` int, `c` double, primary key(`a`, `b`))")
+	c.Assert(err, IsNil)
+	c.Assert(boundCast(tableInfo.Columns[0]), Equals, "DECIMAL(20,4)")
+	c.Assert(boundCast(tableInfo.Columns[1]), Equals, "")
+
+	chunk := NewChunkRange(normalMode).copyAndUpdate("a", "", "", "", "")
+	chunk.Bounds[0].Cast = boundCast(tableInfo.Columns[0])
+	// the updated bound keeps the cast
+	chunk = chunk.copyAndUpdate("a", "1.0001", gt, "12345678901234567.0002", lte)
+	chunk.update("b", "1", gte, "", "")
+	conditions, args := chunk.toString("")
+	c.Assert(conditions, Equals, "`a` > CAST(? AS DECIMAL(20,4)) AND `a` <= CAST(? AS DECIMAL(20,4)) AND `b` >= ?")
+	c.Assert(args, DeepEquals, []string{"1.0001", "12345678901234567.0002", "1"})
+
+	chunk.Mode = bucketMode
+	conditions, _ = chunk.toString("")
+	c.Assert(conditions, Equals, "((`a` > CAST(? AS DECIMAL(20,4))) OR (`a` = CAST(? AS DECIMAL(20,4)) AND `b` >= ?)) AND ((`a` <= CAST(? AS DECIMAL(20,4))))")
+}
+
+func (*testChunkSuite) TestEnumIndexBound(c *C) {
+	chunk := NewChunkRange(normalMode).copyAndUpdate("e", "", "", "", "")
+	chunk.Bounds[0].EnumIndex = true
+	// the updated bound keeps comparing by the index, and the collation is only for the labels
+	chunk = chunk.copyAndUpdate("e", "1", gte, "3", lt)
+	chunk.update("b", "x", gt, "", "")
+	conditions, args := chunk.toString("utf8mb4_bin")
+	c.Assert(conditions, Equals, "(`e` + 0) >= ? AND (`e` + 0) < ? AND `b` COLLATE 'utf8mb4_bin' > ?")
+	c.Assert(args, DeepEquals, []string{"1", "3", "x"})
+
+	chunk.Mode = bucketMode
+	conditions, _ = chunk.toString("")
+	c.Assert(conditions, Equals, "(((`e` + 0) >= ?) OR ((`e` + 0) = ? AND `b` > ?)) AND (((`e` + 0) < ?))")
+}
+
+func (*testChunkSuite) TestUnsplittableColumns(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`e` enum('a', 'b'), `b` int, primary key(`e`, `b`))")
+	c.Assert(err, IsNil)
+	sourceInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`e` enum('b', 'a'), `b` int, primary key(`e`, `b`))")
+	c.Assert(err, IsNil)
+
+	// the ENUM column with different indexes in the source is not split by
+	table := &TableInstance{Schema: "test", Table: "atest", info: tableInfo}
+	table.unsplittableColumns = differentEnumColumns(tableInfo, []*model.TableInfo{sourceInfo})
+	fields, err := table.splitFields("e")
+	c.Assert(err, IsNil)
+	c.Assert(fields, HasLen, 1)
+	c.Assert(fields[0].Name.O, Equals, "b")
+
+	table.unsplittableColumns = differentEnumColumns(tableInfo, []*model.TableInfo{tableInfo})
+	fields, err = table.splitFields("")
+	c.Assert(err, IsNil)
+	c.Assert(fields, HasLen, 2)
+	c.Assert(fields[0].Name.O, Equals, "e")
+}
+
+func (*testChunkSuite) TestApproximateSplitFields(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` double, `b` int, `c` float, `d` int, primary key(`a`), key idx_c(`c`))")
+	c.Assert(err, IsNil)
+
+	// the FLOAT and DOUBLE columns are used at last, even if they are configured
+	testCases := []struct {
+		splitFields string
+		fields      []string
+	}{
+		{"", []string{"b", "d", "a", "c"}},
+		{"c", []string{"b", "d", "c", "a"}},
+		{"a,d", []string{"d", "b", "a", "c"}},
+	}
+	for _, testCase := range testCases {
+		fields, err := getSplitFieldsByString(tableInfo, testCase.splitFields)
+		c.Assert(err, IsNil)
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			names = append(names, field.Name.O)
+		}
+		c.Assert(names, DeepEquals, testCase.fields, Commentf("split fields %s", testCase.splitFields))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// setColumnGroups splits the compared columns of the target table into the groups of ColumnGroupSize columns, the
+// columns are not split if they are not more than ColumnGroupSize. the columns of the order key are not in the groups,
+// they are calculated in every group's checksum to identify the rows.
+func (t *TableDiff) setColumnGroups() {
+	t.columnGroups = nil
+	if t.ColumnGroupSize <= 0 {
+		return
+	}
+
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(t.TargetTable.info)
+	ignoreColumns := utils.SliceToMap(t.IgnoreColumns)
+	columns := make([]string, 0, len(t.TargetTable.info.Columns))
+	for _, col := range t.TargetTable.info.Columns {
+		if _, ok := ignoreColumns[col.Name.O]; ok || dbutil.FindColumnByName(orderKeyCols, col.Name.O) != nil {
+			continue
+		}
+		columns = append(columns, col.Name.O)
+	}
+	if len(columns) <= t.ColumnGroupSize {
+		return
+	}
+
+	for len(columns) > 0 {
+		size := t.ColumnGroupSize
+		if size > len(columns) {
+			size = len(columns)
+		}
+		t.columnGroups = append(t.columnGroups, columns[:size])
+		columns = columns[size:]
+	}
+	log.Info("split the columns into groups", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Int("group num", len(t.columnGroups)))
+}
+
+// columnGroupsIgnoreColumns returns the ignored columns when only the columns are compared, the columns of the other
+// groups are ignored.
+func (t *TableDiff) columnGroupsIgnoreColumns(columns []string) map[string]interface{} {
+	compared := utils.SliceToMap(columns)
+	ignoreColumns := utils.SliceToMap(t.IgnoreColumns)
+	for _, group := range t.columnGroups {
+		for _, column := range group {
+			if _, ok := compared[column]; !ok {
+				ignoreColumns[column] = struct{}{}
+			}
+		}
+	}
+	return ignoreColumns
+}
+
+// compareColumnGroupsChecksum calculates the checksum of every column group, and saves the columns of the mismatched
+// groups in result. the checksums of the groups are combined by XOR, and the counts are the first group's.
+func (t *TableDiff) compareColumnGroupsChecksum(ctx context.Context, chunk *ChunkRange, result *ChunkResult) (sourceChecksum, targetChecksum, sourceCount, targetCount int64, err error) {
+	result.MismatchedColumns = nil
+	for i, group := range t.columnGroups {
+		groupSourceChecksum, groupTargetChecksum, groupSourceCount, groupTargetCount, err := t.getChecksumByColumns(ctx, chunk, t.columnGroupsIgnoreColumns(group))
+		if err != nil {
+			return 0, 0, 0, 0, errors.Annotatef(err, "column group %d", i)
+		}
+
+		if i == 0 {
+			sourceCount, targetCount = groupSourceCount, groupTargetCount
+			if sourceCount != targetCount {
+				// some rows are missing or extra, all the columns should be compared to fix them
+				log.Warn("count is not equal, skip the checksum of the column groups", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk))
+				return groupSourceChecksum, groupTargetChecksum, sourceCount, targetCount, nil
+			}
+		}
+		sourceChecksum ^= groupSourceChecksum
+		targetChecksum ^= groupTargetChecksum
+		if groupSourceChecksum != groupTargetChecksum {
+			result.MismatchedColumns = append(result.MismatchedColumns, group...)
+		}
+	}
+
+	if len(result.MismatchedColumns) != 0 {
+		log.Warn("column groups' checksum is not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Strings("columns", result.MismatchedColumns))
+	}
+	return sourceChecksum, targetChecksum, sourceCount, targetCount, nil
+}
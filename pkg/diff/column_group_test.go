@@ -0,0 +1,109 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testColumnGroupSuite{})
+
+type testColumnGroupSuite struct{}
+
+func (s *testColumnGroupSuite) TestSetColumnGroups(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` int, `a` int, `b` int, `c` int, `d` int, `e` int, PRIMARY KEY (`id`))")
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{TargetTable: &TableInstance{Schema: "test", Table: "t", info: tableInfo}, IgnoreColumns: []string{"c"}}
+	td.setColumnGroups()
+	c.Assert(td.columnGroups, IsNil)
+
+	// the columns are not split if they are not more than the group size
+	td.ColumnGroupSize = 4
+	td.setColumnGroups()
+	c.Assert(td.columnGroups, IsNil)
+
+	// the order key and the ignored columns are not in the groups
+	td.ColumnGroupSize = 3
+	td.setColumnGroups()
+	c.Assert(td.columnGroups, DeepEquals, [][]string{{"a", "b", "d"}, {"e"}})
+	c.Assert(td.useUpdateSQL(), IsTrue)
+
+	td.ColumnGroupSize = 2
+	td.setColumnGroups()
+	c.Assert(td.columnGroups, DeepEquals, [][]string{{"a", "b"}, {"d", "e"}})
+	c.Assert(td.columnGroupsIgnoreColumns([]string{"d", "e"}), DeepEquals, map[string]interface{}{"a": struct{}{}, "b": struct{}{}, "c": struct{}{}})
+}
+
+func (s *testColumnGroupSuite) TestCompareColumnGroupsChecksum(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` int, `a` int, `b` int, `c` int, PRIMARY KEY (`id`))")
+	c.Assert(err, IsNil)
+
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	td := &TableDiff{
+		TargetTable:     &TableInstance{Conn: targetDB, Schema: "test", Table: "t", InstanceID: "target", info: tableInfo},
+		SourceTables:    []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "t", InstanceID: "source", info: tableInfo}},
+		ColumnGroupSize: 1,
+		UseChecksum:     true,
+	}
+	td.adjustConfig()
+	td.setColumnGroups()
+	c.Assert(td.columnGroups, HasLen, 3)
+
+	expectChecksum := func(column string, sourceChecksum, targetChecksum, sourceCount, targetCount int64) {
+		query := "SELECT BIT_XOR\\(CAST\\(CRC32\\(CONCAT_WS\\(',', `id`, `" + column + "`.*"
+		sourceMock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(sourceChecksum, sourceCount))
+		targetMock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(targetChecksum, targetCount))
+	}
+
+	// only the columns of the mismatched groups are compared by rows, even if the combined checksums collide
+	expectChecksum("a", 1, 1, 10, 10)
+	expectChecksum("b", 2, 6, 10, 10)
+	expectChecksum("c", 4, 0, 10, 10)
+	chunk := &ChunkRange{ID: 1, Where: "(TRUE)"}
+	result := &ChunkResult{}
+	equal, err := td.compareChecksum(context.Background(), chunk, result)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(result.MismatchedColumns, DeepEquals, []string{"b", "c"})
+	c.Assert(result.SourceChecksum, Equals, result.TargetChecksum)
+
+	// all the columns are compared if the counts are different
+	expectChecksum("a", 1, 1, 10, 9)
+	result = &ChunkResult{}
+	equal, err = td.compareChecksum(context.Background(), chunk, result)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(result.MismatchedColumns, IsNil)
+
+	expectChecksum("a", 1, 1, 10, 10)
+	expectChecksum("b", 2, 2, 10, 10)
+	expectChecksum("c", 4, 4, 10, 10)
+	result = &ChunkResult{}
+	equal, err = td.compareChecksum(context.Background(), chunk, result)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
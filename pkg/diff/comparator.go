@@ -0,0 +1,89 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	// ComparatorCaseInsensitive compares the column's values case-insensitively, for example emails.
+	ComparatorCaseInsensitive = "case-insensitive"
+	// ComparatorUUID compares the column's values as UUIDs, the dashes and the case of the hex digits are ignored,
+	// for example "6BA7B810-9DAD-11D1-80B4-00C04FD430C8" equals "6ba7b8109dad11d180b400c04fd430c8".
+	ComparatorUUID = "uuid"
+)
+
+// ValidateComparator returns error if the comparator is not supported.
+func ValidateComparator(comparator string) error {
+	switch comparator {
+	case ComparatorCaseInsensitive, ComparatorUUID:
+		return nil
+	default:
+		return errors.NotSupportedf("comparator %s", comparator)
+	}
+}
+
+// equalByComparator compares two not NULL values by the comparator, returns false if the comparator is unknown.
+func equalByComparator(comparator string, data1, data2 []byte) bool {
+	switch comparator {
+	case ComparatorCaseInsensitive:
+		return strings.EqualFold(string(data1), string(data2))
+	case ComparatorUUID:
+		return canonicalUUID(string(data1)) == canonicalUUID(string(data2))
+	default:
+		return false
+	}
+}
+
+func canonicalUUID(value string) string {
+	return strings.ToLower(strings.Replace(value, "-", "", -1))
+}
+
+// comparatorExpr returns the expression used to calculate the checksum of the column's expression, which has the same
+// semantics as the comparator, returns the expression if the comparator is unknown.
+func comparatorExpr(comparator string, expr string) string {
+	switch comparator {
+	case ComparatorCaseInsensitive:
+		return fmt.Sprintf("LOWER(%s)", expr)
+	case ComparatorUUID:
+		return fmt.Sprintf("LOWER(REPLACE(%s, '-', ''))", expr)
+	default:
+		return expr
+	}
+}
+
+// checksumColumnExprs returns the expressions used to calculate the checksum of the table instance's columns which
+// have comparator or expression.
+func (t *TableDiff) checksumColumnExprs(table *TableInstance) map[string]string {
+	if len(t.ColumnComparators) == 0 && len(table.ColumnExprs) == 0 {
+		return nil
+	}
+
+	exprs := make(map[string]string, len(t.ColumnComparators)+len(table.ColumnExprs))
+	for column, expr := range table.ColumnExprs {
+		exprs[column] = fmt.Sprintf("(%s)", expr)
+	}
+	for column, comparator := range t.ColumnComparators {
+		expr, ok := exprs[column]
+		if !ok {
+			expr = fmt.Sprintf("`%s`", strings.Replace(column, "`", "``", -1))
+		}
+		exprs[column] = comparatorExpr(comparator, expr)
+	}
+	return exprs
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testComparatorSuite{})
+
+type testComparatorSuite struct{}
+
+func (s *testComparatorSuite) TestEqualByComparator(c *C) {
+	testCases := []struct {
+		comparator string
+		data1      string
+		data2      string
+		equal      bool
+	}{
+		{ComparatorCaseInsensitive, "Alice@Example.com", "alice@example.com", true},
+		{ComparatorCaseInsensitive, "alice@example.com", "bob@example.com", false},
+		{ComparatorUUID, "6BA7B810-9DAD-11D1-80B4-00C04FD430C8", "6ba7b8109dad11d180b400c04fd430c8", true},
+		{ComparatorUUID, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "6ba7b810-9dad-11d1-80b4-00c04fd430c9", false},
+		{"unknown", "a", "A", false},
+	}
+
+	for _, testCase := range testCases {
+		c.Assert(equalByComparator(testCase.comparator, []byte(testCase.data1), []byte(testCase.data2)), Equals, testCase.equal, Commentf("%+v", testCase))
+	}
+
+	c.Assert(ValidateComparator(ComparatorUUID), IsNil)
+	c.Assert(ValidateComparator("unknown"), NotNil)
+}
+
+func (s *testComparatorSuite) TestColumnComparators(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `email` varchar(24), `uid` char(36), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{ColumnComparators: map[string]string{"email": ComparatorCaseInsensitive, "uid": ComparatorUUID}}
+	c.Assert(td.checksumColumnExprs(&TableInstance{}), DeepEquals, map[string]string{
+		"email": "LOWER(`email`)",
+		"uid":   "LOWER(REPLACE(`uid`, '-', ''))",
+	})
+	c.Assert((&TableDiff{}).checksumColumnExprs(&TableInstance{}), IsNil)
+	// the comparator is applied on the column's expression
+	c.Assert(td.checksumColumnExprs(&TableInstance{ColumnExprs: map[string]string{"id": "`id` - 10000", "email": "TRIM(`email`)"}}), DeepEquals, map[string]string{
+		"id":    "(`id` - 10000)",
+		"email": "LOWER((TRIM(`email`)))",
+		"uid":   "LOWER(REPLACE(`uid`, '-', ''))",
+	})
+
+	keys := tableInfo.Columns[:1]
+	row1 := map[string]*dbutil.ColumnData{
+		"id":    {Data: []byte("1")},
+		"email": {Data: []byte("Alice@Example.com")},
+		"uid":   {Data: []byte("6BA7B810-9DAD-11D1-80B4-00C04FD430C8")},
+	}
+	row2 := map[string]*dbutil.ColumnData{
+		"id":    {Data: []byte("1")},
+		"email": {Data: []byte("alice@example.com")},
+		"uid":   {Data: []byte("6ba7b8109dad11d180b400c04fd430c8")},
+	}
+
+	equal, _, err := compareData(row1, row2, keys, tableInfo.Columns, td.ColumnComparators, nil)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+
+	equal, _, err = compareData(row1, row2, keys, tableInfo.Columns, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+
+	// the NULL value only equals NULL
+	row2["email"] = &dbutil.ColumnData{IsNull: true}
+	equal, _, err = compareData(row1, row2, keys, tableInfo.Columns, td.ColumnComparators, nil)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// getConstraints returns the table's foreign keys, CHECK constraints and expression indexes, returns false if the
+// table is not selected from the database or is a view.
+func (t *TableDiff) getConstraints(ctx context.Context, table *TableInstance) ([]*dbutil.Constraint, bool, error) {
+	if _, ok := table.rowSource().(*sqlRowSource); !ok || table.isView {
+		return nil, false, nil
+	}
+
+	createTableSQL, err := t.getCreateTableSQL(ctx, table)
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
+
+	return dbutil.ParseConstraints(createTableSQL), true, nil
+}
+
+// checkConstraints compares the constraints of the source tables with the target table, the DDLs to fix the target
+// table are written as the fix sql.
+func (t *TableDiff) checkConstraints(ctx context.Context) (bool, error) {
+	targetConstraints, ok, err := t.getConstraints(ctx, t.TargetTable)
+	if err != nil || !ok {
+		return true, errors.Trace(err)
+	}
+
+	equal := true
+	// the sharded source tables usually have the same constraints, so the DDLs are only written once
+	sentDDLs := make(map[string]struct{})
+	for _, sourceTable := range t.SourceTables {
+		sourceConstraints, ok, err := t.getConstraints(ctx, sourceTable)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if !ok {
+			continue
+		}
+
+		for _, difference := range dbutil.DiffConstraints(sourceConstraints, targetConstraints) {
+			log.Warn("constraint is different", zap.String("source", dbutil.TableName(sourceTable.Schema, sourceTable.Table)),
+				zap.String("target", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Stringer("difference", difference))
+			equal = false
+
+			if t.sqlCh == nil {
+				continue
+			}
+			for _, ddl := range difference.FixDDLs(t.TargetTable.Schema, t.TargetTable.Table) {
+				if _, ok := sentDDLs[ddl]; ok {
+					continue
+				}
+				sentDDLs[ddl] = struct{}{}
+				t.sendFixSQL("[fix constraint]", func(Dialect) string { return ddl })
+			}
+		}
+	}
+
+	return equal, nil
+}
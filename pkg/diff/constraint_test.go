@@ -0,0 +1,54 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testConstraintSuite{})
+
+type testConstraintSuite struct{}
+
+func (s *testConstraintSuite) TestCheckConstraints(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	sourceMock.ExpectQuery("SHOW CREATE TABLE `source`.`t`").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t",
+		"CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`),\n  CONSTRAINT `chk_id` CHECK ((`id` > 0))\n) ENGINE=InnoDB"))
+	targetMock.ExpectQuery("SHOW CREATE TABLE `target`.`t`").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t",
+		"CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"))
+
+	tableDiff := &TableDiff{
+		SourceTables:     []*TableInstance{{Conn: sourceDB, Schema: "source", Table: "t", InstanceID: "source-1"}},
+		TargetTable:      &TableInstance{Conn: targetDB, Schema: "target", Table: "t", InstanceID: "target"},
+		CheckConstraints: true,
+		sqlCh:            make(chan string, 1),
+	}
+	tableDiff.adjustConfig()
+
+	equal, err := tableDiff.checkConstraints(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(<-tableDiff.sqlCh, Equals, "ALTER TABLE `target`.`t` ADD CONSTRAINT `chk_id` CHECK ((`id` > 0));")
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
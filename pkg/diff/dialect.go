@@ -0,0 +1,123 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+)
+
+const (
+	// DialectMySQL generates the fix sqls for MySQL and TiDB.
+	DialectMySQL = "mysql"
+	// DialectPostgreSQL generates the fix sqls for PostgreSQL compatible databases.
+	DialectPostgreSQL = "postgresql"
+)
+
+// Dialect describes the syntax of the database which executes the fix sqls.
+type Dialect interface {
+	// Name returns the dialect's name, for example "mysql".
+	Name() string
+
+	// QuoteName quotes the identifier, for example the schema, table or column's name.
+	QuoteName(name string) string
+
+	// FormatValue formats the column's not NULL value to a literal.
+	FormatValue(col *model.ColumnInfo, data []byte) string
+
+	// UpsertSQL returns the sql which inserts the row, or overwrites the existing row with the same keys.
+	// the names are quoted, and values are formatted.
+	UpsertSQL(tableName string, colNames, values, keyNames []string) string
+}
+
+// NewDialect returns the Dialect by name.
+func NewDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case DialectMySQL, "tidb", "":
+		return mysqlDialect{}, nil
+	case DialectPostgreSQL, "postgres":
+		return postgreSQLDialect{}, nil
+	default:
+		return nil, errors.NotSupportedf("dialect %s", name)
+	}
+}
+
+// mysqlDialect generates sqls for MySQL and TiDB, the row is overwritten by `REPLACE`.
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return DialectMySQL
+}
+
+func (mysqlDialect) QuoteName(name string) string {
+	return fmt.Sprintf("`%s`", strings.Replace(name, "`", "``", -1))
+}
+
+func (mysqlDialect) FormatValue(col *model.ColumnInfo, data []byte) string {
+	return formatValue(col, data)
+}
+
+func (mysqlDialect) UpsertSQL(tableName string, colNames, values, keyNames []string) string {
+	return fmt.Sprintf("REPLACE INTO %s(%s) VALUES (%s);", tableName, strings.Join(colNames, ","), strings.Join(values, ","))
+}
+
+// postgreSQLDialect generates sqls for PostgreSQL compatible databases, the row is overwritten by
+// `INSERT ... ON CONFLICT (keys) DO UPDATE`, so the keys must be a primary key or unique index in the target.
+type postgreSQLDialect struct{}
+
+func (postgreSQLDialect) Name() string {
+	return DialectPostgreSQL
+}
+
+func (postgreSQLDialect) QuoteName(name string) string {
+	return fmt.Sprintf(`"%s"`, strings.Replace(name, `"`, `""`, -1))
+}
+
+func (postgreSQLDialect) FormatValue(col *model.ColumnInfo, data []byte) string {
+	if isBinaryColumn(col) {
+		return fmt.Sprintf(`'\x%X'`, data)
+	}
+
+	if needQuotes(col.FieldType) {
+		// standard_conforming_strings is on by default, only the quote need to be escaped
+		return fmt.Sprintf("'%s'", strings.Replace(string(data), "'", "''", -1))
+	}
+
+	return string(data)
+}
+
+func (postgreSQLDialect) UpsertSQL(tableName string, colNames, values, keyNames []string) string {
+	keys := make(map[string]struct{}, len(keyNames))
+	for _, name := range keyNames {
+		keys[name] = struct{}{}
+	}
+
+	sets := make([]string, 0, len(colNames))
+	for _, name := range colNames {
+		if _, ok := keys[name]; ok {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", name, name))
+	}
+
+	action := "DO NOTHING"
+	if len(sets) != 0 {
+		action = fmt.Sprintf("DO UPDATE SET %s", strings.Join(sets, ", "))
+	}
+
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES (%s) ON CONFLICT (%s) %s;", tableName, strings.Join(colNames, ","), strings.Join(values, ","), strings.Join(keyNames, ","), action)
+}
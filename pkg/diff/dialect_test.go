@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testDialectSuite{})
+
+type testDialectSuite struct{}
+
+func (s *testDialectSuite) TestPostgreSQLDialect(c *C) {
+	dialect, err := NewDialect("postgresql")
+	c.Assert(err, IsNil)
+	c.Assert(dialect.Name(), Equals, DialectPostgreSQL)
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), `data` varbinary(10), primary key(`id`))")
+	c.Assert(err, IsNil)
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+
+	newData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("it's")},
+		"data": {Data: []byte{0x01, 0xab}},
+	}
+	oldData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("x")},
+		"data": {IsNull: true},
+	}
+
+	c.Assert(generateDML(dialect, "replace", newData, orderKeyCols, tableInfo, "test"), Equals,
+		`INSERT INTO "test"."atest"("id","name","data") VALUES (1,'it''s','\x01AB') ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "data" = EXCLUDED."data";`)
+	c.Assert(generateDML(dialect, "insert", newData, orderKeyCols, tableInfo, "test"), Equals,
+		`INSERT INTO "test"."atest"("id","name","data") VALUES (1,'it''s','\x01AB');`)
+	c.Assert(generateDML(dialect, "delete", newData, orderKeyCols, tableInfo, "test"), Equals,
+		`DELETE FROM "test"."atest" WHERE "id" = 1;`)
+	c.Assert(generateUpdateDML(dialect, newData, oldData, orderKeyCols, tableInfo, "test"), Equals,
+		`UPDATE "test"."atest" SET "name" = 'it''s', "data" = '\x01AB' WHERE "id" = 1;`)
+
+	// all the columns are keys
+	tableInfo, err = dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`btest` (`id` int, primary key(`id`))")
+	c.Assert(err, IsNil)
+	_, orderKeyCols = dbutil.SelectUniqueOrderKey(tableInfo)
+	c.Assert(generateDML(dialect, "replace", newData, orderKeyCols, tableInfo, "test"), Equals,
+		`INSERT INTO "test"."btest"("id") VALUES (1) ON CONFLICT ("id") DO NOTHING;`)
+
+	_, err = NewDialect("oracle")
+	c.Assert(err, NotNil)
+}
@@ -14,16 +14,15 @@
 package diff
 
 import (
-	"container/heap"
 	"context"
 	"crypto/md5"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -34,13 +33,79 @@ import (
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrDeleteLimitExceeded means the number of rows need to be deleted in target table exceeds the limit
+	ErrDeleteLimitExceeded = errors.New("the number of rows need to be deleted exceeds the limit")
+)
+
+// the number of smaller chunks split from a chunk whose query exceeds the max execution time
+const timeoutSplitCount = 4
+
+// the index hint selects the index covering the split fields
+const indexHintAuto = "auto"
+
 // TableInstance record a table instance
 type TableInstance struct {
 	Conn       *sql.DB `json:"-"`
 	Schema     string  `json:"schema"`
 	Table      string  `json:"table"`
 	InstanceID string  `json:"instance-id"`
-	info       *model.TableInfo
+	// limits the number of chunks checked concurrently in this instance, can be shared by tables in the same instance. no limit if is nil.
+	Limiter *ConcurrencyLimiter `json:"-"`
+	// caches the table's metadata selected from Conn, can be shared by tables in one run. not cache if is nil.
+	MetadataCache *dbutil.MetadataCache `json:"-"`
+	// provides the table's struct and rows, select them from Conn if is nil.
+	// the target table should be in a database because the chunks are split by it.
+	Source RowSource `json:"-"`
+	// the SQL expressions selected instead of the columns, for example {"id": "`id` - 10000"} when the sharding tables
+	// store the transformed values. the values are compared after the expressions are applied, and the chunks' bounds
+	// are also compared with the expressions, so the indexes of the columns can't be used.
+	ColumnExprs map[string]string `json:"column-exprs,omitempty"`
+	// the condition selects the rows in this instance, for example "tenant_id BETWEEN 1 AND 100" for a shard,
+	// merged with TableDiff's Range by AND.
+	Range string `json:"range,omitempty"`
+	info  *model.TableInfo
+	// set true if the table is a view and TableDiff's CompareViews is true, the view's columns are compared as a table
+	isView         bool
+	viewDefinition string
+	// the expressions selected in the rows' queries, the ColumnExprs and the long columns' hashes. use ColumnExprs if is nil.
+	rowColumnExprs map[string]string
+	// the index forced in the queries, resolved from TableDiff's IndexHint
+	indexHint string
+	// the range merged with Range and the collation, used to build the chunks' conditions in this instance
+	limits    string
+	collation string
+	// the ENUM columns whose elements are different from the other instances, the chunks are not split by them
+	// because the ENUM bounds are the elements' indexes.
+	unsplittableColumns map[string]struct{}
+}
+
+// splitFields returns the fields to split the table's chunks like getSplitFieldsByString, without the unsplittable
+// columns.
+func (t *TableInstance) splitFields(splitFields string) ([]*model.ColumnInfo, error) {
+	fields, err := getSplitFieldsByString(t.info, splitFields)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	splittable := make([]*model.ColumnInfo, 0, len(fields))
+	for _, field := range fields {
+		if _, ok := t.unsplittableColumns[field.Name.O]; ok {
+			log.Warn("ENUM column's elements are different between the instances, don't split chunks by it", zap.String("table", dbutil.TableName(t.Schema, t.Table)), zap.String("column", field.Name.O))
+			continue
+		}
+		splittable = append(splittable, field)
+	}
+
+	return splittable, nil
+}
+
+// mergeRange returns the condition merged the table's range with the instance's Range.
+func (t *TableInstance) mergeRange(limits string) string {
+	if len(t.Range) == 0 {
+		return limits
+	}
+	return fmt.Sprintf("(%s) AND (%s)", limits, t.Range)
 }
 
 // TableDiff saves config for diff table
@@ -53,12 +118,25 @@ type TableDiff struct {
 	// columns be ignored
 	IgnoreColumns []string `json:"-"`
 
+	// only these columns are compared if is not empty, the other columns are ignored like IgnoreColumns,
+	// except the columns used to order and match the rows.
+	CheckColumns []string `json:"-"`
+
 	// columns be removed
 	RemoveColumns []string `json:"-"`
 
+	// the columns of a unique business key used to order and match the rows instead of the primary key, for example
+	// when the surrogate primary keys are regenerated in target. the primary key's columns not in the business key
+	// are not compared, and the fix sql locates the rows by the business key and never writes the primary key.
+	BusinessKey []string `json:"business-key,omitempty"`
+
 	// field should be the primary key, unique key or field with index
 	Fields string `json:"fields"`
 
+	// the index forced by FORCE INDEX in the checksum and rows' queries, "auto" selects the index covering the split
+	// fields, no hint if is empty.
+	IndexHint string `json:"index-hint,omitempty"`
+
 	// select range, for example: "age > 10 AND age < 20"
 	Range string `json:"range"`
 
@@ -74,6 +152,21 @@ type TableDiff struct {
 	// how many goroutines are created to check data
 	CheckThreadCount int `json:"-"`
 
+	// limits the number of chunks checked concurrently across the tables, can be shared by all the TableDiffs in one run.
+	// no limit if is nil.
+	GlobalLimiter *ConcurrencyLimiter `json:"-"`
+
+	// the knobs can be changed while the diff is running, like the qps limit and the sample, can be shared by all the
+	// TableDiffs in one run. use the static config if is nil.
+	Tuning *Tuning `json:"-"`
+
+	// limits the memory of the rows buffered to compare, can be shared by all the TableDiffs in one run, the rows are
+	// spilled to the temporary files if the budget is exceeded. no limit if is nil.
+	MemoryLimiter *MemoryLimiter `json:"-"`
+
+	// tracks the chunks being checked, can be shared by all the TableDiffs in one run. will not track if is nil.
+	InFlight *InFlightTracker `json:"-"`
+
 	// set true if target-db and source-db all support tidb implicit column "_tidb_rowid"
 	UseRowID bool `json:"use-rowid"`
 
@@ -83,7 +176,8 @@ type TableDiff struct {
 	// set true if just want compare data by checksum, will skip select data when checksum is not equal
 	OnlyUseChecksum bool `json:"-"`
 
-	// collation config in mysql/tidb, should corresponding to charset.
+	// collation config in mysql/tidb, should corresponding to charset. if is empty and the order key's collations are
+	// different in the instances, every instance uses the binary collation of its charset to order the rows.
 	Collation string `json:"collation"`
 
 	// ignore check table's struct
@@ -92,12 +186,209 @@ type TableDiff struct {
 	// ignore check table's data
 	IgnoreDataCheck bool `json:"-"`
 
+	// set true will also compare every secondary index's content after checking the data, the index's columns and
+	// the primary key's columns are read by FORCE INDEX and compared by checksum, to find the index diverged from its
+	// rows or from the source. see CheckIndexData.
+	CheckIndexes bool `json:"-"`
+
+	// set true will generate fix sqls for source tables instead of target table, the target table is regarded as the source of truth.
+	// for example, after failover the downstream becomes the primary and the upstream need to be repaired.
+	ReverseFixSQL bool `json:"-"`
+
+	// set true will generate `UPDATE ... SET changed columns WHERE keys` for the rows exist in both sides but have different data,
+	// and `INSERT`/`DELETE` for the missing/extra rows, instead of `REPLACE`, which may fire the DELETE and INSERT triggers.
+	UseUpdateSQL bool `json:"-"`
+
+	// set true will compare the length and SHA1 of the TEXT/BLOB columns' values calculated in the databases instead of
+	// transferring the values, the raw values are only selected by the order key when generating the fix sqls.
+	// the different rows' reports contain the hashes like "1024:<sha1>" of these columns. only works for the databases.
+	HashLongColumns bool `json:"-"`
+
+	// split the compared columns into the groups of this number of columns for the very wide tables, the checksum of
+	// every group is calculated separately, and only the columns of the mismatched groups and the order key are selected
+	// to compare the rows. the different rows are fixed by `UPDATE` if the columns are split. 0 means not split.
+	ColumnGroupSize int `json:"-"`
+
+	// set true will compare the views like the tables, the views' struct are compared by the columns and the SELECT
+	// definitions, and the data are compared by selecting the rows from the views, the chunks are split by the
+	// columns' values and TiDBStatsSource is not used. the views can't be compared if is false.
+	CompareViews bool `json:"-"`
+
+	// the integer or decimal columns whose SUM, COUNT(DISTINCT), MIN and MAX are compared with the row count in every
+	// chunk instead of the checksum, which catches most drifts at a fraction of the checksum's cost. the chunk's rows
+	// are compared if the aggregates are different, unless OnlyUseChecksum is true. not compared if is empty.
+	AggregateColumns []string `json:"aggregate-columns,omitempty"`
+
+	// compares the TiDB-specific attributes in the struct check, like the AUTO_RANDOM columns and SHARD_ROW_ID_BITS,
+	// only the instances selected from the databases are compared. not compared if is nil.
+	TiDBAttributes *TiDBAttributesCheck `json:"-"`
+
+	// set true will regard the table's struct as not equal if the ENUM/SET columns' elements have different order,
+	// the different elements always make the struct not equal. the data of ENUM/SET is always compared by label, so
+	// the different order will not cause data difference.
+	CheckEnumOrder bool `json:"-"`
+
+	// set true will compare the foreign keys, CHECK constraints and expression indexes in the struct check, and
+	// generate the DDLs to fix the target table's constraints.
+	CheckConstraints bool `json:"-"`
+
+	// set true will regard the table's struct as not equal if the columns' charsets or collations are different but
+	// compatible, like utf8 and utf8mb4, which are only warned by default. the incompatible charsets are always not equal.
+	StrictCharset bool `json:"-"`
+
+	// the column marks the row as logically deleted, for example `deleted_at` or `is_deleted`.
+	// the soft deleted rows are regarded as absent in the instances which have this column, so the logical deletes
+	// replicated as flags and the physical deletes don't produce differences.
+	SoftDeleteColumn string `json:"soft-delete-column,omitempty"`
+
+	// the row is soft deleted if SoftDeleteColumn's value is one of them, for example "1".
+	// if is empty, the row is soft deleted if SoftDeleteColumn is not NULL, for example `deleted_at`.
+	SoftDeleteValues []string `json:"soft-delete-values,omitempty"`
+
+	// the comparator of the columns, the column's values are compared by the comparator in both checksum and rows,
+	// for example ComparatorCaseInsensitive for emails, to match the application-level semantics.
+	ColumnComparators map[string]string `json:"column-comparators,omitempty"`
+
 	// set true will continue check from the latest checkpoint
 	UseCheckpoint bool `json:"use-checkpoint"`
 
+	// set true will only dispatch the failed, error and not checked chunks loaded from the checkpoint, the success and
+	// ignored chunks are skipped without being sent to the check workers.
+	ResumeFailedChunks bool `json:"-"`
+
+	// set true will recheck the failed chunks of the previous finished check from the checkpoint, even if
+	// UseCheckpoint is false, and the tables passed in the previous check are not checked again.
+	// the tables without checkpoint are checked as usual. like ResumeFailedChunks, it's not a part of the config hash,
+	// so the checkpoint saved by the previous check without it can be used.
+	RecheckFailed bool `json:"-"`
+
+	// the database saves the checkpoint and summary, default is the target's. set it to another database if the target
+	// must not be written, for example the target is opened by dbutil.OpenReadOnlyDB for audits against production.
+	CheckpointConn *sql.DB `json:"-"`
+
 	// get tidb statistics information from which table instance. if is nil, will split chunk by random.
 	TiDBStatsSource *TableInstance `json:"tidb-stats-source"`
 
+	// set true will split the chunks by the regions of the table's records in TiDBStatsSource, so the chunks align with
+	// the data's layout in TiKV and the chunk's checksum is calculated in one region.
+	SplitByRegion bool `json:"split-by-region,omitempty"`
+
+	// used to report the progress of diff, will not report progress if is nil.
+	Progress ProgressReporter `json:"-"`
+
+	// used to export the different rows, for example to a csv file, will not export rows if is nil.
+	RowDiffExporter RowDiffExporter `json:"-"`
+
+	// used to export the queries and checksums of the failed chunks, so the mismatches can be reproduced manually,
+	// will not export if is nil.
+	ChunkArtifactExporter ChunkArtifactExporter `json:"-"`
+
+	// notified of the chunks' and rows' events during the diff, will not notify if is nil.
+	Observer DiffObserver `json:"-"`
+
+	// invoked with the final state and statistics of every chunk, will not be invoked if is nil.
+	ChunkResultHandler ChunkResultHandler `json:"-"`
+
+	// the max number of source tables queried concurrently when calculating a chunk's checksum, default is 8.
+	// the checksums of sharding tables are calculated in parallel and combined by XOR.
+	SourceChecksumConcurrency int `json:"-"`
+
+	// the syntax of the fix sqls, default is MySQL's.
+	Dialect Dialect `json:"-"`
+
+	// the max number of rows can be deleted in target table by fix sql, 0 means no limit.
+	// will stop check and return ErrDeleteLimitExceeded if exceeds the limit.
+	MaxDeleteRows int64 `json:"-"`
+
+	// the max ratio of rows can be deleted in target table by fix sql, for example 0.1 means 10% of the table's rows, 0 means no limit.
+	MaxDeleteRatio float64 `json:"-"`
+
+	// the max number of different rows found in a chunk, the rest rows of the chunk are not compared once reach it, and
+	// no fix sql is generated for them. 0 means no limit.
+	MaxChunkDiffRows int `json:"-"`
+
+	// the schema and table name of percona-toolkit's checksums table, for example `percona`.`checksums`.
+	// if is not empty, will save the chunks' checksum in target database with pt-table-checksum's format, only works when UseChecksum is true.
+	PTChecksumSchema string `json:"-"`
+	PTChecksumTable  string `json:"-"`
+
+	// set true will load pt-table-checksum's result from the checksums table, and only check the chunks which are not equal.
+	// will split chunks as usual if the table is not checked by pt-table-checksum.
+	UsePTChecksum bool `json:"use-pt-checksum,omitempty"`
+
+	// set true will count the chunk's rows in all instances before comparing the checksum, the chunk is regarded as
+	// not equal directly if the counts are different. the counts are summed up and can be got by RowCounts.
+	RowCountCheck bool `json:"-"`
+
+	// set true will re-check the failed chunks once after all the chunks are checked, and the result of the retry is
+	// the final result, to absorb the transient replication lag or flaky connections. the different rows are only exported
+	// and fixed by the retry, so the rows fixed by replication in the meantime don't produce fix sqls.
+	RetryFailedChunks bool `json:"-"`
+
+	// the time to wait before re-checking the failed chunks.
+	RetryDelay time.Duration `json:"-"`
+
+	// set it if the replication from source to target is still running, the failed chunks are re-checked after the target
+	// applied the source's position, up to LagRecheckTimes times. only the rows remain different in the last re-check
+	// are exported and fixed, so the differences caused by the replication lag are not reported.
+	ReplicationWaiter ReplicationWaiter `json:"-"`
+
+	// the max times of re-checking the failed chunks when ReplicationWaiter is set, default is 3.
+	LagRecheckTimes int `json:"-"`
+
+	// set it to re-read the checksums of the chunk found different after the delay, the chunk is only regarded as
+	// different if both reads have the same checksums and counts, so the transient differences caused by the rows being
+	// replicated are filtered without the snapshots or locks. only works with the checksum, 0 means never re-read.
+	DoubleReadDelay time.Duration `json:"-"`
+
+	// the max times to split a chunk whose query exceeds the max execution time, the chunk is split to smaller chunks
+	// which are checked instead, 0 means the chunk is regarded as failed. the max execution time is set in the database,
+	// for example by the variable max_execution_time.
+	TimeoutSplitTimes int `json:"-"`
+
+	// the timeouts of the queries by class, the chunk whose checksum or rows' query exceeds the timeout is also split
+	// like exceeding the max execution time. use dbutil.DefaultTimeoutPolicy if is nil.
+	Timeouts *dbutil.TimeoutPolicy `json:"-"`
+
+	// used to pause and resume the diff, the new chunks are not dispatched when paused. will not pause if is nil.
+	Pauser *Pauser `json:"-"`
+
+	// set true will mask the columns' values in logs and the different rows' reports, for the compliance with PII
+	// policies. the NULL values are not masked.
+	Redact bool `json:"-"`
+
+	// the columns masked when Redact is true, all the columns are masked if is empty.
+	RedactColumns []string `json:"-"`
+
+	// set true will also replace the masked values in fix sqls with the placeholder `?`, only works when Redact is true.
+	// the fix sqls can't be executed directly, but still show which rows and columns need to be fixed.
+	RedactFixSQL bool `json:"-"`
+
+	redact *redactor
+
+	// the limit calculated by MaxDeleteRows and MaxDeleteRatio, 0 means no limit
+	deleteLimit int64
+
+	// the total number of rows counted by the row count check
+	sourceRowCount int64
+	targetRowCount int64
+
+	// the number of generated delete sqls
+	deleteNum int64
+
+	// the number and the bytes of the chunks compared by rows, used to estimate the memory of a chunk
+	comparedChunks int64
+	comparedBytes  int64
+
+	// set true in the first pass if RetryFailedChunks is true, the different rows are only counted
+	skipFix bool
+
+	// the long columns compared by the hashes, see HashLongColumns
+	hashedColumns map[string]struct{}
+
+	// the compared columns split by ColumnGroupSize, nil if the columns are not split
+	columnGroups [][]string
+
 	sqlCh chan string
 
 	wg sync.WaitGroup
@@ -118,23 +409,73 @@ func (t *TableDiff) setConfigHash() error {
 }
 
 // Equal tests whether two database have same data and schema.
-func (t *TableDiff) Equal(ctx context.Context, writeFixSQL func(string) error) (bool, bool, error) {
+func (t *TableDiff) Equal(ctx context.Context, writeFixSQL func(string) error) (structEqual bool, dataEqual bool, err error) {
 	t.adjustConfig()
+	defer func() {
+		t.observer().OnTableDone(t, structEqual, dataEqual, err)
+	}()
 
 	t.sqlCh = make(chan string)
+	atomic.StoreInt64(&t.sourceRowCount, 0)
+	atomic.StoreInt64(&t.targetRowCount, 0)
+
+	// the fix sqls are held until the check finishes if the deleted rows are limited, and discarded if exceed the limit
+	var holder *fixSQLHolder
+	if t.MaxDeleteRows > 0 || t.MaxDeleteRatio > 0 {
+		var spillDir string
+		if t.MemoryLimiter != nil {
+			spillDir = t.MemoryLimiter.spillDir
+		}
+		holder, err = newFixSQLHolder(spillDir, writeFixSQL)
+		if err != nil {
+			return false, false, errors.Trace(err)
+		}
+		defer holder.close()
+		writeFixSQL = holder.hold
+	}
 
 	stopWriteSqlsCh := t.WriteSqls(ctx, writeFixSQL)
 	stopUpdateSummaryCh := t.UpdateSummaryInfo(ctx)
 
-	err := t.getTableInfo(ctx)
+	structEqual, dataEqual, err = t.check(ctx)
+	// the cancelled check is not finished, it's never regarded as equal
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	// the goroutines are stopped even if the check failed, so the fix sqls already sent are written
+	stopWriteSqlsCh <- true
+	stopUpdateSummaryCh <- true
+
+	t.wg.Wait()
+	if holder != nil {
+		discard := errors.Cause(err) == ErrDeleteLimitExceeded
+		if discard {
+			log.Warn("discard the fix sqls because too many rows need to be deleted", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+		}
+		if err1 := holder.release(discard); err1 != nil {
+			log.Error("write held fix sqls failed", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Error(err1))
+		}
+	}
 	if err != nil {
+		return structEqual, false, errors.Trace(err)
+	}
+
+	t.progress().SetPhase(PhaseFinished)
+	return structEqual, dataEqual, nil
+}
+
+// check checks the table's struct and data by the config.
+func (t *TableDiff) check(ctx context.Context) (structEqual bool, dataEqual bool, err error) {
+	if err = t.getTableInfo(ctx); err != nil {
 		return false, false, errors.Trace(err)
 	}
 
-	structEqual := true
-	dataEqual := true
+	structEqual = true
+	dataEqual = true
 
 	if !t.IgnoreStructCheck {
+		t.progress().SetPhase(PhaseCheckStruct)
 		structEqual, err = t.CheckTableStruct(ctx)
 		if err != nil {
 			return false, false, errors.Trace(err)
@@ -143,25 +484,63 @@ func (t *TableDiff) Equal(ctx context.Context, writeFixSQL func(string) error) (
 
 	if !t.IgnoreDataCheck {
 		dataEqual, err = t.CheckTableData(ctx)
-		if err != nil {
-			return false, false, errors.Trace(err)
+		if err == nil && t.CheckIndexes {
+			t.progress().SetPhase(PhaseCheckIndex)
+			var indexEqual bool
+			indexEqual, _, err = t.CheckIndexData(ctx)
+			dataEqual = dataEqual && indexEqual
 		}
 	}
 
-	stopWriteSqlsCh <- true
-	stopUpdateSummaryCh <- true
-
-	t.wg.Wait()
-	return structEqual, dataEqual, nil
+	return structEqual, dataEqual, errors.Trace(err)
 }
 
 // CheckTableStruct checks table's struct
 func (t *TableDiff) CheckTableStruct(ctx context.Context) (bool, error) {
 	for _, sourceTable := range t.SourceTables {
+		if !equalViewDefinition(sourceTable, t.TargetTable) {
+			log.Warn("view's definition is different", zap.String("source", dbutil.TableName(sourceTable.Schema, sourceTable.Table)),
+				zap.String("target", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("source definition", sourceTable.viewDefinition), zap.String("target definition", t.TargetTable.viewDefinition))
+			return false, nil
+		}
+
 		eq := dbutil.EqualTableInfo(sourceTable.info, t.TargetTable.info)
 		if !eq {
 			return false, nil
 		}
+
+		if col, orderOnly := diffEnumElems(sourceTable.info, t.TargetTable.info); col != nil {
+			var targetElems []string
+			if targetCol := dbutil.FindColumnByName(t.TargetTable.info.Columns, col.Name.O); targetCol != nil {
+				targetElems = targetCol.Elems
+			}
+			fields := []zap.Field{zap.String("source", dbutil.TableName(sourceTable.Schema, sourceTable.Table)), zap.String("target", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)),
+				zap.String("column", col.Name.O), zap.Strings("source elements", col.Elems), zap.Strings("target elements", targetElems)}
+			if !orderOnly {
+				log.Warn("ENUM/SET column's elements are different", fields...)
+				return false, nil
+			}
+
+			log.Warn("ENUM/SET column's elements have different order", fields...)
+			if t.CheckEnumOrder {
+				return false, nil
+			}
+		}
+	}
+
+	if !t.checkCharsets() {
+		return false, nil
+	}
+
+	if t.CheckConstraints {
+		eq, err := t.checkConstraints(ctx)
+		if err != nil || !eq {
+			return false, errors.Trace(err)
+		}
+	}
+
+	if t.TiDBAttributes != nil {
+		return t.checkTiDBAttributes(ctx)
 	}
 
 	return true, nil
@@ -182,414 +561,1812 @@ func (t *TableDiff) adjustConfig() {
 	if t.CheckThreadCount <= 0 {
 		t.CheckThreadCount = 4
 	}
+
+	if t.SourceChecksumConcurrency <= 0 {
+		t.SourceChecksumConcurrency = 8
+	}
+
+	if t.LagRecheckTimes <= 0 {
+		t.LagRecheckTimes = 3
+	}
+
+	if t.Progress == nil {
+		t.Progress = NewNoopProgress()
+	}
+
+	if t.Observer == nil {
+		t.Observer = NewNoopObserver()
+	}
+
+	t.redact = newRedactor(t.Redact, t.RedactColumns)
+
+	if len(t.SoftDeleteColumn) != 0 && t.OnlyUseChecksum {
+		log.Warn("the soft deleted rows are not filtered when only use checksum", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+	}
+
+	if t.RowCountCheck && !t.supportRowCount() {
+		log.Warn("some table instances don't support count rows, will skip the row count check", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+		t.RowCountCheck = false
+	}
+
+	if len(t.AggregateColumns) != 0 && !t.supportAggregate() {
+		log.Warn("some table instances don't support aggregates, will skip the aggregates check", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+		t.AggregateColumns = nil
+	}
+
+	if t.UseChecksum && !t.supportChecksum() {
+		log.Warn("some table instances don't support checksum, will compare the rows directly", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+		t.UseChecksum = false
+		t.OnlyUseChecksum = false
+	}
+}
+
+// supportChecksum returns true if all the table instances' RowSources support checksum.
+func (t *TableDiff) supportChecksum() bool {
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		if _, ok := table.rowSource().(ChecksumSource); !ok {
+			return false
+		}
+	}
+	return true
 }
 
 func (t *TableDiff) getTableInfo(ctx context.Context) error {
-	tableInfo, err := dbutil.GetTableInfoWithRowID(ctx, t.TargetTable.Conn, t.TargetTable.Schema, t.TargetTable.Table, t.UseRowID)
-	if err != nil {
-		return errors.Trace(err)
+	// the rows only exist in the target table can't be routed back to their shards
+	if t.ReverseFixSQL && len(t.SourceTables) > 1 {
+		return errors.NotSupportedf("reverse fix sql for the sharding tables of %s", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table))
 	}
-	t.TargetTable.info = removeColumns(tableInfo, t.RemoveColumns)
 
-	for _, sourceTable := range t.SourceTables {
-		tableInfo, err := dbutil.GetTableInfoWithRowID(ctx, sourceTable.Conn, sourceTable.Schema, sourceTable.Table, t.UseRowID)
-		if err != nil {
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		if err := t.getTableInstanceInfo(ctx, table); err != nil {
 			return errors.Trace(err)
 		}
-		sourceTable.info = removeColumns(tableInfo, t.RemoveColumns)
 	}
 
+	sourceInfos := make([]*model.TableInfo, 0, len(t.SourceTables))
+	for _, table := range t.SourceTables {
+		sourceInfos = append(sourceInfos, table.info)
+	}
+	t.TargetTable.unsplittableColumns = differentEnumColumns(t.TargetTable.info, sourceInfos)
+
+	if err := t.adjustCheckColumns(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := t.checkAggregateColumns(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := t.setLongColumnHashes(); err != nil {
+		return errors.Trace(err)
+	}
+	t.setColumnGroups()
+	t.normalizeCollation()
+
 	return nil
 }
 
-// CheckTableData checks table's data
-func (t *TableDiff) CheckTableData(ctx context.Context) (equal bool, err error) {
-	table := t.TargetTable
+// getTableInstanceInfo gets the table instance's information, and prepares the instance to be checked.
+func (t *TableDiff) getTableInstanceInfo(ctx context.Context, table *TableInstance) error {
+	if _, ok := table.rowSource().(*fileRowSource); ok && (t.Range != "TRUE" || len(table.Range) != 0) {
+		return errors.NotSupportedf("range %s for the files of %s", table.mergeRange(t.Range), table.InstanceID)
+	}
+	if _, ok := table.rowSource().(*fileRowSource); ok && len(table.ColumnExprs) != 0 {
+		return errors.NotSupportedf("column expressions for the files of %s", table.InstanceID)
+	}
 
-	useTiDB := false
-	if t.TiDBStatsSource != nil {
-		table = t.TiDBStatsSource
-		useTiDB = true
+	if _, ok := table.rowSource().(*sqlRowSource); ok && t.CompareViews {
+		if err := t.getViewDefinition(ctx, table); err != nil {
+			return errors.Trace(err)
+		}
 	}
 
-	fromCheckpoint := true
-	chunks, err := t.LoadCheckpoint(ctx)
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutMetadata)
+	tableInfo, err := table.rowSource().GetTableInfo(ctx1, t.UseRowID)
+	cancel1()
 	if err != nil {
-		return false, errors.Trace(err)
+		return errors.Trace(err)
+	}
+	table.info, err = setBusinessKey(removeColumns(tableInfo, t.RemoveColumns), t.BusinessKey)
+	if err != nil {
+		return errors.Annotatef(err, "table %s.%s.%s", table.InstanceID, table.Schema, table.Table)
+	}
+	table.indexHint, err = resolveIndexHint(table.info, t.IndexHint, t.Fields)
+	if err != nil {
+		return errors.Annotatef(err, "table %s.%s.%s", table.InstanceID, table.Schema, table.Table)
+	}
+	for column := range table.ColumnExprs {
+		if dbutil.FindColumnByName(table.info.Columns, column) == nil {
+			return errors.NotFoundf("column %s of the expression in table %s.%s.%s", column, table.InstanceID, table.Schema, table.Table)
+		}
 	}
+	table.limits, table.collation = table.mergeRange(t.Range), t.Collation
 
-	if len(chunks) == 0 {
-		log.Debug("don't have checkpoint info or config changed")
+	return nil
+}
 
-		fromCheckpoint = false
-		chunks, err = SplitChunks(ctx, table, t.Fields, t.Range, t.ChunkSize, t.Collation, useTiDB)
+// adjustCheckColumns converts the check columns to the ignore columns by the target table's information.
+func (t *TableDiff) adjustCheckColumns() error {
+	if len(t.CheckColumns) == 0 {
+		return nil
 	}
 
-	if len(chunks) == 0 {
-		log.Warn("get 0 chunks, table is not checked", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
-		return true, nil
+	ignoreColumns, err := ignoreUncheckedColumns(t.TargetTable.info, t.CheckColumns, t.IgnoreColumns)
+	if err != nil {
+		return errors.Annotatef(err, "table %s.%s", t.TargetTable.Schema, t.TargetTable.Table)
 	}
+	t.IgnoreColumns = ignoreColumns
+	return nil
+}
 
-	checkResultCh := make(chan bool, t.CheckThreadCount)
-	defer close(checkResultCh)
+// ignoreUncheckedColumns returns the ignored columns and the columns not in checkColumns, the columns of the unique
+// order key are always checked because they are used to match the rows.
+func ignoreUncheckedColumns(tableInfo *model.TableInfo, checkColumns []string, ignoreColumns []string) ([]string, error) {
+	checked := make(map[string]struct{}, len(checkColumns))
+	for _, name := range checkColumns {
+		col := dbutil.FindColumnByName(tableInfo.Columns, name)
+		if col == nil {
+			return nil, errors.NotFoundf("check column %s", name)
+		}
+		checked[col.Name.O] = struct{}{}
+	}
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+	for _, col := range orderKeyCols {
+		checked[col.Name.O] = struct{}{}
+	}
 
-	checkWorkerCh := make([]chan *ChunkRange, 0, t.CheckThreadCount)
-	for i := 0; i < t.CheckThreadCount; i++ {
-		checkWorkerCh = append(checkWorkerCh, make(chan *ChunkRange, 10))
-		go t.checkChunksDataEqual(ctx, t.Sample < 100 && !fromCheckpoint, checkWorkerCh[i], checkResultCh)
+	ignored := utils.SliceToMap(ignoreColumns)
+	ignoreColumns = append(make([]string, 0, len(tableInfo.Columns)), ignoreColumns...)
+	for _, col := range tableInfo.Columns {
+		if _, ok := checked[col.Name.O]; ok {
+			continue
+		}
+		if _, ok := ignored[col.Name.O]; ok {
+			continue
+		}
+		ignored[col.Name.O] = struct{}{}
+		ignoreColumns = append(ignoreColumns, col.Name.O)
 	}
 
-	go func() {
-		defer func() {
-			for _, ch := range checkWorkerCh {
-				close(ch)
-			}
-		}()
+	return ignoreColumns, nil
+}
 
-		for _, chunk := range chunks {
-			select {
-			case checkWorkerCh[chunk.ID%t.CheckThreadCount] <- chunk:
-			case <-ctx.Done():
-				return
+// resolveIndexHint returns the index forced in the table's queries. the "auto" hint selects the index covering the
+// split fields, or the first split field if the split fields are not set, no index is forced if none covers them.
+func resolveIndexHint(tableInfo *model.TableInfo, indexHint string, splitFields string) (string, error) {
+	switch {
+	case len(indexHint) == 0:
+		return "", nil
+	case strings.EqualFold(indexHint, indexHintAuto):
+		columns := make([]string, 0, 2)
+		for _, field := range strings.Split(splitFields, ",") {
+			if field = strings.TrimSpace(field); len(field) != 0 {
+				columns = append(columns, field)
 			}
 		}
-	}()
-
-	checkedNum := 0
-	equal = true
-
-CheckResult:
-	for {
-		select {
-		case eq := <-checkResultCh:
-			checkedNum++
-			if !eq {
-				equal = false
+		if len(columns) == 0 {
+			fields, err := getSplitFields(tableInfo, nil)
+			if err != nil {
+				return "", errors.Trace(err)
 			}
-			if len(chunks) == checkedNum {
-				break CheckResult
+			if len(fields) != 0 {
+				columns = append(columns, fields[0].Name.O)
 			}
-		case <-ctx.Done():
-			return equal, nil
 		}
+
+		index := dbutil.FindIndexByColumns(tableInfo, columns)
+		if index == nil {
+			log.Warn("no index covers the split fields, will not force index", zap.String("table", tableInfo.Name.O), zap.Strings("fields", columns))
+			return "", nil
+		}
+		return index.Name.O, nil
+	default:
+		for _, index := range tableInfo.Indices {
+			if strings.EqualFold(index.Name.O, indexHint) {
+				return index.Name.O, nil
+			}
+		}
+		return "", errors.NotFoundf("index %s in table %s", indexHint, tableInfo.Name.O)
 	}
-	return equal, nil
 }
 
-// LoadCheckpoint do some prepare work before check data, like adjust config and create checkpoint table
-func (t *TableDiff) LoadCheckpoint(ctx context.Context) ([]*ChunkRange, error) {
-	ctx1, cancel1 := context.WithTimeout(ctx, 5*dbutil.DefaultTimeout)
-	defer cancel1()
+// CheckTableData checks table's data
+func (t *TableDiff) CheckTableData(ctx context.Context) (equal bool, err error) {
+	table := t.TargetTable
 
-	err := t.setConfigHash()
-	if err != nil {
-		return nil, errors.Trace(err)
+	useTiDB := false
+	// the views don't have statistics and regions
+	if t.TiDBStatsSource != nil && !t.TargetTable.isView {
+		table = t.TiDBStatsSource
+		useTiDB = true
 	}
 
-	err = createCheckpointTable(ctx1, t.TargetTable.Conn)
+	t.progress().SetPhase(PhaseSplitChunks)
+
+	fromCheckpoint, err := t.prepareCheckpoint(ctx)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return false, errors.Trace(err)
 	}
 
-	if t.UseCheckpoint {
-		useCheckpoint, err := loadFromCheckPoint(ctx1, t.TargetTable.Conn, t.TargetTable.Schema, t.TargetTable.Table, t.configHash)
+	var (
+		source chunkSource
+		chunks []*ChunkRange
+	)
+	if fromCheckpoint {
+		// the chunks are loaded from checkpoint on demand, so the huge tables' chunks are not loaded at once
+		var total int64
+		source, total, err = t.checkpointChunkSource(ctx, t.ResumeFailedChunks || t.RecheckFailed)
 		if err != nil {
-			return nil, errors.Trace(err)
+			return false, errors.Trace(err)
+		}
+		if source == nil && (t.ResumeFailedChunks || t.RecheckFailed) {
+			log.Info("all chunks in checkpoint are checked", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+			return true, nil
+		}
+		if source == nil {
+			fromCheckpoint = false
+		} else {
+			t.progress().SetTotal(int(total))
+		}
+	}
+
+	fromPTChecksum := false
+	if !fromCheckpoint {
+		log.Debug("don't have checkpoint info or config changed")
+
+		if t.UsePTChecksum {
+			chunks, fromPTChecksum, err = t.loadPTChecksumChunks(ctx)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			if fromPTChecksum && len(chunks) == 0 {
+				log.Info("all chunks are equal in pt-table-checksum's result", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+				return true, nil
+			}
+		}
+
+	}
+
+	if fromPTChecksum {
+		source = sliceChunkSource(chunks)
+		t.progress().SetTotal(len(chunks))
+	} else if !fromCheckpoint {
+		// the chunks are checked while the table is being split
+		var iter *ChunkIterator
+		if useTiDB && t.SplitByRegion {
+			iter, err = NewRegionChunkIterator(ctx, table, t.Fields, t.Range, t.ChunkSize, t.Collation)
+		} else {
+			iter, err = NewChunkIterator(ctx, table, t.Fields, t.Range, t.ChunkSize, t.Collation, useTiDB)
+		}
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		defer iter.Close()
+
+		firstChunk, err := iter.Next(ctx)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if firstChunk != nil {
+			source = t.iteratorChunkSource(firstChunk, iter)
+		}
+	}
+
+	if source == nil {
+		log.Warn("get 0 chunks, table is not checked", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+		return true, nil
+	}
+
+	if err = t.initDeleteLimit(ctx); err != nil {
+		return false, errors.Trace(err)
+	}
+
+	if err = t.preparePTChecksumTable(ctx, !fromCheckpoint && !fromPTChecksum); err != nil {
+		return false, errors.Trace(err)
+	}
+
+	t.progress().SetPhase(PhaseCheckData)
+
+	// the fix sqls are only generated by the last check
+	recheckTimes := t.recheckTimes()
+	t.skipFix = recheckTimes > 0
+	equal, chunks, err = t.checkChunksFrom(ctx, source, t.Sample < 100 || t.Tuning != nil, true, recheckTimes > 0)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	for i := 1; i <= recheckTimes && !equal; i++ {
+		t.skipFix = i < recheckTimes
+		equal = t.retryFailedChunks(ctx, chunks)
+	}
+	if ctx.Err() != nil {
+		return false, errors.Trace(ctx.Err())
+	}
+
+	if t.deleteLimitExceeded() {
+		return false, errors.Annotatef(ErrDeleteLimitExceeded, "table %s, limit %d", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table), t.deleteLimit)
+	}
+
+	return equal, nil
+}
+
+// chunkSource returns the chunks to be checked one by one, returns nil if there is no more chunk.
+type chunkSource func(ctx context.Context) (*ChunkRange, error)
+
+// sliceChunkSource returns a chunkSource of the chunks, returns nil if the chunks is empty.
+func sliceChunkSource(chunks []*ChunkRange) chunkSource {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	i := 0
+	return func(ctx context.Context) (*ChunkRange, error) {
+		if i >= len(chunks) {
+			return nil, nil
+		}
+		i++
+		return chunks[i-1], nil
+	}
+}
+
+// checkpointChunkSource returns a chunkSource of the chunks saved in checkpoint ordered by the chunk id, and the number
+// of the chunks. the chunks are loaded in batches on demand, the success and ignored chunks are skipped if skipChecked
+// is true. returns nil if there is no chunk to check.
+func (t *TableDiff) checkpointChunkSource(ctx context.Context, skipChecked bool) (chunkSource, int64, error) {
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+	total, successNum, _, ignoreNum, err := getChunkSummary(ctx1, t.checkpointConn(), t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table)
+	cancel1()
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, 0, errors.Trace(err)
+	}
+	if skipChecked {
+		log.Info("resume chunks from checkpoint", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Int64("total", total), zap.Int64("recheck", total-successNum-ignoreNum))
+		total -= successNum + ignoreNum
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	var (
+		batch  []*ChunkRange
+		lastID int64 = -1
+		done   bool
+	)
+	return func(ctx context.Context) (*ChunkRange, error) {
+		for {
+			for len(batch) != 0 {
+				chunk := batch[0]
+				batch = batch[1:]
+				if skipChecked && (chunk.State == successState || chunk.State == ignoreState) {
+					continue
+				}
+				return chunk, nil
+			}
+			if done {
+				return nil, nil
+			}
+
+			ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+			chunks, err := loadChunksAfter(ctx1, t.checkpointConn(), t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table, lastID, checkpointLoadBatchSize)
+			cancel1()
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if len(chunks) < checkpointLoadBatchSize {
+				done = true
+			}
+			if len(chunks) != 0 {
+				lastID = chunks[len(chunks)-1].ID
+			}
+			batch = chunks
+		}
+	}, total, nil
+}
+
+// iteratorChunkSource returns a chunkSource of the first chunk and the chunks generated by the iterator, every chunk is
+// saved in checkpoint when it's dispatched, and the progress's total grows with the dispatched chunks. the split is
+// marked done in the summary after the last chunk is saved, the checkpoint can't be used before it.
+func (t *TableDiff) iteratorChunkSource(firstChunk *ChunkRange, iter *ChunkIterator) chunkSource {
+	num := 0
+	return func(ctx context.Context) (*ChunkRange, error) {
+		ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+		defer cancel1()
+
+		chunk := firstChunk
+		if chunk != nil {
+			firstChunk = nil
+		} else {
+			var err error
+			chunk, err = iter.Next(ctx)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if chunk == nil {
+				return nil, errors.Trace(markSplitDone(ctx1, t.checkpointConn(), t.TargetTable.Schema, t.TargetTable.Table))
+			}
+		}
+
+		if err := saveChunk(ctx1, t.checkpointConn(), chunk.ID, t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table, "", chunk); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		num++
+		t.progress().SetTotal(num)
+		return chunk, nil
+	}
+}
+
+// checkChunks checks the chunks' data concurrently, returns false if any chunk is not equal or failed to check.
+func (t *TableDiff) checkChunks(ctx context.Context, chunks []*ChunkRange, filterBySample bool, updateProgress bool) bool {
+	source := sliceChunkSource(chunks)
+	if source == nil {
+		return true
+	}
+
+	equal, _, _ := t.checkChunksFrom(ctx, source, filterBySample, updateProgress, false)
+	return equal
+}
+
+// checkChunksFrom checks the chunks got from the source concurrently, returns false if any chunk is not equal or failed
+// to check, and the dispatched chunks if keep is true. stops dispatching and returns the error if the source fails.
+func (t *TableDiff) checkChunksFrom(ctx context.Context, source chunkSource, filterBySample bool, updateProgress bool, keep bool) (bool, []*ChunkRange, error) {
+	checkResultCh := make(chan bool, t.CheckThreadCount)
+	// the workers may be still checking chunks if the context is done, wait them before closing the results' channel
+	var workers sync.WaitGroup
+	defer func() {
+		workers.Wait()
+		close(checkResultCh)
+	}()
+
+	checkWorkerCh := make([]chan *ChunkRange, 0, t.CheckThreadCount)
+	for i := 0; i < t.CheckThreadCount; i++ {
+		checkWorkerCh = append(checkWorkerCh, make(chan *ChunkRange, 10))
+		workers.Add(1)
+		go func(chunks chan *ChunkRange) {
+			defer workers.Done()
+			t.checkChunksDataEqual(ctx, filterBySample, chunks, checkResultCh)
+		}(checkWorkerCh[i])
+	}
+
+	// the number of the dispatched chunks is sent after the dispatching is finished,
+	// dispatched and sourceErr are set before it.
+	dispatchedNumCh := make(chan int, 1)
+	var (
+		dispatched []*ChunkRange
+		sourceErr  error
+	)
+	go func() {
+		dispatchedNum := 0
+		defer func() {
+			for _, ch := range checkWorkerCh {
+				close(ch)
+			}
+			dispatchedNumCh <- dispatchedNum
+		}()
+
+		for {
+			if err := t.waitResume(ctx); err != nil {
+				return
+			}
+
+			chunk, err := source(ctx)
+			if err != nil {
+				log.Error("get chunk failed", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Error(err))
+				sourceErr = err
+				return
+			}
+			if chunk == nil {
+				return
+			}
+
+			select {
+			case checkWorkerCh[chunk.ID%int64(t.CheckThreadCount)] <- chunk:
+				dispatchedNum++
+				if keep {
+					dispatched = append(dispatched, chunk)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	checkedNum := 0
+	totalNum := -1
+	equal := true
+
+	for {
+		if checkedNum == totalNum {
+			return equal && sourceErr == nil, dispatched, errors.Trace(sourceErr)
+		}
+
+		select {
+		case eq := <-checkResultCh:
+			checkedNum++
+			if updateProgress {
+				t.progress().Increment(1)
+			}
+			if !eq {
+				equal = false
+			}
+		case totalNum = <-dispatchedNumCh:
+		case <-ctx.Done():
+			return false, nil, errors.Trace(ctx.Err())
+		}
+	}
+}
+
+// waitResume blocks until the diff is resumed if it's paused, and flushes the summary before waiting,
+// the checkpoint is saved after every chunk is checked.
+func (t *TableDiff) waitResume(ctx context.Context) error {
+	if t.Pauser == nil || !t.Pauser.Paused() {
+		return nil
+	}
+
+	log.Info("diff is paused", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+	t.flushSummary(ctx)
+	if err := t.Pauser.Wait(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("diff is resumed", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+
+	return nil
+}
+
+// waitReplication waits the target to apply the source's current position.
+func (t *TableDiff) waitReplication(ctx context.Context) error {
+	position, err := t.ReplicationWaiter.CapturePosition(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("wait target to apply source's position", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("position", position))
+	return errors.Trace(t.ReplicationWaiter.WaitPosition(ctx, position))
+}
+
+// recheckTimes returns the max times of re-checking the failed chunks.
+func (t *TableDiff) recheckTimes() int {
+	if t.ReplicationWaiter != nil {
+		return t.LagRecheckTimes
+	}
+	if t.RetryFailedChunks {
+		return 1
+	}
+	return 0
+}
+
+// retryFailedChunks re-checks the failed chunks after RetryDelay, and after the target applied the source's position
+// if ReplicationWaiter is set, returns the result of the retry.
+func (t *TableDiff) retryFailedChunks(ctx context.Context, chunks []*ChunkRange) bool {
+	failedChunks := make([]*ChunkRange, 0, 10)
+	for _, chunk := range chunks {
+		if chunk.State == failedState || chunk.State == errorState {
+			failedChunks = append(failedChunks, chunk)
+		}
+	}
+	if len(failedChunks) == 0 {
+		return false
+	}
+
+	log.Info("retry failed chunks", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Int("chunk num", len(failedChunks)), zap.Duration("delay", t.RetryDelay))
+	if t.RetryDelay > 0 {
+		select {
+		case <-time.After(t.RetryDelay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if t.ReplicationWaiter != nil {
+		// still re-check the chunks if wait failed, the differences are reported if the lag is too large
+		if err := t.waitReplication(ctx); err != nil {
+			log.Warn("wait replication failed", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Error(err))
+		}
+	}
+
+	t.progress().SetPhase(PhaseRetryChunks)
+	return t.checkChunks(ctx, failedChunks, false, false)
+}
+
+// initDeleteLimit calculates the limit of rows can be deleted in target table.
+func (t *TableDiff) initDeleteLimit(ctx context.Context) error {
+	atomic.StoreInt64(&t.deleteNum, 0)
+	t.deleteLimit = t.MaxDeleteRows
+
+	if t.MaxDeleteRatio <= 0 {
+		return nil
+	}
+
+	cnt, err := dbutil.GetRowCount(ctx, t.TargetTable.Conn, t.TargetTable.Schema, t.TargetTable.Table, t.TargetTable.mergeRange(t.Range))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ratioLimit := int64(t.MaxDeleteRatio * float64(cnt))
+	if t.deleteLimit == 0 || ratioLimit < t.deleteLimit {
+		t.deleteLimit = ratioLimit
+	}
+	log.Info("set delete limit", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Int64("row count", cnt), zap.Int64("limit", t.deleteLimit))
+
+	return nil
+}
+
+// addDelete records a delete sql will be generated, returns error if exceeds the limit.
+func (t *TableDiff) addDelete() error {
+	if t.deleteLimit <= 0 && t.MaxDeleteRatio <= 0 {
+		return nil
+	}
+
+	num := atomic.AddInt64(&t.deleteNum, 1)
+	if num > t.deleteLimit {
+		return errors.Annotatef(ErrDeleteLimitExceeded, "limit %d", t.deleteLimit)
+	}
+
+	return nil
+}
+
+func (t *TableDiff) deleteLimitExceeded() bool {
+	if t.deleteLimit <= 0 && t.MaxDeleteRatio <= 0 {
+		return false
+	}
+
+	return atomic.LoadInt64(&t.deleteNum) > t.deleteLimit
+}
+
+// loadPTChecksumChunks loads the chunks which are not equal in pt-table-checksum's result,
+// returns false if the table is not checked by pt-table-checksum.
+func (t *TableDiff) loadPTChecksumChunks(ctx context.Context) ([]*ChunkRange, bool, error) {
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+	defer cancel1()
+
+	checksums, err := LoadPTChecksums(ctx1, t.TargetTable.Conn, t.PTChecksumSchema, t.PTChecksumTable, t.TargetTable.Schema, t.TargetTable.Table)
+	if err != nil {
+		return nil, false, errors.Trace(err)
+	}
+	if len(checksums) == 0 {
+		log.Info("table is not checked by pt-table-checksum", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+		return nil, false, nil
+	}
+
+	chunks := make([]*ChunkRange, 0, len(checksums))
+	for _, checksum := range checksums {
+		if checksum.Equal() {
+			continue
+		}
+
+		chunk, err := ptChecksumToChunk(checksum, t.TargetTable.info)
+		if err != nil {
+			return nil, false, errors.Trace(err)
+		}
+
+		conditions, args := chunk.toString(t.Collation)
+		chunk.Where = fmt.Sprintf("(%s AND %s)", conditions, t.Range)
+		chunk.Args = args
+		chunk.State = notCheckedState
+
+		err = saveChunk(ctx1, t.checkpointConn(), chunk.ID, t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table, "", chunk)
+		if err != nil {
+			return nil, false, errors.Trace(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err = markSplitDone(ctx1, t.checkpointConn(), t.TargetTable.Schema, t.TargetTable.Table); err != nil {
+		return nil, false, errors.Trace(err)
+	}
+	log.Info("load chunks from pt-table-checksum's result", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)),
+		zap.Int("total", len(checksums)), zap.Int("not equal", len(chunks)))
+
+	return chunks, true, nil
+}
+
+// preparePTChecksumTable creates the checksums table, and cleans the table's old checksums if needed.
+func (t *TableDiff) preparePTChecksumTable(ctx context.Context, clean bool) error {
+	if len(t.PTChecksumTable) == 0 {
+		return nil
+	}
+
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+	defer cancel1()
+
+	err := CreatePTChecksumTable(ctx1, t.TargetTable.Conn, t.PTChecksumSchema, t.PTChecksumTable)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if clean {
+		return errors.Trace(CleanPTChecksum(ctx1, t.TargetTable.Conn, t.PTChecksumSchema, t.PTChecksumTable, t.TargetTable.Schema, t.TargetTable.Table))
+	}
+
+	return nil
+}
+
+// savePTChecksum saves the chunk's checksum into the checksums table, the source tables are regarded as master.
+func (t *TableDiff) savePTChecksum(ctx context.Context, chunk *ChunkRange, sourceChecksum, targetChecksum, sourceCount, targetCount int64, chunkTime time.Duration) {
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+	defer cancel1()
+
+	index, lower, upper := chunkToPTChecksum(chunk, t.TargetTable.info)
+	checksum := &PTChecksum{
+		DB:            t.TargetTable.Schema,
+		Tbl:           t.TargetTable.Table,
+		Chunk:         chunk.ID,
+		ChunkTime:     chunkTime.Seconds(),
+		ChunkIndex:    index,
+		LowerBoundary: lower,
+		UpperBoundary: upper,
+		ThisCrc:       fmt.Sprintf("%x", targetChecksum),
+		ThisCnt:       targetCount,
+		MasterCrc:     fmt.Sprintf("%x", sourceChecksum),
+		MasterCnt:     sourceCount,
+	}
+
+	err := SavePTChecksum(ctx1, t.TargetTable.Conn, t.PTChecksumSchema, t.PTChecksumTable, checksum)
+	if err != nil {
+		log.Warn("save pt checksum", zap.String("chunk", chunk.String()), zap.Error(err))
+	}
+}
+
+// checkpointConn returns the database saves the checkpoint and summary.
+func (t *TableDiff) checkpointConn() *sql.DB {
+	if t.CheckpointConn != nil {
+		return t.CheckpointConn
+	}
+	return t.TargetTable.Conn
+}
+
+// LoadCheckpoint do some prepare work before check data, like adjust config and create checkpoint table, and returns
+// all the chunks saved in checkpoint if the checkpoint can be used.
+func (t *TableDiff) LoadCheckpoint(ctx context.Context) ([]*ChunkRange, error) {
+	useCheckpoint, err := t.prepareCheckpoint(ctx)
+	if err != nil || !useCheckpoint {
+		return nil, errors.Trace(err)
+	}
+
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+	defer cancel1()
+	chunks, err := loadChunks(ctx1, t.checkpointConn(), t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table)
+	if err != nil {
+		log.Error("load chunks info", zap.Error(err))
+		return nil, errors.Trace(err)
+	}
+
+	return chunks, nil
+}
+
+// prepareCheckpoint creates the checkpoint table, and returns true if the chunks saved in checkpoint should be used,
+// otherwise the table's old checkpoint is cleaned.
+func (t *TableDiff) prepareCheckpoint(ctx context.Context) (bool, error) {
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+	defer cancel1()
+
+	err := t.setConfigHash()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	err = createCheckpointTable(ctx1, t.checkpointConn())
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	if t.UseCheckpoint || t.RecheckFailed {
+		state, ok, err := loadCheckpointState(ctx1, t.checkpointConn(), t.TargetTable.Schema, t.TargetTable.Table, t.configHash)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+
+		useCheckpoint := ok && state != successState && state != notCheckedState
+		if t.RecheckFailed && ok && state == successState {
+			// the chunks are all skipped by checkpointChunkSource
+			log.Info("table passed in the previous check, will not check again", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+			useCheckpoint = true
+		}
+
+		if useCheckpoint {
+			log.Info("use checkpoint to load chunks")
+			return true, nil
+		}
+	}
+
+	// clean old checkpoint infomation, and initial table summary
+	err = cleanCheckpoint(ctx1, t.checkpointConn(), t.TargetTable.Schema, t.TargetTable.Table)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	err = initTableSummary(ctx1, t.checkpointConn(), t.TargetTable.Schema, t.TargetTable.Table, t.configHash)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	return false, nil
+}
+
+// getSourceTableChecksum calculates the source tables' checksum and count concurrently, combines the checksums by XOR
+// and sums up the counts. returns the error of the first failed source table with its name.
+func (t *TableDiff) getSourceTableChecksum(ctx context.Context, chunk *ChunkRange) (int64, int64, error) {
+	checksum, count, err := t.getSourceTableChecksumByColumns(ctx, chunk, utils.SliceToMap(t.IgnoreColumns))
+	return checksum, count, errors.Trace(err)
+}
+
+// getSourceTableChecksumByColumns calculates the source tables' checksum and count like getSourceTableChecksum, the
+// columns in ignoreColumns are not calculated.
+func (t *TableDiff) getSourceTableChecksumByColumns(ctx context.Context, chunk *ChunkRange, ignoreColumns map[string]interface{}) (int64, int64, error) {
+	checksums := make([]int64, len(t.SourceTables))
+	counts := make([]int64, len(t.SourceTables))
+	errs := make([]error, len(t.SourceTables))
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, t.SourceChecksumConcurrency)
+	for i, sourceTable := range t.SourceTables {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(i int, sourceTable *TableInstance) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+			defer cancel1()
+			checksums[i], counts[i], errs[i] = sourceTable.rowSource().(ChecksumSource).GetChecksum(ctx1, chunk, t.TargetTable.info, ignoreColumns, t.checksumColumnExprs(sourceTable))
+		}(i, sourceTable)
+	}
+	wg.Wait()
+
+	var checksum, count int64
+	for i, sourceTable := range t.SourceTables {
+		if errs[i] != nil {
+			return -1, 0, errors.Annotatef(errs[i], "get checksum of %s in %s", dbutil.TableName(sourceTable.Schema, sourceTable.Table), sourceTable.InstanceID)
+		}
+
+		checksum ^= checksums[i]
+		count += counts[i]
+	}
+	return checksum, count, nil
+}
+
+func (t *TableDiff) checkChunksDataEqual(ctx context.Context, filterBySample bool, chunks chan *ChunkRange, resultCh chan bool) {
+	// sendResult returns false if the context is done, the results are not received any more
+	sendResult := func(eq bool) bool {
+		select {
+		case resultCh <- eq:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return
+			}
+			if chunk.State == successState || chunk.State == ignoreState {
+				if !sendResult(true) {
+					return
+				}
+				continue
+			}
+			if t.deleteLimitExceeded() {
+				// already generated too many delete sqls, don't need check the remain chunks
+				if !sendResult(false) {
+					return
+				}
+				continue
+			}
+			eq, err := t.checkChunkWithSplit(ctx, filterBySample, chunk, 0)
+			if err != nil {
+				log.Error("check chunk data equal failed", zap.String("chunk", chunk.String()), zap.Error(err))
+			} else if !eq {
+				log.Warn("check chunk data not equal", zap.String("chunk", chunk.String()))
+			}
+			if !sendResult(eq && err == nil) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// isQueryTimeout returns true if the query exceeds the max execution time, or the query's context is timeout while the
+// caller's context is not done.
+func isQueryTimeout(ctx context.Context, err error) bool {
+	if dbutil.IsMaxExecutionTimeExceeded(err) {
+		return true
+	}
+	return errors.Cause(err) == context.DeadlineExceeded && ctx.Err() == nil
+}
+
+// checkChunkDataEqual checks the chunk without splitting it.
+func (t *TableDiff) checkChunkDataEqual(ctx context.Context, filterBySample bool, chunk *ChunkRange) (bool, error) {
+	return t.checkChunkWithSplit(ctx, filterBySample, chunk, t.TimeoutSplitTimes)
+}
+
+// checkChunkWithSplit checks the chunk, and saves its state in checkpoint and reports its result to Observer and
+// ChunkResultHandler. if the chunk's query exceeds the max execution time or the timeout, the chunk is split to smaller
+// chunks and checked again, up to TimeoutSplitTimes - splitTimes times, so the hot ranges don't fail the check.
+func (t *TableDiff) checkChunkWithSplit(ctx context.Context, filterBySample bool, chunk *ChunkRange, splitTimes int) (equal bool, err error) {
+	beginTime := time.Now()
+	result := &ChunkResult{
+		Schema: t.TargetTable.Schema,
+		Table:  t.TargetTable.Table,
+		Chunk:  chunk,
+	}
+
+	update := func() {
+		ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+		defer cancel1()
+
+		err1 := saveChunk(ctx1, t.checkpointConn(), chunk.ID, t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table, "", chunk)
+		if err1 != nil {
+			log.Warn("update chunk info", zap.Error(err1))
+		}
+	}
+
+	defer func() {
+		if chunk.State != ignoreState {
+			if err != nil {
+				chunk.State = errorState
+			} else if equal {
+				chunk.State = successState
+			} else {
+				chunk.State = failedState
+			}
+			t.observer().OnChunkResult(t, chunk, equal, err)
+			if chunk.State == failedState {
+				t.exportChunkArtifact(chunk, result)
+			}
+		}
+		update()
+
+		if t.ChunkResultHandler != nil {
+			result.State = chunk.State
+			result.Equal = equal
+			result.Err = err
+			result.Duration = time.Since(beginTime)
+			t.ChunkResultHandler(ctx, result)
+		}
+	}()
+
+	// the config hash is used as seed, so different config samples different chunks, and the chunks loaded from
+	// checkpoint are sampled in the same way as the last run.
+	if filterBySample && !chunk.sampled(t.configHash, t.samplePercent()) {
+		chunk.State = ignoreState
+		return true, nil
+	}
+
+	return t.compareChunkWithSplit(ctx, chunk, result, splitTimes, func() {
+		chunk.State = checkingState
+		update()
+		t.observer().OnChunkStart(t, chunk)
+	})
+}
+
+// compareChunkWithSplit compares the chunk, and splits it to smaller chunks to compare if the chunk's query exceeds the
+// max execution time or the timeout. the smaller chunks share the chunk's id, so they are neither saved in checkpoint
+// nor reported, only their row counts and different rows are merged into the chunk's result.
+func (t *TableDiff) compareChunkWithSplit(ctx context.Context, chunk *ChunkRange, result *ChunkResult, splitTimes int, start func()) (bool, error) {
+	equal, err := t.compareChunk(ctx, chunk, result, start)
+	if err == nil || splitTimes >= t.TimeoutSplitTimes || !isQueryTimeout(ctx, err) {
+		return equal, err
+	}
+
+	subChunks, err1 := splitChunk(t.TargetTable, chunk, t.Fields, t.Range, timeoutSplitCount, t.Collation)
+	if err1 != nil || len(subChunks) <= 1 {
+		log.Warn("chunk exceeds the max execution time and can't be split", zap.String("chunk", chunk.String()), zap.Error(err1))
+		return equal, err
+	}
+	log.Warn("chunk exceeds the max execution time, split it to smaller chunks", zap.String("chunk", chunk.String()), zap.Int("chunk num", len(subChunks)))
+
+	// the chunk's partial result before the timeout is replaced by the smaller chunks' results
+	*result = ChunkResult{Schema: result.Schema, Table: result.Table, Chunk: chunk}
+	equal = true
+	for _, subChunk := range subChunks {
+		subResult := &ChunkResult{Schema: result.Schema, Table: result.Table, Chunk: subChunk}
+		eq, err := t.compareChunkWithSplit(ctx, subChunk, subResult, splitTimes+1, nil)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		result.merge(subResult)
+		equal = equal && eq
+	}
+
+	return equal, nil
+}
+
+// compareChunk compares the chunk by the row count, aggregates, checksum or rows by the config, start is called after
+// the limiters are acquired if it's not nil.
+func (t *TableDiff) compareChunk(ctx context.Context, chunk *ChunkRange, result *ChunkResult, start func()) (equal bool, err error) {
+	inFlightID := t.InFlight.start(t.TargetTable.Schema, t.TargetTable.Table, chunk)
+	defer t.InFlight.finish(inFlightID)
+
+	// the global limiter is always acquired first to avoid deadlock
+	if t.GlobalLimiter != nil {
+		if err = t.GlobalLimiter.Acquire(ctx); err != nil {
+			return false, errors.Trace(err)
+		}
+		defer t.GlobalLimiter.Release()
+	}
+	release, err := acquireLimiters(ctx, append([]*TableInstance{t.TargetTable}, t.SourceTables...))
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer release()
+
+	if start != nil {
+		start()
+	}
+
+	countEqual := true
+	if t.RowCountCheck {
+		t.InFlight.setState(inFlightID, InFlightCounting)
+		if err = t.waitQueries(ctx); err != nil {
+			return false, errors.Trace(err)
+		}
+		countEqual, err = t.compareRowCount(ctx, chunk, result)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+
+	if !countEqual {
+		// the chunk is not equal, skip the checksum
+		if t.OnlyUseChecksum {
+			return false, nil
+		}
+	} else if len(t.AggregateColumns) != 0 {
+		// compare the aggregates instead of the checksum
+		t.InFlight.setState(inFlightID, InFlightAggregate)
+		if err = t.waitQueries(ctx); err != nil {
+			return false, errors.Trace(err)
+		}
+		equal, err = t.compareAggregates(ctx, chunk, result)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if equal {
+			return true, nil
+		}
+		if t.OnlyUseChecksum {
+			return false, nil
+		}
+	} else if t.UseChecksum {
+		// first check the checksum is equal or not
+		t.InFlight.setState(inFlightID, InFlightChecksum)
+		if err = t.waitQueries(ctx); err != nil {
+			return false, errors.Trace(err)
+		}
+		equal, err = t.compareChecksum(ctx, chunk, result)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if equal {
+			return true, nil
+		}
+		if t.DoubleReadDelay > 0 {
+			var confirmed bool
+			confirmed, err = t.confirmByDoubleRead(ctx, chunk, result)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			if !confirmed {
+				return true, nil
+			}
+		}
+	}
+
+	if t.UseChecksum && t.OnlyUseChecksum {
+		return false, nil
+	}
+
+	// if checksum is not equal or don't need compare checksum, compare the data
+	log.Info("select data and then check data", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk))
+
+	t.InFlight.setState(inFlightID, InFlightComparing)
+	if err = t.waitQueries(ctx); err != nil {
+		return false, errors.Trace(err)
+	}
+	equal, err = t.compareRows(ctx, chunk, result)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if !equal && !t.skipFix && result.DifferentRows > 0 {
+		t.sendChunkComment(chunk, result)
+	}
+
+	return equal, nil
+}
+
+// samplePercent returns the sampling check percent, the tuned sample has higher priority.
+func (t *TableDiff) samplePercent() int {
+	if t.Tuning != nil {
+		if sample := t.Tuning.Sample(); sample > 0 {
+			return sample
+		}
+	}
+	return t.Sample
+}
+
+// waitQueries blocks until the queries of the chunk in every table instance can be sent under the tuned qps limit.
+func (t *TableDiff) waitQueries(ctx context.Context) error {
+	if t.Tuning == nil {
+		return nil
+	}
+	return errors.Trace(t.Tuning.Wait(ctx, len(t.SourceTables)+1))
+}
+
+func (t *TableDiff) compareChecksum(ctx context.Context, chunk *ChunkRange, result *ChunkResult) (bool, error) {
+	beginTime := time.Now()
+
+	// first check the checksum is equal or not
+	var (
+		sourceChecksum, sourceCount int64
+		targetChecksum, targetCount int64
+		err                         error
+	)
+	if len(t.columnGroups) == 0 {
+		sourceChecksum, targetChecksum, sourceCount, targetCount, err = t.getChecksumByColumns(ctx, chunk, utils.SliceToMap(t.IgnoreColumns))
+	} else {
+		sourceChecksum, targetChecksum, sourceCount, targetCount, err = t.compareColumnGroupsChecksum(ctx, chunk, result)
+	}
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	if len(t.PTChecksumTable) != 0 {
+		t.savePTChecksum(ctx, chunk, sourceChecksum, targetChecksum, sourceCount, targetCount, time.Since(beginTime))
+	}
+	result.ChecksumCompared = true
+	result.SourceChecksum = sourceChecksum
+	result.TargetChecksum = targetChecksum
+	result.RowCountCompared = true
+	result.SourceRowCount = sourceCount
+	result.TargetRowCount = targetCount
+
+	// the checksum may collide when some rows are duplicated and others are missing, so the count should be equal too
+	// the combined checksums of the column groups may collide even if some groups are different
+	if sourceChecksum == targetChecksum && sourceCount == targetCount && len(result.MismatchedColumns) == 0 {
+		log.Info("checksum is equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Int64("checksum", sourceChecksum), zap.Int64("count", sourceCount))
+		return true, nil
+	}
+
+	log.Warn("checksum is not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Int64("source checksum", sourceChecksum), zap.Int64("target checksum", targetChecksum), zap.Int64("source count", sourceCount), zap.Int64("target count", targetCount))
+
+	return false, nil
+}
+
+// getChecksumByColumns returns the source's and target's checksum and count of the chunk, the columns in ignoreColumns
+// are not calculated.
+func (t *TableDiff) getChecksumByColumns(ctx context.Context, chunk *ChunkRange, ignoreColumns map[string]interface{}) (sourceChecksum, targetChecksum, sourceCount, targetCount int64, err error) {
+	sourceChecksum, sourceCount, err = t.getSourceTableChecksumByColumns(ctx, chunk, ignoreColumns)
+	if err != nil {
+		return 0, 0, 0, 0, errors.Trace(err)
+	}
+
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+	defer cancel1()
+	targetChecksum, targetCount, err = t.TargetTable.rowSource().(ChecksumSource).GetChecksum(ctx1, chunk, t.TargetTable.info, ignoreColumns, t.checksumColumnExprs(t.TargetTable))
+	if err != nil {
+		return 0, 0, 0, 0, errors.Trace(err)
+	}
+
+	return sourceChecksum, targetChecksum, sourceCount, targetCount, nil
+}
+
+func (t *TableDiff) compareRows(ctx context.Context, chunk *ChunkRange, result *ChunkResult) (bool, error) {
+	ignoreCloumns := utils.SliceToMap(t.IgnoreColumns)
+	if len(result.MismatchedColumns) != 0 {
+		// only the columns of the mismatched column groups are different
+		ignoreCloumns = t.columnGroupsIgnoreColumns(result.MismatchedColumns)
+	}
+	selectIgnoreColumns := ignoreCloumns
+	if len(t.SoftDeleteColumn) != 0 {
+		// select the soft delete column to filter the deleted rows, even if it is ignored
+		selectIgnoreColumns = make(map[string]interface{}, len(ignoreCloumns))
+		for column := range ignoreCloumns {
+			selectIgnoreColumns[column] = struct{}{}
+		}
+		delete(selectIgnoreColumns, t.SoftDeleteColumn)
+	}
+
+	// reserve the memory of the chunk's rows by the average bytes of the compared chunks, waits if the hard limit is reached
+	reservation, err := t.MemoryLimiter.reserve(ctx, t.estimateChunkBytes())
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer reservation.release()
+
+	targetRows, orderKeyCols, err := t.bufferChunkRows(ctx, t.TargetTable, chunk, reservation, selectIgnoreColumns, ignoreCloumns)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer targetRows.close()
+
+	if _, ok := ignoreCloumns[t.SoftDeleteColumn]; ok && len(nullableUniqueKey(t.TargetTable.info)) != 0 {
+		// the soft delete column orders the rows with NULL in the nullable unique key, but it's removed from the rows
+		// after filtering the deleted rows. the rows left usually have the same value in it.
+		orderKeyCols = removeColumn(orderKeyCols, t.SoftDeleteColumn)
+	}
+
+	// judge rows have all order keys to avoid panic
+	if targetRows.first != nil && !rowContainsCols(targetRows.first, orderKeyCols) {
+		return false, errors.Errorf("%s.%s.%s's data don't contain all keys %v", t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table, orderKeyCols)
+	}
+
+	sourceRows := make([]*rowBuffer, 0, len(t.SourceTables))
+	defer func() {
+		for _, rows := range sourceRows {
+			rows.close()
+		}
+	}()
+	for _, sourceTable := range t.SourceTables {
+		rows, _, err := t.bufferChunkRows(ctx, sourceTable, chunk, reservation, selectIgnoreColumns, ignoreCloumns)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		sourceRows = append(sourceRows, rows)
+
+		// judge rows have all order keys to avoid panic
+		if rows.first != nil && !rowContainsCols(rows.first, orderKeyCols) {
+			return false, errors.Errorf("%s.%s.%s's data don't contain all keys %v", sourceTable.InstanceID, sourceTable.Schema, sourceTable.Table, orderKeyCols)
+		}
+	}
+
+	sourceIter, err := newMergedRowIterator(sourceRows, t.SourceTables, orderKeyCols)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	targetIter, err := targetRows.iter()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	result.RowsCompared = true
+	for _, rows := range sourceRows {
+		result.SourceRows += rows.count
+		result.SourceBytes += rows.bytes
+	}
+	result.TargetRows = targetRows.count
+	result.TargetBytes = targetRows.bytes
+	atomic.AddInt64(&t.comparedChunks, 1)
+	atomic.AddInt64(&t.comparedBytes, result.SourceBytes+result.TargetBytes)
+
+	// the rows are read from the buffers one by one, so the spilled rows are not loaded into memory again. the next rows
+	// are read ahead to find the duplicated keys.
+	var (
+		equal            = true
+		sourceData       map[string]*dbutil.ColumnData
+		sourceTable      *TableInstance
+		targetData       map[string]*dbutil.ColumnData
+		sourceAhead      map[string]*dbutil.ColumnData
+		sourceAheadTable *TableInstance
+		targetAhead      map[string]*dbutil.ColumnData
+	)
+	nextSource := func() (err error) {
+		sourceData, sourceTable = sourceAhead, sourceAheadTable
+		sourceAhead, sourceAheadTable, err = sourceIter.next()
+		return errors.Trace(err)
+	}
+	nextTarget := func() (err error) {
+		targetData = targetAhead
+		targetAhead, err = targetIter.next()
+		return errors.Trace(err)
+	}
+	if sourceAhead, sourceAheadTable, err = sourceIter.next(); err != nil {
+		return false, errors.Trace(err)
+	}
+	if targetAhead, err = targetIter.next(); err != nil {
+		return false, errors.Trace(err)
+	}
+	if err = nextSource(); err != nil {
+		return false, errors.Trace(err)
+	}
+	if err = nextTarget(); err != nil {
+		return false, errors.Trace(err)
+	}
+
+	// the rows with NULL in the nullable unique key may be duplicated, they are ordered by all the columns, and the
+	// identical rows are compared by the counts.
+	nullableKeyCols := nullableUniqueKey(t.TargetTable.info)
+	// the different rows are located by the unique key, the rows with NULL in the key are fixed by fixDuplicatedRows
+	keyCols := orderKeyCols
+	if len(nullableKeyCols) != 0 {
+		keyCols = nullableKeyCols
+	}
+	nextDuplicatedRows := func() (*duplicatedRows, error) {
+		row := sourceData
+		if row == nil {
+			row = targetData
+		} else if targetData != nil {
+			cmp, err := compareKeys(sourceData, targetData, orderKeyCols)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if cmp > 0 {
+				row = targetData
+			}
+		}
+		if !hasNullKey(row, nullableKeyCols) {
+			return nil, nil
+		}
+
+		rows := &duplicatedRows{}
+		for sourceData != nil {
+			cmp, err := compareKeys(sourceData, row, orderKeyCols)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if cmp != 0 {
+				break
+			}
+			rows.addSource(sourceTable, sourceData)
+			if err := nextSource(); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		for targetData != nil {
+			cmp, err := compareKeys(targetData, row, orderKeyCols)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if cmp != 0 {
+				break
+			}
+			rows.addTarget(targetData)
+			if err := nextTarget(); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		return rows, nil
+	}
+
+	// the unique key may be duplicated if the uniqueness is not enforced, all the rows of the duplicated key are reported
+	uniqueKey := hasUniqueKey(t.TargetTable.info)
+	nextDuplicatedKeyRows := func() (*duplicatedKeyRows, error) {
+		row := sourceData
+		if row == nil {
+			row = targetData
+		} else if targetData != nil {
+			cmp, err := compareKeys(sourceData, targetData, orderKeyCols)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if cmp > 0 {
+				row = targetData
+			}
+		}
+		if hasNullKey(row, nullableKeyCols) {
+			return nil, nil
+		}
+
+		// the rows are ordered by the key, so the rows of the duplicated key are adjacent
+		isDuplicated := func(data, ahead map[string]*dbutil.ColumnData) (bool, error) {
+			if data == nil || ahead == nil {
+				return false, nil
+			}
+			cmp1, err := compareKeys(data, row, keyCols)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			cmp2, err := compareKeys(ahead, row, keyCols)
+			return cmp1 == 0 && cmp2 == 0, errors.Trace(err)
+		}
+		sourceDuplicated, err := isDuplicated(sourceData, sourceAhead)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		targetDuplicated, err := isDuplicated(targetData, targetAhead)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !sourceDuplicated && !targetDuplicated {
+			return nil, nil
+		}
+
+		rows := &duplicatedKeyRows{}
+		for sourceData != nil {
+			cmp, err := compareKeys(sourceData, row, keyCols)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if cmp != 0 {
+				break
+			}
+			rows.addSource(sourceTable, sourceData)
+			if err := nextSource(); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		for targetData != nil {
+			cmp, err := compareKeys(targetData, row, keyCols)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if cmp != 0 {
+				break
+			}
+			rows.addTarget(targetData)
+			if err := nextTarget(); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		return rows, nil
+	}
+
+	for sourceData != nil || targetData != nil {
+		if t.chunkDiffTruncated(chunk, result) {
+			break
+		}
+
+		if len(nullableKeyCols) != 0 {
+			rows, err := nextDuplicatedRows()
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			if rows != nil {
+				if num := rows.differentRows(); num != 0 {
+					equal = false
+					result.DifferentRows += num
+					if err = t.fixDuplicatedRows(ctx, rows, orderKeyCols); err != nil {
+						return false, errors.Trace(err)
+					}
+				}
+				continue
+			}
+		}
+
+		if uniqueKey {
+			rows, err := nextDuplicatedKeyRows()
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			if rows != nil {
+				equal = false
+				result.DuplicatedKeys++
+				result.DifferentRows += len(rows.sourceRows) + len(rows.targetRows)
+				if err = t.reportDuplicatedKeyRows(ctx, chunk, rows, keyCols); err != nil {
+					return false, errors.Trace(err)
+				}
+				continue
+			}
+		}
+
+		var cmp int32
+		switch {
+		case sourceData == nil:
+			// all the rest target's data should be deleted
+			cmp = 1
+		case targetData == nil:
+			// target lack some data, should insert them
+			cmp = -1
+		default:
+			var eq bool
+			eq, cmp, err = compareData(sourceData, targetData, orderKeyCols, t.TargetTable.info.Columns, t.ColumnComparators, t.redact)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			if eq {
+				if err = nextSource(); err != nil {
+					return false, errors.Trace(err)
+				}
+				if err = nextTarget(); err != nil {
+					return false, errors.Trace(err)
+				}
+				continue
+			}
+			if cmp != 0 && len(nullableKeyCols) != 0 {
+				// the rows are the same row if they have the same not NULL unique key
+				var keyCmp int
+				if keyCmp, err = compareKeys(sourceData, targetData, nullableKeyCols); err != nil {
+					return false, errors.Trace(err)
+				}
+				if keyCmp == 0 {
+					cmp = 0
+				}
+			}
+		}
+
+		equal = false
+		result.DifferentRows++
+		switch cmp {
+		case 1:
+			// delete
+			t.exportRowDiff(nil, nil, targetData, keyCols)
+			if targetData, err = t.rawRowData(ctx, t.TargetTable, targetData, keyCols); err != nil {
+				return false, errors.Trace(err)
+			}
+			if err = t.fixTargetExtraRow(targetData, keyCols); err != nil {
+				return false, errors.Trace(err)
+			}
+			err = nextTarget()
+		case -1:
+			// insert
+			t.exportRowDiff(sourceTable, sourceData, nil, keyCols)
+			if sourceData, err = t.rawRowData(ctx, sourceTable, sourceData, keyCols); err != nil {
+				return false, errors.Trace(err)
+			}
+			if err = t.fixSourceExtraRow(sourceData, sourceTable, keyCols); err != nil {
+				return false, errors.Trace(err)
+			}
+			err = nextSource()
+		case 0:
+			// update
+			t.exportRowDiff(sourceTable, sourceData, targetData, keyCols)
+			if sourceData, err = t.rawRowData(ctx, sourceTable, sourceData, keyCols); err != nil {
+				return false, errors.Trace(err)
+			}
+			if targetData, err = t.rawRowData(ctx, t.TargetTable, targetData, keyCols); err != nil {
+				return false, errors.Trace(err)
+			}
+			t.fixDifferentRow(sourceData, sourceTable, targetData, keyCols)
+			if err = nextSource(); err == nil {
+				err = nextTarget()
+			}
+		}
+		if err != nil {
+			return false, errors.Trace(err)
 		}
+	}
 
-		if useCheckpoint {
-			log.Info("use checkpoint to load chunks")
-			chunks, err := loadChunks(ctx1, t.TargetTable.Conn, t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table)
-			if err != nil {
-				log.Error("load chunks info", zap.Error(err))
-				return nil, errors.Trace(err)
-			}
+	return equal, nil
+}
 
-			return chunks, nil
+// bufferChunkRows reads the chunk's rows of the table instance into a rowBuffer, the soft deleted rows are filtered
+// out, and returns the order keys. the rows are spilled to the temporary file if the MemoryLimiter's budget is exceeded.
+func (t *TableDiff) bufferChunkRows(ctx context.Context, table *TableInstance, chunk *ChunkRange, reservation *memoryReservation, selectIgnoreColumns, ignoreColumns map[string]interface{}) (*rowBuffer, []*model.ColumnInfo, error) {
+	buffer := newRowBuffer(t.MemoryLimiter)
+	buffer.reservation = reservation
+	add := func(row map[string]*dbutil.ColumnData) error {
+		if !t.keepRow(row, ignoreColumns) {
+			return nil
 		}
+		return errors.Trace(buffer.add(row))
 	}
 
-	// clean old checkpoint infomation, and initial table summary
-	err = cleanCheckpoint(ctx1, t.TargetTable.Conn, t.TargetTable.Schema, t.TargetTable.Table)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutRowFetch)
+	defer cancel1()
 
-	err = initTableSummary(ctx1, t.TargetTable.Conn, t.TargetTable.Schema, t.TargetTable.Table, t.configHash)
+	var (
+		orderKeyCols []*model.ColumnInfo
+		err          error
+	)
+	if streamer, ok := table.rowSource().(rowStreamer); ok {
+		orderKeyCols, err = streamer.streamRows(ctx1, chunk, table.info, selectIgnoreColumns, table.collation, add)
+	} else {
+		var rows []map[string]*dbutil.ColumnData
+		rows, orderKeyCols, err = table.rowSource().GetRows(ctx1, chunk, table.info, selectIgnoreColumns, table.collation)
+		for i := 0; i < len(rows) && err == nil; i++ {
+			err = add(rows[i])
+		}
+	}
 	if err != nil {
-		return nil, errors.Trace(err)
+		buffer.close()
+		return nil, nil, errors.Trace(err)
 	}
 
-	return nil, nil
+	return buffer, orderKeyCols, nil
 }
 
-func (t *TableDiff) getSourceTableChecksum(ctx context.Context, chunk *ChunkRange) (int64, error) {
-	var checksum int64
-
-	for _, sourceTable := range t.SourceTables {
-		checksumTmp, err := dbutil.GetCRC32Checksum(ctx, sourceTable.Conn, sourceTable.Schema, sourceTable.Table, t.TargetTable.info, chunk.Where, utils.StringsToInterfaces(chunk.Args), utils.SliceToMap(t.IgnoreColumns))
-		if err != nil {
-			return -1, errors.Trace(err)
-		}
+// chunkDiffTruncated returns true if the chunk's different rows reach MaxChunkDiffRows, the rest rows of the chunk
+// should not be compared.
+func (t *TableDiff) chunkDiffTruncated(chunk *ChunkRange, result *ChunkResult) bool {
+	if t.MaxChunkDiffRows <= 0 || result.DifferentRows < t.MaxChunkDiffRows {
+		return false
+	}
 
-		checksum ^= checksumTmp
+	if !result.DiffTruncated {
+		result.DiffTruncated = true
+		log.Warn("too many different rows in chunk, stop comparing the rest rows", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)),
+			zap.String("chunk", chunk.Where), t.redact.chunkArgs(chunk), zap.String("state", fmt.Sprintf("truncated at %d diffs", result.DifferentRows)))
 	}
-	return checksum, nil
+	return true
 }
 
-func (t *TableDiff) checkChunksDataEqual(ctx context.Context, filterByRand bool, chunks chan *ChunkRange, resultCh chan bool) {
-	for {
-		select {
-		case chunk, ok := <-chunks:
-			if !ok {
-				return
-			}
-			if chunk.State == successState || chunk.State == ignoreState {
-				resultCh <- true
-				continue
-			}
-			eq, err := t.checkChunkDataEqual(ctx, filterByRand, chunk)
-			if err != nil {
-				log.Error("check chunk data equal failed", zap.String("chunk", chunk.String()), zap.Error(err))
-				resultCh <- false
-			} else {
-				if !eq {
-					log.Warn("check chunk data not equal", zap.String("chunk", chunk.String()))
-				}
-				resultCh <- eq
-			}
-		case <-ctx.Done():
-			return
-		}
+// keepRow returns false if the row is soft deleted, and removes the soft delete column from the row if it is ignored.
+func (t *TableDiff) keepRow(row map[string]*dbutil.ColumnData, ignoreColumns map[string]interface{}) bool {
+	if len(t.SoftDeleteColumn) == 0 {
+		return true
+	}
+	if isSoftDeleted(row[t.SoftDeleteColumn], t.SoftDeleteValues) {
+		return false
 	}
+	if _, ignored := ignoreColumns[t.SoftDeleteColumn]; ignored {
+		delete(row, t.SoftDeleteColumn)
+	}
+	return true
 }
 
-func (t *TableDiff) checkChunkDataEqual(ctx context.Context, filterByRand bool, chunk *ChunkRange) (equal bool, err error) {
-	update := func() {
-		ctx1, cancel1 := context.WithTimeout(ctx, dbutil.DefaultTimeout)
-		defer cancel1()
-
-		err1 := saveChunk(ctx1, t.TargetTable.Conn, chunk.ID, t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table, "", chunk)
-		if err1 != nil {
-			log.Warn("update chunk info", zap.Error(err1))
-		}
+// isSoftDeleted returns true if the soft delete column's data means deleted, data is nil if the instance doesn't have the column.
+func isSoftDeleted(data *dbutil.ColumnData, deletedValues []string) bool {
+	if data == nil || data.IsNull {
+		return false
+	}
+	if len(deletedValues) == 0 {
+		return true
 	}
 
-	defer func() {
-		if chunk.State != ignoreState {
-			if err != nil {
-				chunk.State = errorState
-			} else if equal {
-				chunk.State = successState
-			} else {
-				chunk.State = failedState
-			}
-		}
-		update()
-	}()
-
-	if filterByRand {
-		rand.Seed(time.Now().UnixNano())
-		r := rand.Intn(100)
-		if r > t.Sample {
-			chunk.State = ignoreState
-			return true, nil
+	for _, value := range deletedValues {
+		if string(data.Data) == value {
+			return true
 		}
 	}
+	return false
+}
 
-	chunk.State = checkingState
-	update()
+// exportRowDiff exports the different row by RowDiffExporter and notifies the Observer,
+// source and sourceData is nil if the row only exists in target table.
+func (t *TableDiff) exportRowDiff(source *TableInstance, sourceData, targetData map[string]*dbutil.ColumnData, orderKeyCols []*model.ColumnInfo) {
+	t.exportRow(source, sourceData, targetData, orderKeyCols, "")
+}
 
-	if t.UseChecksum {
-		// first check the checksum is equal or not
-		equal, err = t.compareChecksum(ctx, chunk)
-		if err != nil {
-			return false, errors.Trace(err)
-		}
-		if equal {
-			return true, nil
-		}
+// exportRow notifies the observer and exports the row, tp overrides the row's type if it's not empty.
+func (t *TableDiff) exportRow(source *TableInstance, sourceData, targetData map[string]*dbutil.ColumnData, orderKeyCols []*model.ColumnInfo, tp string) {
+	_, isNoop := t.observer().(noopObserver)
+	if t.skipFix || (t.RowDiffExporter == nil && isNoop) {
+		return
 	}
 
-	if t.UseChecksum && t.OnlyUseChecksum {
-		return false, nil
+	var sourceInstance string
+	if source != nil {
+		sourceInstance = source.InstanceID
 	}
-
-	// if checksum is not equal or don't need compare checksum, compare the data
-	log.Info("select data and then check data", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), zap.Reflect("args", chunk.Args))
-
-	equal, err = t.compareRows(ctx, chunk)
-	if err != nil {
-		return false, errors.Trace(err)
+	row := newRowDiff(t.TargetTable.Schema, t.TargetTable.Table, sourceInstance, sourceData, targetData, orderKeyCols, t.TargetTable.info.Columns, t.ColumnComparators, t.redact)
+	if tp != "" {
+		row.Type = tp
 	}
+	t.observer().OnRowDifference(t, row)
 
-	return equal, nil
+	if t.RowDiffExporter == nil {
+		return
+	}
+	if err := t.RowDiffExporter.Export(row); err != nil {
+		log.Error("export different row failed", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("key", row.Key), zap.Error(err))
+	}
 }
 
-func (t *TableDiff) compareChecksum(ctx context.Context, chunk *ChunkRange) (bool, error) {
-	// first check the checksum is equal or not
-	sourceChecksum, err := t.getSourceTableChecksum(ctx, chunk)
-	if err != nil {
-		return false, errors.Trace(err)
+// fixTargetExtraRow generates fix sql for the row only exists in target table.
+func (t *TableDiff) fixTargetExtraRow(data map[string]*dbutil.ColumnData, orderKeyCols []*model.ColumnInfo) error {
+	if t.skipFix {
+		return nil
 	}
 
-	targetChecksum, err := dbutil.GetCRC32Checksum(ctx, t.TargetTable.Conn, t.TargetTable.Schema, t.TargetTable.Table, t.TargetTable.info, chunk.Where, utils.StringsToInterfaces(chunk.Args), utils.SliceToMap(t.IgnoreColumns))
-	if err != nil {
-		return false, errors.Trace(err)
-	}
-	if sourceChecksum == targetChecksum {
-		log.Info("checksum is equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), zap.Reflect("args", chunk.Args), zap.Int64("checksum", sourceChecksum))
-		return true, nil
+	if !t.ReverseFixSQL {
+		if err := t.addDelete(); err != nil {
+			return errors.Trace(err)
+		}
+		t.sendFixSQL("[delete]", func(dialect Dialect) string {
+			return generateDML(dialect, "delete", data, orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
+		})
+		return nil
 	}
 
-	log.Warn("checksum is not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), zap.Reflect("args", chunk.Args), zap.Int64("source checksum", sourceChecksum), zap.Int64("target checksum", targetChecksum))
-
-	return false, nil
+	// can't know which shard the row belongs to, the sharding tables are rejected in getTableInfo
+	if len(t.SourceTables) != 1 {
+		return errors.NotSupportedf("reverse fix sql for the sharding tables of %s", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table))
+	}
+	t.sendFixSQL("[insert]", func(dialect Dialect) string {
+		return t.sourceFixSQL(dialect, t.insertType(), data, t.SourceTables[0], orderKeyCols)
+	})
+	return nil
 }
 
-func (t *TableDiff) compareRows(ctx context.Context, chunk *ChunkRange) (bool, error) {
-	sourceRows := make(map[string][]map[string]*dbutil.ColumnData)
-	args := utils.StringsToInterfaces(chunk.Args)
-	ignoreCloumns := utils.SliceToMap(t.IgnoreColumns)
+// fixSourceExtraRow generates fix sql for the row only exists in source table.
+func (t *TableDiff) fixSourceExtraRow(data map[string]*dbutil.ColumnData, source *TableInstance, orderKeyCols []*model.ColumnInfo) error {
+	if t.skipFix {
+		return nil
+	}
 
-	targetRows, orderKeyCols, err := getChunkRows(ctx, t.TargetTable.Conn, t.TargetTable.Schema, t.TargetTable.Table, t.TargetTable.info, chunk.Where, args, ignoreCloumns, t.Collation)
-	if err != nil {
-		return false, errors.Trace(err)
+	if !t.ReverseFixSQL {
+		t.sendFixSQL("[insert]", func(dialect Dialect) string {
+			return generateDML(dialect, t.insertType(), data, orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
+		})
+		return nil
 	}
 
-	// judge rows have all order keys to avoid panic
-	if len(targetRows) > 0 {
-		if !rowContainsCols(targetRows[0], orderKeyCols) {
-			return false, errors.Errorf("%s.%s.%s's data don't contain all keys %v", t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table, orderKeyCols)
-		}
+	if err := t.addDelete(); err != nil {
+		return errors.Trace(err)
 	}
+	t.sendFixSQL("[delete]", func(dialect Dialect) string {
+		return t.sourceFixSQL(dialect, "delete", data, source, orderKeyCols)
+	})
+	return nil
+}
 
-	for i, sourceTable := range t.SourceTables {
-		rows, _, err := getChunkRows(ctx, sourceTable.Conn, sourceTable.Schema, sourceTable.Table, sourceTable.info, chunk.Where, args, ignoreCloumns, t.Collation)
-		if err != nil {
-			return false, errors.Trace(err)
-		}
+// fixDifferentRow generates fix sql for the row exists in both source and target table, but the data is different.
+func (t *TableDiff) fixDifferentRow(sourceData map[string]*dbutil.ColumnData, source *TableInstance, targetData map[string]*dbutil.ColumnData, orderKeyCols []*model.ColumnInfo) {
+	if t.skipFix {
+		return
+	}
 
-		// judge rows have all order keys to avoid panic
-		if len(rows) > 0 {
-			if !rowContainsCols(rows[0], orderKeyCols) {
-				return false, errors.Errorf("%s.%s.%s's data don't contain all keys %v", sourceTable.InstanceID, sourceTable.Schema, sourceTable.Table, orderKeyCols)
+	if !t.ReverseFixSQL {
+		t.sendFixSQL("[update]", func(dialect Dialect) string {
+			if t.useUpdateSQL() {
+				return generateUpdateDML(dialect, sourceData, targetData, orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
 			}
+			return generateDML(dialect, "replace", sourceData, orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
+		})
+		return
+	}
+
+	t.sendFixSQL("[update]", func(dialect Dialect) string {
+		if t.useUpdateSQL() {
+			sql := generateUpdateDML(dialect, targetData, sourceData, orderKeyCols, source.info, source.Schema)
+			return fmt.Sprintf("%s -- instance-id: %s", sql, source.InstanceID)
 		}
+		return t.sourceFixSQL(dialect, "replace", targetData, source, orderKeyCols)
+	})
+}
 
-		sourceRows[fmt.Sprintf("source-%d", i)] = rows
+// dialect returns the Dialect of fix sqls, default is MySQL's.
+func (t *TableDiff) dialect() Dialect {
+	if t.Dialect == nil {
+		return mysqlDialect{}
 	}
+	return t.Dialect
+}
 
-	var (
-		equal     = true
-		rowsData1 = make([]map[string]*dbutil.ColumnData, 0, 100)
-		rowsData2 = make([]map[string]*dbutil.ColumnData, 0, 100)
-	)
+// useUpdateSQL returns true if the different rows are fixed by `UPDATE`. the rows matched by the business key are
+// always updated, because `REPLACE` regenerates their primary keys. the rows compared by the column groups are also
+// updated, because `REPLACE` resets the columns not selected.
+func (t *TableDiff) useUpdateSQL() bool {
+	return t.UseUpdateSQL || len(t.BusinessKey) != 0 || len(t.columnGroups) != 0
+}
 
-	rowDatas := &RowDatas{
-		Rows:         make([]RowData, 0, len(sourceRows)),
-		OrderKeyCols: orderKeyCols,
+// insertType returns the type of sql used to insert the missing row.
+func (t *TableDiff) insertType() string {
+	if t.useUpdateSQL() {
+		return "insert"
 	}
-	heap.Init(rowDatas)
-	sourceMap := make(map[string]interface{})
-	sourceOffset := make(map[string]int)
-	for {
-		for source, rows := range sourceRows {
-			if _, ok := sourceMap[source]; ok {
-				continue
-			}
-			if sourceOffset[source] == len(rows) {
-				delete(sourceRows, source)
-				continue
-			}
+	return "replace"
+}
 
-			data := rows[sourceOffset[source]]
-			heap.Push(rowDatas, RowData{
-				Data:   data,
-				Source: source,
-			})
-			sourceMap[source] = struct{}{}
-			sourceOffset[source]++
-		}
+// sourceFixSQL generates fix sql for the source table, the source's instance id is appended as a comment.
+func (t *TableDiff) sourceFixSQL(dialect Dialect, tp string, data map[string]*dbutil.ColumnData, source *TableInstance, orderKeyCols []*model.ColumnInfo) string {
+	sql := generateDML(dialect, tp, data, orderKeyCols, source.info, source.Schema)
+	return fmt.Sprintf("%s -- instance-id: %s", sql, source.InstanceID)
+}
 
-		if rowDatas.Len() == 0 {
-			break
+// sendFixSQL sends the fix sql generated by gen with the dialect. the masked values are replaced in the logged sql,
+// and also in the written sql if RedactFixSQL is true.
+func (t *TableDiff) sendFixSQL(tp string, gen func(dialect Dialect) string) {
+	sql := gen(t.dialect())
+	logSQL := sql
+	if t.redact != nil {
+		logSQL = gen(redactDialect{Dialect: t.dialect(), redact: t.redact})
+		if t.RedactFixSQL {
+			sql = logSQL
 		}
-
-		rowData := heap.Pop(rowDatas).(RowData)
-		rowsData1 = append(rowsData1, rowData.Data)
-		delete(sourceMap, rowData.Source)
 	}
 
-	rowsData2 = targetRows
+	log.Info(tp, zap.String("sql", logSQL))
+	t.wg.Add(1)
+	t.sqlCh <- sql
+}
 
-	var index1, index2 int
-	for {
-		if index1 == len(rowsData1) {
-			// all the rowsData2's data should be deleted
-			for ; index2 < len(rowsData2); index2++ {
-				sql := generateDML("delete", rowsData2[index2], orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
-				log.Info("[delete]", zap.String("sql", sql))
-				t.wg.Add(1)
-				t.sqlCh <- sql
-				equal = false
-			}
-			break
-		}
-		if index2 == len(rowsData2) {
-			// rowsData2 lack some data, should insert them
-			for ; index1 < len(rowsData1); index1++ {
-				sql := generateDML("replace", rowsData1[index1], orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
-				log.Info("[insert]", zap.String("sql", sql))
-				t.wg.Add(1)
-				t.sqlCh <- sql
-				equal = false
-			}
-			break
-		}
-		eq, cmp, err := compareData(rowsData1[index1], rowsData2[index2], orderKeyCols)
-		if err != nil {
-			return false, errors.Trace(err)
-		}
-		if eq {
-			index1++
-			index2++
-			continue
-		}
-		equal = false
-		switch cmp {
-		case 1:
-			// delete
-			sql := generateDML("delete", rowsData2[index2], orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
-			log.Info("[delete]", zap.String("sql", sql))
-			t.wg.Add(1)
-			t.sqlCh <- sql
-			index2++
-		case -1:
-			// insert
-			sql := generateDML("replace", rowsData1[index1], orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
-			log.Info("[insert]", zap.String("sql", sql))
-			t.wg.Add(1)
-			t.sqlCh <- sql
-			index1++
-		case 0:
-			// update
-			sql := generateDML("replace", rowsData1[index1], orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
-			log.Info("[update]", zap.String("sql", sql))
-			t.wg.Add(1)
-			t.sqlCh <- sql
-			index1++
-			index2++
-		}
+// sendChunkComment sends a comment line with the chunk's conditions and arguments after the chunk's fix sqls, so the
+// fix sqls can be traced back to the chunks. the arguments are masked like the fix sqls if RedactFixSQL is true.
+// the conditions and the arguments are quoted, so a line break in them can't end the comment and inject a statement.
+func (t *TableDiff) sendChunkComment(chunk *ChunkRange, result *ChunkResult) {
+	args := chunk.Args
+	if t.RedactFixSQL {
+		args = t.redact.args(chunk, utils.StringsToInterfaces(chunk.Args))
+	}
+	quotedArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		quotedArgs = append(quotedArgs, strconv.Quote(arg))
 	}
 
-	return equal, nil
+	t.wg.Add(1)
+	t.sqlCh <- fmt.Sprintf("-- chunk %d: %d different rows, where: %q, args: [%s]", chunk.ID, result.DifferentRows, chunk.Where, strings.Join(quotedArgs, ", "))
 }
 
-// WriteSqls write sqls to file
+// WriteSqls write sqls to file until the returned channel is signaled. it doesn't exit when the context is done,
+// because the checking goroutines may still send the fix sqls, they are always drained before the signal.
 func (t *TableDiff) WriteSqls(ctx context.Context, writeFixSQL func(string) error) chan bool {
 	t.wg.Add(1)
-	stopWriteCh := make(chan bool)
+	// buffered, so the stop signal never blocks the caller
+	stopWriteCh := make(chan bool, 1)
 
 	go func() {
 		defer t.wg.Done()
@@ -609,8 +2386,6 @@ func (t *TableDiff) WriteSqls(ctx context.Context, writeFixSQL func(string) erro
 				t.wg.Done()
 			case <-stopWriteCh:
 				stop = true
-			case <-ctx.Done():
-				return
 			default:
 				if stop {
 					return
@@ -626,20 +2401,12 @@ func (t *TableDiff) WriteSqls(ctx context.Context, writeFixSQL func(string) erro
 
 func (t *TableDiff) UpdateSummaryInfo(ctx context.Context) chan bool {
 	t.wg.Add(1)
-	stopUpdateCh := make(chan bool)
+	// buffered, so the stop signal never blocks the caller even if the goroutine exits because the context is done
+	stopUpdateCh := make(chan bool, 1)
 
 	go func() {
-		update := func() {
-			ctx1, cancel1 := context.WithTimeout(ctx, dbutil.DefaultTimeout)
-			defer cancel1()
-
-			err := updateTableSummary(ctx1, t.TargetTable.Conn, t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table)
-			if err != nil {
-				log.Error("save table summary info failed", zap.String("schema", t.TargetTable.Schema), zap.String("table", t.TargetTable.Table), zap.Error(err))
-			}
-		}
 		defer func() {
-			update()
+			t.flushSummary(ctx)
 			t.wg.Done()
 		}()
 
@@ -653,7 +2420,7 @@ func (t *TableDiff) UpdateSummaryInfo(ctx context.Context) chan bool {
 			case <-stopUpdateCh:
 				return
 			case <-ticker.C:
-				update()
+				t.flushSummary(ctx)
 			}
 		}
 	}()
@@ -661,41 +2428,46 @@ func (t *TableDiff) UpdateSummaryInfo(ctx context.Context) chan bool {
 	return stopUpdateCh
 }
 
-func generateDML(tp string, data map[string]*dbutil.ColumnData, keys []*model.ColumnInfo, table *model.TableInfo, schema string) (sql string) {
+// flushSummary saves the table's summary by the chunks' states.
+func (t *TableDiff) flushSummary(ctx context.Context) {
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutCheckpoint)
+	defer cancel1()
+
+	err := updateTableSummary(ctx1, t.checkpointConn(), t.TargetTable.InstanceID, t.TargetTable.Schema, t.TargetTable.Table)
+	if err != nil {
+		log.Error("save table summary info failed", zap.String("schema", t.TargetTable.Schema), zap.String("table", t.TargetTable.Table), zap.Error(err))
+	}
+}
+
+// generateDML generates `REPLACE`, `INSERT` or `DELETE` sql in the dialect, the `REPLACE` is generated by the dialect's upsert.
+func generateDML(dialect Dialect, tp string, data map[string]*dbutil.ColumnData, keys []*model.ColumnInfo, table *model.TableInfo, schema string) (sql string) {
+	tableName := fmt.Sprintf("%s.%s", dialect.QuoteName(schema), dialect.QuoteName(table.Name.O))
 	switch tp {
-	case "replace":
+	case "replace", "insert":
 		colNames := make([]string, 0, len(table.Columns))
 		values := make([]string, 0, len(table.Columns))
 		for _, col := range table.Columns {
-			colNames = append(colNames, fmt.Sprintf("`%s`", col.Name.O))
+			colNames = append(colNames, dialect.QuoteName(col.Name.O))
 			if data[col.Name.O].IsNull {
 				values = append(values, "NULL")
 				continue
 			}
 
-			if needQuotes(col.FieldType) {
-				values = append(values, fmt.Sprintf("'%s'", string(data[col.Name.O].Data)))
-			} else {
-				values = append(values, string(data[col.Name.O].Data))
-			}
+			values = append(values, dialect.FormatValue(col, data[col.Name.O].Data))
 		}
 
-		sql = fmt.Sprintf("REPLACE INTO `%s`.`%s`(%s) VALUES (%s);", schema, table.Name, strings.Join(colNames, ","), strings.Join(values, ","))
-	case "delete":
-		kvs := make([]string, 0, len(keys))
-		for _, col := range keys {
-			if data[col.Name.O].IsNull {
-				kvs = append(kvs, fmt.Sprintf("`%s` is NULL", col.Name.O))
-				continue
-			}
+		if tp == "insert" {
+			sql = fmt.Sprintf("INSERT INTO %s(%s) VALUES (%s);", tableName, strings.Join(colNames, ","), strings.Join(values, ","))
+			break
+		}
 
-			if needQuotes(col.FieldType) {
-				kvs = append(kvs, fmt.Sprintf("`%s` = '%s'", col.Name.O, string(data[col.Name.O].Data)))
-			} else {
-				kvs = append(kvs, fmt.Sprintf("`%s` = %s", col.Name.O, string(data[col.Name.O].Data)))
-			}
+		keyNames := make([]string, 0, len(keys))
+		for _, col := range keys {
+			keyNames = append(keyNames, dialect.QuoteName(col.Name.O))
 		}
-		sql = fmt.Sprintf("DELETE FROM `%s`.`%s` WHERE %s;", schema, table.Name, strings.Join(kvs, " AND "))
+		sql = dialect.UpsertSQL(tableName, colNames, values, keyNames)
+	case "delete":
+		sql = fmt.Sprintf("DELETE FROM %s WHERE %s;", tableName, strings.Join(keyConditions(dialect, data, keys), " AND "))
 	default:
 		log.Error("unknown sql type", zap.String("type", tp))
 	}
@@ -703,7 +2475,46 @@ func generateDML(tp string, data map[string]*dbutil.ColumnData, keys []*model.Co
 	return
 }
 
-func compareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols []*model.ColumnInfo) (bool, int32, error) {
+// generateUpdateDML generates `UPDATE` sql in the dialect which updates the changed columns from oldData to newData.
+func generateUpdateDML(dialect Dialect, newData, oldData map[string]*dbutil.ColumnData, keys []*model.ColumnInfo, table *model.TableInfo, schema string) string {
+	sets := make([]string, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		newValue, ok1 := newData[col.Name.O]
+		oldValue, ok2 := oldData[col.Name.O]
+		if !ok1 || !ok2 {
+			// the column is ignored
+			continue
+		}
+		if equalColumnData(col, "", newValue, oldValue) {
+			continue
+		}
+
+		if newValue.IsNull {
+			sets = append(sets, fmt.Sprintf("%s = NULL", dialect.QuoteName(col.Name.O)))
+		} else {
+			sets = append(sets, fmt.Sprintf("%s = %s", dialect.QuoteName(col.Name.O), dialect.FormatValue(col, newValue.Data)))
+		}
+	}
+
+	return fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s;", dialect.QuoteName(schema), dialect.QuoteName(table.Name.O), strings.Join(sets, ", "), strings.Join(keyConditions(dialect, oldData, keys), " AND "))
+}
+
+// keyConditions returns the conditions which locate the row by keys.
+func keyConditions(dialect Dialect, data map[string]*dbutil.ColumnData, keys []*model.ColumnInfo) []string {
+	kvs := make([]string, 0, len(keys))
+	for _, col := range keys {
+		if data[col.Name.O].IsNull {
+			kvs = append(kvs, fmt.Sprintf("%s is NULL", dialect.QuoteName(col.Name.O)))
+			continue
+		}
+
+		kvs = append(kvs, fmt.Sprintf("%s = %s", dialect.QuoteName(col.Name.O), dialect.FormatValue(col, data[col.Name.O].Data)))
+	}
+
+	return kvs
+}
+
+func compareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols []*model.ColumnInfo, columns []*model.ColumnInfo, comparators map[string]string, redact *redactor) (bool, int32, error) {
 	var (
 		equal        = true
 		data1, data2 *dbutil.ColumnData
@@ -716,14 +2527,14 @@ func compareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols []*model
 		if data2, ok = map2[key]; !ok {
 			return false, 0, errors.Errorf("don't have key %s", key)
 		}
-		if (string(data1.Data) == string(data2.Data)) && (data1.IsNull == data2.IsNull) {
+		if equalColumnData(dbutil.FindColumnByName(columns, key), comparators[key], data1, data2) {
 			continue
 		}
 		equal = false
 		if data1.IsNull == data2.IsNull {
-			log.Error("find difference data", zap.String("column", key), zap.Reflect("data1", map1), zap.Reflect("data2", map2))
+			log.Error("find difference data", zap.String("column", key), zap.Reflect("data1", redact.row(map1)), zap.Reflect("data2", redact.row(map2)))
 		} else {
-			log.Error("find difference data, one of them is NULL", zap.String("column", key), zap.Reflect("data1", map1), zap.Reflect("data2", map2))
+			log.Error("find difference data, one of them is NULL", zap.String("column", key), zap.Reflect("data1", redact.row(map1)), zap.Reflect("data2", redact.row(map2)))
 		}
 		break
 	}
@@ -738,6 +2549,17 @@ func compareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols []*model
 		if data2, ok = map2[col.Name.O]; !ok {
 			return false, 0, errors.Errorf("don't have key %s", col.Name.O)
 		}
+		// `NULL` is less than any value
+		if data1.IsNull || data2.IsNull {
+			if data1.IsNull && data2.IsNull {
+				continue
+			}
+			cmp = 1
+			if data1.IsNull {
+				cmp = -1
+			}
+			break
+		}
 		if needQuotes(col.FieldType) {
 			strData1 := string(data1.Data)
 			strData2 := string(data2.Data)
@@ -754,21 +2576,16 @@ func compareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols []*model
 			break
 
 		} else {
-			num1, err1 := strconv.ParseFloat(string(data1.Data), 64)
-			num2, err2 := strconv.ParseFloat(string(data2.Data), 64)
-			if err1 != nil || err2 != nil {
-				return false, 0, errors.Errorf("convert %s, %s to float failed, err1: %v, err2: %v", string(data1.Data), string(data2.Data), err1, err2)
+			numCmp, err := compareNumber(col, data1.Data, data2.Data)
+			if err != nil {
+				return false, 0, errors.Errorf("compare %s, %s failed, err: %v", redact.row(map1)[col.Name.O].Data, redact.row(map2)[col.Name.O].Data, errors.Cause(err))
 			}
 
-			if num1 == num2 {
+			if numCmp == 0 {
 				continue
 			}
 
-			if num1 < num2 {
-				cmp = -1
-			} else if num1 > num2 {
-				cmp = 1
-			}
+			cmp = int32(numCmp)
 			break
 		}
 	}
@@ -776,17 +2593,72 @@ func compareData(map1, map2 map[string]*dbutil.ColumnData, orderKeyCols []*model
 	return false, cmp, nil
 }
 
-func getChunkRows(ctx context.Context, db *sql.DB, schema, table string, tableInfo *model.TableInfo, where string,
-	args []interface{}, ignoreColumns map[string]interface{}, collation string) ([]map[string]*dbutil.ColumnData, []*model.ColumnInfo, error) {
-	orderKeys, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+// getChunkRows selects the rows in the chunk ordered by rowOrderKeyCols, the columns in columnExprs are selected by
+// the expressions, and the rows are also ordered by the expressions.
+func getChunkRows(ctx context.Context, db *sql.DB, schema, table string, tableInfo *model.TableInfo, indexHint string, where string,
+	args []interface{}, ignoreColumns map[string]interface{}, columnExprs map[string]string, collation string) ([]map[string]*dbutil.ColumnData, []*model.ColumnInfo, error) {
+	datas := make([]map[string]*dbutil.ColumnData, 0, 100)
+	orderKeyCols, err := iterChunkRows(ctx, db, schema, table, tableInfo, indexHint, where, args, ignoreColumns, columnExprs, collation, func(data map[string]*dbutil.ColumnData) error {
+		datas = append(datas, data)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	return datas, orderKeyCols, nil
+}
+
+// iterChunkRows selects the rows in the chunk like getChunkRows, and calls fn with the rows one by one.
+func iterChunkRows(ctx context.Context, db *sql.DB, schema, table string, tableInfo *model.TableInfo, indexHint string, where string,
+	args []interface{}, ignoreColumns map[string]interface{}, columnExprs map[string]string, collation string, fn func(map[string]*dbutil.ColumnData) error) ([]*model.ColumnInfo, error) {
+	query, orderKeyCols := chunkRowsQuery(schema, table, tableInfo, indexHint, where, ignoreColumns, columnExprs, collation)
+
+	log.Debug("select data", zap.String("sql", query), zap.Reflect("args", args))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	// the scanner allocates the rows' data in batches, the wide tables' rows are allocation-heavy
+	scanner, err := dbutil.NewRowScanner(rows, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for rows.Next() {
+		data, err := scanner.Scan()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = fn(data); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return orderKeyCols, errors.Trace(rows.Err())
+}
+
+// chunkRowsQuery returns the query selecting the rows in the chunk used by iterChunkRows, and the order keys.
+func chunkRowsQuery(schema, table string, tableInfo *model.TableInfo, indexHint string, where string,
+	ignoreColumns map[string]interface{}, columnExprs map[string]string, collation string) (string, []*model.ColumnInfo) {
+	orderKeyCols := rowOrderKeyCols(tableInfo, ignoreColumns)
+	orderKeys := make([]string, 0, len(orderKeyCols))
+	for _, col := range orderKeyCols {
+		orderKeys = append(orderKeys, col.Name.O)
+	}
 	columns := "*"
 
-	if len(ignoreColumns) != 0 {
+	if len(ignoreColumns) != 0 || len(columnExprs) != 0 {
 		columnNames := make([]string, 0, len(tableInfo.Columns))
 		for _, col := range tableInfo.Columns {
 			if _, ok := ignoreColumns[col.Name.O]; ok {
 				continue
 			}
+			if expr, ok := columnExprs[col.Name.O]; ok {
+				columnNames = append(columnNames, fmt.Sprintf("%s AS `%s`", expr, col.Name.O))
+				continue
+			}
 			columnNames = append(columnNames, col.Name.O)
 		}
 		columns = strings.Join(columnNames, ", ")
@@ -800,24 +2672,19 @@ func getChunkRows(ctx context.Context, db *sql.DB, schema, table string, tableIn
 		collation = fmt.Sprintf(" COLLATE \"%s\"", collation)
 	}
 
-	query := fmt.Sprintf("SELECT /*!40001 SQL_NO_CACHE */ %s FROM `%s`.`%s` WHERE %s ORDER BY %s%s",
-		columns, schema, table, where, strings.Join(orderKeys, ","), collation)
-
-	log.Debug("select data", zap.String("sql", query), zap.Reflect("args", args))
-	rows, err := db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, nil, errors.Trace(err)
-	}
-	defer rows.Close()
-
-	datas := make([]map[string]*dbutil.ColumnData, 0, 100)
-	for rows.Next() {
-		data, err := dbutil.ScanRow(rows)
-		if err != nil {
-			return nil, nil, errors.Trace(err)
+	// ENUM/SET is ordered by the element's index, which may be different in different instances, so order by the label.
+	for i, col := range orderKeyCols {
+		orderKey := fmt.Sprintf("`%s`", col.Name.O)
+		if expr, ok := columnExprs[col.Name.O]; ok {
+			orderKey = fmt.Sprintf("(%s)", expr)
+			orderKeys[i] = orderKey
+		}
+		if isEnumOrSet(col) {
+			orderKeys[i] = fmt.Sprintf("CAST(%s AS CHAR)", orderKey)
 		}
-		datas = append(datas, data)
 	}
 
-	return datas, orderKeyCols, errors.Trace(rows.Err())
+	query := fmt.Sprintf("SELECT /*!40001 SQL_NO_CACHE */ %s FROM `%s`.`%s`%s WHERE %s ORDER BY %s%s",
+		columns, schema, table, dbutil.IndexHint(indexHint), where, strings.Join(orderKeys, ","), collation)
+	return query, orderKeyCols
 }
@@ -18,9 +18,12 @@ import (
 	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	_ "github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/importer"
 )
@@ -47,8 +50,8 @@ func (*testDiffSuite) TestGenerateSQLs(c *C) {
 	}
 
 	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
-	replaceSQL := generateDML("replace", rowsData, orderKeyCols, tableInfo, "test")
-	deleteSQL := generateDML("delete", rowsData, orderKeyCols, tableInfo, "test")
+	replaceSQL := generateDML(mysqlDialect{}, "replace", rowsData, orderKeyCols, tableInfo, "test")
+	deleteSQL := generateDML(mysqlDialect{}, "delete", rowsData, orderKeyCols, tableInfo, "test")
 	c.Assert(replaceSQL, Equals, "REPLACE INTO `test`.`atest`(`id`,`name`,`birthday`,`update_time`,`money`) VALUES (1,'xxx','2018-01-01 00:00:00','10:10:10',11.1111);")
 	c.Assert(deleteSQL, Equals, "DELETE FROM `test`.`atest` WHERE `id` = 1;")
 
@@ -57,23 +60,110 @@ func (*testDiffSuite) TestGenerateSQLs(c *C) {
 	tableInfo2, err := dbutil.GetTableInfoBySQL(createTableSQL2)
 	c.Assert(err, IsNil)
 	_, orderKeyCols2 := dbutil.SelectUniqueOrderKey(tableInfo2)
-	replaceSQL = generateDML("replace", rowsData, orderKeyCols2, tableInfo2, "test")
-	deleteSQL = generateDML("delete", rowsData, orderKeyCols2, tableInfo2, "test")
+	replaceSQL = generateDML(mysqlDialect{}, "replace", rowsData, orderKeyCols2, tableInfo2, "test")
+	deleteSQL = generateDML(mysqlDialect{}, "delete", rowsData, orderKeyCols2, tableInfo2, "test")
 	c.Assert(replaceSQL, Equals, "REPLACE INTO `test`.`atest`(`id`,`name`,`birthday`,`update_time`,`money`) VALUES (1,'xxx','2018-01-01 00:00:00','10:10:10',11.1111);")
 	c.Assert(deleteSQL, Equals, "DELETE FROM `test`.`atest` WHERE `id` = 1 AND `name` = 'xxx';")
 
 	// test value is nil
 	rowsData["name"] = &dbutil.ColumnData{Data: []byte(""), IsNull: true}
-	replaceSQL = generateDML("replace", rowsData, orderKeyCols, tableInfo, "test")
-	deleteSQL = generateDML("delete", rowsData, orderKeyCols, tableInfo, "test")
+	replaceSQL = generateDML(mysqlDialect{}, "replace", rowsData, orderKeyCols, tableInfo, "test")
+	deleteSQL = generateDML(mysqlDialect{}, "delete", rowsData, orderKeyCols, tableInfo, "test")
 	c.Assert(replaceSQL, Equals, "REPLACE INTO `test`.`atest`(`id`,`name`,`birthday`,`update_time`,`money`) VALUES (1,NULL,'2018-01-01 00:00:00','10:10:10',11.1111);")
 	c.Assert(deleteSQL, Equals, "DELETE FROM `test`.`atest` WHERE `id` = 1;")
 
 	rowsData["id"] = &dbutil.ColumnData{Data: []byte(""), IsNull: true}
-	replaceSQL = generateDML("replace", rowsData, orderKeyCols, tableInfo, "test")
-	deleteSQL = generateDML("delete", rowsData, orderKeyCols, tableInfo, "test")
+	replaceSQL = generateDML(mysqlDialect{}, "replace", rowsData, orderKeyCols, tableInfo, "test")
+	deleteSQL = generateDML(mysqlDialect{}, "delete", rowsData, orderKeyCols, tableInfo, "test")
 	c.Assert(replaceSQL, Equals, "REPLACE INTO `test`.`atest`(`id`,`name`,`birthday`,`update_time`,`money`) VALUES (NULL,NULL,'2018-01-01 00:00:00','10:10:10',11.1111);")
 	c.Assert(deleteSQL, Equals, "DELETE FROM `test`.`atest` WHERE `id` is NULL;")
+
+	// test json column
+	createTableSQL3 := "CREATE TABLE `test`.`atest` (`id` int(24), `info` json, primary key(`id`))"
+	tableInfo3, err := dbutil.GetTableInfoBySQL(createTableSQL3)
+	c.Assert(err, IsNil)
+	_, orderKeyCols3 := dbutil.SelectUniqueOrderKey(tableInfo3)
+	rowsData3 := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1"), IsNull: false},
+		"info": {Data: []byte(`{"name": "it's"}`), IsNull: false},
+	}
+	replaceSQL = generateDML(mysqlDialect{}, "replace", rowsData3, orderKeyCols3, tableInfo3, "test")
+	c.Assert(replaceSQL, Equals, "REPLACE INTO `test`.`atest`(`id`,`info`) VALUES (1,'{\\\"name\\\": \\\"it\\'s\\\"}');")
+
+	rowsData4 := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1"), IsNull: false},
+		"info": {Data: []byte(`{"age":1,"name":"xxx"}`), IsNull: false},
+	}
+	rowsData3["info"] = &dbutil.ColumnData{Data: []byte(`{"name": "xxx", "age": 1}`), IsNull: false}
+	equal, _, err := compareData(rowsData3, rowsData4, orderKeyCols3, tableInfo3.Columns, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+
+	// test binary column
+	createTableSQL4 := "CREATE TABLE `test`.`atest` (`id` varbinary(24), `name` varchar(24), `data` blob, primary key(`id`))"
+	tableInfo4, err := dbutil.GetTableInfoBySQL(createTableSQL4)
+	c.Assert(err, IsNil)
+	_, orderKeyCols4 := dbutil.SelectUniqueOrderKey(tableInfo4)
+	rowsData5 := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte{0x01, '\'', 0xff}, IsNull: false},
+		"name": {Data: []byte("a'b\\c\n"), IsNull: false},
+		"data": {Data: []byte{}, IsNull: false},
+	}
+	replaceSQL = generateDML(mysqlDialect{}, "replace", rowsData5, orderKeyCols4, tableInfo4, "test")
+	deleteSQL = generateDML(mysqlDialect{}, "delete", rowsData5, orderKeyCols4, tableInfo4, "test")
+	c.Assert(replaceSQL, Equals, "REPLACE INTO `test`.`atest`(`id`,`name`,`data`) VALUES (X'0127FF','a\\'b\\\\c\\n',X'');")
+	c.Assert(deleteSQL, Equals, "DELETE FROM `test`.`atest` WHERE `id` = X'0127FF';")
+
+	// test set column with different labels' order
+	createTableSQL5 := "CREATE TABLE `test`.`atest` (`id` int(24), `s` set('a', 'b'), primary key(`id`))"
+	tableInfo5, err := dbutil.GetTableInfoBySQL(createTableSQL5)
+	c.Assert(err, IsNil)
+	_, orderKeyCols5 := dbutil.SelectUniqueOrderKey(tableInfo5)
+	rowsData6 := map[string]*dbutil.ColumnData{
+		"id": {Data: []byte("1"), IsNull: false},
+		"s":  {Data: []byte("a,b"), IsNull: false},
+	}
+	rowsData7 := map[string]*dbutil.ColumnData{
+		"id": {Data: []byte("1"), IsNull: false},
+		"s":  {Data: []byte("b,a"), IsNull: false},
+	}
+	equal, _, err = compareData(rowsData6, rowsData7, orderKeyCols5, tableInfo5.Columns, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+
+	// test generate sql for source table
+	sourceTableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`btest` (`id` int(24), `s` set('a', 'b'), primary key(`id`))")
+	c.Assert(err, IsNil)
+	td := &TableDiff{ReverseFixSQL: true}
+	sourceTable := &TableInstance{Schema: "source", Table: "btest", InstanceID: "mysql1", info: sourceTableInfo}
+	c.Assert(td.sourceFixSQL(td.dialect(), "replace", rowsData6, sourceTable, orderKeyCols5), Equals, "REPLACE INTO `source`.`btest`(`id`,`s`) VALUES (1,'a,b'); -- instance-id: mysql1")
+	c.Assert(td.sourceFixSQL(td.dialect(), "delete", rowsData6, sourceTable, orderKeyCols5), Equals, "DELETE FROM `source`.`btest` WHERE `id` = 1; -- instance-id: mysql1")
+
+	// the rows only in target table can't be routed to the sharding tables
+	td.TargetTable = &TableInstance{Schema: "test", Table: "btest", InstanceID: "target", info: sourceTableInfo}
+	td.SourceTables = []*TableInstance{sourceTable, {Schema: "source", Table: "btest", InstanceID: "mysql2", info: sourceTableInfo}}
+	c.Assert(td.getTableInfo(context.Background()), ErrorMatches, "reverse fix sql for the sharding tables of `test`.`btest` not supported")
+	c.Assert(td.fixTargetExtraRow(rowsData6, orderKeyCols5), ErrorMatches, "reverse fix sql for the sharding tables of `test`.`btest` not supported")
+
+	// test update and insert sql
+	newData := map[string]*dbutil.ColumnData{
+		"id":          {Data: []byte("1"), IsNull: false},
+		"name":        {Data: []byte("yyy"), IsNull: false},
+		"birthday":    {Data: []byte("2018-01-01 00:00:00"), IsNull: false},
+		"update_time": {Data: []byte(""), IsNull: true},
+		"money":       {Data: []byte("11.1111"), IsNull: false},
+	}
+	oldData := map[string]*dbutil.ColumnData{
+		"id":          {Data: []byte("1"), IsNull: false},
+		"name":        {Data: []byte("xxx"), IsNull: false},
+		"birthday":    {Data: []byte("2018-01-01 00:00:00"), IsNull: false},
+		"update_time": {Data: []byte("10:10:10"), IsNull: false},
+		"money":       {Data: []byte("11.1111"), IsNull: false},
+	}
+	updateSQL := generateUpdateDML(mysqlDialect{}, newData, oldData, orderKeyCols, tableInfo, "test")
+	c.Assert(updateSQL, Equals, "UPDATE `test`.`atest` SET `name` = 'yyy', `update_time` = NULL WHERE `id` = 1;")
+	insertSQL := generateDML(mysqlDialect{}, "insert", newData, orderKeyCols, tableInfo, "test")
+	c.Assert(insertSQL, Equals, "INSERT INTO `test`.`atest`(`id`,`name`,`birthday`,`update_time`,`money`) VALUES (1,'yyy','2018-01-01 00:00:00',NULL,11.1111);")
 }
 
 func (t *testDiffSuite) TestDiff(c *C) {
@@ -350,4 +440,199 @@ func (*testDiffSuite) TestConfigHash(c *C) {
 	tbDiff.setConfigHash()
 	hash3 := tbDiff.configHash
 	c.Assert(hash1 == hash3, Equals, false)
+
+	// the fields added later are omitted if they're not set, so the checkpoints saved by the old versions can be used
+	tbDiff = &TableDiff{
+		SourceTables:  []*TableInstance{{Schema: "test", Table: "t", InstanceID: "source-1"}},
+		TargetTable:   &TableInstance{Schema: "test", Table: "t", InstanceID: "target"},
+		Range:         "a > 1",
+		ChunkSize:     1000,
+		UseCheckpoint: true,
+	}
+	c.Assert(tbDiff.setConfigHash(), IsNil)
+	c.Assert(tbDiff.configHash, Equals, "efb37bb2212aa86963a5faa49e670870")
+	tbDiff.BusinessKey = []string{"id"}
+	c.Assert(tbDiff.setConfigHash(), IsNil)
+	c.Assert(tbDiff.configHash, Not(Equals), "efb37bb2212aa86963a5faa49e670870")
+}
+
+func (*testDiffSuite) TestDeleteLimit(c *C) {
+	td := &TableDiff{
+		MaxDeleteRows: 2,
+	}
+	c.Assert(td.initDeleteLimit(context.Background()), IsNil)
+
+	c.Assert(td.addDelete(), IsNil)
+	c.Assert(td.addDelete(), IsNil)
+	c.Assert(td.deleteLimitExceeded(), IsFalse)
+	err := td.addDelete()
+	c.Assert(errors.Cause(err), Equals, ErrDeleteLimitExceeded)
+	c.Assert(td.deleteLimitExceeded(), IsTrue)
+
+	// no limit
+	td = &TableDiff{}
+	c.Assert(td.initDeleteLimit(context.Background()), IsNil)
+	for i := 0; i < 10; i++ {
+		c.Assert(td.addDelete(), IsNil)
+	}
+	c.Assert(td.deleteLimitExceeded(), IsFalse)
+}
+
+func (s *testDiffSuite) TestKeepRow(c *C) {
+	newRows := func() []map[string]*dbutil.ColumnData {
+		return []map[string]*dbutil.ColumnData{
+			{"id": {Data: []byte("1")}, "is_deleted": {Data: []byte("0")}},
+			{"id": {Data: []byte("2")}, "is_deleted": {Data: []byte("1")}},
+			{"id": {Data: []byte("3")}, "is_deleted": {IsNull: true}},
+			// the instance doesn't have the column
+			{"id": {Data: []byte("4")}},
+		}
+	}
+	keptRows := func(td *TableDiff, ignoreColumns map[string]interface{}) []map[string]*dbutil.ColumnData {
+		var kept []map[string]*dbutil.ColumnData
+		for _, row := range newRows() {
+			if td.keepRow(row, ignoreColumns) {
+				kept = append(kept, row)
+			}
+		}
+		return kept
+	}
+
+	td := &TableDiff{}
+	c.Assert(keptRows(td, nil), HasLen, 4)
+
+	td.SoftDeleteColumn = "is_deleted"
+	td.SoftDeleteValues = []string{"1"}
+	rows := keptRows(td, nil)
+	c.Assert(rows, HasLen, 3)
+	c.Assert(string(rows[1]["id"].Data), Equals, "3")
+	c.Assert(rows[0]["is_deleted"], NotNil)
+
+	// deleted if is not NULL, and remove the ignored column
+	td.SoftDeleteValues = nil
+	rows = keptRows(td, map[string]interface{}{"is_deleted": struct{}{}})
+	c.Assert(rows, HasLen, 2)
+	c.Assert(string(rows[0]["id"].Data), Equals, "3")
+	_, ok := rows[0]["is_deleted"]
+	c.Assert(ok, IsFalse)
+}
+
+func (s *testDiffSuite) TestGetSourceTableChecksum(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	checksums := []int64{1, 2, 4, 8}
+	mocks := make([]sqlmock.Sqlmock, 0, len(checksums))
+	sourceTables := make([]*TableInstance, 0, len(checksums))
+	for i, checksum := range checksums {
+		db, mock, err := sqlmock.New()
+		c.Assert(err, IsNil)
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(checksum, 10))
+		mocks = append(mocks, mock)
+		sourceTables = append(sourceTables, &TableInstance{Conn: db, Schema: "test", Table: fmt.Sprintf("atest_%d", i), InstanceID: "source", info: tableInfo})
+	}
+
+	td := &TableDiff{
+		TargetTable:               &TableInstance{Schema: "test", Table: "atest", info: tableInfo},
+		SourceTables:              sourceTables,
+		SourceChecksumConcurrency: 2,
+	}
+	td.adjustConfig()
+
+	chunk := &ChunkRange{ID: 1, Where: "(TRUE)"}
+	checksum, count, err := td.getSourceTableChecksum(context.Background(), chunk)
+	c.Assert(err, IsNil)
+	c.Assert(checksum, Equals, int64(15))
+	c.Assert(count, Equals, int64(40))
+	for _, mock := range mocks {
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+	}
+
+	// the error is attributed to the failed source table
+	for i, mock := range mocks {
+		if i == 2 {
+			mock.ExpectQuery("SELECT BIT_XOR").WillReturnError(errors.New("connection lost"))
+			continue
+		}
+		mock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(checksums[i], 10))
+	}
+	_, _, err = td.getSourceTableChecksum(context.Background(), chunk)
+	c.Assert(err, ErrorMatches, ".*`test`.`atest_2` in source.*connection lost")
+}
+
+func (s *testDiffSuite) TestResolveIndexHint(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), `age` int, primary key(`id`), key `idx_name_age`(`name`, `age`))")
+	c.Assert(err, IsNil)
+
+	testCases := []struct {
+		indexHint   string
+		splitFields string
+		index       string
+	}{
+		{"", "name", ""},
+		{"idx_NAME_age", "", "idx_name_age"},
+		{"auto", "", "PRIMARY"},
+		{"AUTO", "name, age", "idx_name_age"},
+		{"auto", "name", "idx_name_age"},
+		{"auto", "age", ""},
+	}
+	for _, testCase := range testCases {
+		index, err := resolveIndexHint(tableInfo, testCase.indexHint, testCase.splitFields)
+		c.Assert(err, IsNil)
+		c.Assert(index, Equals, testCase.index, Commentf("hint %s, fields %s", testCase.indexHint, testCase.splitFields))
+	}
+
+	_, err = resolveIndexHint(tableInfo, "idx_age", "")
+	c.Assert(errors.IsNotFound(err), IsTrue)
+}
+
+func (s *testDiffSuite) TestIgnoreUncheckedColumns(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), `age` int, `amount` decimal(10,2), `memo` text, primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	// the primary key is always checked
+	ignoreColumns, err := ignoreUncheckedColumns(tableInfo, []string{"Amount"}, []string{"memo"})
+	c.Assert(err, IsNil)
+	c.Assert(ignoreColumns, DeepEquals, []string{"memo", "name", "age"})
+
+	ignoreColumns, err = ignoreUncheckedColumns(tableInfo, []string{"id", "name", "age", "amount", "memo"}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(ignoreColumns, HasLen, 0)
+
+	_, err = ignoreUncheckedColumns(tableInfo, []string{"price"}, nil)
+	c.Assert(errors.IsNotFound(err), IsTrue)
+}
+
+func (s *testDiffSuite) TestCancelledCheck(c *C) {
+	t := &TableDiff{sqlCh: make(chan string)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the writing goroutine keeps draining the fix sqls after the context is done, and the stop signal never blocks
+	var written []string
+	stopWriteSqlsCh := t.WriteSqls(ctx, func(sql string) error {
+		written = append(written, sql)
+		return nil
+	})
+	t.wg.Add(1)
+	t.sqlCh <- "DELETE FROM `test`.`t` WHERE `id` = 1;"
+	stopWriteSqlsCh <- true
+	t.wg.Wait()
+	c.Assert(written, DeepEquals, []string{"DELETE FROM `test`.`t` WHERE `id` = 1;\n"})
+
+	// the worker exits without the results being received
+	chunks := make(chan *ChunkRange, 1)
+	chunks <- &ChunkRange{State: successState}
+	done := make(chan struct{})
+	go func() {
+		t.checkChunksDataEqual(ctx, false, chunks, make(chan bool))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("the worker is blocked after the context is done")
+	}
 }
@@ -0,0 +1,298 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package difftest provides the helpers to write the regression tests of the projects embedding pkg/diff: create the
+// same table in the source and target databases, inject the divergences into the target, run a diff and assert on the
+// structured report.
+package difftest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+)
+
+// Fixture is a table created in both the source and target databases.
+type Fixture struct {
+	Source *sql.DB
+	Target *sql.DB
+	Schema string
+	Table  string
+}
+
+// Setup creates the table with the column definitions in both the source and target databases, for example
+// "`id` int primary key, `name` varchar(20)", and inserts the same rows into them. the table is dropped first if exists.
+func Setup(ctx context.Context, source, target *sql.DB, schema, table, columnDefs string, rows [][]interface{}) (*Fixture, error) {
+	f := &Fixture{
+		Source: source,
+		Target: target,
+		Schema: schema,
+		Table:  table,
+	}
+
+	for _, db := range []*sql.DB{source, target} {
+		sqls := []string{
+			fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", schema),
+			fmt.Sprintf("DROP TABLE IF EXISTS %s", dbutil.TableName(schema, table)),
+			fmt.Sprintf("CREATE TABLE %s (%s)", dbutil.TableName(schema, table), columnDefs),
+		}
+		for _, sql := range sqls {
+			if _, err := db.ExecContext(ctx, sql); err != nil {
+				return nil, errors.Annotatef(err, "execute %s", sql)
+			}
+		}
+		if err := insertRows(ctx, db, schema, table, rows); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return f, nil
+}
+
+// Drop drops the table in both the source and target databases.
+func (f *Fixture) Drop(ctx context.Context) error {
+	for _, db := range []*sql.DB{f.Source, f.Target} {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", dbutil.TableName(f.Schema, f.Table))); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Inject injects the divergences into the target table.
+func (f *Fixture) Inject(ctx context.Context, divergences ...Divergence) error {
+	for _, divergence := range divergences {
+		if err := divergence.Inject(ctx, f.Target, f.Schema, f.Table); err != nil {
+			return errors.Annotatef(err, "inject %s", divergence)
+		}
+	}
+	return nil
+}
+
+// Option customizes the TableDiff before it's run, for example set the chunk size.
+type Option func(td *diff.TableDiff)
+
+// Run diffs the source and target tables, and returns the report. the TableDiff checks the data by checksum first
+// with 1 thread, and can be customized by the options.
+func (f *Fixture) Run(ctx context.Context, opts ...Option) (*Report, error) {
+	report := new(Report)
+	td := &diff.TableDiff{
+		SourceTables: []*diff.TableInstance{{
+			Conn:       f.Source,
+			Schema:     f.Schema,
+			Table:      f.Table,
+			InstanceID: "source",
+		}},
+		TargetTable: &diff.TableInstance{
+			Conn:       f.Target,
+			Schema:     f.Schema,
+			Table:      f.Table,
+			InstanceID: "target",
+		},
+		CheckThreadCount:   1,
+		UseChecksum:        true,
+		RowDiffExporter:    report,
+		ChunkResultHandler: report.handleChunkResult,
+	}
+	for _, opt := range opts {
+		opt(td)
+	}
+
+	var err error
+	report.StructEqual, report.DataEqual, err = td.Equal(ctx, func(sql string) error {
+		report.Lock()
+		report.FixSQLs = append(report.FixSQLs, sql)
+		report.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return report, nil
+}
+
+// insertRows inserts the rows into the table, every row is the values of all the columns in order.
+func insertRows(ctx context.Context, db *sql.DB, schema, table string, rows [][]interface{}) error {
+	for _, row := range rows {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(row)), ", ")
+		insertSQL := fmt.Sprintf("INSERT INTO %s VALUES (%s)", dbutil.TableName(schema, table), placeholders)
+		if _, err := db.ExecContext(ctx, insertSQL, row...); err != nil {
+			return errors.Annotatef(err, "insert row %v", row)
+		}
+	}
+	return nil
+}
+
+// columnName returns the escaped column name like `column`.
+func columnName(column string) string {
+	return fmt.Sprintf("`%s`", strings.Replace(column, "`", "``", -1))
+}
+
+// Divergence is a difference injected into the target table.
+type Divergence interface {
+	Inject(ctx context.Context, db *sql.DB, schema, table string) error
+	String() string
+}
+
+// MissingRows deletes the rows matching the condition from the target, for example "`id` > ?".
+type MissingRows struct {
+	Where string
+	Args  []interface{}
+}
+
+// Inject implements Divergence's Inject.
+func (d *MissingRows) Inject(ctx context.Context, db *sql.DB, schema, table string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", dbutil.TableName(schema, table), d.Where), d.Args...)
+	return errors.Trace(err)
+}
+
+func (d *MissingRows) String() string {
+	return fmt.Sprintf("missing rows where %s", d.Where)
+}
+
+// ExtraRows inserts the rows only in the target, every row is the values of all the columns in order.
+type ExtraRows struct {
+	Rows [][]interface{}
+}
+
+// Inject implements Divergence's Inject.
+func (d *ExtraRows) Inject(ctx context.Context, db *sql.DB, schema, table string) error {
+	return errors.Trace(insertRows(ctx, db, schema, table, d.Rows))
+}
+
+func (d *ExtraRows) String() string {
+	return fmt.Sprintf("%d extra rows", len(d.Rows))
+}
+
+// ChangedValues sets the column's value of the rows matching the condition in the target.
+type ChangedValues struct {
+	Column string
+	Value  interface{}
+	Where  string
+	Args   []interface{}
+}
+
+// Inject implements Divergence's Inject.
+func (d *ChangedValues) Inject(ctx context.Context, db *sql.DB, schema, table string) error {
+	args := append([]interface{}{d.Value}, d.Args...)
+	_, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s", dbutil.TableName(schema, table), columnName(d.Column), d.Where), args...)
+	return errors.Trace(err)
+}
+
+func (d *ChangedValues) String() string {
+	return fmt.Sprintf("changed values of column %s where %s", d.Column, d.Where)
+}
+
+// TypeDrift changes the column's type in the target, for example "bigint" or "varchar(255)".
+type TypeDrift struct {
+	Column string
+	Type   string
+}
+
+// Inject implements Divergence's Inject.
+func (d *TypeDrift) Inject(ctx context.Context, db *sql.DB, schema, table string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", dbutil.TableName(schema, table), columnName(d.Column), d.Type))
+	return errors.Trace(err)
+}
+
+func (d *TypeDrift) String() string {
+	return fmt.Sprintf("type of column %s drifts to %s", d.Column, d.Type)
+}
+
+// Report is the structured result of a diff.
+type Report struct {
+	sync.Mutex
+
+	StructEqual bool
+	DataEqual   bool
+	// the results of the checked chunks
+	Chunks []*diff.ChunkResult
+	// the different rows
+	RowDiffs []*diff.RowDiff
+	// the sqls to fix the target
+	FixSQLs []string
+}
+
+func (r *Report) handleChunkResult(ctx context.Context, result *diff.ChunkResult) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.Chunks = append(r.Chunks, result)
+}
+
+// Export implements diff.RowDiffExporter's Export.
+func (r *Report) Export(row *diff.RowDiff) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.RowDiffs = append(r.RowDiffs, row)
+	return nil
+}
+
+// RowDiffCounts returns the number of the different rows by the type, like diff.RowOnlyInSource.
+func (r *Report) RowDiffCounts() map[string]int {
+	r.Lock()
+	defer r.Unlock()
+
+	counts := make(map[string]int)
+	for _, row := range r.RowDiffs {
+		counts[row.Type]++
+	}
+	return counts
+}
+
+// TestReporter is the interface of the test frameworks, both *testing.T and pingcap/check's *C implement it.
+type TestReporter interface {
+	Errorf(format string, args ...interface{})
+}
+
+// AssertEqual reports an error if the tables' struct or data is not equal.
+func (r *Report) AssertEqual(t TestReporter) bool {
+	if !r.StructEqual || !r.DataEqual {
+		t.Errorf("expect the tables are equal, but struct equal %v, data equal %v, %d different rows", r.StructEqual, r.DataEqual, len(r.RowDiffs))
+		return false
+	}
+	return true
+}
+
+// AssertStructNotEqual reports an error if the tables' struct is equal.
+func (r *Report) AssertStructNotEqual(t TestReporter) bool {
+	if r.StructEqual {
+		t.Errorf("expect the tables' struct is not equal")
+		return false
+	}
+	return true
+}
+
+// AssertRowDiffs reports an error if the data is equal, or the numbers of the different rows are not expected.
+func (r *Report) AssertRowDiffs(t TestReporter, onlyInSource, onlyInTarget, different int) bool {
+	if r.DataEqual {
+		t.Errorf("expect the tables' data is not equal")
+		return false
+	}
+
+	counts := r.RowDiffCounts()
+	if counts[diff.RowOnlyInSource] != onlyInSource || counts[diff.RowOnlyInTarget] != onlyInTarget || counts[diff.RowDifferent] != different {
+		t.Errorf("expect %d rows only in source, %d rows only in target and %d different rows, but got %d, %d and %d",
+			onlyInSource, onlyInTarget, different, counts[diff.RowOnlyInSource], counts[diff.RowOnlyInTarget], counts[diff.RowDifferent])
+		return false
+	}
+	return true
+}
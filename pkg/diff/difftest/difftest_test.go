@@ -0,0 +1,82 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package difftest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testDiffTestSuite{})
+
+type testDiffTestSuite struct{}
+
+// recorder records the errors reported by the assertions.
+type recorder struct {
+	errs []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (s *testDiffTestSuite) TestInject(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectExec("DELETE FROM `test`.`t` WHERE `id` > \\?").WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `test`.`t` VALUES \\(\\?, \\?\\)").WithArgs(20, "x").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `test`.`t` SET `name` = \\? WHERE `id` = \\?").WithArgs("y", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE `test`.`t` MODIFY COLUMN `name` varchar\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	f := &Fixture{Target: db, Schema: "test", Table: "t"}
+	err = f.Inject(context.Background(),
+		&MissingRows{Where: "`id` > ?", Args: []interface{}{10}},
+		&ExtraRows{Rows: [][]interface{}{{20, "x"}}},
+		&ChangedValues{Column: "name", Value: "y", Where: "`id` = ?", Args: []interface{}{1}},
+		&TypeDrift{Column: "name", Type: "varchar(255)"},
+	)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testDiffTestSuite) TestReportAssertions(c *C) {
+	report := &Report{StructEqual: true, DataEqual: true}
+	r := new(recorder)
+	c.Assert(report.AssertEqual(r), IsTrue)
+	c.Assert(report.AssertStructNotEqual(r), IsFalse)
+	c.Assert(report.AssertRowDiffs(r, 0, 0, 0), IsFalse)
+	c.Assert(r.errs, HasLen, 2)
+
+	report = &Report{StructEqual: true}
+	for _, tp := range []string{diff.RowOnlyInSource, diff.RowOnlyInSource, diff.RowDifferent} {
+		c.Assert(report.Export(&diff.RowDiff{Type: tp}), IsNil)
+	}
+	r = new(recorder)
+	c.Assert(report.AssertEqual(r), IsFalse)
+	c.Assert(report.AssertRowDiffs(r, 2, 0, 1), IsTrue)
+	c.Assert(report.AssertRowDiffs(r, 1, 0, 1), IsFalse)
+	c.Assert(r.errs, HasLen, 2)
+	c.Assert(r.errs[1], Equals, "expect 1 rows only in source, 0 rows only in target and 1 different rows, but got 2, 0 and 1")
+}
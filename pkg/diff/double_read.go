@@ -0,0 +1,61 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// confirmByDoubleRead re-reads the checksums of the chunk found different after DoubleReadDelay, returns true if the
+// checksums and the counts are the same as the first read, which means the difference is stable. the changed checksums
+// mean the rows are being modified, for example by the replication, so the difference is transient.
+func (t *TableDiff) confirmByDoubleRead(ctx context.Context, chunk *ChunkRange, result *ChunkResult) (bool, error) {
+	select {
+	case <-time.After(t.DoubleReadDelay):
+	case <-ctx.Done():
+		return false, errors.Trace(ctx.Err())
+	}
+
+	var (
+		second                                                   = &ChunkResult{}
+		sourceChecksum, targetChecksum, sourceCount, targetCount int64
+		err                                                      error
+	)
+	if len(t.columnGroups) == 0 {
+		sourceChecksum, targetChecksum, sourceCount, targetCount, err = t.getChecksumByColumns(ctx, chunk, utils.SliceToMap(t.IgnoreColumns))
+	} else {
+		sourceChecksum, targetChecksum, sourceCount, targetCount, err = t.compareColumnGroupsChecksum(ctx, chunk, second)
+	}
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	result.DoubleReadCompared = true
+	result.DoubleReadConfirmed = sourceChecksum == result.SourceChecksum && targetChecksum == result.TargetChecksum &&
+		sourceCount == result.SourceRowCount && targetCount == result.TargetRowCount && equalStrings(second.MismatchedColumns, result.MismatchedColumns)
+	if !result.DoubleReadConfirmed {
+		log.Warn("chunk is changed between the reads, the difference is transient", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)),
+			zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Int64("source checksum", sourceChecksum), zap.Int64("target checksum", targetChecksum),
+			zap.Int64("source count", sourceCount), zap.Int64("target count", targetCount))
+	}
+
+	return result.DoubleReadConfirmed, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testDoubleReadSuite{})
+
+type testDoubleReadSuite struct{}
+
+func (s *testDoubleReadSuite) TestDoubleRead(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	var results []*ChunkResult
+	td := &TableDiff{
+		TargetTable:     &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables:    []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		UseChecksum:     true,
+		OnlyUseChecksum: true,
+		DoubleReadDelay: time.Millisecond,
+		ChunkResultHandler: func(ctx context.Context, result *ChunkResult) {
+			results = append(results, result)
+		},
+	}
+	td.adjustConfig()
+
+	expectChecksums := func(sourceChecksum, targetChecksum int64) {
+		sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(sourceChecksum, 10))
+		targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(targetChecksum, 10))
+	}
+
+	// both reads have the same difference
+	chunk := &ChunkRange{ID: 1, Where: "(TRUE)"}
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectChecksums(123, 456)
+	expectChecksums(123, 456)
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	equal, err := td.checkChunkDataEqual(context.Background(), false, chunk)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(results[0].State, Equals, failedState)
+	c.Assert(results[0].DoubleReadCompared, IsTrue)
+	c.Assert(results[0].DoubleReadConfirmed, IsTrue)
+
+	// the target is changed by the replication between the reads
+	chunk = &ChunkRange{ID: 2, Where: "(TRUE)"}
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectChecksums(123, 456)
+	expectChecksums(123, 123)
+	targetMock.ExpectExec("REPLACE INTO").WillReturnResult(sqlmock.NewResult(0, 1))
+	equal, err = td.checkChunkDataEqual(context.Background(), false, chunk)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+	c.Assert(results[1].State, Equals, successState)
+	c.Assert(results[1].DoubleReadCompared, IsTrue)
+	c.Assert(results[1].DoubleReadConfirmed, IsFalse)
+
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// hasUniqueKey returns true if the rows are ordered by the primary key or a unique index. the key can still be
+// duplicated if the uniqueness is not enforced, for example the rows of the sharded source tables, or a source table
+// without the index.
+func hasUniqueKey(tableInfo *model.TableInfo) bool {
+	if tableInfo.PKIsHandle {
+		return true
+	}
+	for _, index := range tableInfo.Indices {
+		if index.Primary || index.Unique {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicatedKeyRows is all the rows of a unique key which exists in more than one row on either side. they can't be
+// compared one by one, so all of them are reported.
+type duplicatedKeyRows struct {
+	sources    []*TableInstance
+	sourceRows []map[string]*dbutil.ColumnData
+	targetRows []map[string]*dbutil.ColumnData
+}
+
+func (d *duplicatedKeyRows) addSource(table *TableInstance, row map[string]*dbutil.ColumnData) {
+	d.sources = append(d.sources, table)
+	d.sourceRows = append(d.sourceRows, row)
+}
+
+func (d *duplicatedKeyRows) addTarget(row map[string]*dbutil.ColumnData) {
+	d.targetRows = append(d.targetRows, row)
+}
+
+// reportDuplicatedKeyRows exports all the rows of the duplicated key and generates the fix sqls. the rows of the key
+// in the fixed side are all deleted, and the row of the other side is inserted. if the key is also duplicated in the
+// other side, the right row can't be decided, a comment is written to the fix sqls instead.
+func (t *TableDiff) reportDuplicatedKeyRows(ctx context.Context, chunk *ChunkRange, rows *duplicatedKeyRows, keyCols []*model.ColumnInfo) error {
+	row := rows.targetRows
+	if len(rows.sourceRows) != 0 {
+		row = rows.sourceRows
+	}
+	key := formatRowKey(keyCols, row[0], t.redact)
+	log.Warn("the key is duplicated", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)),
+		zap.String("chunk", chunk.Where), t.redact.chunkArgs(chunk), zap.String("key", key),
+		zap.Int("source rows", len(rows.sourceRows)), zap.Int("target rows", len(rows.targetRows)))
+
+	for i, data := range rows.sourceRows {
+		t.exportRow(rows.sources[i], data, nil, keyCols, RowDuplicatedKey)
+	}
+	for _, data := range rows.targetRows {
+		t.exportRow(nil, nil, data, keyCols, RowDuplicatedKey)
+	}
+
+	if t.skipFix {
+		return nil
+	}
+
+	if !t.ReverseFixSQL {
+		if len(rows.sourceRows) > 1 {
+			t.sendDuplicatedKeyComment(key, "source tables")
+			return nil
+		}
+
+		if len(rows.targetRows) != 0 {
+			if err := t.addDelete(); err != nil {
+				return errors.Trace(err)
+			}
+			targetData := rows.targetRows[0]
+			t.sendFixSQL("[delete]", func(dialect Dialect) string {
+				return generateDML(dialect, "delete", targetData, keyCols, t.TargetTable.info, t.TargetTable.Schema)
+			})
+		}
+		if len(rows.sourceRows) != 0 {
+			sourceData, err := t.rawRowData(ctx, rows.sources[0], rows.sourceRows[0], keyCols)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			t.sendFixSQL("[insert]", func(dialect Dialect) string {
+				return generateDML(dialect, "insert", sourceData, keyCols, t.TargetTable.info, t.TargetTable.Schema)
+			})
+		}
+		return nil
+	}
+
+	if len(rows.targetRows) > 1 {
+		t.sendDuplicatedKeyComment(key, "target table")
+		return nil
+	}
+
+	// the rows of the key are deleted in every source table which contains them
+	sources := make([]*TableInstance, 0, 1)
+	for i, source := range rows.sources {
+		deleted := false
+		for _, table := range sources {
+			deleted = deleted || table == source
+		}
+		if deleted {
+			continue
+		}
+		sources = append(sources, source)
+
+		if err := t.addDelete(); err != nil {
+			return errors.Trace(err)
+		}
+		sourceData := rows.sourceRows[i]
+		t.sendFixSQL("[delete]", func(dialect Dialect) string {
+			return t.sourceFixSQL(dialect, "delete", sourceData, source, keyCols)
+		})
+	}
+	if len(rows.targetRows) == 0 {
+		return nil
+	}
+
+	targetData, err := t.rawRowData(ctx, t.TargetTable, rows.targetRows[0], keyCols)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(sources) == 1 {
+		t.sendFixSQL("[insert]", func(dialect Dialect) string {
+			return t.sourceFixSQL(dialect, "insert", targetData, sources[0], keyCols)
+		})
+		return nil
+	}
+	return errors.Trace(t.fixTargetExtraRow(targetData, keyCols))
+}
+
+// sendDuplicatedKeyComment writes a comment to the fix sqls for the key duplicated in the side, the rows should be
+// fixed manually.
+func (t *TableDiff) sendDuplicatedKeyComment(key, side string) {
+	t.sendFixSQL("[duplicated key]", func(Dialect) string {
+		return fmt.Sprintf("-- the key %s is duplicated in the %s, please fix the rows manually", key, side)
+	})
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sort"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testDuplicateKeySuite{})
+
+type testDuplicateKeySuite struct{}
+
+func (s *testDuplicateKeySuite) TestHasUniqueKey(c *C) {
+	cases := []struct {
+		createTableSQL string
+		unique         bool
+	}{
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24), primary key(`id`))", true},
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24), unique key(`a`))", true},
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24), key(`a`))", false},
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24))", false},
+	}
+	for _, cs := range cases {
+		tableInfo, err := dbutil.GetTableInfoBySQL(cs.createTableSQL)
+		c.Assert(err, IsNil)
+		c.Assert(hasUniqueKey(tableInfo), Equals, cs.unique, Commentf("%s", cs.createTableSQL))
+	}
+}
+
+func (s *testDuplicateKeySuite) TestCompareDuplicatedKeys(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`dtest` (`id` int, `a` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	cases := []struct {
+		reverse bool
+		sqls    []string
+	}{
+		{
+			reverse: false,
+			sqls: []string{
+				"-- the key id=3 is duplicated in the source tables, please fix the rows manually",
+				"DELETE FROM `test`.`dtest` WHERE `id` = 2;",
+			},
+		},
+		{
+			reverse: true,
+			sqls: []string{
+				"-- the key id=2 is duplicated in the target table, please fix the rows manually",
+				"DELETE FROM `test`.`dtest` WHERE `id` = 3; -- instance-id: source-1",
+				"INSERT INTO `test`.`dtest`(`id`,`a`) VALUES (3,'c'); -- instance-id: source-1",
+			},
+		},
+	}
+	for _, cs := range cases {
+		targetDB, targetMock, err := sqlmock.New()
+		c.Assert(err, IsNil)
+		defer targetDB.Close()
+		sourceDB1, sourceMock1, err := sqlmock.New()
+		c.Assert(err, IsNil)
+		defer sourceDB1.Close()
+		sourceDB2, sourceMock2, err := sqlmock.New()
+		c.Assert(err, IsNil)
+		defer sourceDB2.Close()
+
+		observer := &rowsObserver{}
+		td := &TableDiff{
+			TargetTable: &TableInstance{Conn: targetDB, Schema: "test", Table: "dtest", InstanceID: "target", info: tableInfo},
+			SourceTables: []*TableInstance{
+				{Conn: sourceDB1, Schema: "test", Table: "dtest", InstanceID: "source-1", info: tableInfo},
+				{Conn: sourceDB2, Schema: "test", Table: "dtest", InstanceID: "source-2", info: tableInfo},
+			},
+			ReverseFixSQL: cs.reverse,
+			Observer:      observer,
+		}
+		td.adjustConfig()
+		td.sqlCh = make(chan string, 10)
+
+		// the key 2 is duplicated in the target table, and the key 3 is duplicated in the source shards
+		targetRows := sqlmock.NewRows([]string{"id", "a"}).
+			AddRow(1, "a").AddRow(2, "b").AddRow(2, "x").AddRow(3, "c").AddRow(4, "e")
+		targetMock.ExpectQuery("SELECT .* ORDER BY id").WillReturnRows(targetRows)
+		if cs.reverse {
+			// the sharding tables are not supported by reverse fix sqls, the key 3 is duplicated in the only source table
+			td.SourceTables = td.SourceTables[:1]
+			sourceRows := sqlmock.NewRows([]string{"id", "a"}).AddRow(1, "a").AddRow(3, "c").AddRow(3, "d").AddRow(4, "e")
+			sourceMock1.ExpectQuery("SELECT .* ORDER BY id").WillReturnRows(sourceRows)
+		} else {
+			sourceRows1 := sqlmock.NewRows([]string{"id", "a"}).AddRow(1, "a").AddRow(3, "c")
+			sourceRows2 := sqlmock.NewRows([]string{"id", "a"}).AddRow(3, "d").AddRow(4, "e")
+			sourceMock1.ExpectQuery("SELECT .* ORDER BY id").WillReturnRows(sourceRows1)
+			sourceMock2.ExpectQuery("SELECT .* ORDER BY id").WillReturnRows(sourceRows2)
+		}
+
+		result := &ChunkResult{}
+		equal, err := td.compareRows(context.Background(), &ChunkRange{ID: 1, Where: "(TRUE)"}, result)
+		c.Assert(err, IsNil)
+		c.Assert(equal, IsFalse)
+		c.Assert(result.DuplicatedKeys, Equals, 2)
+		// all the rows of the duplicated keys are reported
+		c.Assert(result.DifferentRows, Equals, 5)
+		c.Assert(observer.rows, HasLen, 5)
+		for _, row := range observer.rows {
+			c.Assert(row.Type, Equals, RowDuplicatedKey)
+		}
+
+		close(td.sqlCh)
+		sqls := make([]string, 0, len(cs.sqls))
+		for sql := range td.sqlCh {
+			sqls = append(sqls, sql)
+		}
+		// the order of the rows with the same key in different shards is not decided
+		sort.Strings(sqls)
+		c.Assert(sqls, DeepEquals, cs.sqls)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// InstanceEstimate is the estimated scan volume of a table instance.
+type InstanceEstimate struct {
+	InstanceID string `json:"instance-id"`
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Rows       int64  `json:"rows"`
+	Bytes      int64  `json:"bytes"`
+}
+
+// TableEstimate is the estimated cost of checking a table's data.
+type TableEstimate struct {
+	// the expected number of chunks, the sampled chunks are counted.
+	Chunks int64 `json:"chunks"`
+	// the rows and bytes to be scanned in all the instances.
+	Rows      int64               `json:"rows"`
+	Bytes     int64               `json:"bytes"`
+	Instances []*InstanceEstimate `json:"instances"`
+}
+
+// Estimate returns the expected chunk count, and the estimated rows and bytes to be scanned in every instance.
+// the estimation is based on the tables' statistics and the whole table is counted even if Range is set, so it's an upper bound.
+// it doesn't split chunks or write checkpoint, and can be called before Equal, for example in a dry run.
+func (t *TableDiff) Estimate(ctx context.Context) (*TableEstimate, error) {
+	t.adjustConfig()
+
+	estimate := &TableEstimate{
+		Instances: make([]*InstanceEstimate, 0, len(t.SourceTables)+1),
+	}
+
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		if _, ok := table.rowSource().(*sqlRowSource); !ok {
+			// can't estimate the rows in other RowSources, for example the files
+			estimate.Instances = append(estimate.Instances, &InstanceEstimate{InstanceID: table.InstanceID, Schema: table.Schema, Table: table.Table})
+			continue
+		}
+
+		status, err := dbutil.GetTableStatus(ctx, table.Conn, table.Schema, table.Table)
+		if err != nil {
+			return nil, errors.Annotatef(err, "estimate %s.%s in %s", table.Schema, table.Table, table.InstanceID)
+		}
+
+		instance := &InstanceEstimate{
+			InstanceID: table.InstanceID,
+			Schema:     table.Schema,
+			Table:      table.Table,
+			Rows:       status.Rows * int64(t.Sample) / 100,
+			Bytes:      tableBytes(status) * int64(t.Sample) / 100,
+		}
+		estimate.Instances = append(estimate.Instances, instance)
+		estimate.Rows += instance.Rows
+		estimate.Bytes += instance.Bytes
+	}
+
+	// chunks are split by the target table, or the tidb instance's statistics
+	targetRows := estimate.Instances[0].Rows
+	estimate.Chunks = (targetRows + int64(t.ChunkSize) - 1) / int64(t.ChunkSize)
+
+	return estimate, nil
+}
+
+func tableBytes(status *dbutil.TableStatus) int64 {
+	if status.DataLength > 0 {
+		return status.DataLength
+	}
+	return status.Rows * status.AvgRowLength
+}
+
+// SortTableDiffsByCost sorts the TableDiffs by the estimated bytes to be scanned in descending order,
+// so the most expensive tables can be checked first. the tables can't be estimated are put at the end.
+func SortTableDiffsByCost(ctx context.Context, tables []*TableDiff) {
+	costs := make(map[*TableDiff]int64, len(tables))
+	for _, table := range tables {
+		estimate, err := table.Estimate(ctx)
+		if err != nil {
+			log.Warn("estimate table failed", zap.String("table", dbutil.TableName(table.TargetTable.Schema, table.TargetTable.Table)), zap.Error(err))
+			costs[table] = -1
+			continue
+		}
+		costs[table] = estimate.Bytes
+	}
+
+	sort.SliceStable(tables, func(i, j int) bool {
+		return costs[tables[i]] > costs[tables[j]]
+	})
+}
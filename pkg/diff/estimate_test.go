@@ -0,0 +1,65 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testEstimateSuite{})
+
+type testEstimateSuite struct{}
+
+func (s *testEstimateSuite) TestEstimate(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	td := &TableDiff{
+		TargetTable: &TableInstance{Conn: db, Schema: "test", Table: "t", InstanceID: "target"},
+		SourceTables: []*TableInstance{
+			{Conn: db, Schema: "test", Table: "t1", InstanceID: "source-1"},
+			{Conn: db, Schema: "test", Table: "t2", InstanceID: "source-2"},
+		},
+		ChunkSize: 100,
+		Sample:    50,
+	}
+
+	// the target table
+	mock.ExpectQuery("SELECT TABLE_ROWS, AVG_ROW_LENGTH, DATA_LENGTH FROM information_schema.TABLES").WithArgs("test", "t").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS", "AVG_ROW_LENGTH", "DATA_LENGTH"}).AddRow(1000, 10, 16384))
+	// the source tables, DATA_LENGTH is not available in source-2
+	mock.ExpectQuery("SELECT TABLE_ROWS, AVG_ROW_LENGTH, DATA_LENGTH FROM information_schema.TABLES").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS", "AVG_ROW_LENGTH", "DATA_LENGTH"}).AddRow(600, 10, 8192))
+	mock.ExpectQuery("SELECT TABLE_ROWS, AVG_ROW_LENGTH, DATA_LENGTH FROM information_schema.TABLES").WithArgs("test", "t2").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS", "AVG_ROW_LENGTH", "DATA_LENGTH"}).AddRow(400, 10, nil))
+
+	estimate, err := td.Estimate(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	c.Assert(estimate.Chunks, Equals, int64(5))
+	c.Assert(estimate.Instances, HasLen, 3)
+	c.Assert(estimate.Instances[0].InstanceID, Equals, "target")
+	c.Assert(estimate.Instances[0].Rows, Equals, int64(500))
+	c.Assert(estimate.Instances[0].Bytes, Equals, int64(8192))
+	c.Assert(estimate.Instances[2].Bytes, Equals, int64(2000))
+	c.Assert(estimate.Rows, Equals, int64(1000))
+	c.Assert(estimate.Bytes, Equals, int64(8192+4096+2000))
+
+	// table not exists
+	mock.ExpectQuery("SELECT TABLE_ROWS").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS", "AVG_ROW_LENGTH", "DATA_LENGTH"}))
+	_, err = td.Estimate(context.Background())
+	c.Assert(err, ErrorMatches, ".*not found.*")
+}
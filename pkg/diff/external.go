@@ -0,0 +1,258 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// ExternalChunkResultsVersion is the version of the external chunk results' format.
+const ExternalChunkResultsVersion = 1
+
+// ExternalChunkResultsSchema is the JSON schema of the external chunk results, which are computed by other systems, for
+// example a Spark job hashing the source's export. the checksum should be calculated in the same way as the database:
+// BIT_XOR(CAST(CRC32(CONCAT_WS(',', col1, col2, ..., CONCAT(ISNULL(col1), ISNULL(col2), ...))) AS UNSIGNED)) of the
+// rows in the chunk, the columns are in the target table's order, and the ignored columns are excluded.
+// the chunk contains the rows whose bound columns are in (lower, upper] by default.
+const ExternalChunkResultsSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "external chunk results",
+  "type": "object",
+  "required": ["version", "instance-id", "schema", "table", "chunks"],
+  "additionalProperties": false,
+  "properties": {
+    "version": {"const": 1},
+    "instance-id": {"type": "string", "minLength": 1, "description": "the id of the system computed the results"},
+    "schema": {"type": "string", "minLength": 1, "description": "the target table's schema"},
+    "table": {"type": "string", "minLength": 1, "description": "the target table's name"},
+    "chunks": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["id", "count"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "string", "minLength": 1, "description": "unique in the file"},
+          "bounds": {
+            "type": "array",
+            "description": "empty means the whole table",
+            "items": {
+              "type": "object",
+              "required": ["column"],
+              "additionalProperties": false,
+              "properties": {
+                "column": {"type": "string", "minLength": 1},
+                "lower": {"type": "string", "description": "empty means no lower bound"},
+                "lower-symbol": {"enum": ["", ">", ">="], "default": ">"},
+                "upper": {"type": "string", "description": "empty means no upper bound"},
+                "upper-symbol": {"enum": ["", "<", "<="], "default": "<="},
+                "cast": {"type": "string", "description": "the type the bound values are cast to"}
+              }
+            }
+          },
+          "checksum": {"type": "integer", "description": "only the count is compared if not set"},
+          "count": {"type": "integer", "minimum": 0}
+        }
+      }
+    }
+  }
+}`
+
+// ExternalChunkResults are the chunk results of a table computed by other systems, they are compared with the target
+// table's checksums computed locally. the format is described by ExternalChunkResultsSchema.
+type ExternalChunkResults struct {
+	Version    int              `json:"version"`
+	InstanceID string           `json:"instance-id"`
+	Schema     string           `json:"schema"`
+	Table      string           `json:"table"`
+	Chunks     []*ExternalChunk `json:"chunks"`
+}
+
+// ExternalChunk is the result of a chunk computed by other systems.
+type ExternalChunk struct {
+	ID     string   `json:"id"`
+	Bounds []*Bound `json:"bounds"`
+	// only the count is compared if it's nil
+	Checksum *int64 `json:"checksum"`
+	Count    int64  `json:"count"`
+}
+
+// LoadExternalChunkResults decodes the external chunk results, and validates them by ExternalChunkResultsSchema.
+// the unknown fields are rejected, so the typos are not ignored silently.
+func LoadExternalChunkResults(r io.Reader) (*ExternalChunkResults, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	results := &ExternalChunkResults{}
+	if err := decoder.Decode(results); err != nil {
+		return nil, errors.Annotate(err, "decode external chunk results")
+	}
+	if err := results.Valid(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return results, nil
+}
+
+// Valid returns error if the results don't match ExternalChunkResultsSchema, the default bound symbols are filled.
+func (r *ExternalChunkResults) Valid() error {
+	if r.Version != ExternalChunkResultsVersion {
+		return errors.NotSupportedf("external chunk results version %d", r.Version)
+	}
+	if len(r.InstanceID) == 0 || len(r.Schema) == 0 || len(r.Table) == 0 {
+		return errors.NotValidf("empty instance-id, schema or table in external chunk results")
+	}
+	if r.Chunks == nil {
+		return errors.NotValidf("external chunk results of %s without chunks", dbutil.TableName(r.Schema, r.Table))
+	}
+
+	ids := make(map[string]struct{}, len(r.Chunks))
+	for i, chunk := range r.Chunks {
+		if chunk == nil || len(chunk.ID) == 0 {
+			return errors.NotValidf("chunk %d without id", i)
+		}
+		if _, ok := ids[chunk.ID]; ok {
+			return errors.NotValidf("duplicate chunk id %s", chunk.ID)
+		}
+		ids[chunk.ID] = struct{}{}
+		if chunk.Count < 0 {
+			return errors.NotValidf("chunk %s's count %d", chunk.ID, chunk.Count)
+		}
+
+		columns := make(map[string]struct{}, len(chunk.Bounds))
+		for _, bound := range chunk.Bounds {
+			if bound == nil || len(bound.Column) == 0 {
+				return errors.NotValidf("chunk %s's bound without column", chunk.ID)
+			}
+			if _, ok := columns[bound.Column]; ok {
+				return errors.NotValidf("chunk %s's duplicate bound of column %s", chunk.ID, bound.Column)
+			}
+			columns[bound.Column] = struct{}{}
+
+			switch bound.LowerSymbol {
+			case "":
+				bound.LowerSymbol = gt
+			case gt, gte:
+			default:
+				return errors.NotValidf("chunk %s's lower symbol %s", chunk.ID, bound.LowerSymbol)
+			}
+			switch bound.UpperSymbol {
+			case "":
+				bound.UpperSymbol = lte
+			case lt, lte:
+			default:
+				return errors.NotValidf("chunk %s's upper symbol %s", chunk.ID, bound.UpperSymbol)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CompareExternalChunks compares the external chunk results with the target table's checksums and counts of the same
+// ranges computed locally, the source tables are not used. the results of the chunks are passed to ChunkResultHandler,
+// and the rows not in any chunk are not checked. returns true if all the chunks are equal.
+func (t *TableDiff) CompareExternalChunks(ctx context.Context, results *ExternalChunkResults) (bool, error) {
+	t.adjustConfig()
+
+	if err := t.getTableInstanceInfo(ctx, t.TargetTable); err != nil {
+		return false, errors.Trace(err)
+	}
+	if err := t.adjustCheckColumns(); err != nil {
+		return false, errors.Trace(err)
+	}
+	for _, chunk := range results.Chunks {
+		for _, bound := range chunk.Bounds {
+			if dbutil.FindColumnByName(t.TargetTable.info.Columns, bound.Column) == nil {
+				return false, errors.NotFoundf("column %s of chunk %s in table %s", bound.Column, chunk.ID, dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table))
+			}
+		}
+	}
+
+	checksumSource, supportChecksum := t.TargetTable.rowSource().(ChecksumSource)
+	rowCountSource, supportRowCount := t.TargetTable.rowSource().(RowCountSource)
+	ignoreColumns := utils.SliceToMap(t.IgnoreColumns)
+
+	allEqual := true
+	for i, externalChunk := range results.Chunks {
+		beginTime := time.Now()
+		chunk := NewChunkRange(normalMode)
+		chunk.ID = int64(i)
+		chunk.Bounds = externalChunk.Bounds
+		conditions, args := chunk.toString(t.Collation)
+		chunk.Where = fmt.Sprintf("(%s AND %s)", conditions, t.Range)
+		chunk.Args = args
+
+		if err := t.waitQueries(ctx); err != nil {
+			return false, errors.Trace(err)
+		}
+
+		result := &ChunkResult{
+			Schema:           t.TargetTable.Schema,
+			Table:            t.TargetTable.Table,
+			Chunk:            chunk,
+			RowCountCompared: true,
+			SourceRowCount:   externalChunk.Count,
+		}
+		var err error
+		ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+		switch {
+		case externalChunk.Checksum != nil && supportChecksum:
+			result.ChecksumCompared = true
+			result.SourceChecksum = *externalChunk.Checksum
+			result.TargetChecksum, result.TargetRowCount, err = checksumSource.GetChecksum(ctx1, chunk, t.TargetTable.info, ignoreColumns, t.checksumColumnExprs(t.TargetTable))
+		case externalChunk.Checksum == nil && supportRowCount:
+			result.TargetRowCount, err = rowCountSource.GetRowCount(ctx1, chunk, t.TargetTable.info)
+		default:
+			err = errors.NotSupportedf("compare external chunk %s with %s", externalChunk.ID, t.TargetTable.InstanceID)
+		}
+		cancel1()
+
+		result.Equal = err == nil && result.SourceRowCount == result.TargetRowCount && result.SourceChecksum == result.TargetChecksum
+		switch {
+		case err != nil:
+			result.State, result.Err = errorState, err
+		case result.Equal:
+			result.State = successState
+		default:
+			result.State = failedState
+			log.Warn("external chunk is not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("instance id", results.InstanceID),
+				zap.String("chunk", externalChunk.ID), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Int64("source checksum", result.SourceChecksum),
+				zap.Int64("target checksum", result.TargetChecksum), zap.Int64("source count", result.SourceRowCount), zap.Int64("target count", result.TargetRowCount))
+		}
+		result.Duration = time.Since(beginTime)
+		if t.ChunkResultHandler != nil {
+			t.ChunkResultHandler(ctx, result)
+		}
+		if err != nil {
+			return false, errors.Annotatef(err, "external chunk %s", externalChunk.ID)
+		}
+
+		allEqual = allEqual && result.Equal
+	}
+
+	log.Info("compare external chunks", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("instance id", results.InstanceID),
+		zap.Int("chunks", len(results.Chunks)), zap.Bool("equal", allEqual))
+	return allEqual, nil
+}
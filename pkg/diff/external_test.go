@@ -0,0 +1,103 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"strings"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testExternalSuite{})
+
+type testExternalSuite struct{}
+
+func (s *testExternalSuite) TestLoadExternalChunkResults(c *C) {
+	results, err := LoadExternalChunkResults(strings.NewReader(`{
+		"version": 1, "instance-id": "spark", "schema": "test", "table": "t",
+		"chunks": [
+			{"id": "1", "bounds": [{"column": "a", "upper": "100"}], "checksum": 123, "count": 10},
+			{"id": "2", "bounds": [{"column": "a", "lower": "100", "upper-symbol": "<"}], "count": 5}
+		]}`))
+	c.Assert(err, IsNil)
+	c.Assert(results.Chunks, HasLen, 2)
+	c.Assert(*results.Chunks[0].Checksum, Equals, int64(123))
+	c.Assert(results.Chunks[0].Bounds[0], DeepEquals, &Bound{Column: "a", LowerSymbol: ">", Upper: "100", UpperSymbol: "<="})
+	c.Assert(results.Chunks[1].Checksum, IsNil)
+	c.Assert(results.Chunks[1].Bounds[0].UpperSymbol, Equals, "<")
+
+	testCases := []struct {
+		content string
+		err     string
+	}{
+		{`{"version": 2, "instance-id": "spark", "schema": "test", "table": "t", "chunks": []}`, ".*version 2 not supported.*"},
+		{`{"version": 1, "instance-id": "spark", "schema": "test", "table": "t", "chunk": []}`, ".*unknown field.*"},
+		{`{"version": 1, "instance-id": "spark", "schema": "test", "table": "t"}`, ".*without chunks.*"},
+		{`{"version": 1, "instance-id": "spark", "schema": "test", "table": "t", "chunks": [{"id": "1", "count": 1}, {"id": "1", "count": 2}]}`, ".*duplicate chunk id 1.*"},
+		{`{"version": 1, "instance-id": "spark", "schema": "test", "table": "t", "chunks": [{"id": "1", "count": -1}]}`, ".*count -1.*"},
+		{`{"version": 1, "instance-id": "spark", "schema": "test", "table": "t", "chunks": [{"id": "1", "count": 1, "bounds": [{"column": "a", "lower-symbol": "<"}]}]}`, ".*lower symbol <.*"},
+	}
+	for _, testCase := range testCases {
+		_, err = LoadExternalChunkResults(strings.NewReader(testCase.content))
+		c.Assert(err, ErrorMatches, testCase.err)
+	}
+}
+
+func (s *testExternalSuite) TestCompareExternalChunks(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SHOW CREATE TABLE.*").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+		AddRow("t", "CREATE TABLE `t` (`a` int, `b` varchar(10), PRIMARY KEY (`a`))"))
+	mock.ExpectQuery("SELECT .* AS checksum, COUNT.* WHERE \\(`a` <= \\? AND TRUE\\).*").WithArgs("100").
+		WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	mock.ExpectQuery("SELECT COUNT.* WHERE \\(`a` > \\? AND TRUE\\).*").WithArgs("100").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+	checksum := int64(123)
+	results := &ExternalChunkResults{
+		Version:    ExternalChunkResultsVersion,
+		InstanceID: "spark",
+		Schema:     "test",
+		Table:      "t",
+		Chunks: []*ExternalChunk{
+			{ID: "1", Bounds: []*Bound{{Column: "a", Upper: "100"}}, Checksum: &checksum, Count: 10},
+			{ID: "2", Bounds: []*Bound{{Column: "a", Lower: "100"}}, Count: 5},
+		},
+	}
+	c.Assert(results.Valid(), IsNil)
+
+	var chunkResults []*ChunkResult
+	td := &TableDiff{
+		SourceTables: []*TableInstance{{Schema: "test", Table: "t", InstanceID: "source-1"}},
+		TargetTable:  &TableInstance{Conn: db, Schema: "test", Table: "t", InstanceID: "target"},
+		ChunkResultHandler: func(ctx context.Context, result *ChunkResult) {
+			chunkResults = append(chunkResults, result)
+		},
+	}
+	equal, err := td.CompareExternalChunks(context.Background(), results)
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(chunkResults, HasLen, 2)
+	c.Assert(chunkResults[0].State, Equals, successState)
+	c.Assert(chunkResults[0].ChecksumCompared, IsTrue)
+	c.Assert(chunkResults[1].State, Equals, failedState)
+	c.Assert(chunkResults[1].ChecksumCompared, IsFalse)
+	c.Assert(chunkResults[1].SourceRowCount, Equals, int64(5))
+	c.Assert(chunkResults[1].TargetRowCount, Equals, int64(4))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,672 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	driver "github.com/pingcap/tidb/types/parser_driver"
+	"go.uber.org/zap"
+)
+
+const (
+	fileFormatCSV = "csv"
+	fileFormatSQL = "sql"
+)
+
+// fileRowSource reads all the rows from the files into memory and sorts them by the order keys when first used,
+// and returns the rows in the chunk, which are searched by the chunk's bounds in the sorted rows.
+// the chunk is filtered by its bounds, so the TableDiff's Range must be "TRUE", and the rows are ordered in binary,
+// the collation is ignored.
+type fileRowSource struct {
+	tableInfo *model.TableInfo
+	files     []string
+	// the files' format, "csv" or "sql", decided by the file's extension if is empty
+	format string
+	// set true if the first line of the csv files is the columns' names
+	header bool
+
+	once sync.Once
+	rows []map[string]*dbutil.ColumnData
+	err  error
+}
+
+// NewCSVRowSource returns a RowSource which reads rows from the csv files, the table's struct is parsed from createTableSQL.
+// set header to true if the first line of the files is the columns' names, otherwise the fields are in the order of columns.
+// `\N` is regarded as NULL.
+func NewCSVRowSource(createTableSQL string, header bool, files ...string) (RowSource, error) {
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &fileRowSource{
+		tableInfo: tableInfo,
+		files:     files,
+		format:    fileFormatCSV,
+		header:    header,
+	}, nil
+}
+
+// NewDumpRowSource returns a RowSource which reads rows from a Dumpling or Mydumper export directory.
+// the table's struct is parsed from the file `{schema}.{table}-schema.sql`, and the rows are read from the files
+// `{schema}.{table}.sql`, `{schema}.{table}.{index}.sql`, or the csv files with the same name.
+func NewDumpRowSource(dir, schema, table string) (RowSource, error) {
+	prefix := fmt.Sprintf("%s.%s", schema, table)
+	createTableSQL, err := ioutil.ReadFile(filepath.Join(dir, prefix+"-schema.sql"))
+	if err != nil {
+		return nil, errors.Annotatef(err, "read schema file of %s", prefix)
+	}
+
+	tableInfo, err := parseCreateTableInDump(string(createTableSQL))
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse schema file of %s", prefix)
+	}
+
+	files, err := findDumpDataFiles(dir, prefix)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	log.Info("find data files in dump", zap.String("table", dbutil.TableName(schema, table)), zap.Strings("files", files))
+
+	return &fileRowSource{
+		tableInfo: tableInfo,
+		files:     files,
+		// the csv files exported by dumpling have header
+		header: true,
+	}, nil
+}
+
+// ListDumpTables returns the tables exported in the Dumpling or Mydumper export directory, schema => tables.
+// the tables are found by the schema files `{schema}.{table}-schema.sql`, the views are ignored.
+func ListDumpTables(dir string) (map[string][]string, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tables := make(map[string][]string)
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || !strings.HasSuffix(name, "-schema.sql") {
+			continue
+		}
+
+		// the database's schema file `{schema}-schema-create.sql` and the view's `{schema}.{table}-schema-view.sql`
+		// don't match the suffix, so the name must be a table's.
+		schemaTable := strings.TrimSuffix(name, "-schema.sql")
+		idx := strings.Index(schemaTable, ".")
+		if idx <= 0 || idx == len(schemaTable)-1 {
+			log.Warn("ignore unknown schema file in dump", zap.String("file", name))
+			continue
+		}
+		schema, table := schemaTable[:idx], schemaTable[idx+1:]
+		tables[schema] = append(tables[schema], table)
+	}
+
+	return tables, nil
+}
+
+// parseCreateTableInDump parses the table's struct from the schema file, which may contain comments and SET statements.
+func parseCreateTableInDump(content string) (*model.TableInfo, error) {
+	stmts, _, err := parser.New().Parse(content, "", "")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*ast.CreateTableStmt); ok {
+			return dbutil.GetTableInfoBySQL(stmt.Text())
+		}
+	}
+
+	return nil, errors.NotFoundf("create table statement")
+}
+
+// findDumpDataFiles returns the data files of the table, ordered by name.
+func findDumpDataFiles(dir, prefix string) ([]string, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	files := make([]string, 0, 1)
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || !strings.HasPrefix(name, prefix+".") {
+			continue
+		}
+
+		ext := filepath.Ext(name)
+		if ext != "."+fileFormatSQL && ext != "."+fileFormatCSV {
+			continue
+		}
+
+		// the middle part is empty or the file's index
+		middle := strings.TrimSuffix(strings.TrimPrefix(name, prefix+"."), ext)
+		if len(middle) != 0 {
+			if _, err := strconv.Atoi(middle); err != nil {
+				continue
+			}
+		}
+
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// GetTableInfo implements RowSource's GetTableInfo, the implicit column is not supported.
+func (s *fileRowSource) GetTableInfo(ctx context.Context, useRowID bool) (*model.TableInfo, error) {
+	if useRowID && !s.tableInfo.PKIsHandle {
+		return nil, errors.NotSupportedf("use _tidb_rowid in files")
+	}
+
+	return s.tableInfo, nil
+}
+
+// GetRows implements RowSource's GetRows.
+func (s *fileRowSource) GetRows(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, collation string) ([]map[string]*dbutil.ColumnData, []*model.ColumnInfo, error) {
+	rows := make([]map[string]*dbutil.ColumnData, 0, 100)
+	err := s.eachChunkRow(chunk, tableInfo, ignoreColumns, func(row map[string]*dbutil.ColumnData) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	// the loaded rows are already ordered by the table's order keys, which are different only if some of them are removed.
+	orderKeyCols := rowOrderKeyCols(tableInfo, ignoreColumns)
+	if equalColumnNames(orderKeyCols, rowOrderKeyCols(s.tableInfo, nil)) {
+		return rows, orderKeyCols, nil
+	}
+
+	err = sortRows(rows, orderKeyCols)
+	return rows, orderKeyCols, errors.Trace(err)
+}
+
+// streamRows implements rowStreamer's streamRows, the rows are passed to fn without being copied to a new slice
+// if they're in the order of the loaded rows.
+func (s *fileRowSource) streamRows(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, collation string, fn func(map[string]*dbutil.ColumnData) error) ([]*model.ColumnInfo, error) {
+	orderKeyCols := rowOrderKeyCols(tableInfo, ignoreColumns)
+	if equalColumnNames(orderKeyCols, rowOrderKeyCols(s.tableInfo, nil)) {
+		err := s.eachChunkRow(chunk, tableInfo, ignoreColumns, fn)
+		return orderKeyCols, errors.Trace(err)
+	}
+
+	rows, orderKeyCols, err := s.GetRows(ctx, chunk, tableInfo, ignoreColumns, collation)
+	for i := 0; i < len(rows) && err == nil; i++ {
+		err = fn(rows[i])
+	}
+	return orderKeyCols, errors.Trace(err)
+}
+
+// GetRowCount implements RowCountSource's GetRowCount.
+func (s *fileRowSource) GetRowCount(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo) (int64, error) {
+	if err := s.load(); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	start, end, err := s.chunkRowRange(chunk)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	var cnt int64
+	for _, row := range s.rows[start:end] {
+		contain, err := chunkContains(chunk, row, tableInfo)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if contain {
+			cnt++
+		}
+	}
+
+	return cnt, nil
+}
+
+// eachChunkRow calls fn with the rows in the chunk in the order of the loaded rows, the ignored columns are removed.
+func (s *fileRowSource) eachChunkRow(chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, fn func(map[string]*dbutil.ColumnData) error) error {
+	if err := s.load(); err != nil {
+		return errors.Trace(err)
+	}
+
+	start, end, err := s.chunkRowRange(chunk)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, row := range s.rows[start:end] {
+		contain, err := chunkContains(chunk, row, tableInfo)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !contain {
+			continue
+		}
+
+		data := make(map[string]*dbutil.ColumnData, len(row))
+		for name, value := range row {
+			if _, ok := ignoreColumns[name]; ok {
+				continue
+			}
+			data[name] = value
+		}
+		if err := fn(data); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// chunkRowRange returns the range [start, end) of the loaded rows which may be in the chunk.
+// the rows are ordered by the order keys, so if the chunk's first bound is on the first order key, the range is
+// searched by the bound's values, both the chunk's modes require the column is between the lower and upper values.
+// the rows in the range still need to be checked by chunkContains.
+func (s *fileRowSource) chunkRowRange(chunk *ChunkRange) (int, int, error) {
+	orderKeyCols := rowOrderKeyCols(s.tableInfo, nil)
+	// the rows are ordered by the ENUM's labels, but the bound is by the indexes
+	if len(chunk.Bounds) == 0 || len(orderKeyCols) == 0 || !strings.EqualFold(chunk.Bounds[0].Column, orderKeyCols[0].Name.O) || chunk.Bounds[0].EnumIndex {
+		return 0, len(s.rows), nil
+	}
+
+	key, bound := orderKeyCols[0], chunk.Bounds[0]
+	var searchErr error
+	// search returns the index of the first row whose key is greater than the value, or equal to it if inclusive.
+	// NULL is ordered before any value and doesn't match any condition.
+	search := func(value string, inclusive bool) int {
+		return sort.Search(len(s.rows), func(i int) bool {
+			data, ok := s.rows[i][key.Name.O]
+			if !ok {
+				searchErr = errors.Errorf("don't have key %s", key.Name.O)
+				return true
+			}
+			if data.IsNull {
+				return false
+			}
+			cmp, err := compareValue(key, data.Data, []byte(value))
+			if err != nil {
+				searchErr = err
+				return true
+			}
+			return cmp > 0 || (inclusive && cmp == 0)
+		})
+	}
+
+	start, end := 0, len(s.rows)
+	if len(bound.Lower) != 0 {
+		start = search(bound.Lower, true)
+	}
+	if len(bound.Upper) != 0 {
+		end = search(bound.Upper, false)
+	}
+	if searchErr != nil {
+		return 0, 0, errors.Trace(searchErr)
+	}
+	if end < start {
+		end = start
+	}
+
+	return start, end, nil
+}
+
+// sortRows sorts the rows by the keys, the rows with same keys keep their order.
+func sortRows(rows []map[string]*dbutil.ColumnData, keys []*model.ColumnInfo) error {
+	var sortErr error
+	sort.SliceStable(rows, func(i, j int) bool {
+		cmp, err := compareKeys(rows[i], rows[j], keys)
+		if err != nil {
+			sortErr = err
+		}
+		return cmp < 0
+	})
+
+	return errors.Trace(sortErr)
+}
+
+func equalColumnNames(cols1, cols2 []*model.ColumnInfo) bool {
+	if len(cols1) != len(cols2) {
+		return false
+	}
+	for i := range cols1 {
+		if cols1[i].Name.L != cols2[i].Name.L {
+			return false
+		}
+	}
+
+	return true
+}
+
+// load loads the rows from files only once.
+func (s *fileRowSource) load() error {
+	s.once.Do(func() {
+		s.rows, s.err = s.loadRows()
+	})
+	return s.err
+}
+
+func (s *fileRowSource) loadRows() ([]map[string]*dbutil.ColumnData, error) {
+	rows := make([]map[string]*dbutil.ColumnData, 0, 1024)
+	for _, file := range s.files {
+		var (
+			fileRows []map[string]*dbutil.ColumnData
+			err      error
+		)
+		format := s.format
+		if len(format) == 0 {
+			format = strings.TrimPrefix(filepath.Ext(file), ".")
+		}
+		if format == fileFormatCSV {
+			fileRows, err = s.readCSVFile(file)
+		} else {
+			fileRows, err = s.readSQLFile(file)
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "read file %s", file)
+		}
+		rows = append(rows, fileRows...)
+	}
+
+	// sort the rows once, so the rows in every chunk can be returned in order without sorting again.
+	if err := sortRows(rows, rowOrderKeyCols(s.tableInfo, nil)); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return rows, nil
+}
+
+func (s *fileRowSource) readCSVFile(file string) ([]map[string]*dbutil.ColumnData, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	columns := s.columnNames()
+	if s.header {
+		columns, err = reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	reader.FieldsPerRecord = len(columns)
+
+	rows := make([]map[string]*dbutil.ColumnData, 0, 1024)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		row := make(map[string]*dbutil.ColumnData, len(columns))
+		for i, value := range record {
+			if value == nullValue {
+				row[columns[i]] = &dbutil.ColumnData{IsNull: true}
+			} else {
+				row[columns[i]] = &dbutil.ColumnData{Data: []byte(value)}
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func (s *fileRowSource) readSQLFile(file string) ([]map[string]*dbutil.ColumnData, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	stmts, _, err := parser.New().Parse(string(content), "", "")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	rows := make([]map[string]*dbutil.ColumnData, 0, 1024)
+	for _, stmt := range stmts {
+		insert, ok := stmt.(*ast.InsertStmt)
+		if !ok {
+			continue
+		}
+
+		columns := s.columnNames()
+		if len(insert.Columns) != 0 {
+			columns = make([]string, 0, len(insert.Columns))
+			for _, col := range insert.Columns {
+				columns = append(columns, col.Name.O)
+			}
+		}
+
+		for _, list := range insert.Lists {
+			if len(list) != len(columns) {
+				return nil, errors.Errorf("the number of values %d is not equal to the number of columns %d", len(list), len(columns))
+			}
+
+			row := make(map[string]*dbutil.ColumnData, len(columns))
+			for i, expr := range list {
+				data, err := valueExprToColumnData(expr)
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+				row[columns[i]] = data
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
+
+func (s *fileRowSource) columnNames() []string {
+	columns := make([]string, 0, len(s.tableInfo.Columns))
+	for _, col := range s.tableInfo.Columns {
+		columns = append(columns, col.Name.O)
+	}
+	return columns
+}
+
+// valueExprToColumnData converts the value in INSERT statement to ColumnData, only supports constant values.
+func valueExprToColumnData(expr ast.ExprNode) (*dbutil.ColumnData, error) {
+	negative := false
+	if unary, ok := expr.(*ast.UnaryOperationExpr); ok && unary.Op == opcode.Minus {
+		negative = true
+		expr = unary.V
+	}
+
+	value, ok := expr.(*driver.ValueExpr)
+	if !ok {
+		return nil, errors.NotSupportedf("value %s", expr.Text())
+	}
+	if value.IsNull() {
+		return &dbutil.ColumnData{IsNull: true}, nil
+	}
+
+	str, err := value.ToString()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if negative {
+		str = "-" + str
+	}
+
+	return &dbutil.ColumnData{Data: []byte(str)}, nil
+}
+
+// chunkContains returns true if the row is in the chunk's bounds, it's the same as the chunk's where condition
+// without the limits, see ChunkRange.toString.
+func chunkContains(chunk *ChunkRange, row map[string]*dbutil.ColumnData, tableInfo *model.TableInfo) (bool, error) {
+	compareBound := func(bound *Bound, value, symbol string) (bool, error) {
+		col := dbutil.FindColumnByName(tableInfo.Columns, bound.Column)
+		if col == nil {
+			return false, errors.NotFoundf("column %s", bound.Column)
+		}
+		data, ok := row[col.Name.O]
+		if !ok {
+			return false, errors.Errorf("don't have column %s", col.Name.O)
+		}
+		if data.IsNull {
+			// NULL doesn't match any condition
+			return false, nil
+		}
+
+		var (
+			cmp int
+			err error
+		)
+		if bound.EnumIndex {
+			cmp, err = compareNumber(col, []byte(strconv.Itoa(enumIndex(col, string(data.Data)))), []byte(value))
+		} else {
+			cmp, err = compareValue(col, data.Data, []byte(value))
+		}
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+
+		switch symbol {
+		case equal:
+			return cmp == 0, nil
+		case lt:
+			return cmp < 0, nil
+		case lte:
+			return cmp <= 0, nil
+		case gt:
+			return cmp > 0, nil
+		case gte:
+			return cmp >= 0, nil
+		default:
+			return false, errors.NotValidf("symbol %s", symbol)
+		}
+	}
+
+	if chunk.Mode != bucketMode {
+		for _, bound := range chunk.Bounds {
+			if len(bound.Lower) != 0 {
+				if ok, err := compareBound(bound, bound.Lower, bound.LowerSymbol); err != nil || !ok {
+					return false, errors.Trace(err)
+				}
+			}
+			if len(bound.Upper) != 0 {
+				if ok, err := compareBound(bound, bound.Upper, bound.UpperSymbol); err != nil || !ok {
+					return false, errors.Trace(err)
+				}
+			}
+		}
+		return true, nil
+	}
+
+	// the bucket's range is (a > v1 OR (a = v1 AND b >= v2)) AND (a < v3 OR (a = v3 AND b <= v4))
+	matchBucketBound := func(lower bool) (bool, error) {
+		hasCondition := false
+		prefixEqual := true
+		for _, bound := range chunk.Bounds {
+			value, symbol := bound.Upper, bound.UpperSymbol
+			if lower {
+				value, symbol = bound.Lower, bound.LowerSymbol
+			}
+			if len(value) == 0 {
+				continue
+			}
+			hasCondition = true
+
+			if prefixEqual {
+				ok, err := compareBound(bound, value, symbol)
+				if err != nil || ok {
+					return ok, errors.Trace(err)
+				}
+			}
+
+			eq, err := compareBound(bound, value, equal)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			prefixEqual = prefixEqual && eq
+		}
+
+		return !hasCondition, nil
+	}
+
+	ok, err := matchBucketBound(true)
+	if err != nil || !ok {
+		return false, errors.Trace(err)
+	}
+
+	return matchBucketBound(false)
+}
+
+// compareValue compares the column's two values, returns -1, 0 or 1.
+// the string values are compared in binary, and the numeric values are compared by compareNumber.
+func compareValue(col *model.ColumnInfo, data1, data2 []byte) (int, error) {
+	if needQuotes(col.FieldType) {
+		return strings.Compare(string(data1), string(data2)), nil
+	}
+
+	cmp, err := compareNumber(col, data1, data2)
+	return cmp, errors.Trace(err)
+}
+
+// compareKeys compares two rows by the keys, NULL is less than any value.
+func compareKeys(row1, row2 map[string]*dbutil.ColumnData, keys []*model.ColumnInfo) (int, error) {
+	for _, key := range keys {
+		data1, ok1 := row1[key.Name.O]
+		data2, ok2 := row2[key.Name.O]
+		if !ok1 || !ok2 {
+			return 0, errors.Errorf("don't have key %s", key.Name.O)
+		}
+
+		switch {
+		case data1.IsNull && data2.IsNull:
+			continue
+		case data1.IsNull:
+			return -1, nil
+		case data2.IsNull:
+			return 1, nil
+		}
+
+		cmp, err := compareValue(key, data1.Data, data2.Data)
+		if err != nil || cmp != 0 {
+			return cmp, errors.Trace(err)
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testFileSourceSuite{})
+
+type testFileSourceSuite struct{}
+
+func (s *testFileSourceSuite) TestDumpRowSource(c *C) {
+	dir, err := ioutil.TempDir("", "dump")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"test.t-schema.sql":      "/*!40101 SET NAMES binary*/;\nCREATE TABLE `t` (`id` int, `name` varchar(10), primary key(`id`));\n",
+		"test.t.0.sql":           "INSERT INTO `t` VALUES (3,'c'),(-1,NULL);\n",
+		"test.t.1.csv":           "\"id\",\"name\"\n2,\"b,b\"\n1,\\N\n",
+		"test.t2.sql":            "INSERT INTO `t2` VALUES (100,'x');\n",
+		"test-schema-create.sql": "CREATE DATABASE `test`;\n",
+		"test.v-schema-view.sql": "CREATE VIEW `v` AS SELECT 1;\n",
+		"metadata":               "Started dump at: 2019-12-01 00:00:00\n",
+	}
+	for name, content := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), IsNil)
+	}
+
+	tables, err := ListDumpTables(dir)
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, map[string][]string{"test": {"t"}})
+
+	source, err := NewDumpRowSource(dir, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(source.(*fileRowSource).files, DeepEquals, []string{filepath.Join(dir, "test.t.0.sql"), filepath.Join(dir, "test.t.1.csv")})
+
+	tableInfo, err := source.GetTableInfo(context.Background(), false)
+	c.Assert(err, IsNil)
+	c.Assert(tableInfo.Columns, HasLen, 2)
+
+	chunk := NewChunkRange(normalMode)
+	rows, orderKeyCols, err := source.GetRows(context.Background(), chunk, tableInfo, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(orderKeyCols[0].Name.O, Equals, "id")
+	c.Assert(rows, HasLen, 4)
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, string(row["id"].Data))
+	}
+	c.Assert(ids, DeepEquals, []string{"-1", "1", "2", "3"})
+	c.Assert(rows[0]["name"].IsNull, IsTrue)
+	c.Assert(rows[1]["name"].IsNull, IsTrue)
+	c.Assert(string(rows[2]["name"].Data), Equals, "b,b")
+
+	chunk.update("id", "1", gt, "3", lt)
+	cnt, err := source.(RowCountSource).GetRowCount(context.Background(), chunk, tableInfo)
+	c.Assert(err, IsNil)
+	c.Assert(cnt, Equals, int64(1))
+	rows, _, err = source.GetRows(context.Background(), chunk, tableInfo, map[string]interface{}{"name": struct{}{}}, "")
+	c.Assert(err, IsNil)
+	c.Assert(rows, HasLen, 1)
+	c.Assert(string(rows[0]["id"].Data), Equals, "2")
+	_, ok := rows[0]["name"]
+	c.Assert(ok, IsFalse)
+}
+
+func (s *testFileSourceSuite) TestCSVRowSource(c *C) {
+	file, err := ioutil.TempFile("", "rows.csv")
+	c.Assert(err, IsNil)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("2,b\n1,a\n")
+	c.Assert(err, IsNil)
+	c.Assert(file.Close(), IsNil)
+
+	source, err := NewCSVRowSource("CREATE TABLE `test`.`t` (`id` int, `name` varchar(10), primary key(`id`))", false, file.Name())
+	c.Assert(err, IsNil)
+	tableInfo, err := source.GetTableInfo(context.Background(), false)
+	c.Assert(err, IsNil)
+
+	rows, _, err := source.GetRows(context.Background(), NewChunkRange(normalMode), tableInfo, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(rows, HasLen, 2)
+	c.Assert(string(rows[0]["name"].Data), Equals, "a")
+
+	// the files don't support checksum
+	td := &TableDiff{
+		TargetTable:  &TableInstance{Schema: "test", Table: "t"},
+		SourceTables: []*TableInstance{{Schema: "test", Table: "t", Source: source}},
+		UseChecksum:  true,
+	}
+	td.adjustConfig()
+	c.Assert(td.UseChecksum, IsFalse)
+}
+
+func (s *testFileSourceSuite) TestChunkContains(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`a` int, `b` varchar(10), primary key(`a`, `b`))")
+	c.Assert(err, IsNil)
+
+	// (a > 1 OR (a = 1 AND b > 'x')) AND (a < 3 OR (a = 3 AND b <= 'y'))
+	chunk := NewChunkRange(bucketMode)
+	chunk.update("a", "1", gt, "3", lt)
+	chunk.update("b", "x", gt, "y", lte)
+
+	testCases := []struct {
+		a        string
+		b        string
+		contains bool
+	}{
+		{"1", "x", false},
+		{"1", "z", true},
+		{"2", "a", true},
+		{"3", "y", true},
+		{"3", "z", false},
+		{"4", "a", false},
+	}
+	for _, testCase := range testCases {
+		row := map[string]*dbutil.ColumnData{
+			"a": {Data: []byte(testCase.a)},
+			"b": {Data: []byte(testCase.b)},
+		}
+		contains, err := chunkContains(chunk, row, tableInfo)
+		c.Assert(err, IsNil)
+		c.Assert(contains, Equals, testCase.contains, Commentf("a: %s, b: %s", testCase.a, testCase.b))
+	}
+}
+
+func (s *testFileSourceSuite) TestChunkContainsEnumIndex(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`e` enum('z', 'a', 'm'), primary key(`e`))")
+	c.Assert(err, IsNil)
+
+	// the ENUM bound is compared by the index, `e` + 0 >= 2 AND `e` + 0 <= 3
+	chunk := NewChunkRange(normalMode).copyAndUpdate("e", "", "", "", "")
+	chunk.Bounds[0].EnumIndex = true
+	chunk = chunk.copyAndUpdate("e", "2", gte, "3", lte)
+
+	for label, contains := range map[string]bool{"z": false, "a": true, "m": true, "": false} {
+		row := map[string]*dbutil.ColumnData{"e": {Data: []byte(label)}}
+		ok, err := chunkContains(chunk, row, tableInfo)
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, contains, Commentf("e: %s", label))
+	}
+}
+
+func (s *testFileSourceSuite) TestChunkRowRange(c *C) {
+	file, err := ioutil.TempFile("", "rows.csv")
+	c.Assert(err, IsNil)
+	defer os.Remove(file.Name())
+	for i := 10; i > 0; i-- {
+		_, err = fmt.Fprintf(file, "%d,%d\n%d,%d\n", i, 1, i, 2)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(file.Close(), IsNil)
+
+	source, err := NewCSVRowSource("CREATE TABLE `test`.`t` (`a` int, `b` int, primary key(`a`, `b`))", false, file.Name())
+	c.Assert(err, IsNil)
+	tableInfo, err := source.GetTableInfo(context.Background(), false)
+	c.Assert(err, IsNil)
+
+	bucket := NewChunkRange(bucketMode)
+	bucket.update("a", "3", gt, "5", lte)
+	bucket.update("b", "1", gt, "1", lte)
+	normal := NewChunkRange(normalMode)
+	normal.update("a", "3", gte, "5", lt)
+	lower := NewChunkRange(normalMode)
+	lower.update("a", "9", gt, "", "")
+	upper := NewChunkRange(normalMode)
+	upper.update("a", "", "", "2", lt)
+	other := NewChunkRange(normalMode)
+	other.update("b", "1", gt, "", "")
+
+	testCases := []struct {
+		chunk *ChunkRange
+		rows  []string
+	}{
+		{bucket, []string{"3,2", "4,1", "4,2", "5,1"}},
+		{normal, []string{"3,1", "3,2", "4,1", "4,2"}},
+		{lower, []string{"10,1", "10,2"}},
+		{upper, []string{"1,1", "1,2"}},
+		{other, []string{"1,2", "2,2", "3,2", "4,2", "5,2", "6,2", "7,2", "8,2", "9,2", "10,2"}},
+		{NewChunkRange(normalMode), nil},
+	}
+	for _, testCase := range testCases {
+		rows, _, err := source.GetRows(context.Background(), testCase.chunk, tableInfo, nil, "")
+		c.Assert(err, IsNil)
+		if testCase.rows == nil {
+			c.Assert(rows, HasLen, 20)
+			continue
+		}
+		values := make([]string, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, fmt.Sprintf("%s,%s", row["a"].Data, row["b"].Data))
+		}
+		c.Assert(values, DeepEquals, testCase.rows, Commentf("chunk: %s", testCase.chunk))
+
+		cnt, err := source.(RowCountSource).GetRowCount(context.Background(), testCase.chunk, tableInfo)
+		c.Assert(err, IsNil)
+		c.Assert(cnt, Equals, int64(len(testCase.rows)))
+
+		// the streamed rows are the same as GetRows
+		streamed := make([]map[string]*dbutil.ColumnData, 0, len(rows))
+		_, err = source.(rowStreamer).streamRows(context.Background(), testCase.chunk, tableInfo, nil, "", func(row map[string]*dbutil.ColumnData) error {
+			streamed = append(streamed, row)
+			return nil
+		})
+		c.Assert(err, IsNil)
+		c.Assert(streamed, DeepEquals, rows)
+	}
+}
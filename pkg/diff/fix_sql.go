@@ -0,0 +1,267 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// FixSQLWriter writes fix sqls into a directory, one file for every target table.
+type FixSQLWriter struct {
+	dir string
+	// roll to a new file if the file's size exceeds it, 0 means no limit.
+	maxFileSize int64
+}
+
+// NewFixSQLWriter returns a FixSQLWriter which writes files into dir.
+func NewFixSQLWriter(dir string, maxFileSize int64) (*FixSQLWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &FixSQLWriter{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+	}, nil
+}
+
+// TableWriter returns a writer for the TableDiff's target table, the file is created when the first sql is written.
+func (w *FixSQLWriter) TableWriter(td *TableDiff) *TableFixSQLWriter {
+	return &TableFixSQLWriter{
+		parent: w,
+		td:     td,
+		stats:  make(map[string]int64),
+	}
+}
+
+// TableFixSQLWriter writes a table's fix sqls, and counts the sqls by type.
+type TableFixSQLWriter struct {
+	parent *FixSQLWriter
+	td     *TableDiff
+
+	file      *os.File
+	fileIndex int
+	fileSize  int64
+
+	stats map[string]int64
+}
+
+// Write writes a sql into the table's file, used as the writeFixSQL function of TableDiff.
+func (w *TableFixSQLWriter) Write(sql string) error {
+	if w.file == nil || (w.parent.maxFileSize > 0 && w.fileSize > 0 && w.fileSize+int64(len(sql)) > w.parent.maxFileSize) {
+		if err := w.rollFile(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	n, err := w.file.WriteString(sql)
+	w.fileSize += int64(n)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// the comments, for example the chunks' conditions, are not counted
+	if !strings.HasPrefix(sql, "--") {
+		w.stats[sqlType(sql)]++
+	}
+	return nil
+}
+
+// Stats returns the number of sqls for every type, for example "DELETE" and "REPLACE".
+func (w *TableFixSQLWriter) Stats() map[string]int64 {
+	return w.stats
+}
+
+// Close writes the statistics at the end of the file, and closes the file.
+func (w *TableFixSQLWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	_, err := w.file.WriteString(fmt.Sprintf("-- statistics: %s\n", w.statsString()))
+	if err != nil {
+		w.file.Close()
+		return errors.Trace(err)
+	}
+
+	err = w.file.Close()
+	w.file = nil
+	return errors.Trace(err)
+}
+
+func (w *TableFixSQLWriter) rollFile() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return errors.Trace(err)
+		}
+		w.fileIndex++
+	}
+
+	// the identifiers are escaped, so they never contain dots or path separators, and the file names of the tables and
+	// the rolled files can't collide
+	table := w.td.TargetTable
+	fileName := fmt.Sprintf("%s.%s.sql", escapeFileName(table.Schema), escapeFileName(table.Table))
+	if w.fileIndex > 0 {
+		fileName = fmt.Sprintf("%s.%s.%d.sql", escapeFileName(table.Schema), escapeFileName(table.Table), w.fileIndex)
+	}
+	filePath := filepath.Join(w.parent.dir, fileName)
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("create fix sql file", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.String("file", filePath))
+
+	// the conditions of the chunks are written after their fix sqls, see TableDiff.sendChunkComment
+	header := fmt.Sprintf("-- table: %s\n-- config hash: %s\n-- time: %s\n",
+		dbutil.TableName(table.Schema, table.Table), w.td.configHash, time.Now().Format(time.RFC3339))
+	n, err := file.WriteString(header)
+	if err != nil {
+		file.Close()
+		return errors.Trace(err)
+	}
+
+	w.file = file
+	w.fileSize = int64(n)
+	return nil
+}
+
+func (w *TableFixSQLWriter) statsString() string {
+	types := make([]string, 0, len(w.stats))
+	for tp := range w.stats {
+		types = append(types, tp)
+	}
+	sort.Strings(types)
+
+	items := make([]string, 0, len(types))
+	for _, tp := range types {
+		items = append(items, fmt.Sprintf("%s %d", tp, w.stats[tp]))
+	}
+
+	return strings.Join(items, ", ")
+}
+
+// escapeFileName percent-encodes the ASCII characters of the identifier except letters, digits, '_' and '-', for
+// example "a.b/c" returns "a%2Eb%2Fc".
+func escapeFileName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if ch >= utf8.RuneSelf || ch == '_' || ch == '-' || ('0' <= ch && ch <= '9') || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+
+	return b.String()
+}
+
+// sqlType returns the sql's type, for example "REPLACE INTO ..." returns "REPLACE".
+func sqlType(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if i := strings.IndexByte(sql, ' '); i > 0 {
+		sql = sql[:i]
+	}
+
+	return strings.ToUpper(sql)
+}
+
+// fixSQLHolder holds the fix sqls in a temporary file until the table's check finishes, so they can be discarded if
+// the rows need to be deleted exceed the limit, the partial fix sqls are never written and executed by mistake.
+type fixSQLHolder struct {
+	write func(string) error
+
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+}
+
+func newFixSQLHolder(dir string, write func(string) error) (*fixSQLHolder, error) {
+	file, err := ioutil.TempFile(dir, "sync-diff-fix-sql-")
+	if err != nil {
+		return nil, errors.Annotate(err, "create held fix sql file")
+	}
+
+	writer := bufio.NewWriter(file)
+	return &fixSQLHolder{
+		write:   write,
+		file:    file,
+		writer:  writer,
+		encoder: gob.NewEncoder(writer),
+	}, nil
+}
+
+// hold saves the sql into the temporary file, used as the writeFixSQL function of TableDiff.
+func (h *fixSQLHolder) hold(sql string) error {
+	return errors.Trace(h.encoder.Encode(sql))
+}
+
+// release writes the held sqls in order by the write function if discard is false, and removes the temporary file.
+func (h *fixSQLHolder) release(discard bool) error {
+	defer h.close()
+	if discard {
+		return nil
+	}
+
+	if err := h.writer.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := h.file.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+
+	decoder := gob.NewDecoder(bufio.NewReader(h.file))
+	for {
+		var sql string
+		err := decoder.Decode(&sql)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = h.write(sql); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// close removes the temporary file, it can be called more than once.
+func (h *fixSQLHolder) close() {
+	if h.file == nil {
+		return
+	}
+
+	h.file.Close()
+	if err := os.Remove(h.file.Name()); err != nil {
+		log.Warn("remove held fix sql file", zap.String("file", h.file.Name()), zap.Error(err))
+	}
+	h.file = nil
+}
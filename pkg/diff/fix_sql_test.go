@@ -0,0 +1,169 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testFixSQLSuite{})
+
+type testFixSQLSuite struct{}
+
+func (s *testFixSQLSuite) TestFixSQLWriter(c *C) {
+	dir, err := ioutil.TempDir("", "fix-sql")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	w, err := NewFixSQLWriter(dir, 150)
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{
+		TargetTable: &TableInstance{Schema: "test", Table: "t1"},
+		Range:       "TRUE",
+		configHash:  "abc",
+	}
+	tw := w.TableWriter(td)
+
+	// no file is created if no sql is written
+	c.Assert(tw.Close(), IsNil)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+
+	tw = w.TableWriter(td)
+	sqls := []string{
+		"REPLACE INTO `test`.`t1`(`id`) VALUES (1);\n",
+		"DELETE FROM `test`.`t1` WHERE `id` = 2;\n",
+		"REPLACE INTO `test`.`t1`(`id`) VALUES (3);\n",
+	}
+	for _, sql := range sqls {
+		c.Assert(tw.Write(sql), IsNil)
+	}
+	c.Assert(tw.Stats(), DeepEquals, map[string]int64{"REPLACE": 2, "DELETE": 1})
+	c.Assert(tw.Close(), IsNil)
+
+	// the header's size is about 90, so every file can only save one sql
+	files, err = ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "test.t1.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(string(content), "-- table: `test`.`t1`\n-- config hash: abc\n-- time: "), IsTrue)
+	c.Assert(strings.HasSuffix(string(content), sqls[0]), IsTrue)
+
+	content, err = ioutil.ReadFile(filepath.Join(dir, "test.t1.2.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasSuffix(string(content), sqls[2]+"-- statistics: DELETE 1, REPLACE 2\n"), IsTrue)
+
+	// the comments are not counted
+	tw = w.TableWriter(&TableDiff{TargetTable: &TableInstance{Schema: "test", Table: "t2"}})
+	c.Assert(tw.Write("-- chunk 1: 3 different rows, where: \"(TRUE)\", args: []\n"), IsNil)
+	c.Assert(tw.Stats(), HasLen, 0)
+	c.Assert(tw.Close(), IsNil)
+
+	// the identifiers are escaped, the file is created in the directory, and doesn't collide with the rolled files
+	tw = w.TableWriter(&TableDiff{TargetTable: &TableInstance{Schema: "../test", Table: "t1.2"}})
+	c.Assert(tw.Write(sqls[0]), IsNil)
+	c.Assert(tw.Close(), IsNil)
+	_, err = os.Stat(filepath.Join(dir, "%2E%2E%2Ftest.t1%2E2.sql"))
+	c.Assert(err, IsNil)
+}
+
+func (s *testFixSQLSuite) TestEscapeFileName(c *C) {
+	testCases := []struct {
+		name    string
+		escaped string
+	}{
+		{"t_1-a", "t_1-a"},
+		{"a.b", "a%2Eb"},
+		{"../a/b\\c", "%2E%2E%2Fa%2Fb%5Cc"},
+		{"a%2Eb", "a%252Eb"},
+		{"a b", "a%20b"},
+		{"表", "表"},
+	}
+	for _, tc := range testCases {
+		c.Assert(escapeFileName(tc.name), Equals, tc.escaped, Commentf("%s", tc.name))
+	}
+}
+
+func (s *testFixSQLSuite) TestChunkComment(c *C) {
+	td := &TableDiff{
+		TargetTable: &TableInstance{Schema: "test", Table: "t1"},
+		sqlCh:       make(chan string, 2),
+		redact:      newRedactor(true, []string{"id"}),
+	}
+	chunk := &ChunkRange{ID: 3, Bounds: []*Bound{{Column: "id", Lower: "1", LowerSymbol: gt}}, Where: "((`id` > ?) AND TRUE)", Args: []string{"1"}}
+
+	td.sendChunkComment(chunk, &ChunkResult{DifferentRows: 2})
+	c.Assert(<-td.sqlCh, Equals, "-- chunk 3: 2 different rows, where: \"((`id` > ?) AND TRUE)\", args: [\"1\"]")
+
+	// the arguments are masked like the fix sqls
+	td.RedactFixSQL = true
+	td.sendChunkComment(chunk, &ChunkResult{DifferentRows: 2})
+	c.Assert(<-td.sqlCh, Equals, "-- chunk 3: 2 different rows, where: \"((`id` > ?) AND TRUE)\", args: [\"<redacted>\"]")
+
+	// the line breaks in the conditions and the arguments are escaped, they can't end the comment
+	td.RedactFixSQL = false
+	chunk = &ChunkRange{ID: 4, Where: "((`name` > ?) AND TRUE)\nDROP TABLE t;", Args: []string{"a\nDROP TABLE t;\r"}}
+	td.sendChunkComment(chunk, &ChunkResult{DifferentRows: 1})
+	comment := <-td.sqlCh
+	c.Assert(comment, Equals, "-- chunk 4: 1 different rows, where: \"((`name` > ?) AND TRUE)\\nDROP TABLE t;\", args: [\"a\\nDROP TABLE t;\\r\"]")
+	c.Assert(strings.ContainsAny(comment, "\r\n"), Equals, false)
+}
+
+func (s *testFixSQLSuite) TestFixSQLHolder(c *C) {
+	dir, err := ioutil.TempDir("", "fix-sql-holder")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	var written []string
+	write := func(sql string) error {
+		written = append(written, sql)
+		return nil
+	}
+	sqls := []string{"DELETE FROM `test`.`t` WHERE `id` = 1;\n", "REPLACE INTO `test`.`t`(`id`) VALUES (1);\n"}
+
+	// the held sqls are written in order when released
+	holder, err := newFixSQLHolder(dir, write)
+	c.Assert(err, IsNil)
+	for _, sql := range sqls {
+		c.Assert(holder.hold(sql), IsNil)
+	}
+	c.Assert(written, HasLen, 0)
+	c.Assert(holder.release(false), IsNil)
+	c.Assert(written, DeepEquals, sqls)
+
+	// nothing is written if discarded
+	written = nil
+	holder, err = newFixSQLHolder(dir, write)
+	c.Assert(err, IsNil)
+	for _, sql := range sqls {
+		c.Assert(holder.hold(sql), IsNil)
+	}
+	c.Assert(holder.release(true), IsNil)
+	c.Assert(written, HasLen, 0)
+
+	// the temporary files are removed
+	holder.close()
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const historyTableName = "history"
+
+// TableDrift is the change of a table's failed chunks between two consecutive runs.
+type TableDrift struct {
+	Schema       string `json:"schema"`
+	Table        string `json:"table"`
+	RunID        string `json:"run-id"`
+	ChunkNum     int64  `json:"chunk-num"`
+	FailedChunks int64  `json:"failed-chunks"`
+	// empty if the table is never checked before
+	PreviousRunID        string `json:"previous-run-id"`
+	PreviousFailedChunks int64  `json:"previous-failed-chunks"`
+}
+
+// Delta returns the number of failed chunks increased since the previous run, it's negative if decreased.
+func (d *TableDrift) Delta() int64 {
+	return d.FailedChunks - d.PreviousFailedChunks
+}
+
+// Growing returns true if the failed chunks grow run-over-run, the replication may decay.
+func (d *TableDrift) Growing() bool {
+	return len(d.PreviousRunID) != 0 && d.Delta() > 0
+}
+
+// createHistoryTable creates the table `history` saving every table's result of every run.
+func createHistoryTable(ctx context.Context, db *sql.DB) error {
+	createSchemaSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`;", checkpointSchemaName)
+	if _, err := db.ExecContext(ctx, createSchemaSQL); err != nil {
+		return errors.Trace(err)
+	}
+
+	/* example
+	mysql> select * from sync_diff_inspector.history;
+	+----------------+--------+-------+-----------+------------------+---------------------+
+	| run_id         | schema | table | chunk_num | check_failed_num | create_time         |
+	+----------------+--------+-------+-----------+------------------+---------------------+
+	| 20190326124142 | diff   | test1 |        10 |                1 | 2019-03-26 12:41:42 |
+	+----------------+--------+-------+-----------+------------------+---------------------+
+	*/
+	createHistoryTableSQL :=
+		"CREATE TABLE IF NOT EXISTS `" + checkpointSchemaName + "`.`" + historyTableName + "`(" +
+			"`run_id` varchar(64)," +
+			"`schema` varchar(64), `table` varchar(64)," +
+			"`chunk_num` int not null default 0," +
+			"`check_failed_num` int not null default 0," +
+			"`create_time` datetime DEFAULT CURRENT_TIMESTAMP," +
+			"PRIMARY KEY(`schema`, `table`, `run_id`));"
+	_, err := db.ExecContext(ctx, createHistoryTableSQL)
+	return errors.Trace(err)
+}
+
+// RecordRunHistory saves the table's result in this run into the table `history`, the result is read from the
+// table `summary`, and returns the drift compared with the table's previous run. returns nil if the table's check
+// is not finished.
+func RecordRunHistory(ctx context.Context, db *sql.DB, runID, schema, table string) (*TableDrift, error) {
+	total, _, failed, _, state, err := getTableSummary(ctx, db, schema, table)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	if state != successState && state != failedState {
+		return nil, nil
+	}
+
+	if err = createHistoryTable(ctx, db); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	drift := &TableDrift{
+		Schema:       schema,
+		Table:        table,
+		RunID:        runID,
+		ChunkNum:     total,
+		FailedChunks: failed,
+	}
+
+	query := fmt.Sprintf("SELECT `run_id`, `check_failed_num` FROM `%s`.`%s` WHERE `schema` = ? AND `table` = ? AND `run_id` <> ? ORDER BY `create_time` DESC, `run_id` DESC LIMIT 1",
+		checkpointSchemaName, historyTableName)
+	err = db.QueryRowContext(ctx, query, schema, table, runID).Scan(&drift.PreviousRunID, &drift.PreviousFailedChunks)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Trace(err)
+	}
+
+	replaceSQL := fmt.Sprintf("REPLACE INTO `%s`.`%s`(`run_id`, `schema`, `table`, `chunk_num`, `check_failed_num`) VALUES(?, ?, ?, ?, ?)",
+		checkpointSchemaName, historyTableName)
+	if _, err = db.ExecContext(ctx, replaceSQL, runID, schema, table, total, failed); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return drift, nil
+}
+
+// DriftNotifier is notified when a table's failed chunks grow run-over-run.
+type DriftNotifier interface {
+	NotifyDrift(ctx context.Context, drift *TableDrift) error
+}
+
+// webhookDriftNotifier posts the drift to a webhook.
+type webhookDriftNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookDriftNotifier returns a DriftNotifier which posts the drift in JSON to the url.
+func NewWebhookDriftNotifier(url string, timeout time.Duration) DriftNotifier {
+	return &webhookDriftNotifier{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (n *webhookDriftNotifier) NotifyDrift(ctx context.Context, drift *TableDrift) error {
+	body, err := json.Marshal(drift)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("post drift to %s failed, status %s", n.url, resp.Status)
+	}
+
+	log.Debug("post drift", zap.String("url", n.url), zap.Reflect("drift", drift))
+	return nil
+}
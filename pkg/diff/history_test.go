@@ -0,0 +1,98 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testHistorySuite{})
+
+type testHistorySuite struct{}
+
+func (s *testHistorySuite) TestRecordRunHistory(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	summaryColumns := []string{"chunk_num", "check_success_num", "check_failed_num", "check_ignore_num", "state"}
+	expectCreateTable := func() {
+		mock.ExpectExec("CREATE DATABASE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`history`").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	// the first run
+	mock.ExpectQuery("SELECT `chunk_num`").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows(summaryColumns).AddRow(10, 9, 1, 0, failedState))
+	expectCreateTable()
+	mock.ExpectQuery("SELECT `run_id`, `check_failed_num`").WithArgs("test", "t1", "run-1").WillReturnRows(sqlmock.NewRows([]string{"run_id", "check_failed_num"}))
+	mock.ExpectExec("REPLACE INTO `sync_diff_inspector`.`history`").WithArgs("run-1", "test", "t1", 10, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	drift, err := RecordRunHistory(context.Background(), db, "run-1", "test", "t1")
+	c.Assert(err, IsNil)
+	c.Assert(drift.PreviousRunID, Equals, "")
+	c.Assert(drift.Growing(), IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the failed chunks grow in the second run
+	mock.ExpectQuery("SELECT `chunk_num`").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows(summaryColumns).AddRow(10, 7, 3, 0, failedState))
+	expectCreateTable()
+	mock.ExpectQuery("SELECT `run_id`, `check_failed_num`").WithArgs("test", "t1", "run-2").WillReturnRows(sqlmock.NewRows([]string{"run_id", "check_failed_num"}).AddRow("run-1", 1))
+	mock.ExpectExec("REPLACE INTO `sync_diff_inspector`.`history`").WithArgs("run-2", "test", "t1", 10, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	drift, err = RecordRunHistory(context.Background(), db, "run-2", "test", "t1")
+	c.Assert(err, IsNil)
+	c.Assert(drift.PreviousRunID, Equals, "run-1")
+	c.Assert(drift.Delta(), Equals, int64(2))
+	c.Assert(drift.Growing(), IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the check is not finished
+	mock.ExpectQuery("SELECT `chunk_num`").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows(summaryColumns).AddRow(10, 5, 0, 0, notCheckedState))
+	drift, err = RecordRunHistory(context.Background(), db, "run-3", "test", "t1")
+	c.Assert(err, IsNil)
+	c.Assert(drift, IsNil)
+
+	// the table is not checked
+	mock.ExpectQuery("SELECT `chunk_num`").WithArgs("test", "t2").WillReturnRows(sqlmock.NewRows(summaryColumns))
+	drift, err = RecordRunHistory(context.Background(), db, "run-3", "test", "t2")
+	c.Assert(err, IsNil)
+	c.Assert(drift, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testHistorySuite) TestWebhookDriftNotifier(c *C) {
+	received := make(chan *TableDrift, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		drift := &TableDrift{}
+		if err := json.NewDecoder(r.Body).Decode(drift); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- drift
+	}))
+	defer server.Close()
+
+	drift := &TableDrift{Schema: "test", Table: "t1", RunID: "run-2", FailedChunks: 3, PreviousRunID: "run-1", PreviousFailedChunks: 1}
+	notifier := NewWebhookDriftNotifier(server.URL, time.Second)
+	c.Assert(notifier.NotifyDrift(context.Background(), drift), IsNil)
+	c.Assert(<-received, DeepEquals, drift)
+
+	notifier = NewWebhookDriftNotifier(server.URL+"/not-exist\x7f", time.Second)
+	c.Assert(notifier.NotifyDrift(context.Background(), drift), NotNil)
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// IndexResult is the result of comparing a secondary index's content in source and target tables.
+type IndexResult struct {
+	Index          string `json:"index"`
+	SourceChecksum int64  `json:"source-checksum"`
+	TargetChecksum int64  `json:"target-checksum"`
+	SourceCount    int64  `json:"source-count"`
+	TargetCount    int64  `json:"target-count"`
+}
+
+// Equal returns true if the index's content is equal in source and target.
+func (r *IndexResult) Equal() bool {
+	return r.SourceChecksum == r.TargetChecksum && r.SourceCount == r.TargetCount
+}
+
+// CheckIndexData compares every secondary index's content in source and target tables, by the checksum of the index's
+// columns and the primary key's columns read by FORCE INDEX, so the index diverged from its rows or from the source is
+// found even if the rows are equal. the indices contain the ignored columns or the columns with comparator are skipped,
+// and the indices don't exist in all the instances are skipped. returns the results of the compared indices.
+func (t *TableDiff) CheckIndexData(ctx context.Context) (bool, []*IndexResult, error) {
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		if table.Source != nil {
+			log.Warn("some table instances are not in database, skip the index check", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)))
+			return true, nil, nil
+		}
+	}
+
+	equal := true
+	var results []*IndexResult
+	for _, index := range t.TargetTable.info.Indices {
+		if index.Primary || !t.indexComparable(index) {
+			continue
+		}
+
+		result := &IndexResult{Index: index.Name.O}
+		var err error
+		result.TargetChecksum, result.TargetCount, err = getIndexChecksum(ctx, t.TargetTable, index.Name.L, t.TargetTable.mergeRange(t.Range))
+		if err != nil {
+			return false, nil, errors.Trace(err)
+		}
+
+		skipped := false
+		for _, source := range t.SourceTables {
+			checksum, count, err := getIndexChecksum(ctx, source, index.Name.L, source.mergeRange(t.Range))
+			if err != nil {
+				if errors.IsNotFound(err) {
+					log.Warn("index doesn't exist in source table, skip it", zap.String("table", dbutil.TableName(source.Schema, source.Table)), zap.String("index", index.Name.O))
+					skipped = true
+					break
+				}
+				return false, nil, errors.Trace(err)
+			}
+			result.SourceChecksum ^= checksum
+			result.SourceCount += count
+		}
+		if skipped {
+			continue
+		}
+
+		if !result.Equal() {
+			equal = false
+			log.Warn("index data is not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Reflect("result", result))
+		}
+		results = append(results, result)
+	}
+
+	return equal, results, nil
+}
+
+// indexComparable returns false if the index contains the ignored columns or the columns with comparator,
+// their values in index may be different legally.
+func (t *TableDiff) indexComparable(index *model.IndexInfo) bool {
+	for _, indexCol := range index.Columns {
+		for _, col := range t.IgnoreColumns {
+			if col == indexCol.Name.O {
+				return false
+			}
+		}
+		if _, ok := t.ColumnComparators[indexCol.Name.O]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// getIndexChecksum returns the checksum and the number of rows of the table instance's index, returns NotFound error
+// if the instance doesn't have the index.
+func getIndexChecksum(ctx context.Context, table *TableInstance, indexName string, limitRange string) (int64, int64, error) {
+	for _, index := range table.info.Indices {
+		if index.Name.L != indexName {
+			continue
+		}
+
+		checksum, count, err := dbutil.GetIndexCRC32ChecksumWithCount(ctx, table.Conn, table.Schema, table.Table, table.info, index, limitRange, nil)
+		return checksum, count, errors.Trace(err)
+	}
+
+	return 0, 0, errors.NotFoundf("index %s in %s", indexName, dbutil.TableName(table.Schema, table.Table))
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testIndexCheckSuite{})
+
+type testIndexCheckSuite struct{}
+
+func (s *testIndexCheckSuite) TestCheckIndexData(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	targetInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`id` int, `name` varchar(24), `age` int, `note` text, primary key(`id`), key `idx_name`(`name`), key `idx_age`(`age`), key `idx_note`(`note`(10)))")
+	c.Assert(err, IsNil)
+	sourceInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`id` int, `name` varchar(24), `age` int, `note` text, primary key(`id`), key `idx_name`(`name`), key `idx_note`(`note`(10)))")
+	c.Assert(err, IsNil)
+
+	td := &TableDiff{
+		SourceTables:  []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "t", info: sourceInfo}},
+		TargetTable:   &TableInstance{Conn: targetDB, Schema: "test", Table: "t", info: targetInfo},
+		IgnoreColumns: []string{"note"},
+		Range:         "TRUE",
+	}
+
+	checksumColumns := []string{"checksum", "count"}
+	// idx_age doesn't exist in source, idx_note contains the ignored column
+	targetMock.ExpectQuery("SELECT .* FROM `test`.`t` FORCE INDEX\\(`idx_name`\\) WHERE TRUE").WillReturnRows(sqlmock.NewRows(checksumColumns).AddRow(123, 10))
+	sourceMock.ExpectQuery("SELECT .* FROM `test`.`t` FORCE INDEX\\(`idx_name`\\) WHERE TRUE").WillReturnRows(sqlmock.NewRows(checksumColumns).AddRow(456, 10))
+	targetMock.ExpectQuery("SELECT .* FROM `test`.`t` FORCE INDEX\\(`idx_age`\\) WHERE TRUE").WillReturnRows(sqlmock.NewRows(checksumColumns).AddRow(789, 10))
+
+	equal, results, err := td.CheckIndexData(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+	c.Assert(results, DeepEquals, []*IndexResult{{Index: "idx_name", SourceChecksum: 456, TargetChecksum: 123, SourceCount: 10, TargetCount: 10}})
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// the states of the chunks being checked
+const (
+	InFlightWaiting   = "waiting for limiter"
+	InFlightCounting  = "counting rows"
+	InFlightChecksum  = "calculating checksum"
+	InFlightAggregate = "calculating aggregates"
+	InFlightComparing = "comparing rows"
+)
+
+// InFlightChunk is a chunk being checked.
+type InFlightChunk struct {
+	Schema    string    `json:"schema"`
+	Table     string    `json:"table"`
+	ChunkID   int64     `json:"chunk-id"`
+	Where     string    `json:"where"`
+	Args      []string  `json:"args"`
+	State     string    `json:"state"`
+	StartTime time.Time `json:"start-time"`
+}
+
+// InFlightTracker tracks the chunks being checked, can be shared by the tables' diffs.
+// it's used to diagnose the hanged checks, for example which chunks are waiting for the limiters.
+type InFlightTracker struct {
+	sync.Mutex
+
+	nextID uint64
+	chunks map[uint64]*InFlightChunk
+}
+
+// NewInFlightTracker returns a new InFlightTracker.
+func NewInFlightTracker() *InFlightTracker {
+	return &InFlightTracker{
+		chunks: make(map[uint64]*InFlightChunk),
+	}
+}
+
+// start tracks the chunk, returns the id used to update and finish it. it does nothing if the tracker is nil.
+func (t *InFlightTracker) start(schema, table string, chunk *ChunkRange) uint64 {
+	if t == nil {
+		return 0
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.nextID++
+	t.chunks[t.nextID] = &InFlightChunk{
+		Schema:    schema,
+		Table:     table,
+		ChunkID:   chunk.ID,
+		Where:     chunk.Where,
+		Args:      chunk.Args,
+		State:     InFlightWaiting,
+		StartTime: time.Now(),
+	}
+	return t.nextID
+}
+
+func (t *InFlightTracker) setState(id uint64, state string) {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if chunk, ok := t.chunks[id]; ok {
+		chunk.State = state
+	}
+}
+
+func (t *InFlightTracker) finish(id uint64) {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.chunks, id)
+}
+
+// Snapshot returns the chunks being checked, ordered by the start time.
+func (t *InFlightTracker) Snapshot() []InFlightChunk {
+	t.Lock()
+	defer t.Unlock()
+
+	chunks := make([]InFlightChunk, 0, len(t.chunks))
+	for _, chunk := range t.chunks {
+		chunks = append(chunks, *chunk)
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].StartTime.Before(chunks[j].StartTime)
+	})
+
+	return chunks
+}
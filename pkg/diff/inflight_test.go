@@ -0,0 +1,52 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testInFlightSuite{})
+
+type testInFlightSuite struct{}
+
+func (s *testInFlightSuite) TestInFlightTracker(c *C) {
+	tracker := NewInFlightTracker()
+	c.Assert(tracker.Snapshot(), HasLen, 0)
+
+	id1 := tracker.start("test", "t1", &ChunkRange{ID: 1, Where: "(`a` < ?)", Args: []string{"1"}})
+	id2 := tracker.start("test", "t2", &ChunkRange{ID: 2, Where: "TRUE"})
+	tracker.setState(id2, InFlightChecksum)
+
+	chunks := tracker.Snapshot()
+	c.Assert(chunks, HasLen, 2)
+	c.Assert(chunks[0].Table, Equals, "t1")
+	c.Assert(chunks[0].ChunkID, Equals, int64(1))
+	c.Assert(chunks[0].Where, Equals, "(`a` < ?)")
+	c.Assert(chunks[0].Args, DeepEquals, []string{"1"})
+	c.Assert(chunks[0].State, Equals, InFlightWaiting)
+	c.Assert(chunks[1].Table, Equals, "t2")
+	c.Assert(chunks[1].State, Equals, InFlightChecksum)
+
+	tracker.finish(id1)
+	chunks = tracker.Snapshot()
+	c.Assert(chunks, HasLen, 1)
+	c.Assert(chunks[0].Table, Equals, "t2")
+
+	// the nil tracker does nothing
+	var nilTracker *InFlightTracker
+	id := nilTracker.start("test", "t1", &ChunkRange{})
+	nilTracker.setState(id, InFlightComparing)
+	nilTracker.finish(id)
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// ConcurrencyLimiter limits the number of chunks checked concurrently in a database instance,
+// it can be shared by the TableInstances in different TableDiffs to limit the concurrency across tables.
+type ConcurrencyLimiter struct {
+	sync.Mutex
+
+	name    string
+	limit   int
+	running int
+	// closed to wake up the waiters when a token is released or the limit is changed
+	notifyCh chan struct{}
+}
+
+// NewConcurrencyLimiter returns a ConcurrencyLimiter which allows at most n chunks checked concurrently, 0 means no limit.
+// name is used to acquire limiters in a fixed order, should be unique, for example the instance id.
+func NewConcurrencyLimiter(name string, n int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		name:     name,
+		limit:    n,
+		notifyCh: make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a chunk can be checked, or the context is done.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	for {
+		l.Lock()
+		if l.limit <= 0 || l.running < l.limit {
+			l.running++
+			l.Unlock()
+			return nil
+		}
+		notifyCh := l.notifyCh
+		l.Unlock()
+
+		select {
+		case <-notifyCh:
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+}
+
+// Release releases the token acquired by Acquire.
+func (l *ConcurrencyLimiter) Release() {
+	l.Lock()
+	defer l.Unlock()
+
+	l.running--
+	l.notify()
+}
+
+// SetLimit changes the max number of chunks checked concurrently, 0 means no limit. the chunks being checked are not
+// affected if the limit is decreased, the new chunks wait until the number of running chunks is less than the limit.
+func (l *ConcurrencyLimiter) SetLimit(n int) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.limit = n
+	l.notify()
+}
+
+// Limit returns the max number of chunks checked concurrently, 0 means no limit.
+func (l *ConcurrencyLimiter) Limit() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.limit
+}
+
+// Running returns the number of chunks being checked.
+func (l *ConcurrencyLimiter) Running() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.running
+}
+
+func (l *ConcurrencyLimiter) notify() {
+	close(l.notifyCh)
+	l.notifyCh = make(chan struct{})
+}
+
+// acquireLimiters acquires all the limiters of the instances, returns a function to release them.
+// the limiters are acquired in the order of name to avoid deadlock, and the same limiter is only acquired once.
+func acquireLimiters(ctx context.Context, instances []*TableInstance) (func(), error) {
+	limiterMap := make(map[*ConcurrencyLimiter]struct{})
+	limiters := make([]*ConcurrencyLimiter, 0, len(instances))
+	for _, instance := range instances {
+		if instance.Limiter == nil {
+			continue
+		}
+		if _, ok := limiterMap[instance.Limiter]; ok {
+			continue
+		}
+		limiterMap[instance.Limiter] = struct{}{}
+		limiters = append(limiters, instance.Limiter)
+	}
+	sort.Slice(limiters, func(i, j int) bool {
+		return limiters[i].name < limiters[j].name
+	})
+
+	release := func(acquired []*ConcurrencyLimiter) {
+		for i := len(acquired) - 1; i >= 0; i-- {
+			acquired[i].Release()
+		}
+	}
+
+	for i, limiter := range limiters {
+		if err := limiter.Acquire(ctx); err != nil {
+			release(limiters[:i])
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return func() { release(limiters) }, nil
+}
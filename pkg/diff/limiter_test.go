@@ -0,0 +1,79 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testLimiterSuite{})
+
+type testLimiterSuite struct{}
+
+func (s *testLimiterSuite) TestAcquireLimiters(c *C) {
+	limiter1 := NewConcurrencyLimiter("source-1", 1)
+	limiter2 := NewConcurrencyLimiter("target", 2)
+
+	instances := []*TableInstance{
+		{InstanceID: "target", Limiter: limiter2},
+		{InstanceID: "source-1", Limiter: limiter1},
+		// sharding tables in the same instance share the limiter
+		{InstanceID: "source-1", Limiter: limiter1},
+		{InstanceID: "source-2"},
+	}
+
+	release, err := acquireLimiters(context.Background(), instances)
+	c.Assert(err, IsNil)
+	c.Assert(limiter1.running, Equals, 1)
+	c.Assert(limiter2.running, Equals, 1)
+
+	// source-1 is full, the second acquire will be blocked until timeout, and release the acquired target's token
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = acquireLimiters(ctx, instances)
+	c.Assert(err, NotNil)
+	c.Assert(limiter2.running, Equals, 1)
+
+	release()
+	c.Assert(limiter1.running, Equals, 0)
+	c.Assert(limiter2.running, Equals, 0)
+}
+
+func (s *testLimiterSuite) TestSetLimit(c *C) {
+	limiter := NewConcurrencyLimiter("target", 1)
+	c.Assert(limiter.Acquire(context.Background()), IsNil)
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- limiter.Acquire(context.Background())
+	}()
+	select {
+	case <-acquired:
+		c.Fatal("acquire should be blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the waiter is woken up after the limit is increased
+	limiter.SetLimit(2)
+	c.Assert(<-acquired, IsNil)
+	c.Assert(limiter.Limit(), Equals, 2)
+
+	// 0 means no limit
+	limiter.SetLimit(0)
+	c.Assert(limiter.Acquire(context.Background()), IsNil)
+	c.Assert(limiter.Running(), Equals, 3)
+}
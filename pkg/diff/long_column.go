@@ -0,0 +1,158 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// isLongColumn returns true if the column's values may be too large to be transferred, like TEXT and BLOB.
+// TINYTEXT and TINYBLOB are not long, their values are shorter than the hash.
+func isLongColumn(col *model.ColumnInfo) bool {
+	switch col.Tp {
+	case mysql.TypeBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob:
+		return true
+	}
+	return false
+}
+
+// longColumnHashExpr returns the expression of the value's length and SHA1, which is compared instead of the value.
+func longColumnHashExpr(expr string) string {
+	return fmt.Sprintf("CONCAT(LENGTH(%s), ':', SHA1(%s))", expr, expr)
+}
+
+// columnExpr returns the expression selected for the column in the table instance.
+func (t *TableInstance) columnExpr(column string) string {
+	if expr, ok := t.ColumnExprs[column]; ok {
+		return fmt.Sprintf("(%s)", expr)
+	}
+	return fmt.Sprintf("`%s`", column)
+}
+
+// rowExprs returns the expressions selected instead of the columns in the rows' queries.
+func (t *TableInstance) rowExprs() map[string]string {
+	if t.rowColumnExprs != nil {
+		return t.rowColumnExprs
+	}
+	return t.ColumnExprs
+}
+
+// setLongColumnHashes selects the hashes of the long columns instead of the values when comparing the rows if
+// HashLongColumns is true. the long columns are decided by the target table, so all the instances select the same
+// columns' hashes. the columns of the order key and with comparators are compared by values.
+func (t *TableDiff) setLongColumnHashes() error {
+	t.hashedColumns = nil
+	if !t.HashLongColumns {
+		return nil
+	}
+
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(t.TargetTable.info)
+	hashedColumns := make(map[string]struct{})
+	for _, col := range t.TargetTable.info.Columns {
+		if !isLongColumn(col) || dbutil.FindColumnByName(orderKeyCols, col.Name.O) != nil {
+			continue
+		}
+		if _, ok := t.ColumnComparators[col.Name.O]; ok {
+			continue
+		}
+		hashedColumns[col.Name.O] = struct{}{}
+	}
+	if len(hashedColumns) == 0 {
+		return nil
+	}
+
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		if _, ok := table.rowSource().(*sqlRowSource); !ok {
+			return errors.NotSupportedf("hashing the long columns for the row source of %s", table.InstanceID)
+		}
+
+		table.rowColumnExprs = make(map[string]string, len(table.ColumnExprs)+len(hashedColumns))
+		for column, expr := range table.ColumnExprs {
+			table.rowColumnExprs[column] = expr
+		}
+		for column := range hashedColumns {
+			table.rowColumnExprs[column] = longColumnHashExpr(table.columnExpr(column))
+		}
+	}
+	t.hashedColumns = hashedColumns
+
+	return nil
+}
+
+// rawRowData returns the row's data with the raw values of the hashed long columns, which are selected from the
+// table instance by the order key, so the fix sql writes the values instead of the hashes.
+func (t *TableDiff) rawRowData(ctx context.Context, table *TableInstance, data map[string]*dbutil.ColumnData, orderKeyCols []*model.ColumnInfo) (map[string]*dbutil.ColumnData, error) {
+	if t.skipFix || len(t.hashedColumns) == 0 {
+		return data, nil
+	}
+
+	columns := make([]string, 0, len(t.hashedColumns))
+	for _, col := range table.info.Columns {
+		if _, ok := t.hashedColumns[col.Name.O]; ok {
+			columns = append(columns, fmt.Sprintf("%s AS `%s`", table.columnExpr(col.Name.O), col.Name.O))
+		}
+	}
+
+	conditions := make([]string, 0, len(orderKeyCols))
+	args := make([]interface{}, 0, len(orderKeyCols))
+	for _, col := range orderKeyCols {
+		// the rows with NULL in the nullable unique key are also ordered by the hashed columns
+		if _, ok := t.hashedColumns[col.Name.O]; ok {
+			continue
+		}
+		if data[col.Name.O].IsNull {
+			conditions = append(conditions, fmt.Sprintf("%s IS NULL", table.columnExpr(col.Name.O)))
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = ?", table.columnExpr(col.Name.O)))
+		args = append(args, string(data[col.Name.O].Data))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(columns, ", "), dbutil.TableName(table.Schema, table.Table), strings.Join(conditions, " AND "))
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutRowFetch)
+	defer cancel1()
+	rows, err := table.Conn.QueryContext(ctx1, query, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// the row is deleted after compared
+		return nil, errors.NotFoundf("raw values of the different row in %s.%s.%s", table.InstanceID, table.Schema, table.Table)
+	}
+	rawData, err := dbutil.ScanRow(rows)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	newData := make(map[string]*dbutil.ColumnData, len(data))
+	for column, value := range data {
+		newData[column] = value
+	}
+	for column, value := range rawData {
+		newData[column] = value
+	}
+	return newData, nil
+}
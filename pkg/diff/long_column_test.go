@@ -0,0 +1,90 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testLongColumnSuite{})
+
+type testLongColumnSuite struct{}
+
+func (s *testLongColumnSuite) TestSetLongColumnHashes(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` int, `k` blob, `body` text, `note` tinytext, `email` longtext, `v` varchar(10), PRIMARY KEY (`id`, `k`(10)))")
+	c.Assert(err, IsNil)
+
+	target := &TableInstance{Schema: "test", Table: "t", InstanceID: "target", info: tableInfo}
+	source := &TableInstance{Schema: "test", Table: "t", InstanceID: "source", info: tableInfo, ColumnExprs: map[string]string{"body": "LOWER(`body`)"}}
+	td := &TableDiff{
+		TargetTable:       target,
+		SourceTables:      []*TableInstance{source},
+		ColumnComparators: map[string]string{"email": ComparatorCaseInsensitive},
+	}
+	c.Assert(td.setLongColumnHashes(), IsNil)
+	c.Assert(td.hashedColumns, IsNil)
+	c.Assert(source.rowExprs(), DeepEquals, source.ColumnExprs)
+
+	// the columns of the order key, with comparators and TINYTEXT are not hashed
+	td.HashLongColumns = true
+	c.Assert(td.setLongColumnHashes(), IsNil)
+	c.Assert(td.hashedColumns, DeepEquals, map[string]struct{}{"body": {}})
+	c.Assert(target.rowExprs(), DeepEquals, map[string]string{"body": "CONCAT(LENGTH(`body`), ':', SHA1(`body`))"})
+	c.Assert(source.rowExprs(), DeepEquals, map[string]string{"body": "CONCAT(LENGTH((LOWER(`body`))), ':', SHA1((LOWER(`body`))))"})
+
+	// the files don't support the expressions
+	source.Source = &fileRowSource{}
+	c.Assert(td.setLongColumnHashes(), ErrorMatches, ".*not supported")
+}
+
+func (s *testLongColumnSuite) TestRawRowData(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` int, `body` text, `v` varchar(10), PRIMARY KEY (`id`))")
+	c.Assert(err, IsNil)
+	table := &TableInstance{Conn: db, Schema: "test", Table: "t", InstanceID: "target", info: tableInfo}
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+
+	data := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"body": {Data: []byte("5:aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d")},
+		"v":    {Data: []byte("x")},
+	}
+
+	// the data is not changed if no column is hashed
+	td := &TableDiff{TargetTable: table}
+	rawData, err := td.rawRowData(context.Background(), table, data, orderKeyCols)
+	c.Assert(err, IsNil)
+	c.Assert(rawData, DeepEquals, data)
+
+	td.hashedColumns = map[string]struct{}{"body": {}}
+	mock.ExpectQuery("SELECT `body` AS `body` FROM `test`.`t` WHERE `id` = \\?").WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"body"}).AddRow("hello"))
+	rawData, err = td.rawRowData(context.Background(), table, data, orderKeyCols)
+	c.Assert(err, IsNil)
+	c.Assert(string(rawData["body"].Data), Equals, "hello")
+	c.Assert(rawData["v"], Equals, data["v"])
+	c.Assert(string(data["body"].Data), Equals, "5:aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d")
+
+	// the row is deleted after compared
+	mock.ExpectQuery("SELECT `body` AS `body` FROM `test`.`t` WHERE `id` = \\?").WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"body"}))
+	_, err = td.rawRowData(context.Background(), table, data, orderKeyCols)
+	c.Assert(err, ErrorMatches, ".*not found")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// MemoryLimiter tracks the approximate bytes of the rows buffered to compare, can be shared by all the TableDiffs in one
+// run. the rows are spilled to the temporary files when the budget is exceeded, instead of growing unbounded.
+// if the hard limit is set, the chunks reserve the memory before reading their rows, and wait until the bytes in use
+// are less than the limit, so the concurrent wide chunks are not read at the same time.
+type MemoryLimiter struct {
+	sync.Mutex
+
+	budget int64
+	inUse  int64
+	// the directory of the temporary files, the system's default if is empty
+	spillDir string
+
+	// the hard limit of the bytes in use, 0 means no limit
+	hardLimit int64
+	// closed and renewed when the bytes are released, to wake up the waiting chunks
+	released chan struct{}
+}
+
+// NewMemoryLimiter returns a MemoryLimiter with the budget in bytes, the rows are spilled to the temporary files in
+// spillDir when the budget is exceeded. the rows are never spilled if budget is 0.
+func NewMemoryLimiter(budget int64, spillDir string) *MemoryLimiter {
+	if budget <= 0 {
+		budget = math.MaxInt64
+	}
+	return &MemoryLimiter{
+		budget:   budget,
+		spillDir: spillDir,
+		released: make(chan struct{}),
+	}
+}
+
+// SetHardLimit sets the hard limit of the bytes in use, the chunks wait before reading their rows when it's reached.
+// 0 means no limit.
+func (l *MemoryLimiter) SetHardLimit(limit int64) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.hardLimit = limit
+}
+
+// tryConsume consumes the bytes, returns false if the budget is exceeded, and the bytes are not consumed.
+// it always succeeds if the limiter is nil.
+func (l *MemoryLimiter) tryConsume(n int64) bool {
+	if l == nil {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.inUse+n > l.budget {
+		return false
+	}
+	l.inUse += n
+	return true
+}
+
+// consume consumes the bytes even if the budget is exceeded, for example the row is larger than the budget.
+func (l *MemoryLimiter) consume(n int64) {
+	if l == nil {
+		return
+	}
+
+	l.Lock()
+	l.inUse += n
+	l.Unlock()
+}
+
+// release releases the consumed bytes.
+func (l *MemoryLimiter) release(n int64) {
+	if l == nil {
+		return
+	}
+
+	l.Lock()
+	l.inUse -= n
+	if n > 0 {
+		close(l.released)
+		l.released = make(chan struct{})
+	}
+	l.Unlock()
+}
+
+// reserve reserves n bytes for a chunk before reading its rows, waits until the bytes in use and n are not greater than
+// the hard limit. it never waits if nothing is in use, so a chunk larger than the limit can still be checked.
+// the reserved bytes are used by the chunk's rowBuffers first, and should be released by the reservation.
+func (l *MemoryLimiter) reserve(ctx context.Context, n int64) (*memoryReservation, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	waited := false
+	for {
+		l.Lock()
+		if l.hardLimit <= 0 || l.inUse == 0 || l.inUse+n <= l.hardLimit {
+			l.inUse += n
+			l.Unlock()
+			return &memoryReservation{limiter: l, reserved: n}, nil
+		}
+		released := l.released
+		inUse := l.inUse
+		l.Unlock()
+
+		if !waited {
+			log.Debug("memory hard limit is reached, wait for the other chunks", zap.Int64("in use", inUse), zap.Int64("reserve", n))
+			waited = true
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, errors.Trace(ctx.Err())
+		}
+	}
+}
+
+// memoryReservation is the bytes reserved by a chunk, shared by the chunk's rowBuffers.
+type memoryReservation struct {
+	sync.Mutex
+
+	limiter  *MemoryLimiter
+	reserved int64
+	used     int64
+}
+
+// take uses n bytes of the reservation, returns false if the reservation is not enough.
+func (r *memoryReservation) take(n int64) bool {
+	if r == nil {
+		return false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.used+n > r.reserved {
+		return false
+	}
+	r.used += n
+	return true
+}
+
+// put returns the bytes taken from the reservation.
+func (r *memoryReservation) put(n int64) {
+	if r == nil || n == 0 {
+		return
+	}
+
+	r.Lock()
+	r.used -= n
+	r.Unlock()
+}
+
+// release releases the reservation to the limiter.
+func (r *memoryReservation) release() {
+	if r == nil {
+		return
+	}
+
+	r.limiter.release(r.reserved)
+}
+
+// InUse returns the bytes in use.
+func (l *MemoryLimiter) InUse() int64 {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.inUse
+}
+
+// estimateChunkBytes returns the average bytes of the chunks compared by rows, 0 if no chunk is compared.
+func (t *TableDiff) estimateChunkBytes() int64 {
+	chunks := atomic.LoadInt64(&t.comparedChunks)
+	if chunks == 0 {
+		return 0
+	}
+	return atomic.LoadInt64(&t.comparedBytes) / chunks
+}
@@ -14,8 +14,10 @@
 package diff
 
 import (
+	"container/heap"
 	"strconv"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
@@ -50,18 +52,19 @@ func (r RowDatas) Less(i, j int) bool {
 		data1 = col1.Data
 		data2 = col2.Data
 
+		// `NULL` is less than any value
+		if col1.IsNull || col2.IsNull {
+			if col1.IsNull && col2.IsNull {
+				continue
+			}
+			return col1.IsNull
+		}
+
 		if needQuotes(col.FieldType) {
 			strData1 := string(data1)
 			strData2 := string(data2)
 
 			if strData1 == strData2 {
-				// `NULL` is less than ""
-				if r.Rows[i].Data[col.Name.O].IsNull {
-					return true
-				}
-				if r.Rows[j].Data[col.Name.O].IsNull {
-					return false
-				}
 				continue
 			}
 			if strData1 > strData2 {
@@ -69,22 +72,15 @@ func (r RowDatas) Less(i, j int) bool {
 			}
 			return true
 		}
-		num1, err1 := strconv.ParseFloat(string(data1), 64)
-		if err1 != nil {
-			log.Fatal("convert string to float failed", zap.ByteString("data", data1), zap.Error(err1))
-		}
-		num2, err2 := strconv.ParseFloat(string(data2), 64)
-		if err2 != nil {
-			log.Fatal("convert string to float failed", zap.ByteString("data", data2), zap.Error(err2))
+		cmp, err := compareNumber(col, data1, data2)
+		if err != nil {
+			log.Fatal("compare numbers failed", zap.ByteString("data1", data1), zap.ByteString("data2", data2), zap.Error(err))
 		}
 
-		if num1 == num2 {
+		if cmp == 0 {
 			continue
 		}
-		if num1 > num2 {
-			return false
-		}
-		return true
+		return cmp < 0
 
 	}
 
@@ -105,3 +101,65 @@ func (r *RowDatas) Pop() interface{} {
 	r.Rows = old[0 : n-1]
 	return x
 }
+
+// mergedRowIterator merges the ordered rows of the source instances by the order keys, only one row of every source
+// is kept in the heap.
+type mergedRowIterator struct {
+	iters  []*rowIterator
+	tables []*TableInstance
+	rows   *RowDatas
+	// the sources whose next row should be pushed into the heap
+	pending []int
+}
+
+func newMergedRowIterator(buffers []*rowBuffer, tables []*TableInstance, orderKeyCols []*model.ColumnInfo) (*mergedRowIterator, error) {
+	m := &mergedRowIterator{
+		iters:  make([]*rowIterator, 0, len(buffers)),
+		tables: tables,
+		rows: &RowDatas{
+			Rows:         make([]RowData, 0, len(buffers)),
+			OrderKeyCols: orderKeyCols,
+		},
+		pending: make([]int, 0, len(buffers)),
+	}
+	for i, buffer := range buffers {
+		iter, err := buffer.iter()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		m.iters = append(m.iters, iter)
+		m.pending = append(m.pending, i)
+	}
+	heap.Init(m.rows)
+
+	return m, nil
+}
+
+// next returns the smallest row and its source table, returns nil if all the rows are read.
+func (m *mergedRowIterator) next() (map[string]*dbutil.ColumnData, *TableInstance, error) {
+	for _, i := range m.pending {
+		row, err := m.iters[i].next()
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		if row != nil {
+			heap.Push(m.rows, RowData{
+				Data:   row,
+				Source: strconv.Itoa(i),
+			})
+		}
+	}
+	m.pending = m.pending[:0]
+
+	if m.rows.Len() == 0 {
+		return nil, nil, nil
+	}
+	rowData := heap.Pop(m.rows).(RowData)
+	i, err := strconv.Atoi(rowData.Source)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	m.pending = append(m.pending, i)
+
+	return rowData.Data, m.tables[i], nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// nullableUniqueKey returns the columns of the table's unique order key if it's a unique index with nullable columns,
+// returns nil if the order key is the primary key, a not NULL unique index or all the columns. the rows with NULL in
+// the key don't conflict, so they may be duplicated.
+func nullableUniqueKey(tableInfo *model.TableInfo) []*model.ColumnInfo {
+	if tableInfo.PKIsHandle {
+		return nil
+	}
+
+	hasUnique := false
+	for _, index := range tableInfo.Indices {
+		if index.Primary {
+			return nil
+		}
+		hasUnique = hasUnique || index.Unique
+	}
+	if !hasUnique {
+		return nil
+	}
+
+	_, keyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+	for _, col := range keyCols {
+		if !mysql.HasNotNullFlag(col.Flag) {
+			return keyCols
+		}
+	}
+
+	return nil
+}
+
+// rowOrderKeyCols returns the columns which the chunk's rows are ordered by. it's the unique order key, and the other
+// selected columns are appended if the key is a nullable unique key, so the duplicated rows with NULL in the key are
+// adjacent and in the same order in every instance.
+func rowOrderKeyCols(tableInfo *model.TableInfo, ignoreColumns map[string]interface{}) []*model.ColumnInfo {
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+	if nullableUniqueKey(tableInfo) == nil {
+		return orderKeyCols
+	}
+
+	for _, col := range tableInfo.Columns {
+		if _, ok := ignoreColumns[col.Name.O]; ok {
+			continue
+		}
+		if col.Name.O == dbutil.ImplicitColName || dbutil.FindColumnByName(orderKeyCols, col.Name.O) != nil {
+			continue
+		}
+		orderKeyCols = append(orderKeyCols, col)
+	}
+
+	return orderKeyCols
+}
+
+// removeColumn returns the columns without the named column.
+func removeColumn(cols []*model.ColumnInfo, name string) []*model.ColumnInfo {
+	kept := make([]*model.ColumnInfo, 0, len(cols))
+	for _, col := range cols {
+		if col.Name.O != name {
+			kept = append(kept, col)
+		}
+	}
+	return kept
+}
+
+// hasNullKey returns true if any column of the key is NULL in the row.
+func hasNullKey(row map[string]*dbutil.ColumnData, keyCols []*model.ColumnInfo) bool {
+	for _, col := range keyCols {
+		if data, ok := row[col.Name.O]; ok && data.IsNull {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicatedRows is a group of the identical rows with NULL in the nullable unique key, which are compared by the
+// counts in the source tables and the target table instead of one by one.
+type duplicatedRows struct {
+	// the rows of the source tables, in the order of the tables
+	sources    []*TableInstance
+	sourceRows []map[string]*dbutil.ColumnData
+	sourceNums []int
+
+	targetRow map[string]*dbutil.ColumnData
+	targetNum int
+}
+
+func (d *duplicatedRows) addSource(table *TableInstance, row map[string]*dbutil.ColumnData) {
+	for i, source := range d.sources {
+		if source == table {
+			d.sourceNums[i]++
+			return
+		}
+	}
+	d.sources = append(d.sources, table)
+	d.sourceRows = append(d.sourceRows, row)
+	d.sourceNums = append(d.sourceNums, 1)
+}
+
+func (d *duplicatedRows) addTarget(row map[string]*dbutil.ColumnData) {
+	d.targetRow = row
+	d.targetNum++
+}
+
+func (d *duplicatedRows) sourceNum() int {
+	num := 0
+	for _, n := range d.sourceNums {
+		num += n
+	}
+	return num
+}
+
+// differentRows returns the number of the rows only exist in the source tables or the target table.
+func (d *duplicatedRows) differentRows() int {
+	if num := d.sourceNum() - d.targetNum; num > 0 {
+		return num
+	}
+	return d.targetNum - d.sourceNum()
+}
+
+// keptSourceNums returns the number of the rows kept in every source table if the source tables are fixed, the
+// target's rows are kept in the source tables in order.
+func (d *duplicatedRows) keptSourceNums() []int {
+	kept := make([]int, len(d.sourceNums))
+	remain := d.targetNum
+	for i, n := range d.sourceNums {
+		if n > remain {
+			n = remain
+		}
+		kept[i] = n
+		remain -= n
+	}
+	return kept
+}
+
+// fixDuplicatedRows exports the different rows of the group and generates the fix sqls. the identical rows can't be
+// deleted one by one by the keys, so they are all deleted and the kept rows are inserted again.
+func (t *TableDiff) fixDuplicatedRows(ctx context.Context, rows *duplicatedRows, orderKeyCols []*model.ColumnInfo) error {
+	sourceNum := rows.sourceNum()
+	kept := rows.keptSourceNums()
+
+	var err error
+	targetRow := rows.targetRow
+	if rows.targetNum > sourceNum {
+		for i := sourceNum; i < rows.targetNum; i++ {
+			t.exportRowDiff(nil, nil, targetRow, orderKeyCols)
+		}
+		if targetRow, err = t.rawRowData(ctx, t.TargetTable, targetRow, orderKeyCols); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	sourceRows := make([]map[string]*dbutil.ColumnData, len(rows.sources))
+	for i, source := range rows.sources {
+		for j := kept[i]; j < rows.sourceNums[i]; j++ {
+			t.exportRowDiff(source, rows.sourceRows[i], nil, orderKeyCols)
+		}
+		sourceRows[i] = rows.sourceRows[i]
+		if kept[i] < rows.sourceNums[i] {
+			if sourceRows[i], err = t.rawRowData(ctx, source, sourceRows[i], orderKeyCols); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+
+	if t.skipFix {
+		return nil
+	}
+
+	if !t.ReverseFixSQL {
+		if rows.targetNum > sourceNum {
+			if err = t.addDelete(); err != nil {
+				return errors.Trace(err)
+			}
+			t.sendFixSQL("[delete]", func(dialect Dialect) string {
+				return generateDML(dialect, "delete", targetRow, orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
+			})
+			for i := 0; i < sourceNum; i++ {
+				t.sendFixSQL("[insert]", func(dialect Dialect) string {
+					return generateDML(dialect, "insert", targetRow, orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
+				})
+			}
+			return nil
+		}
+
+		// the rows with NULL in the key never conflict, so they are inserted instead of upserted
+		for i := range rows.sources {
+			data := sourceRows[i]
+			for j := kept[i]; j < rows.sourceNums[i]; j++ {
+				t.sendFixSQL("[insert]", func(dialect Dialect) string {
+					return generateDML(dialect, "insert", data, orderKeyCols, t.TargetTable.info, t.TargetTable.Schema)
+				})
+			}
+		}
+		return nil
+	}
+
+	for i := sourceNum; i < rows.targetNum; i++ {
+		if err = t.fixTargetExtraRow(targetRow, orderKeyCols); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for i, source := range rows.sources {
+		if kept[i] == rows.sourceNums[i] {
+			continue
+		}
+		if err = t.addDelete(); err != nil {
+			return errors.Trace(err)
+		}
+		data := sourceRows[i]
+		t.sendFixSQL("[delete]", func(dialect Dialect) string {
+			return t.sourceFixSQL(dialect, "delete", data, source, orderKeyCols)
+		})
+		for j := 0; j < kept[i]; j++ {
+			t.sendFixSQL("[insert]", func(dialect Dialect) string {
+				return t.sourceFixSQL(dialect, "insert", data, source, orderKeyCols)
+			})
+		}
+	}
+
+	return nil
+}
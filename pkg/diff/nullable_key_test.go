@@ -0,0 +1,130 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testNullableKeySuite{})
+
+type testNullableKeySuite struct{}
+
+func columnNames(cols []*model.ColumnInfo) []string {
+	names := make([]string, 0, len(cols))
+	for _, col := range cols {
+		names = append(names, col.Name.O)
+	}
+	return names
+}
+
+func (s *testNullableKeySuite) TestRowOrderKeyCols(c *C) {
+	cases := []struct {
+		createTableSQL string
+		nullable       bool
+		orderKeys      []string
+	}{
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24), `b` int, primary key(`id`))", false, []string{"id"}},
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24), `b` int, primary key(`a`), unique key(`id`))", false, []string{"a"}},
+		{"CREATE TABLE `t` (`id` int NOT NULL, `a` varchar(24), `b` int, unique key(`id`))", false, []string{"id"}},
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24), `b` int)", false, []string{"id", "a", "b"}},
+		{"CREATE TABLE `t` (`id` int, `a` varchar(24), `b` int, unique key(`id`))", true, []string{"id", "a", "b"}},
+		{"CREATE TABLE `t` (`id` int NOT NULL, `a` varchar(24), `b` int, unique key(`b`, `id`))", true, []string{"b", "id", "a"}},
+	}
+	for _, cs := range cases {
+		tableInfo, err := dbutil.GetTableInfoBySQL(cs.createTableSQL)
+		c.Assert(err, IsNil)
+		c.Assert(nullableUniqueKey(tableInfo) != nil, Equals, cs.nullable, Commentf("%s", cs.createTableSQL))
+		c.Assert(columnNames(rowOrderKeyCols(tableInfo, nil)), DeepEquals, cs.orderKeys, Commentf("%s", cs.createTableSQL))
+	}
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `t` (`id` int, `a` varchar(24), `b` int, unique key(`id`))")
+	c.Assert(err, IsNil)
+	c.Assert(columnNames(rowOrderKeyCols(tableInfo, map[string]interface{}{"a": struct{}{}})), DeepEquals, []string{"id", "b"})
+}
+
+func (s *testNullableKeySuite) TestCompareDuplicatedRows(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`k` int, `a` varchar(24), `b` int, unique key(`k`))")
+	c.Assert(err, IsNil)
+
+	cases := []struct {
+		reverse bool
+		sqls    []string
+	}{
+		{
+			reverse: false,
+			sqls: []string{
+				"DELETE FROM `test`.`atest` WHERE `k` is NULL AND `a` = 'x' AND `b` = 1;",
+				"INSERT INTO `test`.`atest`(`k`,`a`,`b`) VALUES (NULL,'x',1);",
+				"INSERT INTO `test`.`atest`(`k`,`a`,`b`) VALUES (NULL,'z',1);",
+				"REPLACE INTO `test`.`atest`(`k`,`a`,`b`) VALUES (1,'y',3);",
+			},
+		},
+		{
+			reverse: true,
+			sqls: []string{
+				"REPLACE INTO `test`.`atest`(`k`,`a`,`b`) VALUES (NULL,'x',1); -- instance-id: source-1",
+				"REPLACE INTO `test`.`atest`(`k`,`a`,`b`) VALUES (NULL,'x',1); -- instance-id: source-1",
+				"DELETE FROM `test`.`atest` WHERE `k` is NULL AND `a` = 'z' AND `b` = 1; -- instance-id: source-1",
+				"REPLACE INTO `test`.`atest`(`k`,`a`,`b`) VALUES (1,'y',2); -- instance-id: source-1",
+			},
+		},
+	}
+	for _, cs := range cases {
+		td := &TableDiff{
+			TargetTable:   &TableInstance{Conn: targetDB, Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+			SourceTables:  []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+			ReverseFixSQL: cs.reverse,
+		}
+		td.adjustConfig()
+		td.sqlCh = make(chan string, 10)
+
+		// the rows are ordered by all the columns
+		targetRows := sqlmock.NewRows([]string{"k", "a", "b"}).
+			AddRow(nil, "x", 1).AddRow(nil, "x", 1).AddRow(nil, "x", 1).
+			AddRow(1, "y", 2)
+		sourceRows := sqlmock.NewRows([]string{"k", "a", "b"}).
+			AddRow(nil, "x", 1).
+			AddRow(nil, "z", 1).
+			AddRow(1, "y", 3)
+		targetMock.ExpectQuery("SELECT .* ORDER BY k,a,b").WillReturnRows(targetRows)
+		sourceMock.ExpectQuery("SELECT .* ORDER BY k,a,b").WillReturnRows(sourceRows)
+
+		result := &ChunkResult{}
+		equal, err := td.compareRows(context.Background(), &ChunkRange{ID: 1, Where: "(TRUE)"}, result)
+		c.Assert(err, IsNil)
+		c.Assert(equal, IsFalse)
+		// 2 extra rows (NULL, 'x', 1) in target, 1 extra row (NULL, 'z', 1) in source, and the row of k = 1 is different
+		c.Assert(result.DifferentRows, Equals, 4)
+
+		close(td.sqlCh)
+		sqls := make([]string, 0, len(cs.sqls))
+		for sql := range td.sqlCh {
+			sqls = append(sqls, sql)
+		}
+		c.Assert(sqls, DeepEquals, cs.sqls)
+	}
+}
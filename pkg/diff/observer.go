@@ -0,0 +1,49 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+// DiffObserver is notified of the events during a table's diff, embedders can implement it to build
+// their own UIs, alerting or storage. the methods may be called concurrently by the check goroutines,
+// and should return quickly because they are called in the check loop.
+type DiffObserver interface {
+	// OnChunkStart is called before checking the chunk's data, the sampled out chunks are not notified.
+	OnChunkStart(table *TableDiff, chunk *ChunkRange)
+	// OnChunkResult is called after checking the chunk's data, err is not nil if the check failed.
+	// it's called again if the failed chunk is re-checked by the retry.
+	OnChunkResult(table *TableDiff, chunk *ChunkRange, equal bool, err error)
+	// OnRowDifference is called for every different row found when comparing the rows.
+	OnRowDifference(table *TableDiff, row *RowDiff)
+	// OnTableDone is called when the table's diff is finished, err is not nil if the diff failed.
+	OnTableDone(table *TableDiff, structEqual, dataEqual bool, err error)
+}
+
+// NewNoopObserver returns a DiffObserver which does nothing.
+func NewNoopObserver() DiffObserver {
+	return noopObserver{}
+}
+
+type noopObserver struct{}
+
+func (noopObserver) OnChunkStart(*TableDiff, *ChunkRange)               {}
+func (noopObserver) OnChunkResult(*TableDiff, *ChunkRange, bool, error) {}
+func (noopObserver) OnRowDifference(*TableDiff, *RowDiff)               {}
+func (noopObserver) OnTableDone(*TableDiff, bool, bool, error)          {}
+
+// observer returns the TableDiff's DiffObserver, or a noop one if it's not set.
+func (t *TableDiff) observer() DiffObserver {
+	if t.Observer == nil {
+		return noopObserver{}
+	}
+	return t.Observer
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testObserverSuite{})
+
+type testObserverSuite struct{}
+
+type rowsObserver struct {
+	noopObserver
+	rows []*RowDiff
+}
+
+func (o *rowsObserver) OnRowDifference(table *TableDiff, row *RowDiff) {
+	o.rows = append(o.rows, row)
+}
+
+func (s *testObserverSuite) TestObserveRowDifference(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+
+	observer := &rowsObserver{}
+	td := &TableDiff{
+		TargetTable:  &TableInstance{Schema: "test", Table: "atest", InstanceID: "target", info: tableInfo},
+		SourceTables: []*TableInstance{{Schema: "test", Table: "atest", InstanceID: "source-1", info: tableInfo}},
+		Observer:     observer,
+	}
+	td.adjustConfig()
+	c.Assert(td.Observer, Equals, observer)
+
+	sourceData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("a")},
+	}
+	targetData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("b")},
+	}
+	td.exportRowDiff(td.SourceTables[0], sourceData, targetData, tableInfo.Columns[:1])
+	td.exportRowDiff(nil, nil, targetData, tableInfo.Columns[:1])
+
+	c.Assert(observer.rows, HasLen, 2)
+	c.Assert(observer.rows[0].Type, Equals, RowDifferent)
+	c.Assert(observer.rows[0].SourceInstance, Equals, "source-1")
+	c.Assert(observer.rows[0].Columns, HasLen, 1)
+	c.Assert(observer.rows[1].Type, Equals, RowOnlyInTarget)
+}
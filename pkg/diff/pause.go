@@ -0,0 +1,86 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// Pauser pauses and resumes the diffs without restarting the process, can be shared by the tables' diffs.
+// when paused, the chunks being checked are finished, and the new chunks are not dispatched until resumed.
+type Pauser struct {
+	sync.Mutex
+
+	// closed when resumed, nil if not paused
+	resumeCh chan struct{}
+}
+
+// NewPauser returns a new Pauser, which is not paused.
+func NewPauser() *Pauser {
+	return &Pauser{}
+}
+
+// Pause pauses the diffs, returns false if already paused.
+func (p *Pauser) Pause() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.resumeCh != nil {
+		return false
+	}
+	p.resumeCh = make(chan struct{})
+	return true
+}
+
+// Resume resumes the diffs, returns false if not paused.
+func (p *Pauser) Resume() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.resumeCh == nil {
+		return false
+	}
+	close(p.resumeCh)
+	p.resumeCh = nil
+	return true
+}
+
+// Paused returns true if the diffs are paused.
+func (p *Pauser) Paused() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.resumeCh != nil
+}
+
+// Wait blocks until resumed, returns error if ctx is done.
+func (p *Pauser) Wait(ctx context.Context) error {
+	p.Lock()
+	resumeCh := p.resumeCh
+	p.Unlock()
+
+	if resumeCh == nil {
+		return nil
+	}
+
+	select {
+	case <-resumeCh:
+		return nil
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
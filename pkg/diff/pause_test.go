@@ -0,0 +1,57 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testPauseSuite{})
+
+type testPauseSuite struct{}
+
+func (s *testPauseSuite) TestPauser(c *C) {
+	p := NewPauser()
+	c.Assert(p.Paused(), IsFalse)
+	c.Assert(p.Wait(context.Background()), IsNil)
+	c.Assert(p.Resume(), IsFalse)
+
+	c.Assert(p.Pause(), IsTrue)
+	c.Assert(p.Pause(), IsFalse)
+	c.Assert(p.Paused(), IsTrue)
+
+	resumed := make(chan error)
+	go func() {
+		resumed <- p.Wait(context.Background())
+	}()
+
+	select {
+	case <-resumed:
+		c.Fatal("wait should block when paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Assert(p.Resume(), IsTrue)
+	c.Assert(<-resumed, IsNil)
+	c.Assert(p.Paused(), IsFalse)
+
+	// the wait is interrupted by the context
+	c.Assert(p.Pause(), IsTrue)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(p.Wait(ctx), NotNil)
+}
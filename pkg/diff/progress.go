@@ -0,0 +1,188 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// PhaseCheckStruct means the diff is checking table's struct
+	PhaseCheckStruct = "check struct"
+	// PhaseSplitChunks means the diff is splitting table's data to chunks
+	PhaseSplitChunks = "split chunks"
+	// PhaseCheckData means the diff is checking chunks' data
+	PhaseCheckData = "check data"
+	// PhaseRetryChunks means the diff is re-checking the failed chunks
+	PhaseRetryChunks = "retry chunks"
+	// PhaseCheckIndex means the diff is checking the secondary indices' data
+	PhaseCheckIndex = "check index"
+	// PhaseFinished means the diff is finished
+	PhaseFinished = "finished"
+)
+
+// ProgressReporter is used to report the progress of a table's diff,
+// embedders can implement it to surface the progress in their own systems.
+type ProgressReporter interface {
+	// SetPhase sets the phase the diff is in, see PhaseXXX.
+	SetPhase(phase string)
+	// SetTotal sets the total number of chunks need to be checked.
+	SetTotal(total int)
+	// Increment marks n more chunks as checked.
+	Increment(n int)
+}
+
+// NewNoopProgress returns a ProgressReporter which does nothing.
+func NewNoopProgress() ProgressReporter {
+	return noopProgress{}
+}
+
+type noopProgress struct{}
+
+func (noopProgress) SetPhase(string) {}
+func (noopProgress) SetTotal(int)    {}
+func (noopProgress) Increment(int)   {}
+
+// progress returns the TableDiff's ProgressReporter, or a noop one if it's not set, so the methods
+// which are called without adjustConfig, like CheckTableData, don't panic.
+func (t *TableDiff) progress() ProgressReporter {
+	if t.Progress == nil {
+		return noopProgress{}
+	}
+	return t.Progress
+}
+
+// consoleProgress prints the progress to a writer, one line for every update.
+type consoleProgress struct {
+	sync.Mutex
+
+	w     io.Writer
+	table string
+	phase string
+	total int
+	done  int
+}
+
+// NewConsoleProgress returns a ProgressReporter which prints progress of the table to w.
+func NewConsoleProgress(w io.Writer, table string) ProgressReporter {
+	return &consoleProgress{
+		w:     w,
+		table: table,
+	}
+}
+
+func (p *consoleProgress) SetPhase(phase string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.phase = phase
+	p.print()
+}
+
+func (p *consoleProgress) SetTotal(total int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.total = total
+	p.print()
+}
+
+func (p *consoleProgress) Increment(n int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.done += n
+	p.print()
+}
+
+func (p *consoleProgress) print() {
+	percent := 0
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	fmt.Fprintf(p.w, "table %s [%s] %d/%d chunks (%d%%)\n", p.table, p.phase, p.done, p.total, percent)
+}
+
+var (
+	progressChunkTotal = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "sync_diff",
+			Subsystem: "progress",
+			Name:      "chunk_total",
+			Help:      "total number of chunks need to be checked",
+		}, []string{"table"})
+
+	progressChunkChecked = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "sync_diff",
+			Subsystem: "progress",
+			Name:      "chunk_checked",
+			Help:      "number of chunks already checked",
+		}, []string{"table"})
+
+	progressPhase = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "sync_diff",
+			Subsystem: "progress",
+			Name:      "phase",
+			Help:      "the phase the table's diff is in, the current phase is 1",
+		}, []string{"table", "phase"})
+)
+
+// RegisterProgressMetrics registers the metrics used by the prometheus ProgressReporter.
+func RegisterProgressMetrics(registry *prometheus.Registry) {
+	registry.MustRegister(progressChunkTotal)
+	registry.MustRegister(progressChunkChecked)
+	registry.MustRegister(progressPhase)
+}
+
+// prometheusProgress saves the progress into prometheus gauges.
+type prometheusProgress struct {
+	sync.Mutex
+
+	table string
+	phase string
+}
+
+// NewPrometheusProgress returns a ProgressReporter which saves progress of the table into prometheus metrics,
+// call RegisterProgressMetrics to expose these metrics.
+func NewPrometheusProgress(table string) ProgressReporter {
+	return &prometheusProgress{
+		table: table,
+	}
+}
+
+func (p *prometheusProgress) SetPhase(phase string) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.phase != "" {
+		progressPhase.WithLabelValues(p.table, p.phase).Set(0)
+	}
+	p.phase = phase
+	progressPhase.WithLabelValues(p.table, p.phase).Set(1)
+}
+
+func (p *prometheusProgress) SetTotal(total int) {
+	progressChunkTotal.WithLabelValues(p.table).Set(float64(total))
+	progressChunkChecked.WithLabelValues(p.table).Set(0)
+}
+
+func (p *prometheusProgress) Increment(n int) {
+	progressChunkChecked.WithLabelValues(p.table).Add(float64(n))
+}
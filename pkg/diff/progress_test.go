@@ -0,0 +1,53 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testProgressSuite{})
+
+type testProgressSuite struct{}
+
+func (s *testProgressSuite) TestConsoleProgress(c *C) {
+	buf := new(bytes.Buffer)
+	p := NewConsoleProgress(buf, "`test`.`test`")
+
+	p.SetPhase(PhaseCheckData)
+	p.SetTotal(4)
+	p.Increment(1)
+	p.Increment(1)
+
+	c.Assert(buf.String(), Equals, "table `test`.`test` [check data] 0/0 chunks (0%)\n"+
+		"table `test`.`test` [check data] 0/4 chunks (0%)\n"+
+		"table `test`.`test` [check data] 1/4 chunks (25%)\n"+
+		"table `test`.`test` [check data] 2/4 chunks (50%)\n")
+}
+
+func (s *testProgressSuite) TestNilProgressAndObserver(c *C) {
+	// the methods called without adjustConfig use the noop progress and observer
+	td := &TableDiff{}
+	c.Assert(td.progress(), Equals, NewNoopProgress())
+	c.Assert(td.observer(), Equals, NewNoopObserver())
+	td.progress().SetPhase(PhaseCheckData)
+	td.observer().OnChunkStart(td, NewChunkRange(normalMode))
+
+	buf := new(bytes.Buffer)
+	td.Progress = NewConsoleProgress(buf, "`test`.`test`")
+	td.progress().SetPhase(PhaseCheckData)
+	c.Assert(buf.String(), Equals, "table `test`.`test` [check data] 0/0 chunks (0%)\n")
+}
@@ -0,0 +1,313 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// PTChecksum is a row in percona-toolkit's checksums table, which is written by pt-table-checksum.
+// sync_diff_inspector is the replica, and the source tables are the master.
+type PTChecksum struct {
+	DB        string
+	Tbl       string
+	Chunk     int64
+	ChunkTime float64
+	// the index used to split chunk, is empty when the whole table is one chunk.
+	ChunkIndex string
+	// the comma separated values of the index's columns, empty means NULL.
+	// the commas and backslashes in the values are escaped by backslash, see joinPTBoundary.
+	LowerBoundary string
+	UpperBoundary string
+	ThisCrc       string
+	ThisCnt       int64
+	MasterCrc     string
+	MasterCnt     int64
+}
+
+// Equal returns true if the chunk's checksum and count are same in master and replica.
+func (c *PTChecksum) Equal() bool {
+	return c.ThisCrc == c.MasterCrc && c.ThisCnt == c.MasterCnt
+}
+
+// CreatePTChecksumTable creates the checksums table in percona-toolkit's format, schema.table is usually `percona`.`checksums`.
+func CreatePTChecksumTable(ctx context.Context, db *sql.DB, schema, table string) error {
+	createSchemaSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`;", schema)
+	_, err := db.ExecContext(ctx, createSchemaSQL)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// same with the table created by pt-table-checksum's --create-replicate-table
+	createTableSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s("+
+		"`db` char(64) NOT NULL,"+
+		"`tbl` char(64) NOT NULL,"+
+		"`chunk` int NOT NULL,"+
+		"`chunk_time` float NULL,"+
+		"`chunk_index` varchar(200) NULL,"+
+		"`lower_boundary` text NULL,"+
+		"`upper_boundary` text NULL,"+
+		"`this_crc` char(40) NOT NULL,"+
+		"`this_cnt` int NOT NULL,"+
+		"`master_crc` char(40) NULL,"+
+		"`master_cnt` int NULL,"+
+		"`ts` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,"+
+		"PRIMARY KEY(`db`, `tbl`, `chunk`),"+
+		"INDEX `ts_db_tbl`(`ts`, `db`, `tbl`));", dbutil.TableName(schema, table))
+	_, err = db.ExecContext(ctx, createTableSQL)
+	if err != nil {
+		log.Error("create pt checksums table", zap.Error(err))
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// SavePTChecksum saves the chunk's checksum into percona-toolkit's checksums table.
+func SavePTChecksum(ctx context.Context, db *sql.DB, schema, table string, c *PTChecksum) error {
+	sql := fmt.Sprintf("REPLACE INTO %s(`db`, `tbl`, `chunk`, `chunk_time`, `chunk_index`, `lower_boundary`, `upper_boundary`, `this_crc`, `this_cnt`, `master_crc`, `master_cnt`) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		dbutil.TableName(schema, table))
+	err := dbutil.ExecSQLWithRetry(ctx, db, sql, c.DB, c.Tbl, c.Chunk, c.ChunkTime, toNullString(c.ChunkIndex),
+		toNullString(c.LowerBoundary), toNullString(c.UpperBoundary), c.ThisCrc, c.ThisCnt, c.MasterCrc, c.MasterCnt)
+	if err != nil {
+		log.Error("save pt checksum failed", zap.Error(err))
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// CleanPTChecksum deletes the table's rows in percona-toolkit's checksums table.
+func CleanPTChecksum(ctx context.Context, db *sql.DB, schema, table, checkSchema, checkTable string) error {
+	sql := fmt.Sprintf("DELETE FROM %s WHERE `db` = ? AND `tbl` = ?;", dbutil.TableName(schema, table))
+	return errors.Trace(dbutil.ExecSQLWithRetry(ctx, db, sql, checkSchema, checkTable))
+}
+
+// LoadPTChecksums loads the checksums of a table from percona-toolkit's checksums table.
+func LoadPTChecksums(ctx context.Context, db *sql.DB, schema, table, checkSchema, checkTable string) ([]*PTChecksum, error) {
+	query := fmt.Sprintf("SELECT `db`, `tbl`, `chunk`, `chunk_time`, `chunk_index`, `lower_boundary`, `upper_boundary`, `this_crc`, `this_cnt`, `master_crc`, `master_cnt` FROM %s WHERE `db` = ? AND `tbl` = ? ORDER BY `chunk`",
+		dbutil.TableName(schema, table))
+	rows, err := db.QueryContext(ctx, query, checkSchema, checkTable)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	checksums := make([]*PTChecksum, 0, 10)
+	for rows.Next() {
+		var (
+			c                                     PTChecksum
+			chunkTime                             sql.NullFloat64
+			chunkIndex, lowerBoundary, upperBound sql.NullString
+			masterCrc                             sql.NullString
+			masterCnt                             sql.NullInt64
+		)
+		err = rows.Scan(&c.DB, &c.Tbl, &c.Chunk, &chunkTime, &chunkIndex, &lowerBoundary, &upperBound, &c.ThisCrc, &c.ThisCnt, &masterCrc, &masterCnt)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		c.ChunkTime = chunkTime.Float64
+		c.ChunkIndex = chunkIndex.String
+		c.LowerBoundary = lowerBoundary.String
+		c.UpperBoundary = upperBound.String
+		if masterCrc.Valid && masterCnt.Valid {
+			c.MasterCrc = masterCrc.String
+			c.MasterCnt = masterCnt.Int64
+		} else {
+			// the checksum of master is not replicated yet, regard it as not equal
+			c.MasterCrc = ""
+			c.MasterCnt = -1
+		}
+		checksums = append(checksums, &c)
+	}
+
+	return checksums, errors.Trace(rows.Err())
+}
+
+// ptChecksumToChunk converts the chunk checked by pt-table-checksum to ChunkRange.
+func ptChecksumToChunk(c *PTChecksum, tableInfo *model.TableInfo) (*ChunkRange, error) {
+	chunk := NewChunkRange(bucketMode)
+	chunk.ID = c.Chunk
+
+	if c.ChunkIndex == "" || (c.LowerBoundary == "" && c.UpperBoundary == "") {
+		// the whole table is one chunk
+		return chunk, nil
+	}
+
+	var index *model.IndexInfo
+	for _, idx := range tableInfo.Indices {
+		if idx.Name.L == strings.ToLower(c.ChunkIndex) {
+			index = idx
+			break
+		}
+	}
+	if index == nil {
+		return nil, errors.NotFoundf("index %s in table %s", c.ChunkIndex, tableInfo.Name)
+	}
+
+	var lowerValues, upperValues []string
+	if c.LowerBoundary != "" {
+		lowerValues = splitPTBoundary(c.LowerBoundary)
+		if len(lowerValues) > len(index.Columns) {
+			return nil, errors.Errorf("lower boundary %s don't match index %s", c.LowerBoundary, c.ChunkIndex)
+		}
+	}
+	if c.UpperBoundary != "" {
+		upperValues = splitPTBoundary(c.UpperBoundary)
+		if len(upperValues) > len(index.Columns) {
+			return nil, errors.Errorf("upper boundary %s don't match index %s", c.UpperBoundary, c.ChunkIndex)
+		}
+	}
+
+	/*
+		pt-table-checksum's chunk is [lower, upper], and the lower/upper is compared as tuple.
+		for example, index is (a, b), lower is (1, 2), upper is (3, 4), the range is
+		(a > 1 OR (a = 1 AND b >= 2)) AND (a < 3 OR (a = 3 AND b <= 4))
+		if lower or upper is NULL, pt-table-checksum's range is open at this side, but we always use
+		a closed range, checking some more rows is harmless.
+	*/
+	for i, col := range index.Columns {
+		if i >= len(lowerValues) && i >= len(upperValues) {
+			break
+		}
+
+		bound := &Bound{Column: col.Name.O}
+		if i < len(lowerValues) {
+			bound.Lower = lowerValues[i]
+			bound.LowerSymbol = gt
+			if i == len(lowerValues)-1 {
+				bound.LowerSymbol = gte
+			}
+		}
+		if i < len(upperValues) {
+			bound.Upper = upperValues[i]
+			bound.UpperSymbol = lt
+			if i == len(upperValues)-1 {
+				bound.UpperSymbol = lte
+			}
+		}
+		chunk.Bounds = append(chunk.Bounds, bound)
+	}
+
+	return chunk, nil
+}
+
+// chunkToPTChecksum converts the chunk's bounds to pt-table-checksum's index and boundaries.
+// the boundaries are only saved when the chunk is split by an index's leading columns, and the bounds are compared
+// as tuple like pt-table-checksum, which is bucketMode, or normalMode with only one column.
+func chunkToPTChecksum(chunk *ChunkRange, tableInfo *model.TableInfo) (index, lower, upper string) {
+	if len(chunk.Bounds) == 0 || (chunk.Mode != bucketMode && len(chunk.Bounds) != 1) {
+		return "", "", ""
+	}
+
+	for _, idx := range dbutil.FindAllIndex(tableInfo) {
+		if len(idx.Columns) < len(chunk.Bounds) {
+			continue
+		}
+
+		match := true
+		for i, bound := range chunk.Bounds {
+			if idx.Columns[i].Name.L != strings.ToLower(bound.Column) {
+				match = false
+				break
+			}
+		}
+		if match {
+			index = idx.Name.O
+			break
+		}
+	}
+	if index == "" {
+		return "", "", ""
+	}
+
+	lowers := make([]string, 0, len(chunk.Bounds))
+	uppers := make([]string, 0, len(chunk.Bounds))
+	for _, bound := range chunk.Bounds {
+		if len(bound.Lower) != 0 {
+			lowers = append(lowers, bound.Lower)
+		}
+		if len(bound.Upper) != 0 {
+			uppers = append(uppers, bound.Upper)
+		}
+	}
+
+	// only save the boundary which is complete
+	if len(lowers) == len(chunk.Bounds) {
+		lower = joinPTBoundary(lowers)
+	}
+	if len(uppers) == len(chunk.Bounds) {
+		upper = joinPTBoundary(uppers)
+	}
+
+	return index, lower, upper
+}
+
+// joinPTBoundary joins the values by comma, the commas and backslashes in the values are escaped by backslash,
+// so the values can be split by splitPTBoundary unambiguously.
+func joinPTBoundary(values []string) string {
+	escaped := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.Replace(value, `\`, `\\`, -1)
+		escaped = append(escaped, strings.Replace(value, ",", `\,`, -1))
+	}
+	return strings.Join(escaped, ",")
+}
+
+// splitPTBoundary splits the boundary joined by joinPTBoundary, the boundary written by pt-table-checksum is split
+// in the same way as it has no backslash usually.
+func splitPTBoundary(boundary string) []string {
+	values := make([]string, 0, 2)
+	var value strings.Builder
+	for i := 0; i < len(boundary); i++ {
+		switch {
+		case boundary[i] == '\\' && i+1 < len(boundary):
+			i++
+			value.WriteByte(boundary[i])
+		case boundary[i] == ',':
+			values = append(values, value.String())
+			value.Reset()
+		default:
+			value.WriteByte(boundary[i])
+		}
+	}
+	return append(values, value.String())
+}
+
+func getChunkRowCount(ctx context.Context, db *sql.DB, schema, table, where string, args []interface{}) (int64, error) {
+	query := fmt.Sprintf("SELECT COUNT(1) cnt FROM %s WHERE %s", dbutil.TableName(schema, table), where)
+	log.Debug("get chunk row count", zap.String("sql", query), zap.Reflect("args", args))
+
+	var cnt sql.NullInt64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&cnt)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	return cnt.Int64, nil
+}
+
+func toNullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: len(s) != 0}
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testPTChecksumSuite{})
+
+type testPTChecksumSuite struct{}
+
+func (s *testPTChecksumSuite) TestPTChecksumToChunk(c *C) {
+	createTableSQL := "CREATE TABLE `test`.`test`(`a` int, `b` varchar(10), `c` int, PRIMARY KEY(`a`, `b`), KEY `idx_c`(`c`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL)
+	c.Assert(err, IsNil)
+
+	testCases := []struct {
+		checksum *PTChecksum
+		where    string
+		args     []string
+	}{
+		{
+			&PTChecksum{Chunk: 1},
+			"TRUE",
+			nil,
+		},
+		{
+			&PTChecksum{Chunk: 2, ChunkIndex: "PRIMARY", LowerBoundary: "1,x", UpperBoundary: "3,y"},
+			"((`a` > ?) OR (`a` = ? AND `b` >= ?)) AND ((`a` < ?) OR (`a` = ? AND `b` <= ?))",
+			[]string{"1", "1", "x", "3", "3", "y"},
+		},
+		{
+			&PTChecksum{Chunk: 3, ChunkIndex: "idx_c", UpperBoundary: "10"},
+			"(`c` <= ?)",
+			[]string{"10"},
+		},
+		{
+			&PTChecksum{Chunk: 4, ChunkIndex: "idx_c", LowerBoundary: "100"},
+			"(`c` >= ?)",
+			[]string{"100"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		chunk, err := ptChecksumToChunk(testCase.checksum, tableInfo)
+		c.Assert(err, IsNil)
+		c.Assert(chunk.ID, Equals, testCase.checksum.Chunk)
+		where, args := chunk.toString("")
+		c.Assert(where, Equals, testCase.where)
+		c.Assert(args, DeepEquals, testCase.args)
+	}
+
+	_, err = ptChecksumToChunk(&PTChecksum{ChunkIndex: "idx_d", LowerBoundary: "1"}, tableInfo)
+	c.Assert(err, NotNil)
+	_, err = ptChecksumToChunk(&PTChecksum{ChunkIndex: "idx_c", LowerBoundary: "1,2"}, tableInfo)
+	c.Assert(err, NotNil)
+}
+
+func (s *testPTChecksumSuite) TestChunkToPTChecksum(c *C) {
+	createTableSQL := "CREATE TABLE `test`.`test`(`a` int, `b` varchar(10), `c` int, PRIMARY KEY(`a`, `b`), KEY `idx_c`(`c`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL)
+	c.Assert(err, IsNil)
+
+	chunk := NewChunkRange(normalMode)
+	chunk.update("a", "1", gte, "3", lt)
+	index, lower, upper := chunkToPTChecksum(chunk, tableInfo)
+	c.Assert(index, Equals, "PRIMARY")
+	c.Assert(lower, Equals, "1")
+	c.Assert(upper, Equals, "3")
+
+	// the bounds of normalMode chunk on several columns are not a tuple range
+	chunk.update("b", "x", gte, "", "")
+	index, _, _ = chunkToPTChecksum(chunk, tableInfo)
+	c.Assert(index, Equals, "")
+
+	chunk.Mode = bucketMode
+	index, lower, upper = chunkToPTChecksum(chunk, tableInfo)
+	c.Assert(index, Equals, "PRIMARY")
+	c.Assert(lower, Equals, "1,x")
+	c.Assert(upper, Equals, "")
+
+	chunk = NewChunkRange(normalMode)
+	chunk.update("c", "", "", "10", lt)
+	index, lower, upper = chunkToPTChecksum(chunk, tableInfo)
+	c.Assert(index, Equals, "idx_c")
+	c.Assert(lower, Equals, "")
+	c.Assert(upper, Equals, "10")
+
+	chunk = NewChunkRange(normalMode)
+	chunk.update("b", "x", gte, "y", lt)
+	index, _, _ = chunkToPTChecksum(chunk, tableInfo)
+	c.Assert(index, Equals, "")
+
+	// the commas and backslashes in the values are escaped, and the chunk can be converted back
+	chunk = NewChunkRange(bucketMode)
+	chunk.update("a", "1", gt, "3", lt)
+	chunk.update("b", "x,y", gte, `z\,`, lte)
+	index, lower, upper = chunkToPTChecksum(chunk, tableInfo)
+	c.Assert(index, Equals, "PRIMARY")
+	c.Assert(lower, Equals, `1,x\,y`)
+	c.Assert(upper, Equals, `3,z\\\,`)
+	converted, err := ptChecksumToChunk(&PTChecksum{ChunkIndex: index, LowerBoundary: lower, UpperBoundary: upper}, tableInfo)
+	c.Assert(err, IsNil)
+	where, args := converted.toString("")
+	c.Assert(where, Equals, "((`a` > ?) OR (`a` = ? AND `b` >= ?)) AND ((`a` < ?) OR (`a` = ? AND `b` <= ?))")
+	c.Assert(args, DeepEquals, []string{"1", "1", "x,y", "3", "3", `z\,`})
+
+	c.Assert((&PTChecksum{ThisCrc: "a1", ThisCnt: 1, MasterCrc: "a1", MasterCnt: 1}).Equal(), IsTrue)
+	c.Assert((&PTChecksum{ThisCrc: "a1", ThisCnt: 1, MasterCrc: "a1", MasterCnt: 2}).Equal(), IsFalse)
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// QuickResult is the result of the table's quick check.
+type QuickResult struct {
+	SourceCount int64 `json:"source-count"`
+	TargetCount int64 `json:"target-count"`
+	// false if some RowSources don't support checksum, only the row counts are compared
+	ChecksumCompared bool  `json:"checksum-compared"`
+	SourceChecksum   int64 `json:"source-checksum"`
+	TargetChecksum   int64 `json:"target-checksum"`
+}
+
+// Equal returns true if the row counts and the checksums are equal.
+func (r *QuickResult) Equal() bool {
+	return r.SourceCount == r.TargetCount && r.SourceChecksum == r.TargetChecksum
+}
+
+// String implements fmt.Stringer interface.
+func (r *QuickResult) String() string {
+	if !r.ChecksumCompared {
+		return fmt.Sprintf("count %d/%d", r.SourceCount, r.TargetCount)
+	}
+	return fmt.Sprintf("count %d/%d, checksum %d/%d", r.SourceCount, r.TargetCount, r.SourceChecksum, r.TargetChecksum)
+}
+
+// QuickCheck compares the total row count and the whole table's checksum of the source tables and the target table,
+// the table is not split into chunks and the rows are never fetched, so it's cheap enough to verify many tables
+// routinely. the checkpoint and the fix sqls are not used. only the row counts are compared if some RowSources don't
+// support checksum.
+func (t *TableDiff) QuickCheck(ctx context.Context) (*QuickResult, error) {
+	t.adjustConfig()
+
+	if err := t.getTableInfo(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	chunk := NewChunkRange(normalMode)
+	conditions, args := chunk.toString(t.Collation)
+	chunk.Where = fmt.Sprintf("(%s AND %s)", conditions, t.Range)
+	chunk.Args = args
+
+	if err := t.waitQueries(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	result := &QuickResult{}
+	var err error
+	switch {
+	case t.supportChecksum():
+		result.ChecksumCompared = true
+		result.SourceChecksum, result.SourceCount, err = t.getSourceTableChecksum(ctx, chunk)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+		result.TargetChecksum, result.TargetCount, err = t.TargetTable.rowSource().(ChecksumSource).GetChecksum(ctx1, chunk, t.TargetTable.info, utils.SliceToMap(t.IgnoreColumns), t.checksumColumnExprs(t.TargetTable))
+		cancel1()
+		if err != nil {
+			return nil, errors.Annotatef(err, "get checksum of %s in %s", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table), t.TargetTable.InstanceID)
+		}
+	case t.supportRowCount():
+		chunkResult := &ChunkResult{}
+		if _, err = t.compareRowCount(ctx, chunk, chunkResult); err != nil {
+			return nil, errors.Trace(err)
+		}
+		result.SourceCount, result.TargetCount = chunkResult.SourceRowCount, chunkResult.TargetRowCount
+	default:
+		return nil, errors.NotSupportedf("quick check of %s without checksum and row count", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table))
+	}
+
+	log.Info("quick check", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.Stringer("result", result), zap.Bool("equal", result.Equal()))
+	return result, nil
+}
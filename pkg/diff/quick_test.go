@@ -0,0 +1,55 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testQuickSuite{})
+
+type testQuickSuite struct{}
+
+func (s *testQuickSuite) TestQuickCheck(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	createTable := "CREATE TABLE `t` (`a` int, `b` varchar(10), PRIMARY KEY (`a`))"
+	for _, mock := range []sqlmock.Sqlmock{targetMock, sourceMock} {
+		mock.ExpectQuery("SHOW CREATE TABLE.*").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", createTable))
+	}
+	// the whole table is checked by one checksum query
+	sourceMock.ExpectQuery("SELECT .* AS checksum, COUNT.* WHERE \\(TRUE AND a > 10\\).*").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectQuery("SELECT .* AS checksum, COUNT.* WHERE \\(TRUE AND a > 10\\).*").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(456, 10))
+
+	td := &TableDiff{
+		SourceTables: []*TableInstance{{Conn: sourceDB, Schema: "test", Table: "t", InstanceID: "source-1"}},
+		TargetTable:  &TableInstance{Conn: targetDB, Schema: "test", Table: "t", InstanceID: "target"},
+		Range:        "a > 10",
+	}
+	result, err := td.QuickCheck(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, &QuickResult{SourceCount: 10, TargetCount: 10, ChecksumCompared: true, SourceChecksum: 123, TargetChecksum: 456})
+	c.Assert(result.Equal(), IsFalse)
+	c.Assert(result.String(), Equals, "count 10/10, checksum 123/456")
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"fmt"
+
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// redactedValue replaces the masked values in logs and reports.
+const redactedValue = "<redacted>"
+
+// redactor masks the columns' values in logs and reports, for the compliance with PII policies.
+// nil redactor doesn't mask any column.
+type redactor struct {
+	// all the columns are masked if is empty
+	columns map[string]struct{}
+}
+
+// newRedactor returns a redactor which masks the columns, or all the columns if columns is empty.
+// returns nil if not enabled.
+func newRedactor(enabled bool, columns []string) *redactor {
+	if !enabled {
+		return nil
+	}
+
+	r := &redactor{columns: make(map[string]struct{}, len(columns))}
+	for _, col := range columns {
+		r.columns[col] = struct{}{}
+	}
+	return r
+}
+
+// masked returns true if the column's values should be masked.
+func (r *redactor) masked(column string) bool {
+	if r == nil {
+		return false
+	}
+	if len(r.columns) == 0 {
+		return true
+	}
+	_, ok := r.columns[column]
+	return ok
+}
+
+// row returns the row used in logs, the masked columns' values are replaced, NULL is kept.
+func (r *redactor) row(data map[string]*dbutil.ColumnData) map[string]*dbutil.ColumnData {
+	if r == nil {
+		return data
+	}
+
+	row := make(map[string]*dbutil.ColumnData, len(data))
+	for name, col := range data {
+		if col != nil && !col.IsNull && r.masked(name) {
+			col = &dbutil.ColumnData{Data: []byte(redactedValue)}
+		}
+		row[name] = col
+	}
+	return row
+}
+
+// value returns the value used in reports, the masked column's value is replaced, NULL is kept.
+func (r *redactor) value(column string, value *string) *string {
+	if value == nil || !r.masked(column) {
+		return value
+	}
+
+	masked := redactedValue
+	return &masked
+}
+
+// chunkArgs returns the field of the chunk's arguments used in logs. the arguments are the bounds' values, so all of
+// them are masked if any bound's column is masked.
+func (r *redactor) chunkArgs(chunk *ChunkRange) zap.Field {
+	for _, bound := range chunk.Bounds {
+		if r.masked(bound.Column) {
+			return zap.String("args", redactedValue)
+		}
+	}
+	return zap.Reflect("args", chunk.Args)
+}
+
+// args returns the chunk's arguments used in reports, all of them are masked like chunkArgs.
+func (r *redactor) args(chunk *ChunkRange, args []interface{}) []string {
+	values := make([]string, 0, len(args))
+	masked := false
+	for _, bound := range chunk.Bounds {
+		if r.masked(bound.Column) {
+			masked = true
+			break
+		}
+	}
+	for _, arg := range args {
+		if masked {
+			values = append(values, redactedValue)
+		} else {
+			values = append(values, fmt.Sprintf("%v", arg))
+		}
+	}
+	return values
+}
+
+// redactDialect formats the masked columns' values as the placeholder `?`, the fix sqls can't be executed directly,
+// but still show which rows and columns need to be fixed.
+type redactDialect struct {
+	Dialect
+	redact *redactor
+}
+
+// FormatValue implements Dialect's FormatValue.
+func (d redactDialect) FormatValue(col *model.ColumnInfo, data []byte) string {
+	if d.redact.masked(col.Name.O) {
+		return "?"
+	}
+	return d.Dialect.FormatValue(col, data)
+}
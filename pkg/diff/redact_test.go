@@ -0,0 +1,93 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testRedactSuite{})
+
+type testRedactSuite struct{}
+
+func (s *testRedactSuite) TestRedactor(c *C) {
+	var r *redactor
+	c.Assert(newRedactor(false, []string{"name"}), IsNil)
+	c.Assert(r.masked("name"), IsFalse)
+
+	r = newRedactor(true, nil)
+	c.Assert(r.masked("id"), IsTrue)
+	c.Assert(r.masked("name"), IsTrue)
+
+	r = newRedactor(true, []string{"name"})
+	c.Assert(r.masked("id"), IsFalse)
+	c.Assert(r.masked("name"), IsTrue)
+
+	row := r.row(map[string]*dbutil.ColumnData{
+		"id":    {Data: []byte("1")},
+		"name":  {Data: []byte("alice")},
+		"email": {IsNull: true},
+	})
+	c.Assert(string(row["id"].Data), Equals, "1")
+	c.Assert(string(row["name"].Data), Equals, redactedValue)
+	c.Assert(row["email"].IsNull, IsTrue)
+
+	value := "alice"
+	c.Assert(*r.value("name", &value), Equals, redactedValue)
+	c.Assert(*r.value("id", &value), Equals, "alice")
+	c.Assert(r.value("name", nil), IsNil)
+
+	chunk := &ChunkRange{Bounds: []*Bound{{Column: "id"}}, Args: []string{"1", "10"}}
+	c.Assert(r.chunkArgs(chunk).Interface, DeepEquals, []string{"1", "10"})
+	chunk.Bounds = append(chunk.Bounds, &Bound{Column: "name"})
+	c.Assert(r.chunkArgs(chunk).String, Equals, redactedValue)
+}
+
+func (s *testRedactSuite) TestRedactRowDiffAndFixSQL(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), `c` int, primary key(`id`))")
+	c.Assert(err, IsNil)
+	keys := []*model.ColumnInfo{tableInfo.Columns[0]}
+	sourceData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("alice")},
+		"c":    {Data: []byte("1")},
+	}
+	targetData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("bob")},
+		"c":    {IsNull: true},
+	}
+
+	row := newRowDiff("test", "atest", "", sourceData, targetData, keys, tableInfo.Columns, nil, newRedactor(true, []string{"id", "name"}))
+	c.Assert(row.Key, Equals, "id="+redactedValue)
+	c.Assert(row.Columns, HasLen, 2)
+	c.Assert(*row.Columns[0].Source, Equals, redactedValue)
+	c.Assert(*row.Columns[0].Target, Equals, redactedValue)
+	c.Assert(*row.Columns[1].Source, Equals, "1")
+	c.Assert(row.Columns[1].Target, IsNil)
+
+	td := &TableDiff{
+		TargetTable: &TableInstance{Schema: "test", Table: "atest", info: tableInfo},
+		sqlCh:       make(chan string, 2),
+		redact:      newRedactor(true, []string{"name"}),
+	}
+	td.fixSourceExtraRow(sourceData, nil, keys)
+	c.Assert(<-td.sqlCh, Equals, "REPLACE INTO `test`.`atest`(`id`,`name`,`c`) VALUES (1,'alice',1);")
+
+	td.RedactFixSQL = true
+	td.fixSourceExtraRow(sourceData, nil, keys)
+	c.Assert(<-td.sqlCh, Equals, "REPLACE INTO `test`.`atest`(`id`,`name`,`c`) VALUES (1,?,1);")
+}
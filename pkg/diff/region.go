@@ -0,0 +1,133 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// regionSpliter splits the table's data by the regions of the table's records in TiKV, every chunk is the range of
+// the handles in one region, so the chunk's scan stays in the region.
+type regionSpliter struct{}
+
+// splitTo splits the table's data to chunks by the regions, and calls emit for every chunk once it's generated.
+func (s *regionSpliter) splitTo(table *TableInstance, emit func(*ChunkRange) error) error {
+	handleCol := handleColumn(table.info)
+	if len(handleCol) == 0 {
+		return errors.NotSupportedf("split table %s without integer handle by regions", dbutil.TableName(table.Schema, table.Table))
+	}
+
+	regions, err := dbutil.GetTableRegions(context.Background(), table.Conn, table.Schema, table.Table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(regions) == 0 {
+		return errors.NotFoundf("regions of table %s", dbutil.TableName(table.Schema, table.Table))
+	}
+
+	handles, err := regionHandles(regions)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("split chunks by regions", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Int("regions", len(regions)), zap.Int("chunks", len(handles)+1))
+
+	// the chunks are [-inf, h1), [h1, h2), ..., [hn, +inf)
+	var lower, lowerSymbol string
+	for _, handle := range handles {
+		upper := strconv.FormatInt(handle, 10)
+		chunk := NewChunkRange(normalMode)
+		chunk.update(handleCol, lower, lowerSymbol, upper, lt)
+		if err = emit(chunk); err != nil {
+			return errors.Trace(err)
+		}
+		lower, lowerSymbol = upper, gte
+	}
+
+	chunk := NewChunkRange(normalMode)
+	if len(lower) != 0 {
+		chunk.update(handleCol, lower, lowerSymbol, "", "")
+	}
+	return errors.Trace(emit(chunk))
+}
+
+// regionHandles returns the sorted handles of the regions' boundaries in the table's records.
+func regionHandles(regions []*dbutil.RegionInfo) ([]int64, error) {
+	handles := make([]int64, 0, len(regions))
+	handleSet := make(map[int64]struct{})
+	for _, region := range regions {
+		for _, key := range []string{region.StartKey, region.EndKey} {
+			handle, ok, err := dbutil.DecodeRecordHandle(key, region.TableID)
+			if err != nil {
+				return nil, errors.Annotatef(err, "region %d", region.RegionID)
+			}
+			if !ok {
+				continue
+			}
+			if _, ok = handleSet[handle]; !ok {
+				handleSet[handle] = struct{}{}
+				handles = append(handles, handle)
+			}
+		}
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+
+	return handles, nil
+}
+
+// handleColumn returns the column of the table's integer handle, the integer primary key or the implicit row id,
+// returns empty string if the table's handle is not selected as a column.
+func handleColumn(tableInfo *model.TableInfo) string {
+	if tableInfo.PKIsHandle {
+		for _, index := range tableInfo.Indices {
+			if index.Primary && len(index.Columns) == 1 {
+				return index.Columns[0].Name.O
+			}
+		}
+	}
+
+	if dbutil.FindColumnByName(tableInfo.Columns, dbutil.ImplicitColName) != nil {
+		return dbutil.ImplicitColName
+	}
+
+	return ""
+}
+
+// getChunksByRegionsTo splits the table's data by the regions, and splits by TiDB's statistics like
+// getChunksForTableTo if failed.
+func getChunksByRegionsTo(table *TableInstance, columns []*model.ColumnInfo, chunkSize int, limits string, collation string, emit func(*ChunkRange) error) error {
+	s := regionSpliter{}
+	chunkNum := 0
+	err := s.splitTo(table, func(chunk *ChunkRange) error {
+		chunkNum++
+		return emit(chunk)
+	})
+	if err == nil {
+		return nil
+	}
+	if chunkNum > 0 {
+		// the chunks are already emitted, can't split again
+		return errors.Trace(err)
+	}
+
+	log.Warn("split chunks by regions failed, will split chunk by tidb's statistics", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+	return getChunksForTableTo(table, columns, chunkSize, limits, collation, true, emit)
+}
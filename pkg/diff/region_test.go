@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"encoding/hex"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/codec"
+)
+
+var _ = Suite(&testRegionSuite{})
+
+type testRegionSuite struct{}
+
+func (s *testRegionSuite) TestRegionChunkIterator(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`id` int, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+	table := &TableInstance{Conn: db, Schema: "test", Table: "t", info: tableInfo}
+
+	regionKey := func(handle int64) string {
+		return hex.EncodeToString(codec.EncodeBytes(nil, tablecodec.EncodeRowKeyWithHandle(45, handle)))
+	}
+	tablePrefix := hex.EncodeToString(codec.EncodeBytes(nil, tablecodec.EncodeTablePrefix(45)))
+	nextTablePrefix := hex.EncodeToString(codec.EncodeBytes(nil, tablecodec.EncodeTablePrefix(46)))
+	mock.ExpectQuery("SELECT REGION_ID, TABLE_ID, START_KEY, END_KEY, APPROXIMATE_KEYS FROM information_schema.TIKV_REGION_STATUS").
+		WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"REGION_ID", "TABLE_ID", "START_KEY", "END_KEY", "APPROXIMATE_KEYS"}).
+			AddRow(2, 45, tablePrefix, regionKey(100), 100).
+			AddRow(3, 45, regionKey(100), regionKey(200), 100).
+			AddRow(4, 45, regionKey(200), nextTablePrefix, 100))
+
+	iter, err := NewRegionChunkIterator(context.Background(), table, "", "TRUE", 100, "")
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	expectChunks := []struct {
+		where string
+		args  []string
+	}{
+		{"(`id` < ? AND TRUE)", []string{"100"}},
+		{"(`id` >= ? AND `id` < ? AND TRUE)", []string{"100", "200"}},
+		{"(`id` >= ? AND TRUE)", []string{"200"}},
+	}
+	for i, expect := range expectChunks {
+		chunk, err := iter.Next(context.Background())
+		c.Assert(err, IsNil)
+		c.Assert(chunk.ID, Equals, int64(i))
+		c.Assert(chunk.Where, Equals, expect.where)
+		c.Assert(chunk.Args, DeepEquals, expect.args)
+	}
+	chunk, err := iter.Next(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(chunk, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testRegionSuite) TestHandleColumn(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`id` bigint, `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+	c.Assert(handleColumn(tableInfo), Equals, "id")
+
+	tableInfo, err = dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`id` varchar(24), `name` varchar(24), primary key(`id`))")
+	c.Assert(err, IsNil)
+	c.Assert(handleColumn(tableInfo), Equals, "")
+
+	// the implicit row id is selected
+	tableInfo, err = dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`t` (`id` varchar(24), `name` varchar(24))")
+	c.Assert(err, IsNil)
+	tableInfo.Columns = append(tableInfo.Columns, &model.ColumnInfo{Name: model.NewCIStr(dbutil.ImplicitColName)})
+	c.Assert(handleColumn(tableInfo), Equals, dbutil.ImplicitColName)
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// ReplicationWaiter is used to check when the replication from source to target is still running, the mismatched chunks
+// are re-checked after the target applied the source's position captured after the check, so the differences caused
+// by the replication lag are not reported.
+type ReplicationWaiter interface {
+	// CapturePosition returns the source's current position, for example the GTID set or the TSO.
+	CapturePosition(ctx context.Context) (string, error)
+	// WaitPosition blocks until the target applied the source's position, returns error if timeout.
+	WaitPosition(ctx context.Context, position string) error
+}
+
+// gtidWaiter waits the MySQL GTID replication.
+type gtidWaiter struct {
+	source  *sql.DB
+	target  *sql.DB
+	timeout time.Duration
+}
+
+// NewGTIDWaiter returns a ReplicationWaiter for the MySQL GTID replication, the position is the source's
+// gtid_executed, and the target is waited by WAIT_FOR_EXECUTED_GTID_SET.
+func NewGTIDWaiter(source, target *sql.DB, timeout time.Duration) ReplicationWaiter {
+	return &gtidWaiter{
+		source:  source,
+		target:  target,
+		timeout: timeout,
+	}
+}
+
+func (w *gtidWaiter) CapturePosition(ctx context.Context) (string, error) {
+	var gtidSet string
+	err := w.source.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed").Scan(&gtidSet)
+	return gtidSet, errors.Trace(err)
+}
+
+func (w *gtidWaiter) WaitPosition(ctx context.Context, position string) error {
+	/*
+		mysql> SELECT WAIT_FOR_EXECUTED_GTID_SET('3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5', 10);
+		+---------------------------------------------------------------------------+
+		| WAIT_FOR_EXECUTED_GTID_SET('3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5', 10) |
+		+---------------------------------------------------------------------------+
+		|                                                                         0 |
+		+---------------------------------------------------------------------------+
+	*/
+	var timeout sql.NullInt64
+	err := w.target.QueryRowContext(ctx, "SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?)", position, int64(w.timeout.Seconds())).Scan(&timeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if timeout.Int64 != 0 {
+		return errors.Errorf("wait gtid set %s timeout after %s", position, w.timeout)
+	}
+
+	return nil
+}
+
+// tsoWaiter waits the replication from TiDB by TSO.
+type tsoWaiter struct {
+	source         *sql.DB
+	target         *sql.DB
+	appliedTSQuery string
+	timeout        time.Duration
+	interval       time.Duration
+}
+
+// NewTSOWaiter returns a ReplicationWaiter for the replication from TiDB, the position is the source's TSO, and the
+// target's applied TSO is got by appliedTSQuery, for example the query of the replication tool's checkpoint.
+// the target is polled every interval.
+func NewTSOWaiter(source, target *sql.DB, appliedTSQuery string, timeout, interval time.Duration) ReplicationWaiter {
+	return &tsoWaiter{
+		source:         source,
+		target:         target,
+		appliedTSQuery: appliedTSQuery,
+		timeout:        timeout,
+		interval:       interval,
+	}
+}
+
+func (w *tsoWaiter) CapturePosition(ctx context.Context) (string, error) {
+	ts, err := dbutil.GetTidbLatestTSO(ctx, w.source)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return strconv.FormatInt(ts, 10), nil
+}
+
+func (w *tsoWaiter) WaitPosition(ctx context.Context, position string) error {
+	ts, err := strconv.ParseInt(position, 10, 64)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	deadline := time.Now().Add(w.timeout)
+	for {
+		var appliedTS int64
+		err = w.target.QueryRowContext(ctx, w.appliedTSQuery).Scan(&appliedTS)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if appliedTS >= ts {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("wait ts %d timeout after %s, the applied ts is %d", ts, w.timeout, appliedTS)
+		}
+
+		log.Debug("wait target to apply ts", zap.Int64("ts", ts), zap.Int64("applied ts", appliedTS))
+		select {
+		case <-time.After(w.interval):
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testReplicationSuite{})
+
+type testReplicationSuite struct{}
+
+func (s *testReplicationSuite) TestGTIDWaiter(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	waiter := NewGTIDWaiter(sourceDB, targetDB, 10*time.Second)
+	ctx := context.Background()
+
+	gtidSet := "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5"
+	sourceMock.ExpectQuery("SELECT @@GLOBAL.gtid_executed").WillReturnRows(sqlmock.NewRows([]string{"gtid"}).AddRow(gtidSet))
+	position, err := waiter.CapturePosition(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, gtidSet)
+
+	targetMock.ExpectQuery("SELECT WAIT_FOR_EXECUTED_GTID_SET").WithArgs(gtidSet, 10).WillReturnRows(sqlmock.NewRows([]string{"timeout"}).AddRow(0))
+	c.Assert(waiter.WaitPosition(ctx, position), IsNil)
+
+	targetMock.ExpectQuery("SELECT WAIT_FOR_EXECUTED_GTID_SET").WithArgs(gtidSet, 10).WillReturnRows(sqlmock.NewRows([]string{"timeout"}).AddRow(1))
+	c.Assert(waiter.WaitPosition(ctx, position), ErrorMatches, ".*timeout.*")
+
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testReplicationSuite) TestTSOWaiter(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	waiter := NewTSOWaiter(sourceDB, targetDB, "SELECT commit_ts FROM checkpoint", time.Minute, time.Millisecond)
+	ctx := context.Background()
+
+	sourceMock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).AddRow("tidb-binlog", "400718757701615617", "", "", ""))
+	position, err := waiter.CapturePosition(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(position, Equals, "400718757701615617")
+
+	// the target is polled until the applied ts passes the position
+	targetMock.ExpectQuery("SELECT commit_ts FROM checkpoint").WillReturnRows(sqlmock.NewRows([]string{"commit_ts"}).AddRow(400718757701615000))
+	targetMock.ExpectQuery("SELECT commit_ts FROM checkpoint").WillReturnRows(sqlmock.NewRows([]string{"commit_ts"}).AddRow(400718757701615617))
+	c.Assert(waiter.WaitPosition(ctx, position), IsNil)
+
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// RowCountSource is a RowSource which can count the rows in a chunk cheaply.
+type RowCountSource interface {
+	RowSource
+
+	// GetRowCount returns the number of rows in the chunk.
+	GetRowCount(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo) (int64, error)
+}
+
+// GetRowCount implements RowCountSource's GetRowCount.
+func (s *sqlRowSource) GetRowCount(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo) (int64, error) {
+	where, args := s.table.chunkWhere(chunk)
+	cnt, err := getChunkRowCount(ctx, s.table.Conn, s.table.Schema, s.table.Table, where, args)
+	return cnt, errors.Trace(err)
+}
+
+// supportRowCount returns true if all the table instances' RowSources can count rows.
+func (t *TableDiff) supportRowCount() bool {
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		if _, ok := table.rowSource().(RowCountSource); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareRowCount compares the number of rows in the chunk of source tables and target table,
+// the chunk is not equal if the counts are different.
+func (t *TableDiff) compareRowCount(ctx context.Context, chunk *ChunkRange, result *ChunkResult) (bool, error) {
+	var sourceCount int64
+	for _, sourceTable := range t.SourceTables {
+		ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+		cnt, err := sourceTable.rowSource().(RowCountSource).GetRowCount(ctx1, chunk, sourceTable.info)
+		cancel1()
+		if err != nil {
+			return false, errors.Annotatef(err, "get row count of %s in %s", dbutil.TableName(sourceTable.Schema, sourceTable.Table), sourceTable.InstanceID)
+		}
+		sourceCount += cnt
+	}
+
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutChecksum)
+	targetCount, err := t.TargetTable.rowSource().(RowCountSource).GetRowCount(ctx1, chunk, t.TargetTable.info)
+	cancel1()
+	if err != nil {
+		return false, errors.Annotatef(err, "get row count of %s in %s", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table), t.TargetTable.InstanceID)
+	}
+
+	atomic.AddInt64(&t.sourceRowCount, sourceCount)
+	atomic.AddInt64(&t.targetRowCount, targetCount)
+	result.RowCountCompared = true
+	result.SourceRowCount = sourceCount
+	result.TargetRowCount = targetCount
+
+	if sourceCount == targetCount {
+		return true, nil
+	}
+
+	log.Warn("row count is not equal", zap.String("table", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("where", chunk.Where), t.redact.chunkArgs(chunk), zap.Int64("source count", sourceCount), zap.Int64("target count", targetCount))
+	return false, nil
+}
+
+// RowCounts returns the total number of rows in source tables and target table counted by the row count check,
+// only contains the chunks checked in the latest Equal. ok is false if RowCountCheck is not enabled.
+func (t *TableDiff) RowCounts() (sourceCount, targetCount int64, ok bool) {
+	if !t.RowCountCheck {
+		return 0, 0, false
+	}
+
+	return atomic.LoadInt64(&t.sourceRowCount), atomic.LoadInt64(&t.targetRowCount), true
+}
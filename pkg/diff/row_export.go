@@ -0,0 +1,213 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+const (
+	// RowOnlyInSource means the row only exists in source tables.
+	RowOnlyInSource = "only-in-source"
+	// RowOnlyInTarget means the row only exists in target table.
+	RowOnlyInTarget = "only-in-target"
+	// RowDifferent means the row exists in both sides but has different data.
+	RowDifferent = "different"
+	// RowDuplicatedKey means the row's unique key exists in more than one row on either side, all the rows of the key
+	// are exported with the values of their own side.
+	RowDuplicatedKey = "duplicated-key"
+
+	// ExportFormatCSV writes one line for every different column.
+	ExportFormatCSV = "csv"
+	// ExportFormatJSON writes one json object for every different row, a.k.a. NDJSON.
+	ExportFormatJSON = "json"
+
+	// nullValue is used to represent NULL in csv, same as mysql's LOAD DATA.
+	nullValue = `\N`
+)
+
+// ColumnDiff is a column's values in source and target, the value is nil if the column is NULL or the row doesn't exist.
+// the binary column's value is formatted as hex, for example "0x0127FF".
+type ColumnDiff struct {
+	Name   string  `json:"name"`
+	Source *string `json:"source"`
+	Target *string `json:"target"`
+}
+
+// RowDiff is a row which is different in source and target.
+type RowDiff struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// one of RowOnlyInSource, RowOnlyInTarget, RowDifferent and RowDuplicatedKey
+	Type string `json:"type"`
+	// the instance id of the source table which contains the row, is empty if the row only exists in target.
+	SourceInstance string `json:"source-instance,omitempty"`
+	// the key columns' values, format is "a=1,b=2"
+	Key string `json:"key"`
+	// the different columns, contains all the columns if the row only exists in one side.
+	Columns []*ColumnDiff `json:"columns"`
+}
+
+// RowDiffExporter exports the different rows, should be safe for concurrent use.
+type RowDiffExporter interface {
+	Export(row *RowDiff) error
+}
+
+// NewRowDiffExporter returns a RowDiffExporter which writes rows to w with the format, format can be "csv" or "json".
+func NewRowDiffExporter(format string, w io.Writer) (RowDiffExporter, error) {
+	switch format {
+	case ExportFormatCSV:
+		exporter := &csvRowDiffExporter{
+			w: csv.NewWriter(w),
+		}
+		if err := exporter.writeRecord([]string{"schema", "table", "type", "source-instance", "key", "column", "source", "target"}); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return exporter, nil
+	case ExportFormatJSON:
+		return &jsonRowDiffExporter{
+			encoder: json.NewEncoder(w),
+		}, nil
+	default:
+		return nil, errors.NotValidf("export format %s", format)
+	}
+}
+
+type csvRowDiffExporter struct {
+	sync.Mutex
+	w *csv.Writer
+}
+
+// Export implements RowDiffExporter's Export.
+func (e *csvRowDiffExporter) Export(row *RowDiff) error {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, col := range row.Columns {
+		err := e.w.Write([]string{row.Schema, row.Table, row.Type, row.SourceInstance, row.Key, col.Name, csvValue(col.Source), csvValue(col.Target)})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	e.w.Flush()
+
+	return errors.Trace(e.w.Error())
+}
+
+func (e *csvRowDiffExporter) writeRecord(record []string) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if err := e.w.Write(record); err != nil {
+		return errors.Trace(err)
+	}
+	e.w.Flush()
+
+	return errors.Trace(e.w.Error())
+}
+
+func csvValue(value *string) string {
+	if value == nil {
+		return nullValue
+	}
+	return *value
+}
+
+type jsonRowDiffExporter struct {
+	sync.Mutex
+	encoder *json.Encoder
+}
+
+// Export implements RowDiffExporter's Export.
+func (e *jsonRowDiffExporter) Export(row *RowDiff) error {
+	e.Lock()
+	defer e.Unlock()
+
+	return errors.Trace(e.encoder.Encode(row))
+}
+
+// newRowDiff returns a RowDiff, sourceData or targetData is nil if the row doesn't exist in that side.
+// only the different columns are contained if the row exists in both sides. the values of the columns masked by redact
+// are replaced.
+func newRowDiff(schema, table, sourceInstance string, sourceData, targetData map[string]*dbutil.ColumnData, keys []*model.ColumnInfo, columns []*model.ColumnInfo, comparators map[string]string, redact *redactor) *RowDiff {
+	row := &RowDiff{
+		Schema:         schema,
+		Table:          table,
+		SourceInstance: sourceInstance,
+	}
+
+	data := sourceData
+	switch {
+	case targetData == nil:
+		row.Type = RowOnlyInSource
+	case sourceData == nil:
+		row.Type = RowOnlyInTarget
+		data = targetData
+	default:
+		row.Type = RowDifferent
+	}
+
+	row.Key = formatRowKey(keys, data, redact)
+
+	for _, col := range columns {
+		sourceCol, ok1 := sourceData[col.Name.O]
+		targetCol, ok2 := targetData[col.Name.O]
+		if !ok1 && !ok2 {
+			// the ignored column
+			continue
+		}
+		if ok1 && ok2 && equalColumnData(col, comparators[col.Name.O], sourceCol, targetCol) {
+			continue
+		}
+
+		row.Columns = append(row.Columns, &ColumnDiff{
+			Name:   col.Name.O,
+			Source: redact.value(col.Name.O, exportValue(col, sourceCol)),
+			Target: redact.value(col.Name.O, exportValue(col, targetCol)),
+		})
+	}
+
+	return row
+}
+
+// formatRowKey formats the key columns' values of the row as "a=1,b=2", the masked values are replaced.
+func formatRowKey(keys []*model.ColumnInfo, data map[string]*dbutil.ColumnData, redact *redactor) string {
+	keyItems := make([]string, 0, len(keys))
+	for _, key := range keys {
+		keyItems = append(keyItems, fmt.Sprintf("%s=%s", key.Name.O, csvValue(redact.value(key.Name.O, exportValue(key, data[key.Name.O])))))
+	}
+	return strings.Join(keyItems, ",")
+}
+
+func exportValue(col *model.ColumnInfo, data *dbutil.ColumnData) *string {
+	if data == nil || data.IsNull {
+		return nil
+	}
+
+	value := string(data.Data)
+	if isBinaryColumn(col) {
+		value = "0x" + strings.ToUpper(hex.EncodeToString(data.Data))
+	}
+	return &value
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testRowExportSuite{})
+
+type testRowExportSuite struct{}
+
+func (s *testRowExportSuite) TestExportRowDiff(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`id` int, `name` varchar(24), `b` varbinary(10), `c` int, primary key(`id`))")
+	c.Assert(err, IsNil)
+	keys := []*model.ColumnInfo{tableInfo.Columns[0]}
+
+	sourceData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("a,b")},
+		"b":    {Data: []byte{0x01, 0xff}},
+		"c":    {IsNull: true},
+	}
+	targetData := map[string]*dbutil.ColumnData{
+		"id":   {Data: []byte("1")},
+		"name": {Data: []byte("a,b")},
+		"b":    {Data: []byte{0x01}},
+		"c":    {Data: []byte("2")},
+	}
+
+	rows := []*RowDiff{
+		newRowDiff("test", "atest", "source-1", sourceData, targetData, keys, tableInfo.Columns, nil, nil),
+		newRowDiff("test", "atest", "", nil, map[string]*dbutil.ColumnData{"id": {Data: []byte("2")}, "c": {Data: []byte("3")}}, keys, tableInfo.Columns, nil, nil),
+	}
+	c.Assert(rows[0].Type, Equals, RowDifferent)
+	c.Assert(rows[0].Key, Equals, "id=1")
+	c.Assert(rows[0].Columns, HasLen, 2)
+	c.Assert(rows[1].Type, Equals, RowOnlyInTarget)
+	c.Assert(rows[1].Columns, HasLen, 2)
+
+	buf := new(bytes.Buffer)
+	exporter, err := NewRowDiffExporter(ExportFormatCSV, buf)
+	c.Assert(err, IsNil)
+	for _, row := range rows {
+		c.Assert(exporter.Export(row), IsNil)
+	}
+	c.Assert(buf.String(), Equals, "schema,table,type,source-instance,key,column,source,target\n"+
+		"test,atest,different,source-1,id=1,b,0x01FF,0x01\n"+
+		"test,atest,different,source-1,id=1,c,\\N,2\n"+
+		"test,atest,only-in-target,,id=2,id,\\N,2\n"+
+		"test,atest,only-in-target,,id=2,c,\\N,3\n")
+
+	buf.Reset()
+	exporter, err = NewRowDiffExporter(ExportFormatJSON, buf)
+	c.Assert(err, IsNil)
+	c.Assert(exporter.Export(rows[0]), IsNil)
+	c.Assert(buf.String(), Equals, `{"schema":"test","table":"atest","type":"different","source-instance":"source-1","key":"id=1","columns":[{"name":"b","source":"0x01FF","target":"0x01"},{"name":"c","source":null,"target":"2"}]}`+"\n")
+
+	_, err = NewRowDiffExporter("xml", buf)
+	c.Assert(err, NotNil)
+}
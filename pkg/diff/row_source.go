@@ -0,0 +1,127 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+)
+
+// RowSource provides a table instance's struct and rows, the default RowSource selects them from the database,
+// other implementations can read them from files, for example a Dumpling export directory.
+type RowSource interface {
+	// GetTableInfo returns the table's struct, the implicit column _tidb_rowid is added if useRowID is true and supported.
+	GetTableInfo(ctx context.Context, useRowID bool) (*model.TableInfo, error)
+
+	// GetRows returns the rows in the chunk ordered by the table's unique order keys, and the order keys.
+	// the columns in ignoreColumns are not returned.
+	GetRows(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, collation string) ([]map[string]*dbutil.ColumnData, []*model.ColumnInfo, error)
+}
+
+// ChecksumSource is a RowSource which can calculate the checksum of a chunk, the checksum is only comparable between
+// the ChecksumSources which use the same algorithm. the chunks are compared by rows if any instance doesn't support it.
+type ChecksumSource interface {
+	RowSource
+
+	// GetChecksum returns the checksum and the number of the rows in the chunk.
+	// the columns in columnExprs are replaced by the expressions when calculating the checksum.
+	GetChecksum(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, columnExprs map[string]string) (int64, int64, error)
+}
+
+// rowStreamer is a RowSource which can read the rows in the chunk one by one like GetRows, so the rows are not
+// materialized in memory, and can be spilled to disk.
+type rowStreamer interface {
+	streamRows(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, collation string, fn func(map[string]*dbutil.ColumnData) error) ([]*model.ColumnInfo, error)
+}
+
+// sqlRowSource selects rows and checksum from the table instance's database.
+type sqlRowSource struct {
+	table *TableInstance
+}
+
+// NewSQLRowSource returns a RowSource which selects rows from the table instance's database.
+func NewSQLRowSource(table *TableInstance) ChecksumSource {
+	return &sqlRowSource{table: table}
+}
+
+// GetTableInfo implements RowSource's GetTableInfo.
+func (s *sqlRowSource) GetTableInfo(ctx context.Context, useRowID bool) (*model.TableInfo, error) {
+	if s.table.isView {
+		tableInfo, err := dbutil.GetViewInfo(ctx, s.table.Conn, s.table.Schema, s.table.Table)
+		return tableInfo, errors.Trace(err)
+	}
+
+	if s.table.MetadataCache != nil {
+		tableInfo, err := s.table.MetadataCache.GetTableInfoWithRowID(ctx, s.table.Conn, s.table.Schema, s.table.Table, useRowID)
+		return tableInfo, errors.Trace(err)
+	}
+
+	tableInfo, err := dbutil.GetTableInfoWithRowID(ctx, s.table.Conn, s.table.Schema, s.table.Table, useRowID)
+	return tableInfo, errors.Trace(err)
+}
+
+// GetRows implements RowSource's GetRows.
+func (s *sqlRowSource) GetRows(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, collation string) ([]map[string]*dbutil.ColumnData, []*model.ColumnInfo, error) {
+	where, args := s.table.chunkWhere(chunk)
+	rows, orderKeyCols, err := getChunkRows(ctx, s.table.Conn, s.table.Schema, s.table.Table, tableInfo, s.table.indexHint, where, args, ignoreColumns, s.table.rowExprs(), collation)
+	return rows, orderKeyCols, errors.Trace(err)
+}
+
+func (s *sqlRowSource) streamRows(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, collation string, fn func(map[string]*dbutil.ColumnData) error) ([]*model.ColumnInfo, error) {
+	where, args := s.table.chunkWhere(chunk)
+	orderKeyCols, err := iterChunkRows(ctx, s.table.Conn, s.table.Schema, s.table.Table, tableInfo, s.table.indexHint, where, args, ignoreColumns, s.table.rowExprs(), collation, fn)
+	return orderKeyCols, errors.Trace(err)
+}
+
+// GetChecksum implements ChecksumSource's GetChecksum.
+func (s *sqlRowSource) GetChecksum(ctx context.Context, chunk *ChunkRange, tableInfo *model.TableInfo, ignoreColumns map[string]interface{}, columnExprs map[string]string) (int64, int64, error) {
+	where, args := s.table.chunkWhere(chunk)
+	checksum, count, err := dbutil.GetCRC32ChecksumWithCountByIndex(ctx, s.table.Conn, s.table.Schema, s.table.Table, tableInfo, s.table.indexHint, where, args, ignoreColumns, columnExprs)
+	return checksum, count, errors.Trace(err)
+}
+
+// chunkWhere returns the chunk's conditions and arguments in the table instance, the bounds of the columns in
+// ColumnExprs are compared with the expressions, and the instance's Range is merged.
+func (t *TableInstance) chunkWhere(chunk *ChunkRange) (string, []interface{}) {
+	rebuild := len(t.Range) != 0
+	for _, bound := range chunk.Bounds {
+		if _, ok := t.ColumnExprs[bound.Column]; ok {
+			rebuild = true
+			break
+		}
+	}
+	if !rebuild {
+		return chunk.Where, utils.StringsToInterfaces(chunk.Args)
+	}
+
+	limits := t.limits
+	if len(limits) == 0 {
+		limits = t.mergeRange("TRUE")
+	}
+	conditions, args := chunk.toStringByExprs(t.collation, t.ColumnExprs)
+	return fmt.Sprintf("(%s AND %s)", conditions, limits), utils.StringsToInterfaces(args)
+}
+
+// rowSource returns the table instance's RowSource, selects rows from the database if Source is nil.
+func (t *TableInstance) rowSource() RowSource {
+	if t.Source != nil {
+		return t.Source
+	}
+	return NewSQLRowSource(t)
+}
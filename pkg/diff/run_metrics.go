@@ -0,0 +1,178 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// RunMetrics collects the statistics of the checked chunks in one run, and writes a final snapshot in OpenMetrics text
+// format, so the batch pipelines without a prometheus scraper can still ingest the statistics of the run.
+// HandleChunkResult can be used as TableDiff's ChunkResultHandler.
+type RunMetrics struct {
+	sync.Mutex
+
+	startTime time.Time
+	tables    map[tableKey]*tableRunMetrics
+}
+
+type tableKey struct {
+	schema string
+	table  string
+}
+
+type tableRunMetrics struct {
+	// the number of chunks by the final state
+	chunks        map[string]int64
+	differentRows int64
+	sourceBytes   int64
+	targetBytes   int64
+	// the total time used to check the chunks
+	checkDuration time.Duration
+}
+
+// NewRunMetrics returns a new RunMetrics, the run's duration is counted from now.
+func NewRunMetrics() *RunMetrics {
+	return &RunMetrics{
+		startTime: time.Now(),
+		tables:    make(map[tableKey]*tableRunMetrics),
+	}
+}
+
+// HandleChunkResult collects the chunk's result, it's safe to be called concurrently.
+func (m *RunMetrics) HandleChunkResult(ctx context.Context, result *ChunkResult) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := tableKey{schema: result.Schema, table: result.Table}
+	table, ok := m.tables[key]
+	if !ok {
+		table = &tableRunMetrics{chunks: make(map[string]int64)}
+		m.tables[key] = table
+	}
+
+	table.chunks[result.State]++
+	table.differentRows += int64(result.DifferentRows)
+	table.sourceBytes += result.SourceBytes
+	table.targetBytes += result.TargetBytes
+	table.checkDuration += result.Duration
+}
+
+// WriteOpenMetrics writes the snapshot of the metrics in OpenMetrics text format.
+func (m *RunMetrics) WriteOpenMetrics(w io.Writer) error {
+	m.Lock()
+	defer m.Unlock()
+
+	keys := make([]tableKey, 0, len(m.tables))
+	for key := range m.tables {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].schema != keys[j].schema {
+			return keys[i].schema < keys[j].schema
+		}
+		return keys[i].table < keys[j].table
+	})
+
+	bw := bufio.NewWriter(w)
+	writeFamily := func(name, tp, unit, help string) {
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, tp)
+		if unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", name, unit)
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+	}
+	writeSample := func(name string, key tableKey, extraLabels string, value interface{}) {
+		fmt.Fprintf(bw, "%s{schema=\"%s\",table=\"%s\"%s} %v\n", name, escapeLabelValue(key.schema), escapeLabelValue(key.table), extraLabels, value)
+	}
+
+	writeFamily("sync_diff_chunks", "counter", "", "number of checked chunks by the final state")
+	for _, key := range keys {
+		table := m.tables[key]
+		states := make([]string, 0, len(table.chunks))
+		for state := range table.chunks {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		for _, state := range states {
+			writeSample("sync_diff_chunks_total", key, fmt.Sprintf(",state=\"%s\"", escapeLabelValue(state)), table.chunks[state])
+		}
+	}
+
+	writeFamily("sync_diff_different_rows", "counter", "", "number of different rows found by comparing the rows")
+	for _, key := range keys {
+		writeSample("sync_diff_different_rows_total", key, "", m.tables[key].differentRows)
+	}
+
+	writeFamily("sync_diff_compared_bytes", "counter", "bytes", "size of the rows selected to compare")
+	for _, key := range keys {
+		writeSample("sync_diff_compared_bytes_total", key, ",side=\"source\"", m.tables[key].sourceBytes)
+		writeSample("sync_diff_compared_bytes_total", key, ",side=\"target\"", m.tables[key].targetBytes)
+	}
+
+	writeFamily("sync_diff_chunk_check_duration_seconds", "counter", "seconds", "total time used to check the chunks")
+	for _, key := range keys {
+		writeSample("sync_diff_chunk_check_duration_seconds_total", key, "", m.tables[key].checkDuration.Seconds())
+	}
+
+	writeFamily("sync_diff_run_duration_seconds", "gauge", "seconds", "time used by the run")
+	fmt.Fprintf(bw, "sync_diff_run_duration_seconds %v\n", time.Since(m.startTime).Seconds())
+	writeFamily("sync_diff_run_start_time_seconds", "gauge", "seconds", "unix time when the run started")
+	fmt.Fprintf(bw, "sync_diff_run_start_time_seconds %d\n", m.startTime.Unix())
+
+	fmt.Fprint(bw, "# EOF\n")
+	return errors.Trace(bw.Flush())
+}
+
+// WriteFile writes the snapshot of the metrics into the file, the file is replaced atomically,
+// so the pipelines never read a partial snapshot.
+func (m *RunMetrics) WriteFile(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.Remove(f.Name())
+
+	// the temp file is only readable by the owner
+	if err = f.Chmod(0644); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	if err = m.WriteOpenMetrics(f); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	if err = f.Close(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(os.Rename(f.Name(), path))
+}
+
+// escapeLabelValue escapes the label value in OpenMetrics text format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
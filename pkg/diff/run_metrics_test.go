@@ -0,0 +1,68 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testRunMetricsSuite{})
+
+type testRunMetricsSuite struct{}
+
+func (s *testRunMetricsSuite) TestWriteOpenMetrics(c *C) {
+	m := NewRunMetrics()
+	ctx := context.Background()
+	m.HandleChunkResult(ctx, &ChunkResult{Schema: "test", Table: "t2", State: successState, Duration: time.Second})
+	m.HandleChunkResult(ctx, &ChunkResult{Schema: "test", Table: "t1", State: successState, Duration: time.Second, SourceBytes: 10, TargetBytes: 10})
+	m.HandleChunkResult(ctx, &ChunkResult{Schema: "test", Table: "t1", State: failedState, Duration: 2 * time.Second, DifferentRows: 3, SourceBytes: 20, TargetBytes: 15})
+	m.HandleChunkResult(ctx, &ChunkResult{Schema: "test", Table: `t"3`, State: ignoreState})
+
+	dir, err := ioutil.TempDir("", "run-metrics")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.txt")
+	c.Assert(m.WriteFile(path), IsNil)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	content := string(data)
+
+	for _, line := range []string{
+		"# TYPE sync_diff_chunks counter\n",
+		`sync_diff_chunks_total{schema="test",table="t1",state="failed"} 1` + "\n",
+		`sync_diff_chunks_total{schema="test",table="t1",state="success"} 1` + "\n",
+		`sync_diff_chunks_total{schema="test",table="t\"3",state="ignore"} 1` + "\n",
+		`sync_diff_different_rows_total{schema="test",table="t1"} 3` + "\n",
+		`sync_diff_compared_bytes_total{schema="test",table="t1",side="source"} 30` + "\n",
+		`sync_diff_compared_bytes_total{schema="test",table="t1",side="target"} 25` + "\n",
+		`sync_diff_chunk_check_duration_seconds_total{schema="test",table="t1"} 3` + "\n",
+		"# UNIT sync_diff_run_duration_seconds seconds\n",
+	} {
+		c.Assert(strings.Contains(content, line), IsTrue, Commentf("%s not in %s", line, content))
+	}
+	c.Assert(strings.Index(content, `table="t1"`) < strings.Index(content, `table="t2"`), IsTrue)
+	c.Assert(strings.HasSuffix(content, "# EOF\n"), IsTrue)
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
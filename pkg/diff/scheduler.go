@@ -0,0 +1,118 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// Scheduler checks multiple tables concurrently under a global budget. the tables are started in the order of their
+// estimated size, the largest first, so the whole run is not delayed by a large table started at last.
+type Scheduler struct {
+	tableConcurrency int
+	limiter          *ConcurrencyLimiter
+}
+
+// NewScheduler returns a Scheduler which checks at most tableConcurrency tables concurrently. limiter limits the number
+// of chunks checked concurrently across all the tables, so the connections are not exhausted, it's set as every table's
+// GlobalLimiter. nil means no limit, and the chunks are only limited by the tables' CheckThreadCount.
+func NewScheduler(tableConcurrency int, limiter *ConcurrencyLimiter) *Scheduler {
+	if tableConcurrency <= 0 {
+		tableConcurrency = 1
+	}
+
+	return &Scheduler{
+		tableConcurrency: tableConcurrency,
+		limiter:          limiter,
+	}
+}
+
+// Run calls check for every table concurrently, check should run the TableDiff, for example by Equal.
+// the tables failed to estimate are started last. no more tables are started after check returns error or the context
+// is done, and the first error is returned after the running tables are finished.
+func (s *Scheduler) Run(ctx context.Context, tables []*TableDiff, check func(ctx context.Context, table *TableDiff) error) error {
+	tables = s.orderTables(ctx, tables)
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+	defer cancel1()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	tableCh := make(chan *TableDiff)
+	for i := 0; i < s.tableConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for table := range tableCh {
+				if err := check(ctx1, table); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel1()
+					})
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, table := range tables {
+		if s.limiter != nil {
+			table.GlobalLimiter = s.limiter
+		}
+
+		select {
+		case tableCh <- table:
+		case <-ctx1.Done():
+			break dispatch
+		}
+	}
+	close(tableCh)
+	wg.Wait()
+
+	if firstErr != nil {
+		return errors.Trace(firstErr)
+	}
+	return errors.Trace(ctx.Err())
+}
+
+// orderTables orders the tables by the estimated bytes to be scanned, from large to small.
+func (s *Scheduler) orderTables(ctx context.Context, tables []*TableDiff) []*TableDiff {
+	bytes := make(map[*TableDiff]int64, len(tables))
+	for _, table := range tables {
+		estimate, err := table.Estimate(ctx)
+		if err != nil {
+			log.Warn("estimate table failed, will be checked last", zap.String("table", dbutil.TableName(table.TargetTable.Schema, table.TargetTable.Table)), zap.Error(err))
+			bytes[table] = -1
+			continue
+		}
+		bytes[table] = estimate.Bytes
+	}
+
+	orderedTables := append([]*TableDiff{}, tables...)
+	sort.SliceStable(orderedTables, func(i, j int) bool {
+		return bytes[orderedTables[i]] > bytes[orderedTables[j]]
+	})
+
+	return orderedTables
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"errors"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testSchedulerSuite{})
+
+type testSchedulerSuite struct{}
+
+func (s *testSchedulerSuite) TestScheduler(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	tables := make([]*TableDiff, 0, 3)
+	for _, name := range []string{"t1", "t2", "t3"} {
+		tables = append(tables, &TableDiff{
+			TargetTable: &TableInstance{Conn: db, Schema: "test", Table: name, InstanceID: "target"},
+			ChunkSize:   100,
+		})
+	}
+	expectEstimate := func() {
+		mock.ExpectQuery("SELECT TABLE_ROWS").WithArgs("test", "t1").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS", "AVG_ROW_LENGTH", "DATA_LENGTH"}).AddRow(100, 10, 1000))
+		mock.ExpectQuery("SELECT TABLE_ROWS").WithArgs("test", "t2").WillReturnError(errors.New("table not exists"))
+		mock.ExpectQuery("SELECT TABLE_ROWS").WithArgs("test", "t3").WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS", "AVG_ROW_LENGTH", "DATA_LENGTH"}).AddRow(500, 10, 5000))
+	}
+
+	// the largest table is checked first, and the table failed to estimate is checked last
+	expectEstimate()
+	limiter := NewConcurrencyLimiter("global", 2)
+	var checked []string
+	err = NewScheduler(1, limiter).Run(context.Background(), tables, func(ctx context.Context, table *TableDiff) error {
+		c.Assert(table.GlobalLimiter, Equals, limiter)
+		checked = append(checked, table.TargetTable.Table)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(checked, DeepEquals, []string{"t3", "t1", "t2"})
+
+	// returns the error of the check
+	expectEstimate()
+	err = NewScheduler(2, nil).Run(context.Background(), tables, func(ctx context.Context, table *TableDiff) error {
+		if table.TargetTable.Table == "t1" {
+			return errors.New("check failed")
+		}
+		return nil
+	})
+	c.Assert(err, ErrorMatches, "check failed")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// rowBuffer buffers the ordered rows of a chunk, the rows in memory are spilled to a temporary file when the
+// MemoryLimiter's budget is exceeded, and the rows are read back in the same order. it never spills if the limiter is nil.
+type rowBuffer struct {
+	limiter *MemoryLimiter
+	// the bytes reserved by the chunk, used before consuming from the limiter
+	reservation *memoryReservation
+
+	// the first row added, used to check the row's columns
+	first map[string]*dbutil.ColumnData
+	rows  []map[string]*dbutil.ColumnData
+	// the bytes of rows consumed from the limiter and taken from the reservation
+	memBytes      int64
+	reservedBytes int64
+
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+	// the number of the rows spilled to the file
+	spilled int
+
+	// the number and the bytes of all the rows
+	count int
+	bytes int64
+}
+
+func newRowBuffer(limiter *MemoryLimiter) *rowBuffer {
+	return &rowBuffer{limiter: limiter}
+}
+
+// add appends the row, the rows should be added by the order keys.
+func (b *rowBuffer) add(row map[string]*dbutil.ColumnData) error {
+	size := rowBytes(row)
+	if b.reservation.take(size) {
+		b.reservedBytes += size
+	} else {
+		if !b.limiter.tryConsume(size) {
+			if err := b.spill(); err != nil {
+				return errors.Trace(err)
+			}
+			if !b.limiter.tryConsume(size) {
+				// the row is kept in memory even if it's larger than the budget
+				b.limiter.consume(size)
+			}
+		}
+		b.memBytes += size
+	}
+
+	if b.first == nil {
+		b.first = row
+	}
+	b.rows = append(b.rows, row)
+	b.count++
+	b.bytes += size
+	return nil
+}
+
+// spill writes the rows in memory to the temporary file, and releases their bytes.
+func (b *rowBuffer) spill() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+
+	if b.file == nil {
+		file, err := ioutil.TempFile(b.limiter.spillDir, "sync-diff-rows-")
+		if err != nil {
+			return errors.Annotate(err, "create spill file")
+		}
+		b.file = file
+		b.writer = bufio.NewWriter(file)
+		b.encoder = gob.NewEncoder(b.writer)
+		log.Debug("spill rows to file", zap.String("file", file.Name()))
+	}
+
+	for _, row := range b.rows {
+		if err := b.encoder.Encode(row); err != nil {
+			return errors.Annotatef(err, "spill rows to file %s", b.file.Name())
+		}
+	}
+	b.spilled += len(b.rows)
+	b.rows = nil
+	b.releaseMemory()
+	return nil
+}
+
+// releaseMemory releases the bytes of the rows in memory to the limiter and the reservation.
+func (b *rowBuffer) releaseMemory() {
+	b.limiter.release(b.memBytes)
+	b.memBytes = 0
+	b.reservation.put(b.reservedBytes)
+	b.reservedBytes = 0
+}
+
+// iter returns an iterator of all the rows in the order they are added, the buffer should not be added any more.
+func (b *rowBuffer) iter() (*rowIterator, error) {
+	iter := &rowIterator{buffer: b}
+	if b.file == nil {
+		return iter, nil
+	}
+
+	if err := b.writer.Flush(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Trace(err)
+	}
+	iter.decoder = gob.NewDecoder(bufio.NewReader(b.file))
+	return iter, nil
+}
+
+// close releases the memory and removes the temporary file.
+func (b *rowBuffer) close() {
+	b.rows = nil
+	b.releaseMemory()
+
+	if b.file != nil {
+		b.file.Close()
+		if err := os.Remove(b.file.Name()); err != nil {
+			log.Warn("remove spill file failed", zap.String("file", b.file.Name()), zap.Error(err))
+		}
+		b.file = nil
+	}
+}
+
+// rowIterator reads the rows of a rowBuffer one by one, the spilled rows are read from the file first.
+type rowIterator struct {
+	buffer  *rowBuffer
+	decoder *gob.Decoder
+	// the number of the rows read from the file and the memory
+	fileRead int
+	memRead  int
+}
+
+// next returns the next row, returns nil if all the rows are read.
+func (it *rowIterator) next() (map[string]*dbutil.ColumnData, error) {
+	if it.fileRead < it.buffer.spilled {
+		var row map[string]*dbutil.ColumnData
+		if err := it.decoder.Decode(&row); err != nil {
+			return nil, errors.Annotatef(err, "read spilled rows from file %s", it.buffer.file.Name())
+		}
+		it.fileRead++
+		return row, nil
+	}
+
+	if it.memRead < len(it.buffer.rows) {
+		it.memRead++
+		return it.buffer.rows[it.memRead-1], nil
+	}
+	return nil, nil
+}
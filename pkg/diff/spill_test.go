@@ -0,0 +1,161 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testSpillSuite{})
+
+type testSpillSuite struct{}
+
+func (s *testSpillSuite) TestMemoryLimiter(c *C) {
+	limiter := NewMemoryLimiter(10, "")
+	c.Assert(limiter.tryConsume(6), IsTrue)
+	c.Assert(limiter.tryConsume(6), IsFalse)
+	limiter.consume(6)
+	c.Assert(limiter.InUse(), Equals, int64(12))
+	limiter.release(12)
+	c.Assert(limiter.InUse(), Equals, int64(0))
+
+	// no limit
+	var nilLimiter *MemoryLimiter
+	c.Assert(nilLimiter.tryConsume(100), IsTrue)
+}
+
+func (s *testSpillSuite) TestMemoryHardLimit(c *C) {
+	limiter := NewMemoryLimiter(0, "")
+	limiter.SetHardLimit(10)
+	ctx := context.Background()
+
+	// the first reservation never waits even if it's larger than the limit
+	reservation1, err := limiter.reserve(ctx, 12)
+	c.Assert(err, IsNil)
+	c.Assert(limiter.InUse(), Equals, int64(12))
+
+	// the rows use the reservation first
+	buffer := newRowBuffer(limiter)
+	buffer.reservation = reservation1
+	c.Assert(buffer.add(map[string]*dbutil.ColumnData{"a": {Data: []byte("abcdefgh")}}), IsNil)
+	c.Assert(limiter.InUse(), Equals, int64(12))
+
+	reserved := make(chan *memoryReservation)
+	go func() {
+		reservation2, err := limiter.reserve(ctx, 5)
+		c.Assert(err, IsNil)
+		reserved <- reservation2
+	}()
+	select {
+	case <-reserved:
+		c.Fatal("reserved when the hard limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	buffer.close()
+	reservation1.release()
+	reservation2 := <-reserved
+	c.Assert(limiter.InUse(), Equals, int64(5))
+
+	// the waiting is canceled by the context
+	limiter.consume(10)
+	ctx1, cancel1 := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel1()
+	_, err = limiter.reserve(ctx1, 1)
+	c.Assert(err, NotNil)
+	reservation2.release()
+	limiter.release(10)
+	c.Assert(limiter.InUse(), Equals, int64(0))
+}
+
+func (s *testSpillSuite) TestRowBufferSpill(c *C) {
+	dir, err := ioutil.TempDir("", "spill")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	// every row has 3 bytes, so only 3 rows are kept in memory
+	limiter := NewMemoryLimiter(10, dir)
+	buffer := newRowBuffer(limiter)
+	for i := 0; i < 10; i++ {
+		row := map[string]*dbutil.ColumnData{
+			"id":   {Data: []byte(strconv.Itoa(100 + i))},
+			"name": {IsNull: true},
+		}
+		c.Assert(buffer.add(row), IsNil)
+	}
+	c.Assert(buffer.count, Equals, 10)
+	c.Assert(buffer.bytes, Equals, int64(30))
+	c.Assert(buffer.spilled, Greater, 0)
+	c.Assert(limiter.InUse(), LessEqual, int64(10))
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+
+	iter, err := buffer.iter()
+	c.Assert(err, IsNil)
+	for i := 0; i < 10; i++ {
+		row, err := iter.next()
+		c.Assert(err, IsNil)
+		c.Assert(string(row["id"].Data), Equals, strconv.Itoa(100+i))
+		c.Assert(row["name"].IsNull, IsTrue)
+	}
+	row, err := iter.next()
+	c.Assert(err, IsNil)
+	c.Assert(row, IsNil)
+
+	buffer.close()
+	c.Assert(limiter.InUse(), Equals, int64(0))
+	files, err = ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
+
+func (s *testSpillSuite) TestMergedRowIterator(c *C) {
+	createTableSQL := "create table test.test(`id` int, `name` varchar(24), primary key(`id`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL)
+	c.Assert(err, IsNil)
+	_, orderKeyCols := dbutil.SelectUniqueOrderKey(tableInfo)
+
+	// the first source's rows are spilled
+	limiter := NewMemoryLimiter(2, "")
+	tables := []*TableInstance{{InstanceID: "source-1"}, {InstanceID: "source-2"}}
+	buffers := []*rowBuffer{newRowBuffer(limiter), newRowBuffer(nil)}
+	for i, ids := range [][]int{{1, 4, 5}, {2, 3, 6}} {
+		for _, id := range ids {
+			c.Assert(buffers[i].add(map[string]*dbutil.ColumnData{"id": {Data: []byte(strconv.Itoa(id))}}), IsNil)
+		}
+		defer buffers[i].close()
+	}
+
+	iter, err := newMergedRowIterator(buffers, tables, orderKeyCols)
+	c.Assert(err, IsNil)
+	expectSources := []string{"source-1", "source-2", "source-2", "source-1", "source-1", "source-2"}
+	for i, expectSource := range expectSources {
+		row, table, err := iter.next()
+		c.Assert(err, IsNil)
+		c.Assert(string(row["id"].Data), Equals, strconv.Itoa(i+1))
+		c.Assert(table.InstanceID, Equals, expectSource)
+	}
+	row, table, err := iter.next()
+	c.Assert(err, IsNil)
+	c.Assert(row, IsNil)
+	c.Assert(table, IsNil)
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+const (
+	// TableResultPass means the table's struct and data are equal
+	TableResultPass = "pass"
+	// TableResultFail means the table's struct or data is not equal
+	TableResultFail = "fail"
+	// TableResultError means meet error when check the table
+	TableResultError = "error"
+)
+
+// TableResult is the final result of a table's check in a run.
+type TableResult struct {
+	RunID  string
+	Schema string
+	Table  string
+	// one of TableResultPass, TableResultFail and TableResultError
+	State       string
+	StructEqual bool
+	DataEqual   bool
+	// set true if the rows are counted, SourceRows and TargetRows are exported as NULL otherwise
+	RowCounted bool
+	SourceRows int64
+	TargetRows int64
+	// the error message if the state is TableResultError
+	Message   string
+	CheckTime time.Time
+}
+
+// SummaryExporter upserts the tables' final results into a reporting table, one row for every table which saves the
+// table's latest result, so the dashboards can chart the consistency status by SQL without parsing the files.
+type SummaryExporter struct {
+	db     *sql.DB
+	schema string
+	table  string
+}
+
+// NewSummaryExporter returns a SummaryExporter, the schema and table are created if not exist.
+func NewSummaryExporter(ctx context.Context, db *sql.DB, schema, table string) (*SummaryExporter, error) {
+	createSchemaSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`;", schema)
+	if _, err := db.ExecContext(ctx, createSchemaSQL); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	/* example
+	mysql> select * from sync_diff_report.table_result;
+	+----------------+--------+-------+-------+--------------+------------+-------------+-------------+---------+---------------------+
+	| run_id         | schema | table | state | struct_equal | data_equal | source_rows | target_rows | message | check_time          |
+	+----------------+--------+-------+-------+--------------+------------+-------------+-------------+---------+---------------------+
+	| 20190326124142 | diff   | test1 | fail  |            1 |          0 |        1000 |         999 |         | 2019-03-26 12:41:42 |
+	+----------------+--------+-------+-------+--------------+------------+-------------+-------------+---------+---------------------+
+	*/
+	createTableSQL :=
+		"CREATE TABLE IF NOT EXISTS " + dbutil.TableName(schema, table) + "(" +
+			"`run_id` varchar(64)," +
+			"`schema` varchar(64), `table` varchar(64)," +
+			"`state` varchar(16)," +
+			"`struct_equal` tinyint(1) not null default 0," +
+			"`data_equal` tinyint(1) not null default 0," +
+			"`source_rows` bigint," +
+			"`target_rows` bigint," +
+			"`message` text," +
+			"`check_time` datetime," +
+			"PRIMARY KEY(`schema`, `table`));"
+	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &SummaryExporter{
+		db:     db,
+		schema: schema,
+		table:  table,
+	}, nil
+}
+
+// Export upserts the table's result, the previous result of the table is replaced.
+func (e *SummaryExporter) Export(ctx context.Context, result *TableResult) error {
+	var sourceRows, targetRows interface{}
+	if result.RowCounted {
+		sourceRows, targetRows = result.SourceRows, result.TargetRows
+	}
+
+	upsertSQL := fmt.Sprintf("INSERT INTO %s(`run_id`, `schema`, `table`, `state`, `struct_equal`, `data_equal`, `source_rows`, `target_rows`, `message`, `check_time`) "+
+		"VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE `run_id` = VALUES(`run_id`), `state` = VALUES(`state`), `struct_equal` = VALUES(`struct_equal`), "+
+		"`data_equal` = VALUES(`data_equal`), `source_rows` = VALUES(`source_rows`), `target_rows` = VALUES(`target_rows`), `message` = VALUES(`message`), `check_time` = VALUES(`check_time`)",
+		dbutil.TableName(e.schema, e.table))
+	err := dbutil.ExecSQLWithRetry(ctx, e.db, upsertSQL, result.RunID, result.Schema, result.Table, result.State, result.StructEqual, result.DataEqual,
+		sourceRows, targetRows, result.Message, result.CheckTime)
+	return errors.Trace(err)
+}
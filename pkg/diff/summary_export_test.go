@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testSummaryExportSuite{})
+
+type testSummaryExportSuite struct{}
+
+func (s *testSummaryExportSuite) TestExport(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectExec("CREATE DATABASE IF NOT EXISTS `report`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `report`.`table_result`").WillReturnResult(sqlmock.NewResult(0, 0))
+	exporter, err := NewSummaryExporter(context.Background(), db, "report", "table_result")
+	c.Assert(err, IsNil)
+
+	checkTime := time.Unix(1575158400, 0)
+	mock.ExpectExec("INSERT INTO `report`.`table_result`.* ON DUPLICATE KEY UPDATE").
+		WithArgs("run1", "test", "t1", TableResultFail, true, false, int64(10), int64(9), "", checkTime).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = exporter.Export(context.Background(), &TableResult{
+		RunID:       "run1",
+		Schema:      "test",
+		Table:       "t1",
+		State:       TableResultFail,
+		StructEqual: true,
+		RowCounted:  true,
+		SourceRows:  10,
+		TargetRows:  9,
+		CheckTime:   checkTime,
+	})
+	c.Assert(err, IsNil)
+
+	// the rows are not counted
+	mock.ExpectExec("INSERT INTO `report`.`table_result`").
+		WithArgs("run1", "test", "t2", TableResultError, false, false, nil, nil, "connection refused", checkTime).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	err = exporter.Export(context.Background(), &TableResult{
+		RunID:     "run1",
+		Schema:    "test",
+		Table:     "t2",
+		State:     TableResultError,
+		Message:   "connection refused",
+		CheckTime: checkTime,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
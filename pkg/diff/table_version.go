@@ -0,0 +1,205 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+const tableVersionTableName = "table_version"
+
+// GetTableDataVersion returns the version of the table's data and struct, the version is changed when the table is
+// modified, so the tables unchanged since the last successful check can be skipped. returns empty if the version is
+// unknown, for example the UPDATE_TIME of InnoDB is not persisted after restart.
+// for TiDB, it's made up of the table id, the hash of the create table statement, and the version and the modify count
+// in mysql.stats_meta, which are updated by the statistics' delta in about one minute after the table is modified,
+// so the modification in the last minute may be missed. for MySQL, it's the CREATE_TIME and the UPDATE_TIME in
+// information_schema.TABLES.
+func GetTableDataVersion(ctx context.Context, db *sql.DB, schema, table string) (string, error) {
+	isTiDB, err := dbutil.IsTiDB(ctx, db)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	if !isTiDB {
+		var createTime, updateTime sql.NullString
+		query := "SELECT CREATE_TIME, UPDATE_TIME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+		err = db.QueryRowContext(ctx, query, schema, table).Scan(&createTime, &updateTime)
+		if err == sql.ErrNoRows {
+			return "", errors.NotFoundf("table %s", dbutil.TableName(schema, table))
+		}
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		if !createTime.Valid || !updateTime.Valid {
+			return "", nil
+		}
+		return fmt.Sprintf("mysql:%s:%s", createTime.String, updateTime.String), nil
+	}
+
+	createTableSQL, err := dbutil.GetCreateTableSQL(ctx, db, schema, table)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	var tableID int64
+	query := "SELECT TIDB_TABLE_ID FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+	if err = db.QueryRowContext(ctx, query, schema, table).Scan(&tableID); err != nil {
+		return "", errors.Trace(err)
+	}
+
+	/*
+		mysql> SELECT version, modify_count, count FROM mysql.stats_meta WHERE table_id = 45;
+		+--------------------+--------------+-------+
+		| version            | modify_count | count |
+		+--------------------+--------------+-------+
+		| 411595209227927553 |          100 |  1000 |
+		+--------------------+--------------+-------+
+	*/
+	var version, modifyCount, count int64
+	query = "SELECT version, modify_count, count FROM mysql.stats_meta WHERE table_id = ?"
+	err = db.QueryRowContext(ctx, query, tableID).Scan(&version, &modifyCount, &count)
+	if err == sql.ErrNoRows {
+		// the statistics' meta is not created yet
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return fmt.Sprintf("tidb:%d:%d:%d:%d:%d", tableID, crc32.ChecksumIEEE([]byte(createTableSQL)), version, modifyCount, count), nil
+}
+
+// DataVersions returns the data versions of the target table and the source tables keyed by the instance id, the
+// version is empty if it's unknown, for example the tables in files.
+func (t *TableDiff) DataVersions(ctx context.Context) (map[string]string, error) {
+	versions := make(map[string]string, len(t.SourceTables)+1)
+	for _, table := range append([]*TableInstance{t.TargetTable}, t.SourceTables...) {
+		key := fmt.Sprintf("%s:%s", table.InstanceID, dbutil.TableName(table.Schema, table.Table))
+		if _, ok := table.rowSource().(*sqlRowSource); !ok {
+			versions[key] = ""
+			continue
+		}
+
+		ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutMetadata)
+		version, err := GetTableDataVersion(ctx1, table.Conn, table.Schema, table.Table)
+		cancel1()
+		if err != nil {
+			return nil, errors.Annotatef(err, "get data version of %s in %s", dbutil.TableName(table.Schema, table.Table), table.InstanceID)
+		}
+		versions[key] = version
+	}
+
+	return versions, nil
+}
+
+// UnchangedVersions returns true if all the versions are known and equal to the cached versions.
+func UnchangedVersions(versions, cached map[string]string) bool {
+	if len(versions) == 0 || len(versions) != len(cached) {
+		return false
+	}
+	for key, version := range versions {
+		if len(version) == 0 || cached[key] != version {
+			return false
+		}
+	}
+	return true
+}
+
+// createTableVersionTable creates the table `table_version` saving the data versions of the tables' instances when
+// the tables passed the check.
+func createTableVersionTable(ctx context.Context, db *sql.DB) error {
+	createSchemaSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`;", checkpointSchemaName)
+	if _, err := db.ExecContext(ctx, createSchemaSQL); err != nil {
+		return errors.Trace(err)
+	}
+
+	/* example
+	mysql> select * from sync_diff_inspector.table_version;
+	+--------+-------+----------------------------+-------------------------------------------------+---------------------+
+	| schema | table | instance                   | version                                         | check_time          |
+	+--------+-------+----------------------------+-------------------------------------------------+---------------------+
+	| diff   | test1 | target:`diff`.`test1`      | tidb:45:1804289383:411595209227927553:100:1000  | 2019-03-26 12:41:42 |
+	+--------+-------+----------------------------+-------------------------------------------------+---------------------+
+	*/
+	createTableSQL :=
+		"CREATE TABLE IF NOT EXISTS `" + checkpointSchemaName + "`.`" + tableVersionTableName + "`(" +
+			"`schema` varchar(64), `table` varchar(64)," +
+			"`instance` varchar(256)," +
+			"`version` varchar(256) not null," +
+			"`check_time` datetime DEFAULT CURRENT_TIMESTAMP," +
+			"PRIMARY KEY(`schema`, `table`, `instance`));"
+	_, err := db.ExecContext(ctx, createTableSQL)
+	return errors.Trace(err)
+}
+
+// LoadTableVersions loads the data versions of the table's instances saved when the table passed the last check.
+func LoadTableVersions(ctx context.Context, db *sql.DB, schema, table string) (map[string]string, error) {
+	if err := createTableVersionTable(ctx, db); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	query := fmt.Sprintf("SELECT `instance`, `version` FROM `%s`.`%s` WHERE `schema` = ? AND `table` = ?", checkpointSchemaName, tableVersionTableName)
+	rows, err := db.QueryContext(ctx, query, schema, table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]string)
+	for rows.Next() {
+		var instance, version string
+		if err = rows.Scan(&instance, &version); err != nil {
+			return nil, errors.Trace(err)
+		}
+		versions[instance] = version
+	}
+
+	return versions, errors.Trace(rows.Err())
+}
+
+// SaveTableVersions replaces the saved data versions of the table's instances, the versions should be got before the
+// check, so the modification during the check is not missed. empty versions clear the saved versions.
+func SaveTableVersions(ctx context.Context, db *sql.DB, schema, table string, versions map[string]string) error {
+	if err := createTableVersionTable(ctx, db); err != nil {
+		return errors.Trace(err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	deleteSQL := fmt.Sprintf("DELETE FROM `%s`.`%s` WHERE `schema` = ? AND `table` = ?", checkpointSchemaName, tableVersionTableName)
+	if _, err = tx.ExecContext(ctx, deleteSQL, schema, table); err != nil {
+		tx.Rollback()
+		return errors.Trace(err)
+	}
+
+	insertSQL := fmt.Sprintf("INSERT INTO `%s`.`%s`(`schema`, `table`, `instance`, `version`) VALUES(?, ?, ?, ?)", checkpointSchemaName, tableVersionTableName)
+	for instance, version := range versions {
+		if _, err = tx.ExecContext(ctx, insertSQL, schema, table, instance, version); err != nil {
+			tx.Rollback()
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(tx.Commit())
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testTableVersionSuite{})
+
+type testTableVersionSuite struct{}
+
+func (s *testTableVersionSuite) TestGetTableDataVersion(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	ctx := context.Background()
+
+	// TiDB
+	mock.ExpectQuery("SELECT version()").WillReturnRows(sqlmock.NewRows([]string{"version()"}).AddRow("5.7.25-TiDB-v4.0.0"))
+	mock.ExpectQuery("SHOW CREATE TABLE").WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", "CREATE TABLE `t` (`a` int)"))
+	mock.ExpectQuery("SELECT TIDB_TABLE_ID").WithArgs("test", "t").WillReturnRows(sqlmock.NewRows([]string{"TIDB_TABLE_ID"}).AddRow(45))
+	mock.ExpectQuery("SELECT version, modify_count, count FROM mysql.stats_meta").WithArgs(45).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "modify_count", "count"}).AddRow(411595209227927553, 100, 1000))
+	version, err := GetTableDataVersion(ctx, db, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(version, Matches, "tidb:45:[0-9]+:411595209227927553:100:1000")
+
+	// MySQL, the update time is unknown after restart
+	mock.ExpectQuery("SELECT version()").WillReturnRows(sqlmock.NewRows([]string{"version()"}).AddRow("5.7.21"))
+	mock.ExpectQuery("SELECT CREATE_TIME, UPDATE_TIME").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"CREATE_TIME", "UPDATE_TIME"}).AddRow("2019-03-26 12:00:00", nil))
+	version, err = GetTableDataVersion(ctx, db, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, "")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testTableVersionSuite) TestUnchangedVersions(c *C) {
+	versions := map[string]string{"target:`test`.`t`": "tidb:1", "source-1:`test`.`t`": "mysql:1"}
+	c.Assert(UnchangedVersions(versions, map[string]string{"target:`test`.`t`": "tidb:1", "source-1:`test`.`t`": "mysql:1"}), IsTrue)
+	c.Assert(UnchangedVersions(versions, map[string]string{"target:`test`.`t`": "tidb:2", "source-1:`test`.`t`": "mysql:1"}), IsFalse)
+	c.Assert(UnchangedVersions(versions, map[string]string{"target:`test`.`t`": "tidb:1"}), IsFalse)
+	c.Assert(UnchangedVersions(map[string]string{}, map[string]string{}), IsFalse)
+	// the unknown versions are never unchanged
+	c.Assert(UnchangedVersions(map[string]string{"target:`test`.`t`": ""}, map[string]string{"target:`test`.`t`": ""}), IsFalse)
+}
+
+func (s *testTableVersionSuite) TestSaveTableVersions(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	ctx := context.Background()
+
+	expectCreateTable := func() {
+		mock.ExpectExec("CREATE DATABASE IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS `sync_diff_inspector`.`table_version`").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	expectCreateTable()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `sync_diff_inspector`.`table_version`").WithArgs("test", "t").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO `sync_diff_inspector`.`table_version`").WithArgs("test", "t", "target:`test`.`t`", "tidb:1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	c.Assert(SaveTableVersions(ctx, db, "test", "t", map[string]string{"target:`test`.`t`": "tidb:1"}), IsNil)
+
+	expectCreateTable()
+	mock.ExpectQuery("SELECT `instance`, `version`").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"instance", "version"}).AddRow("target:`test`.`t`", "tidb:1"))
+	versions, err := LoadTableVersions(ctx, db, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(versions, DeepEquals, map[string]string{"target:`test`.`t`": "tidb:1"})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+// TiDBAttributesCheck is the config of comparing the TiDB-specific attributes in the struct check, like the
+// AUTO_RANDOM columns, SHARD_ROW_ID_BITS and the sequences, every attribute can be ignored.
+type TiDBAttributesCheck struct {
+	// set true will not compare the AUTO_INCREMENT columns, and not check the target's AUTO_INCREMENT option is not
+	// less than the sources', which avoids the duplicate IDs allocated after switching to the target.
+	IgnoreAutoIncrement bool `toml:"ignore-auto-increment" json:"ignore-auto-increment"`
+	// set true will not compare the AUTO_RANDOM columns and their shard bits.
+	IgnoreAutoRandom bool `toml:"ignore-auto-random" json:"ignore-auto-random"`
+	// set true will not compare the SHARD_ROW_ID_BITS option.
+	IgnoreShardRowIDBits bool `toml:"ignore-shard-row-id-bits" json:"ignore-shard-row-id-bits"`
+	// set true will not compare the PRE_SPLIT_REGIONS option.
+	IgnorePreSplitRegions bool `toml:"ignore-pre-split-regions" json:"ignore-pre-split-regions"`
+	// set true will not compare the sequences in the schemas, see CompareSequences.
+	IgnoreSequences bool `toml:"ignore-sequences" json:"ignore-sequences"`
+}
+
+// getTiDBAttributes returns the TiDB-specific attributes of the table instance, returns nil if the instance is not
+// selected from the database or is a view.
+func (t *TableDiff) getTiDBAttributes(ctx context.Context, table *TableInstance) (*dbutil.TiDBTableAttributes, error) {
+	if _, ok := table.rowSource().(*sqlRowSource); !ok || table.isView {
+		return nil, nil
+	}
+
+	createTableSQL, err := t.getCreateTableSQL(ctx, table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return dbutil.ParseTiDBTableAttributes(createTableSQL), nil
+}
+
+// getCreateTableSQL returns the table's create table statement, which is cached if the table has MetadataCache.
+func (t *TableDiff) getCreateTableSQL(ctx context.Context, table *TableInstance) (string, error) {
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutMetadata)
+	defer cancel1()
+
+	var (
+		createTableSQL string
+		err            error
+	)
+	if table.MetadataCache != nil {
+		createTableSQL, err = table.MetadataCache.GetCreateTableSQL(ctx1, table.Conn, table.Schema, table.Table)
+	} else {
+		createTableSQL, err = dbutil.GetCreateTableSQL(ctx1, table.Conn, table.Schema, table.Table)
+	}
+	if err != nil {
+		return "", errors.Annotatef(err, "table %s.%s.%s", table.InstanceID, table.Schema, table.Table)
+	}
+
+	return createTableSQL, nil
+}
+
+// diffTiDBAttributes returns the differences of the TiDB-specific attributes between the source and target table.
+func diffTiDBAttributes(check *TiDBAttributesCheck, source, target *dbutil.TiDBTableAttributes) []string {
+	var differences []string
+	if !check.IgnoreAutoIncrement {
+		if source.AutoIncrementColumn != target.AutoIncrementColumn {
+			differences = append(differences, fmt.Sprintf("AUTO_INCREMENT column: source %q, target %q", source.AutoIncrementColumn, target.AutoIncrementColumn))
+		}
+		// the ID allocated by target may be duplicate with the source's allocated if target's is less
+		if len(target.AutoIncrementColumn) != 0 && target.AutoIncrement < source.AutoIncrement {
+			differences = append(differences, fmt.Sprintf("AUTO_INCREMENT: source %d, target %d less than source", source.AutoIncrement, target.AutoIncrement))
+		}
+	}
+	if !check.IgnoreAutoRandom && !equalAutoRandomBits(source.AutoRandomBits, target.AutoRandomBits) {
+		differences = append(differences, fmt.Sprintf("AUTO_RANDOM: source %v, target %v", source.AutoRandomBits, target.AutoRandomBits))
+	}
+	if !check.IgnoreShardRowIDBits && source.ShardRowIDBits != target.ShardRowIDBits {
+		differences = append(differences, fmt.Sprintf("SHARD_ROW_ID_BITS: source %d, target %d", source.ShardRowIDBits, target.ShardRowIDBits))
+	}
+	if !check.IgnorePreSplitRegions && source.PreSplitRegions != target.PreSplitRegions {
+		differences = append(differences, fmt.Sprintf("PRE_SPLIT_REGIONS: source %d, target %d", source.PreSplitRegions, target.PreSplitRegions))
+	}
+
+	return differences
+}
+
+// checkTiDBAttributes returns true if the TiDB-specific attributes of all the source tables and target table are equal.
+func (t *TableDiff) checkTiDBAttributes(ctx context.Context) (bool, error) {
+	targetAttrs, err := t.getTiDBAttributes(ctx, t.TargetTable)
+	if err != nil || targetAttrs == nil {
+		return true, errors.Trace(err)
+	}
+
+	equal := true
+	for _, sourceTable := range t.SourceTables {
+		sourceAttrs, err := t.getTiDBAttributes(ctx, sourceTable)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if sourceAttrs == nil {
+			continue
+		}
+
+		for _, difference := range diffTiDBAttributes(t.TiDBAttributes, sourceAttrs, targetAttrs) {
+			log.Warn("TiDB attributes are different", zap.String("source", dbutil.TableName(sourceTable.Schema, sourceTable.Table)),
+				zap.String("target", dbutil.TableName(t.TargetTable.Schema, t.TargetTable.Table)), zap.String("difference", difference))
+			equal = false
+		}
+	}
+
+	return equal, nil
+}
+
+func equalAutoRandomBits(bits1, bits2 map[string]int) bool {
+	if len(bits1) != len(bits2) {
+		return false
+	}
+	for column, bits := range bits1 {
+		if bits2Value, ok := bits2[column]; !ok || bits2Value != bits {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	// SequenceMissing means the sequence exists in source but not in target.
+	SequenceMissing = "missing"
+	// SequenceExtra means the sequence exists in target but not in source.
+	SequenceExtra = "extra"
+	// SequenceDefinitionDiff means the sequence's definitions are different.
+	SequenceDefinitionDiff = "definition"
+)
+
+// SequenceDrift is a difference of a sequence between source and target.
+type SequenceDrift struct {
+	Sequence string
+	// one of SequenceMissing, SequenceExtra and SequenceDefinitionDiff
+	Kind   string
+	Detail string
+}
+
+// String returns the string of the drift, used for report.
+func (d *SequenceDrift) String() string {
+	if len(d.Detail) == 0 {
+		return fmt.Sprintf("sequence %s: %s", d.Sequence, d.Kind)
+	}
+	return fmt.Sprintf("sequence %s: %s, %s", d.Sequence, d.Kind, d.Detail)
+}
+
+// CompareSequences compares the definitions of the sequences in the source's schema and the target's schema, the
+// sequences' current values are not compared because they are allocated in batches. the drifts are sorted by the name.
+func CompareSequences(ctx context.Context, source, target *sql.DB, sourceSchema, targetSchema string) ([]*SequenceDrift, error) {
+	sourceSequences, err := dbutil.GetSequences(ctx, source, sourceSchema)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get sequences of source schema %s", sourceSchema)
+	}
+	targetSequences, err := dbutil.GetSequences(ctx, target, targetSchema)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get sequences of target schema %s", targetSchema)
+	}
+
+	var drifts []*SequenceDrift
+	for name, sourceSequence := range sourceSequences {
+		targetSequence, ok := targetSequences[name]
+		if !ok {
+			drifts = append(drifts, &SequenceDrift{Sequence: dbutil.TableName(targetSchema, name), Kind: SequenceMissing})
+			continue
+		}
+		if *sourceSequence != *targetSequence {
+			drifts = append(drifts, &SequenceDrift{
+				Sequence: dbutil.TableName(targetSchema, name),
+				Kind:     SequenceDefinitionDiff,
+				Detail:   fmt.Sprintf("source (%s), target (%s)", sourceSequence, targetSequence),
+			})
+		}
+	}
+	for name := range targetSequences {
+		if _, ok := sourceSequences[name]; !ok {
+			drifts = append(drifts, &SequenceDrift{Sequence: dbutil.TableName(targetSchema, name), Kind: SequenceExtra})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].Sequence < drifts[j].Sequence
+	})
+	return drifts, nil
+}
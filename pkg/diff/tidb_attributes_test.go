@@ -0,0 +1,73 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testTiDBAttributesSuite{})
+
+type testTiDBAttributesSuite struct{}
+
+func (s *testTiDBAttributesSuite) TestDiffTiDBAttributes(c *C) {
+	source := &dbutil.TiDBTableAttributes{AutoIncrement: 100, AutoIncrementColumn: "id", AutoRandomBits: map[string]int{}, ShardRowIDBits: 4, PreSplitRegions: 2}
+	target := &dbutil.TiDBTableAttributes{AutoIncrement: 50, AutoRandomBits: map[string]int{"id": 5}, ShardRowIDBits: 4, PreSplitRegions: 3}
+
+	check := &TiDBAttributesCheck{}
+	c.Assert(diffTiDBAttributes(check, source, target), DeepEquals, []string{
+		`AUTO_INCREMENT column: source "id", target ""`,
+		"AUTO_RANDOM: source map[], target map[id:5]",
+		"PRE_SPLIT_REGIONS: source 2, target 3",
+	})
+
+	// the target's AUTO_INCREMENT should not be less than the source's
+	target2 := &dbutil.TiDBTableAttributes{AutoIncrement: 50, AutoIncrementColumn: "id", AutoRandomBits: map[string]int{}, ShardRowIDBits: 4}
+	c.Assert(diffTiDBAttributes(&TiDBAttributesCheck{IgnoreAutoRandom: true, IgnorePreSplitRegions: true}, source, target2), DeepEquals, []string{
+		"AUTO_INCREMENT: source 100, target 50 less than source",
+	})
+	target2.AutoIncrement = 200
+	c.Assert(diffTiDBAttributes(&TiDBAttributesCheck{IgnoreAutoRandom: true, IgnorePreSplitRegions: true}, source, target2), HasLen, 0)
+
+	check = &TiDBAttributesCheck{IgnoreAutoIncrement: true, IgnoreAutoRandom: true, IgnorePreSplitRegions: true}
+	c.Assert(diffTiDBAttributes(check, source, target), HasLen, 0)
+}
+
+func (s *testTiDBAttributesSuite) TestCompareSequences(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	columns := []string{"SEQUENCE_NAME", "START", "INCREMENT", "MIN_VALUE", "MAX_VALUE", "CACHE", "CACHE_VALUE", "CYCLE"}
+	sourceMock.ExpectQuery("SELECT SEQUENCE_NAME, .* FROM information_schema.SEQUENCES").WithArgs("source").WillReturnRows(
+		sqlmock.NewRows(columns).AddRow("seq1", 1, 1, 1, 100, 1, 10, 0).AddRow("seq2", 1, 1, 1, 100, 1, 10, 0).AddRow("seq3", 1, 1, 1, 100, 1, 10, 0))
+	targetMock.ExpectQuery("SELECT SEQUENCE_NAME, .* FROM information_schema.SEQUENCES").WithArgs("target").WillReturnRows(
+		sqlmock.NewRows(columns).AddRow("seq1", 1, 1, 1, 100, 1, 10, 0).AddRow("seq2", 1, 2, 1, 100, 1, 10, 0).AddRow("seq4", 1, 1, 1, 100, 1, 10, 0))
+
+	drifts, err := CompareSequences(context.Background(), sourceDB, targetDB, "source", "target")
+	c.Assert(err, IsNil)
+	c.Assert(drifts, HasLen, 3)
+	c.Assert(drifts[0].String(), Equals, "sequence `target`.`seq2`: definition, source (start 1, increment 1, min value 1, max value 100, cache true, cache size 10, cycle false), target (start 1, increment 2, min value 1, max value 100, cache true, cache size 10, cycle false)")
+	c.Assert(drifts[1].String(), Equals, "sequence `target`.`seq3`: missing")
+	c.Assert(drifts[2].String(), Equals, "sequence `target`.`seq4`: extra")
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// Tuning saves the knobs which can be changed while the diff is running, for example to throttle the diff when the
+// production load spikes without restarting it. it can be shared by all the TableDiffs in one run.
+type Tuning struct {
+	sync.Mutex
+
+	// the max number of queries sent to the databases per second to check the chunks, 0 means no limit
+	qpsLimit int
+	// the sampling check percent, 0 means using TableDiff's Sample
+	sample int
+	// the time when the next query can be sent
+	next time.Time
+	// closed to wake up the waiters when the knobs are changed
+	notifyCh chan struct{}
+}
+
+// NewTuning returns a new Tuning.
+func NewTuning(qpsLimit int, sample int) (*Tuning, error) {
+	t := &Tuning{notifyCh: make(chan struct{})}
+	if err := t.SetQPSLimit(qpsLimit); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := t.SetSample(sample); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return t, nil
+}
+
+// SetQPSLimit changes the max number of queries per second, 0 means no limit.
+func (t *Tuning) SetQPSLimit(qps int) error {
+	if qps < 0 {
+		return errors.NotValidf("qps limit %d", qps)
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.qpsLimit = qps
+	// the waiters are reset by the new limit
+	t.next = time.Now()
+	t.notify()
+	return nil
+}
+
+// QPSLimit returns the max number of queries per second, 0 means no limit.
+func (t *Tuning) QPSLimit() int {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.qpsLimit
+}
+
+// SetSample changes the sampling check percent of the chunks not checked yet, 0 means using TableDiff's Sample.
+func (t *Tuning) SetSample(sample int) error {
+	if sample < 0 || sample > 100 {
+		return errors.NotValidf("sample %d", sample)
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.sample = sample
+	return nil
+}
+
+// Sample returns the sampling check percent, 0 means using TableDiff's Sample.
+func (t *Tuning) Sample() int {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.sample
+}
+
+// Wait blocks until n queries can be sent under the qps limit, or the context is done.
+func (t *Tuning) Wait(ctx context.Context, n int) error {
+	for {
+		t.Lock()
+		if t.qpsLimit <= 0 {
+			t.Unlock()
+			return nil
+		}
+
+		now := time.Now()
+		if !t.next.After(now) {
+			t.next = now.Add(time.Duration(float64(n) / float64(t.qpsLimit) * float64(time.Second)))
+			t.Unlock()
+			return nil
+		}
+		wait := t.next.Sub(now)
+		notifyCh := t.notifyCh
+		t.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-notifyCh:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Trace(ctx.Err())
+		}
+	}
+}
+
+func (t *Tuning) notify() {
+	close(t.notifyCh)
+	t.notifyCh = make(chan struct{})
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testTuningSuite{})
+
+type testTuningSuite struct{}
+
+func (s *testTuningSuite) TestTuningKnobs(c *C) {
+	_, err := NewTuning(-1, 0)
+	c.Assert(err, NotNil)
+	_, err = NewTuning(0, 101)
+	c.Assert(err, NotNil)
+
+	tuning, err := NewTuning(10, 0)
+	c.Assert(err, IsNil)
+	c.Assert(tuning.QPSLimit(), Equals, 10)
+
+	t := &TableDiff{Sample: 50}
+	c.Assert(t.samplePercent(), Equals, 50)
+	t.Tuning = tuning
+	c.Assert(t.samplePercent(), Equals, 50)
+	c.Assert(tuning.SetSample(10), IsNil)
+	c.Assert(t.samplePercent(), Equals, 10)
+	c.Assert(tuning.SetSample(-1), NotNil)
+	c.Assert(tuning.Sample(), Equals, 10)
+}
+
+func (s *testTuningSuite) TestTuningWait(c *C) {
+	tuning, err := NewTuning(0, 0)
+	c.Assert(err, IsNil)
+	// no limit
+	for i := 0; i < 100; i++ {
+		c.Assert(tuning.Wait(context.Background(), 1), IsNil)
+	}
+
+	c.Assert(tuning.SetQPSLimit(1), IsNil)
+	c.Assert(tuning.Wait(context.Background(), 1), IsNil)
+
+	// the next query is blocked for one second
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	err = tuning.Wait(ctx, 1)
+	cancel()
+	c.Assert(err, NotNil)
+
+	// the waiter is woken up by the new limit
+	done := make(chan error, 1)
+	go func() {
+		done <- tuning.Wait(context.Background(), 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(tuning.SetQPSLimit(0), IsNil)
+	select {
+	case err = <-done:
+		c.Assert(err, IsNil)
+	case <-time.After(time.Second / 2):
+		c.Fatal("the waiter is not woken up")
+	}
+}
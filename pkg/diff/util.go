@@ -14,10 +14,23 @@
 package diff
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/parser/charset"
 	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/utils"
 	"github.com/pingcap/tidb/types"
+	"go.uber.org/zap"
 )
 
 func equalStrings(str1, str2 []string) bool {
@@ -64,6 +77,80 @@ func removeColumns(tableInfo *model.TableInfo, columns []string) *model.TableInf
 	return tableInfo
 }
 
+// setBusinessKey returns the table info which uses the business key as the unique key to order and match the rows,
+// the primary key's columns not in the business key are removed because they are expected to be different.
+func setBusinessKey(tableInfo *model.TableInfo, businessKey []string) (*model.TableInfo, error) {
+	if len(businessKey) == 0 {
+		return tableInfo, nil
+	}
+
+	keyMap := utils.SliceToMap(businessKey)
+	pkColumnMap := make(map[string]struct{})
+	for _, col := range tableInfo.Columns {
+		if mysql.HasPriKeyFlag(col.Flag) {
+			pkColumnMap[col.Name.O] = struct{}{}
+		}
+	}
+	for _, index := range tableInfo.Indices {
+		if index.Primary {
+			for _, col := range index.Columns {
+				pkColumnMap[col.Name.O] = struct{}{}
+			}
+		}
+	}
+
+	pkColumns := make([]string, 0, len(pkColumnMap))
+	for _, col := range tableInfo.Columns {
+		if _, ok := pkColumnMap[col.Name.O]; !ok {
+			continue
+		}
+		if _, ok := keyMap[col.Name.O]; !ok {
+			pkColumns = append(pkColumns, col.Name.O)
+		}
+	}
+	if len(pkColumns) != 0 {
+		tableInfo = removeColumns(tableInfo, pkColumns)
+		tableInfo.PKIsHandle = false
+	}
+
+	offsets := make(map[string]int, len(tableInfo.Columns))
+	for i, col := range tableInfo.Columns {
+		offsets[col.Name.O] = i
+	}
+
+	keyIndex := &model.IndexInfo{
+		Name:    model.NewCIStr("business_key"),
+		Primary: true,
+		Unique:  true,
+	}
+	for _, name := range businessKey {
+		offset, ok := offsets[name]
+		if !ok {
+			return nil, errors.NotFoundf("business key column %s", name)
+		}
+		keyIndex.Columns = append(keyIndex.Columns, &model.IndexColumn{
+			Name:   model.NewCIStr(name),
+			Offset: offset,
+			Length: types.UnspecifiedLength,
+		})
+	}
+
+	// the business key replaces the primary key, and the columns' offsets are changed after removing the columns
+	indices := []*model.IndexInfo{keyIndex}
+	for _, index := range tableInfo.Indices {
+		if index.Primary {
+			continue
+		}
+		for _, col := range index.Columns {
+			col.Offset = offsets[col.Name.O]
+		}
+		indices = append(indices, index)
+	}
+	tableInfo.Indices = indices
+
+	return tableInfo, nil
+}
+
 func getColumnsFromIndex(index *model.IndexInfo, tableInfo *model.TableInfo) []*model.ColumnInfo {
 	indexColumns := make([]*model.ColumnInfo, 0, len(index.Columns))
 	for _, indexColumn := range index.Columns {
@@ -81,6 +168,68 @@ func needQuotes(ft types.FieldType) bool {
 	return !(dbutil.IsNumberType(ft.Tp) || dbutil.IsFloatType(ft.Tp))
 }
 
+// isApproximateColumn returns true if the column is FLOAT or DOUBLE, its values can't be used as the chunk's bounds
+// exactly, the bounds may round to the neighbor values and make the chunks overlapped or gapped.
+func isApproximateColumn(col *model.ColumnInfo) bool {
+	return col.Tp == mysql.TypeFloat || col.Tp == mysql.TypeDouble
+}
+
+// hasApproximateColumn returns true if any column is FLOAT or DOUBLE.
+func hasApproximateColumn(cols []*model.ColumnInfo) bool {
+	for _, col := range cols {
+		if isApproximateColumn(col) {
+			return true
+		}
+	}
+	return false
+}
+
+// boundCast returns the type the column's bound values are cast to in the chunk's conditions. the string bound is
+// compared with DECIMAL as double in MySQL, so cast it to the column's DECIMAL type to compare exactly.
+func boundCast(col *model.ColumnInfo) string {
+	if col.Tp != mysql.TypeNewDecimal {
+		return ""
+	}
+
+	flen, decimal := col.Flen, col.Decimal
+	if flen <= 0 {
+		flen = mysql.MaxDecimalWidth
+	}
+	if decimal < 0 {
+		decimal = 0
+	}
+	return fmt.Sprintf("DECIMAL(%d,%d)", flen, decimal)
+}
+
+// compareNumber compares the numeric column's two values, returns -1, 0 or 1. the DECIMAL values are compared exactly,
+// and the others are compared as float.
+func compareNumber(col *model.ColumnInfo, data1, data2 []byte) (int, error) {
+	if col.Tp == mysql.TypeNewDecimal {
+		var dec1, dec2 types.MyDecimal
+		err1 := dec1.FromString(data1)
+		err2 := dec2.FromString(data2)
+		if err1 != nil || err2 != nil {
+			return 0, errors.Errorf("convert %s, %s to decimal failed, err1: %v, err2: %v", string(data1), string(data2), err1, err2)
+		}
+		return dec1.Compare(&dec2), nil
+	}
+
+	num1, err1 := strconv.ParseFloat(string(data1), 64)
+	num2, err2 := strconv.ParseFloat(string(data2), 64)
+	if err1 != nil || err2 != nil {
+		return 0, errors.Errorf("convert %s, %s to float failed, err1: %v, err2: %v", string(data1), string(data2), err1, err2)
+	}
+
+	switch {
+	case num1 < num2:
+		return -1, nil
+	case num1 > num2:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
 func rowContainsCols(row map[string]*dbutil.ColumnData, cols []*model.ColumnInfo) bool {
 	for _, col := range cols {
 		if _, ok := row[col.Name.O]; !ok {
@@ -90,3 +239,218 @@ func rowContainsCols(row map[string]*dbutil.ColumnData, cols []*model.ColumnInfo
 
 	return true
 }
+
+// rowBytes returns the size of the row's data.
+func rowBytes(row map[string]*dbutil.ColumnData) int64 {
+	var size int64
+	for _, data := range row {
+		size += int64(len(data.Data))
+	}
+
+	return size
+}
+
+// equalJSON compares two json documents semantically, the key order and white space are ignored.
+func equalJSON(data1, data2 []byte) bool {
+	v1, err := decodeJSON(data1)
+	if err != nil {
+		log.Warn("decode json failed", zap.ByteString("data", data1), zap.Error(err))
+		return false
+	}
+	v2, err := decodeJSON(data2)
+	if err != nil {
+		log.Warn("decode json failed", zap.ByteString("data", data2), zap.Error(err))
+		return false
+	}
+
+	return reflect.DeepEqual(v1, v2)
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	// use json.Number to avoid losing precision of big integer
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&v)
+	return v, errors.Trace(err)
+}
+
+// equalColumnData returns true if the column's two data are equal, col can be nil if the column's info is unknown.
+func equalColumnData(col *model.ColumnInfo, comparator string, data1, data2 *dbutil.ColumnData) bool {
+	if data1.IsNull != data2.IsNull {
+		return false
+	}
+	if data1.IsNull || string(data1.Data) == string(data2.Data) {
+		return true
+	}
+	if len(comparator) != 0 {
+		return equalByComparator(comparator, data1.Data, data2.Data)
+	}
+	if col == nil {
+		return false
+	}
+
+	switch col.Tp {
+	case mysql.TypeJSON:
+		// json's data may have different key order or white space in mysql and tidb, need compare them semantically.
+		return equalJSON(data1.Data, data2.Data)
+	case mysql.TypeSet:
+		// set's labels may have different order if the set's definition is different.
+		return equalSet(data1.Data, data2.Data)
+	}
+
+	return false
+}
+
+// equalSet compares two SET values by labels, the labels' order is decided by the SET's definition,
+// so the same value may have different order in different instances.
+func equalSet(data1, data2 []byte) bool {
+	labels1 := strings.Split(string(data1), ",")
+	labels2 := strings.Split(string(data2), ",")
+	sort.Strings(labels1)
+	sort.Strings(labels2)
+
+	return equalStrings(labels1, labels2)
+}
+
+// isEnumOrSet returns true if the column's type is ENUM or SET.
+func isEnumOrSet(col *model.ColumnInfo) bool {
+	return col.Tp == mysql.TypeEnum || col.Tp == mysql.TypeSet
+}
+
+// diffEnumElems returns the first ENUM/SET column which has different elements or different elements' order in two
+// tables, orderOnly is true if the column has the same elements but in different order.
+func diffEnumElems(tableInfo1, tableInfo2 *model.TableInfo) (col *model.ColumnInfo, orderOnly bool) {
+	for _, col1 := range tableInfo1.Columns {
+		if !isEnumOrSet(col1) {
+			continue
+		}
+
+		col2 := dbutil.FindColumnByName(tableInfo2.Columns, col1.Name.O)
+		if col2 == nil {
+			return col1, false
+		}
+		if equalStrings(col1.Elems, col2.Elems) {
+			continue
+		}
+
+		elems1 := append([]string{}, col1.Elems...)
+		elems2 := append([]string{}, col2.Elems...)
+		sort.Strings(elems1)
+		sort.Strings(elems2)
+		return col1, equalStrings(elems1, elems2)
+	}
+
+	return nil, false
+}
+
+// differentEnumColumns returns the ENUM columns of the table whose elements are different from the other tables, or
+// missing in them.
+func differentEnumColumns(tableInfo *model.TableInfo, others []*model.TableInfo) map[string]struct{} {
+	columns := make(map[string]struct{})
+	for _, col := range tableInfo.Columns {
+		if col.Tp != mysql.TypeEnum {
+			continue
+		}
+
+		for _, other := range others {
+			otherCol := dbutil.FindColumnByName(other.Columns, col.Name.O)
+			if otherCol == nil || !equalStrings(col.Elems, otherCol.Elems) {
+				columns[col.Name.O] = struct{}{}
+				break
+			}
+		}
+	}
+
+	return columns
+}
+
+// enumIndex returns the index of the ENUM column's label, starts from 1. the empty string inserted for an invalid
+// value is 0.
+func enumIndex(col *model.ColumnInfo, label string) int {
+	for i, elem := range col.Elems {
+		if elem == label {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// enumIndexValues converts the ENUM column's labels and their counts to the indexes ordered by the index, the labels
+// may be ordered by the collation.
+func enumIndexValues(col *model.ColumnInfo, labels []string, counts []int) ([]string, []int) {
+	indexCounts := make(map[int]int, len(labels))
+	indexes := make([]int, 0, len(labels))
+	for i, label := range labels {
+		index := enumIndex(col, label)
+		if _, ok := indexCounts[index]; !ok {
+			indexes = append(indexes, index)
+		}
+		indexCounts[index] += counts[i]
+	}
+	sort.Ints(indexes)
+
+	values := make([]string, 0, len(indexes))
+	valueCounts := make([]int, 0, len(indexes))
+	for _, index := range indexes {
+		values = append(values, strconv.Itoa(index))
+		valueCounts = append(valueCounts, indexCounts[index])
+	}
+	return values, valueCounts
+}
+
+// formatValue formats the column's data as a literal used in sql,
+// binary data is formatted as hex literal, and string data is quoted and escaped.
+func formatValue(col *model.ColumnInfo, data []byte) string {
+	if isBinaryColumn(col) {
+		return fmt.Sprintf("X'%X'", data)
+	}
+
+	if needQuotes(col.FieldType) {
+		return fmt.Sprintf("'%s'", escapeString(string(data)))
+	}
+
+	return string(data)
+}
+
+// isBinaryColumn returns true if the column saves binary data, like BINARY, VARBINARY, BLOB and BIT.
+func isBinaryColumn(col *model.ColumnInfo) bool {
+	switch col.Tp {
+	case mysql.TypeBit:
+		return true
+	case mysql.TypeString, mysql.TypeVarchar, mysql.TypeVarString,
+		mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob:
+		return col.Charset == charset.CharsetBin
+	}
+
+	return false
+}
+
+// escapeString escapes the special characters in string, reference https://dev.mysql.com/doc/refman/5.7/en/string-literals.html
+func escapeString(str string) string {
+	var buf strings.Builder
+	buf.Grow(len(str))
+
+	for i := 0; i < len(str); i++ {
+		switch str[i] {
+		case 0:
+			buf.WriteString(`\0`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\032':
+			buf.WriteString(`\Z`)
+		default:
+			buf.WriteByte(str[i])
+		}
+	}
+
+	return buf.String()
+}
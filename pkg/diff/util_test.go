@@ -46,6 +46,44 @@ func (s *testUtilSuite) TestRemoveColumns(c *C) {
 	c.Assert(len(tbInfo.Indices), Equals, 1)
 }
 
+func (s *testUtilSuite) TestSetBusinessKey(c *C) {
+	createTableSQL := "CREATE TABLE `test`.`atest` (`id` int, `code` varchar(20), `region` int, `d` int, primary key(`id`), index idx(`d`))"
+	tableInfo, err := dbutil.GetTableInfoBySQL(createTableSQL)
+	c.Assert(err, IsNil)
+
+	// no business key
+	tbInfo, err := setBusinessKey(tableInfo, nil)
+	c.Assert(err, IsNil)
+	c.Assert(tbInfo, Equals, tableInfo)
+
+	// the primary key is removed, and the business key is used as the order key
+	tbInfo, err = setBusinessKey(tableInfo, []string{"region", "code"})
+	c.Assert(err, IsNil)
+	c.Assert(tbInfo.Columns, HasLen, 3)
+	c.Assert(tbInfo.PKIsHandle, IsFalse)
+	keys, keyCols := dbutil.SelectUniqueOrderKey(tbInfo)
+	c.Assert(keys, DeepEquals, []string{"region", "code"})
+	c.Assert(keyCols[0].Name.O, Equals, "region")
+	c.Assert(keyCols[1].Name.O, Equals, "code")
+	c.Assert(tbInfo.Indices, HasLen, 2)
+	c.Assert(tbInfo.Indices[1].Name.O, Equals, "idx")
+	c.Assert(tbInfo.Columns[tbInfo.Indices[1].Columns[0].Offset].Name.O, Equals, "d")
+
+	// the primary key's columns in the business key are kept
+	tableInfo, err = dbutil.GetTableInfoBySQL(createTableSQL)
+	c.Assert(err, IsNil)
+	tbInfo, err = setBusinessKey(tableInfo, []string{"id", "code"})
+	c.Assert(err, IsNil)
+	c.Assert(tbInfo.Columns, HasLen, 4)
+	keys, _ = dbutil.SelectUniqueOrderKey(tbInfo)
+	c.Assert(keys, DeepEquals, []string{"id", "code"})
+
+	tableInfo, err = dbutil.GetTableInfoBySQL(createTableSQL)
+	c.Assert(err, IsNil)
+	_, err = setBusinessKey(tableInfo, []string{"not_exist"})
+	c.Assert(err, NotNil)
+}
+
 func (s *testUtilSuite) TestRowContainsCols(c *C) {
 	row := map[string]*dbutil.ColumnData{
 		"a": nil,
@@ -70,3 +108,106 @@ func (s *testUtilSuite) TestRowContainsCols(c *C) {
 	contain = rowContainsCols(row, cols)
 	c.Assert(contain, Equals, false)
 }
+
+func (s *testUtilSuite) TestEqualJSON(c *C) {
+	testCases := []struct {
+		data1 string
+		data2 string
+		equal bool
+	}{
+		{`{"a": 1, "b": "x"}`, `{"b":"x","a":1}`, true},
+		{`[1, 2, {"c": null}]`, `[1,2,{"c":null}]`, true},
+		{`{"a": 12345678901234567890}`, `{"a": 12345678901234567891}`, false},
+		{`{"a": 1}`, `{"a": "1"}`, false},
+		{`[1, 2]`, `[2, 1]`, false},
+		{`{"a": 1`, `{"a": 1}`, false},
+	}
+
+	for _, testCase := range testCases {
+		c.Assert(equalJSON([]byte(testCase.data1), []byte(testCase.data2)), Equals, testCase.equal)
+	}
+}
+
+func (s *testUtilSuite) TestEnumAndSet(c *C) {
+	c.Assert(equalSet([]byte("a,b,c"), []byte("c,a,b")), IsTrue)
+	c.Assert(equalSet([]byte(""), []byte("")), IsTrue)
+	c.Assert(equalSet([]byte("a,b"), []byte("a,c")), IsFalse)
+	c.Assert(equalSet([]byte("a,b"), []byte("a")), IsFalse)
+
+	tableInfo1, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`test`(`id` int, `e` enum('a', 'b'), `s` set('x', 'y'))")
+	c.Assert(err, IsNil)
+	tableInfo2, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`test`(`id` int, `e` enum('a', 'b'), `s` set('y', 'x'))")
+	c.Assert(err, IsNil)
+	tableInfo3, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`test`(`id` int, `e` enum('b', 'a'), `s` set('x', 'y'))")
+	c.Assert(err, IsNil)
+	tableInfo4, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`test`(`id` int, `e` enum('a', 'c'), `s` set('x', 'y'))")
+	c.Assert(err, IsNil)
+
+	testCases := []struct {
+		tableInfo *model.TableInfo
+		column    string
+		orderOnly bool
+	}{
+		{tableInfo1, "", false},
+		{tableInfo2, "s", true},
+		{tableInfo3, "e", true},
+		// the different elements are not only the order difference
+		{tableInfo4, "e", false},
+	}
+	for _, testCase := range testCases {
+		col, orderOnly := diffEnumElems(tableInfo1, testCase.tableInfo)
+		if len(testCase.column) == 0 {
+			c.Assert(col, IsNil)
+			continue
+		}
+		c.Assert(col.Name.O, Equals, testCase.column)
+		c.Assert(orderOnly, Equals, testCase.orderOnly)
+	}
+
+	// the ENUM columns with different indexes are not split by, the SET columns are not split by the indexes
+	c.Assert(differentEnumColumns(tableInfo1, []*model.TableInfo{tableInfo1, tableInfo2}), HasLen, 0)
+	c.Assert(differentEnumColumns(tableInfo1, []*model.TableInfo{tableInfo2, tableInfo3}), DeepEquals, map[string]struct{}{"e": {}})
+	c.Assert(differentEnumColumns(tableInfo1, []*model.TableInfo{tableInfo4}), DeepEquals, map[string]struct{}{"e": {}})
+
+	// the labels ordered by the collation are converted to the indexes ordered by the index
+	e := tableInfo3.Columns[1]
+	c.Assert(enumIndex(e, "a"), Equals, 2)
+	c.Assert(enumIndex(e, ""), Equals, 0)
+	values, counts := enumIndexValues(e, []string{"", "a", "b"}, []int{1, 2, 3})
+	c.Assert(values, DeepEquals, []string{"0", "1", "2"})
+	c.Assert(counts, DeepEquals, []int{1, 3, 2})
+}
+
+func (s *testUtilSuite) TestEscapeString(c *C) {
+	c.Assert(escapeString("abc"), Equals, "abc")
+	c.Assert(escapeString(`it's "x"`), Equals, `it\'s \"x\"`)
+	c.Assert(escapeString("a\\b\nc\rd\x00e\x1a"), Equals, `a\\b\nc\rd\0e\Z`)
+}
+
+func (s *testUtilSuite) TestCompareNumber(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `test`.`atest` (`a` decimal(40,20), `b` double)")
+	c.Assert(err, IsNil)
+	decimalCol, doubleCol := tableInfo.Columns[0], tableInfo.Columns[1]
+
+	testCases := []struct {
+		col   *model.ColumnInfo
+		data1 string
+		data2 string
+		cmp   int
+	}{
+		// the values are equal when converted to float
+		{decimalCol, "12345678901234567890.00000000000000000001", "12345678901234567890.00000000000000000002", -1},
+		{decimalCol, "1.10", "1.1", 0},
+		{decimalCol, "-0.5", "-0.50000000000000000001", 1},
+		{doubleCol, "1e3", "999.9", 1},
+		{doubleCol, "2.5", "2.5", 0},
+	}
+	for _, testCase := range testCases {
+		cmp, err := compareNumber(testCase.col, []byte(testCase.data1), []byte(testCase.data2))
+		c.Assert(err, IsNil)
+		c.Assert(cmp, Equals, testCase.cmp, Commentf("%s vs %s", testCase.data1, testCase.data2))
+	}
+
+	_, err = compareNumber(decimalCol, []byte("abc"), []byte("1"))
+	c.Assert(err, NotNil)
+}
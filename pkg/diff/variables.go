@@ -0,0 +1,165 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// the sql_mode flags change how the values are quoted, escaped or padded, so the same rows may be read differently.
+var sensitiveSQLModes = []string{"ANSI_QUOTES", "NO_BACKSLASH_ESCAPES", "PAD_CHAR_TO_FULL_LENGTH"}
+
+// SessionVariables are the instance's session variables which may cause false differences if they are different
+// between the instances.
+type SessionVariables struct {
+	InstanceID string
+	SQLMode    string
+	// the session's time zone, SYSTEM is replaced by the system time zone
+	TimeZone            string
+	CharacterSetResults string
+}
+
+// FetchSessionVariables fetches the session variables of the instance.
+func FetchSessionVariables(ctx context.Context, db *sql.DB, instanceID string) (*SessionVariables, error) {
+	/*
+		mysql> SELECT @@SESSION.sql_mode, @@SESSION.time_zone, @@GLOBAL.system_time_zone, @@SESSION.character_set_results;
+		+---------------------------------------------+---------------------+---------------------------+----------------------------------+
+		| @@SESSION.sql_mode                          | @@SESSION.time_zone | @@GLOBAL.system_time_zone | @@SESSION.character_set_results |
+		+---------------------------------------------+---------------------+---------------------------+----------------------------------+
+		| ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,...  | SYSTEM              | CST                       | utf8mb4                          |
+		+---------------------------------------------+---------------------+---------------------------+----------------------------------+
+	*/
+	var sqlMode, timeZone, systemTimeZone, charsetResults sql.NullString
+	query := "SELECT @@SESSION.sql_mode, @@SESSION.time_zone, @@GLOBAL.system_time_zone, @@SESSION.character_set_results"
+	err := db.QueryRowContext(ctx, query).Scan(&sqlMode, &timeZone, &systemTimeZone, &charsetResults)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	variables := &SessionVariables{
+		InstanceID:          instanceID,
+		SQLMode:             sqlMode.String,
+		TimeZone:            timeZone.String,
+		CharacterSetResults: charsetResults.String,
+	}
+	if strings.EqualFold(variables.TimeZone, "SYSTEM") {
+		variables.TimeZone = systemTimeZone.String
+	}
+	// NULL means the results are not converted
+	if !charsetResults.Valid || strings.EqualFold(variables.CharacterSetResults, "binary") {
+		variables.CharacterSetResults = "binary"
+	}
+
+	return variables, nil
+}
+
+// sensitiveSQLMode returns the sensitive flags in the sql_mode, sorted and joined by comma.
+func sensitiveSQLMode(sqlMode string) string {
+	var flags []string
+	for _, flag := range strings.Split(strings.ToUpper(sqlMode), ",") {
+		flag = strings.TrimSpace(flag)
+		for _, sensitive := range sensitiveSQLModes {
+			if flag == sensitive {
+				flags = append(flags, flag)
+			}
+		}
+	}
+	sort.Strings(flags)
+
+	return strings.Join(flags, ",")
+}
+
+// AlignedSQLMode returns the sql_mode without the sensitive flags.
+func AlignedSQLMode(sqlMode string) string {
+	var flags []string
+	for _, flag := range strings.Split(sqlMode, ",") {
+		flag = strings.TrimSpace(flag)
+		if len(flag) == 0 || len(sensitiveSQLMode(flag)) != 0 {
+			continue
+		}
+		flags = append(flags, flag)
+	}
+
+	return strings.Join(flags, ",")
+}
+
+// AlignedSessionVariables returns the session variables need to set in the instance's connections, so the rows are
+// read in the same way as the other instances. the sensitive sql_mode flags are removed, and the time zone and the
+// result's character set are set to UTC and utf8mb4.
+func AlignedSessionVariables(variables *SessionVariables) map[string]string {
+	return map[string]string{
+		"sql_mode":              AlignedSQLMode(variables.SQLMode),
+		"time_zone":             "+00:00",
+		"character_set_results": "utf8mb4",
+	}
+}
+
+// VariableDifference is the difference of a session variable between the instances.
+type VariableDifference struct {
+	Variable string
+	// the values of the variable, keyed by the instance id
+	Values map[string]string
+}
+
+// String implements fmt.Stringer interface.
+func (d *VariableDifference) String() string {
+	instanceIDs := make([]string, 0, len(d.Values))
+	for instanceID := range d.Values {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+
+	values := make([]string, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		values = append(values, fmt.Sprintf("%s: '%s'", instanceID, d.Values[instanceID]))
+	}
+	return fmt.Sprintf("%s is different, %s", d.Variable, strings.Join(values, ", "))
+}
+
+// CompareSessionVariables returns the differences of the session variables between the instances. for sql_mode, only
+// the sensitive flags are compared.
+func CompareSessionVariables(instances []*SessionVariables) []*VariableDifference {
+	getters := []struct {
+		variable string
+		value    func(*SessionVariables) string
+	}{
+		{"sql_mode", func(v *SessionVariables) string { return sensitiveSQLMode(v.SQLMode) }},
+		{"time_zone", func(v *SessionVariables) string { return v.TimeZone }},
+		{"character_set_results", func(v *SessionVariables) string { return strings.ToLower(v.CharacterSetResults) }},
+	}
+
+	var differences []*VariableDifference
+	for _, getter := range getters {
+		values := make(map[string]string, len(instances))
+		different := false
+		for _, instance := range instances {
+			value := getter.value(instance)
+			if len(values) != 0 && value != getter.value(instances[0]) {
+				different = true
+			}
+			values[instance.InstanceID] = value
+		}
+		if different {
+			differences = append(differences, &VariableDifference{Variable: getter.variable, Values: values})
+		}
+	}
+
+	return differences
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testVariablesSuite{})
+
+type testVariablesSuite struct{}
+
+func (s *testVariablesSuite) TestFetchSessionVariables(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT @@SESSION.sql_mode.*").WillReturnRows(sqlmock.NewRows([]string{"sql_mode", "time_zone", "system_time_zone", "character_set_results"}).
+		AddRow("ANSI_QUOTES,STRICT_TRANS_TABLES", "SYSTEM", "CST", nil))
+	variables, err := FetchSessionVariables(context.Background(), db, "source-1")
+	c.Assert(err, IsNil)
+	c.Assert(variables, DeepEquals, &SessionVariables{
+		InstanceID:          "source-1",
+		SQLMode:             "ANSI_QUOTES,STRICT_TRANS_TABLES",
+		TimeZone:            "CST",
+		CharacterSetResults: "binary",
+	})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testVariablesSuite) TestCompareSessionVariables(c *C) {
+	source := &SessionVariables{InstanceID: "source-1", SQLMode: "STRICT_TRANS_TABLES,ansi_quotes", TimeZone: "+08:00", CharacterSetResults: "utf8mb4"}
+	target := &SessionVariables{InstanceID: "target", SQLMode: "ANSI_QUOTES", TimeZone: "+08:00", CharacterSetResults: "UTF8MB4"}
+
+	// only the sensitive flags of sql_mode are compared
+	c.Assert(CompareSessionVariables([]*SessionVariables{source, target}), HasLen, 0)
+
+	target.SQLMode = "STRICT_TRANS_TABLES"
+	target.TimeZone = "UTC"
+	differences := CompareSessionVariables([]*SessionVariables{source, target})
+	c.Assert(differences, HasLen, 2)
+	c.Assert(differences[0].Variable, Equals, "sql_mode")
+	c.Assert(differences[0].String(), Equals, "sql_mode is different, source-1: 'ANSI_QUOTES', target: ''")
+	c.Assert(differences[1].Variable, Equals, "time_zone")
+	c.Assert(differences[1].Values, DeepEquals, map[string]string{"source-1": "+08:00", "target": "UTC"})
+
+	c.Assert(AlignedSessionVariables(source), DeepEquals, map[string]string{
+		"sql_mode":              "STRICT_TRANS_TABLES",
+		"time_zone":             "+00:00",
+		"character_set_results": "utf8mb4",
+	})
+}
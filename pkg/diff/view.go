@@ -0,0 +1,60 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// getViewDefinition sets the table instance's view definition if the table is a view.
+func (t *TableDiff) getViewDefinition(ctx context.Context, table *TableInstance) error {
+	ctx1, cancel1 := t.Timeouts.WithTimeout(ctx, dbutil.TimeoutMetadata)
+	defer cancel1()
+
+	isView, err := dbutil.IsView(ctx1, table.Conn, table.Schema, table.Table)
+	if err != nil {
+		return errors.Annotatef(err, "table %s.%s.%s", table.InstanceID, table.Schema, table.Table)
+	}
+	table.isView = isView
+	if !isView {
+		return nil
+	}
+
+	table.viewDefinition, err = dbutil.GetViewDefinition(ctx1, table.Conn, table.Schema, table.Table)
+	return errors.Annotatef(err, "view %s.%s.%s", table.InstanceID, table.Schema, table.Table)
+}
+
+// equalViewDefinition returns true if both the table instances are not views, or both are views and have the same
+// definition. the definitions are compared without the instances' schema names, which are different if routed.
+func equalViewDefinition(table1, table2 *TableInstance) bool {
+	if table1.isView != table2.isView {
+		return false
+	}
+	if !table1.isView {
+		return true
+	}
+
+	return normalizeViewDefinition(table1.viewDefinition, table1.Schema) == normalizeViewDefinition(table2.viewDefinition, table2.Schema)
+}
+
+// normalizeViewDefinition removes the schema's name qualifying the tables and columns from the view's definition.
+func normalizeViewDefinition(definition, schema string) string {
+	qualifier := fmt.Sprintf("`%s`.", strings.Replace(schema, "`", "``", -1))
+	return strings.TrimSpace(strings.Replace(definition, qualifier, "", -1))
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+var _ = Suite(&testViewSuite{})
+
+type testViewSuite struct{}
+
+func (s *testViewSuite) TestCompareViews(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer sourceDB.Close()
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer targetDB.Close()
+
+	expectView := func(mock sqlmock.Sqlmock, schema, definition string) {
+		mock.ExpectQuery("SELECT TABLE_TYPE FROM information_schema.TABLES").WithArgs(schema, "v").WillReturnRows(sqlmock.NewRows([]string{"TABLE_TYPE"}).AddRow("VIEW"))
+		mock.ExpectQuery("SELECT VIEW_DEFINITION FROM information_schema.VIEWS").WithArgs(schema, "v").WillReturnRows(sqlmock.NewRows([]string{"VIEW_DEFINITION"}).AddRow(definition))
+		mock.ExpectQuery("SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLLATION_NAME FROM information_schema.COLUMNS").WithArgs(schema, "v").WillReturnRows(
+			sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLLATION_NAME"}).AddRow("id", "int(11)", "NO", nil))
+	}
+
+	newTableDiff := func() *TableDiff {
+		td := &TableDiff{
+			SourceTables: []*TableInstance{{Conn: sourceDB, Schema: "source", Table: "v", InstanceID: "source"}},
+			TargetTable:  &TableInstance{Conn: targetDB, Schema: "target", Table: "v", InstanceID: "target"},
+			CompareViews: true,
+		}
+		td.adjustConfig()
+		return td
+	}
+
+	// the definitions are compared without the schema names
+	expectView(sourceMock, "source", "select `source`.`t`.`id` AS `id` from `source`.`t`")
+	expectView(targetMock, "target", "select `target`.`t`.`id` AS `id` from `target`.`t`")
+	td := newTableDiff()
+	c.Assert(td.getTableInfo(context.Background()), IsNil)
+	c.Assert(td.TargetTable.isView, IsTrue)
+	c.Assert(td.TargetTable.info.Columns, HasLen, 1)
+	equal, err := td.CheckTableStruct(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsTrue)
+
+	expectView(sourceMock, "source", "select `source`.`t`.`id` AS `id` from `source`.`t` where (`source`.`t`.`id` > 10)")
+	expectView(targetMock, "target", "select `target`.`t`.`id` AS `id` from `target`.`t`")
+	td = newTableDiff()
+	c.Assert(td.getTableInfo(context.Background()), IsNil)
+	equal, err = td.CheckTableStruct(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(equal, IsFalse)
+
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testViewSuite) TestEqualViewDefinition(c *C) {
+	tableInfo, err := dbutil.GetTableInfoBySQL("CREATE TABLE `v` (`id` int)")
+	c.Assert(err, IsNil)
+
+	view := &TableInstance{Schema: "a`b", Table: "v", info: tableInfo, isView: true, viewDefinition: "select `a``b`.`t`.`id` AS `id` from `a``b`.`t`"}
+	table := &TableInstance{Schema: "test", Table: "v", info: tableInfo}
+	c.Assert(equalViewDefinition(table, table), IsTrue)
+	c.Assert(equalViewDefinition(view, table), IsFalse)
+	c.Assert(normalizeViewDefinition(view.viewDefinition, view.Schema), Equals, "select `t`.`id` AS `id` from `t`")
+}
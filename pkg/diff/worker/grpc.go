@@ -0,0 +1,139 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// codecName is the content subtype of the JSON codec, the messages are encoded in JSON, so the service can be
+	// called without generating the code from protobuf.
+	codecName = "json"
+
+	checkRangeMethod = "/diff.Worker/CheckRange"
+)
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+// workerServer is the server API of the gRPC service diff.Worker.
+type workerServer interface {
+	CheckRange(ctx context.Context, req *CheckRangeRequest) (*CheckRangeResponse, error)
+}
+
+func registerWorkerServer(s *grpc.Server, srv workerServer) {
+	s.RegisterService(&workerServiceDesc, srv)
+}
+
+var workerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "diff.Worker",
+	HandlerType: (*workerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckRange",
+			Handler:    checkRangeHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "worker",
+}
+
+func checkRangeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(CheckRangeRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		resp, err := srv.(workerServer).CheckRange(ctx, req.(*CheckRangeRequest))
+		return resp, toStatusError(err)
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: checkRangeMethod,
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+// toStatusError converts the error to the gRPC status error with the code, so the client can tell the invalid
+// requests from the failures of the databases.
+func toStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	code := codes.Internal
+	cause := errors.Cause(err)
+	if _, ok := cause.(*mysql.MySQLError); !ok {
+		// the errors created by errors.NotValidf and so on
+		switch message := cause.Error(); {
+		case cause == context.Canceled:
+			code = codes.Canceled
+		case cause == context.DeadlineExceeded:
+			code = codes.DeadlineExceeded
+		case strings.HasSuffix(message, " not valid"), strings.HasSuffix(message, " not supported"):
+			code = codes.InvalidArgument
+		case strings.HasSuffix(message, " not found"):
+			code = codes.NotFound
+		}
+	}
+	return status.Error(code, err.Error())
+}
+
+// Client is the client of the worker's gRPC service.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient returns a new Client calls the worker by the connection, the connection is not closed by Client.
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn}
+}
+
+// CheckRange calls the worker's CheckRange.
+func (c *Client) CheckRange(ctx context.Context, req *CheckRangeRequest, opts ...grpc.CallOption) (*CheckRangeResponse, error) {
+	resp := new(CheckRangeResponse)
+	err := c.conn.Invoke(ctx, checkRangeMethod, req, resp, append(opts, grpc.CallContentSubtype(codecName))...)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,338 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Config is the configuration of Worker.
+type Config struct {
+	// the source databases by the instance id, the connections only execute the read-only statements, see
+	// dbutil.OpenReadOnlyDB.
+	SourceDBs map[string]dbutil.DBConfig
+	TargetDB  dbutil.DBConfig
+	// the tables checked on requests, the requests of the other tables are rejected.
+	Tables []*TableConfig
+	// the max number of ranges checked concurrently, the others wait, 0 means no limit.
+	Concurrency int
+	// the timeouts of the queries, the default policy is used if is nil.
+	Timeouts *dbutil.TimeoutPolicy
+	// the TLS config of the gRPC service, set its ClientCAs and ClientAuth to verify the clients' certificates.
+	// the service can only listen on the loopback address if is nil.
+	TLS *tls.Config
+}
+
+// TableConfig is the config of a target table checked on requests.
+type TableConfig struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// the source tables, the same name's table in all the source databases if is empty
+	SourceTables []*TableRef `json:"source-tables"`
+	// the condition merged with the requests' bounds, for example "tenant_id = 1", empty means no condition
+	Range string `json:"range"`
+	// the columns are not checked
+	IgnoreColumns []string `json:"ignore-columns"`
+}
+
+// TableRef identifies a table in a database instance.
+type TableRef struct {
+	InstanceID string `json:"instance-id"`
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	// the condition selects the rows in this table, merged with the table's range, empty means no condition
+	Range string `json:"range"`
+}
+
+// CheckRangeRequest is the request to check a key range of a table.
+type CheckRangeRequest struct {
+	// the target table's schema and name, should be in the worker's tables
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// the bounds of the key range, the whole table if is empty
+	Bounds []*diff.Bound `json:"bounds"`
+	// the columns are not checked, besides the ignored columns in the table's config
+	IgnoreColumns []string `json:"ignore-columns"`
+	// the snapshots read by setting the session variable tidb_snapshot, for example the TSO of the replicated
+	// position, only works for TiDB. empty means reading the latest data.
+	SourceSnapshot string `json:"source-snapshot"`
+	TargetSnapshot string `json:"target-snapshot"`
+	// set true will reload the cached tables' struct before checking, should be set after the DDLs are replicated.
+	ReloadStruct bool `json:"reload-struct"`
+}
+
+// CheckRangeResponse is the verdict of the key range.
+type CheckRangeResponse struct {
+	Equal          bool          `json:"equal"`
+	SourceChecksum int64         `json:"source-checksum"`
+	TargetChecksum int64         `json:"target-checksum"`
+	SourceCount    int64         `json:"source-count"`
+	TargetCount    int64         `json:"target-count"`
+	Duration       time.Duration `json:"duration"`
+}
+
+// Worker is a long-running service checks the key ranges of the tables on request, for example the ranges just
+// replicated by DM or TiCDC, so the data can be validated continuously instead of batch runs. it can be used as a
+// library by calling CheckRange, or served by gRPC, see Serve and Client.
+type Worker struct {
+	cfg Config
+
+	sourceDBs map[string]*sql.DB
+	targetDB  *sql.DB
+	limiter   *diff.ConcurrencyLimiter
+	// caches the tables' struct of the shared connections, the struct changed by DDL is reloaded after Clear
+	cache *dbutil.MetadataCache
+
+	mu     sync.Mutex
+	server *grpc.Server
+}
+
+// NewWorker returns a new Worker, the read-only connections of the databases are opened.
+func NewWorker(cfg Config) (*Worker, error) {
+	// the worker never writes the databases whatever requested
+	openDB := dbutil.OpenReadOnlyDB
+
+	sourceDBs := make(map[string]*sql.DB, len(cfg.SourceDBs))
+	closeAll := func() {
+		for _, db := range sourceDBs {
+			db.Close()
+		}
+	}
+	for instanceID, dbCfg := range cfg.SourceDBs {
+		db, err := openDB(dbCfg)
+		if err != nil {
+			closeAll()
+			return nil, errors.Annotatef(err, "create db connections of %s", instanceID)
+		}
+		sourceDBs[instanceID] = db
+	}
+	targetDB, err := openDB(cfg.TargetDB)
+	if err != nil {
+		closeAll()
+		return nil, errors.Annotatef(err, "create db connections of target")
+	}
+
+	return newWorker(cfg, sourceDBs, targetDB), nil
+}
+
+func newWorker(cfg Config, sourceDBs map[string]*sql.DB, targetDB *sql.DB) *Worker {
+	w := &Worker{
+		cfg:       cfg,
+		sourceDBs: sourceDBs,
+		targetDB:  targetDB,
+		cache:     dbutil.NewMetadataCache(),
+	}
+	if cfg.Concurrency > 0 {
+		w.limiter = diff.NewConcurrencyLimiter("worker", cfg.Concurrency)
+	}
+	return w
+}
+
+// CheckRange checks the key range of the target table and the source tables by the checksums and the counts, see
+// diff.TableDiff's CheckRange. it's safe to be called concurrently.
+func (w *Worker) CheckRange(ctx context.Context, req *CheckRangeRequest) (*CheckRangeResponse, error) {
+	if len(req.Schema) == 0 || len(req.Table) == 0 {
+		return nil, errors.NotValidf("empty schema or table")
+	}
+	table := w.table(req.Schema, req.Table)
+	if table == nil {
+		return nil, errors.NotFoundf("table %s in the worker's tables", dbutil.TableName(req.Schema, req.Table))
+	}
+
+	if w.limiter != nil {
+		if err := w.limiter.Acquire(ctx); err != nil {
+			return nil, errors.Trace(err)
+		}
+		defer w.limiter.Release()
+	}
+
+	sourceTables := table.SourceTables
+	if len(sourceTables) == 0 {
+		for instanceID := range w.sourceDBs {
+			sourceTables = append(sourceTables, &TableRef{InstanceID: instanceID, Schema: req.Schema, Table: req.Table})
+		}
+	}
+	if len(sourceTables) == 0 {
+		return nil, errors.NotValidf("empty source tables")
+	}
+
+	if req.ReloadStruct {
+		w.ClearCache()
+	}
+
+	var closers []func()
+	defer func() {
+		for _, closeDB := range closers {
+			closeDB()
+		}
+	}()
+
+	td := &diff.TableDiff{
+		IgnoreColumns: append(append([]string{}, table.IgnoreColumns...), req.IgnoreColumns...),
+		Range:         table.Range,
+		UseChecksum:   true,
+		Timeouts:      w.cfg.Timeouts,
+	}
+	for _, sourceTable := range sourceTables {
+		db, ok := w.sourceDBs[sourceTable.InstanceID]
+		if !ok {
+			return nil, errors.NotFoundf("source instance %s", sourceTable.InstanceID)
+		}
+		instance, closeDB, err := w.tableInstance(db, w.cfg.SourceDBs[sourceTable.InstanceID], sourceTable, req.SourceSnapshot)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		closers = append(closers, closeDB)
+		td.SourceTables = append(td.SourceTables, instance)
+	}
+	targetTable, closeDB, err := w.tableInstance(w.targetDB, w.cfg.TargetDB, &TableRef{InstanceID: "target", Schema: req.Schema, Table: req.Table}, req.TargetSnapshot)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	closers = append(closers, closeDB)
+	td.TargetTable = targetTable
+
+	result, err := td.CheckRange(ctx, req.Bounds)
+	if err != nil {
+		// the error may be caused by the tables' struct changed
+		w.ClearCache()
+		return nil, errors.Trace(err)
+	}
+
+	return &CheckRangeResponse{
+		Equal:          result.Equal,
+		SourceChecksum: result.SourceChecksum,
+		TargetChecksum: result.TargetChecksum,
+		SourceCount:    result.SourceRowCount,
+		TargetCount:    result.TargetRowCount,
+		Duration:       result.Duration,
+	}, nil
+}
+
+// table returns the config of the target table, nil if the table is not in the worker's tables.
+func (w *Worker) table(schema, table string) *TableConfig {
+	for _, tableCfg := range w.cfg.Tables {
+		if tableCfg.Schema == schema && tableCfg.Table == table {
+			return tableCfg
+		}
+	}
+	return nil
+}
+
+// tableInstance returns the table instance reads from the shared connections, or the new connections reading at the
+// snapshot, which should be closed by the returned function after checked.
+func (w *Worker) tableInstance(db *sql.DB, dbCfg dbutil.DBConfig, table *TableRef, snapshot string) (*diff.TableInstance, func(), error) {
+	instance := &diff.TableInstance{
+		Conn:       db,
+		Schema:     table.Schema,
+		Table:      table.Table,
+		InstanceID: table.InstanceID,
+		Range:      table.Range,
+	}
+	if len(snapshot) == 0 {
+		instance.MetadataCache = w.cache
+		return instance, func() {}, nil
+	}
+
+	variables := make(map[string]string, len(dbCfg.SessionVariables)+1)
+	for name, value := range dbCfg.SessionVariables {
+		variables[name] = value
+	}
+	variables["tidb_snapshot"] = snapshot
+	dbCfg.SessionVariables = variables
+	// the snapshot is read exactly
+	dbCfg.ReadStaleness = ""
+
+	snapshotDB, err := dbutil.OpenReadOnlyDB(dbCfg)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "create db connections of %s at snapshot %s", table.InstanceID, snapshot)
+	}
+	instance.Conn = snapshotDB
+	return instance, func() { snapshotDB.Close() }, nil
+}
+
+// ClearCache clears the cached tables' struct, should be called after the tables' struct are changed, for example
+// after replicating the DDLs.
+func (w *Worker) ClearCache() {
+	w.cache.Clear()
+}
+
+// Serve serves the gRPC service on the listener, blocks until Stop is called or the listener fails. the listener should
+// be on the loopback address if the TLS config is nil.
+func (w *Worker) Serve(listener net.Listener) error {
+	var opts []grpc.ServerOption
+	if w.cfg.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(w.cfg.TLS)))
+	} else if !isLoopback(listener.Addr()) {
+		return errors.NotSupportedf("listening on non-loopback address %s without TLS", listener.Addr())
+	}
+
+	w.mu.Lock()
+	if w.server != nil {
+		w.mu.Unlock()
+		return errors.AlreadyExistsf("worker server")
+	}
+	w.server = grpc.NewServer(opts...)
+	registerWorkerServer(w.server, w)
+	server := w.server
+	w.mu.Unlock()
+
+	log.Info("start worker server", zap.Stringer("addr", listener.Addr()))
+	return errors.Trace(server.Serve(listener))
+}
+
+// isLoopback returns true if the address is a loopback address or a unix socket.
+func isLoopback(addr net.Addr) bool {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP.IsLoopback()
+	case *net.UnixAddr:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop stops the gRPC service gracefully, the requests being checked are finished.
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.server != nil {
+		w.server.GracefulStop()
+		w.server = nil
+	}
+}
+
+// Close stops the gRPC service and closes the connections.
+func (w *Worker) Close() {
+	w.Stop()
+	for _, db := range w.sourceDBs {
+		db.Close()
+	}
+	w.targetDB.Close()
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testWorkerSuite{})
+
+type testWorkerSuite struct{}
+
+func (s *testWorkerSuite) TestCheckRange(c *C) {
+	sourceDB, sourceMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	targetDB, targetMock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+
+	w := newWorker(Config{Concurrency: 1, Tables: []*TableConfig{{Schema: "test", Table: "t"}}}, map[string]*sql.DB{"source-1": sourceDB}, targetDB)
+	defer w.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	go w.Serve(listener)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	client := NewClient(conn)
+
+	createTable := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", "CREATE TABLE `t` (`id` int, `name` varchar(10), PRIMARY KEY (`id`))")
+	}
+	targetMock.ExpectQuery("SHOW CREATE TABLE `test`.`t`").WillReturnRows(createTable())
+	sourceMock.ExpectQuery("SHOW CREATE TABLE `test`.`t`").WillReturnRows(createTable())
+	sourceMock.ExpectQuery("SELECT BIT_XOR.* WHERE \\(`id` > \\? AND `id` <= \\? AND TRUE\\)").WithArgs("0", "100").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectQuery("SELECT BIT_XOR.* WHERE \\(`id` > \\? AND `id` <= \\? AND TRUE\\)").WithArgs("0", "100").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(456, 10))
+
+	req := &CheckRangeRequest{
+		Schema: "test",
+		Table:  "t",
+		Bounds: []*diff.Bound{{Column: "id", Lower: "0", Upper: "100"}},
+	}
+	resp, err := client.CheckRange(context.Background(), req)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Equal, IsFalse)
+	c.Assert(resp.SourceChecksum, Equals, int64(123))
+	c.Assert(resp.TargetChecksum, Equals, int64(456))
+	c.Assert(resp.SourceCount, Equals, int64(10))
+	c.Assert(resp.TargetCount, Equals, int64(10))
+
+	// the table's struct is cached
+	sourceMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	targetMock.ExpectQuery("SELECT BIT_XOR").WillReturnRows(sqlmock.NewRows([]string{"checksum", "count"}).AddRow(123, 10))
+	resp, err = client.CheckRange(context.Background(), req)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Equal, IsTrue)
+	c.Assert(sourceMock.ExpectationsWereMet(), IsNil)
+	c.Assert(targetMock.ExpectationsWereMet(), IsNil)
+
+	// the invalid requests
+	_, err = client.CheckRange(context.Background(), &CheckRangeRequest{Schema: "test"})
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+	// the tables not configured are rejected
+	_, err = client.CheckRange(context.Background(), &CheckRangeRequest{Schema: "mysql", Table: "user"})
+	c.Assert(status.Code(err), Equals, codes.NotFound)
+	_, err = client.CheckRange(context.Background(), &CheckRangeRequest{Schema: "test", Table: "t", Bounds: []*diff.Bound{{Column: "id", LowerSymbol: "="}}})
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+}
+
+func (s *testWorkerSuite) TestServeWithoutTLS(c *C) {
+	targetDB, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	w := newWorker(Config{}, nil, targetDB)
+	defer w.Close()
+
+	// only listens on the loopback address without TLS
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	c.Assert(w.Serve(listener), ErrorMatches, "listening on non-loopback address .* without TLS not supported")
+}
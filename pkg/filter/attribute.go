@@ -0,0 +1,192 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// TableAttributes are the table's attributes fetched from information_schema.
+type TableAttributes struct {
+	Engine string
+	// the estimated number of rows
+	Rows          int64
+	HasPrimaryKey bool
+	Comment       string
+	// the columns' names in the order of the table's definition
+	Columns []string
+}
+
+// AttributeRules selects the tables by their attributes, the empty rules match all the tables.
+type AttributeRules struct {
+	// the table's engine should be one of them, case insensitive, for example "InnoDB".
+	Engines []string `json:"engines" toml:"engines" yaml:"engines"`
+	// the table's estimated rows should be greater than or equal to it, 0 means no limit.
+	MinRows int64 `json:"min-rows" toml:"min-rows" yaml:"min-rows"`
+	// the table's estimated rows should be less than or equal to it, 0 means no limit.
+	MaxRows int64 `json:"max-rows" toml:"max-rows" yaml:"max-rows"`
+	// set true will only select the tables have primary key.
+	RequirePrimaryKey bool `json:"require-primary-key" toml:"require-primary-key" yaml:"require-primary-key"`
+}
+
+// Valid returns error if the rules are invalid.
+func (r *AttributeRules) Valid() error {
+	if r.MinRows < 0 || r.MaxRows < 0 {
+		return errors.NotValidf("min-rows %d and max-rows %d", r.MinRows, r.MaxRows)
+	}
+	if r.MaxRows > 0 && r.MinRows > r.MaxRows {
+		return errors.NotValidf("min-rows %d greater than max-rows %d", r.MinRows, r.MaxRows)
+	}
+	return nil
+}
+
+// Match returns true if the table's attributes match the rules.
+func (r *AttributeRules) Match(attrs *TableAttributes) bool {
+	if r == nil {
+		return true
+	}
+	if attrs == nil {
+		return false
+	}
+
+	if len(r.Engines) > 0 {
+		matched := false
+		for _, engine := range r.Engines {
+			if strings.EqualFold(engine, attrs.Engine) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if r.MinRows > 0 && attrs.Rows < r.MinRows {
+		return false
+	}
+	if r.MaxRows > 0 && attrs.Rows > r.MaxRows {
+		return false
+	}
+
+	return !r.RequirePrimaryKey || attrs.HasPrimaryKey
+}
+
+// ApplyOn returns the tables whose attributes match the rules, the attributes are fetched from the database.
+// the tables don't exist in information_schema, for example the views, are filtered out.
+func (r *AttributeRules) ApplyOn(ctx context.Context, db *sql.DB, stbs []*Table) ([]*Table, error) {
+	if r == nil || len(stbs) == 0 {
+		return stbs, nil
+	}
+
+	schemas := make([]string, 0, 1)
+	schemaSet := make(map[string]struct{})
+	for _, tb := range stbs {
+		if _, ok := schemaSet[tb.Schema]; !ok {
+			schemaSet[tb.Schema] = struct{}{}
+			schemas = append(schemas, tb.Schema)
+		}
+	}
+
+	attrs, err := FetchTableAttributes(ctx, db, schemas)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var tbs []*Table
+	for _, tb := range stbs {
+		if r.Match(attrs[Table{Schema: tb.Schema, Name: tb.Name}]) {
+			tbs = append(tbs, tb)
+		}
+	}
+
+	return tbs, nil
+}
+
+// FetchTableAttributes fetches the attributes of the base tables in the schemas from information_schema.
+func FetchTableAttributes(ctx context.Context, db *sql.DB, schemas []string) (map[Table]*TableAttributes, error) {
+	attrs := make(map[Table]*TableAttributes)
+	if len(schemas) == 0 {
+		return attrs, nil
+	}
+
+	schemaArgs := make([][]interface{}, 0, len(schemas))
+	for _, schema := range schemas {
+		schemaArgs = append(schemaArgs, []interface{}{schema})
+	}
+
+	/*
+		mysql> SELECT TABLE_SCHEMA, TABLE_NAME, ENGINE, TABLE_ROWS, TABLE_COMMENT FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA IN ('test');
+		+--------------+------------+--------+------------+---------------+
+		| TABLE_SCHEMA | TABLE_NAME | ENGINE | TABLE_ROWS | TABLE_COMMENT |
+		+--------------+------------+--------+------------+---------------+
+		| test         | t1         | InnoDB |       1000 | shard:orders  |
+		+--------------+------------+--------+------------+---------------+
+	*/
+	query := "SELECT TABLE_SCHEMA, TABLE_NAME, ENGINE, TABLE_ROWS, TABLE_COMMENT FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA IN (%s)"
+	err := dbutil.QueryInList(ctx, db, query, nil, schemaArgs, 0, func(rows *sql.Rows) error {
+		var (
+			schema, name string
+			engine       sql.NullString
+			tableRows    sql.NullInt64
+			comment      sql.NullString
+		)
+		if err := rows.Scan(&schema, &name, &engine, &tableRows, &comment); err != nil {
+			return errors.Trace(err)
+		}
+		attrs[Table{Schema: schema, Name: name}] = &TableAttributes{
+			Engine:  engine.String,
+			Rows:    tableRows.Int64,
+			Comment: comment.String,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	query = "SELECT DISTINCT TABLE_SCHEMA, TABLE_NAME FROM information_schema.STATISTICS WHERE INDEX_NAME = 'PRIMARY' AND TABLE_SCHEMA IN (%s)"
+	err = dbutil.QueryInList(ctx, db, query, nil, schemaArgs, 0, func(rows *sql.Rows) error {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			return errors.Trace(err)
+		}
+		if attr, ok := attrs[Table{Schema: schema, Name: name}]; ok {
+			attr.HasPrimaryKey = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	query = "SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA IN (%s) ORDER BY ORDINAL_POSITION"
+	err = dbutil.QueryInList(ctx, db, query, nil, schemaArgs, 0, func(rows *sql.Rows) error {
+		var schema, name, column string
+		if err := rows.Scan(&schema, &name, &column); err != nil {
+			return errors.Trace(err)
+		}
+		if attr, ok := attrs[Table{Schema: schema, Name: name}]; ok {
+			attr.Columns = append(attr.Columns, column)
+		}
+		return nil
+	})
+
+	return attrs, errors.Trace(err)
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testFilterSuite) TestAttributeRulesMatch(c *C) {
+	attrs := &TableAttributes{Engine: "InnoDB", Rows: 1000, HasPrimaryKey: false}
+
+	cases := []struct {
+		rules *AttributeRules
+		match bool
+	}{
+		{nil, true},
+		{&AttributeRules{}, true},
+		{&AttributeRules{Engines: []string{"innodb"}}, true},
+		{&AttributeRules{Engines: []string{"MyISAM"}}, false},
+		{&AttributeRules{MinRows: 1000}, true},
+		{&AttributeRules{MinRows: 1001}, false},
+		{&AttributeRules{MaxRows: 999}, false},
+		{&AttributeRules{RequirePrimaryKey: true}, false},
+	}
+	for _, t := range cases {
+		c.Assert(t.rules.Match(attrs), Equals, t.match, Commentf("%+v", t.rules))
+	}
+
+	c.Assert((&AttributeRules{}).Match(nil), IsFalse)
+	c.Assert((&AttributeRules{MinRows: 10, MaxRows: 1}).Valid(), NotNil)
+	c.Assert((&AttributeRules{MinRows: 1, MaxRows: 10}).Valid(), IsNil)
+}
+
+func (s *testFilterSuite) TestAttributeRulesApplyOn(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, ENGINE, TABLE_ROWS, TABLE_COMMENT FROM information_schema.TABLES").WithArgs("test").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "ENGINE", "TABLE_ROWS", "TABLE_COMMENT"}).
+			AddRow("test", "t1", "InnoDB", 1000, "shard:orders").
+			AddRow("test", "t2", "InnoDB", 10, "").
+			AddRow("test", "t3", "MyISAM", 1000, "").
+			AddRow("test", "t4", "InnoDB", 1000, ""))
+	mock.ExpectQuery("SELECT DISTINCT TABLE_SCHEMA, TABLE_NAME FROM information_schema.STATISTICS").WithArgs("test").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME"}).AddRow("test", "t1").AddRow("test", "t2").AddRow("test", "t3"))
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME FROM information_schema.COLUMNS").WithArgs("test").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME"}).AddRow("test", "t1", "id").AddRow("test", "t1", "shard_id").AddRow("test", "v1", "id"))
+
+	rules := &AttributeRules{Engines: []string{"InnoDB"}, MinRows: 100, RequirePrimaryKey: true}
+	tables, err := rules.ApplyOn(context.Background(), db, []*Table{{"test", "t1"}, {"test", "t2"}, {"test", "t3"}, {"test", "t4"}, {"test", "v1"}})
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, []*Table{{"test", "t1"}})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testFilterSuite) TestFetchTableAttributes(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, ENGINE, TABLE_ROWS, TABLE_COMMENT FROM information_schema.TABLES").WithArgs("test").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "ENGINE", "TABLE_ROWS", "TABLE_COMMENT"}).AddRow("test", "t1", "InnoDB", 1000, "shard:orders"))
+	mock.ExpectQuery("SELECT DISTINCT TABLE_SCHEMA, TABLE_NAME FROM information_schema.STATISTICS").WithArgs("test").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME"}).AddRow("test", "t1"))
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME FROM information_schema.COLUMNS").WithArgs("test").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME"}).AddRow("test", "t1", "id").AddRow("test", "t1", "shard_id").AddRow("test", "v1", "id"))
+
+	attrs, err := FetchTableAttributes(context.Background(), db, []string{"test"})
+	c.Assert(err, IsNil)
+	c.Assert(attrs, DeepEquals, map[Table]*TableAttributes{
+		{Schema: "test", Name: "t1"}: {Engine: "InnoDB", Rows: 1000, HasPrimaryKey: true, Comment: "shard:orders", Columns: []string{"id", "shard_id"}},
+	})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -18,6 +18,8 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+
+	"github.com/pingcap/errors"
 )
 
 // ActionType is do or ignore something
@@ -71,6 +73,32 @@ type Rules struct {
 	IgnoreDBs    []string `json:"ignore-dbs" toml:"ignore-dbs" yaml:"ignore-dbs"`
 }
 
+// Valid returns error if the regular expressions in the rules, which start with "~", are invalid.
+func (r *Rules) Valid() error {
+	if r == nil {
+		return nil
+	}
+
+	patterns := make([]string, 0, len(r.DoDBs)+len(r.IgnoreDBs)+2*(len(r.DoTables)+len(r.IgnoreTables)))
+	patterns = append(patterns, r.DoDBs...)
+	patterns = append(patterns, r.IgnoreDBs...)
+	for _, tables := range [][]*Table{r.DoTables, r.IgnoreTables} {
+		for _, table := range tables {
+			patterns = append(patterns, table.Schema, table.Name)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "~") {
+			continue
+		}
+		if _, err := regexp.Compile(pattern[1:]); err != nil {
+			return errors.Annotatef(err, "pattern %s", pattern)
+		}
+	}
+	return nil
+}
+
 // ToLower convert all entries to lowercase
 func (r *Rules) ToLower() {
 	if r == nil {
@@ -149,3 +149,27 @@ func (s *testFilterSuite) TestCaseSensitive(c *C) {
 	c.Logf("got %+v, expected %+v", actual, expected)
 	c.Assert(actual, DeepEquals, expected)
 }
+
+func (s *testFilterSuite) TestValid(c *C) {
+	var nilRules *Rules
+	c.Assert(nilRules.Valid(), IsNil)
+
+	validRules := &Rules{
+		DoDBs:        []string{"~^test.*"},
+		IgnoreTables: []*Table{{"test", "~^t[0-9]+$"}},
+	}
+	c.Assert(validRules.Valid(), IsNil)
+
+	invalidRules := []*Rules{
+		{DoDBs: []string{"~("}},
+		{IgnoreDBs: []string{"~[a-"}},
+		{DoTables: []*Table{{"test", "~("}}},
+		{IgnoreTables: []*Table{{"~(", "t1"}}},
+	}
+	for _, r := range invalidRules {
+		c.Assert(r.Valid(), NotNil)
+	}
+
+	// the patterns not start with "~" are not regular expressions
+	c.Assert((&Rules{DoDBs: []string{"("}}).Valid(), IsNil)
+}
@@ -25,6 +25,10 @@ type Config struct {
 
 	IndexSQL string `toml:"index-sql" json:"index-sql"`
 
+	// the number of tables generated and populated, the table-sql and index-sql are regarded as the templates of
+	// the tables if it is greater than 0. 0 means only the table in table-sql.
+	TableCount int `toml:"table-count" json:"table-count"`
+
 	LogLevel string `toml:"log-level" json:"log-level"`
 
 	WorkerCount int `toml:"worker-count" json:"worker-count"`
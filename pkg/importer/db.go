@@ -227,7 +227,10 @@ func execSQL(db *sql.DB, sql string) error {
 }
 
 func createDB(cfg dbutil.DBConfig) (*sql.DB, error) {
-	dbDSN := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Schema)
+	dbDSN, err := dbutil.GetDSN(cfg, cfg.Schema, "charset=utf8")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	db, err := sql.Open("mysql", dbDSN)
 	if err != nil {
 		return nil, errors.Trace(err)
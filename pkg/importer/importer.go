@@ -14,35 +14,59 @@
 package importer
 
 import (
+	"database/sql"
+
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
 )
 
 // DoProcess generates data.
 func DoProcess(cfg *Config) {
-	table := newTable()
-	err := parseTableSQL(table, cfg.TableSQL)
+	dbs, err := createDBs(cfg.DBCfg, cfg.WorkerCount)
 	if err != nil {
-		log.Fatal("parseTableSQL", zap.Error(err))
+		log.Fatal("createDBs", zap.Error(err))
+	}
+	defer closeDBs(dbs)
+
+	if cfg.TableCount <= 0 {
+		processTable(cfg, dbs, cfg.TableSQL, cfg.IndexSQL)
+		return
 	}
 
-	err = parseIndexSQL(table, cfg.IndexSQL)
+	for i := 0; i < cfg.TableCount; i++ {
+		tableSQL, err := renderTemplate("table-sql", cfg.TableSQL, i)
+		if err != nil {
+			log.Fatal("renderTemplate", zap.Int("index", i), zap.Error(err))
+		}
+		indexSQL, err := renderTemplate("index-sql", cfg.IndexSQL, i)
+		if err != nil {
+			log.Fatal("renderTemplate", zap.Int("index", i), zap.Error(err))
+		}
+
+		log.Info("generate table", zap.Int("index", i), zap.String("sql", tableSQL))
+		processTable(cfg, dbs, tableSQL, indexSQL)
+	}
+}
+
+// processTable creates the table and index, then populates the table.
+func processTable(cfg *Config, dbs []*sql.DB, tableSQL, indexSQL string) {
+	table := newTable()
+	err := parseTableSQL(table, tableSQL)
 	if err != nil {
-		log.Fatal("parseIndexSQL", zap.Error(err))
+		log.Fatal("parseTableSQL", zap.Error(err))
 	}
 
-	dbs, err := createDBs(cfg.DBCfg, cfg.WorkerCount)
+	err = parseIndexSQL(table, indexSQL)
 	if err != nil {
-		log.Fatal("createDBs", zap.Error(err))
+		log.Fatal("parseIndexSQL", zap.Error(err))
 	}
-	defer closeDBs(dbs)
 
-	err = execSQL(dbs[0], cfg.TableSQL)
+	err = execSQL(dbs[0], tableSQL)
 	if err != nil {
 		log.Fatal("execSQL", zap.Error(err))
 	}
 
-	err = execSQL(dbs[0], cfg.IndexSQL)
+	err = execSQL(dbs[0], indexSQL)
 	if err != nil {
 		log.Fatal("execSQL", zap.Error(err))
 	}
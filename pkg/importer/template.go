@@ -0,0 +1,74 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"bytes"
+	"math/rand"
+	"text/template"
+
+	"github.com/pingcap/errors"
+)
+
+// templateData is the data used to render the table's DDL from the template.
+type templateData struct {
+	// the index of the generated table, from 0 to table-count - 1
+	Index int
+}
+
+// renderTemplate renders the sql template of the index-th table, the template is a Go text/template, for example
+// `create table t_{{.Index}}(a int primary key{{range $i := seq (randInt 1 10)}}, c{{$i}} int{{end}});`.
+// the template functions are `seq n` returns 1, 2, ..., n, `randInt min max` returns a random integer in [min, max],
+// and `pick v1 v2 ...` returns one of the values randomly. the random functions are seeded by the index,
+// so the same table is rendered every time.
+func renderTemplate(name, text string, index int) (string, error) {
+	if len(text) == 0 {
+		return "", nil
+	}
+
+	rd := rand.New(rand.NewSource(int64(index)))
+	funcs := template.FuncMap{
+		"seq": func(n int) []int {
+			nums := make([]int, 0, n)
+			for i := 1; i <= n; i++ {
+				nums = append(nums, i)
+			}
+			return nums
+		},
+		"randInt": func(min, max int) (int, error) {
+			if min > max {
+				return 0, errors.NotValidf("randInt %d %d", min, max)
+			}
+			return min + rd.Intn(max-min+1), nil
+		},
+		"pick": func(values ...string) (string, error) {
+			if len(values) == 0 {
+				return "", errors.NotValidf("pick without values")
+			}
+			return values[rd.Intn(len(values))], nil
+		},
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = tmpl.Execute(buf, templateData{Index: index}); err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return buf.String(), nil
+}
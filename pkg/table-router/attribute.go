@@ -0,0 +1,110 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/filter"
+)
+
+// AttributePredicate restricts a rule to the tables having the attributes, so the shards can be routed by their
+// structures or tags instead of only the names.
+type AttributePredicate struct {
+	// the table should have all the columns, case insensitive
+	Columns []string `json:"columns" toml:"columns" yaml:"columns"`
+	// the table's comment should contain the tag, for example "shard:orders"
+	CommentTag string `json:"comment-tag" toml:"comment-tag" yaml:"comment-tag"`
+}
+
+// Valid returns error if the predicate is empty.
+func (p *AttributePredicate) Valid() error {
+	if len(p.Columns) == 0 && len(p.CommentTag) == 0 {
+		return errors.NotValidf("empty attributes predicate")
+	}
+	return nil
+}
+
+// Match returns true if the table's attributes satisfy the predicate, the table with unknown attributes doesn't match.
+func (p *AttributePredicate) Match(attrs *filter.TableAttributes) bool {
+	if p == nil {
+		return true
+	}
+	if attrs == nil {
+		return false
+	}
+
+	for _, column := range p.Columns {
+		found := false
+		for _, col := range attrs.Columns {
+			if strings.EqualFold(column, col) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return strings.Contains(attrs.Comment, p.CommentTag)
+}
+
+// HasAttributeRules returns true if any rule has the attribute predicate, the tables' attributes should be set by
+// SetTableAttributes before routing.
+func (r *Table) HasAttributeRules() bool {
+	r.mu.RLock()
+	instances := []string{""}
+	for instance := range r.instanceSelectors {
+		instances = append(instances, instance)
+	}
+	for instance := range r.regexpRules {
+		instances = append(instances, instance)
+	}
+	r.mu.RUnlock()
+
+	for _, instance := range instances {
+		for _, rule := range r.allRules(instance) {
+			if rule.Attributes != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetTableAttributes sets the attributes of the source instance's tables, they're matched by the rules' attribute
+// predicates when routing the tables of the instance. the attributes of the instance are replaced.
+func (r *Table) SetTableAttributes(instance string, attrs map[filter.Table]*filter.TableAttributes) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tableAttributes[instance] = attrs
+}
+
+// satisfy returns true if the rule has no attribute predicate, or the attributes of the instance's schema/table
+// satisfy it.
+func (r *Table) satisfy(rule *TableRule, instance, schema, table string) bool {
+	if rule.Attributes == nil {
+		return true
+	}
+	if len(table) == 0 {
+		return false
+	}
+
+	r.mu.RLock()
+	attrs := r.tableAttributes[instance][filter.Table{Schema: schema, Name: table}]
+	r.mu.RUnlock()
+	return rule.Attributes.Match(attrs)
+}
@@ -0,0 +1,236 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/filter"
+	"github.com/pingcap/tidb-tools/pkg/table-rule-selector"
+)
+
+const (
+	// MatchedByTablePattern means the table is routed by a table level pattern rule.
+	MatchedByTablePattern = "table-pattern"
+	// MatchedByTableRegexp means the table is routed by a table level regexp rule.
+	MatchedByTableRegexp = "table-regexp"
+	// MatchedBySchemaPattern means the table is routed by a schema level pattern rule.
+	MatchedBySchemaPattern = "schema-pattern"
+	// MatchedBySchemaRegexp means the table is routed by a schema level regexp rule.
+	MatchedBySchemaRegexp = "schema-regexp"
+)
+
+// Explanation explains how a schema/table is routed, it's used to debug the rules.
+type Explanation struct {
+	Instance string `json:"instance,omitempty"`
+	Schema   string `json:"schema"`
+	Table    string `json:"table"`
+
+	// the rule which routes the schema/table, nil if no rule matches or the matched rules conflict
+	Rule *TableRule `json:"rule,omitempty"`
+	// one of MatchedByTablePattern, MatchedByTableRegexp, MatchedBySchemaPattern and MatchedBySchemaRegexp, empty if
+	// Rule is nil
+	MatchedBy string `json:"matched-by,omitempty"`
+	// the human readable reason why the rule is chosen
+	Reason string `json:"reason"`
+
+	// the target schema/table, same as the schema/table if no rule matches, empty if the matched rules conflict
+	TargetSchema string            `json:"target-schema"`
+	TargetTable  string            `json:"target-table"`
+	Columns      map[string]string `json:"extract-columns,omitempty"`
+
+	// the other matched rules which have lower priority than Rule
+	Overridden []*TableRule `json:"overridden,omitempty"`
+	// the matched rules in the same level, the schema/table can't be routed if they are not empty
+	Conflicts []*TableRule `json:"conflicts,omitempty"`
+	// the rules matched by the schema/table, but the table's attributes don't satisfy their attribute predicates
+	Unsatisfied []*TableRule `json:"unsatisfied,omitempty"`
+}
+
+// Matched returns true if the schema/table is matched by any rule.
+func (e *Explanation) Matched() bool {
+	return e.Rule != nil || len(e.Conflicts) != 0
+}
+
+// Explain explains how schema/table is routed by the rules of all the instances.
+func (r *Table) Explain(schema, table string) (*Explanation, error) {
+	return r.ExplainWithInstance("", schema, table)
+}
+
+// ExplainWithInstance explains how schema/table of the source instance is routed. unlike RouteWithInstance, it doesn't
+// return an error if the matched rules conflict, the conflicting rules are set in the explanation.
+func (r *Table) ExplainWithInstance(instance, schema, table string) (*Explanation, error) {
+	e, err := r.explain(instance, schema, table)
+	return e, errors.Trace(err)
+}
+
+func (r *Table) explain(instance, schema, table string) (*Explanation, error) {
+	d, err := r.decide(instance, schema, table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	e := &Explanation{
+		Instance:    instance,
+		Schema:      schema,
+		Table:       table,
+		Rule:        d.rule,
+		MatchedBy:   d.matchedBy,
+		Conflicts:   d.conflicts,
+		Unsatisfied: d.unsatisfied,
+	}
+
+	// the matched rules in the order of the priority
+	matched := append(d.tableRules[:len(d.tableRules):len(d.tableRules)], regexpTableRules(d.tableRegexpRules)...)
+	matched = append(matched, d.schemaRules...)
+	matched = append(matched, regexpTableRules(d.schemaRegexpRules)...)
+	matched = append(matched, d.hiddenRules...)
+	for _, rule := range matched {
+		if rule != e.Rule && !containsRule(e.Conflicts, rule) {
+			e.Overridden = append(e.Overridden, rule)
+		}
+	}
+
+	switch {
+	case len(e.Conflicts) != 0:
+		e.Reason = fmt.Sprintf("%d %s rules match in the same level, they conflict with each other", len(e.Conflicts), d.level)
+		return e, nil
+	case e.Rule == nil:
+		e.Reason = "no rule matches, the schema/table is not routed"
+		if len(e.Unsatisfied) != 0 {
+			e.Reason += fmt.Sprintf(", %d matched rules are skipped by their attribute predicates", len(e.Unsatisfied))
+		}
+	default:
+		e.Reason = fmt.Sprintf("matched by the %s rule", strings.Replace(e.MatchedBy, "-", " ", 1))
+		if len(e.Rule.SourceInstance) != 0 {
+			e.Reason += fmt.Sprintf(" of source instance %s", e.Rule.SourceInstance)
+		}
+		if len(e.Overridden) != 0 {
+			e.Reason += fmt.Sprintf(", which has higher priority than the other %d matched rules", len(e.Overridden))
+		}
+	}
+
+	e.TargetSchema, e.TargetTable, e.Columns = d.target(schema, table)
+	return e, nil
+}
+
+func regexpTableRules(rules []*regexpRule) []*TableRule {
+	tableRules := make([]*TableRule, 0, len(rules))
+	for _, rule := range rules {
+		tableRules = append(tableRules, rule.TableRule)
+	}
+	return tableRules
+}
+
+func containsRule(rules []*TableRule, rule *TableRule) bool {
+	for _, r := range rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// ExplainReport is the explanations of a list of tables.
+type ExplainReport struct {
+	Explanations []*Explanation `json:"explanations"`
+	// the tables not matched by any rule
+	Unmatched []*filter.Table `json:"unmatched,omitempty"`
+	// the explanations of the tables matched by the conflicting rules
+	Conflicts []*Explanation `json:"conflicts,omitempty"`
+	// the rules which don't route any of the tables, they may be mistyped or overridden by other rules
+	UnusedRules []*TableRule `json:"unused-rules,omitempty"`
+}
+
+// ExplainTables explains how the tables of the source instance are routed, and reports the unmatched tables, the
+// conflicting rules and the unused rules. it's used to debug a large rule set against the real tables.
+func (r *Table) ExplainTables(instance string, tables []*filter.Table) (*ExplainReport, error) {
+	report := &ExplainReport{
+		Explanations: make([]*Explanation, 0, len(tables)),
+	}
+	used := make(map[*TableRule]struct{})
+	for _, table := range tables {
+		e, err := r.explain(instance, table.Schema, table.Name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		report.Explanations = append(report.Explanations, e)
+
+		switch {
+		case len(e.Conflicts) != 0:
+			report.Conflicts = append(report.Conflicts, e)
+			for _, rule := range e.Conflicts {
+				used[rule] = struct{}{}
+			}
+		case e.Rule == nil:
+			report.Unmatched = append(report.Unmatched, table)
+		default:
+			used[e.Rule] = struct{}{}
+		}
+	}
+
+	for _, rule := range r.allRules(instance) {
+		if _, ok := used[rule]; !ok {
+			report.UnusedRules = append(report.UnusedRules, rule)
+		}
+	}
+	return report, nil
+}
+
+// allRules returns the rules which may route the tables of the source instance, sorted by the instance, the schema and
+// the table.
+func (r *Table) allRules(instance string) []*TableRule {
+	selectors := []selector.Selector{r.Selector}
+
+	r.mu.RLock()
+	if s, ok := r.instanceSelectors[instance]; ok && len(instance) != 0 {
+		selectors = append(selectors, s)
+	}
+	rules := regexpTableRules(r.regexpRules[""])
+	if len(instance) != 0 {
+		rules = append(rules, regexpTableRules(r.regexpRules[instance])...)
+	}
+	r.mu.RUnlock()
+
+	for _, s := range selectors {
+		schemaRules, tableRules := s.AllRules()
+		for _, rule := range schemaRules {
+			if rule, ok := rule.(*TableRule); ok {
+				rules = append(rules, rule)
+			}
+		}
+		for _, rs := range tableRules {
+			for _, rule := range rs {
+				if rule, ok := rule.(*TableRule); ok {
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		ri, rj := rules[i], rules[j]
+		if ri.SourceInstance != rj.SourceInstance {
+			return ri.SourceInstance < rj.SourceInstance
+		}
+		if ri.SchemaPattern+ri.SchemaRegexp != rj.SchemaPattern+rj.SchemaRegexp {
+			return ri.SchemaPattern+ri.SchemaRegexp < rj.SchemaPattern+rj.SchemaRegexp
+		}
+		return ri.TablePattern+ri.TableRegexp < rj.TablePattern+rj.TableRegexp
+	})
+	return rules
+}
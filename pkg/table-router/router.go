@@ -14,9 +14,13 @@
 package router
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/filter"
 	"github.com/pingcap/tidb-tools/pkg/table-rule-selector"
 )
 
@@ -27,21 +31,78 @@ type TableRule struct {
 	TablePattern  string `json:"table-pattern" toml:"table-pattern" yaml:"table-pattern"`
 	TargetSchema  string `json:"target-schema" toml:"target-schema" yaml:"target-schema"`
 	TargetTable   string `json:"target-table" toml:"target-table" yaml:"target-table"`
+	// the rule only routes the tables of this source instance, for example the shards with the same schema/table name
+	// in different instances. the rule routes the tables of all the instances if is empty.
+	SourceInstance string `json:"source-instance" toml:"source-instance" yaml:"source-instance"`
+
+	// the regular expressions match the whole schema/table instead of the patterns, the target schema/table and the
+	// extracted columns can refer the capture groups like `$1` or `${name}`, the groups are numbered in the schema
+	// regexp then the table regexp. the rule is schema level if the table regexp is empty.
+	SchemaRegexp string `json:"schema-regexp" toml:"schema-regexp" yaml:"schema-regexp"`
+	TableRegexp  string `json:"table-regexp" toml:"table-regexp" yaml:"table-regexp"`
+	// the values of the columns extracted from the schema/table by the regexps, keyed by the target column,
+	// for example {"shard_id": "$1"} extracts the shard id of `t_(\d+)`.
+	ExtractColumns map[string]string `json:"extract-columns" toml:"extract-columns" yaml:"extract-columns"`
+
+	// the rule only routes the tables having the attributes if it's not nil, the attributes of the tables are set by
+	// the router's SetTableAttributes.
+	Attributes *AttributePredicate `json:"attributes" toml:"attributes" yaml:"attributes"`
 }
 
 // Valid checks validity of rule
 func (t *TableRule) Valid() error {
-	if len(t.SchemaPattern) == 0 {
-		return errors.New("schema pattern of table route rule should not be empty")
+	if t.isRegexp() {
+		if len(t.SchemaPattern) != 0 || len(t.TablePattern) != 0 {
+			return errors.New("schema/table pattern and regexp of table route rule can't be used together")
+		}
+		if len(t.SchemaRegexp) == 0 {
+			return errors.New("schema regexp of table route rule should not be empty")
+		}
+		if _, err := t.compile(false); err != nil {
+			return errors.Annotate(err, "regexp of table route rule is invalid")
+		}
+	} else {
+		if len(t.SchemaPattern) == 0 {
+			return errors.New("schema pattern of table route rule should not be empty")
+		}
+		if len(t.ExtractColumns) != 0 {
+			return errors.New("extract columns of table route rule only can be used with the regexps")
+		}
 	}
 
 	if len(t.TargetSchema) == 0 {
 		return errors.New("target schema of table route rule should not be empty")
 	}
 
+	if t.Attributes != nil {
+		if err := t.Attributes.Valid(); err != nil {
+			return errors.Annotate(err, "attributes of table route rule is invalid")
+		}
+	}
+
 	return nil
 }
 
+// isRegexp returns true if the rule matches the schema/table by the regexps.
+func (t *TableRule) isRegexp() bool {
+	return len(t.SchemaRegexp) != 0 || len(t.TableRegexp) != 0
+}
+
+// compile compiles the regexps to one regexp matching the schema and table joined by '\x00', so the capture groups
+// are numbered in the schema regexp then the table regexp.
+func (t *TableRule) compile(caseSensitive bool) (*regexp.Regexp, error) {
+	expr := fmt.Sprintf("^(?:%s)$", t.SchemaRegexp)
+	if len(t.TableRegexp) != 0 {
+		expr = fmt.Sprintf("^(?:%s)\x00(?:%s)$", t.SchemaRegexp, t.TableRegexp)
+	}
+	if !caseSensitive {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	return re, errors.Trace(err)
+}
+
 // ToLower covert schema/table parttern to lower case
 func (t *TableRule) ToLower() {
 	t.SchemaPattern = strings.ToLower(t.SchemaPattern)
@@ -50,16 +111,28 @@ func (t *TableRule) ToLower() {
 
 // Table routes schema/table to target schema/table by given route rules
 type Table struct {
+	// the rules of all the source instances
 	selector.Selector
 
+	mu sync.RWMutex
+	// the rules of the specified source instances, keyed by the instance
+	instanceSelectors map[string]selector.Selector
+	// the regexp rules in the order of adding, keyed by the source instance, empty instance means all the instances
+	regexpRules map[string][]*regexpRule
+	// the tables' attributes matched by the rules' attribute predicates, keyed by the source instance
+	tableAttributes map[string]map[filter.Table]*filter.TableAttributes
+
 	caseSensitive bool
 }
 
 // NewTableRouter returns a table router
 func NewTableRouter(caseSensitive bool, rules []*TableRule) (*Table, error) {
 	r := &Table{
-		Selector:      selector.NewTrieSelector(),
-		caseSensitive: caseSensitive,
+		Selector:          selector.NewTrieSelector(),
+		instanceSelectors: make(map[string]selector.Selector),
+		regexpRules:       make(map[string][]*regexpRule),
+		tableAttributes:   make(map[string]map[filter.Table]*filter.TableAttributes),
+		caseSensitive:     caseSensitive,
 	}
 
 	for _, rule := range rules {
@@ -77,11 +150,14 @@ func (r *Table) AddRule(rule *TableRule) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if rule.isRegexp() {
+		return errors.Trace(r.insertRegexpRule(rule, false))
+	}
 	if !r.caseSensitive {
 		rule.ToLower()
 	}
 
-	err = r.Insert(rule.SchemaPattern, rule.TablePattern, rule, false)
+	err = r.selector(rule.SourceInstance, true).Insert(rule.SchemaPattern, rule.TablePattern, rule, false)
 	if err != nil {
 		return errors.Annotatef(err, "add rule %+v into table router", rule)
 	}
@@ -95,11 +171,14 @@ func (r *Table) UpdateRule(rule *TableRule) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if rule.isRegexp() {
+		return errors.Trace(r.insertRegexpRule(rule, true))
+	}
 	if !r.caseSensitive {
 		rule.ToLower()
 	}
 
-	err = r.Insert(rule.SchemaPattern, rule.TablePattern, rule, true)
+	err = r.selector(rule.SourceInstance, true).Insert(rule.SchemaPattern, rule.TablePattern, rule, true)
 	if err != nil {
 		return errors.Annotatef(err, "update rule %+v into table router", rule)
 	}
@@ -109,11 +188,18 @@ func (r *Table) UpdateRule(rule *TableRule) error {
 
 // RemoveRule removes a rule from table router
 func (r *Table) RemoveRule(rule *TableRule) error {
+	if rule.isRegexp() {
+		return errors.Trace(r.removeRegexpRule(rule))
+	}
 	if !r.caseSensitive {
 		rule.ToLower()
 	}
 
-	err := r.Remove(rule.SchemaPattern, rule.TablePattern)
+	s := r.selector(rule.SourceInstance, false)
+	if s == nil {
+		return errors.NotFoundf("rules of source instance %s", rule.SourceInstance)
+	}
+	err := s.Remove(rule.SchemaPattern, rule.TablePattern)
 	if err != nil {
 		return errors.Annotatef(err, "remove rule %+v", rule)
 	}
@@ -121,61 +207,335 @@ func (r *Table) RemoveRule(rule *TableRule) error {
 	return nil
 }
 
+// selector returns the selector of the source instance's rules, the rules of all the instances if instance is empty.
+// creates it if not exists and create is true, otherwise returns nil.
+func (r *Table) selector(instance string, create bool) selector.Selector {
+	if len(instance) == 0 {
+		return r.Selector
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.instanceSelectors[instance]
+	if !ok && create {
+		s = selector.NewTrieSelector()
+		r.instanceSelectors[instance] = s
+	}
+	return s
+}
+
+// regexpRule is a TableRule matching the schema/table by the compiled regexps.
+type regexpRule struct {
+	*TableRule
+	re *regexp.Regexp
+}
+
+// match returns the indexes of the matched capture groups like regexp's FindStringSubmatchIndex, and the matched
+// string, returns nil if the schema/table is not matched.
+func (r *regexpRule) match(schema, table string) ([]int, string) {
+	s := schema
+	if len(r.TableRegexp) != 0 {
+		if len(table) == 0 {
+			return nil, ""
+		}
+		s = schema + "\x00" + table
+	}
+	return r.re.FindStringSubmatchIndex(s), s
+}
+
+// expand replaces the capture groups in the template by the matched values.
+func (r *regexpRule) expand(template string, s string, match []int) string {
+	return string(r.re.ExpandString(nil, template, s, match))
+}
+
+func (r *Table) insertRegexpRule(rule *TableRule, update bool) error {
+	re, err := rule.compile(r.caseSensitive)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rules := r.regexpRules[rule.SourceInstance]
+	for i, existing := range rules {
+		if existing.SchemaRegexp == rule.SchemaRegexp && existing.TableRegexp == rule.TableRegexp {
+			if !update {
+				return errors.AlreadyExistsf("rule %+v", rule)
+			}
+			rules[i] = &regexpRule{TableRule: rule, re: re}
+			return nil
+		}
+	}
+	if update {
+		return errors.NotFoundf("rule %+v", rule)
+	}
+
+	r.regexpRules[rule.SourceInstance] = append(rules, &regexpRule{TableRule: rule, re: re})
+	return nil
+}
+
+func (r *Table) removeRegexpRule(rule *TableRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rules := r.regexpRules[rule.SourceInstance]
+	for i, existing := range rules {
+		if existing.SchemaRegexp == rule.SchemaRegexp && existing.TableRegexp == rule.TableRegexp {
+			r.regexpRules[rule.SourceInstance] = append(rules[:i:i], rules[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.NotFoundf("rule %+v", rule)
+}
+
+// matchRegexpRules returns all the matched regexp rules in the order of the priority, the rules of the instance are
+// matched before the rules of all the instances.
+func (r *Table) matchRegexpRules(instance, schema, table string) []*regexpRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rules := r.regexpRules[instance]
+	if len(instance) != 0 {
+		rules = append(rules[:len(rules):len(rules)], r.regexpRules[""]...)
+	}
+	matched := make([]*regexpRule, 0, 1)
+	for _, rule := range rules {
+		if match, _ := rule.match(schema, table); match != nil {
+			matched = append(matched, rule)
+		}
+	}
+
+	return matched
+}
+
 // Route routes schema/table to target schema/table
 // don't support to route schema/table to multiple schema/table
 func (r *Table) Route(schema, table string) (string, string, error) {
+	return r.RouteWithInstance("", schema, table)
+}
+
+// RouteWithInstance routes schema/table of the source instance to target schema/table like Route,
+// the rules of the instance have higher priority than the rules of all the instances in the same level.
+func (r *Table) RouteWithInstance(instance, schema, table string) (string, string, error) {
+	targetSchema, targetTable, _, err := r.route(instance, schema, table)
+	return targetSchema, targetTable, errors.Trace(err)
+}
+
+// ExtractColumns returns the values of the columns extracted from schema/table of the source instance by the matched
+// regexp rule, returns nil if the schema/table is not routed by a regexp rule with extract columns.
+func (r *Table) ExtractColumns(instance, schema, table string) (map[string]string, error) {
+	_, _, columns, err := r.route(instance, schema, table)
+	return columns, errors.Trace(err)
+}
+
+// route returns the target schema/table and the extracted columns. the table level rules have higher priority than
+// the schema level rules, and the pattern rules have higher priority than the regexp rules in the same level.
+func (r *Table) route(instance, schema, table string) (string, string, map[string]string, error) {
+	d, err := r.decide(instance, schema, table)
+	if err != nil {
+		return "", "", nil, errors.Trace(err)
+	}
+	if len(d.conflicts) != 0 {
+		return "", "", nil, errors.NotSupportedf("route %s/%s to rule set(%d)", schema, table, len(d.conflicts))
+	}
+
+	targetSchema, targetTable, columns := d.target(schema, table)
+	return targetSchema, targetTable, columns, nil
+}
+
+// decision is the matched rules of a schema/table classified by the levels, and the rule chosen to route it.
+// it's shared by route and explain, explain builds the explanation from it.
+type decision struct {
+	tableRules        []*TableRule
+	tableRegexpRules  []*regexpRule
+	schemaRules       []*TableRule
+	schemaRegexpRules []*regexpRule
+	// the rules of all the instances hidden by the rules of the instance in the same level
+	hiddenRules []*TableRule
+	// the rules matched by the schema/table, but the table's attributes don't satisfy their attribute predicates
+	unsatisfied []*TableRule
+
+	// the rule which routes the schema/table, regexpRule is also set if it's a regexp rule
+	rule       *TableRule
+	regexpRule *regexpRule
+	matchedBy  string
+	// the matched rules in the highest matched level if there are more than one, and the level
+	conflicts []*TableRule
+	level     string
+}
+
+// decide matches the rules of the source instance, and chooses the rule in the highest matched level, in the order of
+// table pattern, table regexp, schema pattern and schema regexp. the matched rules conflict if there are more than one
+// in the level.
+func (r *Table) decide(instance, schema, table string) (decision, error) {
+	var d decision
 	schemaL, tableL := schema, table
 	if !r.caseSensitive {
 		schemaL, tableL = strings.ToLower(schema), strings.ToLower(table)
 	}
 
-	rules := r.Match(schemaL, tableL)
-	var (
-		schemaRules = make([]*TableRule, 0, len(rules))
-		tableRules  = make([]*TableRule, 0, len(rules))
-	)
-	// classify rules into schema level rules and table level
-	// table level rules have highest priority
-	for i := range rules {
-		rule, ok := rules[i].(*TableRule)
-		if !ok {
-			return "", "", errors.NotValidf("table route rule %+v", rules[i])
+	// the rules matched by the names are skipped if the table's attributes don't satisfy them
+	satisfied := func(rules []*TableRule) []*TableRule {
+		kept := rules[:0]
+		for _, rule := range rules {
+			if r.satisfy(rule, instance, schema, table) {
+				kept = append(kept, rule)
+			} else {
+				d.unsatisfied = append(d.unsatisfied, rule)
+			}
+		}
+		return kept
+	}
+	match := func(s selector.Selector) ([]*TableRule, []*TableRule, error) {
+		schemaRules, tableRules, err := classifyRules(s.Match(schemaL, tableL))
+		if err != nil {
+			return nil, nil, errors.Trace(err)
 		}
+		if len(table) == 0 {
+			tableRules = nil
+		}
+		return satisfied(schemaRules), satisfied(tableRules), nil
+	}
 
-		if len(rule.TablePattern) == 0 {
-			schemaRules = append(schemaRules, rule)
-		} else {
-			tableRules = append(tableRules, rule)
+	var err error
+	d.schemaRules, d.tableRules, err = match(r.Selector)
+	if err != nil {
+		return d, errors.Trace(err)
+	}
+	if len(instance) != 0 {
+		r.mu.RLock()
+		s, ok := r.instanceSelectors[instance]
+		r.mu.RUnlock()
+		if ok {
+			instanceSchemaRules, instanceTableRules, err := match(s)
+			if err != nil {
+				return d, errors.Trace(err)
+			}
+			if len(instanceSchemaRules) != 0 {
+				d.hiddenRules = append(d.hiddenRules, d.schemaRules...)
+				d.schemaRules = instanceSchemaRules
+			}
+			if len(instanceTableRules) != 0 {
+				d.hiddenRules = append(d.hiddenRules, d.tableRules...)
+				d.tableRules = instanceTableRules
+			}
 		}
 	}
 
-	var (
-		targetSchema string
-		targetTable  string
-	)
-	if len(table) == 0 || len(tableRules) == 0 {
-		if len(schemaRules) > 1 {
-			return "", "", errors.NotSupportedf("route %s/%s to rule set(%d)", schema, table, len(schemaRules))
+	for _, rule := range r.matchRegexpRules(instance, schema, table) {
+		switch {
+		case !r.satisfy(rule.TableRule, instance, schema, table):
+			d.unsatisfied = append(d.unsatisfied, rule.TableRule)
+		case len(rule.TableRegexp) == 0:
+			d.schemaRegexpRules = append(d.schemaRegexpRules, rule)
+		default:
+			d.tableRegexpRules = append(d.tableRegexpRules, rule)
 		}
+	}
+	d.tableRegexpRules = d.hideRegexpRules(d.tableRegexpRules)
+	d.schemaRegexpRules = d.hideRegexpRules(d.schemaRegexpRules)
 
-		if len(schemaRules) == 1 {
-			targetSchema, targetTable = schemaRules[0].TargetSchema, schemaRules[0].TargetTable
+	switch {
+	case len(d.tableRules) > 1:
+		d.conflicts, d.level = d.tableRules, "table pattern"
+	case len(d.tableRules) == 1:
+		d.rule, d.matchedBy = d.tableRules[0], MatchedByTablePattern
+	case len(d.tableRegexpRules) > 1:
+		d.conflicts, d.level = regexpTableRules(d.tableRegexpRules), "table regexp"
+	case len(d.tableRegexpRules) == 1:
+		d.regexpRule, d.matchedBy = d.tableRegexpRules[0], MatchedByTableRegexp
+	case len(d.schemaRules) > 1:
+		d.conflicts, d.level = d.schemaRules, "schema pattern"
+	case len(d.schemaRules) == 1:
+		d.rule, d.matchedBy = d.schemaRules[0], MatchedBySchemaPattern
+	case len(d.schemaRegexpRules) > 1:
+		d.conflicts, d.level = regexpTableRules(d.schemaRegexpRules), "schema regexp"
+	case len(d.schemaRegexpRules) == 1:
+		d.regexpRule, d.matchedBy = d.schemaRegexpRules[0], MatchedBySchemaRegexp
+	}
+	if d.regexpRule != nil {
+		d.rule = d.regexpRule.TableRule
+	}
+
+	return d, nil
+}
+
+// hideRegexpRules returns the matched regexp rules of the instance if any, the rules of all the instances are hidden
+// by them like the pattern rules. the rules of the instance are matched before the rules of all the instances.
+func (d *decision) hideRegexpRules(rules []*regexpRule) []*regexpRule {
+	for i, rule := range rules {
+		if len(rule.SourceInstance) != 0 {
+			continue
 		}
-	} else {
-		if len(tableRules) > 1 {
-			return "", "", errors.NotSupportedf("route %s/%s to rule set(%d)", schema, table, len(tableRules))
+		if i == 0 {
+			return rules
 		}
+		d.hiddenRules = append(d.hiddenRules, regexpTableRules(rules[i:])...)
+		return rules[:i]
+	}
+	return rules
+}
 
-		targetSchema, targetTable = tableRules[0].TargetSchema, tableRules[0].TargetTable
+// target returns the target schema/table and the extracted columns of the chosen rule, the target schema/table is
+// same as the schema/table if no rule matches.
+func (d *decision) target(schema, table string) (string, string, map[string]string) {
+	var (
+		targetSchema, targetTable string
+		columns                   map[string]string
+	)
+	switch {
+	case d.regexpRule != nil:
+		targetSchema, targetTable, columns = d.regexpRule.route(schema, table)
+	case d.rule != nil:
+		targetSchema, targetTable = d.rule.TargetSchema, d.rule.TargetTable
 	}
 
 	if len(targetSchema) == 0 {
 		targetSchema = schema
 	}
-
 	if len(targetTable) == 0 {
 		targetTable = table
 	}
+	return targetSchema, targetTable, columns
+}
+
+// route returns the target schema/table and the extracted columns with the capture groups replaced, the schema/table
+// must be matched by the rule.
+func (r *regexpRule) route(schema, table string) (string, string, map[string]string) {
+	match, s := r.match(schema, table)
+	var columns map[string]string
+	if len(r.ExtractColumns) != 0 {
+		columns = make(map[string]string, len(r.ExtractColumns))
+		for column, template := range r.ExtractColumns {
+			columns[column] = r.expand(template, s, match)
+		}
+	}
+
+	return r.expand(r.TargetSchema, s, match), r.expand(r.TargetTable, s, match), columns
+}
+
+// classifyRules classifies rules into schema level rules and table level
+// table level rules have highest priority
+func classifyRules(rules selector.RuleSet) ([]*TableRule, []*TableRule, error) {
+	var (
+		schemaRules = make([]*TableRule, 0, len(rules))
+		tableRules  = make([]*TableRule, 0, len(rules))
+	)
+	for i := range rules {
+		rule, ok := rules[i].(*TableRule)
+		if !ok {
+			return nil, nil, errors.NotValidf("table route rule %+v", rules[i])
+		}
+
+		if len(rule.TablePattern) == 0 {
+			schemaRules = append(schemaRules, rule)
+		} else {
+			tableRules = append(tableRules, rule)
+		}
+	}
 
-	return targetSchema, targetTable, nil
+	return schemaRules, tableRules, nil
 }
@@ -17,6 +17,7 @@ import (
 	"testing"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/filter"
 )
 
 func TestClient(t *testing.T) {
@@ -29,11 +30,11 @@ type testRouterSuite struct{}
 
 func (t *testRouterSuite) TestRoute(c *C) {
 	rules := []*TableRule{
-		{"Test_1_*", "abc*", "t1", "abc"},
-		{"test_1_*", "test*", "t2", "test"},
-		{"test_1_*", "", "test", ""},
-		{"test_2_*", "abc*", "t1", "abc"},
-		{"test_2_*", "test*", "t2", "test"},
+		{SchemaPattern: "Test_1_*", TablePattern: "abc*", TargetSchema: "t1", TargetTable: "abc"},
+		{SchemaPattern: "test_1_*", TablePattern: "test*", TargetSchema: "t2", TargetTable: "test"},
+		{SchemaPattern: "test_1_*", TargetSchema: "test"},
+		{SchemaPattern: "test_2_*", TablePattern: "abc*", TargetSchema: "t1", TargetTable: "abc"},
+		{SchemaPattern: "test_2_*", TablePattern: "test*", TargetSchema: "t2", TargetTable: "test"},
 	}
 
 	cases := [][]string{
@@ -91,12 +92,12 @@ func (t *testRouterSuite) TestRoute(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(schema, Equals, "test_3_a")
 	// test multiple schema level rules
-	err = router.AddRule(&TableRule{"test_*", "", "error", ""})
+	err = router.AddRule(&TableRule{SchemaPattern: "test_*", TargetSchema: "error"})
 	c.Assert(err, IsNil)
 	_, _, err = router.Route("test_1_a", "")
 	c.Assert(err, NotNil)
 	// test multiple table level rules
-	err = router.AddRule(&TableRule{"test_1_*", "tes*", "error", "error"})
+	err = router.AddRule(&TableRule{SchemaPattern: "test_1_*", TablePattern: "tes*", TargetSchema: "error", TargetTable: "error"})
 	c.Assert(err, IsNil)
 	_, _, err = router.Route("test_1_a", "test")
 	c.Assert(err, NotNil)
@@ -120,11 +121,11 @@ func (t *testRouterSuite) TestRoute(c *C) {
 func (t *testRouterSuite) TestCaseSensitive(c *C) {
 	// we test case insensitive in TestRoute
 	rules := []*TableRule{
-		{"Test_1_*", "abc*", "t1", "abc"},
-		{"test_1_*", "test*", "t2", "test"},
-		{"test_1_*", "", "test", ""},
-		{"test_2_*", "abc*", "t1", "abc"},
-		{"test_2_*", "test*", "t2", "test"},
+		{SchemaPattern: "Test_1_*", TablePattern: "abc*", TargetSchema: "t1", TargetTable: "abc"},
+		{SchemaPattern: "test_1_*", TablePattern: "test*", TargetSchema: "t2", TargetTable: "test"},
+		{SchemaPattern: "test_1_*", TargetSchema: "test"},
+		{SchemaPattern: "test_2_*", TablePattern: "abc*", TargetSchema: "t1", TargetTable: "abc"},
+		{SchemaPattern: "test_2_*", TablePattern: "test*", TargetSchema: "t2", TargetTable: "test"},
 	}
 
 	cases := [][]string{
@@ -151,3 +152,280 @@ func (t *testRouterSuite) TestCaseSensitive(c *C) {
 		c.Assert(table, Equals, cs[3])
 	}
 }
+
+func (t *testRouterSuite) TestRouteWithInstance(c *C) {
+	rules := []*TableRule{
+		{SchemaPattern: "test_*", TablePattern: "t_*", TargetSchema: "test", TargetTable: "t"},
+		{SchemaPattern: "test_*", TargetSchema: "test"},
+		{SchemaPattern: "test_*", TablePattern: "t_*", TargetSchema: "test", TargetTable: "t_mysql2", SourceInstance: "mysql2"},
+		{SchemaPattern: "test_*", TargetSchema: "test_mysql3", SourceInstance: "mysql3"},
+	}
+
+	router, err := NewTableRouter(false, rules)
+	c.Assert(err, IsNil)
+
+	// the same patterns of different instances can be added, but not the same instance
+	err = router.AddRule(&TableRule{SchemaPattern: "test_*", TablePattern: "t_*", TargetSchema: "test", TargetTable: "t", SourceInstance: "mysql2"})
+	c.Assert(err, NotNil)
+	err = router.AddRule(&TableRule{SchemaPattern: "test_*", TablePattern: "t_*", TargetSchema: "test", TargetTable: "t_mysql4", SourceInstance: "mysql4"})
+	c.Assert(err, IsNil)
+
+	cases := [][]string{
+		{"", "test_1", "t_1", "test", "t"},
+		{"mysql1", "test_1", "t_1", "test", "t"},
+		{"mysql2", "test_1", "t_1", "test", "t_mysql2"},
+		{"mysql2", "test_1", "x", "test", "x"},
+		// the table level rules of all the instances have higher priority than the schema level rules of the instance
+		{"mysql3", "test_1", "t_1", "test", "t"},
+		{"mysql3", "test_1", "x", "test_mysql3", "x"},
+		{"mysql4", "test_1", "t_1", "test", "t_mysql4"},
+		{"mysql4", "abc", "t_1", "abc", "t_1"},
+	}
+	for _, cs := range cases {
+		schema, table, err := router.RouteWithInstance(cs[0], cs[1], cs[2])
+		c.Assert(err, IsNil)
+		c.Assert(schema, Equals, cs[3], Commentf("case %v", cs))
+		c.Assert(table, Equals, cs[4], Commentf("case %v", cs))
+	}
+
+	// Route only uses the rules of all the instances
+	schema, table, err := router.Route("test_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(schema, Equals, "test")
+	c.Assert(table, Equals, "t")
+
+	err = router.RemoveRule(rules[2])
+	c.Assert(err, IsNil)
+	err = router.RemoveRule(&TableRule{SchemaPattern: "test_*", TablePattern: "t_*", TargetSchema: "test", TargetTable: "t", SourceInstance: "mysql5"})
+	c.Assert(err, NotNil)
+	schema, table, err = router.RouteWithInstance("mysql2", "test_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(schema, Equals, "test")
+	c.Assert(table, Equals, "t")
+}
+
+func (t *testRouterSuite) TestRouteByRegexp(c *C) {
+	rules := []*TableRule{
+		{SchemaRegexp: `shard_(\d+)`, TableRegexp: `t_(?P<id>\d+)`, TargetSchema: "shard", TargetTable: "t", ExtractColumns: map[string]string{"db_id": "$1", "table_id": "${id}"}},
+		{SchemaRegexp: `shard_(\d+)`, TableRegexp: `(\w+)_bak`, TargetSchema: "bak", TargetTable: "${2}"},
+		{SchemaRegexp: `shard_(\d+)`, TargetSchema: "shard_all"},
+		{SchemaPattern: "shard_*", TablePattern: "u_*", TargetSchema: "shard", TargetTable: "u"},
+		{SchemaRegexp: `log_(\d+)`, TableRegexp: `(.*)`, TargetSchema: "log", TargetTable: "$1", ExtractColumns: map[string]string{"day": "$1"}, SourceInstance: "mysql1"},
+	}
+
+	router, err := NewTableRouter(false, rules)
+	c.Assert(err, IsNil)
+	err = router.AddRule(&TableRule{SchemaRegexp: `shard_(\d+)`, TargetSchema: "error"})
+	c.Assert(err, NotNil)
+
+	cases := []struct {
+		instance, schema, table   string
+		targetSchema, targetTable string
+		columns                   map[string]string
+	}{
+		{"", "shard_1", "t_01", "shard", "t", map[string]string{"db_id": "1", "table_id": "01"}},
+		// case insensitive, the captures keep the case
+		{"", "SHARD_2", "T_3", "shard", "t", map[string]string{"db_id": "2", "table_id": "3"}},
+		{"", "shard_1", "Orders_bak", "bak", "Orders", nil},
+		// the schema level rule
+		{"", "shard_1", "x", "shard_all", "x", nil},
+		{"", "shard_1", "", "shard_all", "", nil},
+		// the pattern rule has higher priority than the regexp rule in the same level
+		{"", "shard_1", "u_1", "shard", "u", nil},
+		// the regexps match the whole name
+		{"", "shard_1x", "t_1", "shard_1x", "t_1", nil},
+		{"", "log_20200101", "t", "log_20200101", "t", nil},
+		{"mysql1", "log_20200101", "t", "log", "20200101", map[string]string{"day": "20200101"}},
+		{"mysql1", "shard_1", "t_1", "shard", "t", map[string]string{"db_id": "1", "table_id": "1"}},
+	}
+	for _, cs := range cases {
+		schema, table, err := router.RouteWithInstance(cs.instance, cs.schema, cs.table)
+		c.Assert(err, IsNil)
+		c.Assert(schema, Equals, cs.targetSchema, Commentf("case %+v", cs))
+		c.Assert(table, Equals, cs.targetTable, Commentf("case %+v", cs))
+		columns, err := router.ExtractColumns(cs.instance, cs.schema, cs.table)
+		c.Assert(err, IsNil)
+		c.Assert(columns, DeepEquals, cs.columns, Commentf("case %+v", cs))
+	}
+
+	// update and remove the regexp rules
+	err = router.UpdateRule(&TableRule{SchemaRegexp: `shard_(\d+)`, TableRegexp: `(\w+)_bak`, TargetSchema: "bak_$1", TargetTable: "$2"})
+	c.Assert(err, IsNil)
+	schema, table, err := router.Route("shard_1", "orders_bak")
+	c.Assert(err, IsNil)
+	c.Assert(schema, Equals, "bak_1")
+	c.Assert(table, Equals, "orders")
+	err = router.RemoveRule(rules[1])
+	c.Assert(err, IsNil)
+	err = router.RemoveRule(rules[1])
+	c.Assert(err, NotNil)
+	schema, table, err = router.Route("shard_1", "orders_bak")
+	c.Assert(err, IsNil)
+	c.Assert(schema, Equals, "shard_all")
+	c.Assert(table, Equals, "orders_bak")
+
+	// invalid rules
+	invalidRules := []*TableRule{
+		{SchemaRegexp: `shard_(\d+`, TargetSchema: "shard"},
+		{TableRegexp: `t_(\d+)`, TargetSchema: "shard"},
+		{SchemaPattern: "shard_*", SchemaRegexp: `shard_(\d+)`, TargetSchema: "shard"},
+		{SchemaPattern: "shard_*", TargetSchema: "shard", ExtractColumns: map[string]string{"id": "$1"}},
+		{SchemaRegexp: `shard_(\d+)`},
+	}
+	for _, rule := range invalidRules {
+		c.Assert(router.AddRule(rule), NotNil, Commentf("rule %+v", rule))
+	}
+}
+
+func (t *testRouterSuite) TestExplain(c *C) {
+	rules := []*TableRule{
+		{SchemaPattern: "shard_*", TablePattern: "t_*", TargetSchema: "shard", TargetTable: "t"},
+		{SchemaPattern: "shard_*", TablePattern: "t_1*", TargetSchema: "shard", TargetTable: "t1"},
+		{SchemaRegexp: `shard_(\d+)`, TableRegexp: `u_(\d+)`, TargetSchema: "shard", TargetTable: "u", ExtractColumns: map[string]string{"id": "$2"}},
+		{SchemaPattern: "shard_*", TargetSchema: "shard_all"},
+		{SchemaPattern: "shard_*", TablePattern: "v_*", TargetSchema: "shard_v", SourceInstance: "mysql1"},
+		{SchemaPattern: "unused_*", TargetSchema: "unused"},
+	}
+	router, err := NewTableRouter(false, rules)
+	c.Assert(err, IsNil)
+
+	e, err := router.Explain("shard_1", "u_2")
+	c.Assert(err, IsNil)
+	c.Assert(e.Rule, Equals, rules[2])
+	c.Assert(e.MatchedBy, Equals, MatchedByTableRegexp)
+	c.Assert(e.TargetSchema, Equals, "shard")
+	c.Assert(e.TargetTable, Equals, "u")
+	c.Assert(e.Columns, DeepEquals, map[string]string{"id": "2"})
+	c.Assert(e.Overridden, DeepEquals, []*TableRule{rules[3]})
+	c.Assert(e.Reason, Equals, "matched by the table regexp rule, which has higher priority than the other 1 matched rules")
+
+	e, err = router.ExplainWithInstance("mysql1", "shard_1", "v_1")
+	c.Assert(err, IsNil)
+	c.Assert(e.Rule, Equals, rules[4])
+	c.Assert(e.MatchedBy, Equals, MatchedByTablePattern)
+	c.Assert(e.TargetSchema, Equals, "shard_v")
+	c.Assert(e.TargetTable, Equals, "v_1")
+	c.Assert(e.Reason, Equals, "matched by the table pattern rule of source instance mysql1, which has higher priority than the other 1 matched rules")
+
+	// the conflicting rules are explained instead of returning an error
+	e, err = router.Explain("shard_1", "t_10")
+	c.Assert(err, IsNil)
+	c.Assert(e.Rule, IsNil)
+	c.Assert(e.Conflicts, HasLen, 2)
+	c.Assert(e.Overridden, DeepEquals, []*TableRule{rules[3]})
+	c.Assert(e.TargetSchema, Equals, "")
+	_, _, err = router.Route("shard_1", "t_10")
+	c.Assert(err, NotNil)
+
+	e, err = router.Explain("other", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(e.Matched(), IsFalse)
+	c.Assert(e.TargetSchema, Equals, "other")
+	c.Assert(e.TargetTable, Equals, "t_1")
+
+	tables := []*filter.Table{
+		{Schema: "shard_1", Name: "t_2"},
+		{Schema: "shard_1", Name: "t_10"},
+		{Schema: "shard_1", Name: "u_1"},
+		{Schema: "other", Name: "t_1"},
+	}
+	report, err := router.ExplainTables("", tables)
+	c.Assert(err, IsNil)
+	c.Assert(report.Explanations, HasLen, 4)
+	c.Assert(report.Unmatched, DeepEquals, []*filter.Table{tables[3]})
+	c.Assert(report.Conflicts, DeepEquals, []*Explanation{report.Explanations[1]})
+	// the schema level rule is overridden by the table level rules, the rules of the other instances are not reported
+	c.Assert(report.UnusedRules, DeepEquals, []*TableRule{rules[3], rules[5]})
+
+	// the regexp rules in the same level conflict with each other too
+	regexpRules := []*TableRule{
+		{SchemaRegexp: `shard_(\d+)`, TableRegexp: `t_(\d+)`, TargetSchema: "shard", TargetTable: "t"},
+		{SchemaRegexp: `shard_.*`, TableRegexp: `t_.*`, TargetSchema: "shard", TargetTable: "t2"},
+		{SchemaRegexp: `shard_(\d+)`, TargetSchema: "shard_all"},
+		{SchemaRegexp: `shard_(\d+)`, TableRegexp: `t_(\d+)`, TargetSchema: "mysql1", TargetTable: "t", SourceInstance: "mysql1"},
+	}
+	router, err = NewTableRouter(false, regexpRules)
+	c.Assert(err, IsNil)
+	_, _, err = router.Route("shard_1", "t_1")
+	c.Assert(err, NotNil)
+	e, err = router.Explain("shard_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(e.Rule, IsNil)
+	c.Assert(e.Conflicts, DeepEquals, []*TableRule{regexpRules[0], regexpRules[1]})
+	c.Assert(e.Overridden, DeepEquals, []*TableRule{regexpRules[2]})
+	c.Assert(e.Reason, Equals, "2 table regexp rules match in the same level, they conflict with each other")
+
+	// the regexp rule of the instance hides the regexp rules of all the instances in the same level
+	schema, table, err := router.RouteWithInstance("mysql1", "shard_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(schema, Equals, "mysql1")
+	c.Assert(table, Equals, "t")
+	e, err = router.ExplainWithInstance("mysql1", "shard_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(e.Overridden, DeepEquals, []*TableRule{regexpRules[2], regexpRules[0], regexpRules[1]})
+
+	tables = []*filter.Table{
+		{Schema: "shard_1", Name: "t_1"},
+		{Schema: "shard_1", Name: "x"},
+	}
+	report, err = router.ExplainTables("", tables)
+	c.Assert(err, IsNil)
+	c.Assert(report.Conflicts, DeepEquals, []*Explanation{report.Explanations[0]})
+	c.Assert(report.UnusedRules, HasLen, 0)
+}
+
+func (t *testRouterSuite) TestRouteByAttributes(c *C) {
+	rules := []*TableRule{
+		{SchemaPattern: "shard_*", TablePattern: "t_*", TargetSchema: "shard", TargetTable: "t", Attributes: &AttributePredicate{Columns: []string{"shard_id"}}},
+		{SchemaRegexp: `shard_(\d+)`, TableRegexp: `t_(\d+)`, TargetSchema: "tagged", TargetTable: "t", Attributes: &AttributePredicate{CommentTag: "shard:orders"}},
+		{SchemaPattern: "shard_*", TargetSchema: "shard_all"},
+	}
+	router, err := NewTableRouter(false, rules)
+	c.Assert(err, IsNil)
+	c.Assert(router.HasAttributeRules(), IsTrue)
+
+	// the tables with unknown attributes don't satisfy the predicates
+	schema, table, err := router.Route("shard_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(schema, Equals, "shard_all")
+	c.Assert(table, Equals, "t_1")
+
+	router.SetTableAttributes("", map[filter.Table]*filter.TableAttributes{
+		{Schema: "shard_1", Name: "t_1"}: {Columns: []string{"id", "SHARD_ID"}},
+		{Schema: "shard_1", Name: "t_2"}: {Columns: []string{"id"}, Comment: "partitioned by shard:orders"},
+		{Schema: "shard_1", Name: "t_3"}: {Columns: []string{"id"}},
+	})
+	cases := [][]string{
+		{"shard_1", "t_1", "shard", "t"},
+		{"shard_1", "t_2", "tagged", "t"},
+		{"shard_1", "t_3", "shard_all", "t_3"},
+		{"shard_1", "", "shard_all", ""},
+	}
+	for _, cs := range cases {
+		schema, table, err = router.Route(cs[0], cs[1])
+		c.Assert(err, IsNil)
+		c.Assert(schema, Equals, cs[2])
+		c.Assert(table, Equals, cs[3])
+	}
+
+	// the attributes of the other instances are not used
+	schema, _, err = router.RouteWithInstance("mysql1", "shard_1", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(schema, Equals, "shard_all")
+
+	e, err := router.Explain("shard_1", "t_3")
+	c.Assert(err, IsNil)
+	c.Assert(e.Rule, Equals, rules[2])
+	c.Assert(e.Unsatisfied, DeepEquals, []*TableRule{rules[0], rules[1]})
+
+	e, err = router.Explain("shard_2", "t_1")
+	c.Assert(err, IsNil)
+	c.Assert(e.Reason, Equals, "matched by the schema pattern rule")
+
+	router, err = NewTableRouter(false, rules[2:])
+	c.Assert(err, IsNil)
+	c.Assert(router.HasAttributeRules(), IsFalse)
+
+	rule := &TableRule{SchemaPattern: "shard_*", TargetSchema: "shard", Attributes: &AttributePredicate{}}
+	c.Assert(rule.Valid(), NotNil)
+}
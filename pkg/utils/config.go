@@ -0,0 +1,193 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+)
+
+// SecretMask replaces the values of the secrets when the config is printed.
+const SecretMask = "******"
+
+// the keys containing these words are secrets
+var secretWords = []string{"password", "passwd", "secret", "token"}
+
+// ConfigBinder binds the command line flags, the environment variables and the config file to the config of a tool
+// binary. the precedence is command line flag > environment variable > config file > flag's default value.
+type ConfigBinder struct {
+	fs *flag.FlagSet
+	// the environment variable of a flag is the prefix followed by the upper case flag name with '-' replaced by '_',
+	// for example "SYNC_DIFF_CHUNK_SIZE" for the flag "chunk-size" with prefix "SYNC_DIFF_".
+	envPrefix string
+
+	// the path of the config file set by the flag, the file is decoded into config as TOML
+	configFile *string
+	config     interface{}
+
+	printVersion *bool
+	app          string
+
+	validators []func() error
+}
+
+// NewConfigBinder returns a ConfigBinder of the flags, the environment variables are not bound if envPrefix is empty.
+func NewConfigBinder(fs *flag.FlagSet, envPrefix string) *ConfigBinder {
+	return &ConfigBinder{
+		fs:        fs,
+		envPrefix: envPrefix,
+	}
+}
+
+// WithConfigFile decodes the TOML file in the path into config, path is usually bound to the "config" flag.
+func (b *ConfigBinder) WithConfigFile(path *string, config interface{}) *ConfigBinder {
+	b.configFile = path
+	b.config = config
+	return b
+}
+
+// WithVersion prints the version of the app and returns flag.ErrHelp when parsing if printVersion is set true by the
+// flags.
+func (b *ConfigBinder) WithVersion(printVersion *bool, app string) *ConfigBinder {
+	b.printVersion = printVersion
+	b.app = app
+	return b
+}
+
+// AddValidator adds a hook to validate the config after all the sources are parsed, the hooks are called in order.
+func (b *ConfigBinder) AddValidator(validate func() error) *ConfigBinder {
+	b.validators = append(b.validators, validate)
+	return b
+}
+
+// EnvName returns the name of the environment variable bound to the flag.
+func (b *ConfigBinder) EnvName(flagName string) string {
+	return b.envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// Parse parses the flags in arguments, the environment variables and the config file, then validates the config.
+func (b *ConfigBinder) Parse(arguments []string) error {
+	// parse first to get the config file
+	if err := b.fs.Parse(arguments); err != nil {
+		return errors.Trace(err)
+	}
+
+	if b.printVersion != nil && *b.printVersion {
+		fmt.Print(GetRawInfo(b.app))
+		return flag.ErrHelp
+	}
+
+	if b.configFile != nil && len(*b.configFile) != 0 {
+		if _, err := toml.DecodeFile(*b.configFile, b.config); err != nil {
+			return errors.Annotatef(err, "load config file %s", *b.configFile)
+		}
+	}
+
+	if err := b.bindEnv(); err != nil {
+		return errors.Trace(err)
+	}
+
+	// parse again to replace with the command line options
+	if err := b.fs.Parse(arguments); err != nil {
+		return errors.Trace(err)
+	}
+	if len(b.fs.Args()) != 0 {
+		return errors.Errorf("'%s' is an invalid flag", b.fs.Arg(0))
+	}
+
+	for _, validate := range b.validators {
+		if err := validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// bindEnv sets the flags by the environment variables.
+func (b *ConfigBinder) bindEnv() error {
+	if len(b.envPrefix) == 0 {
+		return nil
+	}
+
+	var err error
+	b.fs.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		name := b.EnvName(f.Name)
+		if value, ok := os.LookupEnv(name); ok {
+			if err1 := b.fs.Set(f.Name, value); err1 != nil {
+				err = errors.Annotatef(err1, "invalid environment variable %s", name)
+			}
+		}
+	})
+	return errors.Trace(err)
+}
+
+// IsSecretKey returns true if the config key looks like a secret, for example "password" or "access-token".
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range secretWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskSecrets returns the config's JSON with the values of the secret keys replaced by SecretMask, it's used to print
+// the config into the logs. the references to the secrets like "env:VAR_NAME" and "file:/path" are kept.
+func MaskSecrets(config interface{}) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Sprintf("<marshal config failed: %v>", err)
+	}
+	var value interface{}
+	if err = json.Unmarshal(data, &value); err != nil {
+		return fmt.Sprintf("<unmarshal config failed: %v>", err)
+	}
+
+	data, err = json.Marshal(maskSecrets(value))
+	if err != nil {
+		return fmt.Sprintf("<marshal config failed: %v>", err)
+	}
+	return string(data)
+}
+
+func maskSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok && IsSecretKey(key) {
+				if len(s) != 0 && !strings.HasPrefix(s, "env:") && !strings.HasPrefix(s, "file:") {
+					v[key] = SecretMask
+				}
+				continue
+			}
+			v[key] = maskSecrets(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = maskSecrets(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+var _ = Suite(&testConfigSuite{})
+
+type testConfigSuite struct{}
+
+type testConfig struct {
+	*flag.FlagSet `json:"-"`
+
+	ConfigFile string `toml:"-" json:"-"`
+	Host       string `toml:"host" json:"host"`
+	Port       int    `toml:"port" json:"port"`
+	User       string `toml:"user" json:"user"`
+	Password   string `toml:"password" json:"password"`
+	Verbose    bool   `toml:"verbose" json:"verbose"`
+}
+
+func newTestConfig() *testConfig {
+	cfg := &testConfig{}
+	cfg.FlagSet = flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.StringVar(&cfg.ConfigFile, "config", "", "")
+	cfg.StringVar(&cfg.Host, "host", "127.0.0.1", "")
+	cfg.IntVar(&cfg.Port, "port", 3306, "")
+	cfg.StringVar(&cfg.User, "user", "root", "")
+	cfg.StringVar(&cfg.Password, "password", "", "")
+	cfg.BoolVar(&cfg.Verbose, "verbose", false, "")
+	return cfg
+}
+
+func (t *testConfigSuite) TestConfigBinder(c *C) {
+	dir, err := ioutil.TempDir("", "config")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	err = ioutil.WriteFile(path, []byte("host = \"10.0.0.1\"\nport = 4000\nuser = \"test\"\n"), 0644)
+	c.Assert(err, IsNil)
+
+	os.Setenv("UTILS_TEST_PORT", "4001")
+	os.Setenv("UTILS_TEST_USER", "env")
+	defer os.Unsetenv("UTILS_TEST_PORT")
+	defer os.Unsetenv("UTILS_TEST_USER")
+
+	// flag > environment variable > config file > default value
+	cfg := newTestConfig()
+	validated := false
+	binder := NewConfigBinder(cfg.FlagSet, "UTILS_TEST_").WithConfigFile(&cfg.ConfigFile, cfg).AddValidator(func() error {
+		validated = true
+		return nil
+	})
+	c.Assert(binder.EnvName("config-file"), Equals, "UTILS_TEST_CONFIG_FILE")
+	err = binder.Parse([]string{"-config", path, "-user", "flag"})
+	c.Assert(err, IsNil)
+	c.Assert(validated, IsTrue)
+	c.Assert(cfg.Host, Equals, "10.0.0.1")
+	c.Assert(cfg.Port, Equals, 4001)
+	c.Assert(cfg.User, Equals, "flag")
+	c.Assert(cfg.Verbose, IsFalse)
+
+	// the environment variables are not bound without the prefix
+	cfg = newTestConfig()
+	err = NewConfigBinder(cfg.FlagSet, "").Parse(nil)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Port, Equals, 3306)
+
+	os.Setenv("UTILS_TEST_VERBOSE", "not-bool")
+	defer os.Unsetenv("UTILS_TEST_VERBOSE")
+	cfg = newTestConfig()
+	err = NewConfigBinder(cfg.FlagSet, "UTILS_TEST_").Parse(nil)
+	c.Assert(err, ErrorMatches, ".*UTILS_TEST_VERBOSE.*")
+	os.Unsetenv("UTILS_TEST_VERBOSE")
+
+	cfg = newTestConfig()
+	err = NewConfigBinder(cfg.FlagSet, "").Parse([]string{"extra"})
+	c.Assert(err, ErrorMatches, ".*'extra' is an invalid flag.*")
+
+	cfg = newTestConfig()
+	err = NewConfigBinder(cfg.FlagSet, "").AddValidator(func() error {
+		return errors.New("invalid port")
+	}).Parse(nil)
+	c.Assert(err, ErrorMatches, ".*invalid port.*")
+}
+
+func (t *testConfigSuite) TestMaskSecrets(c *C) {
+	c.Assert(IsSecretKey("password"), IsTrue)
+	c.Assert(IsSecretKey("access-token"), IsTrue)
+	c.Assert(IsSecretKey("ssl-key"), IsFalse)
+
+	cfg := newTestConfig()
+	cfg.Password = "123456"
+	c.Assert(MaskSecrets(cfg), Equals, `{"host":"127.0.0.1","password":"******","port":3306,"user":"root","verbose":false}`)
+
+	// the references to the secrets and the empty secrets are kept
+	nested := map[string]interface{}{
+		"source": []map[string]string{{"password": "env:PASSWORD"}, {"password": ""}},
+		"target": map[string]string{"password": "file:/path", "api-secret": "abc"},
+	}
+	c.Assert(MaskSecrets(nested), Equals, `{"source":[{"password":"env:PASSWORD"},{"password":""}],"target":{"api-secret":"******","password":"file:/path"}}`)
+}
@@ -0,0 +1,226 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrClass is the class of an error code.
+type ErrClass int
+
+// the error classes, every class has its own code range, for example config's codes are in [1000, 2000).
+const (
+	ClassConfig ErrClass = iota + 1
+	ClassConnection
+	ClassSchema
+	ClassData
+	ClassInternal
+)
+
+var errClassNames = map[ErrClass]string{
+	ClassConfig:     "config",
+	ClassConnection: "connection",
+	ClassSchema:     "schema",
+	ClassData:       "data",
+	ClassInternal:   "internal",
+}
+
+// String implements fmt.Stringer interface.
+func (c ErrClass) String() string {
+	if name, ok := errClassNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ErrCode is a stable and machine-readable identifier of an error.
+type ErrCode struct {
+	Code  int
+	Class ErrClass
+	// Name is the short description of the code, for example "InvalidConfig".
+	Name string
+}
+
+var (
+	errCodeMu       sync.RWMutex
+	errCodeRegistry = make(map[int]*ErrCode)
+)
+
+// RegisterErrCode registers an error code, panics if the code is registered already or not in the class's range.
+func RegisterErrCode(code int, class ErrClass, name string) *ErrCode {
+	if code < int(class)*1000 || code >= int(class+1)*1000 {
+		panic(fmt.Sprintf("error code %d is not in the range of class %s", code, class))
+	}
+
+	errCodeMu.Lock()
+	defer errCodeMu.Unlock()
+
+	if ec, ok := errCodeRegistry[code]; ok {
+		panic(fmt.Sprintf("error code %d is registered by %s already", code, ec.Name))
+	}
+
+	ec := &ErrCode{
+		Code:  code,
+		Class: class,
+		Name:  name,
+	}
+	errCodeRegistry[code] = ec
+	return ec
+}
+
+// RegisteredErrCodes returns all the registered error codes, ordered by code.
+func RegisteredErrCodes() []*ErrCode {
+	errCodeMu.RLock()
+	defer errCodeMu.RUnlock()
+
+	codes := make([]*ErrCode, 0, len(errCodeRegistry))
+	for _, ec := range errCodeRegistry {
+		codes = append(codes, ec)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+
+	return codes
+}
+
+// the common error codes used by all tools.
+var (
+	ErrInvalidConfig   = RegisterErrCode(1001, ClassConfig, "InvalidConfig")
+	ErrConnectDB       = RegisterErrCode(2001, ClassConnection, "ConnectDB")
+	ErrConnectEtcd     = RegisterErrCode(2002, ClassConnection, "ConnectEtcd")
+	ErrTableNotFound   = RegisterErrCode(3001, ClassSchema, "TableNotFound")
+	ErrSchemaMismatch  = RegisterErrCode(3002, ClassSchema, "SchemaMismatch")
+	ErrDataMismatch    = RegisterErrCode(4001, ClassData, "DataMismatch")
+	ErrDataCheckFailed = RegisterErrCode(4002, ClassData, "DataCheckFailed")
+	ErrUnknown         = RegisterErrCode(5000, ClassInternal, "Unknown")
+)
+
+// String implements fmt.Stringer interface, for example "config:1001".
+func (ec *ErrCode) String() string {
+	return fmt.Sprintf("%s:%d", ec.Class, ec.Code)
+}
+
+// New returns a new error with this code.
+func (ec *ErrCode) New(format string, args ...interface{}) error {
+	return errors.AddStack(&CodedError{
+		code: ec,
+		msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Wrap wraps err with this code, returns nil if err is nil.
+func (ec *ErrCode) Wrap(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	return errors.AddStack(&CodedError{
+		code:  ec,
+		msg:   fmt.Sprintf(format, args...),
+		cause: err,
+	})
+}
+
+// CodedError is an error with an ErrCode.
+type CodedError struct {
+	code  *ErrCode
+	msg   string
+	cause error
+}
+
+// Error implements error interface.
+func (e *CodedError) Error() string {
+	if e.cause == nil {
+		return fmt.Sprintf("[%s] %s", e.code, e.msg)
+	}
+	return fmt.Sprintf("[%s] %s: %v", e.code, e.msg, e.cause)
+}
+
+// Cause implements the causer interface of pingcap/errors, so errors.Cause can find the wrapped error.
+func (e *CodedError) Cause() error {
+	return e.cause
+}
+
+// Code returns the error's code.
+func (e *CodedError) Code() *ErrCode {
+	return e.code
+}
+
+// GetErrCode returns the code of the error, returns ErrUnknown if the error doesn't have a code.
+func GetErrCode(err error) *ErrCode {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		if e, ok := err.(*CodedError); ok {
+			return e.code
+		}
+
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+
+	return ErrUnknown
+}
+
+// ErrorInfo is the machine-readable information of an error, can be used in log and json output.
+type ErrorInfo struct {
+	Code    int    `json:"code"`
+	Class   string `json:"class"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// GetErrorInfo returns the ErrorInfo of the error, returns nil if err is nil.
+func GetErrorInfo(err error) *ErrorInfo {
+	if err == nil {
+		return nil
+	}
+
+	ec := GetErrCode(err)
+	return &ErrorInfo{
+		Code:    ec.Code,
+		Class:   ec.Class.String(),
+		Name:    ec.Name,
+		Message: err.Error(),
+	}
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler interface.
+func (e *ErrorInfo) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("code", e.Code)
+	enc.AddString("class", e.Class)
+	enc.AddString("name", e.Name)
+	return nil
+}
+
+// ZapErrCode returns a zap field which contains the error's code, class and name.
+func ZapErrCode(err error) zap.Field {
+	if err == nil {
+		return zap.Skip()
+	}
+	return zap.Object("error-code", GetErrorInfo(err))
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+var _ = Suite(&testErrCodeSuite{})
+
+type testErrCodeSuite struct{}
+
+func (s *testErrCodeSuite) TestErrCode(c *C) {
+	err := ErrInvalidConfig.New("invalid port %d", 0)
+	c.Assert(err, ErrorMatches, `\[config:1001\] invalid port 0`)
+	c.Assert(GetErrCode(err), Equals, ErrInvalidConfig)
+
+	// the code can be found through the annotations
+	cause := errors.New("connection refused")
+	err = errors.Annotate(ErrConnectDB.Wrap(cause, "create source db"), "init")
+	c.Assert(err, ErrorMatches, `init: \[connection:2001\] create source db: connection refused`)
+	c.Assert(GetErrCode(err), Equals, ErrConnectDB)
+	c.Assert(errors.Cause(err), Equals, cause)
+
+	c.Assert(ErrConnectDB.Wrap(nil, "create source db"), IsNil)
+	c.Assert(GetErrCode(cause), Equals, ErrUnknown)
+
+	info := GetErrorInfo(err)
+	data, err := json.Marshal(info)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{"code":2001,"class":"connection","name":"ConnectDB","message":"init: [connection:2001] create source db: connection refused"}`)
+	c.Assert(GetErrorInfo(nil), IsNil)
+}
+
+func (s *testErrCodeSuite) TestRegisterErrCode(c *C) {
+	c.Assert(func() { RegisterErrCode(1001, ClassConfig, "Duplicated") }, PanicMatches, "error code 1001 is registered by InvalidConfig already")
+	c.Assert(func() { RegisterErrCode(2999, ClassConfig, "OutOfRange") }, PanicMatches, "error code 2999 is not in the range of class config")
+
+	codes := RegisteredErrCodes()
+	for i := 1; i < len(codes); i++ {
+		c.Assert(codes[i-1].Code, Less, codes[i].Code)
+	}
+}
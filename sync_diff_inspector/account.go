@@ -0,0 +1,55 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// compareAccounts compares the accounts and their grants between every source and target, and saves the drifts in
+// the report.
+func (df *Diff) compareAccounts(ctx context.Context) error {
+	targetAccounts, err := diff.FetchAccounts(ctx, df.targetDB.Conn, df.ignoreAccounts)
+	if err != nil {
+		return errors.Annotatef(err, "fetch accounts from %s", df.targetDB.InstanceID)
+	}
+
+	instanceIDs := make([]string, 0, len(df.sourceDBs))
+	for instanceID := range df.sourceDBs {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+
+	for _, instanceID := range instanceIDs {
+		sourceAccounts, err := diff.FetchAccounts(ctx, df.sourceDBs[instanceID].Conn, df.ignoreAccounts)
+		if err != nil {
+			return errors.Annotatef(err, "fetch accounts from %s", instanceID)
+		}
+
+		drifts := diff.CompareAccounts(sourceAccounts, targetAccounts)
+		for _, drift := range drifts {
+			log.Warn("account drift", zap.String("source", instanceID), zap.Stringer("drift", drift))
+		}
+		log.Info("compare accounts", zap.String("source", instanceID), zap.Int("accounts", len(sourceAccounts)), zap.Int("drifts", len(drifts)))
+		df.report.SetAccountCheckResult(instanceID, drifts)
+	}
+
+	return nil
+}
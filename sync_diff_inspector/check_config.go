@@ -0,0 +1,91 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// runCheckConfig validates the config without checking the data, it connects all the instances, runs the pre-checks
+// like the privileges needed by the check, resolves the tables by the filters and routes, and prints the planned table
+// pairs with the estimated chunks. the fix sql, the diff rows and the checkpoint are not written. returns the exit code.
+func runCheckConfig(ctx context.Context, cfg *Config) int {
+	cfg.DryRun = true
+	cfg.StatusAddr = ""
+	cfg.DiffRowsFile = ""
+	cfg.ChunkArtifactsFile = ""
+	cfg.FixSQLDir = ""
+	cfg.FixSQLFile = os.DevNull
+
+	df, err := NewDiff(ctx, cfg)
+	if err != nil {
+		log.Error("fail to initialize diff process", zap.Error(err), utils.ZapErrCode(err))
+		return exitCodeError
+	}
+	defer df.Close()
+
+	results, err := df.preCheck(cfg)
+	if err != nil {
+		log.Error("pre-check failed", zap.Error(err))
+		return exitCodeError
+	}
+	failed := !results.Summary.Passed
+
+	tables := orderTablesByPriority(df.tables, nil)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET TABLE\tSOURCE TABLES\tCHUNKS\tROWS\tBYTES")
+	for _, table := range tables {
+		td, err := df.newTableDiff(table, nil)
+		if err == nil {
+			var estimate *diff.TableEstimate
+			estimate, err = td.Estimate(ctx)
+			if err == nil {
+				writePlannedTable(w, table, estimate)
+				continue
+			}
+		}
+		log.Error("estimate table failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		failed = true
+	}
+	if err = w.Flush(); err != nil {
+		log.Error("print planned tables failed", zap.Error(err))
+		return exitCodeError
+	}
+
+	if failed {
+		return exitCodeError
+	}
+	log.Info("the config is valid", zap.Int("table num", len(tables)))
+	return exitCodeEqual
+}
+
+// writePlannedTable writes the table pair and its estimation in one line.
+func writePlannedTable(w io.Writer, table *TableConfig, estimate *diff.TableEstimate) {
+	sourceTables := make([]string, 0, len(table.SourceTables))
+	for _, sourceTable := range table.SourceTables {
+		sourceTables = append(sourceTables, fmt.Sprintf("%s:%s", sourceTable.InstanceID, dbutil.TableName(sourceTable.Schema, sourceTable.Table)))
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", dbutil.TableName(table.Schema, table.Table), strings.Join(sourceTables, ", "), estimate.Chunks, estimate.Rows, estimate.Bytes)
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// cleanupCommand is the subcommand only prunes the checkpoint and summary rows.
+const cleanupCommand = "cleanup"
+
+// runCleanup prunes the checkpoint and summary rows by checkpoint-retention-days, and the rows of the tables deleted in target database.
+func runCleanup(ctx context.Context, cfg *Config) error {
+	openDB := dbutil.OpenDB
+	if cfg.ReadOnly {
+		openDB = dbutil.OpenReadOnlyDB
+	}
+
+	targetDB, err := openDB(cfg.TargetDBCfg.DBConfig)
+	if err != nil {
+		return errors.Annotatef(err, "create db connections %s", cfg.TargetDBCfg.DBConfig.String())
+	}
+	defer targetDB.Close()
+
+	checkpointDB := targetDB
+	if cfg.CheckpointDBCfg != nil {
+		checkpointDB, err = dbutil.OpenDB(*cfg.CheckpointDBCfg)
+		if err != nil {
+			return errors.Annotatef(err, "create db connections %s", cfg.CheckpointDBCfg.String())
+		}
+		defer checkpointDB.Close()
+	}
+
+	return errors.Trace(cleanupCheckpoint(ctx, checkpointDB, targetDB, cfg.CheckpointRetentionDays))
+}
+
+// cleanupCheckpoint prunes the checkpoint and summary rows not updated in retentionDays, 0 means don't prune rows by time,
+// and the rows of the tables don't exist in target database.
+func cleanupCheckpoint(ctx context.Context, checkpointDB, targetDB *sql.DB, retentionDays int) error {
+	schemas, err := dbutil.GetSchemas(ctx, targetDB)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the tables of a schema are only queried once, the schemas deleted have no tables
+	schemaTables := make(map[string]map[string]struct{})
+	for _, schema := range schemas {
+		schemaTables[schema] = nil
+	}
+	tableExists := func(ctx context.Context, schema, table string) (bool, error) {
+		tables, ok := schemaTables[schema]
+		if !ok {
+			return false, nil
+		}
+		if tables == nil {
+			tableNames, err := dbutil.GetTables(ctx, targetDB, schema)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			tables = make(map[string]struct{}, len(tableNames))
+			for _, tableName := range tableNames {
+				tables[tableName] = struct{}{}
+			}
+			schemaTables[schema] = tables
+		}
+
+		_, ok = tables[table]
+		return ok, nil
+	}
+
+	deleted, err := diff.CleanupCheckpoint(ctx, checkpointDB, diff.CheckpointCleanupPolicy{
+		Retention:   time.Duration(retentionDays) * 24 * time.Hour,
+		TableExists: tableExists,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("cleanup checkpoint", zap.Int("retention days", retentionDays), zap.Int64("deleted rows", deleted))
+
+	return nil
+}
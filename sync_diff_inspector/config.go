@@ -17,13 +17,17 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
+	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/parser/model"
+	column "github.com/pingcap/tidb-tools/pkg/column-mapping"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"github.com/pingcap/tidb-tools/pkg/filter"
 	router "github.com/pingcap/tidb-tools/pkg/table-router"
+	"github.com/pingcap/tidb-tools/pkg/utils"
 	"go.uber.org/zap"
 )
 
@@ -32,6 +36,25 @@ const (
 	percent100 = 100
 )
 
+// envPrefix is the prefix of the environment variables which set the flags
+const envPrefix = "SYNC_DIFF_"
+
+const (
+	// modeFull checks the tables by chunks, and compares the rows of the different chunks
+	modeFull = "full"
+	// modeQuick only compares the total row count and the whole table's checksum of every table
+	modeQuick = "quick"
+)
+
+const (
+	// preCheckWarn only reports the failed pre-checks
+	preCheckWarn = "warn"
+	// preCheckStrict stops the run if any pre-check failed
+	preCheckStrict = "strict"
+	// preCheckOff skips the pre-checks
+	preCheckOff = "off"
+)
+
 var sourceInstanceMap map[string]interface{} = make(map[string]interface{})
 
 // DBConfig is the config of database, and keep the connection.
@@ -42,6 +65,19 @@ type DBConfig struct {
 
 	Snapshot string `toml:"snapshot" json:"snapshot"`
 
+	// the max number of chunks checked concurrently in this instance across all tables, 0 means no limit.
+	MaxConcurrentChunks int `toml:"max-concurrent-chunks" json:"max-concurrent-chunks"`
+
+	// the Dumpling or Mydumper export directory, the tables' struct and rows are read from the files instead of the database.
+	// only can be used in source, and the data is compared by rows because checksum is not supported.
+	DumpDir string `toml:"dump-dir" json:"dump-dir"`
+
+	// the address like "host:port" of the MySQL read replica, the rows are read from it instead of host and port,
+	// with the same user and password.
+	ReadReplica string `toml:"read-replica" json:"read-replica"`
+	// TiDB's tidb_replica_read, like "follower" or "closest-replicas", the rows are read from the followers.
+	ReplicaRead string `toml:"replica-read" json:"replica-read"`
+
 	Conn *sql.DB
 }
 
@@ -51,6 +87,28 @@ func (c *DBConfig) Valid() bool {
 		log.Error("must specify source database's instance id")
 		return false
 	}
+	if c.MaxConcurrentChunks < 0 {
+		log.Error("max-concurrent-chunks must be greater than or equal to 0", zap.String("instance id", c.InstanceID))
+		return false
+	}
+	if c.MaxOpenConns < 0 {
+		log.Error("max-open-conns must be greater than or equal to 0", zap.String("instance id", c.InstanceID))
+		return false
+	}
+	if len(c.ConnMaxLifetime) != 0 {
+		if lifetime, err := time.ParseDuration(c.ConnMaxLifetime); err != nil || lifetime < 0 {
+			log.Error("conn-max-lifetime is invalid", zap.String("instance id", c.InstanceID), zap.String("conn-max-lifetime", c.ConnMaxLifetime))
+			return false
+		}
+	}
+	if c.DumpDir != "" && c.Snapshot != "" {
+		log.Error("snapshot can't be used with dump-dir", zap.String("instance id", c.InstanceID))
+		return false
+	}
+	if err := c.validReplicaRead(); err != nil {
+		log.Error("config of reading from replicas is invalid", zap.String("instance id", c.InstanceID), zap.Error(err))
+		return false
+	}
 	sourceInstanceMap[c.InstanceID] = struct{}{}
 
 	return true
@@ -71,10 +129,20 @@ type TableConfig struct {
 	TableInstance
 	// columns be ignored, will not check this column's data, but may use these columns as split field or order by key.
 	IgnoreColumns []string `toml:"ignore-columns"`
+	// only these columns are checked if is not empty, the other columns are ignored like ignore-columns,
+	// except the primary key or unique key's columns used to match the rows.
+	CheckColumns []string `toml:"check-columns"`
 	// columns be removed, will remove these columns from table info, and will not check these columns' data.
 	RemoveColumns []string `toml:"remove-columns"`
+	// the columns of a unique business key used to order and match the rows instead of the primary key,
+	// for example when the surrogate primary keys are regenerated in target.
+	BusinessKey []string `toml:"business-key"`
+	// the columns whose values are masked in logs and reports when redact is true, all the columns are masked if is empty.
+	RedactColumns []string `toml:"redact-columns"`
 	// field should be the primary key, unique key or field with index
 	Fields string `toml:"index-fields"`
+	// the index forced by FORCE INDEX in the checksum and rows' queries, "auto" selects the index covering index-fields.
+	IndexHint string `toml:"index-hint"`
 	// select range, for example: "age > 10 AND age < 20"
 	Range string `toml:"range"`
 	// set true if comparing sharding tables with target table, should have more than one source tables.
@@ -88,6 +156,36 @@ type TableConfig struct {
 
 	// collation config in mysql/tidb
 	Collation string `toml:"collation"`
+
+	// the max number of rows can be deleted in target table by fix sql, will use the global config if is 0.
+	MaxDeleteRows int64 `toml:"max-delete-rows"`
+	// the max ratio of rows can be deleted in target table by fix sql, will use the global config if is 0.
+	MaxDeleteRatio float64 `toml:"max-delete-ratio"`
+
+	// how many goroutines are created to check this table's data, will use the global config if is 0.
+	CheckThreadCount int `toml:"check-thread-count"`
+
+	// the column marks the row as logically deleted, the soft deleted rows are regarded as absent.
+	SoftDeleteColumn string `toml:"soft-delete-column"`
+	// the row is soft deleted if the column's value is one of them, or the value is not NULL if is empty.
+	SoftDeleteValues []string `toml:"soft-delete-values"`
+
+	// the comparator of the columns, can be "case-insensitive" or "uuid", for example { email = "case-insensitive" }.
+	ColumnComparators map[string]string `toml:"column-comparators"`
+
+	// the SQL expressions selected instead of the source tables' columns, for example { id = "`id` - 10000" },
+	// overrides the expressions of column-mapping-rules.
+	ColumnExprs map[string]string `toml:"column-exprs"`
+
+	// the path of the chunk results computed by other systems in the format of diff.ExternalChunkResultsSchema, the
+	// results are compared with the target table's checksums instead of the source tables.
+	ExternalChunkResults string `toml:"external-chunk-results"`
+
+	// the integer or decimal columns whose SUM, COUNT(DISTINCT), MIN and MAX are compared per chunk instead of the checksum.
+	AggregateColumns []string `toml:"aggregate-columns"`
+
+	// the table's priority class, can be "critical", "normal" or "low", default is "normal".
+	Priority string `toml:"priority"`
 }
 
 // Valid returns true if table's config is valide.
@@ -116,6 +214,28 @@ func (t *TableConfig) Valid() bool {
 		}
 	}
 
+	if t.CheckThreadCount < 0 {
+		log.Error("check-thread-count must be greater than or equal to 0", zap.String("table", dbutil.TableName(t.Schema, t.Table)))
+		return false
+	}
+
+	if t.MaxDeleteRows < 0 || t.MaxDeleteRatio < 0 || t.MaxDeleteRatio > 1 {
+		log.Error("max-delete-rows must be greater than or equal to 0, and max-delete-ratio must be in [0, 1]", zap.String("table", dbutil.TableName(t.Schema, t.Table)))
+		return false
+	}
+
+	for column, comparator := range t.ColumnComparators {
+		if err := diff.ValidateComparator(comparator); err != nil {
+			log.Error("column's comparator is invalid", zap.String("table", dbutil.TableName(t.Schema, t.Table)), zap.String("column", column), zap.Error(err))
+			return false
+		}
+	}
+
+	if _, ok := priorityOrder[t.Priority]; len(t.Priority) != 0 && !ok {
+		log.Error("priority must be critical, normal or low", zap.String("table", dbutil.TableName(t.Schema, t.Table)), zap.String("priority", t.Priority))
+		return false
+	}
+
 	return true
 }
 
@@ -127,6 +247,9 @@ type TableInstance struct {
 	Schema string `toml:"schema"`
 	// table name
 	Table string `toml:"table"`
+	// the condition selects the rows in the source table, merged with the table's range by AND,
+	// for example "tenant_id BETWEEN 1 AND 100". only used in source-tables.
+	Range string `toml:"range"`
 }
 
 // Valid returns true if table instance's info is valide.
@@ -163,6 +286,23 @@ type Config struct {
 	// target database's config
 	TargetDBCfg DBConfig `toml:"target-db" json:"target-db"`
 
+	// set true will never write anything to the source and target databases, the connections reject the statements
+	// except SELECT, SHOW and setting session variables. the checkpoint and summary are saved in checkpoint-db.
+	ReadOnly bool `toml:"read-only" json:"read-only"`
+
+	// the database saves the checkpoint and summary, default is the target database. must be set in read-only mode.
+	CheckpointDBCfg *dbutil.DBConfig `toml:"checkpoint-db" json:"checkpoint-db"`
+
+	// the checkpoint and summary rows not updated in the days, and the rows of the tables deleted in target database are
+	// pruned before every check, 0 means never prune. the "cleanup" subcommand prunes the rows by it and exits.
+	CheckpointRetentionDays int `toml:"checkpoint-retention-days" json:"checkpoint-retention-days"`
+
+	// the names of the schema and tables saving the checkpoint and summary, default are "sync_diff_inspector", "summary" and "chunk".
+	// the schema is created if not exists.
+	CheckpointSchema       string `toml:"checkpoint-schema" json:"checkpoint-schema"`
+	CheckpointSummaryTable string `toml:"checkpoint-summary-table" json:"checkpoint-summary-table"`
+	CheckpointChunkTable   string `toml:"checkpoint-chunk-table" json:"checkpoint-chunk-table"`
+
 	// for example, the whole data is [1...100]
 	// we can split these data to [1...10], [11...20], ..., [91...100]
 	// the [1...10] is a chunk, and it's chunk size is 10
@@ -175,24 +315,162 @@ type Config struct {
 	// how many goroutines are created to check data
 	CheckThreadCount int `toml:"check-thread-count" json:"check-thread-count"`
 
+	// the max number of source tables queried concurrently when calculating a chunk's checksum, useful for many sharding tables.
+	SourceChecksumConcurrency int `toml:"source-checksum-concurrency" json:"source-checksum-concurrency"`
+
 	// set true if target-db and source-db all support tidb implicit column "_tidb_rowid"
 	UseRowID bool `toml:"use-rowid" json:"use-rowid"`
 
 	// set false if want to comapre the data directly
 	UseChecksum bool `toml:"use-checksum" json:"use-checksum"`
 
+	// set true will count the chunk's rows in source and target before comparing the checksum, the chunk is regarded as
+	// not equal directly if the counts are different. the total counts of tables are printed in the report.
+	RowCountCheck bool `toml:"row-count-check" json:"row-count-check"`
+
+	// set true will re-check the failed chunks of a table once after all the chunks are checked, to absorb the transient
+	// replication lag or flaky connections. the fix sqls are only generated for the chunks still different in the retry.
+	RetryFailedChunks bool `toml:"retry-failed-chunks" json:"retry-failed-chunks"`
+
+	// the time to wait before re-checking the failed chunks, for example "30s".
+	RetryDelay string `toml:"retry-delay" json:"retry-delay"`
+
+	// the delay to re-read the checksums of the chunk found different, for example "5s". the chunk is only regarded as
+	// different if both reads have the same checksums. empty means never re-read.
+	DoubleReadDelay string `toml:"double-read-delay" json:"double-read-delay"`
+
+	// the max times to split a chunk whose query exceeds the max execution time set in the database, the chunk is split
+	// to smaller chunks which are checked instead. 0 means the chunk is regarded as failed.
+	TimeoutSplitTimes int `toml:"timeout-split-times" json:"timeout-split-times"`
+
+	// the timeouts of the queries by class, the chunk whose checksum or rows' query exceeds the timeout is also split
+	// by timeout-split-times.
+	Timeouts Timeouts `toml:"timeouts" json:"timeouts"`
+
+	// check when the replication from source to target is still running, the mismatched chunks are re-checked after
+	// the target applied the source's position, only the rows remain different are reported.
+	OnlineCheck OnlineCheck `toml:"online-check" json:"online-check"`
+
 	// set true if just want compare data by checksum, will skip select data when checksum is not equal.
 	OnlyUseChecksum bool `toml:"only-use-checksum" json:"only-use-checksum"`
 
 	// the name of the file which saves sqls used to fix different data
 	FixSQLFile string `toml:"fix-sql-file" json:"fix-sql-file"`
 
+	// set true will generate fix sqls for source tables, the target is regarded as the source of truth.
+	ReverseFixSQL bool `toml:"reverse-fix-sql" json:"reverse-fix-sql"`
+
+	// set true will generate `UPDATE` for the different rows and `INSERT` for the missing rows instead of `REPLACE`.
+	UseUpdateSQL bool `toml:"use-update-sql" json:"use-update-sql"`
+
+	// set true will compare the length and SHA1 of the TEXT/BLOB columns calculated in the databases instead of the values.
+	HashLongColumns bool `toml:"hash-long-columns" json:"hash-long-columns"`
+
+	// set true will mask the columns' values in logs and the different rows' reports, for the compliance with PII policies.
+	Redact bool `toml:"redact" json:"redact"`
+
+	// set true will also replace the masked values in fix sqls with the placeholder `?`, need redact.
+	RedactFixSQL bool `toml:"redact-fix-sql" json:"redact-fix-sql"`
+
+	// the syntax of the fix sqls, can be "mysql" or "postgresql", default is "mysql".
+	FixSQLDialect string `toml:"fix-sql-dialect" json:"fix-sql-dialect"`
+
+	// the directory to save fix sqls, one file for every table. will not use fix-sql-file if is not empty.
+	FixSQLDir string `toml:"fix-sql-dir" json:"fix-sql-dir"`
+
+	// the max size of a fix sql file in fix-sql-dir, will roll to a new file if exceeds it, 0 means no limit.
+	FixSQLMaxFileSize int64 `toml:"fix-sql-max-file-size" json:"fix-sql-max-file-size"`
+
+	// the file to write the final metrics snapshot of the run in OpenMetrics text format, for the pipelines without a scraper.
+	MetricsSnapshotFile string `toml:"metrics-snapshot-file" json:"metrics-snapshot-file"`
+
+	// the file to write the final summary of the run in JSON format, contains the exit code and every table's verdict.
+	SummaryFile string `toml:"summary-file" json:"summary-file"`
+
+	// set true will only print the result of the run in the console summary.
+	Quiet bool `toml:"quiet" json:"quiet"`
+	// set true will print every table's result in the console summary, only the tables not equal are printed by default.
+	Verbose bool `toml:"verbose" json:"verbose"`
+
+	// set true will save every table's failed chunks of the run in the history table, and alert if they grow run-over-run.
+	RecordHistory bool `toml:"record-history" json:"record-history"`
+
+	// the url to post the drift in JSON when a table's failed chunks grow run-over-run, need record-history.
+	DriftAlertWebhook string `toml:"drift-alert-webhook" json:"drift-alert-webhook"`
+
+	// the database to upsert every table's final result of the run, so the dashboards can chart the consistency status
+	// by SQL. the schema must be set, and the schema and table are created if not exist.
+	SummaryExportDBCfg *dbutil.DBConfig `toml:"summary-export-db" json:"summary-export-db"`
+
+	// the table in summary-export-db's schema to save the results, default is "table_result".
+	SummaryExportTable string `toml:"summary-export-table" json:"summary-export-table"`
+
+	// the address of the HTTP API to get the status and control the check at runtime, for example "127.0.0.1:8089", empty means disabled.
+	StatusAddr string `toml:"status-addr" json:"status-addr"`
+
+	// the address of the worker's gRPC service, only used by the worker subcommand, for example "127.0.0.1:8090".
+	WorkerAddr string `toml:"worker-addr" json:"worker-addr"`
+	// the certificate and key of the worker's gRPC service, and the CA verifies the clients' certificates.
+	// the worker can only listen on the loopback address if they are not set.
+	WorkerSSLCA   string `toml:"worker-ssl-ca" json:"worker-ssl-ca"`
+	WorkerSSLCert string `toml:"worker-ssl-cert" json:"worker-ssl-cert"`
+	WorkerSSLKey  string `toml:"worker-ssl-key" json:"worker-ssl-key"`
+
+	// the file to export the different rows, every row contains the source and target values of the different columns.
+	DiffRowsFile string `toml:"diff-rows-file" json:"diff-rows-file"`
+
+	// the format of diff-rows-file, can be "csv" or "json"(one json object per line).
+	DiffRowsFormat string `toml:"diff-rows-format" json:"diff-rows-format"`
+
+	// the file to export the diagnostics of the failed chunks, every chunk contains the checksum and select sqls with the
+	// arguments of every table instance, and the checksums of both sides, one json object per line.
+	ChunkArtifactsFile string `toml:"chunk-artifacts-file" json:"chunk-artifacts-file"`
+
+	// the max number of rows can be deleted in every target table by fix sql, 0 means no limit.
+	// the check of the table will stop if exceeds the limit, to avoid wiping the target table by a wrong config.
+	MaxDeleteRows int64 `toml:"max-delete-rows" json:"max-delete-rows"`
+
+	// the max ratio of rows can be deleted in every target table by fix sql, for example 0.1 means 10% of the table's rows, 0 means no limit.
+	MaxDeleteRatio float64 `toml:"max-delete-ratio" json:"max-delete-ratio"`
+
+	// the max number of different rows found in a chunk, the rest rows of the chunk are not compared once reach it, 0 means no limit.
+	MaxChunkDiffRows int `toml:"max-chunk-diff-rows" json:"max-chunk-diff-rows"`
+
+	// split the compared columns of the wide tables into the groups of this number of columns, the groups' checksums are
+	// calculated separately, and only the mismatched groups are compared by rows. 0 means not split.
+	ColumnGroupSize int `toml:"column-group-size" json:"column-group-size"`
+
+	// percona-toolkit's checksums table in target database, for example "percona.checksums".
+	// if is not empty, will save chunks' checksum in this table with pt-table-checksum's format.
+	PTChecksumTable string `toml:"pt-checksum-table" json:"pt-checksum-table"`
+
+	// set true will only check the chunks which are not equal in pt-table-checksum's result saved in pt-checksum-table.
+	UsePTChecksum bool `toml:"use-pt-checksum" json:"use-pt-checksum"`
+
 	// the tables to be checked
 	Tables []*CheckTables `toml:"check-tables" json:"check-tables"`
 
+	// discover the tables in target database matched by the rules, and check them with the tables in check-tables,
+	// the system schemas and the checkpoint schema are ignored.
+	TableFilter *filter.Rules `toml:"table-filter" json:"table-filter"`
+
+	// only check the tables in check-tables and table-filter whose attributes in target database match the rules, for example the engine,
+	// the estimated rows and whether has primary key.
+	TableAttributes *filter.AttributeRules `toml:"table-attributes" json:"table-attributes"`
+
 	// TableRules defines table name and database name's conversion relationship between source database and target database
 	TableRules []*router.TableRule `toml:"table-rules" json:"table-rules"`
 
+	// the DM task file, the routes, binlog event filters and black-white lists (or block-allow lists) of the task's
+	// mysql-instances are loaded, and the target tables of the replicated source tables are checked. the source-id of
+	// every mysql-instance should be the instance-id of a source-db.
+	DMTaskFile string `toml:"dm-task-file" json:"dm-task-file"`
+	dmTask     *dmTask
+
+	// the column mapping rules applied in the replication, the mapped values of the source tables are computed by the
+	// expressions in SQL before compared, for example the ids with shard offset.
+	ColumnMappingRules []*column.Rule `toml:"column-mapping-rules" json:"column-mapping-rules"`
+
 	// the config of table
 	TableCfgs []*TableConfig `toml:"table-config" json:"table-config"`
 
@@ -202,17 +480,99 @@ type Config struct {
 	// ignore check table's data
 	IgnoreDataCheck bool `toml:"ignore-data-check" json:"ignore-data-check"`
 
+	// set true will also compare every secondary index's content by the checksum read by FORCE INDEX after checking the data
+	CheckIndexes bool `toml:"check-indexes" json:"check-indexes"`
+
+	// set true will regard the table's struct as not equal if the ENUM/SET columns' elements have different order
+	CheckEnumOrder bool `toml:"check-enum-order" json:"check-enum-order"`
+
+	// set true will compare the foreign keys, CHECK constraints and expression indexes in the struct check
+	CheckConstraints bool `toml:"check-constraints" json:"check-constraints"`
+
+	// set true will regard the table's struct as not equal if the columns' charsets or collations are different but compatible
+	StrictCharset bool `toml:"strict-charset" json:"strict-charset"`
+
+	// set true will also check the views, the struct is compared by the columns and the definition, and the data is
+	// compared by selecting the rows from the views
+	CompareViews bool `toml:"compare-views" json:"compare-views"`
+
+	// compares the TiDB-specific attributes in the struct check, like AUTO_RANDOM, SHARD_ROW_ID_BITS and the sequences
+	// of the checked schemas, every attribute can be ignored. not compared if not set.
+	TiDBAttributes *diff.TiDBAttributesCheck `toml:"tidb-attributes" json:"tidb-attributes"`
+
 	// set true will continue check from the latest checkpoint
 	UseCheckpoint bool `toml:"use-checkpoint" json:"use-checkpoint"`
 
+	// set true will only dispatch the failed, error and not checked chunks when continue check from the checkpoint
+	ResumeFailedChunks bool `toml:"resume-failed-chunks" json:"resume-failed-chunks"`
+
+	// set true will only recheck the failed chunks of the previous finished check, the tables passed in the previous
+	// check are not checked again
+	RecheckFailed bool `toml:"recheck-failed" json:"recheck-failed"`
+
 	// use this tidb's statistics information to split chunk
 	TiDBInstanceID string `toml:"tidb-instance-id" json:"tidb-instance-id"`
 
+	// set true will set the session variables which may cause false differences, like sql_mode's ANSI_QUOTES, time_zone
+	// and character_set_results, to the same values in all the instances' connections if they are different.
+	AlignSessionVariables bool `toml:"align-session-variables" json:"align-session-variables"`
+
+	// set true will compare the accounts in mysql.user and their grants between every source and target, the password
+	// hashes and the grants' formatting are canonicalized, so only the real drift is reported.
+	CheckAccounts bool `toml:"check-accounts" json:"check-accounts"`
+	// the accounts are not compared, like "root@localhost", or "root" for all the hosts.
+	IgnoreAccounts []string `toml:"ignore-accounts" json:"ignore-accounts"`
+
+	// set true will split chunks by the regions of the table's records in the tidb of tidb-instance-id, the tables
+	// without integer handle are still split by the statistics information.
+	SplitByRegion bool `toml:"split-by-region" json:"split-by-region"`
+
+	// set true will only print the estimated chunks, rows and bytes to be scanned of every table, and not check the data.
+	DryRun bool `toml:"dry-run" json:"dry-run"`
+
+	// the check mode, "full" or "quick". the quick mode only compares the total row count and the whole table's checksum
+	// of every table, without splitting chunks and fetching rows, and prints a compact pass/fail report.
+	Mode string `toml:"mode" json:"mode"`
+
+	// how the instances are checked before the check, "warn", "strict" or "off". the privileges on the tables, the
+	// sessions' timeouts and sql_mode, and whether the fix sql replaces the rows in target are checked at startup.
+	// "warn" only reports the failed pre-checks, "strict" stops the run if any pre-check failed.
+	PreCheck string `toml:"pre-check" json:"pre-check"`
+
+	// set true will skip the tables whose data versions of all the instances are unchanged since the last successful
+	// check, the versions are saved in the checkpoint database.
+	SkipUnchangedTables bool `toml:"skip-unchanged-tables" json:"skip-unchanged-tables"`
+
+	// the max time to check the tables of every priority class in one run, the tables exceed the budget are skipped.
+	PriorityTimeBudget PriorityTimeBudget `toml:"priority-time-budget" json:"priority-time-budget"`
+
+	// the number of tables checked concurrently, the tables of higher priority are checked first. default is 1.
+	TableConcurrency int `toml:"table-concurrency" json:"table-concurrency"`
+
+	// the max number of chunks checked concurrently in all the tables, 0 means no limit.
+	GlobalMaxConcurrentChunks int `toml:"global-max-concurrent-chunks" json:"global-max-concurrent-chunks"`
+
+	// the max memory in MiB of the rows buffered to compare in all the tables, the rows are spilled to the temporary
+	// files in spill-dir if it's exceeded. 0 means no limit.
+	MemoryBudget int64 `toml:"memory-budget" json:"memory-budget"`
+	// the directory of the temporary files of the spilled rows, the system's default if is empty.
+	SpillDir string `toml:"spill-dir" json:"spill-dir"`
+	// the hard limit in MiB of the rows buffered to compare in all the tables, the chunks wait before reading their rows
+	// if it's reached. 0 means no limit.
+	MemoryLimit int64 `toml:"memory-limit" json:"memory-limit"`
+
+	// the max number of queries sent to the databases per second to check the chunks, 0 means no limit.
+	// can be changed by the HTTP API at runtime.
+	QPSLimit int `toml:"qps-limit" json:"qps-limit"`
+
 	// config file
 	ConfigFile string
 
 	// print version if set true
 	PrintVersion bool
+
+	// only validate the config, the connections and the privileges, and print the planned tables if set true
+	CheckConfig bool
 }
 
 // NewConfig creates a new config.
@@ -229,54 +589,37 @@ func NewConfig() *Config {
 	fs.BoolVar(&cfg.UseRowID, "use-rowid", false, "set true if target-db and source-db all support tidb implicit column _tidb_rowid")
 	fs.BoolVar(&cfg.UseChecksum, "use-checksum", true, "set false if want to comapre the data directly")
 	fs.StringVar(&cfg.FixSQLFile, "fix-sql-file", "fix.sql", "the name of the file which saves sqls used to fix different data")
+	fs.StringVar(&cfg.FixSQLDir, "fix-sql-dir", "", "the directory which saves sqls used to fix different data, one file for every table")
 	fs.BoolVar(&cfg.PrintVersion, "V", false, "print version of sync_diff_inspector")
+	fs.BoolVar(&cfg.CheckConfig, "check-config", false, "only validate the config, connect the instances, verify the privileges and print the planned tables with the estimated chunks, the data is not checked")
 	fs.BoolVar(&cfg.IgnoreDataCheck, "ignore-data-check", false, "ignore check table's data")
 	fs.BoolVar(&cfg.IgnoreStructCheck, "ignore-struct-check", false, "ignore check table's struct")
 	fs.BoolVar(&cfg.UseCheckpoint, "use-checkpoint", true, "set true will continue check from the latest checkpoint")
+	fs.BoolVar(&cfg.RecheckFailed, "recheck-failed", false, "only recheck the failed chunks of the previous finished check, the tables passed in the previous check are not checked again")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "only print the estimated chunks, rows and bytes to be scanned of every table")
+	fs.StringVar(&cfg.PreCheck, "pre-check", preCheckWarn, "how the privileges, the sessions' timeouts and sql_mode are checked at startup: warn, strict to stop the run if any pre-check failed, or off")
+	fs.StringVar(&cfg.Mode, "mode", modeFull, "the check mode: full, or quick to only compare the total row count and the whole table's checksum of every table")
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "only print the result of the run in the console summary")
+	fs.BoolVar(&cfg.Verbose, "verbose", false, "print every table's result in the console summary")
+	fs.StringVar(&cfg.SummaryFile, "summary-file", "", "the file to write the final summary of the run in JSON format")
+	fs.BoolVar(&cfg.ReadOnly, "read-only", false, "never write anything to the source and target databases")
+	fs.StringVar(&cfg.WorkerAddr, "worker-addr", "", "the address of the worker's gRPC service, only used by the worker subcommand")
 
 	return cfg
 }
 
-// Parse parses flag definitions from the argument list.
+// Parse parses flag definitions from the argument list, the flags can also be set by the environment variables
+// prefixed with "SYNC_DIFF_", like SYNC_DIFF_CHUNK_SIZE, which override the config file.
 func (c *Config) Parse(arguments []string) error {
-	// Parse first to get config file.
-	err := c.FlagSet.Parse(arguments)
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	// Load config file if specified.
-	if c.ConfigFile != "" {
-		err = c.configFromFile(c.ConfigFile)
-		if err != nil {
-			return errors.Trace(err)
-		}
-	}
-
-	// Parse again to replace with command line options.
-	err = c.FlagSet.Parse(arguments)
-	if err != nil {
-		return errors.Trace(err)
-	}
-
-	if len(c.FlagSet.Args()) != 0 {
-		return errors.Errorf("'%s' is an invalid flag", c.FlagSet.Arg(0))
-	}
-
-	return nil
+	binder := utils.NewConfigBinder(c.FlagSet, envPrefix).WithConfigFile(&c.ConfigFile, c)
+	return errors.Trace(binder.Parse(arguments))
 }
 
 func (c *Config) String() string {
 	if c == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("Config(%+v)", *c)
-}
-
-// configFromFile loads config from file.
-func (c *Config) configFromFile(path string) error {
-	_, err := toml.DecodeFile(path, c)
-	return errors.Trace(err)
+	return fmt.Sprintf("Config(%s)", utils.MaskSecrets(c))
 }
 
 func (c *Config) checkConfig() bool {
@@ -290,6 +633,11 @@ func (c *Config) checkConfig() bool {
 		return false
 	}
 
+	if c.SourceChecksumConcurrency < 0 {
+		log.Error("source-checksum-concurrency must be greater than or equal to 0")
+		return false
+	}
+
 	if len(c.SourceDBCfg) == 0 {
 		log.Error("must have at least one source database")
 		return false
@@ -309,8 +657,165 @@ func (c *Config) checkConfig() bool {
 		return false
 	}
 
-	if len(c.Tables) == 0 {
-		log.Error("must specify check tables")
+	if len(c.DMTaskFile) != 0 {
+		task, err := loadDMTask(c.DMTaskFile)
+		if err != nil {
+			log.Error("load dm task file failed", zap.String("file", c.DMTaskFile), zap.Error(err))
+			return false
+		}
+		for _, instance := range task.MySQLInstances {
+			if _, ok := sourceInstanceMap[instance.SourceID]; !ok {
+				log.Error("source-id of dm task is not the instance-id of any source-db", zap.String("source id", instance.SourceID))
+				return false
+			}
+		}
+		c.dmTask = task
+		c.TableRules = append(c.TableRules, task.tableRules()...)
+	}
+
+	if c.TargetDBCfg.DumpDir != "" {
+		log.Error("dump-dir only can be used in source database")
+		return false
+	}
+
+	if c.Quiet && c.Verbose {
+		log.Error("quiet and verbose can't be set together")
+		return false
+	}
+
+	switch c.Mode {
+	case modeFull:
+	case modeQuick:
+		if c.DryRun {
+			log.Error("dry-run can't be used in quick mode")
+			return false
+		}
+	default:
+		log.Error("mode must be full or quick", zap.String("mode", c.Mode))
+		return false
+	}
+
+	switch c.PreCheck {
+	case "", preCheckWarn, preCheckStrict, preCheckOff:
+	default:
+		log.Error("pre-check must be warn, strict or off", zap.String("pre-check", c.PreCheck))
+		return false
+	}
+
+	if c.ReadOnly {
+		// the checkpoint is not used in quick mode, except the tables' data versions
+		if c.CheckpointDBCfg == nil && !c.DryRun && (c.Mode != modeQuick || c.SkipUnchangedTables) {
+			log.Error("need set checkpoint-db in read-only mode, the checkpoint can't be saved in target database")
+			return false
+		}
+		if len(c.PTChecksumTable) != 0 {
+			log.Error("pt-checksum-table can't be used in read-only mode")
+			return false
+		}
+	}
+
+	if c.CheckpointRetentionDays < 0 {
+		log.Error("checkpoint-retention-days must be greater than or equal to 0", zap.Int("checkpoint retention days", c.CheckpointRetentionDays))
+		return false
+	}
+
+	if len(c.Tables) == 0 && c.TableFilter == nil && len(c.DMTaskFile) == 0 {
+		log.Error("must specify check tables, table filter or dm task file")
+		return false
+	}
+
+	if err := c.TableFilter.Valid(); err != nil {
+		log.Error("table-filter is invalid", zap.Error(err))
+		return false
+	}
+
+	if c.TableAttributes != nil {
+		if err := c.TableAttributes.Valid(); err != nil {
+			log.Error("table-attributes is invalid", zap.Error(err))
+			return false
+		}
+	}
+
+	if c.SplitByRegion && len(c.TiDBInstanceID) == 0 {
+		log.Error("split-by-region needs tidb-instance-id")
+		return false
+	}
+
+	if c.MaxChunkDiffRows < 0 {
+		log.Error("max-chunk-diff-rows must be greater than or equal to 0", zap.Int("max-chunk-diff-rows", c.MaxChunkDiffRows))
+		return false
+	}
+
+	if c.ColumnGroupSize < 0 {
+		log.Error("column-group-size must be greater than or equal to 0", zap.Int("column-group-size", c.ColumnGroupSize))
+		return false
+	}
+
+	if c.MaxDeleteRows < 0 || c.MaxDeleteRatio < 0 || c.MaxDeleteRatio > 1 {
+		log.Error("max-delete-rows must be greater than or equal to 0, and max-delete-ratio must be in [0, 1]")
+		return false
+	}
+
+	if _, err := diff.NewDialect(c.FixSQLDialect); err != nil {
+		log.Error("fix-sql-dialect is invalid", zap.Error(err))
+		return false
+	}
+
+	if len(c.RetryDelay) != 0 {
+		if d, err := time.ParseDuration(c.RetryDelay); err != nil || d < 0 {
+			log.Error("retry-delay is invalid", zap.String("retry delay", c.RetryDelay), zap.Error(err))
+			return false
+		}
+	}
+
+	if len(c.DoubleReadDelay) != 0 {
+		if d, err := time.ParseDuration(c.DoubleReadDelay); err != nil || d < 0 {
+			log.Error("double-read-delay is invalid", zap.String("double read delay", c.DoubleReadDelay), zap.Error(err))
+			return false
+		}
+	}
+
+	if c.TimeoutSplitTimes < 0 {
+		log.Error("timeout-split-times must be greater than or equal to 0", zap.Int("timeout split times", c.TimeoutSplitTimes))
+		return false
+	}
+
+	if _, err := c.Timeouts.policy(); err != nil {
+		log.Error("timeouts is invalid", zap.Error(err))
+		return false
+	}
+
+	if err := c.OnlineCheck.valid(); err != nil {
+		log.Error("online-check is invalid", zap.Error(err))
+		return false
+	}
+	if c.OnlineCheck.enabled() && (len(c.SourceDBCfg) != 1 || c.SourceDBCfg[0].DumpDir != "") {
+		log.Error("online-check only supports one source database")
+		return false
+	}
+
+	if c.FixSQLMaxFileSize < 0 {
+		log.Error("fix-sql-max-file-size must be greater than or equal to 0")
+		return false
+	}
+
+	if len(c.DiffRowsFile) != 0 {
+		if len(c.DiffRowsFormat) == 0 {
+			c.DiffRowsFormat = diff.ExportFormatCSV
+		}
+		if c.DiffRowsFormat != diff.ExportFormatCSV && c.DiffRowsFormat != diff.ExportFormatJSON {
+			log.Error("diff-rows-format must be csv or json", zap.String("format", c.DiffRowsFormat))
+			return false
+		}
+	}
+
+	if len(c.PTChecksumTable) != 0 {
+		if _, _, err := splitTableName(c.PTChecksumTable); err != nil {
+			log.Error("pt-checksum-table is invalid", zap.Error(err))
+			return false
+		}
+	} else if c.UsePTChecksum {
+		log.Error("need set pt-checksum-table when use-pt-checksum is true")
 		return false
 	}
 
@@ -318,6 +823,59 @@ func (c *Config) checkConfig() bool {
 		if !tableCfg.Valid() {
 			return false
 		}
+		if c.ReverseFixSQL && tableCfg.IsSharding {
+			log.Error("reverse-fix-sql doesn't support the sharding tables, the rows only in target table can't be routed to their shards", zap.String("table", dbutil.TableName(tableCfg.Schema, tableCfg.Table)))
+			return false
+		}
+	}
+
+	if _, err := c.PriorityTimeBudget.budgets(); err != nil {
+		log.Error("priority-time-budget is invalid", zap.Error(err))
+		return false
+	}
+
+	if len(c.DriftAlertWebhook) != 0 && !c.RecordHistory {
+		log.Error("need set record-history = true when drift-alert-webhook is set")
+		return false
+	}
+
+	if c.SummaryExportDBCfg != nil {
+		if len(c.SummaryExportDBCfg.Schema) == 0 {
+			log.Error("must specify the schema of summary-export-db")
+			return false
+		}
+		if len(c.SummaryExportTable) == 0 {
+			c.SummaryExportTable = "table_result"
+		}
+	}
+
+	if c.RedactFixSQL && !c.Redact {
+		log.Error("need set redact = true when redact-fix-sql is true")
+		return false
+	}
+
+	if c.TableConcurrency < 0 {
+		log.Error("table-concurrency must not be negative", zap.Int("table-concurrency", c.TableConcurrency))
+		return false
+	}
+
+	if c.GlobalMaxConcurrentChunks < 0 {
+		log.Error("global-max-concurrent-chunks must not be negative", zap.Int("global-max-concurrent-chunks", c.GlobalMaxConcurrentChunks))
+		return false
+	}
+
+	if c.MemoryBudget < 0 {
+		log.Error("memory-budget must not be negative", zap.Int64("memory-budget", c.MemoryBudget))
+		return false
+	}
+	if c.MemoryLimit < 0 {
+		log.Error("memory-limit must not be negative", zap.Int64("memory-limit", c.MemoryLimit))
+		return false
+	}
+
+	if c.QPSLimit < 0 {
+		log.Error("qps-limit must not be negative", zap.Int("qps-limit", c.QPSLimit))
+		return false
 	}
 
 	if c.OnlyUseChecksum {
@@ -325,7 +883,7 @@ func (c *Config) checkConfig() bool {
 			log.Error("need set use-checksum = true")
 			return false
 		}
-	} else {
+	} else if len(c.FixSQLDir) == 0 {
 		if len(c.FixSQLFile) == 0 {
 			log.Warn("fix-sql-file is invalid, will use default value 'fix.sql'")
 			c.FixSQLFile = "fix.sql"
@@ -0,0 +1,110 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// the levels of the console summary.
+const (
+	// consoleQuiet only prints the result of the run
+	consoleQuiet = "quiet"
+	// consoleNormal prints the result and the tables not equal
+	consoleNormal = "normal"
+	// consoleVerbose prints the result and all the tables
+	consoleVerbose = "verbose"
+)
+
+const (
+	colorGreen = "\x1b[32m"
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// consoleLevel returns the level of the console summary.
+func (c *Config) consoleLevel() string {
+	switch {
+	case c.Quiet:
+		return consoleQuiet
+	case c.Verbose:
+		return consoleVerbose
+	default:
+		return consoleNormal
+	}
+}
+
+// isTerminal returns true if the file is a terminal and the color is not disabled by the environment variable NO_COLOR.
+func isTerminal(f *os.File) bool {
+	if len(os.Getenv("NO_COLOR")) != 0 {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeConsoleSummary writes the human-friendly summary of the run, every table is in one line with ✓ or ✗.
+func writeConsoleSummary(w io.Writer, summary *Summary, level string, color bool) {
+	paint := func(text, colorCode string) string {
+		if !color {
+			return text
+		}
+		return colorCode + text + colorReset
+	}
+	mark := func(ok bool) string {
+		if ok {
+			return paint("✓", colorGreen)
+		}
+		return paint("✗", colorRed)
+	}
+
+	pass := summary.ExitCode == exitCodeEqual
+	result := paint("PASS", colorGreen)
+	if !pass {
+		result = paint(fmt.Sprintf("FAIL (exit code %d)", summary.ExitCode), colorRed)
+	}
+	cost := summary.EndTime.Sub(summary.StartTime).Round(time.Millisecond)
+	fmt.Fprintf(w, "%s %s  %d passed, %d failed, %d skipped in %s\n", mark(pass), result, summary.PassNum, summary.FailedNum, summary.SkippedNum, cost)
+	if len(summary.Error) != 0 {
+		fmt.Fprintf(w, "  error: %s\n", summary.Error)
+	}
+	if level == consoleQuiet {
+		return
+	}
+
+	for _, table := range summary.Tables {
+		equal := table.Verdict == verdictEqual
+		if equal && level != consoleVerbose {
+			continue
+		}
+
+		line := fmt.Sprintf("  %s %s  %s", mark(equal), dbutil.TableName(table.Schema, table.Table), table.Verdict)
+		if table.SourceRows != nil && table.TargetRows != nil {
+			line += fmt.Sprintf("  rows %d/%d", *table.SourceRows, *table.TargetRows)
+		}
+		line += fmt.Sprintf("  %s", time.Duration(table.Duration*float64(time.Second)).Round(time.Millisecond))
+		if len(table.Error) != 0 {
+			line += fmt.Sprintf("  error: %s", table.Error)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
@@ -15,14 +15,24 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"net/http"
 	"os"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/check"
+	column "github.com/pingcap/tidb-tools/pkg/column-mapping"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/diff"
+	"github.com/pingcap/tidb-tools/pkg/filter"
 	router "github.com/pingcap/tidb-tools/pkg/table-router"
 	"github.com/pingcap/tidb-tools/pkg/utils"
 	"go.uber.org/zap"
@@ -30,22 +40,88 @@ import (
 
 // Diff contains two sql DB, used for comparing.
 type Diff struct {
-	sourceDBs         map[string]DBConfig
-	targetDB          DBConfig
-	chunkSize         int
-	sample            int
-	checkThreadCount  int
-	useRowID          bool
-	useChecksum       bool
-	useCheckpoint     bool
-	onlyUseChecksum   bool
-	ignoreDataCheck   bool
-	ignoreStructCheck bool
-	tables            map[string]map[string]*TableConfig
-	fixSQLFile        *os.File
-	report            *Report
-	tidbInstanceID    string
-	tableRouter       *router.Table
+	sourceDBs                 map[string]DBConfig
+	targetDB                  DBConfig
+	checkpointDB              *sql.DB
+	checkpointRetentionDays   int
+	chunkSize                 int
+	sample                    int
+	checkThreadCount          int
+	tableConcurrency          int
+	globalLimiter             *diff.ConcurrencyLimiter
+	tuning                    *diff.Tuning
+	useRowID                  bool
+	useChecksum               bool
+	useCheckpoint             bool
+	resumeFailedChunks        bool
+	recheckFailed             bool
+	onlyUseChecksum           bool
+	ignoreDataCheck           bool
+	checkIndexes              bool
+	ignoreStructCheck         bool
+	checkEnumOrder            bool
+	checkConstraints          bool
+	strictCharset             bool
+	compareViews              bool
+	tidbAttributes            *diff.TiDBAttributesCheck
+	tables                    map[string]map[string]*TableConfig
+	fixSQLFile                *os.File
+	fixSQLFileLock            sync.Mutex
+	fixSQLWriter              *diff.FixSQLWriter
+	diffRowsFile              *os.File
+	rowDiffExporter           diff.RowDiffExporter
+	chunkArtifactsFile        *os.File
+	chunkArtifactExporter     diff.ChunkArtifactExporter
+	reverseFixSQL             bool
+	useUpdateSQL              bool
+	hashLongColumns           bool
+	redact                    bool
+	redactFixSQL              bool
+	maxDeleteRows             int64
+	maxChunkDiffRows          int
+	columnGroupSize           int
+	maxDeleteRatio            float64
+	ptChecksumSchema          string
+	ptChecksumTable           string
+	usePTChecksum             bool
+	report                    *Report
+	tidbInstanceID            string
+	splitByRegion             bool
+	checkAccounts             bool
+	ignoreAccounts            []string
+	tableRouter               *router.Table
+	tableAttributes           map[string]map[filter.Table]*filter.TableAttributes
+	columnMapping             *column.Mapping
+	limiters                  map[string]*diff.ConcurrencyLimiter
+	dryRun                    bool
+	quickMode                 bool
+	skipUnchangedTables       bool
+	priorityBudgets           map[string]time.Duration
+	sourceChecksumConcurrency int
+	fixSQLDialect             diff.Dialect
+	rowCountCheck             bool
+	retryFailedChunks         bool
+	retryDelay                time.Duration
+	doubleReadDelay           time.Duration
+	timeoutSplitTimes         int
+	timeouts                  *dbutil.TimeoutPolicy
+	replicationWaiter         diff.ReplicationWaiter
+	lagRecheckTimes           int
+	metadataCache             *dbutil.MetadataCache
+	metricsSnapshotFile       string
+	recordHistory             bool
+	runID                     string
+	driftNotifier             diff.DriftNotifier
+	summaryExportDB           *sql.DB
+	summaryExporter           *diff.SummaryExporter
+	runMetrics                *diff.RunMetrics
+	pauser                    *diff.Pauser
+	inFlight                  *diff.InFlightTracker
+	memoryLimiter             *diff.MemoryLimiter
+	stopWatchDumpSignals      func()
+	status                    *statusTracker
+	stopWatchPauseSignals     func()
+	httpServer                *http.Server
 
 	ctx context.Context
 }
@@ -53,20 +129,56 @@ type Diff struct {
 // NewDiff returns a Diff instance.
 func NewDiff(ctx context.Context, cfg *Config) (diff *Diff, err error) {
 	diff = &Diff{
-		sourceDBs:         make(map[string]DBConfig),
-		chunkSize:         cfg.ChunkSize,
-		sample:            cfg.Sample,
-		checkThreadCount:  cfg.CheckThreadCount,
-		useRowID:          cfg.UseRowID,
-		useChecksum:       cfg.UseChecksum,
-		useCheckpoint:     cfg.UseCheckpoint,
-		onlyUseChecksum:   cfg.OnlyUseChecksum,
-		ignoreDataCheck:   cfg.IgnoreDataCheck,
-		ignoreStructCheck: cfg.IgnoreStructCheck,
-		tidbInstanceID:    cfg.TiDBInstanceID,
-		tables:            make(map[string]map[string]*TableConfig),
-		report:            NewReport(),
-		ctx:               ctx,
+		sourceDBs:                 make(map[string]DBConfig),
+		chunkSize:                 cfg.ChunkSize,
+		sample:                    cfg.Sample,
+		checkThreadCount:          cfg.CheckThreadCount,
+		tableConcurrency:          cfg.TableConcurrency,
+		useRowID:                  cfg.UseRowID,
+		useChecksum:               cfg.UseChecksum,
+		useCheckpoint:             cfg.UseCheckpoint && !cfg.DryRun,
+		resumeFailedChunks:        cfg.ResumeFailedChunks,
+		recheckFailed:             cfg.RecheckFailed,
+		checkpointRetentionDays:   cfg.CheckpointRetentionDays,
+		onlyUseChecksum:           cfg.OnlyUseChecksum,
+		ignoreDataCheck:           cfg.IgnoreDataCheck,
+		checkIndexes:              cfg.CheckIndexes,
+		ignoreStructCheck:         cfg.IgnoreStructCheck,
+		checkEnumOrder:            cfg.CheckEnumOrder,
+		checkConstraints:          cfg.CheckConstraints,
+		strictCharset:             cfg.StrictCharset,
+		compareViews:              cfg.CompareViews,
+		tidbAttributes:            cfg.TiDBAttributes,
+		tidbInstanceID:            cfg.TiDBInstanceID,
+		splitByRegion:             cfg.SplitByRegion,
+		checkAccounts:             cfg.CheckAccounts,
+		ignoreAccounts:            cfg.IgnoreAccounts,
+		maxDeleteRows:             cfg.MaxDeleteRows,
+		maxChunkDiffRows:          cfg.MaxChunkDiffRows,
+		columnGroupSize:           cfg.ColumnGroupSize,
+		maxDeleteRatio:            cfg.MaxDeleteRatio,
+		usePTChecksum:             cfg.UsePTChecksum,
+		reverseFixSQL:             cfg.ReverseFixSQL,
+		useUpdateSQL:              cfg.UseUpdateSQL,
+		hashLongColumns:           cfg.HashLongColumns,
+		redact:                    cfg.Redact,
+		redactFixSQL:              cfg.RedactFixSQL,
+		dryRun:                    cfg.DryRun,
+		quickMode:                 cfg.Mode == modeQuick,
+		skipUnchangedTables:       cfg.SkipUnchangedTables && !cfg.DryRun,
+		sourceChecksumConcurrency: cfg.SourceChecksumConcurrency,
+		rowCountCheck:             cfg.RowCountCheck,
+		retryFailedChunks:         cfg.RetryFailedChunks,
+		timeoutSplitTimes:         cfg.TimeoutSplitTimes,
+		lagRecheckTimes:           cfg.OnlineCheck.RecheckTimes,
+		metadataCache:             dbutil.NewMetadataCache(),
+		metricsSnapshotFile:       cfg.MetricsSnapshotFile,
+		recordHistory:             cfg.RecordHistory && !cfg.DryRun && cfg.Mode != modeQuick,
+		runID:                     time.Now().Format("20060102150405"),
+		tables:                    make(map[string]map[string]*TableConfig),
+		report:                    NewReport(),
+		status:                    newStatusTracker(),
+		ctx:                       ctx,
 	}
 
 	if err = diff.init(cfg); err != nil {
@@ -87,65 +199,324 @@ func (df *Diff) init(cfg *Config) (err error) {
 		return errors.Trace(err)
 	}
 
-	df.fixSQLFile, err = os.Create(cfg.FixSQLFile)
+	df.fixSQLDialect, err = diff.NewDialect(cfg.FixSQLDialect)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
+	df.priorityBudgets, err = cfg.PriorityTimeBudget.budgets()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	df.timeouts, err = cfg.Timeouts.policy()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if cfg.OnlineCheck.enabled() {
+		df.replicationWaiter, err = cfg.OnlineCheck.replicationWaiter(df.sourceDBs[cfg.SourceDBCfg[0].InstanceID].Conn, df.targetDB.Conn)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if len(cfg.RetryDelay) != 0 {
+		df.retryDelay, err = time.ParseDuration(cfg.RetryDelay)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if len(cfg.DoubleReadDelay) != 0 {
+		df.doubleReadDelay, err = time.ParseDuration(cfg.DoubleReadDelay)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if len(cfg.PTChecksumTable) != 0 {
+		df.ptChecksumSchema, df.ptChecksumTable, err = splitTableName(cfg.PTChecksumTable)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	// dry-run only estimates the tables, the output files are not created
+	if !cfg.DryRun {
+		if err = df.createOutputFiles(cfg); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if len(cfg.MetricsSnapshotFile) != 0 && !cfg.DryRun {
+		df.runMetrics = diff.NewRunMetrics()
+	}
+
+	if len(cfg.DriftAlertWebhook) != 0 {
+		df.driftNotifier = diff.NewWebhookDriftNotifier(cfg.DriftAlertWebhook, dbutil.DefaultTimeout)
+	}
+
+	df.pauser = diff.NewPauser()
+	df.stopWatchPauseSignals = df.watchPauseSignals()
+	df.inFlight = diff.NewInFlightTracker()
+	if cfg.MemoryBudget > 0 || cfg.MemoryLimit > 0 {
+		df.memoryLimiter = diff.NewMemoryLimiter(cfg.MemoryBudget<<20, cfg.SpillDir)
+		df.memoryLimiter.SetHardLimit(cfg.MemoryLimit << 20)
+	}
+	df.stopWatchDumpSignals = df.watchDumpSignals()
+
+	// the pre-checks are run by check-config itself
+	if cfg.PreCheck != preCheckOff && !cfg.CheckConfig {
+		var results *check.Results
+		if results, err = df.preCheck(cfg); err != nil {
+			return errors.Trace(err)
+		}
+		if !results.Summary.Passed && cfg.PreCheck == preCheckStrict {
+			return utils.ErrInvalidConfig.New("%d of %d pre-checks failed", results.Summary.Failed, results.Summary.Total)
+		}
+	}
+
+	if len(cfg.StatusAddr) != 0 {
+		if err = df.startHTTPServer(cfg.StatusAddr); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	return nil
 }
 
-func (df *Diff) CreateDBConn(cfg *Config) (err error) {
-	// SetMaxOpenConns and SetMaxIdleConns for connection to avoid error like
-	// `dial tcp 10.26.2.1:3306: connect: cannot assign requested address`
-	for _, source := range cfg.SourceDBCfg {
-		source.Conn, err = dbutil.OpenDB(source.DBConfig)
+// createOutputFiles creates the files of the fix sqls, the different rows and the chunk artifacts.
+func (df *Diff) createOutputFiles(cfg *Config) (err error) {
+	if len(cfg.FixSQLDir) != 0 {
+		df.fixSQLWriter, err = diff.NewFixSQLWriter(cfg.FixSQLDir, cfg.FixSQLMaxFileSize)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	} else {
+		df.fixSQLFile, err = os.Create(cfg.FixSQLFile)
 		if err != nil {
-			return errors.Errorf("create source db %+v error %v", source.DBConfig, err)
+			return errors.Trace(err)
 		}
-		source.Conn.SetMaxOpenConns(cfg.CheckThreadCount)
-		source.Conn.SetMaxIdleConns(cfg.CheckThreadCount)
+	}
 
-		df.sourceDBs[source.InstanceID] = source
-		if source.Snapshot != "" {
-			err = dbutil.SetSnapshot(df.ctx, source.Conn, source.Snapshot)
+	if len(cfg.DiffRowsFile) != 0 {
+		df.diffRowsFile, err = os.Create(cfg.DiffRowsFile)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		df.rowDiffExporter, err = diff.NewRowDiffExporter(cfg.DiffRowsFormat, df.diffRowsFile)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if len(cfg.ChunkArtifactsFile) != 0 {
+		df.chunkArtifactsFile, err = os.Create(cfg.ChunkArtifactsFile)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		df.chunkArtifactExporter = diff.NewChunkArtifactExporter(df.chunkArtifactsFile)
+	}
+
+	return nil
+}
+
+func (df *Diff) CreateDBConn(cfg *Config) (err error) {
+	// the table's check-thread-count may be greater than the global config
+	maxThreadCount := cfg.CheckThreadCount
+	for _, tableCfg := range cfg.TableCfgs {
+		if tableCfg.CheckThreadCount > maxThreadCount {
+			maxThreadCount = tableCfg.CheckThreadCount
+		}
+	}
+
+	// the tables checked concurrently use the same connection pool
+	maxConnCount := maxThreadCount
+	if cfg.TableConcurrency > 1 {
+		maxConnCount *= cfg.TableConcurrency
+	}
+	if cfg.GlobalMaxConcurrentChunks > 0 && cfg.GlobalMaxConcurrentChunks < maxConnCount {
+		maxConnCount = cfg.GlobalMaxConcurrentChunks
+	}
+	if maxConnCount < maxThreadCount {
+		maxConnCount = maxThreadCount
+	}
+
+	df.limiters = make(map[string]*diff.ConcurrencyLimiter)
+	if cfg.GlobalMaxConcurrentChunks > 0 {
+		df.globalLimiter = diff.NewConcurrencyLimiter("global", cfg.GlobalMaxConcurrentChunks)
+	}
+	// the tuning is created even if no limit, so the qps limit and the sample can be changed by the HTTP API at runtime
+	df.tuning, err = diff.NewTuning(cfg.QPSLimit, 0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	openDB := dbutil.OpenDB
+	if cfg.ReadOnly {
+		log.Info("read-only mode, only read-only statements are allowed in source and target databases")
+		openDB = dbutil.OpenReadOnlyDB
+	}
+
+	// connect opens the connection of the source or target, and sets the history snapshot.
+	connect := func(db *DBConfig) error {
+		readCfg, err := db.readDBConfig()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		conn, err := openDB(readCfg)
+		if err != nil {
+			return utils.ErrConnectDB.Wrap(err, "create db %+v", readCfg)
+		}
+		if desc := db.replicaReadDesc(); len(desc) != 0 {
+			log.Warn("read from replicas, the data may be not consistent between the instances", zap.String("instance id", db.InstanceID), zap.String("replica read", desc))
+			df.report.SetReplicaRead(db.InstanceID, desc)
+		}
+		// SetMaxOpenConns and SetMaxIdleConns for connection to avoid error like
+		// `dial tcp 10.26.2.1:3306: connect: cannot assign requested address`, unless they are set in the config
+		if db.MaxOpenConns == 0 {
+			conn.SetMaxOpenConns(maxConnCount)
+		}
+		if db.MaxIdleConns == 0 {
+			conn.SetMaxIdleConns(maxConnCount)
+		}
+		db.Conn = conn
+		if db.Snapshot != "" {
+			err = dbutil.SetSnapshot(df.ctx, conn, db.Snapshot)
 			if err != nil {
-				return errors.Errorf("set history snapshot %s for source db %+v error %v", source.Snapshot, source.DBConfig, err)
+				return utils.ErrConnectDB.Wrap(err, "set history snapshot %s for db %+v", db.Snapshot, db.DBConfig)
 			}
 		}
+		return nil
 	}
 
-	// create connection for target.
-	cfg.TargetDBCfg.Conn, err = dbutil.OpenDB(cfg.TargetDBCfg.DBConfig)
-	if err != nil {
-		return errors.Errorf("create target db %+v error %v", cfg.TargetDBCfg, err)
+	for _, source := range cfg.SourceDBCfg {
+		// the limiter is created even if no limit, so the limit can be changed by the HTTP API at runtime
+		df.limiters[source.InstanceID] = diff.NewConcurrencyLimiter(source.InstanceID, source.MaxConcurrentChunks)
+		df.sourceDBs[source.InstanceID] = source
+
+		// the rows are read from the files, don't need connection.
+		if source.DumpDir != "" {
+			log.Info("use dump directory as source", zap.String("instance id", source.InstanceID), zap.String("dump dir", source.DumpDir))
+			continue
+		}
+
+		if err = connect(&source); err != nil {
+			return errors.Annotatef(err, "source %s", source.InstanceID)
+		}
+		df.sourceDBs[source.InstanceID] = source
 	}
-	cfg.TargetDBCfg.Conn.SetMaxOpenConns(cfg.CheckThreadCount)
-	cfg.TargetDBCfg.Conn.SetMaxIdleConns(cfg.CheckThreadCount)
 
+	// create connection for target.
+	if err = connect(&cfg.TargetDBCfg); err != nil {
+		return errors.Annotatef(err, "target %s", cfg.TargetDBCfg.InstanceID)
+	}
+	df.limiters[cfg.TargetDBCfg.InstanceID] = diff.NewConcurrencyLimiter(cfg.TargetDBCfg.InstanceID, cfg.TargetDBCfg.MaxConcurrentChunks)
 	df.targetDB = cfg.TargetDBCfg
-	if cfg.TargetDBCfg.Snapshot != "" {
-		err = dbutil.SetSnapshot(df.ctx, cfg.TargetDBCfg.Conn, cfg.TargetDBCfg.Snapshot)
+
+	if err = df.checkSessionVariables(cfg.AlignSessionVariables, connect); err != nil {
+		return errors.Trace(err)
+	}
+
+	// create connection for checkpoint, it needs to be written even in read-only mode.
+	if cfg.CheckpointDBCfg != nil {
+		df.checkpointDB, err = dbutil.OpenDB(*cfg.CheckpointDBCfg)
 		if err != nil {
-			return errors.Errorf("set history snapshot %s for target db %+v error %v", cfg.TargetDBCfg.Snapshot, cfg.TargetDBCfg, err)
+			return utils.ErrConnectDB.Wrap(err, "create checkpoint db %+v", cfg.CheckpointDBCfg)
+		}
+	} else {
+		df.checkpointDB = df.targetDB.Conn
+	}
+
+	if cfg.SummaryExportDBCfg != nil && !cfg.DryRun {
+		df.summaryExportDB, err = dbutil.OpenDB(*cfg.SummaryExportDBCfg)
+		if err != nil {
+			return utils.ErrConnectDB.Wrap(err, "create summary export db %+v", cfg.SummaryExportDBCfg)
+		}
+		df.summaryExporter, err = diff.NewSummaryExporter(df.ctx, df.summaryExportDB, cfg.SummaryExportDBCfg.Schema, cfg.SummaryExportTable)
+		if err != nil {
+			return errors.Annotate(err, "create summary export table")
 		}
 	}
 
 	return nil
 }
 
+// filterTablesByAttributes returns the tables whose attributes in target database match the rules.
+func (df *Diff) filterTablesByAttributes(rules *filter.AttributeRules, schema string, tables []string, allTablesMap map[string]map[string]map[string]interface{}) ([]string, error) {
+	attrs, err := df.getTableAttributes(df.targetDB.InstanceID, df.targetDB.Conn, allTablesMap[df.targetDB.InstanceID])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	matchedTables := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if rules.Match(attrs[filter.Table{Schema: schema, Name: table}]) {
+			matchedTables = append(matchedTables, table)
+		}
+	}
+	log.Info("filter tables by attributes", zap.String("schema", schema), zap.Int("table num", len(tables)), zap.Strings("matched tables", matchedTables))
+
+	return matchedTables, nil
+}
+
+// discoverTables returns the tables matched by the filter rules in target database, schema => tables.
+// the system schemas and the checkpoint schema are ignored.
+func discoverTables(rules *filter.Rules, allTables map[string]map[string]interface{}) map[string][]string {
+	discoveredTables := make(map[string][]string)
+	if rules == nil {
+		return discoveredTables
+	}
+
+	filterTables := make([]*filter.Table, 0, len(allTables))
+	for schema, tables := range allTables {
+		if filter.IsSystemSchema(schema) || diff.IsCheckpointSchema(schema) {
+			continue
+		}
+		for table := range tables {
+			filterTables = append(filterTables, &filter.Table{Schema: schema, Name: table})
+		}
+	}
+
+	for _, table := range filter.New(false, rules).ApplyOn(filterTables) {
+		discoveredTables[table.Schema] = append(discoveredTables[table.Schema], table.Name)
+	}
+	for schema, tables := range discoveredTables {
+		sort.Strings(tables)
+		log.Info("discover tables by table filter", zap.String("schema", schema), zap.Strings("tables", tables))
+	}
+
+	return discoveredTables
+}
+
 // AdjustTableConfig adjusts the table's config by check-tables and table-config.
 func (df *Diff) AdjustTableConfig(cfg *Config) (err error) {
 	df.tableRouter, err = router.NewTableRouter(false, cfg.TableRules)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	df.columnMapping, err = column.NewMapping(false, cfg.ColumnMappingRules)
+	if err != nil {
+		return errors.Trace(err)
+	}
 
 	allTablesMap, err := df.GetAllTables(cfg)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
+	if cfg.dmTask != nil {
+		if err = df.applyDMTask(cfg, allTablesMap); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if df.tableRouter.HasAttributeRules() {
+		if err = df.setTableAttributes(allTablesMap); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	// get all source table's matched target table
 	// target database name => target table name => all matched source table instance
 	sourceTablesMap := make(map[string]map[string][]TableInstance)
@@ -156,7 +527,7 @@ func (df *Diff) AdjustTableConfig(cfg *Config) (err error) {
 
 		for schema, allTables := range allSchemas {
 			for table := range allTables {
-				targetSchema, targetTable, err := df.tableRouter.Route(schema, table)
+				targetSchema, targetTable, err := df.tableRouter.RouteWithInstance(instanceID, schema, table)
 				if err != nil {
 					return errors.Errorf("get route result for %s.%s.%s failed, error %v", instanceID, schema, table, err)
 				}
@@ -180,6 +551,38 @@ func (df *Diff) AdjustTableConfig(cfg *Config) (err error) {
 
 	// fill the table information.
 	// will add default source information, don't worry, we will use table config's info replace this later.
+	addTable := func(schema, tableName string) error {
+		tableInfo, err := df.metadataCache.GetTableInfoWithRowID(df.ctx, df.targetDB.Conn, schema, tableName, cfg.UseRowID)
+		if err != nil {
+			return errors.Errorf("get table %s.%s's inforamtion error %s", schema, tableName, errors.ErrorStack(err))
+		}
+
+		sourceTables := make([]TableInstance, 0, 1)
+		if _, ok := sourceTablesMap[schema][tableName]; ok {
+			log.Info("find matched source tables", zap.Reflect("source tables", sourceTablesMap[schema][tableName]), zap.String("target schema", schema), zap.String("table", tableName))
+			sourceTables = sourceTablesMap[schema][tableName]
+		} else {
+			// use same database name and table name
+			sourceTables = append(sourceTables, TableInstance{
+				InstanceID: cfg.SourceDBCfg[0].InstanceID,
+				Schema:     schema,
+				Table:      tableName,
+			})
+		}
+
+		df.tables[schema][tableName] = &TableConfig{
+			TableInstance: TableInstance{
+				Schema: schema,
+				Table:  tableName,
+			},
+			IgnoreColumns:   make([]string, 0, 1),
+			TargetTableInfo: tableInfo,
+			Range:           "TRUE",
+			SourceTables:    sourceTables,
+		}
+		return nil
+	}
+
 	for _, schemaTables := range cfg.Tables {
 		df.tables[schemaTables.Schema] = make(map[string]*TableConfig)
 		tables := make([]string, 0, len(schemaTables.Tables))
@@ -196,60 +599,66 @@ func (df *Diff) AdjustTableConfig(cfg *Config) (err error) {
 			tables = append(tables, matchedTables...)
 		}
 
-		for _, tableName := range tables {
-			tableInfo, err := dbutil.GetTableInfoWithRowID(df.ctx, df.targetDB.Conn, schemaTables.Schema, tableName, cfg.UseRowID)
+		if cfg.TableAttributes != nil {
+			tables, err = df.filterTablesByAttributes(cfg.TableAttributes, schemaTables.Schema, tables, allTablesMap)
 			if err != nil {
-				return errors.Errorf("get table %s.%s's inforamtion error %s", schemaTables.Schema, tableName, errors.ErrorStack(err))
+				return errors.Trace(err)
 			}
+		}
 
+		for _, tableName := range tables {
 			if _, ok := df.tables[schemaTables.Schema][tableName]; ok {
 				log.Error("duplicate config for one table", zap.String("table", dbutil.TableName(schemaTables.Schema, tableName)))
 				continue
 			}
 
-			sourceTables := make([]TableInstance, 0, 1)
-			if _, ok := sourceTablesMap[schemaTables.Schema][tableName]; ok {
-				log.Info("find matched source tables", zap.Reflect("source tables", sourceTablesMap[schemaTables.Schema][tableName]), zap.String("target schema", schemaTables.Schema), zap.String("table", tableName))
-				sourceTables = sourceTablesMap[schemaTables.Schema][tableName]
-			} else {
-				// use same database name and table name
-				sourceTables = append(sourceTables, TableInstance{
-					InstanceID: cfg.SourceDBCfg[0].InstanceID,
-					Schema:     schemaTables.Schema,
-					Table:      tableName,
-				})
+			if err = addTable(schemaTables.Schema, tableName); err != nil {
+				return errors.Trace(err)
 			}
+		}
+	}
 
-			df.tables[schemaTables.Schema][tableName] = &TableConfig{
-				TableInstance: TableInstance{
-					Schema: schemaTables.Schema,
-					Table:  tableName,
-				},
-				IgnoreColumns:   make([]string, 0, 1),
-				TargetTableInfo: tableInfo,
-				Range:           "TRUE",
-				SourceTables:    sourceTables,
+	// the discovered tables already in check-tables are ignored
+	discoveredTables := discoverTables(cfg.TableFilter, allTablesMap[df.targetDB.InstanceID])
+	for schema, tables := range discoveredTables {
+		if cfg.TableAttributes != nil {
+			tables, err = df.filterTablesByAttributes(cfg.TableAttributes, schema, tables, allTablesMap)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		if _, ok := df.tables[schema]; !ok {
+			df.tables[schema] = make(map[string]*TableConfig)
+		}
+		for _, tableName := range tables {
+			if _, ok := df.tables[schema][tableName]; ok {
+				continue
+			}
+
+			if err = addTable(schema, tableName); err != nil {
+				return errors.Trace(err)
 			}
 		}
 	}
 
 	for _, table := range cfg.TableCfgs {
 		if _, ok := df.tables[table.Schema]; !ok {
-			return errors.NotFoundf("schema %s in check tables", table.Schema)
+			return utils.ErrTableNotFound.New("schema %s in check tables not found", table.Schema)
 		}
 		if _, ok := df.tables[table.Schema][table.Table]; !ok {
-			return errors.NotFoundf("table %s.%s in check tables", table.Schema, table.Table)
+			return utils.ErrTableNotFound.New("table %s.%s in check tables not found", table.Schema, table.Table)
 		}
 
 		sourceTables := make([]TableInstance, 0, len(table.SourceTables))
 		for _, sourceTable := range table.SourceTables {
 			if _, ok := df.sourceDBs[sourceTable.InstanceID]; !ok {
-				return errors.Errorf("unkonwn database instance id %s", sourceTable.InstanceID)
+				return utils.ErrInvalidConfig.New("unkonwn database instance id %s", sourceTable.InstanceID)
 			}
 
 			allTables, ok := allTablesMap[df.sourceDBs[sourceTable.InstanceID].InstanceID][sourceTable.Schema]
 			if !ok {
-				return errors.Errorf("unknown schema %s in database %+v", sourceTable.Schema, df.sourceDBs[sourceTable.InstanceID])
+				return utils.ErrTableNotFound.New("unknown schema %s in database %+v", sourceTable.Schema, df.sourceDBs[sourceTable.InstanceID])
 			}
 
 			tables, err := df.GetMatchTable(df.sourceDBs[sourceTable.InstanceID], sourceTable.Schema, sourceTable.Table, allTables)
@@ -262,6 +671,7 @@ func (df *Diff) AdjustTableConfig(cfg *Config) (err error) {
 					InstanceID: sourceTable.InstanceID,
 					Schema:     sourceTable.Schema,
 					Table:      table,
+					Range:      sourceTable.Range,
 				})
 			}
 		}
@@ -273,14 +683,81 @@ func (df *Diff) AdjustTableConfig(cfg *Config) (err error) {
 			df.tables[table.Schema][table.Table].Range = table.Range
 		}
 		df.tables[table.Schema][table.Table].IgnoreColumns = table.IgnoreColumns
+		df.tables[table.Schema][table.Table].CheckColumns = table.CheckColumns
 		df.tables[table.Schema][table.Table].RemoveColumns = table.RemoveColumns
+		df.tables[table.Schema][table.Table].BusinessKey = table.BusinessKey
+		df.tables[table.Schema][table.Table].RedactColumns = table.RedactColumns
 		df.tables[table.Schema][table.Table].Fields = table.Fields
+		df.tables[table.Schema][table.Table].IndexHint = table.IndexHint
 		df.tables[table.Schema][table.Table].Collation = table.Collation
+		df.tables[table.Schema][table.Table].MaxDeleteRows = table.MaxDeleteRows
+		df.tables[table.Schema][table.Table].MaxDeleteRatio = table.MaxDeleteRatio
+		df.tables[table.Schema][table.Table].CheckThreadCount = table.CheckThreadCount
+		df.tables[table.Schema][table.Table].SoftDeleteColumn = table.SoftDeleteColumn
+		df.tables[table.Schema][table.Table].SoftDeleteValues = table.SoftDeleteValues
+		df.tables[table.Schema][table.Table].ColumnComparators = table.ColumnComparators
+		df.tables[table.Schema][table.Table].ColumnExprs = table.ColumnExprs
+		df.tables[table.Schema][table.Table].ExternalChunkResults = table.ExternalChunkResults
+		df.tables[table.Schema][table.Table].AggregateColumns = table.AggregateColumns
+		df.tables[table.Schema][table.Table].Priority = table.Priority
+	}
+
+	return nil
+}
+
+// hasLowPriorityTable returns true if any table's priority is low.
+func (df *Diff) hasLowPriorityTable() bool {
+	for _, schema := range df.tables {
+		for _, table := range schema {
+			if tablePriority(table) == PriorityLow {
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// setTableAttributes fetches the source tables' attributes for the table rules with attribute predicates. the tables
+// in the dump directories don't have attributes, so they're not matched by these rules.
+func (df *Diff) setTableAttributes(allTablesMap map[string]map[string]map[string]interface{}) error {
+	for _, source := range df.sourceDBs {
+		if source.Conn == nil {
+			continue
+		}
 
+		attrs, err := df.getTableAttributes(source.InstanceID, source.Conn, allTablesMap[source.InstanceID])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		df.tableRouter.SetTableAttributes(source.InstanceID, attrs)
+	}
 	return nil
 }
 
+// getTableAttributes returns the attributes of the tables in all the schemas of the instance, they're fetched only once
+// for every instance, and shared by the table-attributes filter and the table rules.
+func (df *Diff) getTableAttributes(instanceID string, db *sql.DB, allSchemas map[string]map[string]interface{}) (map[filter.Table]*filter.TableAttributes, error) {
+	if attrs, ok := df.tableAttributes[instanceID]; ok {
+		return attrs, nil
+	}
+
+	schemas := make([]string, 0, len(allSchemas))
+	for schema := range allSchemas {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+
+	attrs, err := filter.FetchTableAttributes(df.ctx, db, schemas)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get table attributes from %s", instanceID)
+	}
+	if df.tableAttributes == nil {
+		df.tableAttributes = make(map[string]map[filter.Table]*filter.TableAttributes)
+	}
+	df.tableAttributes[instanceID] = attrs
+	return attrs, nil
+}
+
 // GetAllTables get all tables in all databases.
 func (df *Diff) GetAllTables(cfg *Config) (map[string]map[string]map[string]interface{}, error) {
 	// instanceID => schema => table
@@ -292,7 +769,7 @@ func (df *Diff) GetAllTables(cfg *Config) (map[string]map[string]map[string]inte
 		return nil, errors.Annotatef(err, "get schemas from %s", df.targetDB.InstanceID)
 	}
 	for _, schema := range targetSchemas {
-		allTables, err := dbutil.GetTables(df.ctx, df.targetDB.Conn, schema)
+		allTables, err := df.getTables(df.targetDB.Conn, schema)
 		if err != nil {
 			return nil, errors.Annotatef(err, "get tables from %s.%s", df.targetDB.InstanceID, schema)
 		}
@@ -301,13 +778,24 @@ func (df *Diff) GetAllTables(cfg *Config) (map[string]map[string]map[string]inte
 
 	for _, source := range df.sourceDBs {
 		allTablesMap[source.InstanceID] = make(map[string]map[string]interface{})
+		if source.DumpDir != "" {
+			dumpTables, err := diff.ListDumpTables(source.DumpDir)
+			if err != nil {
+				return nil, errors.Annotatef(err, "get tables from dump directory %s", source.DumpDir)
+			}
+			for schema, allTables := range dumpTables {
+				allTablesMap[source.InstanceID][schema] = utils.SliceToMap(allTables)
+			}
+			continue
+		}
+
 		sourceSchemas, err := dbutil.GetSchemas(df.ctx, source.Conn)
 		if err != nil {
 			return nil, errors.Annotatef(err, "get schemas from %s", source.InstanceID)
 		}
 
 		for _, schema := range sourceSchemas {
-			allTables, err := dbutil.GetTables(df.ctx, source.Conn, schema)
+			allTables, err := df.getTables(source.Conn, schema)
 			if err != nil {
 				return nil, errors.Annotatef(err, "get tables from %s.%s", source.InstanceID, schema)
 			}
@@ -318,6 +806,20 @@ func (df *Diff) GetAllTables(cfg *Config) (map[string]map[string]map[string]inte
 	return allTablesMap, nil
 }
 
+// getTables returns the names of the tables in the schema, and the views if compare-views is true.
+func (df *Diff) getTables(db *sql.DB, schema string) ([]string, error) {
+	tables, err := dbutil.GetTables(df.ctx, db, schema)
+	if err != nil || !df.compareViews {
+		return tables, errors.Trace(err)
+	}
+
+	views, err := dbutil.GetViews(df.ctx, db, schema)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return append(tables, views...), nil
+}
+
 // GetMatchTable returns all the matched table.
 func (df *Diff) GetMatchTable(db DBConfig, schema, table string, allTables map[string]interface{}) ([]string, error) {
 	tableNames := make([]string, 0, 1)
@@ -343,9 +845,25 @@ func (df *Diff) GetMatchTable(db DBConfig, schema, table string, allTables map[s
 
 // Close closes file and database connection.
 func (df *Diff) Close() {
+	if df.stopWatchPauseSignals != nil {
+		df.stopWatchPauseSignals()
+	}
+	if df.stopWatchDumpSignals != nil {
+		df.stopWatchDumpSignals()
+	}
+	if df.httpServer != nil {
+		df.httpServer.Close()
+	}
+
 	if df.fixSQLFile != nil {
 		df.fixSQLFile.Close()
 	}
+	if df.diffRowsFile != nil {
+		df.diffRowsFile.Close()
+	}
+	if df.chunkArtifactsFile != nil {
+		df.chunkArtifactsFile.Close()
+	}
 
 	for _, db := range df.sourceDBs {
 		if db.Conn != nil {
@@ -356,86 +874,456 @@ func (df *Diff) Close() {
 	if df.targetDB.Conn != nil {
 		df.targetDB.Conn.Close()
 	}
+
+	if df.checkpointDB != nil && df.checkpointDB != df.targetDB.Conn {
+		df.checkpointDB.Close()
+	}
+
+	if df.summaryExportDB != nil {
+		df.summaryExportDB.Close()
+	}
 }
 
 // Equal tests whether two database have same data and schema.
 func (df *Diff) Equal() (err error) {
 	defer df.Close()
 
-	for _, schema := range df.tables {
-		for _, table := range schema {
-			var tidbStatsSource *diff.TableInstance
+	chunkResultHandler := df.status.HandleChunkResult
+	if df.runMetrics != nil {
+		chunkResultHandler = func(ctx context.Context, result *diff.ChunkResult) {
+			df.status.HandleChunkResult(ctx, result)
+			df.runMetrics.HandleChunkResult(ctx, result)
+		}
+		// write the snapshot even if the check failed, so the statistics of the checked chunks are not lost
+		defer func() {
+			if err1 := df.runMetrics.WriteFile(df.metricsSnapshotFile); err1 != nil {
+				log.Error("write metrics snapshot failed", zap.String("file", df.metricsSnapshotFile), zap.Error(err1))
+				return
+			}
+			log.Info("write metrics snapshot", zap.String("file", df.metricsSnapshotFile))
+		}()
+	}
 
-			sourceTables := make([]*diff.TableInstance, 0, len(table.SourceTables))
-			for _, sourceTable := range table.SourceTables {
-				sourceTableInstance := &diff.TableInstance{
-					Conn:       df.sourceDBs[sourceTable.InstanceID].Conn,
-					Schema:     sourceTable.Schema,
-					Table:      sourceTable.Table,
-					InstanceID: sourceTable.InstanceID,
-				}
-				sourceTables = append(sourceTables, sourceTableInstance)
+	if df.checkpointRetentionDays > 0 && !df.dryRun {
+		// the check can continue even if failed to prune the checkpoint
+		if err1 := cleanupCheckpoint(df.ctx, df.checkpointDB, df.targetDB.Conn, df.checkpointRetentionDays); err1 != nil {
+			log.Warn("cleanup checkpoint failed", zap.Error(err1))
+		}
+	}
 
-				if sourceTable.InstanceID == df.tidbInstanceID {
-					tidbStatsSource = sourceTableInstance
-				}
-			}
+	if df.checkAccounts && !df.dryRun {
+		if err = df.compareAccounts(df.ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
 
-			targetTableInstance := &diff.TableInstance{
-				Conn:       df.targetDB.Conn,
-				Schema:     table.Schema,
-				Table:      table.Table,
-				InstanceID: df.targetDB.InstanceID,
-			}
+	if df.tidbAttributes != nil && !df.tidbAttributes.IgnoreSequences && !df.ignoreStructCheck && !df.dryRun {
+		if err = df.compareSequences(df.ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
 
-			if df.targetDB.InstanceID == df.tidbInstanceID {
-				tidbStatsSource = targetTableInstance
-			}
+	var lastCheckTimes map[string]time.Time
+	if df.hasLowPriorityTable() && !df.dryRun {
+		lastCheckTimes, err = diff.LoadTablesLastCheckTime(df.ctx, df.checkpointDB)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	tables := orderTablesByPriority(df.tables, lastCheckTimes)
+	df.status.setTotalTables(len(tables))
+	if df.tableConcurrency > 1 {
+		return errors.Trace(df.checkTablesConcurrently(tables, chunkResultHandler))
+	}
 
-			if len(df.tidbInstanceID) != 0 && tidbStatsSource == nil {
-				return errors.NotFoundf("tidb instance id %s", df.tidbInstanceID)
-			}
+	budget := newPriorityBudget(df.priorityBudgets)
+	for _, table := range tables {
+		priority := tablePriority(table)
+		if budget.exhausted(priority) {
+			log.Warn("time budget of the priority is exhausted, skip check table", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.String("priority", priority))
+			atomic.AddInt32(&df.report.SkippedNum, 1)
+			continue
+		}
+		beginTime := time.Now()
 
-			td := &diff.TableDiff{
-				SourceTables: sourceTables,
-				TargetTable:  targetTableInstance,
-
-				IgnoreColumns: table.IgnoreColumns,
-				RemoveColumns: table.RemoveColumns,
-
-				Fields:            table.Fields,
-				Range:             table.Range,
-				Collation:         table.Collation,
-				ChunkSize:         df.chunkSize,
-				Sample:            df.sample,
-				CheckThreadCount:  df.checkThreadCount,
-				UseRowID:          df.useRowID,
-				UseChecksum:       df.useChecksum,
-				UseCheckpoint:     df.useCheckpoint,
-				OnlyUseChecksum:   df.onlyUseChecksum,
-				IgnoreStructCheck: df.ignoreStructCheck,
-				IgnoreDataCheck:   df.ignoreDataCheck,
-				TiDBStatsSource:   tidbStatsSource,
-			}
+		td, err := df.newTableDiff(table, chunkResultHandler)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = df.checkTable(df.ctx, table, td); err != nil {
+			return errors.Trace(err)
+		}
 
-			structEqual, dataEqual, err := td.Equal(df.ctx, func(dml string) error {
-				_, err := df.fixSQLFile.WriteString(fmt.Sprintf("%s\n", dml))
-				return errors.Trace(err)
-			})
+		budget.add(priority, time.Since(beginTime))
+	}
+
+	return nil
+}
+
+// checkTablesConcurrently checks table-concurrency tables concurrently by diff.Scheduler, the tables of higher priority
+// are checked before the tables of lower priority. the tables not started before the priority's time budget is used up
+// are skipped.
+func (df *Diff) checkTablesConcurrently(tables []*TableConfig, chunkResultHandler diff.ChunkResultHandler) error {
+	scheduler := diff.NewScheduler(df.tableConcurrency, df.globalLimiter)
+	budget := newPriorityBudget(df.priorityBudgets)
+
+	for len(tables) > 0 {
+		// the tables are ordered by priority, check the tables of the same priority together
+		priority := tablePriority(tables[0])
+		num := 1
+		for num < len(tables) && tablePriority(tables[num]) == priority {
+			num++
+		}
+
+		tableDiffs := make([]*diff.TableDiff, 0, num)
+		tableCfgs := make(map[*diff.TableDiff]*TableConfig, num)
+		for _, table := range tables[:num] {
+			td, err := df.newTableDiff(table, chunkResultHandler)
 			if err != nil {
-				log.Error("check failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
 				return errors.Trace(err)
 			}
+			tableDiffs = append(tableDiffs, td)
+			tableCfgs[td] = table
+		}
+
+		beginTime := time.Now()
+		err := scheduler.Run(df.ctx, tableDiffs, func(ctx context.Context, td *diff.TableDiff) error {
+			table := tableCfgs[td]
+			if budget.exceeded(priority, time.Since(beginTime)) {
+				log.Warn("time budget of the priority is exhausted, skip check table", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.String("priority", priority))
+				atomic.AddInt32(&df.report.SkippedNum, 1)
+				return nil
+			}
+			return df.checkTable(ctx, table, td)
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		tables = tables[num:]
+	}
+
+	return nil
+}
+
+// sourceColumnExprs returns the SQL expressions selected instead of the source table's columns, the values extracted
+// by the route rule override the column mapping rules, and the expressions in the table's config override both.
+func (df *Diff) sourceColumnExprs(table *TableConfig, sourceTable TableInstance) (map[string]string, error) {
+	mappedColumn, mappedExpr, err := df.columnMapping.HandleSQLExpr(sourceTable.Schema, sourceTable.Table)
+	if err != nil {
+		return nil, errors.Annotatef(err, "column mapping of %s in %s", dbutil.TableName(sourceTable.Schema, sourceTable.Table), sourceTable.InstanceID)
+	}
+	extractedColumns, err := df.tableRouter.ExtractColumns(sourceTable.InstanceID, sourceTable.Schema, sourceTable.Table)
+	if err != nil {
+		return nil, errors.Annotatef(err, "extract columns of %s in %s", dbutil.TableName(sourceTable.Schema, sourceTable.Table), sourceTable.InstanceID)
+	}
+	if len(mappedColumn) == 0 && len(extractedColumns) == 0 && len(table.ColumnExprs) == 0 {
+		return nil, nil
+	}
+
+	exprs := make(map[string]string, len(table.ColumnExprs)+len(extractedColumns)+1)
+	if len(mappedColumn) != 0 {
+		exprs[mappedColumn] = mappedExpr
+	}
+	for column, value := range extractedColumns {
+		exprs[column] = fmt.Sprintf("'%s'", strings.Replace(value, "'", "''", -1))
+	}
+	for column, expr := range table.ColumnExprs {
+		exprs[column] = expr
+	}
+	return exprs, nil
+}
+
+// newTableDiff returns the TableDiff to check the table.
+func (df *Diff) newTableDiff(table *TableConfig, chunkResultHandler diff.ChunkResultHandler) (*diff.TableDiff, error) {
+	var (
+		tidbStatsSource *diff.TableInstance
+		err             error
+	)
 
-			df.report.SetTableStructCheckResult(table.Schema, table.Table, structEqual)
-			df.report.SetTableDataCheckResult(table.Schema, table.Table, dataEqual)
-			if structEqual && dataEqual {
-				df.report.PassNum++
-			} else {
-				df.report.FailedNum++
+	sourceTables := make([]*diff.TableInstance, 0, len(table.SourceTables))
+	for _, sourceTable := range table.SourceTables {
+		sourceTableInstance := &diff.TableInstance{
+			Conn:          df.sourceDBs[sourceTable.InstanceID].Conn,
+			Schema:        sourceTable.Schema,
+			Table:         sourceTable.Table,
+			InstanceID:    sourceTable.InstanceID,
+			Range:         sourceTable.Range,
+			Limiter:       df.limiters[sourceTable.InstanceID],
+			MetadataCache: df.metadataCache,
+		}
+		sourceTableInstance.ColumnExprs, err = df.sourceColumnExprs(table, sourceTable)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if dumpDir := df.sourceDBs[sourceTable.InstanceID].DumpDir; dumpDir != "" {
+			sourceTableInstance.Source, err = diff.NewDumpRowSource(dumpDir, sourceTable.Schema, sourceTable.Table)
+			if err != nil {
+				return nil, errors.Trace(err)
 			}
 		}
+		sourceTables = append(sourceTables, sourceTableInstance)
+
+		if sourceTable.InstanceID == df.tidbInstanceID {
+			tidbStatsSource = sourceTableInstance
+		}
+	}
+
+	targetTableInstance := &diff.TableInstance{
+		Conn:          df.targetDB.Conn,
+		Schema:        table.Schema,
+		Table:         table.Table,
+		InstanceID:    df.targetDB.InstanceID,
+		Limiter:       df.limiters[df.targetDB.InstanceID],
+		MetadataCache: df.metadataCache,
+	}
+
+	if df.targetDB.InstanceID == df.tidbInstanceID {
+		tidbStatsSource = targetTableInstance
+	}
+
+	if len(df.tidbInstanceID) != 0 && tidbStatsSource == nil {
+		return nil, errors.NotFoundf("tidb instance id %s", df.tidbInstanceID)
+	}
+
+	maxDeleteRows, maxDeleteRatio := df.maxDeleteRows, df.maxDeleteRatio
+	if table.MaxDeleteRows != 0 {
+		maxDeleteRows = table.MaxDeleteRows
+	}
+	if table.MaxDeleteRatio != 0 {
+		maxDeleteRatio = table.MaxDeleteRatio
+	}
+	checkThreadCount := df.checkThreadCount
+	if table.CheckThreadCount != 0 {
+		checkThreadCount = table.CheckThreadCount
+	}
+
+	td := &diff.TableDiff{
+		SourceTables: sourceTables,
+		TargetTable:  targetTableInstance,
+
+		IgnoreColumns: table.IgnoreColumns,
+		CheckColumns:  table.CheckColumns,
+		RemoveColumns: table.RemoveColumns,
+		BusinessKey:   table.BusinessKey,
+
+		Fields:                    table.Fields,
+		IndexHint:                 table.IndexHint,
+		Range:                     table.Range,
+		Collation:                 table.Collation,
+		ChunkSize:                 df.chunkSize,
+		Sample:                    df.sample,
+		CheckThreadCount:          checkThreadCount,
+		GlobalLimiter:             df.globalLimiter,
+		Tuning:                    df.tuning,
+		InFlight:                  df.inFlight,
+		MemoryLimiter:             df.memoryLimiter,
+		UseRowID:                  df.useRowID,
+		UseChecksum:               df.useChecksum,
+		UseCheckpoint:             df.useCheckpoint,
+		ResumeFailedChunks:        df.resumeFailedChunks,
+		RecheckFailed:             df.recheckFailed,
+		OnlyUseChecksum:           df.onlyUseChecksum,
+		IgnoreStructCheck:         df.ignoreStructCheck,
+		IgnoreDataCheck:           df.ignoreDataCheck,
+		CheckIndexes:              df.checkIndexes,
+		CheckEnumOrder:            df.checkEnumOrder,
+		CheckConstraints:          df.checkConstraints,
+		StrictCharset:             df.strictCharset,
+		CompareViews:              df.compareViews,
+		TiDBAttributes:            df.tidbAttributes,
+		ReverseFixSQL:             df.reverseFixSQL,
+		UseUpdateSQL:              df.useUpdateSQL,
+		HashLongColumns:           df.hashLongColumns,
+		Redact:                    df.redact,
+		RedactColumns:             table.RedactColumns,
+		RedactFixSQL:              df.redactFixSQL,
+		TiDBStatsSource:           tidbStatsSource,
+		SplitByRegion:             df.splitByRegion,
+		MaxDeleteRows:             maxDeleteRows,
+		MaxChunkDiffRows:          df.maxChunkDiffRows,
+		ColumnGroupSize:           df.columnGroupSize,
+		MaxDeleteRatio:            maxDeleteRatio,
+		PTChecksumSchema:          df.ptChecksumSchema,
+		PTChecksumTable:           df.ptChecksumTable,
+		UsePTChecksum:             df.usePTChecksum,
+		CheckpointConn:            df.checkpointDB,
+		Pauser:                    df.pauser,
+		RowDiffExporter:           df.rowDiffExporter,
+		ChunkArtifactExporter:     df.chunkArtifactExporter,
+		SoftDeleteColumn:          table.SoftDeleteColumn,
+		SoftDeleteValues:          table.SoftDeleteValues,
+		ColumnComparators:         table.ColumnComparators,
+		AggregateColumns:          table.AggregateColumns,
+		SourceChecksumConcurrency: df.sourceChecksumConcurrency,
+		Dialect:                   df.fixSQLDialect,
+		RowCountCheck:             df.rowCountCheck,
+		RetryFailedChunks:         df.retryFailedChunks,
+		TimeoutSplitTimes:         df.timeoutSplitTimes,
+		Timeouts:                  df.timeouts,
+		RetryDelay:                df.retryDelay,
+		DoubleReadDelay:           df.doubleReadDelay,
+		ReplicationWaiter:         df.replicationWaiter,
+		LagRecheckTimes:           df.lagRecheckTimes,
+		ChunkResultHandler:        chunkResultHandler,
+	}
+
+	return td, nil
+}
+
+// checkTable checks the table by the TableDiff, and saves the result in the report.
+func (df *Diff) checkTable(ctx context.Context, table *TableConfig, td *diff.TableDiff) error {
+	if df.status.isSkipped(table.Schema, table.Table) {
+		log.Warn("table is skipped by the http api", zap.String("table", dbutil.TableName(table.Schema, table.Table)))
+		atomic.AddInt32(&df.report.SkippedNum, 1)
+		return nil
+	}
+
+	beginTime := time.Now()
+	defer func() {
+		df.report.SetTableDuration(table.Schema, table.Table, time.Since(beginTime))
+	}()
+
+	if df.dryRun {
+		estimate, err := td.Estimate(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("estimate", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Reflect("estimate", estimate))
+		return nil
+	}
+
+	if len(table.ExternalChunkResults) != 0 {
+		return errors.Trace(df.compareExternalChunks(ctx, table, td))
+	}
+
+	// the versions are got before the check, so the modification during the check is not missed
+	var versions map[string]string
+	if df.skipUnchangedTables {
+		var unchanged bool
+		versions, unchanged = df.tableVersions(ctx, table, td)
+		if unchanged {
+			log.Info("table is unchanged since the last successful check, skip it", zap.String("table", dbutil.TableName(table.Schema, table.Table)))
+			df.report.SetTableUnchanged(table.Schema, table.Table)
+			atomic.AddInt32(&df.report.PassNum, 1)
+			return nil
+		}
+	}
+
+	if df.quickMode {
+		return errors.Trace(df.quickCheckTable(ctx, table, td, versions))
+	}
+
+	writeFixSQL := func(dml string) error {
+		// the tables checked concurrently share the file
+		df.fixSQLFileLock.Lock()
+		defer df.fixSQLFileLock.Unlock()
+
+		_, err := df.fixSQLFile.WriteString(fmt.Sprintf("%s\n", dml))
+		return errors.Trace(err)
+	}
+	var tableWriter *diff.TableFixSQLWriter
+	if df.fixSQLWriter != nil {
+		tableWriter = df.fixSQLWriter.TableWriter(td)
+		writeFixSQL = tableWriter.Write
 	}
 
-	return
+	// the table's check is canceled if it's skipped by the http api
+	tableCtx, cancel := context.WithCancel(ctx)
+	td.Progress = df.status.startTable(table.Schema, table.Table, cancel)
+	structEqual, dataEqual, err := td.Equal(tableCtx, writeFixSQL)
+	df.status.finishTable(table.Schema, table.Table)
+	cancel()
+	if tableWriter != nil {
+		if err1 := tableWriter.Close(); err1 != nil {
+			log.Error("close fix sql file failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err1))
+		}
+		log.Info("write fix sql", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Reflect("statistics", tableWriter.Stats()))
+	}
+	if errors.Cause(err) == diff.ErrDeleteLimitExceeded {
+		// flag this table as failed, and continue to check other tables
+		log.Error("too many rows need to be deleted, stop check this table, please check the config", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		dataEqual, err = false, nil
+	}
+	if df.status.isSkipped(table.Schema, table.Table) {
+		log.Warn("table is skipped by the http api, stop check", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		atomic.AddInt32(&df.report.SkippedNum, 1)
+		return nil
+	}
+	if ctx.Err() != nil {
+		// the whole check is canceled, for example another table checked concurrently failed, this table is not
+		// finished, so it's neither passed nor failed
+		log.Warn("check is canceled", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		return errors.Trace(ctx.Err())
+	}
+	result := &diff.TableResult{
+		RunID:     df.runID,
+		Schema:    table.Schema,
+		Table:     table.Table,
+		CheckTime: time.Now(),
+	}
+	if err != nil {
+		log.Error("check failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		df.status.addError(dbutil.TableName(table.Schema, table.Table), "", err)
+		df.report.SetTableError(table.Schema, table.Table, err)
+		result.State, result.Message = diff.TableResultError, err.Error()
+		df.exportTableResult(ctx, result)
+		return errors.Trace(err)
+	}
+
+	df.report.SetTableStructCheckResult(table.Schema, table.Table, structEqual)
+	if sourceCount, targetCount, ok := td.RowCounts(); ok {
+		df.report.SetTableRowCount(table.Schema, table.Table, sourceCount, targetCount)
+		result.RowCounted, result.SourceRows, result.TargetRows = true, sourceCount, targetCount
+	}
+	df.report.SetTableDataCheckResult(table.Schema, table.Table, dataEqual)
+	if structEqual && dataEqual {
+		atomic.AddInt32(&df.report.PassNum, 1)
+		result.State = diff.TableResultPass
+	} else {
+		atomic.AddInt32(&df.report.FailedNum, 1)
+		result.State = diff.TableResultFail
+	}
+	result.StructEqual, result.DataEqual = structEqual, dataEqual
+	df.exportTableResult(ctx, result)
+	df.saveTableVersions(ctx, table, versions, structEqual && dataEqual)
+
+	if df.recordHistory {
+		df.recordTableHistory(ctx, table)
+	}
+
+	return nil
+}
+
+// exportTableResult upserts the table's final result into the summary export table, the errors are only logged,
+// because the check is finished.
+func (df *Diff) exportTableResult(ctx context.Context, result *diff.TableResult) {
+	if df.summaryExporter == nil {
+		return
+	}
+	if err := df.summaryExporter.Export(ctx, result); err != nil {
+		log.Warn("export table result failed", zap.String("table", dbutil.TableName(result.Schema, result.Table)), zap.Error(err))
+	}
+}
+
+// recordTableHistory saves the table's result of this run in the history table, and alerts if the table's failed
+// chunks grow run-over-run. the errors are only logged, because the check is finished.
+func (df *Diff) recordTableHistory(ctx context.Context, table *TableConfig) {
+	drift, err := diff.RecordRunHistory(ctx, df.checkpointDB, df.runID, table.Schema, table.Table)
+	if err != nil {
+		log.Warn("record run history failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		return
+	}
+	if drift == nil || !drift.Growing() {
+		return
+	}
+
+	log.Warn("failed chunks grow since the previous run, the replication may decay", zap.String("table", dbutil.TableName(table.Schema, table.Table)),
+		zap.String("previous run", drift.PreviousRunID), zap.Int64("previous failed chunks", drift.PreviousFailedChunks), zap.Int64("failed chunks", drift.FailedChunks))
+	if df.driftNotifier == nil {
+		return
+	}
+	if err = df.driftNotifier.NotifyDrift(ctx, drift); err != nil {
+		log.Warn("notify drift failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+	}
 }
@@ -0,0 +1,249 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	bf "github.com/pingcap/tidb-tools/pkg/binlog-filter"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"github.com/pingcap/tidb-tools/pkg/filter"
+	router "github.com/pingcap/tidb-tools/pkg/table-router"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// dmTask is the part of DM's task file used to derive the tables to check, the routes, the binlog event filters and
+// the black-white lists (or block-allow lists) of every upstream instance. the other fields of the task are ignored.
+type dmTask struct {
+	Name           string                         `yaml:"name"`
+	CaseSensitive  bool                           `yaml:"case-sensitive"`
+	MySQLInstances []*dmMySQLInstance             `yaml:"mysql-instances"`
+	Routes         map[string]*router.TableRule   `yaml:"routes"`
+	Filters        map[string]*bf.BinlogEventRule `yaml:"filters"`
+	BWList         map[string]*filter.Rules       `yaml:"black-white-list"`
+	BAList         map[string]*filter.Rules       `yaml:"block-allow-list"`
+}
+
+// dmMySQLInstance is an upstream instance of the task, the source-id should be the instance-id of a source-db.
+type dmMySQLInstance struct {
+	SourceID    string   `yaml:"source-id"`
+	RouteRules  []string `yaml:"route-rules"`
+	FilterRules []string `yaml:"filter-rules"`
+	BWListName  string   `yaml:"black-white-list"`
+	BAListName  string   `yaml:"block-allow-list"`
+}
+
+// loadDMTask loads the DM task file, and checks the rules referenced by the instances exist.
+func loadDMTask(path string) (*dmTask, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	task := &dmTask{}
+	if err = yaml.Unmarshal(data, task); err != nil {
+		return nil, errors.Annotatef(err, "parse dm task file %s", path)
+	}
+	if len(task.MySQLInstances) == 0 {
+		return nil, errors.NotValidf("dm task %s without mysql-instances", task.Name)
+	}
+
+	for _, instance := range task.MySQLInstances {
+		if len(instance.SourceID) == 0 {
+			return nil, errors.NotValidf("mysql instance of dm task %s without source-id", task.Name)
+		}
+		for _, name := range instance.RouteRules {
+			if _, ok := task.Routes[name]; !ok {
+				return nil, errors.NotFoundf("route rule %s of %s", name, instance.SourceID)
+			}
+		}
+		for _, name := range instance.FilterRules {
+			if _, ok := task.Filters[name]; !ok {
+				return nil, errors.NotFoundf("filter rule %s of %s", name, instance.SourceID)
+			}
+		}
+		if _, err = task.tableFilter(instance); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return task, nil
+}
+
+// tableRules returns the route rules of every instance, the rules only route the tables of their instance.
+func (t *dmTask) tableRules() []*router.TableRule {
+	var rules []*router.TableRule
+	for _, instance := range t.MySQLInstances {
+		for _, name := range instance.RouteRules {
+			rule := *t.Routes[name]
+			rule.SourceInstance = instance.SourceID
+			rules = append(rules, &rule)
+		}
+	}
+	return rules
+}
+
+// tableFilter returns the filter of the instance's black-white list or block-allow list, nil means all the tables
+// are replicated.
+func (t *dmTask) tableFilter(instance *dmMySQLInstance) (*filter.Filter, error) {
+	name, lists := instance.BAListName, t.BAList
+	if len(name) == 0 {
+		name, lists = instance.BWListName, t.BWList
+	}
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	rules, ok := lists[name]
+	if !ok {
+		return nil, errors.NotFoundf("block-allow list %s of %s", name, instance.SourceID)
+	}
+	if err := rules.Valid(); err != nil {
+		return nil, errors.Annotatef(err, "block-allow list %s of %s", name, instance.SourceID)
+	}
+	return filter.New(t.CaseSensitive, rules), nil
+}
+
+// replicatedTables returns the tables of the instance replicated by the task, the tables filtered out by the
+// black-white list, the tables whose inserts, updates and deletes are all ignored by the binlog event filters, and the
+// tables of the system schemas and the checkpoint schema are removed. the tables whose part of the DML events are
+// ignored are warned, they may be different from target.
+func (t *dmTask) replicatedTables(instance *dmMySQLInstance, allTables map[string]map[string]interface{}) (map[string]map[string]interface{}, error) {
+	tableFilter, err := t.tableFilter(instance)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	filterRules := make([]*bf.BinlogEventRule, 0, len(instance.FilterRules))
+	for _, name := range instance.FilterRules {
+		rule := *t.Filters[name]
+		filterRules = append(filterRules, &rule)
+	}
+	eventFilter, err := bf.NewBinlogEvent(t.CaseSensitive, filterRules)
+	if err != nil {
+		return nil, errors.Annotatef(err, "filter rules of %s", instance.SourceID)
+	}
+
+	tables := make([]*filter.Table, 0, len(allTables))
+	for schema, schemaTables := range allTables {
+		if filter.IsSystemSchema(schema) || diff.IsCheckpointSchema(schema) {
+			continue
+		}
+		for table := range schemaTables {
+			tables = append(tables, &filter.Table{Schema: schema, Name: table})
+		}
+	}
+	if tableFilter != nil {
+		tables = tableFilter.ApplyOn(tables)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return dbutil.TableName(tables[i].Schema, tables[i].Name) < dbutil.TableName(tables[j].Schema, tables[j].Name)
+	})
+
+	replicated := make(map[string]map[string]interface{})
+	for _, table := range tables {
+		var ignoredEvents []string
+		for _, event := range []bf.EventType{bf.InsertEvent, bf.UpdateEvent, bf.DeleteEvent} {
+			action, err := eventFilter.Filter(table.Schema, table.Name, event, "")
+			if err != nil {
+				return nil, errors.Annotatef(err, "filter %s of %s", dbutil.TableName(table.Schema, table.Name), instance.SourceID)
+			}
+			if action == bf.Ignore {
+				ignoredEvents = append(ignoredEvents, string(event))
+			}
+		}
+
+		switch len(ignoredEvents) {
+		case 3:
+			log.Info("all the DML events of the table are ignored by the dm task, skip it", zap.String("instance id", instance.SourceID), zap.String("table", dbutil.TableName(table.Schema, table.Name)))
+			continue
+		case 0:
+		default:
+			log.Warn("part of the DML events of the table are ignored by the dm task, the data may be different", zap.String("instance id", instance.SourceID), zap.String("table", dbutil.TableName(table.Schema, table.Name)), zap.Strings("ignored events", ignoredEvents))
+		}
+
+		if _, ok := replicated[table.Schema]; !ok {
+			replicated[table.Schema] = make(map[string]interface{})
+		}
+		replicated[table.Schema][table.Name] = struct{}{}
+	}
+
+	return replicated, nil
+}
+
+// applyDMTask removes the source tables not replicated by the DM task from allTablesMap, so they are not matched as
+// the source tables, and adds the target tables of the replicated source tables into check-tables.
+func (df *Diff) applyDMTask(cfg *Config, allTablesMap map[string]map[string]map[string]interface{}) error {
+	targetTables := make(map[string]map[string]struct{})
+	tableNum := 0
+	for _, instance := range cfg.dmTask.MySQLInstances {
+		replicated, err := cfg.dmTask.replicatedTables(instance, allTablesMap[instance.SourceID])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		allTablesMap[instance.SourceID] = replicated
+
+		for schema, tables := range replicated {
+			for table := range tables {
+				targetSchema, targetTable, err := df.tableRouter.RouteWithInstance(instance.SourceID, schema, table)
+				if err != nil {
+					return errors.Annotatef(err, "route %s of %s", dbutil.TableName(schema, table), instance.SourceID)
+				}
+				if _, ok := allTablesMap[df.targetDB.InstanceID][targetSchema][targetTable]; !ok {
+					return utils.ErrTableNotFound.New("target table %s of %s in %s not found", dbutil.TableName(targetSchema, targetTable), dbutil.TableName(schema, table), instance.SourceID)
+				}
+
+				if _, ok := targetTables[targetSchema]; !ok {
+					targetTables[targetSchema] = make(map[string]struct{})
+				}
+				if _, ok := targetTables[targetSchema][targetTable]; !ok {
+					targetTables[targetSchema][targetTable] = struct{}{}
+					tableNum++
+				}
+			}
+		}
+	}
+
+	// the tables are merged into the check-tables of the same schema
+	for _, schemaTables := range cfg.Tables {
+		tables, ok := targetTables[schemaTables.Schema]
+		if !ok {
+			continue
+		}
+		for _, table := range schemaTables.Tables {
+			delete(tables, table)
+		}
+		for table := range tables {
+			schemaTables.Tables = append(schemaTables.Tables, table)
+		}
+		delete(targetTables, schemaTables.Schema)
+	}
+	for schema, tables := range targetTables {
+		schemaTables := &CheckTables{Schema: schema, Tables: make([]string, 0, len(tables))}
+		for table := range tables {
+			schemaTables.Tables = append(schemaTables.Tables, table)
+		}
+		sort.Strings(schemaTables.Tables)
+		cfg.Tables = append(cfg.Tables, schemaTables)
+	}
+
+	log.Info("load tables from dm task", zap.String("task", cfg.dmTask.Name), zap.Int("table num", tableNum))
+	return nil
+}
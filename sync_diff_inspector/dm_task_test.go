@@ -0,0 +1,182 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func TestSyncDiff(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testDMTaskSuite{})
+
+type testDMTaskSuite struct{}
+
+const testDMTask = `
+name: test
+mysql-instances:
+  - source-id: "mysql-1"
+    route-rules: ["shard-route"]
+    filter-rules: ["ignore-log", "ignore-delete"]
+    block-allow-list: "ba"
+  - source-id: "mysql-2"
+    route-rules: ["shard-route"]
+    black-white-list: "bw"
+routes:
+  shard-route:
+    schema-pattern: "shop_*"
+    table-pattern: "orders_*"
+    target-schema: "shop"
+    target-table: "orders"
+filters:
+  ignore-log:
+    schema-pattern: "shop_*"
+    table-pattern: "log"
+    events: ["all dml"]
+    action: Ignore
+  ignore-delete:
+    schema-pattern: "shop_*"
+    table-pattern: "orders_*"
+    events: ["delete"]
+    action: Ignore
+block-allow-list:
+  ba:
+    do-dbs: ["shop_1"]
+black-white-list:
+  bw:
+    ignore-tables:
+      - db-name: "shop_2"
+        tbl-name: "log"
+`
+
+func writeDMTask(c *C, dir, content string) string {
+	path := filepath.Join(dir, "task.yaml")
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+	return path
+}
+
+func (s *testDMTaskSuite) TestLoadDMTask(c *C) {
+	dir, err := ioutil.TempDir("", "dm-task")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	task, err := loadDMTask(writeDMTask(c, dir, testDMTask))
+	c.Assert(err, IsNil)
+	c.Assert(task.Name, Equals, "test")
+	c.Assert(task.MySQLInstances, HasLen, 2)
+	c.Assert(task.MySQLInstances[0].SourceID, Equals, "mysql-1")
+	c.Assert(task.MySQLInstances[0].FilterRules, DeepEquals, []string{"ignore-log", "ignore-delete"})
+	c.Assert(task.MySQLInstances[0].BAListName, Equals, "ba")
+	c.Assert(task.MySQLInstances[1].BWListName, Equals, "bw")
+	c.Assert(task.Routes["shard-route"].TargetTable, Equals, "orders")
+
+	_, err = loadDMTask(filepath.Join(dir, "not-exist.yaml"))
+	c.Assert(err, NotNil)
+
+	testCases := []struct {
+		content string
+		errMsg  string
+	}{
+		{
+			"name: test\n",
+			"dm task test without mysql-instances not valid",
+		},
+		{
+			"name: test\nmysql-instances:\n  - route-rules: [\"shard-route\"]\n",
+			"mysql instance of dm task test without source-id not valid",
+		},
+		{
+			"name: test\nmysql-instances:\n  - source-id: \"mysql-1\"\n    route-rules: [\"shard-route\"]\n",
+			"route rule shard-route of mysql-1 not found",
+		},
+		{
+			"name: test\nmysql-instances:\n  - source-id: \"mysql-1\"\n    filter-rules: [\"ignore-log\"]\n",
+			"filter rule ignore-log of mysql-1 not found",
+		},
+		{
+			"name: test\nmysql-instances:\n  - source-id: \"mysql-1\"\n    block-allow-list: \"ba\"\n",
+			"block-allow list ba of mysql-1 not found",
+		},
+	}
+	for _, tc := range testCases {
+		_, err = loadDMTask(writeDMTask(c, dir, tc.content))
+		c.Assert(err, ErrorMatches, tc.errMsg, Commentf("%s", tc.content))
+	}
+}
+
+func (s *testDMTaskSuite) TestTableRules(c *C) {
+	dir, err := ioutil.TempDir("", "dm-task")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	task, err := loadDMTask(writeDMTask(c, dir, testDMTask))
+	c.Assert(err, IsNil)
+
+	// every instance gets its own copy of the rule, which only routes the tables of the instance
+	rules := task.tableRules()
+	c.Assert(rules, HasLen, 2)
+	c.Assert(rules[0].SourceInstance, Equals, "mysql-1")
+	c.Assert(rules[1].SourceInstance, Equals, "mysql-2")
+	for _, rule := range rules {
+		c.Assert(rule.SchemaPattern, Equals, "shop_*")
+		c.Assert(rule.TargetSchema, Equals, "shop")
+		c.Assert(rule.TargetTable, Equals, "orders")
+	}
+	c.Assert(task.Routes["shard-route"].SourceInstance, Equals, "")
+}
+
+func (s *testDMTaskSuite) TestReplicatedTables(c *C) {
+	dir, err := ioutil.TempDir("", "dm-task")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	task, err := loadDMTask(writeDMTask(c, dir, testDMTask))
+	c.Assert(err, IsNil)
+
+	allTables := map[string]map[string]interface{}{
+		"shop_1":              {"orders_1": struct{}{}, "log": struct{}{}},
+		"shop_2":              {"orders_2": struct{}{}, "log": struct{}{}},
+		"mysql":               {"user": struct{}{}},
+		"sync_diff_inspector": {"summary": struct{}{}},
+	}
+
+	// mysql-1 only replicates shop_1 by the block-allow list, and all the DML events of the log table are ignored.
+	// the orders table is kept though its deletes are ignored.
+	tables, err := task.replicatedTables(task.MySQLInstances[0], allTables)
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, map[string]map[string]interface{}{
+		"shop_1": {"orders_1": struct{}{}},
+	})
+
+	// mysql-2 ignores the log table by the black-white list, and has no filter rules.
+	// the system schemas and the checkpoint schema are never replicated.
+	tables, err = task.replicatedTables(task.MySQLInstances[1], allTables)
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, map[string]map[string]interface{}{
+		"shop_1": {"orders_1": struct{}{}, "log": struct{}{}},
+		"shop_2": {"orders_2": struct{}{}},
+	})
+
+	// no tables
+	tables, err = task.replicatedTables(task.MySQLInstances[1], nil)
+	c.Assert(err, IsNil)
+	c.Assert(tables, HasLen, 0)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// watchDumpSignals dumps the status to the log when receives the dump signal, used to diagnose the hanged check
+// without attaching a debugger. returns a function to stop watching.
+func (df *Diff) watchDumpSignals() func() {
+	if len(dumpSignals) == 0 {
+		return func() {}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, dumpSignals...)
+	stopCh := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				df.dumpStatus()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(stopCh)
+	}
+}
+
+// dumpStatus writes the status to the log, including every table's progress and the chunks being checked.
+func (df *Diff) dumpStatus() {
+	status := df.Status()
+
+	log.Info("dump status",
+		zap.Bool("paused", status.Paused),
+		zap.Int("total tables", status.TotalTables),
+		zap.Int("checked tables", status.CheckedTables),
+		zap.Strings("skipped tables", status.SkippedTables),
+		zap.Reflect("concurrency", status.Concurrency),
+		zap.Reflect("running chunks", status.RunningChunks),
+		zap.Int("in-flight chunks", len(status.InFlightChunks)),
+		zap.Int("errors", len(status.Errors)))
+
+	for _, table := range status.Tables {
+		log.Info("dump table status", zap.String("table", table.Table), zap.String("phase", table.Phase), zap.Int("total chunks", table.TotalChunks), zap.Int("checked chunks", table.CheckedChunks))
+	}
+
+	for _, chunk := range status.InFlightChunks {
+		log.Info("dump in-flight chunk",
+			zap.String("schema", chunk.Schema),
+			zap.String("table", chunk.Table),
+			zap.Int64("chunk id", chunk.ChunkID),
+			zap.String("where", chunk.Where),
+			zap.Strings("args", chunk.Args),
+			zap.String("state", chunk.State),
+			zap.Duration("elapsed", time.Since(chunk.StartTime)))
+	}
+
+	for _, statusErr := range status.Errors {
+		log.Info("dump error", zap.Time("time", statusErr.Time), zap.String("table", statusErr.Table), zap.String("chunk", statusErr.Chunk), zap.String("error", statusErr.Error))
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// startHTTPServer starts the HTTP server on addr, which is used to get the status and control the diff at runtime.
+//
+// `GET /status` returns the Status.
+// `POST /pause` stops dispatching new chunks, and `POST /resume` resumes the paused diff.
+// `POST /concurrency?instance-id=xx&limit=n` changes the max number of chunks checked concurrently in the instance.
+// `GET /tuning` returns the knobs can be changed at runtime, and `POST /tuning?qps-limit=n&sample=n` changes them,
+// the omitted knobs are not changed.
+// `POST /skip?schema=xx&table=xx` skips the target table, stops it if it's being checked.
+func (df *Diff) startHTTPServer(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", df.handleStatus)
+	mux.HandleFunc("/pause", df.handlePause)
+	mux.HandleFunc("/resume", df.handleResume)
+	mux.HandleFunc("/concurrency", df.handleConcurrency)
+	mux.HandleFunc("/tuning", df.handleTuning)
+	mux.HandleFunc("/skip", df.handleSkip)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Annotatef(err, "listen on %s", addr)
+	}
+
+	df.httpServer = &http.Server{Handler: mux}
+	go func() {
+		err := df.httpServer.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Error("http server stopped", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+	log.Info("start http server", zap.String("addr", addr))
+
+	return nil
+}
+
+func (df *Diff) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only support GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, df.Status())
+}
+
+func (df *Diff) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only support POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	df.pause()
+	writeJSON(w, map[string]bool{"paused": true})
+}
+
+func (df *Diff) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only support POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	df.resume()
+	writeJSON(w, map[string]bool{"paused": false})
+}
+
+func (df *Diff) handleConcurrency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only support POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil {
+		http.Error(w, "limit is invalid", http.StatusBadRequest)
+		return
+	}
+	if err = df.setConcurrency(r.FormValue("instance-id"), limit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, df.concurrency())
+}
+
+func (df *Diff) handleTuning(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var qpsLimit, sample *int
+		for _, knob := range []struct {
+			name  string
+			value **int
+		}{{"qps-limit", &qpsLimit}, {"sample", &sample}} {
+			if r.FormValue(knob.name) == "" {
+				continue
+			}
+			v, err := strconv.Atoi(r.FormValue(knob.name))
+			if err != nil {
+				http.Error(w, knob.name+" is invalid", http.StatusBadRequest)
+				return
+			}
+			*knob.value = &v
+		}
+		if err := df.setTuning(qpsLimit, sample); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "only support GET and POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, df.getTuning())
+}
+
+func (df *Diff) handleSkip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only support POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := df.skipTable(r.FormValue("schema"), r.FormValue("table")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]bool{"skipped": true})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn("write http response failed", zap.Error(err))
+	}
+}
@@ -23,20 +23,28 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/diff"
 	"github.com/pingcap/tidb-tools/pkg/utils"
 	"go.uber.org/zap"
 )
 
 func main() {
+	args := os.Args[1:]
+	var command string
+	if len(args) > 0 && (args[0] == cleanupCommand || args[0] == workerCommand) {
+		command, args = args[0], args[1:]
+	}
+
 	cfg := NewConfig()
-	err := cfg.Parse(os.Args[1:])
+	err := cfg.Parse(args)
 	switch errors.Cause(err) {
 	case nil:
 	case flag.ErrHelp:
 		os.Exit(0)
 	default:
-		log.Error("parse cmd flags", zap.Error(err))
-		os.Exit(2)
+		err = utils.ErrInvalidConfig.Wrap(err, "parse cmd flags")
+		log.Error("parse cmd flags", zap.Error(err), utils.ZapErrCode(err))
+		os.Exit(exitCodeInvalidConfig)
 	}
 
 	if cfg.PrintVersion {
@@ -47,43 +55,108 @@ func main() {
 	l := zap.NewAtomicLevel()
 	if err := l.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
 		log.Error("invalide log level", zap.String("log level", cfg.LogLevel))
-		return
+		os.Exit(exitCodeInvalidConfig)
 	}
 	log.SetLevel(l.Level())
 
 	ok := cfg.checkConfig()
 	if !ok {
 		log.Error("there is something wrong with your config, please check it!")
-		return
+		os.Exit(exitCodeInvalidConfig)
+	}
+
+	err = diff.SetCheckpointNames(cfg.CheckpointSchema, cfg.CheckpointSummaryTable, cfg.CheckpointChunkTable)
+	if err != nil {
+		log.Error("invalid checkpoint names", zap.Error(err))
+		os.Exit(exitCodeInvalidConfig)
 	}
 
 	ctx := context.Background()
 
-	if !checkSyncState(ctx, cfg) {
-		log.Fatal("sourceDB don't equal targetDB")
+	if cfg.CheckConfig && command == "" {
+		exitCode := runCheckConfig(ctx, cfg)
+		utils.SyncLog()
+		os.Exit(exitCode)
+	}
+
+	switch command {
+	case cleanupCommand:
+		if err = runCleanup(ctx, cfg); err != nil {
+			log.Fatal("cleanup checkpoint failed", zap.Error(err))
+		}
+		utils.SyncLog()
+		return
+	case workerCommand:
+		if err = runWorker(ctx, cfg); err != nil {
+			log.Fatal("worker stopped", zap.Error(err))
+		}
+		utils.SyncLog()
+		return
+	}
+
+	exitCode := checkSyncState(ctx, cfg)
+	switch exitCode {
+	case exitCodeEqual:
+		if !cfg.DryRun {
+			log.Info("test pass!!!")
+		}
+	case exitCodeError:
+		log.Error("check failed", zap.Int("exit code", exitCode))
+	default:
+		log.Error("sourceDB don't equal targetDB", zap.Int("exit code", exitCode))
 	}
-	log.Info("test pass!!!")
 
 	utils.SyncLog()
+	os.Exit(exitCode)
 }
 
-func checkSyncState(ctx context.Context, cfg *Config) bool {
+// checkSyncState checks the tables, and returns the exit code by the result.
+func checkSyncState(ctx context.Context, cfg *Config) int {
 	beginTime := time.Now()
 	defer func() {
 		log.Info("check data finished", zap.Duration("cost", time.Since(beginTime)))
 	}()
 
+	report := NewReport()
+	exitCode := exitCodeError
+	var err error
+	// the summary is written even if the check failed, so the automation always gets the verdicts
+	defer func() {
+		if cfg.DryRun {
+			return
+		}
+		summary := report.Summary(beginTime, exitCode, err)
+		writeConsoleSummary(os.Stdout, summary, cfg.consoleLevel(), isTerminal(os.Stdout))
+		if len(cfg.SummaryFile) == 0 {
+			return
+		}
+		if err1 := writeSummaryFile(cfg.SummaryFile, summary); err1 != nil {
+			log.Error("write summary failed", zap.String("file", cfg.SummaryFile), zap.Error(err1))
+			return
+		}
+		log.Info("write summary", zap.String("file", cfg.SummaryFile))
+	}()
+
 	d, err := NewDiff(ctx, cfg)
 	if err != nil {
-		log.Fatal("fail to initialize diff process", zap.Error(err))
+		log.Error("fail to initialize diff process", zap.Error(err), utils.ZapErrCode(err))
+		return exitCode
 	}
+	report = d.report
 
 	err = d.Equal()
 	if err != nil {
-		log.Fatal("check data difference failed", zap.Error(err))
+		log.Error("check data difference failed", zap.Error(err), utils.ZapErrCode(err))
+		return exitCode
+	}
+
+	if cfg.DryRun {
+		exitCode = exitCodeEqual
+		return exitCode
 	}
 
 	log.Info("check report", zap.Stringer("report", d.report))
 
-	return d.report.Result == Pass
+	exitCode = d.report.ExitCode(nil)
+	return exitCode
 }
@@ -0,0 +1,100 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+)
+
+const (
+	// OnlineModeGTID waits the MySQL GTID replication.
+	OnlineModeGTID = "gtid"
+	// OnlineModeTSO waits the replication from TiDB by TSO.
+	OnlineModeTSO = "tso"
+
+	defaultOnlineWaitTimeout = 5 * time.Minute
+	tsoPollInterval          = time.Second
+)
+
+// OnlineCheck is the config of checking when the replication from source to target is still running, the mismatched
+// chunks are re-checked after the target applied the source's position, only the rows remain different are reported.
+type OnlineCheck struct {
+	// the type of the replication position, can be "gtid" or "tso", empty means disabled.
+	Mode string `toml:"mode" json:"mode"`
+	// the max times of re-checking the mismatched chunks, default is 3.
+	RecheckTimes int `toml:"recheck-times" json:"recheck-times"`
+	// the max time to wait the target to apply the source's position, default is "5m".
+	WaitTimeout string `toml:"wait-timeout" json:"wait-timeout"`
+	// the query returns the TSO applied by the target, for example the replication tool's checkpoint, used in "tso" mode.
+	AppliedTSQuery string `toml:"applied-ts-query" json:"applied-ts-query"`
+}
+
+func (o *OnlineCheck) enabled() bool {
+	return len(o.Mode) != 0
+}
+
+func (o *OnlineCheck) waitTimeout() (time.Duration, error) {
+	if len(o.WaitTimeout) == 0 {
+		return defaultOnlineWaitTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(o.WaitTimeout)
+	if err != nil {
+		return 0, errors.Annotatef(err, "parse wait-timeout %s", o.WaitTimeout)
+	}
+	if timeout <= 0 {
+		return 0, errors.NotValidf("wait-timeout %s", o.WaitTimeout)
+	}
+	return timeout, nil
+}
+
+func (o *OnlineCheck) valid() error {
+	switch o.Mode {
+	case "", OnlineModeGTID:
+	case OnlineModeTSO:
+		if len(o.AppliedTSQuery) == 0 {
+			return errors.NotValidf("empty applied-ts-query in tso mode")
+		}
+	default:
+		return errors.NotSupportedf("mode %s", o.Mode)
+	}
+
+	if o.RecheckTimes < 0 {
+		return errors.NotValidf("recheck-times %d", o.RecheckTimes)
+	}
+
+	_, err := o.waitTimeout()
+	return errors.Trace(err)
+}
+
+// replicationWaiter returns the ReplicationWaiter by the mode.
+func (o *OnlineCheck) replicationWaiter(source, target *sql.DB) (diff.ReplicationWaiter, error) {
+	timeout, err := o.waitTimeout()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	switch o.Mode {
+	case OnlineModeGTID:
+		return diff.NewGTIDWaiter(source, target, timeout), nil
+	case OnlineModeTSO:
+		return diff.NewTSOWaiter(source, target, o.AppliedTSQuery, timeout, tsoPollInterval), nil
+	default:
+		return nil, errors.NotSupportedf("mode %s", o.Mode)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+
+	"github.com/pingcap/log"
+)
+
+// watchPauseSignals pauses the diff when receives the pause signal, and resumes it when receives the resume signal.
+// returns a function to stop watching.
+func (df *Diff) watchPauseSignals() func() {
+	if len(pauseSignals) == 0 {
+		return func() {}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, pauseSignals...)
+	stopCh := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig == pauseSignals[0] {
+					df.pause()
+				} else {
+					df.resume()
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(stopCh)
+	}
+}
+
+func (df *Diff) pause() bool {
+	if !df.pauser.Pause() {
+		return false
+	}
+	log.Info("pause check, the chunks being checked will be finished")
+	return true
+}
+
+func (df *Diff) resume() bool {
+	if !df.pauser.Resume() {
+		return false
+	}
+	log.Info("resume check")
+	return true
+}
@@ -0,0 +1,20 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// +build windows
+
+package main
+
+import "os"
+
+// windows doesn't support SIGUSR1 and SIGUSR2, the diff can only be paused by the HTTP API.
+var pauseSignals []os.Signal
@@ -0,0 +1,142 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/check"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// minWaitTimeout is the minimal wait_timeout, the connections may be idle while the other instances are queried.
+const minWaitTimeout = time.Minute
+
+// minOutputFreeSpace is the minimal free space of the output directories, the size of the fix sql is unknown before
+// the check.
+const minOutputFreeSpace = 64 << 20
+
+// preCheck checks the privileges on the tables and the checkpoint schema, the sessions' timeouts and sql_mode of every
+// instance, whether the fix sql replaces the rows in target, and the free space of the output directories. the results are logged and saved in the report.
+func (df *Diff) preCheck(cfg *Config) (*check.Results, error) {
+	results, err := check.Do(df.ctx, df.preCheckers(cfg))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	df.report.SetPreCheckResults(results)
+
+	for _, result := range results.Results {
+		switch result.State {
+		case check.StateFailure:
+			log.Error("pre-check failed", zap.String("name", result.Name), zap.String("instance", result.Extra), zap.String("error", result.ErrorMsg), zap.String("instruction", result.Instruction))
+		case check.StateWarning:
+			log.Warn("pre-check warning", zap.String("name", result.Name), zap.String("instance", result.Extra), zap.String("error", result.ErrorMsg), zap.String("instruction", result.Instruction))
+		}
+	}
+
+	return results, nil
+}
+
+// preCheckers returns the checkers of every instance, the sources read from the dump directories are not checked.
+func (df *Diff) preCheckers(cfg *Config) []check.Checker {
+	// the queries of the rows are limited by the longer timeout, 0 means not limited
+	queryTimeout := df.timeouts.Checksum
+	if queryTimeout != 0 && (df.timeouts.RowFetch == 0 || df.timeouts.RowFetch > queryTimeout) {
+		queryTimeout = df.timeouts.RowFetch
+	}
+
+	sourcePrivileges := make(map[string][]*check.TablePrivilege)
+	targetPrivileges := make([]*check.TablePrivilege, 0, len(df.tables))
+	targetTables := make(map[string][]string)
+	for _, table := range orderTablesByPriority(df.tables, nil) {
+		for _, sourceTable := range table.SourceTables {
+			sourcePrivileges[sourceTable.InstanceID] = append(sourcePrivileges[sourceTable.InstanceID], &check.TablePrivilege{
+				Privilege: "SELECT",
+				Schema:    sourceTable.Schema,
+				Table:     sourceTable.Table,
+			})
+		}
+		targetPrivileges = append(targetPrivileges, &check.TablePrivilege{
+			Privilege: "SELECT",
+			Schema:    table.Schema,
+			Table:     table.Table,
+		})
+		targetTables[table.Schema] = append(targetTables[table.Schema], table.Table)
+	}
+
+	// the checkpoint is saved in full mode, and in quick mode to save the tables' data versions
+	var checkpointPrivileges []*check.TablePrivilege
+	if (!cfg.DryRun || cfg.CheckConfig) && (cfg.Mode != modeQuick || cfg.SkipUnchangedTables) {
+		for _, privilege := range []string{"SELECT", "CREATE", "INSERT", "UPDATE", "DELETE"} {
+			checkpointPrivileges = append(checkpointPrivileges, &check.TablePrivilege{
+				Privilege: privilege,
+				Schema:    diff.CheckpointSchemaName(),
+			})
+		}
+	}
+
+	var checkers []check.Checker
+	addInstanceCheckers := func(db DBConfig, privileges []*check.TablePrivilege) {
+		checkers = append(checkers,
+			check.NewTablePrivilegeChecker(db.Conn, &db.DBConfig, privileges),
+			check.NewSessionTimeoutChecker(db.Conn, &db.DBConfig, queryTimeout, minWaitTimeout),
+			check.NewSQLModeChecker(db.Conn, &db.DBConfig, check.DiffIncompatibleSQLModes),
+		)
+	}
+
+	for instanceID, privileges := range sourcePrivileges {
+		source := df.sourceDBs[instanceID]
+		// the rows are read from the dump files
+		if source.Conn == nil {
+			continue
+		}
+		addInstanceCheckers(source, privileges)
+	}
+
+	if df.checkpointDB == df.targetDB.Conn {
+		targetPrivileges = append(targetPrivileges, checkpointPrivileges...)
+	} else if len(checkpointPrivileges) != 0 {
+		checkers = append(checkers, check.NewTablePrivilegeChecker(df.checkpointDB, cfg.CheckpointDBCfg, checkpointPrivileges))
+	}
+	addInstanceCheckers(df.targetDB, targetPrivileges)
+	checkers = append(checkers, check.NewReplaceChecker(df.targetDB.Conn, &df.targetDB.DBConfig, targetTables))
+
+	return append(checkers, outputDirCheckers(cfg)...)
+}
+
+// outputDirCheckers returns the checkers of the directories of the fix sql and the spilled rows.
+func outputDirCheckers(cfg *Config) []check.Checker {
+	var checkers []check.Checker
+	if len(cfg.FixSQLDir) != 0 {
+		checkers = append(checkers, check.NewOutputDirChecker("fix-sql-dir", cfg.FixSQLDir, 0, minOutputFreeSpace))
+	} else if len(cfg.FixSQLFile) != 0 && cfg.FixSQLFile != os.DevNull {
+		checkers = append(checkers, check.NewOutputDirChecker("fix-sql-file", filepath.Dir(cfg.FixSQLFile), 0, minOutputFreeSpace))
+	}
+
+	if cfg.MemoryBudget > 0 {
+		spillDir := cfg.SpillDir
+		if len(spillDir) == 0 {
+			spillDir = os.TempDir()
+		}
+		// the spilled rows may be as large as the buffered rows
+		checkers = append(checkers, check.NewOutputDirChecker("spill-dir", spillDir, uint64(cfg.MemoryBudget)<<20, minOutputFreeSpace))
+	}
+
+	return checkers
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+const (
+	// PriorityCritical means the table is always checked first and fully.
+	PriorityCritical = "critical"
+	// PriorityNormal is the default priority, the tables are checked after the critical tables.
+	PriorityNormal = "normal"
+	// PriorityLow means the table is checked last, the tables checked least recently are checked first,
+	// so the low priority tables are checked round-robin across the runs if the time budget is not enough.
+	PriorityLow = "low"
+)
+
+var priorityOrder = map[string]int{
+	PriorityCritical: 0,
+	PriorityNormal:   1,
+	PriorityLow:      2,
+}
+
+// PriorityTimeBudget is the max time to check the tables of every priority class in one run, for example "2h".
+// empty means no limit, the critical tables don't have budget. the table being checked is not interrupted, so
+// the run can exceed the budget by the time of one table. if the tables are checked concurrently, the budget is the
+// elapsed time since the priority class's first table started, and the running tables can exceed it.
+type PriorityTimeBudget struct {
+	Normal string `toml:"normal" json:"normal"`
+	Low    string `toml:"low" json:"low"`
+}
+
+// budgets parses the time budget of every priority class.
+func (b *PriorityTimeBudget) budgets() (map[string]time.Duration, error) {
+	budgets := make(map[string]time.Duration)
+	for priority, budget := range map[string]string{PriorityNormal: b.Normal, PriorityLow: b.Low} {
+		if len(budget) == 0 {
+			continue
+		}
+
+		d, err := time.ParseDuration(budget)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse %s priority's time budget", priority)
+		}
+		if d <= 0 {
+			return nil, errors.NotValidf("%s priority's time budget %s", priority, budget)
+		}
+		budgets[priority] = d
+	}
+
+	return budgets, nil
+}
+
+// tablePriority returns the table's priority, default is normal.
+func tablePriority(table *TableConfig) string {
+	if len(table.Priority) == 0 {
+		return PriorityNormal
+	}
+	return table.Priority
+}
+
+// orderTablesByPriority returns the tables ordered by priority, the low priority tables are ordered by the
+// time of their latest finished check, and the other tables are ordered by name.
+func orderTablesByPriority(tables map[string]map[string]*TableConfig, lastCheckTimes map[string]time.Time) []*TableConfig {
+	orderedTables := make([]*TableConfig, 0, len(tables))
+	for _, schemaTables := range tables {
+		for _, table := range schemaTables {
+			orderedTables = append(orderedTables, table)
+		}
+	}
+
+	sort.Slice(orderedTables, func(i, j int) bool {
+		table1, table2 := orderedTables[i], orderedTables[j]
+		priority1, priority2 := tablePriority(table1), tablePriority(table2)
+		if priority1 != priority2 {
+			return priorityOrder[priority1] < priorityOrder[priority2]
+		}
+
+		name1, name2 := dbutil.TableName(table1.Schema, table1.Table), dbutil.TableName(table2.Schema, table2.Table)
+		if priority1 == PriorityLow {
+			// the tables never checked have zero time, so are checked first
+			time1, time2 := lastCheckTimes[name1], lastCheckTimes[name2]
+			if !time1.Equal(time2) {
+				return time1.Before(time2)
+			}
+		}
+		return name1 < name2
+	})
+
+	return orderedTables
+}
+
+// priorityBudget tracks the time spent on every priority class in this run.
+type priorityBudget struct {
+	budgets map[string]time.Duration
+	spent   map[string]time.Duration
+}
+
+func newPriorityBudget(budgets map[string]time.Duration) *priorityBudget {
+	return &priorityBudget{
+		budgets: budgets,
+		spent:   make(map[string]time.Duration),
+	}
+}
+
+// exhausted returns true if the priority class's time budget is used up.
+func (b *priorityBudget) exhausted(priority string) bool {
+	return b.exceeded(priority, b.spent[priority])
+}
+
+// exceeded returns true if spent uses up the priority class's time budget.
+func (b *priorityBudget) exceeded(priority string, spent time.Duration) bool {
+	budget, ok := b.budgets[priority]
+	return ok && spent >= budget
+}
+
+func (b *priorityBudget) add(priority string, d time.Duration) {
+	b.spent[priority] += d
+}
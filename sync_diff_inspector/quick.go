@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// quickCheckTable only compares the total row count and the whole table's checksum of the table, and saves the result
+// in the report. the table's data versions are saved if it passed the check.
+func (df *Diff) quickCheckTable(ctx context.Context, table *TableConfig, td *diff.TableDiff, versions map[string]string) error {
+	result := &diff.TableResult{
+		RunID:       df.runID,
+		Schema:      table.Schema,
+		Table:       table.Table,
+		StructEqual: true,
+	}
+
+	quickResult, err := td.QuickCheck(ctx)
+	result.CheckTime = time.Now()
+	if err != nil {
+		log.Error("quick check failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		df.status.addError(dbutil.TableName(table.Schema, table.Table), "", err)
+		df.report.SetTableError(table.Schema, table.Table, err)
+		result.State, result.Message = diff.TableResultError, err.Error()
+		df.exportTableResult(ctx, result)
+		return errors.Trace(err)
+	}
+
+	df.report.SetTableQuickCheckResult(table.Schema, table.Table, quickResult)
+	result.DataEqual = quickResult.Equal()
+	result.RowCounted, result.SourceRows, result.TargetRows = true, quickResult.SourceCount, quickResult.TargetCount
+	if result.DataEqual {
+		atomic.AddInt32(&df.report.PassNum, 1)
+		result.State = diff.TableResultPass
+	} else {
+		atomic.AddInt32(&df.report.FailedNum, 1)
+		result.State = diff.TableResultFail
+	}
+	df.exportTableResult(ctx, result)
+	df.saveTableVersions(ctx, table, versions, result.DataEqual)
+
+	return nil
+}
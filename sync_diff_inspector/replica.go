@@ -0,0 +1,107 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// the values of TiDB's tidb_replica_read.
+var replicaReadValues = map[string]struct{}{
+	"leader":              {},
+	"follower":            {},
+	"leader-and-follower": {},
+	"closest-replicas":    {},
+	"closest-adaptive":    {},
+}
+
+// validReplicaRead returns error if the config of reading from replicas is invalid.
+func (c *DBConfig) validReplicaRead() error {
+	if len(c.ReplicaRead) != 0 {
+		if _, ok := replicaReadValues[strings.ToLower(c.ReplicaRead)]; !ok {
+			return errors.NotValidf("replica-read %s", c.ReplicaRead)
+		}
+	}
+	if len(c.ReadStaleness) != 0 {
+		if _, err := dbutil.ParseReadStaleness(c.ReadStaleness); err != nil {
+			return errors.Trace(err)
+		}
+		if len(c.Snapshot) != 0 {
+			return errors.NotValidf("read-staleness with snapshot")
+		}
+	}
+	if len(c.ReadReplica) != 0 {
+		if _, _, err := parseAddress(c.ReadReplica); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// replicaReadDesc returns how the instance reads from the replicas, empty if reads from the leader or primary.
+func (c *DBConfig) replicaReadDesc() string {
+	var descs []string
+	if len(c.ReadReplica) != 0 {
+		descs = append(descs, fmt.Sprintf("read replica %s", c.ReadReplica))
+	}
+	if len(c.ReplicaRead) != 0 && !strings.EqualFold(c.ReplicaRead, "leader") {
+		descs = append(descs, fmt.Sprintf("tidb_replica_read %s", strings.ToLower(c.ReplicaRead)))
+	}
+	if len(c.ReadStaleness) != 0 {
+		descs = append(descs, fmt.Sprintf("read staleness %s", c.ReadStaleness))
+	}
+	return strings.Join(descs, ", ")
+}
+
+// readDBConfig returns the config used to open the connection, the address is replaced by the read replica, and the
+// session variable of follower read is set in every connection. the stale read is set by dbutil.
+func (c *DBConfig) readDBConfig() (dbutil.DBConfig, error) {
+	cfg := c.DBConfig
+	if len(c.ReadReplica) != 0 {
+		host, port, err := parseAddress(c.ReadReplica)
+		if err != nil {
+			return cfg, errors.Trace(err)
+		}
+		cfg.Host, cfg.Port = host, port
+	}
+
+	variables := make(map[string]string)
+	if len(c.ReplicaRead) != 0 {
+		variables["tidb_replica_read"] = strings.ToLower(c.ReplicaRead)
+	}
+	if len(variables) != 0 {
+		cfg.SessionVariables = mergeSessionVariables(c.SessionVariables, variables)
+	}
+
+	return cfg, nil
+}
+
+// parseAddress parses the address like "host:port".
+func parseAddress(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, errors.Annotatef(err, "address %s", address)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, errors.NotValidf("port of address %s", address)
+	}
+	return host, port, nil
+}
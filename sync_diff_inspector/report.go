@@ -15,7 +15,12 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/pingcap/tidb-tools/pkg/check"
+	"github.com/pingcap/tidb-tools/pkg/diff"
 )
 
 const (
@@ -31,6 +36,23 @@ type TableResult struct {
 	Table       string
 	StructEqual bool
 	DataEqual   bool
+
+	// the total number of rows in the checked chunks, only set if row-count-check is true
+	RowCountChecked bool
+	SourceRowCount  int64
+	TargetRowCount  int64
+
+	// the result of the quick check, only set in quick mode
+	Quick *diff.QuickResult
+
+	// the error occurred when checking the table
+	Error string
+
+	// true if the table is skipped because it's unchanged since the last successful check
+	Unchanged bool
+
+	// the time used to check the table
+	Duration time.Duration
 }
 
 // Report saves the check results.
@@ -38,10 +60,25 @@ type Report struct {
 	sync.RWMutex
 
 	// Result is pass or fail
-	Result       string
-	PassNum      int32
-	FailedNum    int32
+	Result    string
+	PassNum   int32
+	FailedNum int32
+	// the number of tables skipped because the time budget of their priority is exhausted, or skipped by the HTTP API
+	SkippedNum   int32
 	TableResults map[string]map[string]*TableResult
+	// the drifts of the accounts between every source and target, only set if check-accounts is true
+	AccountDrifts map[string][]*diff.AccountDrift
+	// the drifts of the sequences between every source schema and target, keyed by "instance-id.schema", only set if
+	// tidb-attributes is set and the sequences are not ignored
+	SequenceDrifts map[string][]*diff.SequenceDrift
+	// the differences of the session variables between the instances, they may cause false differences of the data
+	VariableDifferences []*diff.VariableDifference
+	// true if the session variables are aligned in all the instances' connections
+	VariablesAligned bool
+	// how the instances read from the replicas, the differences may be caused by the replication lag of the replicas
+	ReplicaReads map[string]string
+	// the results of the pre-checks at startup, nil if the pre-checks are off
+	PreCheckResults *check.Results
 }
 
 // NewReport returns a new Report.
@@ -75,10 +112,33 @@ func (r *Report) String() (report string) {
 	*/
 	report = fmt.Sprintf("\ncheck result: %s!\n", r.Result)
 	report += fmt.Sprintf("%d tables' check passed, %d tables' check failed.\n", r.PassNum, r.FailedNum)
+	if r.SkippedNum > 0 {
+		report += fmt.Sprintf("%d tables' check skipped because the time budget is exhausted.\n", r.SkippedNum)
+	}
 
 	var failTableRsult, passTableResult string
 	for schema, tableMap := range r.TableResults {
 		for table, result := range tableMap {
+			// the quick check's result is printed in one line
+			if result.Quick != nil {
+				if result.Quick.Equal() {
+					passTableResult = fmt.Sprintf("%s%s.%s: pass, %s\n", passTableResult, schema, table, result.Quick)
+				} else {
+					failTableRsult = fmt.Sprintf("%s%s.%s: fail, %s\n", failTableRsult, schema, table, result.Quick)
+				}
+				continue
+			}
+
+			if result.Unchanged {
+				passTableResult = fmt.Sprintf("%stable: %s.%s\ntable's data unchanged since the last successful check\n\n", passTableResult, schema, table)
+				continue
+			}
+
+			if len(result.Error) != 0 {
+				failTableRsult = fmt.Sprintf("%stable: %s.%s\ntable's check error: %s\n\n", failTableRsult, schema, table, result.Error)
+				continue
+			}
+
 			var structResult, dataResult string
 			if !result.StructEqual {
 				structResult = "table's struct not equal"
@@ -92,6 +152,10 @@ func (r *Report) String() (report string) {
 				dataResult = "table's data equal"
 			}
 
+			if result.RowCountChecked {
+				dataResult = fmt.Sprintf("%s\ntable's rows: source %d, target %d", dataResult, result.SourceRowCount, result.TargetRowCount)
+			}
+
 			if !result.StructEqual || !result.DataEqual {
 				failTableRsult = fmt.Sprintf("%stable: %s.%s\n%s\n%s\n\n", failTableRsult, schema, table, structResult, dataResult)
 			} else {
@@ -103,9 +167,126 @@ func (r *Report) String() (report string) {
 	// first print the check failed table's information
 	report += fmt.Sprintf("\n%s%s", failTableRsult, passTableResult)
 
+	instanceIDs := make([]string, 0, len(r.AccountDrifts))
+	for instanceID := range r.AccountDrifts {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+	for _, instanceID := range instanceIDs {
+		drifts := r.AccountDrifts[instanceID]
+		if len(drifts) == 0 {
+			report += fmt.Sprintf("accounts of %s equal\n", instanceID)
+			continue
+		}
+		report += fmt.Sprintf("accounts of %s not equal\n", instanceID)
+		for _, drift := range drifts {
+			report += fmt.Sprintf("%s\n", drift)
+		}
+	}
+
+	sources := make([]string, 0, len(r.SequenceDrifts))
+	for source := range r.SequenceDrifts {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		drifts := r.SequenceDrifts[source]
+		if len(drifts) == 0 {
+			report += fmt.Sprintf("sequences of %s equal\n", source)
+			continue
+		}
+		report += fmt.Sprintf("sequences of %s not equal\n", source)
+		for _, drift := range drifts {
+			report += fmt.Sprintf("%s\n", drift)
+		}
+	}
+
+	for _, difference := range r.VariableDifferences {
+		if r.VariablesAligned {
+			report += fmt.Sprintf("%s, aligned before check\n", difference)
+		} else {
+			report += fmt.Sprintf("%s, may cause false differences\n", difference)
+		}
+	}
+
+	instanceIDs = instanceIDs[:0]
+	for instanceID := range r.ReplicaReads {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+	for _, instanceID := range instanceIDs {
+		report += fmt.Sprintf("%s reads from replicas by %s, the data may be not consistent, differences may be false\n", instanceID, r.ReplicaReads[instanceID])
+	}
+
+	if r.PreCheckResults != nil {
+		for _, result := range r.PreCheckResults.Results {
+			if result.State != check.StateSuccess {
+				report += fmt.Sprintf("pre-check %s of %s %s: %s\n", result.Name, result.Extra, result.State, result.ErrorMsg)
+			}
+		}
+	}
+
 	return
 }
 
+// SetReplicaRead sets how the instance reads from the replicas.
+func (r *Report) SetReplicaRead(instanceID, desc string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.ReplicaReads == nil {
+		r.ReplicaReads = make(map[string]string)
+	}
+	r.ReplicaReads[instanceID] = desc
+}
+
+// SetPreCheckResults sets the results of the pre-checks.
+func (r *Report) SetPreCheckResults(results *check.Results) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.PreCheckResults = results
+}
+
+// SetVariableCheckResult sets the differences of the session variables between the instances.
+func (r *Report) SetVariableCheckResult(differences []*diff.VariableDifference, aligned bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.VariableDifferences = differences
+	r.VariablesAligned = aligned
+}
+
+// SetAccountCheckResult sets the drifts of the accounts between the source instance and target.
+func (r *Report) SetAccountCheckResult(instanceID string, drifts []*diff.AccountDrift) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.AccountDrifts == nil {
+		r.AccountDrifts = make(map[string][]*diff.AccountDrift)
+	}
+	r.AccountDrifts[instanceID] = drifts
+
+	if len(drifts) != 0 {
+		r.Result = Fail
+	}
+}
+
+// SetSequenceCheckResult sets the drifts of the sequences between the source instance's schema and target.
+func (r *Report) SetSequenceCheckResult(instanceID, schema string, drifts []*diff.SequenceDrift) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.SequenceDrifts == nil {
+		r.SequenceDrifts = make(map[string][]*diff.SequenceDrift)
+	}
+	r.SequenceDrifts[fmt.Sprintf("%s.%s", instanceID, schema)] = drifts
+
+	if len(drifts) != 0 {
+		r.Result = Fail
+	}
+}
+
 // SetTableStructCheckResult sets the struct check result for table.
 func (r *Report) SetTableStructCheckResult(schema, table string, equal bool) {
 	r.Lock()
@@ -149,3 +330,94 @@ func (r *Report) SetTableDataCheckResult(schema, table string, equal bool) {
 		r.Result = Fail
 	}
 }
+
+// SetTableQuickCheckResult sets the quick check result for table, the table's struct is not checked.
+func (r *Report) SetTableQuickCheckResult(schema, table string, result *diff.QuickResult) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.TableResults[schema]; !ok {
+		r.TableResults[schema] = make(map[string]*TableResult)
+	}
+
+	equal := result.Equal()
+	r.TableResults[schema][table] = &TableResult{
+		Schema:          schema,
+		Table:           table,
+		StructEqual:     true,
+		DataEqual:       equal,
+		RowCountChecked: true,
+		SourceRowCount:  result.SourceCount,
+		TargetRowCount:  result.TargetCount,
+		Quick:           result,
+	}
+
+	if !equal {
+		r.Result = Fail
+	}
+}
+
+// SetTableUnchanged sets the table is skipped because it's unchanged since the last successful check.
+func (r *Report) SetTableUnchanged(schema, table string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.TableResults[schema]; !ok {
+		r.TableResults[schema] = make(map[string]*TableResult)
+	}
+
+	r.TableResults[schema][table] = &TableResult{
+		Schema:      schema,
+		Table:       table,
+		StructEqual: true,
+		DataEqual:   true,
+		Unchanged:   true,
+	}
+}
+
+// SetTableError sets the error occurred when checking the table.
+func (r *Report) SetTableError(schema, table string, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.TableResults[schema]; !ok {
+		r.TableResults[schema] = make(map[string]*TableResult)
+	}
+
+	tableResult, ok := r.TableResults[schema][table]
+	if !ok {
+		tableResult = &TableResult{}
+		r.TableResults[schema][table] = tableResult
+	}
+	tableResult.Error = err.Error()
+	r.Result = Fail
+}
+
+// SetTableDuration sets the time used to check the table, it's ignored if the table has no result.
+func (r *Report) SetTableDuration(schema, table string, duration time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	if tableResult, ok := r.TableResults[schema][table]; ok {
+		tableResult.Duration = duration
+	}
+}
+
+// SetTableRowCount sets the total number of rows in source and target for table.
+func (r *Report) SetTableRowCount(schema, table string, sourceCount, targetCount int64) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.TableResults[schema]; !ok {
+		r.TableResults[schema] = make(map[string]*TableResult)
+	}
+
+	tableResult, ok := r.TableResults[schema][table]
+	if !ok {
+		tableResult = &TableResult{}
+		r.TableResults[schema][table] = tableResult
+	}
+	tableResult.RowCountChecked = true
+	tableResult.SourceRowCount = sourceCount
+	tableResult.TargetRowCount = targetCount
+}
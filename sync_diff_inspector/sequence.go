@@ -0,0 +1,73 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// sequenceSchemas is a pair of the source's schema and the target's schema whose sequences are compared.
+type sequenceSchemas struct {
+	instanceID   string
+	sourceSchema string
+	targetSchema string
+}
+
+// compareSequences compares the definitions of the sequences between every checked source schema and target schema,
+// the drifts are saved in report.
+func (df *Diff) compareSequences(ctx context.Context) error {
+	pairs := make(map[sequenceSchemas]struct{})
+	for _, tables := range df.tables {
+		for _, table := range tables {
+			for _, sourceTable := range table.SourceTables {
+				pairs[sequenceSchemas{instanceID: sourceTable.InstanceID, sourceSchema: sourceTable.Schema, targetSchema: table.Schema}] = struct{}{}
+			}
+		}
+	}
+
+	sortedPairs := make([]sequenceSchemas, 0, len(pairs))
+	for pair := range pairs {
+		sortedPairs = append(sortedPairs, pair)
+	}
+	sort.Slice(sortedPairs, func(i, j int) bool {
+		if sortedPairs[i].instanceID != sortedPairs[j].instanceID {
+			return sortedPairs[i].instanceID < sortedPairs[j].instanceID
+		}
+		if sortedPairs[i].sourceSchema != sortedPairs[j].sourceSchema {
+			return sortedPairs[i].sourceSchema < sortedPairs[j].sourceSchema
+		}
+		return sortedPairs[i].targetSchema < sortedPairs[j].targetSchema
+	})
+
+	for _, pair := range sortedPairs {
+		drifts, err := diff.CompareSequences(ctx, df.sourceDBs[pair.instanceID].Conn, df.targetDB.Conn, pair.sourceSchema, pair.targetSchema)
+		if err != nil {
+			return errors.Annotatef(err, "compare sequences of %s", pair.instanceID)
+		}
+
+		for _, drift := range drifts {
+			log.Warn("sequence drift", zap.String("source", pair.instanceID), zap.String("schema", pair.sourceSchema), zap.Stringer("drift", drift))
+		}
+		log.Info("compare sequences", zap.String("source", pair.instanceID), zap.String("schema", pair.sourceSchema), zap.Int("drifts", len(drifts)))
+		df.report.SetSequenceCheckResult(pair.instanceID, pair.sourceSchema, drifts)
+	}
+
+	return nil
+}
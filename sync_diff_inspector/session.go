@@ -0,0 +1,92 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// checkSessionVariables compares the session variables which may cause false differences between all the instances,
+// and saves the differences in the report. if align is true and there are differences, the connections are reopened
+// with the aligned session variables by connect.
+func (df *Diff) checkSessionVariables(align bool, connect func(db *DBConfig) error) error {
+	instanceIDs := make([]string, 0, len(df.sourceDBs))
+	for instanceID, source := range df.sourceDBs {
+		// the rows are read from the files
+		if source.Conn == nil {
+			continue
+		}
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+
+	instances := make([]*diff.SessionVariables, 0, len(instanceIDs)+1)
+	for _, instanceID := range instanceIDs {
+		variables, err := diff.FetchSessionVariables(df.ctx, df.sourceDBs[instanceID].Conn, instanceID)
+		if err != nil {
+			return errors.Annotatef(err, "fetch session variables from %s", instanceID)
+		}
+		instances = append(instances, variables)
+	}
+	variables, err := diff.FetchSessionVariables(df.ctx, df.targetDB.Conn, df.targetDB.InstanceID)
+	if err != nil {
+		return errors.Annotatef(err, "fetch session variables from %s", df.targetDB.InstanceID)
+	}
+	instances = append(instances, variables)
+
+	differences := diff.CompareSessionVariables(instances)
+	for _, difference := range differences {
+		log.Warn("session variable is different, may cause false differences", zap.Stringer("difference", difference), zap.Bool("align", align))
+	}
+	df.report.SetVariableCheckResult(differences, align && len(differences) != 0)
+	if !align || len(differences) == 0 {
+		return nil
+	}
+
+	// reopen the connections, the driver sets the aligned session variables in every new connection
+	for i, instanceID := range instanceIDs {
+		source := df.sourceDBs[instanceID]
+		source.Conn.Close()
+		source.SessionVariables = mergeSessionVariables(source.SessionVariables, diff.AlignedSessionVariables(instances[i]))
+		if err = connect(&source); err != nil {
+			return errors.Annotatef(err, "align session variables of source %s", instanceID)
+		}
+		df.sourceDBs[instanceID] = source
+	}
+	df.targetDB.Conn.Close()
+	df.targetDB.SessionVariables = mergeSessionVariables(df.targetDB.SessionVariables, diff.AlignedSessionVariables(variables))
+	if err = connect(&df.targetDB); err != nil {
+		return errors.Annotatef(err, "align session variables of target %s", df.targetDB.InstanceID)
+	}
+	log.Info("session variables are aligned in all the instances")
+
+	return nil
+}
+
+// mergeSessionVariables returns the session variables in the config overridden by the aligned session variables.
+func mergeSessionVariables(variables, aligned map[string]string) map[string]string {
+	merged := make(map[string]string, len(variables)+len(aligned))
+	for name, value := range variables {
+		merged[name] = value
+	}
+	for name, value := range aligned {
+		merged[name] = value
+	}
+	return merged
+}
@@ -0,0 +1,316 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// the max number of errors kept in the status, the earliest errors are dropped.
+const maxStatusErrors = 100
+
+// StatusError is an error occurred in the check.
+type StatusError struct {
+	Time  time.Time `json:"time"`
+	Table string    `json:"table"`
+	// the chunk's range, empty if the error is not occurred in a chunk
+	Chunk string `json:"chunk,omitempty"`
+	Error string `json:"error"`
+}
+
+// TableStatus is the progress of a table being checked.
+type TableStatus struct {
+	Table         string `json:"table"`
+	Phase         string `json:"phase"`
+	TotalChunks   int    `json:"total-chunks"`
+	CheckedChunks int    `json:"checked-chunks"`
+}
+
+// Status is the runtime status of the check.
+type Status struct {
+	Paused bool `json:"paused"`
+	// the tables being checked, ordered by name
+	Tables        []*TableStatus `json:"tables"`
+	TotalTables   int            `json:"total-tables"`
+	CheckedTables int            `json:"checked-tables"`
+	// the tables skipped by the HTTP API
+	SkippedTables []string `json:"skipped-tables"`
+	// the max number of chunks checked concurrently in every instance, 0 means no limit
+	Concurrency map[string]int `json:"concurrency"`
+	// the knobs can be changed at runtime, like the qps limit
+	Tuning *Tuning `json:"tuning"`
+	// the number of chunks being checked in every instance
+	RunningChunks map[string]int `json:"running-chunks"`
+	// the chunks being checked, ordered by the start time
+	InFlightChunks []diff.InFlightChunk `json:"in-flight-chunks"`
+	Errors         []StatusError        `json:"errors"`
+}
+
+// tableProgress is the ProgressReporter of a table being checked.
+type tableProgress struct {
+	sync.Mutex
+
+	status TableStatus
+	cancel context.CancelFunc
+}
+
+func (p *tableProgress) SetPhase(phase string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.status.Phase = phase
+}
+
+func (p *tableProgress) SetTotal(total int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.status.TotalChunks = total
+	p.status.CheckedChunks = 0
+}
+
+func (p *tableProgress) Increment(n int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.status.CheckedChunks += n
+}
+
+func (p *tableProgress) snapshot() *TableStatus {
+	p.Lock()
+	defer p.Unlock()
+
+	status := p.status
+	return &status
+}
+
+// statusTracker tracks the runtime status of the check.
+type statusTracker struct {
+	sync.RWMutex
+
+	// the tables being checked
+	running       map[string]*tableProgress
+	totalTables   int
+	checkedTables int
+	skippedTables []string
+	skipped       map[string]struct{}
+	errors        []StatusError
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		running: make(map[string]*tableProgress),
+		skipped: make(map[string]struct{}),
+	}
+}
+
+func (s *statusTracker) setTotalTables(total int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.totalTables = total
+}
+
+// startTable marks the table as being checked, and returns the table's ProgressReporter.
+// cancel is called if the table is skipped.
+func (s *statusTracker) startTable(schema, table string, cancel context.CancelFunc) diff.ProgressReporter {
+	s.Lock()
+	defer s.Unlock()
+
+	progress := &tableProgress{
+		status: TableStatus{Table: dbutil.TableName(schema, table)},
+		cancel: cancel,
+	}
+	s.running[progress.status.Table] = progress
+	return progress
+}
+
+// finishTable marks the table as finished.
+func (s *statusTracker) finishTable(schema, table string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.running, dbutil.TableName(schema, table))
+	s.checkedTables++
+}
+
+func (s *statusTracker) skipTable(schema, table string) {
+	s.Lock()
+	defer s.Unlock()
+
+	tableName := dbutil.TableName(schema, table)
+	if _, ok := s.skipped[tableName]; ok {
+		return
+	}
+	s.skipped[tableName] = struct{}{}
+	s.skippedTables = append(s.skippedTables, tableName)
+
+	if progress, ok := s.running[tableName]; ok {
+		progress.cancel()
+	}
+}
+
+func (s *statusTracker) isSkipped(schema, table string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.skipped[dbutil.TableName(schema, table)]
+	return ok
+}
+
+func (s *statusTracker) addError(table, chunk string, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.errors = append(s.errors, StatusError{
+		Time:  time.Now(),
+		Table: table,
+		Chunk: chunk,
+		Error: err.Error(),
+	})
+	if len(s.errors) > maxStatusErrors {
+		s.errors = s.errors[len(s.errors)-maxStatusErrors:]
+	}
+}
+
+// HandleChunkResult records the chunks' errors, it can be used as TableDiff's ChunkResultHandler.
+func (s *statusTracker) HandleChunkResult(ctx context.Context, result *diff.ChunkResult) {
+	if result.Err == nil {
+		return
+	}
+
+	chunk := ""
+	if result.Chunk != nil {
+		chunk = result.Chunk.Where
+	}
+	s.addError(dbutil.TableName(result.Schema, result.Table), chunk, result.Err)
+}
+
+func (s *statusTracker) status() *Status {
+	s.RLock()
+	defer s.RUnlock()
+
+	tables := make([]*TableStatus, 0, len(s.running))
+	for _, progress := range s.running {
+		tables = append(tables, progress.snapshot())
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Table < tables[j].Table
+	})
+
+	return &Status{
+		Tables:        tables,
+		TotalTables:   s.totalTables,
+		CheckedTables: s.checkedTables,
+		SkippedTables: append([]string{}, s.skippedTables...),
+		Errors:        append([]StatusError{}, s.errors...),
+	}
+}
+
+// Status returns the runtime status of the check.
+func (df *Diff) Status() *Status {
+	status := df.status.status()
+	status.Paused = df.pauser.Paused()
+	status.Concurrency = df.concurrency()
+	status.Tuning = df.getTuning()
+	status.RunningChunks = make(map[string]int, len(df.limiters))
+	for instanceID, limiter := range df.limiters {
+		status.RunningChunks[instanceID] = limiter.Running()
+	}
+	if df.inFlight != nil {
+		status.InFlightChunks = df.inFlight.Snapshot()
+	}
+	return status
+}
+
+func (df *Diff) concurrency() map[string]int {
+	concurrency := make(map[string]int, len(df.limiters))
+	for instanceID, limiter := range df.limiters {
+		concurrency[instanceID] = limiter.Limit()
+	}
+	return concurrency
+}
+
+// setConcurrency changes the max number of chunks checked concurrently in the instance, 0 means no limit.
+func (df *Diff) setConcurrency(instanceID string, limit int) error {
+	if limit < 0 {
+		return errors.NotValidf("limit %d", limit)
+	}
+	limiter, ok := df.limiters[instanceID]
+	if !ok {
+		return errors.NotFoundf("instance %s", instanceID)
+	}
+
+	limiter.SetLimit(limit)
+	log.Info("change concurrency", zap.String("instance id", instanceID), zap.Int("limit", limit))
+	return nil
+}
+
+// Tuning is the knobs can be changed at runtime.
+type Tuning struct {
+	// the max number of queries sent to the databases per second, 0 means no limit
+	QPSLimit int `json:"qps-limit"`
+	// the sampling check percent of the chunks not checked yet, 0 means using the configured sample
+	Sample int `json:"sample"`
+}
+
+func (df *Diff) getTuning() *Tuning {
+	if df.tuning == nil {
+		return nil
+	}
+	return &Tuning{
+		QPSLimit: df.tuning.QPSLimit(),
+		Sample:   df.tuning.Sample(),
+	}
+}
+
+// setTuning changes the knobs, the nil value is not changed.
+func (df *Diff) setTuning(qpsLimit, sample *int) error {
+	if df.tuning == nil {
+		return errors.NotSupportedf("tuning before the databases are connected")
+	}
+	if qpsLimit != nil {
+		if err := df.tuning.SetQPSLimit(*qpsLimit); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("change qps limit", zap.Int("qps limit", *qpsLimit))
+	}
+	if sample != nil {
+		if err := df.tuning.SetSample(*sample); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("change sample", zap.Int("sample", *sample))
+	}
+	return nil
+}
+
+// skipTable skips the target table, the table is stopped if it's being checked.
+func (df *Diff) skipTable(schema, table string) error {
+	if _, ok := df.tables[schema][table]; !ok {
+		return errors.NotFoundf("table %s", dbutil.TableName(schema, table))
+	}
+
+	df.status.skipTable(schema, table)
+	log.Info("skip table", zap.String("table", dbutil.TableName(schema, table)))
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/check"
+)
+
+// the exit codes of sync_diff_inspector, so the automation can branch on the outcomes without parsing the logs.
+const (
+	// exitCodeEqual means all the checked tables are equal
+	exitCodeEqual = 0
+	// exitCodeError means some errors occurred, the check is not finished
+	exitCodeError = 1
+	// exitCodeInvalidConfig means the flags or the config is invalid
+	exitCodeInvalidConfig = 2
+	// exitCodeStructDiffers means some tables' struct are different
+	exitCodeStructDiffers = 3
+	// exitCodeDataDiffers means some tables' data, or the accounts are different, and all the tables' struct are equal
+	exitCodeDataDiffers = 4
+	// exitCodeSkipped means some tables are skipped, and all the checked tables are equal
+	exitCodeSkipped = 5
+)
+
+// the verdicts of the tables in the summary.
+const (
+	verdictEqual         = "equal"
+	verdictStructDiffers = "struct-differs"
+	verdictDataDiffers   = "data-differs"
+	verdictError         = "error"
+)
+
+// TableSummary is the table's verdict in the summary.
+type TableSummary struct {
+	Schema      string `json:"schema"`
+	Table       string `json:"table"`
+	Verdict     string `json:"verdict"`
+	StructEqual bool   `json:"struct-equal"`
+	DataEqual   bool   `json:"data-equal"`
+	// the total number of rows, only set if the rows are counted
+	SourceRows *int64 `json:"source-rows,omitempty"`
+	TargetRows *int64 `json:"target-rows,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// the time used to check the table in seconds
+	Duration float64 `json:"duration"`
+}
+
+// Summary is the machine-readable summary of the run.
+type Summary struct {
+	Result     string          `json:"result"`
+	ExitCode   int             `json:"exit-code"`
+	StartTime  time.Time       `json:"start-time"`
+	EndTime    time.Time       `json:"end-time"`
+	PassNum    int32           `json:"pass-num"`
+	FailedNum  int32           `json:"failed-num"`
+	SkippedNum int32           `json:"skipped-num"`
+	Error      string          `json:"error,omitempty"`
+	Tables     []*TableSummary `json:"tables"`
+	// the results of the pre-checks at startup
+	PreCheck *check.Results `json:"pre-check,omitempty"`
+}
+
+// tableVerdict returns the verdict of the table's result.
+func tableVerdict(result *TableResult) string {
+	switch {
+	case len(result.Error) != 0:
+		return verdictError
+	case !result.StructEqual:
+		return verdictStructDiffers
+	case !result.DataEqual:
+		return verdictDataDiffers
+	default:
+		return verdictEqual
+	}
+}
+
+// ExitCode returns the exit code by the results of the tables, err is the error of the run.
+func (r *Report) ExitCode(err error) int {
+	r.RLock()
+	defer r.RUnlock()
+
+	if err != nil {
+		return exitCodeError
+	}
+
+	code := exitCodeEqual
+	for _, tableMap := range r.TableResults {
+		for _, result := range tableMap {
+			switch tableVerdict(result) {
+			case verdictError:
+				return exitCodeError
+			case verdictStructDiffers:
+				code = exitCodeStructDiffers
+			case verdictDataDiffers:
+				if code == exitCodeEqual {
+					code = exitCodeDataDiffers
+				}
+			}
+		}
+	}
+	// the accounts are different
+	if code == exitCodeEqual && r.Result == Fail {
+		code = exitCodeDataDiffers
+	}
+	// the skipped tables are not verified, so they can't be regarded as equal
+	if code == exitCodeEqual && r.SkippedNum > 0 {
+		code = exitCodeSkipped
+	}
+
+	return code
+}
+
+// Summary returns the summary of the run, the tables are sorted by name.
+func (r *Report) Summary(startTime time.Time, exitCode int, err error) *Summary {
+	r.RLock()
+	defer r.RUnlock()
+
+	summary := &Summary{
+		Result:     r.Result,
+		ExitCode:   exitCode,
+		StartTime:  startTime,
+		EndTime:    time.Now(),
+		PassNum:    r.PassNum,
+		FailedNum:  r.FailedNum,
+		SkippedNum: r.SkippedNum,
+		Tables:     make([]*TableSummary, 0, len(r.TableResults)),
+		PreCheck:   r.PreCheckResults,
+	}
+	if err != nil {
+		summary.Result = Fail
+		summary.Error = err.Error()
+	}
+
+	for schema, tableMap := range r.TableResults {
+		for table, result := range tableMap {
+			tableSummary := &TableSummary{
+				Schema:      schema,
+				Table:       table,
+				Verdict:     tableVerdict(result),
+				StructEqual: result.StructEqual,
+				DataEqual:   result.DataEqual,
+				Error:       result.Error,
+				Duration:    result.Duration.Seconds(),
+			}
+			if result.RowCountChecked {
+				sourceRows, targetRows := result.SourceRowCount, result.TargetRowCount
+				tableSummary.SourceRows, tableSummary.TargetRows = &sourceRows, &targetRows
+			}
+			summary.Tables = append(summary.Tables, tableSummary)
+		}
+	}
+	sort.Slice(summary.Tables, func(i, j int) bool {
+		if summary.Tables[i].Schema != summary.Tables[j].Schema {
+			return summary.Tables[i].Schema < summary.Tables[j].Schema
+		}
+		return summary.Tables[i].Table < summary.Tables[j].Table
+	})
+
+	return summary
+}
+
+// writeSummaryFile writes the summary into the file in JSON format, the file is replaced atomically, so the automation
+// never reads a partial summary.
+func writeSummaryFile(path string, summary *Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	if err = f.Chmod(0644); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	if err = f.Close(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(os.Rename(f.Name(), path))
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+var _ = Suite(&testSummarySuite{})
+
+type testSummarySuite struct{}
+
+func (s *testSummarySuite) TestExitCode(c *C) {
+	equal := &TableResult{StructEqual: true, DataEqual: true}
+	dataDiffers := &TableResult{StructEqual: true, DataEqual: false}
+	structDiffers := &TableResult{StructEqual: false, DataEqual: true}
+	failed := &TableResult{StructEqual: true, DataEqual: true, Error: "check failed"}
+
+	testCases := []struct {
+		results []*TableResult
+		result  string
+		skipped int32
+		err     error
+		code    int
+	}{
+		{nil, Pass, 0, nil, exitCodeEqual},
+		{[]*TableResult{equal, equal}, Pass, 0, nil, exitCodeEqual},
+		{[]*TableResult{equal}, Pass, 0, errors.New("run failed"), exitCodeError},
+		{[]*TableResult{equal, failed, structDiffers}, Fail, 0, nil, exitCodeError},
+		{[]*TableResult{dataDiffers, structDiffers}, Fail, 0, nil, exitCodeStructDiffers},
+		{[]*TableResult{equal, dataDiffers}, Fail, 0, nil, exitCodeDataDiffers},
+		// the accounts are different
+		{[]*TableResult{equal}, Fail, 0, nil, exitCodeDataDiffers},
+		// the skipped tables are not regarded as equal, but the differences come first
+		{[]*TableResult{equal}, Pass, 1, nil, exitCodeSkipped},
+		{nil, Pass, 2, nil, exitCodeSkipped},
+		{[]*TableResult{dataDiffers}, Fail, 1, nil, exitCodeDataDiffers},
+		{[]*TableResult{failed}, Fail, 1, nil, exitCodeError},
+	}
+	for i, tc := range testCases {
+		report := NewReport()
+		report.Result = tc.result
+		report.SkippedNum = tc.skipped
+		for j, result := range tc.results {
+			report.TableResults[fmt.Sprintf("schema%d", j)] = map[string]*TableResult{"t": result}
+		}
+		c.Assert(report.ExitCode(tc.err), Equals, tc.code, Commentf("case %d", i))
+	}
+}
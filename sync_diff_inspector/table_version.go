@@ -0,0 +1,56 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// tableVersions returns the current data versions of the table's instances, and true if they are unchanged since the
+// last successful check. the table is checked if failed to get the versions.
+func (df *Diff) tableVersions(ctx context.Context, table *TableConfig, td *diff.TableDiff) (map[string]string, bool) {
+	versions, err := td.DataVersions(ctx)
+	if err != nil {
+		log.Warn("get table's data versions failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		return nil, false
+	}
+
+	cached, err := diff.LoadTableVersions(ctx, df.checkpointDB, table.Schema, table.Table)
+	if err != nil {
+		log.Warn("load table's data versions failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+		return versions, false
+	}
+
+	return versions, diff.UnchangedVersions(versions, cached)
+}
+
+// saveTableVersions saves the table's data versions if it passed the check, otherwise clears the saved versions,
+// the errors are only logged because the check is finished.
+func (df *Diff) saveTableVersions(ctx context.Context, table *TableConfig, versions map[string]string, passed bool) {
+	if versions == nil {
+		return
+	}
+	if !passed {
+		versions = nil
+	}
+
+	if err := diff.SaveTableVersions(ctx, df.checkpointDB, table.Schema, table.Table, versions); err != nil {
+		log.Warn("save table's data versions failed", zap.String("table", dbutil.TableName(table.Schema, table.Table)), zap.Error(err))
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// Timeouts is the config of the queries' timeouts by class, for example "30s". empty means the default timeout, and
+// "0s" means no timeout, the query is only stopped when the check is canceled.
+type Timeouts struct {
+	// the timeout of the queries of the tables' metadata, like SHOW CREATE TABLE, default is "25s".
+	Metadata string `toml:"metadata" json:"metadata"`
+	// the timeout of the queries scan the rows to calculate the checksum or count the rows, default is no timeout.
+	Checksum string `toml:"checksum" json:"checksum"`
+	// the timeout of the queries select the rows, default is no timeout.
+	RowFetch string `toml:"row-fetch" json:"row-fetch"`
+	// the timeout of the statements load and save the checkpoint and summary, default is "25s".
+	Checkpoint string `toml:"checkpoint" json:"checkpoint"`
+}
+
+// policy returns the TimeoutPolicy, the empty timeouts are the default timeouts.
+func (t *Timeouts) policy() (*dbutil.TimeoutPolicy, error) {
+	policy := dbutil.DefaultTimeoutPolicy()
+	for _, timeout := range []struct {
+		class dbutil.TimeoutClass
+		value string
+		field *time.Duration
+	}{
+		{dbutil.TimeoutMetadata, t.Metadata, &policy.Metadata},
+		{dbutil.TimeoutChecksum, t.Checksum, &policy.Checksum},
+		{dbutil.TimeoutRowFetch, t.RowFetch, &policy.RowFetch},
+		{dbutil.TimeoutCheckpoint, t.Checkpoint, &policy.Checkpoint},
+	} {
+		if len(timeout.value) == 0 {
+			continue
+		}
+
+		d, err := time.ParseDuration(timeout.value)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse %s timeout %s", timeout.class, timeout.value)
+		}
+		*timeout.field = d
+	}
+
+	return policy, errors.Trace(policy.Valid())
+}
@@ -15,8 +15,21 @@ package main
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
 )
 
 func schemaName(instanceID, schema string) string {
 	return fmt.Sprintf("%s|%s", instanceID, schema)
 }
+
+// splitTableName splits "schema.table" to schema and table.
+func splitTableName(name string) (string, string, error) {
+	names := strings.Split(name, ".")
+	if len(names) != 2 || len(names[0]) == 0 || len(names[1]) == 0 {
+		return "", "", errors.NotValidf("table name %s", name)
+	}
+
+	return names[0], names[1], nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/diff/worker"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// workerCommand is the subcommand runs a long-running worker, which checks the key ranges of the tables on requests
+// by gRPC, for example from DM, instead of checking the tables in the config.
+const workerCommand = "worker"
+
+// runWorker serves the worker's gRPC service on worker-addr until SIGINT or SIGTERM, the source and target databases
+// and the tables are from the config, and the check-thread-count ranges are checked concurrently.
+func runWorker(ctx context.Context, cfg *Config) error {
+	if len(cfg.WorkerAddr) == 0 {
+		return errors.NotValidf("empty worker-addr")
+	}
+
+	timeouts, err := cfg.Timeouts.policy()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	workerCfg := worker.Config{
+		SourceDBs:   make(map[string]dbutil.DBConfig, len(cfg.SourceDBCfg)),
+		TargetDB:    cfg.TargetDBCfg.DBConfig,
+		Concurrency: cfg.CheckThreadCount,
+		Timeouts:    timeouts,
+	}
+	for _, source := range cfg.SourceDBCfg {
+		if len(source.DumpDir) != 0 {
+			log.Warn("the worker doesn't support the dump directory, skip the source", zap.String("instance id", source.InstanceID))
+			continue
+		}
+		workerCfg.SourceDBs[source.InstanceID] = source.DBConfig
+	}
+	workerCfg.TLS, err = workerTLSConfig(cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	workerCfg.Tables, err = workerTables(ctx, cfg, workerCfg.SourceDBs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(workerCfg.Tables) == 0 {
+		return errors.NotFoundf("tables to check")
+	}
+
+	w, err := worker.NewWorker(workerCfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer w.Close()
+
+	listener, err := net.Listen("tcp", cfg.WorkerAddr)
+	if err != nil {
+		return errors.Annotatef(err, "listen on %s", cfg.WorkerAddr)
+	}
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sc)
+	go func() {
+		select {
+		case sig := <-sc:
+			log.Info("got signal to stop the worker", zap.Stringer("signal", sig))
+		case <-ctx.Done():
+		}
+		w.Stop()
+	}()
+
+	return errors.Trace(w.Serve(listener))
+}
+
+// workerTLSConfig returns the TLS config of the worker's gRPC service, which verifies the clients' certificates by the
+// CA. nil if the TLS is not configured.
+func workerTLSConfig(cfg *Config) (*tls.Config, error) {
+	if len(cfg.WorkerSSLCA) == 0 && len(cfg.WorkerSSLCert) == 0 && len(cfg.WorkerSSLKey) == 0 {
+		return nil, nil
+	}
+	if len(cfg.WorkerSSLCA) == 0 || len(cfg.WorkerSSLCert) == 0 || len(cfg.WorkerSSLKey) == 0 {
+		return nil, errors.NotValidf("worker TLS without all of worker-ssl-ca, worker-ssl-cert and worker-ssl-key")
+	}
+
+	tlsConfig, err := utils.ToTLSConfig(cfg.WorkerSSLCA, cfg.WorkerSSLCert, cfg.WorkerSSLKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	tlsConfig.ClientCAs = tlsConfig.RootCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
+
+// workerTables returns the tables to check in the config, resolved like the batch check by the read-only
+// connections. the source tables in the dump directories are skipped.
+func workerTables(ctx context.Context, cfg *Config, sourceDBs map[string]dbutil.DBConfig) ([]*worker.TableConfig, error) {
+	df := &Diff{
+		sourceDBs:     make(map[string]DBConfig),
+		tables:        make(map[string]map[string]*TableConfig),
+		metadataCache: dbutil.NewMetadataCache(),
+		report:        NewReport(),
+		ctx:           ctx,
+	}
+	defer df.Close()
+
+	for _, source := range cfg.SourceDBCfg {
+		if _, ok := sourceDBs[source.InstanceID]; !ok {
+			continue
+		}
+		conn, err := dbutil.OpenReadOnlyDB(source.DBConfig)
+		if err != nil {
+			return nil, errors.Annotatef(err, "create db connections of %s", source.InstanceID)
+		}
+		source.Conn = conn
+		df.sourceDBs[source.InstanceID] = source
+	}
+	df.targetDB = cfg.TargetDBCfg
+	conn, err := dbutil.OpenReadOnlyDB(df.targetDB.DBConfig)
+	if err != nil {
+		return nil, errors.Annotatef(err, "create db connections of target")
+	}
+	df.targetDB.Conn = conn
+
+	if err = df.AdjustTableConfig(cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var tables []*worker.TableConfig
+	for _, schemaTables := range df.tables {
+		for _, table := range schemaTables {
+			tableCfg := &worker.TableConfig{
+				Schema:        table.Schema,
+				Table:         table.Table,
+				Range:         table.Range,
+				IgnoreColumns: table.IgnoreColumns,
+			}
+			for _, sourceTable := range table.SourceTables {
+				if _, ok := sourceDBs[sourceTable.InstanceID]; !ok {
+					continue
+				}
+				tableCfg.SourceTables = append(tableCfg.SourceTables, &worker.TableRef{
+					InstanceID: sourceTable.InstanceID,
+					Schema:     sourceTable.Schema,
+					Table:      sourceTable.Table,
+					Range:      sourceTable.Range,
+				})
+			}
+			if len(tableCfg.SourceTables) == 0 {
+				log.Warn("the worker doesn't have the table's source tables, skip the table", zap.String("table", dbutil.TableName(table.Schema, table.Table)))
+				continue
+			}
+			tables = append(tables, tableCfg)
+		}
+	}
+
+	return tables, nil
+}
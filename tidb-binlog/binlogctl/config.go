@@ -16,7 +16,6 @@ package main
 import (
 	"crypto/tls"
 	"flag"
-	"fmt"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-tools/pkg/utils"
@@ -37,11 +36,13 @@ const (
 	offlinePump    = "offline-pump"
 	pauseDrainer   = "pause-drainer"
 	offlineDrainer = "offline-drainer"
+	exportTopo     = "export-topology"
+	applyTopo      = "apply-topology"
 )
 
 // Config holds the configuration of drainer
 type Config struct {
-	*flag.FlagSet
+	*flag.FlagSet `json:"-"`
 
 	Command      string `toml:"cmd" json:"cmd"`
 	NodeID       string `toml:"node-id" json:"node-id"`
@@ -52,6 +53,8 @@ type Config struct {
 	SSLCert      string `toml:"ssl-cert" json:"ssl-cert"`
 	SSLKey       string `toml:"ssl-key" json:"ssl-key"`
 	State        string `toml:"state" json:"state"`
+	TopologyFile string `toml:"topology-file" json:"topology-file"`
+	DryRun       bool   `toml:"dry-run" json:"dry-run"`
 	tls          *tls.Config
 	printVersion bool
 }
@@ -61,7 +64,7 @@ func NewConfig() *Config {
 	cfg := &Config{}
 	cfg.FlagSet = flag.NewFlagSet("binlogctl", flag.ContinueOnError)
 
-	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"offline-pump\", \"offline-drainer\"")
+	cfg.FlagSet.StringVar(&cfg.Command, "cmd", "pumps", "operator: \"generate_meta\", \"pumps\", \"drainers\", \"update-pump\", \"update-drainer\", \"pause-pump\", \"pause-drainer\", \"offline-pump\", \"offline-drainer\", \"export-topology\", \"apply-topology\"")
 	cfg.FlagSet.StringVar(&cfg.NodeID, "node-id", "", "id of node, use to update some node with operation update-pump, update-drainer, pause-pump, pause-drainer, offline-pump and offline-drainer")
 	cfg.FlagSet.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "meta directory path")
 	cfg.FlagSet.StringVar(&cfg.EtcdURLs, "pd-urls", defaultEtcdURLs, "a comma separated list of PD endpoints")
@@ -70,38 +73,32 @@ func NewConfig() *Config {
 	cfg.FlagSet.StringVar(&cfg.SSLKey, "ssl-key", "", "Path of file that contains X509 key in PEM format for connection with cluster components.")
 	cfg.FlagSet.StringVar(&cfg.TimeZone, "time-zone", "", "set time zone if you want save time info in savepoint file, for example `Asia/Shanghai` for CST time, `Local` for local time")
 	cfg.FlagSet.StringVar(&cfg.State, "state", "", "set node's state, can set to online, pausing, paused, closing or offline.")
+	cfg.FlagSet.StringVar(&cfg.TopologyFile, "topology-file", "", "the YAML file of the pumps' and drainers' states, export-topology writes to it or stdout if empty, and apply-topology reconciles the nodes toward it")
+	cfg.FlagSet.BoolVar(&cfg.DryRun, "dry-run", false, "only print the operations of apply-topology, don't change the nodes")
 	cfg.FlagSet.BoolVar(&cfg.printVersion, "V", false, "prints version and exit")
 
 	return cfg
 }
 
-// Parse parses all config from command-line flags, environment vars or the configuration file
+// Parse parses all config from command-line flags or environment vars prefixed with "BINLOGCTL_", like BINLOGCTL_PD_URLS
 func (cfg *Config) Parse(args []string) error {
-	// parse first to get config file
-	err := cfg.FlagSet.Parse(args)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	// parse command line options
-	if len(cfg.FlagSet.Args()) > 0 {
-		return errors.Errorf("'%s' is not a valid flag", cfg.FlagSet.Arg(0))
-	}
-
-	if cfg.printVersion {
-		fmt.Printf(utils.GetRawInfo("binlogctl"))
-		return flag.ErrHelp
-	}
+	binder := utils.NewConfigBinder(cfg.FlagSet, "BINLOGCTL_").
+		WithVersion(&cfg.printVersion, "binlogctl").
+		AddValidator(cfg.adjust).
+		AddValidator(cfg.validate)
+	return errors.Trace(binder.Parse(args))
+}
 
-	// adjust configuration
+// adjust adjusts the configuration and transforms the tls config
+func (cfg *Config) adjust() error {
 	adjustString(&cfg.DataDir, defaultDataDir)
 
-	// transfore tls config
+	var err error
 	cfg.tls, err = utils.ToTLSConfig(cfg.SSLCA, cfg.SSLCert, cfg.SSLKey)
 	if err != nil {
 		return errors.Errorf("tls config error %v", err)
 	}
-
-	return cfg.validate()
+	return nil
 }
 
 func adjustString(v *string, defValue string) {
@@ -117,5 +114,8 @@ func (cfg *Config) validate() error {
 	if err != nil {
 		return errors.Errorf("parse EtcdURLs error: %s, %v", cfg.EtcdURLs, err)
 	}
+	if cfg.Command == applyTopo && len(cfg.TopologyFile) == 0 {
+		return errors.Errorf("topology-file is required by %s", applyTopo)
+	}
 	return nil
 }
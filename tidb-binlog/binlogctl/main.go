@@ -17,6 +17,7 @@ import (
 	"flag"
 	"os"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb-tools/pkg/utils"
 	"github.com/pingcap/tidb-tools/tidb-binlog/node"
@@ -31,12 +32,13 @@ const (
 func main() {
 	cfg := NewConfig()
 	err := cfg.Parse(os.Args[1:])
-	switch err {
+	switch errors.Cause(err) {
 	case nil:
 	case flag.ErrHelp:
 		os.Exit(0)
 	default:
-		log.Error("parse cmd flags", zap.Error(err))
+		err = utils.ErrInvalidConfig.Wrap(err, "parse cmd flags")
+		log.Error("parse cmd flags", zap.Error(err), utils.ZapErrCode(err))
 		os.Exit(2)
 	}
 
@@ -59,10 +61,14 @@ func main() {
 		err = applyAction(cfg.EtcdURLs, node.PumpNode, cfg.NodeID, close)
 	case offlineDrainer:
 		err = applyAction(cfg.EtcdURLs, node.DrainerNode, cfg.NodeID, close)
+	case exportTopo:
+		err = exportTopology(cfg.EtcdURLs, cfg.TopologyFile)
+	case applyTopo:
+		err = applyTopology(cfg.EtcdURLs, cfg.TopologyFile, cfg.DryRun)
 	}
 
 	if err != nil {
-		log.Fatal("fail to execute command", zap.String("command", cfg.Command), zap.Error(err))
+		log.Fatal("fail to execute command", zap.String("command", cfg.Command), zap.Error(err), utils.ZapErrCode(err))
 	}
 
 	utils.SyncLog()
@@ -90,7 +90,7 @@ func createRegistry(urls string) (*node.EtcdRegistry, error) {
 	}
 	cli, err := etcd.NewClientFromCfg(ectdEndpoints, etcdDialTimeout, node.DefaultRootPath, nil)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, utils.ErrConnectEtcd.Wrap(err, "connect etcd %s", urls)
 	}
 
 	return node.NewEtcdRegistry(cli, etcdDialTimeout), nil
@@ -112,21 +112,26 @@ func applyAction(urls, kind, nodeID string, action string) error {
 			continue
 		}
 
-		client := &http.Client{}
-		url := fmt.Sprintf("http://%s/state/%s/%s", n.Addr, n.NodeID, action)
-		log.Debug("send put http request", zap.String("url", url))
-		req, err := http.NewRequest("PUT", url, nil)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		_, err = client.Do(req)
-		if err == nil {
-			log.Info("apply action on node success", zap.String("action", action), zap.String("NodeID", n.NodeID))
-			return nil
-		}
+		return errors.Trace(sendAction(n, action))
+	}
+
+	return errors.NotFoundf("nodeID %s", nodeID)
+}
 
+// sendAction sends the action to the node by http, the node will pause or close by itself.
+func sendAction(n *node.Status, action string) error {
+	client := &http.Client{}
+	url := fmt.Sprintf("http://%s/state/%s/%s", n.Addr, n.NodeID, action)
+	log.Debug("send put http request", zap.String("url", url))
+	req, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = client.Do(req)
+	if err != nil {
 		return errors.Trace(err)
 	}
 
-	return errors.NotFoundf("nodeID %s", nodeID)
+	log.Info("apply action on node success", zap.String("action", action), zap.String("NodeID", n.NodeID))
+	return nil
 }
@@ -0,0 +1,229 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb-tools/tidb-binlog/node"
+	"go.uber.org/zap"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Topology is the declarative state of the pump and drainer nodes, it can be exported from etcd, edited and applied
+// back, for example kept in git to manage the tidb-binlog nodes.
+type Topology struct {
+	Pumps    []*NodeState `yaml:"pumps"`
+	Drainers []*NodeState `yaml:"drainers"`
+}
+
+// NodeState is the state of a node in the topology.
+type NodeState struct {
+	NodeID string `yaml:"node-id"`
+	// the address is only informational, it's not applied
+	Addr string `yaml:"addr,omitempty"`
+	// online, paused or offline
+	State string `yaml:"state"`
+}
+
+// nodes returns the nodes of the kind.
+func (t *Topology) nodes(kind string) []*NodeState {
+	if kind == node.PumpNode {
+		return t.Pumps
+	}
+	return t.Drainers
+}
+
+// validate checks the nodes' states, the transitional states pausing and closing can't be applied.
+func (t *Topology) validate() error {
+	for _, kind := range []string{node.PumpNode, node.DrainerNode} {
+		nodeIDs := make(map[string]struct{})
+		for _, n := range t.nodes(kind) {
+			if len(n.NodeID) == 0 {
+				return errors.NotValidf("%s without node-id", kind)
+			}
+			if _, ok := nodeIDs[n.NodeID]; ok {
+				return errors.NotValidf("duplicated %s %s", kind, n.NodeID)
+			}
+			nodeIDs[n.NodeID] = struct{}{}
+
+			switch n.State {
+			case node.Online, node.Paused, node.Offline:
+			default:
+				return errors.NotValidf("state %s of %s %s, should be online, paused or offline", n.State, kind, n.NodeID)
+			}
+		}
+	}
+	return nil
+}
+
+// nodeOperation is an operation to change a node's state toward the topology.
+type nodeOperation struct {
+	kind   string
+	status *node.Status
+	state  string
+	// the action sent to the node by http, empty means the state is updated in etcd directly
+	action string
+}
+
+func (o *nodeOperation) String() string {
+	how := "update state in etcd"
+	if len(o.action) != 0 {
+		how = fmt.Sprintf("send %s to %s", o.action, o.status.Addr)
+	}
+	return fmt.Sprintf("%s %s: %s => %s, %s", o.kind, o.status.NodeID, o.status.State, o.state, how)
+}
+
+// exportTopology writes the registered pump and drainer nodes to the file in YAML, the empty path means stdout.
+func exportTopology(urls, path string) error {
+	registry, err := createRegistry(urls)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer registry.Close()
+
+	topology := &Topology{}
+	for _, kind := range []string{node.PumpNode, node.DrainerNode} {
+		nodes, _, err := registry.Nodes(context.Background(), node.NodePrefix[kind])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+
+		states := make([]*NodeState, 0, len(nodes))
+		for _, n := range nodes {
+			states = append(states, &NodeState{NodeID: n.NodeID, Addr: n.Addr, State: n.State})
+		}
+		if kind == node.PumpNode {
+			topology.Pumps = states
+		} else {
+			topology.Drainers = states
+		}
+	}
+
+	data, err := yaml.Marshal(topology)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(path) == 0 {
+		_, err = os.Stdout.Write(data)
+		return errors.Trace(err)
+	}
+
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("export topology", zap.String("file", path), zap.Int("pumps", len(topology.Pumps)), zap.Int("drainers", len(topology.Drainers)))
+	return nil
+}
+
+// applyTopology reconciles the registered nodes toward the topology in the file, the online nodes are paused or
+// closed by sending the action to them, and the other nodes' states are updated in etcd directly. the registered nodes
+// not in the topology are not changed. if dryRun is true, only logs the operations.
+func applyTopology(urls, path string, dryRun bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	topology := &Topology{}
+	if err = yaml.UnmarshalStrict(data, topology); err != nil {
+		return errors.Annotatef(err, "parse topology file %s", path)
+	}
+	if err = topology.validate(); err != nil {
+		return errors.Trace(err)
+	}
+
+	registry, err := createRegistry(urls)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer registry.Close()
+
+	for _, kind := range []string{node.PumpNode, node.DrainerNode} {
+		nodes, _, err := registry.Nodes(context.Background(), node.NodePrefix[kind])
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		operations, err := planNodeOperations(kind, nodes, topology.nodes(kind))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, operation := range operations {
+			log.Info("apply topology", zap.Stringer("operation", operation), zap.Bool("dry run", dryRun))
+			if dryRun {
+				continue
+			}
+
+			if len(operation.action) != 0 {
+				err = sendAction(operation.status, operation.action)
+			} else {
+				operation.status.State = operation.state
+				err = registry.UpdateNode(context.Background(), node.NodePrefix[kind], operation.status)
+			}
+			if err != nil {
+				return errors.Annotatef(err, "apply %s", operation)
+			}
+		}
+	}
+
+	return nil
+}
+
+// planNodeOperations returns the operations to change the registered nodes' states toward the desired states,
+// returns error if a desired node is not registered, or a paused or offline node is desired to be online, which can
+// only be done by restarting the node. the nodes in the transitional states pausing and closing are skipped.
+func planNodeOperations(kind string, registered []*node.Status, desired []*NodeState) ([]*nodeOperation, error) {
+	nodes := make(map[string]*node.Status, len(registered))
+	for _, n := range registered {
+		nodes[n.NodeID] = n
+	}
+
+	var operations []*nodeOperation
+	for _, state := range desired {
+		n, ok := nodes[state.NodeID]
+		if !ok {
+			return nil, errors.NotFoundf("%s %s", kind, state.NodeID)
+		}
+		if n.State == state.State {
+			continue
+		}
+
+		operation := &nodeOperation{kind: kind, status: n, state: state.State}
+		switch n.State {
+		case node.Online:
+			if state.State == node.Paused {
+				operation.action = pause
+			} else {
+				operation.action = close
+			}
+		case node.Paused, node.Offline:
+			if state.State == node.Online {
+				return nil, errors.Errorf("%s %s is %s, can't be changed to online, please restart the node instead", kind, n.NodeID, n.State)
+			}
+		default:
+			log.Warn("skip node in transitional state", zap.String("kind", kind), zap.String("node", n.NodeID), zap.String("state", n.State), zap.String("desired state", state.State))
+			continue
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/tidb-binlog/node"
+)
+
+func TestBinlogctl(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testTopologySuite{})
+
+type testTopologySuite struct{}
+
+func (s *testTopologySuite) TestPlanNodeOperations(c *C) {
+	testCases := []struct {
+		registered string
+		desired    string
+		// the operation's action, "-" means no operation
+		action string
+		errMsg string
+	}{
+		{node.Online, node.Online, "-", ""},
+		{node.Online, node.Paused, pause, ""},
+		{node.Online, node.Offline, close, ""},
+		{node.Paused, node.Offline, "", ""},
+		{node.Offline, node.Paused, "", ""},
+		{node.Paused, node.Online, "", ".*please restart the node instead"},
+		{node.Offline, node.Online, "", ".*please restart the node instead"},
+		{node.Pausing, node.Offline, "-", ""},
+		{node.Closing, node.Online, "-", ""},
+	}
+
+	for _, testCase := range testCases {
+		comment := Commentf("%s => %s", testCase.registered, testCase.desired)
+		registered := []*node.Status{{NodeID: "pump-1", Addr: "127.0.0.1:8250", State: testCase.registered}}
+		operations, err := planNodeOperations(node.PumpNode, registered, []*NodeState{{NodeID: "pump-1", State: testCase.desired}})
+		if len(testCase.errMsg) != 0 {
+			c.Assert(err, ErrorMatches, testCase.errMsg, comment)
+			continue
+		}
+		c.Assert(err, IsNil, comment)
+		if testCase.action == "-" {
+			c.Assert(operations, HasLen, 0, comment)
+			continue
+		}
+		c.Assert(operations, HasLen, 1, comment)
+		c.Assert(operations[0].action, Equals, testCase.action, comment)
+		c.Assert(operations[0].state, Equals, testCase.desired, comment)
+	}
+
+	// the desired node must be registered
+	_, err := planNodeOperations(node.PumpNode, nil, []*NodeState{{NodeID: "pump-1", State: node.Online}})
+	c.Assert(err, ErrorMatches, ".*not found")
+}